@@ -7,12 +7,14 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 
 	"github.com/ArtificialLegacy/imgscal/pkg/cli"
 	"github.com/ArtificialLegacy/imgscal/pkg/config"
 	"github.com/ArtificialLegacy/imgscal/pkg/statemachine"
 	"github.com/ArtificialLegacy/imgscal/pkg/states"
+	"github.com/akamensky/argparse"
 )
 
 func main() {
@@ -29,6 +31,7 @@ func main() {
 	sm.AddState(states.STATE_WORKFLOW_HELP, states.WorkflowHelp)
 	sm.AddState(states.STATE_WORKFLOW_CMD, states.WorkflowCMD)
 	sm.AddState(states.STATE_WORKFLOW_CMDLIST, states.WorkflowCMDList)
+	sm.AddState(states.STATE_WORKFLOW_BATCH, states.WorkflowBatch)
 
 	cfgDir, err := os.UserConfigDir()
 	if err != nil {
@@ -147,6 +150,35 @@ func main() {
 				fmt.Printf("%s'help' requires a workflow name to be specified!%s\n\n", cli.COLOR_RED, cli.COLOR_RESET)
 				os.Exit(1)
 			}
+		} else if pth == "run" {
+			// arguments after -- are passed to the workflow's cmd library.
+			args, wfArgs := os.Args[1:], []string{}
+			for i, arg := range args {
+				if arg == "--" {
+					args, wfArgs = args[:i], args[i+1:]
+					break
+				}
+			}
+
+			parser := argparse.NewParser("imgscal run", "Run a workflow headlessly over a batch of files.")
+			wf := parser.StringPositional(&argparse.Options{Required: true, Help: "Name of the workflow to run."})
+			input := parser.String("i", "input", &argparse.Options{Required: true, Help: "Glob of files to process, supports '**'."})
+			jobs := parser.Int("j", "jobs", &argparse.Options{Default: runtime.NumCPU(), Help: "Number of workflows to run at once"})
+			output := parser.String("o", "output", &argparse.Options{Help: "Directory to write output to, defaults to the workflow's output directory."})
+
+			err := parser.Parse(args)
+			if err != nil {
+				fmt.Printf("%s%s%s\n\n%s", cli.COLOR_RED, err, cli.COLOR_RESET, parser.Usage(nil))
+				os.Exit(1)
+			}
+
+			states.WorkflowBatchEnter(sm, states.WorkflowBatchData{
+				Name:   *wf,
+				Input:  *input,
+				Jobs:   *jobs,
+				Output: *output,
+				Args:   wfArgs,
+			})
 		} else {
 			states.WorkflowCMDEnter(sm, os.Args[1])
 		}
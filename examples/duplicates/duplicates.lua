@@ -0,0 +1,70 @@
+---@param workflow imgscal_WorkflowInit
+function init(workflow)
+	workflow.import({
+		"cmd",
+		"ref",
+		"cli",
+		"io",
+		"image",
+	})
+end
+
+function main()
+	local dirRef = cmd.arg_string_pos()
+	local thresholdRef = cmd.arg_int("t", "threshold")
+	local hashRef = cmd.arg_selector("a", "algorithm", { "phash", "ahash", "dhash", "whash" })
+
+	local ok, err = cmd.parse()
+
+	if not ok then
+		cli.print(cli.RED .. err .. cli.RESET)
+		return
+	end
+
+	-- default to a distance of 8, which catches resized and recompressed copies.
+	local threshold = ref.get(thresholdRef)
+	if threshold == 0 then
+		threshold = 8
+	end
+
+	local a = ref.get(hashRef)
+	local hash = image.HASH_PERCEPTUAL
+
+	if a == "ahash" then
+		hash = image.HASH_AVERAGE
+	elseif a == "dhash" then
+		hash = image.HASH_DIFFERENCE
+	elseif a == "whash" then
+		hash = image.HASH_WAVELET
+	end
+
+	local groups = io.dir_img_duplicates(ref.get(dirRef), {
+		hash = hash,
+		threshold = threshold,
+	})
+
+	if #groups == 0 then
+		cli.println("No duplicates found.")
+		return
+	end
+
+	for i, group in ipairs(groups) do
+		cli.println(cli.BOLD .. "Cluster " .. i .. " (" .. #group .. " images)" .. cli.RESET)
+		for _, pth in ipairs(group) do
+			cli.println("  " .. pth)
+		end
+	end
+end
+
+---@param info imgscal_WorkflowInfo
+function help(info)
+	return [[
+Usage:
+ >  duplicates <directory> [-t=threshold] [-a=algorithm]
+    * Prints each cluster of images that look alike.
+    * If threshold is omitted, it will default to 8.
+        * This is the largest number of bits that can differ between two hashes, out of 64.
+    * If algorithm is omitted, it will default to 'phash'.
+        * Valid algorithm values are: ['phash', 'ahash', 'dhash', 'whash'].
+    ]]
+end
@@ -41,6 +41,7 @@ type ItemImage struct {
 	Name     string
 	Encoding imageutil.ImageEncoding
 	Model    imageutil.ColorModel
+	Metadata *imageutil.Metadata
 }
 
 func (img ItemImage) Identifier() CollectionType { return TYPE_IMAGE }
@@ -64,14 +65,16 @@ type ItemTask struct {
 func (qr ItemTask) Identifier() CollectionType { return TYPE_TASK }
 
 type Item[T ItemSelf] struct {
-	Self *T
-	Lg   *log.Logger
-	wg   *sync.WaitGroup
+	Self  *T
+	Lg    *log.Logger
+	wg    *sync.WaitGroup
+	sched *Scheduler
 
 	cleaned bool
 	collect bool
 
 	currTask *Task[T]
+	holding  bool
 
 	failed bool
 	Err    error
@@ -79,7 +82,11 @@ type Item[T ItemSelf] struct {
 	TaskQueue chan *Task[T]
 }
 
-func NewItem[T ItemSelf](lg *log.Logger, wg *sync.WaitGroup, fn func(i *Item[T])) *Item[T] {
+func NewItem[T ItemSelf](lg *log.Logger, wg *sync.WaitGroup, sched *Scheduler, fn func(i *Item[T])) *Item[T] {
+	if sched == nil {
+		sched = defaultScheduler
+	}
+
 	i := &Item[T]{
 		Self:      nil,
 		Lg:        lg,
@@ -88,6 +95,7 @@ func NewItem[T ItemSelf](lg *log.Logger, wg *sync.WaitGroup, fn func(i *Item[T])
 		failed:    false,
 		TaskQueue: make(chan *Task[T], TASK_QUEUE_SIZE),
 		wg:        wg,
+		sched:     sched,
 	}
 
 	go i.process(fn)
@@ -99,6 +107,10 @@ func (i *Item[T]) process(fn func(i *Item[T])) {
 	defer func() {
 		if p := recover(); p != nil {
 			i.Lg.Append(fmt.Sprintf("recovered from panic within collection item: %+v\n%s", p, debug.Stack()), log.LEVEL_ERROR)
+			if i.holding {
+				i.holding = false
+				i.sched.release()
+			}
 			if fn != nil {
 				fn(i)
 			}
@@ -126,14 +138,22 @@ func (i *Item[T]) process(fn func(i *Item[T])) {
 	}()
 
 	for {
-		if len(i.TaskQueue) == 0 {
-			continue
+		i.currTask = <-i.TaskQueue
+
+		if !i.currTask.unbounded {
+			i.sched.acquire()
+			i.holding = true
 		}
 
-		i.currTask = <-i.TaskQueue
 		i.Lg.Append(fmt.Sprintf("%s.%s task called", i.currTask.Lib, i.currTask.Name), log.LEVEL_VERBOSE)
 		i.currTask.Fn(i)
 		i.Lg.Append(fmt.Sprintf("%s.%s task finished", i.currTask.Lib, i.currTask.Name), log.LEVEL_VERBOSE)
+
+		if i.holding {
+			i.holding = false
+			i.sched.release()
+		}
+
 		i.currTask = nil
 		i.wg.Done()
 
@@ -144,12 +164,42 @@ func (i *Item[T]) process(fn func(i *Item[T])) {
 	}
 }
 
+// Wait blocks until a value is received from ch, releasing the worker held by the current task in the meantime.
+// Tasks that wait on tasks from other items must use this to avoid starving the scheduler.
+func (i *Item[T]) Wait(ch <-chan struct{}) {
+	i.yield(func() { <-ch })
+}
+
+// WaitGroup is the same as Wait, but blocks until wg is done.
+func (i *Item[T]) WaitGroup(wg *sync.WaitGroup) {
+	i.yield(wg.Wait)
+}
+
+func (i *Item[T]) yield(fn func()) {
+	if !i.holding {
+		fn()
+		return
+	}
+
+	i.holding = false
+	i.sched.release()
+
+	fn()
+
+	i.sched.acquire()
+	i.holding = true
+}
+
 type Task[T ItemSelf] struct {
 	Fn   func(i *Item[T])
 	Fail func(i *Item[T])
 
 	Lib  string
 	Name string
+
+	// set for tasks scheduled from within another task,
+	// these run without a worker as the parent task is already holding one.
+	unbounded bool
 }
 
 type Collection[T ItemSelf] struct {
@@ -161,6 +211,7 @@ type Collection[T ItemSelf] struct {
 	Errs []error
 
 	onCollect func(i *Item[T])
+	sched     *Scheduler
 
 	Identifier CollectionType
 }
@@ -171,6 +222,7 @@ func NewCollection[T ItemSelf](lg *log.Logger, wg *sync.WaitGroup, identifier Co
 		lg:         lg,
 		Errs:       []error{},
 		wg:         wg,
+		sched:      defaultScheduler,
 		Identifier: identifier,
 	}
 }
@@ -180,8 +232,14 @@ func (c *Collection[T]) OnCollect(fn func(i *Item[T])) *Collection[T] {
 	return c
 }
 
+// UseScheduler sets the scheduler used by items added to the collection after this call.
+func (c *Collection[T]) UseScheduler(sched *Scheduler) *Collection[T] {
+	c.sched = sched
+	return c
+}
+
 func (c *Collection[T]) AddItem(lg *log.Logger) int {
-	item := NewItem(lg, c.wg, c.onCollect)
+	item := NewItem(lg, c.wg, c.sched, c.onCollect)
 	id := len(c.items)
 
 	c.items = append(c.items, item)
@@ -241,6 +299,8 @@ func (c *Collection[T]) Schedule(state *golua.LState, id int, tk *Task[T]) <-cha
 		return wait
 	}
 
+	ctx := state.Context()
+
 	task := &Task[T]{
 		Lib:  tk.Lib,
 		Name: tk.Name,
@@ -254,6 +314,7 @@ func (c *Collection[T]) Schedule(state *golua.LState, id int, tk *Task[T]) <-cha
 			}
 			wait <- struct{}{}
 		},
+		unbounded: InTask(ctx),
 	}
 
 	item := c.items[id]
@@ -264,7 +325,6 @@ func (c *Collection[T]) Schedule(state *golua.LState, id int, tk *Task[T]) <-cha
 		return wait
 	}
 
-	ctx := state.Context()
 	nested := SearchContext(ctx, id, c.Identifier)
 
 	if !nested {
@@ -343,6 +403,12 @@ func SearchContext(ctx context.Context, id int, identifier CollectionType) bool
 	return false
 }
 
+// InTask reports if the context belongs to a thread created within a scheduled task.
+func InTask(ctx context.Context) bool {
+	stack, ok := ctx.Value(CONTEXT_STACK).([]StackContext)
+	return ok && len(stack) > 0
+}
+
 func (c *Collection[T]) IDValid(id int) bool {
 	return id >= 0 && id < len(c.items)
 }
@@ -387,7 +453,7 @@ func (c *Collection[T]) SchedulePipe(state *golua.LState, id1, id2 int, tk1, tk2
 			Fn: func(i *Item[T]) {
 				tk1.Fn(i)
 				ready <- struct{}{}
-				<-finished
+				i.Wait(finished)
 			},
 			Fail: func(i *Item[T]) {
 				if tk1.Fail != nil {
@@ -400,7 +466,7 @@ func (c *Collection[T]) SchedulePipe(state *golua.LState, id1, id2 int, tk1, tk2
 			Lib:  tk2.Lib,
 			Name: tk2.Name,
 			Fn: func(i *Item[T]) {
-				<-ready
+				i.Wait(ready)
 				tk2.Fn(i)
 				finished <- struct{}{}
 				wait <- struct{}{}
@@ -0,0 +1,73 @@
+package collection
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Scheduler limits how many tasks can run at the same time across all items that share it.
+// Items still run their own tasks in order, the scheduler only decides when they can start.
+type Scheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	limit   int
+	running int
+}
+
+// NewScheduler creates a scheduler allowing up to workers tasks to run at once,
+// a value less than 1 defaults to GOMAXPROCS.
+func NewScheduler(workers int) *Scheduler {
+	s := &Scheduler{}
+	s.cond = sync.NewCond(&s.mu)
+	s.SetLimit(workers)
+
+	return s
+}
+
+// SetLimit changes the amount of tasks allowed to run at once,
+// a value less than 1 defaults to GOMAXPROCS.
+func (s *Scheduler) SetLimit(workers int) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	s.mu.Lock()
+	s.limit = workers
+	s.mu.Unlock()
+
+	s.cond.Broadcast()
+}
+
+func (s *Scheduler) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.limit
+}
+
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+func (s *Scheduler) acquire() {
+	s.mu.Lock()
+	for s.running >= s.limit {
+		s.cond.Wait()
+	}
+	s.running++
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+
+	s.cond.Signal()
+}
+
+var defaultScheduler = NewScheduler(0)
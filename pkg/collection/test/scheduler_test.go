@@ -0,0 +1,242 @@
+package test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	golua "github.com/yuin/gopher-lua"
+)
+
+func newSchedulerCollection(workers int) (*collection.Collection[ItemString], *sync.WaitGroup, *golua.LState) {
+	lg := log.NewLoggerEmpty()
+	wg := &sync.WaitGroup{}
+	c := collection.NewCollection[ItemString](&lg, wg, TYPE_STRING).UseScheduler(collection.NewScheduler(workers))
+	state := golua.NewState(golua.Options{
+		SkipOpenLibs: true,
+	})
+	collection.CreateContext(state)
+
+	return c, wg, state
+}
+
+func emptyLogger() *log.Logger {
+	lg := log.NewLoggerEmpty()
+	return &lg
+}
+
+func TestSchedulerLimit(t *testing.T) {
+	const workers = 2
+	const items = 8
+
+	c, wg, state := newSchedulerCollection(workers)
+
+	var running, peak atomic.Int32
+
+	for range items {
+		id := c.AddItem(emptyLogger())
+		c.Schedule(state, id, &collection.Task[ItemString]{
+			Lib:  "test",
+			Name: "limit",
+			Fn: func(i *collection.Item[ItemString]) {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+			},
+		})
+	}
+
+	wg.Wait()
+
+	if peak.Load() > workers {
+		t.Errorf("too many tasks ran at once, expected<=%d got=%d", workers, peak.Load())
+	}
+}
+
+func TestSchedulerPipeSingleWorker(t *testing.T) {
+	timeout := time.After(5 * time.Second)
+	done := make(chan struct{})
+
+	const expected = "test_value"
+	value := ""
+
+	go func() {
+		c, wg, state := newSchedulerCollection(1)
+
+		id1 := c.AddItem(emptyLogger())
+		id2 := c.AddItem(emptyLogger())
+
+		c.Schedule(state, id1, &collection.Task[ItemString]{
+			Lib:  "test",
+			Name: "add",
+			Fn: func(i *collection.Item[ItemString]) {
+				i.Self = &ItemString{Value: expected}
+			},
+		})
+
+		var got string
+		<-c.SchedulePipe(state, id1, id2,
+			&collection.Task[ItemString]{
+				Lib:  "test",
+				Name: "from",
+				Fn: func(i *collection.Item[ItemString]) {
+					got = i.Self.Value
+				},
+			},
+			&collection.Task[ItemString]{
+				Lib:  "test",
+				Name: "to",
+				Fn: func(i *collection.Item[ItemString]) {
+					i.Self = &ItemString{Value: got}
+					value = i.Self.Value
+				},
+			})
+
+		wg.Wait()
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+		if value != expected {
+			t.Errorf("got wrong item after pipe, expected=%s got=%s", expected, value)
+		}
+	case <-timeout:
+		t.Fatal("test timed out, scheduler deadlocked")
+	}
+}
+
+func TestSchedulerWaitSingleWorker(t *testing.T) {
+	timeout := time.After(5 * time.Second)
+	done := make(chan struct{})
+
+	go func() {
+		c, wg, state := newSchedulerCollection(1)
+
+		ready := make(chan struct{}, 1)
+
+		id1 := c.AddItem(emptyLogger())
+		id2 := c.AddItem(emptyLogger())
+
+		c.Schedule(state, id1, &collection.Task[ItemString]{
+			Lib:  "test",
+			Name: "waiting",
+			Fn: func(i *collection.Item[ItemString]) {
+				i.Wait(ready)
+			},
+		})
+		c.Schedule(state, id2, &collection.Task[ItemString]{
+			Lib:  "test",
+			Name: "signal",
+			Fn: func(i *collection.Item[ItemString]) {
+				ready <- struct{}{}
+			},
+		})
+
+		wg.Wait()
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+	case <-timeout:
+		t.Fatal("test timed out, scheduler deadlocked")
+	}
+}
+
+// TestSchedulerHandoffSingleWorker follows context.new_direct, where a task signals another item
+// before that item's task has started, then waits for it to finish.
+func TestSchedulerHandoffSingleWorker(t *testing.T) {
+	timeout := time.After(5 * time.Second)
+	done := make(chan struct{})
+
+	const expected = "test_value"
+	value := ""
+
+	go func() {
+		c, wg, state := newSchedulerCollection(1)
+
+		ready := make(chan struct{}, 2)
+		finish := make(chan struct{}, 2)
+		shared := ""
+
+		id1 := c.AddItem(emptyLogger())
+		id2 := c.AddItem(emptyLogger())
+
+		c.Schedule(state, id1, &collection.Task[ItemString]{
+			Lib:  "test",
+			Name: "source",
+			Fn: func(i *collection.Item[ItemString]) {
+				shared = expected
+				ready <- struct{}{}
+				i.Wait(finish)
+			},
+		})
+		c.Schedule(state, id2, &collection.Task[ItemString]{
+			Lib:  "test",
+			Name: "target",
+			Fn: func(i *collection.Item[ItemString]) {
+				i.Wait(ready)
+				value = shared
+				finish <- struct{}{}
+			},
+		})
+
+		wg.Wait()
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+		if value != expected {
+			t.Errorf("got wrong value after handoff, expected=%s got=%s", expected, value)
+		}
+	case <-timeout:
+		t.Fatal("test timed out, scheduler deadlocked")
+	}
+}
+
+// BenchmarkThroughput schedules small tasks across 64 items and waits for all of them to finish.
+func BenchmarkThroughput(b *testing.B) {
+	const items = 64
+	const tasks = 16
+
+	c, wg, state := newSchedulerCollection(0)
+
+	ids := make([]int, items)
+	for ind := range items {
+		ids[ind] = c.AddItem(emptyLogger())
+	}
+
+	b.ResetTimer()
+
+	for range b.N {
+		for range tasks {
+			for _, id := range ids {
+				c.Schedule(state, id, &collection.Task[ItemString]{
+					Lib:  "test",
+					Name: "throughput",
+					Fn: func(i *collection.Item[ItemString]) {
+						sum := 0
+						for n := range 1000 {
+							sum += n
+						}
+						i.Self = &ItemString{Value: string(rune(sum % 128))}
+					},
+				})
+			}
+		}
+
+		wg.Wait()
+	}
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func cpuTime() time.Duration {
+	usage := syscall.Rusage{}
+	syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// BenchmarkIdleItems reports the cpu time used while 64 items sit idle with empty task queues.
+func BenchmarkIdleItems(b *testing.B) {
+	const items = 64
+	const idle = 50 * time.Millisecond
+
+	c, _, _ := newSchedulerCollection(0)
+	for range items {
+		c.AddItem(emptyLogger())
+	}
+
+	b.ResetTimer()
+
+	var used time.Duration
+	for range b.N {
+		start := cpuTime()
+		time.Sleep(idle)
+		used += cpuTime() - start
+	}
+
+	b.ReportMetric(float64(used)/float64(time.Duration(b.N)*idle)*100, "%cpu")
+}
@@ -22,6 +22,10 @@ type Config struct {
 	DisableLogs       bool   `json:"disable_logs"`
 	AlwaysConfirm     bool   `json:"always_confirm"`
 	DisableBell       bool   `json:"disable_bell"`
+	MaxWorkers        int    `json:"max_workers"`
+	DecodeMaxPixels   int    `json:"decode_max_pixels"`
+	DecodeMaxBytes    int64  `json:"decode_max_bytes"`
+	DecodeMaxFrames   int    `json:"decode_max_frames"`
 }
 
 func NewConfig() *Config {
@@ -44,5 +48,9 @@ func NewConfigWithDefaults(homeDir string) *Config {
 		DisableLogs:       false,
 		AlwaysConfirm:     false,
 		DisableBell:       false,
+		MaxWorkers:        0,
+		DecodeMaxPixels:   0,
+		DecodeMaxBytes:    0,
+		DecodeMaxFrames:   0,
 	}
 }
@@ -0,0 +1,163 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+)
+
+// Animation mirrors gif.GIF without the palette limit, so it can be shared by APNG and WebP.
+// Frames are placed on the canvas by their bounds and drawn over the previous frame,
+// Delay is in 100ths of a second, Disposal uses the gif.Disposal values,
+// and LoopCount follows the same rules as gif.GIF.
+type Animation struct {
+	Frames          []image.Image
+	Delay           []int
+	Disposal        []byte
+	LoopCount       int
+	BackgroundIndex byte
+}
+
+func AnimationFromGIF(gf *gif.GIF) *Animation {
+	frames := make([]image.Image, len(gf.Image))
+	for i, v := range gf.Image {
+		frames[i] = v
+	}
+
+	return &Animation{
+		Frames:          frames,
+		Delay:           gf.Delay,
+		Disposal:        gf.Disposal,
+		LoopCount:       gf.LoopCount,
+		BackgroundIndex: gf.BackgroundIndex,
+	}
+}
+
+func (a *Animation) Validate() error {
+	if len(a.Frames) == 0 {
+		return fmt.Errorf("animation has no frames")
+	}
+	if len(a.Delay) != len(a.Frames) {
+		return fmt.Errorf("animation has %d frames but %d delays", len(a.Frames), len(a.Delay))
+	}
+	if a.Disposal != nil && len(a.Disposal) != len(a.Frames) {
+		return fmt.Errorf("animation has %d frames but %d disposals", len(a.Frames), len(a.Disposal))
+	}
+
+	for i, f := range a.Frames {
+		if f == nil {
+			return fmt.Errorf("animation frame %d is missing", i)
+		}
+
+		b := f.Bounds()
+		if b.Min.X < 0 || b.Min.Y < 0 {
+			return fmt.Errorf("animation frame %d has negative bounds: %s", i, b)
+		}
+		if b.Empty() {
+			return fmt.Errorf("animation frame %d is empty", i)
+		}
+	}
+
+	return nil
+}
+
+// Canvas is the union of all frame bounds, starting at (0,0).
+func (a *Animation) Canvas() image.Rectangle {
+	canvas := image.Rectangle{}
+	for _, f := range a.Frames {
+		canvas = canvas.Union(f.Bounds())
+	}
+
+	return image.Rect(0, 0, canvas.Max.X, canvas.Max.Y)
+}
+
+func (a *Animation) disposal(i int) byte {
+	if a.Disposal == nil {
+		return gif.DisposalNone
+	}
+	return a.Disposal[i]
+}
+
+// loop counts in apng and webp are the number of times to play, with 0 being forever.
+func loopCountToPlays(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount < 0:
+		return 1
+	}
+	return loopCount + 1
+}
+
+func playsToLoopCount(plays int) int {
+	switch plays {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	}
+	return plays - 1
+}
+
+// animationCompositor renders frames that only cover part of the canvas,
+// each decoded frame is returned as a full copy of the canvas.
+type animationCompositor struct {
+	canvas   *image.NRGBA
+	previous *image.NRGBA
+
+	disposeRect image.Rectangle
+	dispose     byte
+}
+
+func newAnimationCompositor(width, height int) *animationCompositor {
+	return &animationCompositor{
+		canvas:  image.NewNRGBA(image.Rect(0, 0, width, height)),
+		dispose: gif.DisposalNone,
+	}
+}
+
+// frame draws img at its bounds, blend controls if it is drawn over the canvas or replaces it.
+// The disposal is applied before the next frame is drawn.
+func (c *animationCompositor) frame(img image.Image, blend bool, dispose byte) image.Image {
+	switch c.dispose {
+	case gif.DisposalBackground:
+		draw.Draw(c.canvas, c.disposeRect, image.Transparent, image.Point{}, draw.Src)
+	case gif.DisposalPrevious:
+		if c.previous != nil {
+			draw.Draw(c.canvas, c.disposeRect, c.previous, c.disposeRect.Min, draw.Src)
+		}
+	}
+
+	if dispose == gif.DisposalPrevious {
+		c.previous = cloneNRGBA(c.canvas)
+	}
+
+	op := draw.Over
+	if !blend {
+		op = draw.Src
+	}
+	draw.Draw(c.canvas, img.Bounds(), img, img.Bounds().Min, op)
+
+	c.disposeRect = img.Bounds()
+	c.dispose = dispose
+
+	return cloneNRGBA(c.canvas)
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	c := image.NewNRGBA(img.Rect)
+	copy(c.Pix, img.Pix)
+	return c
+}
+
+// animationFrameNRGBA converts a frame to NRGBA, keeping its bounds.
+func animationFrameNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok {
+		return n
+	}
+
+	n := image.NewNRGBA(img.Bounds())
+	draw.Draw(n, n.Rect, img, n.Rect.Min, draw.Src)
+	return n
+}
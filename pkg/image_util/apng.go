@@ -0,0 +1,398 @@
+package imageutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+const (
+	apngDisposeNone uint8 = iota
+	apngDisposeBackground
+	apngDisposePrevious
+)
+
+const (
+	apngBlendSource uint8 = iota
+	apngBlendOver
+)
+
+type apngFrame struct {
+	rect    image.Rectangle
+	delay   int
+	dispose uint8
+	blend   uint8
+	data    []byte
+}
+
+// APNGDecode decodes all frames of an APNG, composited onto the full canvas.
+// A PNG without animation is returned as a single frame.
+func APNGDecode(r io.Reader, limits DecodeLimits) (*Animation, error) {
+	data, err := limits.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("invalid png")
+	}
+
+	var ihdr []byte
+	// chunks that each frame needs to decode, such as the palette.
+	shared := []byte{}
+	frames := []*apngFrame{}
+	var current *apngFrame
+	plays := 0
+	animated := false
+
+	p := len(magic)
+	for p+8 <= len(data) {
+		ln := int(binary.BigEndian.Uint32(data[p : p+4]))
+		typ := string(data[p+4 : p+8])
+		if p+12+ln > len(data) {
+			return nil, fmt.Errorf("invalid png chunk length at %d", p)
+		}
+		chunk := data[p+8 : p+8+ln]
+		raw := data[p : p+12+ln]
+		p += 12 + ln
+
+		switch typ {
+		case "IHDR":
+			if ln != 13 {
+				return nil, fmt.Errorf("invalid png IHDR chunk")
+			}
+			ihdr = chunk
+			if err := limits.CheckPixels(int(binary.BigEndian.Uint32(ihdr[0:4])), int(binary.BigEndian.Uint32(ihdr[4:8]))); err != nil {
+				return nil, err
+			}
+		case "PLTE", "tRNS", "gAMA", "sBIT", "cHRM", "sRGB", "iCCP":
+			shared = append(shared, raw...)
+		case "acTL":
+			if ln != 8 {
+				return nil, fmt.Errorf("invalid apng acTL chunk")
+			}
+			animated = true
+			plays = int(binary.BigEndian.Uint32(chunk[4:8]))
+			if err := limits.CheckFrames(int(binary.BigEndian.Uint32(chunk[0:4]))); err != nil {
+				return nil, err
+			}
+		case "fcTL":
+			if ln != 26 {
+				return nil, fmt.Errorf("invalid apng fcTL chunk")
+			}
+			w := int(binary.BigEndian.Uint32(chunk[4:8]))
+			h := int(binary.BigEndian.Uint32(chunk[8:12]))
+			x := int(binary.BigEndian.Uint32(chunk[12:16]))
+			y := int(binary.BigEndian.Uint32(chunk[16:20]))
+			num := int(binary.BigEndian.Uint16(chunk[20:22]))
+			den := int(binary.BigEndian.Uint16(chunk[22:24]))
+			if den == 0 {
+				den = 100
+			}
+
+			current = &apngFrame{
+				rect:    image.Rect(x, y, x+w, y+h),
+				delay:   (num*100 + den/2) / den,
+				dispose: chunk[24],
+				blend:   chunk[25],
+			}
+			frames = append(frames, current)
+			if err := limits.CheckFrames(len(frames)); err != nil {
+				return nil, err
+			}
+		case "IDAT":
+			// the default image is only part of the animation when a fcTL comes before it.
+			if current != nil {
+				current.data = append(current.data, chunk...)
+			} else if !animated {
+				return apngStill(data)
+			}
+		case "fdAT":
+			if current == nil || ln < 4 {
+				return nil, fmt.Errorf("invalid apng fdAT chunk")
+			}
+			current.data = append(current.data, chunk[4:]...)
+		case "IEND":
+			p = len(data)
+		}
+	}
+
+	if ihdr == nil {
+		return nil, fmt.Errorf("png is missing IHDR chunk")
+	}
+	if !animated || len(frames) == 0 {
+		return apngStill(data)
+	}
+
+	width := int(binary.BigEndian.Uint32(ihdr[0:4]))
+	height := int(binary.BigEndian.Uint32(ihdr[4:8]))
+	for i, f := range frames {
+		if err := animationCheckFrame(f.rect, width, height); err != nil {
+			return nil, fmt.Errorf("invalid apng frame %d: %s", i, err)
+		}
+	}
+
+	comp := newAnimationCompositor(width, height)
+
+	anim := &Animation{
+		Frames:    make([]image.Image, len(frames)),
+		Delay:     make([]int, len(frames)),
+		Disposal:  make([]byte, len(frames)),
+		LoopCount: playsToLoopCount(plays),
+	}
+
+	for i, f := range frames {
+		img, err := apngFrameDecode(ihdr, shared, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode apng frame %d: %s", i, err)
+		}
+
+		dispose := gif.DisposalNone
+		switch f.dispose {
+		case apngDisposeBackground:
+			dispose = gif.DisposalBackground
+		case apngDisposePrevious:
+			// the first frame has nothing to restore to.
+			if i == 0 {
+				dispose = gif.DisposalBackground
+			} else {
+				dispose = gif.DisposalPrevious
+			}
+		}
+
+		anim.Frames[i] = comp.frame(img, f.blend == apngBlendOver, byte(dispose))
+		anim.Delay[i] = f.delay
+		// frames are already composited, so each one replaces the last.
+		anim.Disposal[i] = gif.DisposalBackground
+	}
+
+	return anim, nil
+}
+
+func apngStill(data []byte) (*Animation, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Animation{
+		Frames:   []image.Image{img},
+		Delay:    []int{0},
+		Disposal: []byte{gif.DisposalNone},
+	}, nil
+}
+
+// apngFrameDecode wraps the frame data as a standalone png so it can use the png decoder.
+func apngFrameDecode(ihdr, shared []byte, f *apngFrame) (image.Image, error) {
+	header := bytes.Clone(ihdr)
+	binary.BigEndian.PutUint32(header[0:4], uint32(f.rect.Dx()))
+	binary.BigEndian.PutUint32(header[4:8], uint32(f.rect.Dy()))
+
+	b := []byte(magic)
+	b = append(b, pngChunk("IHDR", header)...)
+	b = append(b, shared...)
+	b = append(b, pngChunk("IDAT", f.data)...)
+	b = append(b, pngChunk("IEND", nil)...)
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	n := image.NewNRGBA(f.rect)
+	draw.Draw(n, f.rect, img, image.Point{}, draw.Src)
+	return n, nil
+}
+
+// APNGEncode writes the animation as an 8-bit RGBA APNG.
+func APNGEncode(w io.Writer, anim *Animation, options *EncodeOptions) error {
+	if options == nil {
+		options = DefaultEncodeOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if err := anim.Validate(); err != nil {
+		return err
+	}
+
+	canvas := anim.Canvas()
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(canvas.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(canvas.Dy()))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:4], uint32(len(anim.Frames)))
+	binary.BigEndian.PutUint32(actl[4:8], uint32(loopCountToPlays(anim.LoopCount)))
+
+	b := []byte(magic)
+	b = append(b, pngChunk("IHDR", ihdr)...)
+	b = append(b, pngChunk("acTL", actl)...)
+
+	seq := uint32(0)
+
+	for i, f := range anim.Frames {
+		frame := animationFrameNRGBA(f)
+
+		// the first frame is also the default image, so it must cover the canvas.
+		if i == 0 && frame.Rect != canvas {
+			full := image.NewNRGBA(canvas)
+			draw.Draw(full, frame.Rect, frame, frame.Rect.Min, draw.Src)
+			frame = full
+		}
+
+		dispose := apngDisposeNone
+		switch anim.disposal(i) {
+		case gif.DisposalBackground:
+			dispose = apngDisposeBackground
+		case gif.DisposalPrevious:
+			dispose = apngDisposePrevious
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:4], seq)
+		binary.BigEndian.PutUint32(fctl[4:8], uint32(frame.Rect.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:12], uint32(frame.Rect.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:16], uint32(frame.Rect.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:20], uint32(frame.Rect.Min.Y))
+		binary.BigEndian.PutUint16(fctl[20:22], uint16(anim.Delay[i]))
+		binary.BigEndian.PutUint16(fctl[22:24], 100)
+		fctl[24] = dispose
+		fctl[25] = apngBlendOver
+		b = append(b, pngChunk("fcTL", fctl)...)
+		seq++
+
+		data, err := apngFrameData(frame, options.PNGCompression)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			b = append(b, pngChunk("IDAT", data)...)
+		} else {
+			fdat := binary.BigEndian.AppendUint32(nil, seq)
+			b = append(b, pngChunk("fdAT", append(fdat, data...))...)
+			seq++
+		}
+	}
+
+	b = append(b, pngChunk("IEND", nil)...)
+
+	_, err := w.Write(b)
+	return err
+}
+
+func apngZlibLevel(level png.CompressionLevel) int {
+	switch level {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	}
+	return zlib.DefaultCompression
+}
+
+// apngFrameData filters and compresses the rows of the frame,
+// the png encoder can't be used as it picks the color type per image.
+func apngFrameData(img *image.NRGBA, level png.CompressionLevel) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw, err := zlib.NewWriterLevel(buf, apngZlibLevel(level))
+	if err != nil {
+		return nil, err
+	}
+
+	const bpp = 4
+	stride := img.Rect.Dx() * bpp
+	prev := make([]byte, stride)
+	filtered := make([][]byte, 5)
+	for i := range filtered {
+		filtered[i] = make([]byte, stride+1)
+		filtered[i][0] = byte(i)
+	}
+
+	for y := range img.Rect.Dy() {
+		row := img.Pix[y*img.Stride : y*img.Stride+stride]
+
+		for x := range stride {
+			var a, c byte
+			if x >= bpp {
+				a = row[x-bpp]
+				c = prev[x-bpp]
+			}
+			up := prev[x]
+
+			filtered[0][x+1] = row[x]
+			filtered[1][x+1] = row[x] - a
+			filtered[2][x+1] = row[x] - up
+			filtered[3][x+1] = row[x] - byte((int(a)+int(up))/2)
+			filtered[4][x+1] = row[x] - paeth(a, up, c)
+		}
+
+		// pick the filter with the smallest sum of absolute differences, the same heuristic as the png encoder.
+		best := 0
+		bestSum := -1
+		for i, f := range filtered {
+			sum := 0
+			for _, v := range f[1:] {
+				sum += absByte(v)
+			}
+			if bestSum < 0 || sum < bestSum {
+				best = i
+				bestSum = sum
+			}
+		}
+
+		_, err := zw.Write(filtered[best])
+		if err != nil {
+			return nil, err
+		}
+
+		copy(prev, row)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa := absInt(p - int(a))
+	pb := absInt(p - int(b))
+	pc := absInt(p - int(c))
+
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func absByte(v byte) int {
+	if v < 128 {
+		return int(v)
+	}
+	return 256 - int(v)
+}
@@ -0,0 +1,798 @@
+package imageutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+)
+
+type AsepriteLayerType int
+
+const (
+	ASEPRITELAYER_IMAGE AsepriteLayerType = iota
+	ASEPRITELAYER_GROUP
+	ASEPRITELAYER_TILEMAP
+)
+
+type AsepriteBlend int
+
+const (
+	ASEPRITEBLEND_NORMAL AsepriteBlend = iota
+	ASEPRITEBLEND_MULTIPLY
+	ASEPRITEBLEND_SCREEN
+	ASEPRITEBLEND_OVERLAY
+	ASEPRITEBLEND_DARKEN
+	ASEPRITEBLEND_LIGHTEN
+	ASEPRITEBLEND_COLOR_DODGE
+	ASEPRITEBLEND_COLOR_BURN
+	ASEPRITEBLEND_HARD_LIGHT
+	ASEPRITEBLEND_SOFT_LIGHT
+	ASEPRITEBLEND_DIFFERENCE
+	ASEPRITEBLEND_EXCLUSION
+	ASEPRITEBLEND_HUE
+	ASEPRITEBLEND_SATURATION
+	ASEPRITEBLEND_COLOR
+	ASEPRITEBLEND_LUMINOSITY
+	ASEPRITEBLEND_ADDITION
+	ASEPRITEBLEND_SUBTRACT
+	ASEPRITEBLEND_DIVIDE
+)
+
+type AsepriteDirection int
+
+const (
+	ASEPRITEDIRECTION_FORWARD AsepriteDirection = iota
+	ASEPRITEDIRECTION_REVERSE
+	ASEPRITEDIRECTION_PINGPONG
+	ASEPRITEDIRECTION_PINGPONG_REVERSE
+)
+
+const (
+	aseMagic      = 0xA5E0
+	aseFrameMagic = 0xF1FA
+
+	aseHeaderSize      = 128
+	aseFrameHeaderSize = 16
+	aseChunkHeaderSize = 6
+)
+
+const (
+	aseChunkOldPalette   = 0x0004
+	aseChunkOldPalette64 = 0x0011
+	aseChunkLayer        = 0x2004
+	aseChunkCel          = 0x2005
+	aseChunkTags         = 0x2018
+	aseChunkPalette      = 0x2019
+	aseChunkSlice        = 0x2022
+)
+
+const (
+	aseFlagLayerOpacity = 1
+	aseFlagLayerUUID    = 4
+)
+
+const (
+	aseLayerVisible    = 1
+	aseLayerBackground = 8
+	aseLayerReference  = 64
+)
+
+const (
+	aseCelRaw        = 0
+	aseCelLinked     = 1
+	aseCelCompressed = 2
+)
+
+const (
+	aseSliceNineSlice = 1
+	aseSlicePivot     = 2
+)
+
+type AsepriteLayer struct {
+	Name    string
+	Type    AsepriteLayerType
+	Blend   AsepriteBlend
+	Opacity uint8
+	// Visible is the layer's own flag, a layer inside a hidden group is still marked as visible.
+	Visible    bool
+	Background bool
+	Reference  bool
+	// Level is the depth of the layer in the group tree, Parent is -1 for top level layers.
+	Level  int
+	Parent int
+}
+
+// AsepriteCel is the content of a layer on one frame.
+// Linked cels share the image of the cel they link to.
+type AsepriteCel struct {
+	Layer   int
+	Opacity uint8
+	ZIndex  int
+	// Image bounds are the position of the cel on the canvas, and may be outside of it.
+	Image *image.NRGBA
+}
+
+type AsepriteFrame struct {
+	// Duration is in milliseconds.
+	Duration int
+	Cels     []*AsepriteCel
+}
+
+type AsepriteTag struct {
+	Name      string
+	From      int
+	To        int
+	Direction AsepriteDirection
+	// Repeat is 0 for infinite.
+	Repeat int
+}
+
+// AsepriteSliceKey applies from its frame until the next key.
+type AsepriteSliceKey struct {
+	Frame  int
+	Bounds image.Rectangle
+	// Center is relative to Bounds, and only set for 9-slices.
+	Center image.Rectangle
+	// Pivot is relative to Bounds.
+	Pivot image.Point
+}
+
+type AsepriteSlice struct {
+	Name      string
+	NineSlice bool
+	HasPivot  bool
+	Keys      []AsepriteSliceKey
+}
+
+type Aseprite struct {
+	Width  int
+	Height int
+	// Depth is the bits per pixel: 32 for RGBA, 16 for grayscale and 8 for indexed.
+	Depth            int
+	TransparentIndex int
+	Layers           []AsepriteLayer
+	Frames           []AsepriteFrame
+	Tags             []AsepriteTag
+	Slices           []AsepriteSlice
+	Palette          []color.NRGBA
+}
+
+// aseReader latches the first error, so chunks can be read without checking every field.
+type aseReader struct {
+	b   []byte
+	p   int
+	err error
+}
+
+func (r *aseReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.p+n > len(r.b) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	b := r.b[r.p : r.p+n]
+	r.p += n
+	return b
+}
+
+func (r *aseReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *aseReader) u8() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (r *aseReader) u16() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(b))
+}
+
+func (r *aseReader) i16() int {
+	return int(int16(r.u16()))
+}
+
+func (r *aseReader) u32() int {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(b))
+}
+
+func (r *aseReader) i32() int {
+	return int(int32(r.u32()))
+}
+
+func (r *aseReader) str() string {
+	return string(r.bytes(r.u16()))
+}
+
+// aseCelRawData is kept until the palette is known, as it may come after the cels.
+type aseCelRawData struct {
+	cel  *AsepriteCel
+	w, h int
+	pix  []byte
+}
+
+// AsepriteDecode reads an .ase or .aseprite file.
+// Cels on tilemap layers are skipped, as tilesets are not supported.
+func AsepriteDecode(r io.Reader, limits DecodeLimits) (*Aseprite, error) {
+	data, err := limits.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &aseReader{b: data}
+
+	header := ar.bytes(aseHeaderSize)
+	if ar.err != nil {
+		return nil, ar.err
+	}
+	if binary.LittleEndian.Uint16(header[4:6]) != aseMagic {
+		return nil, fmt.Errorf("invalid aseprite")
+	}
+
+	frameCount := int(binary.LittleEndian.Uint16(header[6:8]))
+	ase := &Aseprite{
+		Width:            int(binary.LittleEndian.Uint16(header[8:10])),
+		Height:           int(binary.LittleEndian.Uint16(header[10:12])),
+		Depth:            int(binary.LittleEndian.Uint16(header[12:14])),
+		TransparentIndex: int(header[28]),
+	}
+	flags := binary.LittleEndian.Uint32(header[14:18])
+
+	if ase.Depth != 32 && ase.Depth != 16 && ase.Depth != 8 {
+		return nil, fmt.Errorf("unsupported aseprite color depth: %d", ase.Depth)
+	}
+	if err := limits.CheckPixels(ase.Width, ase.Height); err != nil {
+		return nil, err
+	}
+	if err := limits.CheckFrames(frameCount); err != nil {
+		return nil, err
+	}
+
+	cels := []*aseCelRawData{}
+	oldPalette := []color.NRGBA{}
+	hasPalette := false
+	levels := []int{}
+
+	for f := range frameCount {
+		start := ar.p
+		size := ar.u32()
+		if ar.u16() != aseFrameMagic {
+			return nil, fmt.Errorf("invalid aseprite frame %d", f)
+		}
+		chunkCount := ar.u16()
+		duration := ar.u16()
+		ar.skip(2)
+		if count := ar.u32(); count != 0 {
+			chunkCount = count
+		}
+		if ar.err != nil {
+			return nil, ar.err
+		}
+		if size < aseFrameHeaderSize || start+size > len(data) {
+			return nil, fmt.Errorf("invalid aseprite frame size: %d", size)
+		}
+
+		frame := AsepriteFrame{Duration: duration}
+
+		for range chunkCount {
+			chunkStart := ar.p
+			chunkSize := ar.u32()
+			chunkType := ar.u16()
+			if ar.err != nil {
+				return nil, ar.err
+			}
+			if chunkSize < aseChunkHeaderSize || chunkStart+chunkSize > start+size {
+				return nil, fmt.Errorf("invalid aseprite chunk size: %d", chunkSize)
+			}
+
+			cr := &aseReader{b: data[:chunkStart+chunkSize], p: ar.p}
+
+			switch chunkType {
+			case aseChunkLayer:
+				layer := AsepriteLayer{}
+				layerFlags := cr.u16()
+				layer.Type = AsepriteLayerType(cr.u16())
+				layer.Level = cr.u16()
+				cr.skip(4)
+				layer.Blend = AsepriteBlend(cr.u16())
+				layer.Opacity = uint8(cr.u8())
+				cr.skip(3)
+				layer.Name = cr.str()
+				if layer.Type == ASEPRITELAYER_TILEMAP {
+					cr.skip(4)
+				}
+				if flags&aseFlagLayerUUID != 0 {
+					cr.skip(16)
+				}
+
+				if flags&aseFlagLayerOpacity == 0 {
+					layer.Opacity = 255
+				}
+				layer.Visible = layerFlags&aseLayerVisible != 0
+				layer.Background = layerFlags&aseLayerBackground != 0
+				layer.Reference = layerFlags&aseLayerReference != 0
+
+				levels = append(levels[:min(layer.Level, len(levels))], len(ase.Layers))
+				layer.Parent = -1
+				if layer.Level > 0 && len(levels) > 1 {
+					layer.Parent = levels[len(levels)-2]
+				}
+
+				ase.Layers = append(ase.Layers, layer)
+			case aseChunkCel:
+				cel, raw, err := aseCelRead(cr, ase, f, limits)
+				if err != nil {
+					return nil, err
+				}
+				if cel != nil {
+					frame.Cels = append(frame.Cels, cel)
+				}
+				if raw != nil {
+					cels = append(cels, raw)
+				}
+			case aseChunkTags:
+				count := cr.u16()
+				cr.skip(8)
+				for range count {
+					tag := AsepriteTag{}
+					tag.From = cr.u16()
+					tag.To = cr.u16()
+					tag.Direction = AsepriteDirection(cr.u8())
+					tag.Repeat = cr.u16()
+					cr.skip(10)
+					tag.Name = cr.str()
+					ase.Tags = append(ase.Tags, tag)
+				}
+			case aseChunkPalette:
+				hasPalette = true
+				size := cr.u32()
+				first := cr.u32()
+				last := cr.u32()
+				cr.skip(8)
+				if cr.err == nil && (size > 65536 || last >= size || first > last) {
+					return nil, fmt.Errorf("invalid aseprite palette range: %d-%d of %d", first, last, size)
+				}
+
+				if len(ase.Palette) < size {
+					ase.Palette = append(ase.Palette, make([]color.NRGBA, size-len(ase.Palette))...)
+				}
+				ase.Palette = ase.Palette[:size]
+
+				for i := first; i <= last && cr.err == nil; i++ {
+					entryFlags := cr.u16()
+					c := cr.bytes(4)
+					if c == nil {
+						break
+					}
+					ase.Palette[i] = color.NRGBA{c[0], c[1], c[2], c[3]}
+					if entryFlags&1 != 0 {
+						cr.str()
+					}
+				}
+			case aseChunkOldPalette, aseChunkOldPalette64:
+				index := 0
+				packets := cr.u16()
+				for range packets {
+					index += cr.u8()
+					count := cr.u8()
+					if count == 0 {
+						count = 256
+					}
+
+					for range count {
+						c := cr.bytes(3)
+						if c == nil {
+							break
+						}
+						if chunkType == aseChunkOldPalette64 {
+							c = []byte{c[0]<<2 | c[0]>>4, c[1]<<2 | c[1]>>4, c[2]<<2 | c[2]>>4}
+						}
+						if index >= len(oldPalette) {
+							oldPalette = append(oldPalette, make([]color.NRGBA, index-len(oldPalette)+1)...)
+						}
+						oldPalette[index] = color.NRGBA{c[0], c[1], c[2], 255}
+						index++
+					}
+				}
+			case aseChunkSlice:
+				count := cr.u32()
+				sliceFlags := cr.u32()
+				cr.skip(4)
+				slice := AsepriteSlice{
+					Name:      cr.str(),
+					NineSlice: sliceFlags&aseSliceNineSlice != 0,
+					HasPivot:  sliceFlags&aseSlicePivot != 0,
+				}
+
+				for i := 0; i < count && cr.err == nil; i++ {
+					key := AsepriteSliceKey{}
+					key.Frame = cr.u32()
+					x, y := cr.i32(), cr.i32()
+					w, h := cr.u32(), cr.u32()
+					key.Bounds = image.Rect(x, y, x+w, y+h)
+
+					if slice.NineSlice {
+						x, y := cr.i32(), cr.i32()
+						w, h := cr.u32(), cr.u32()
+						key.Center = image.Rect(x, y, x+w, y+h)
+					}
+					if slice.HasPivot {
+						key.Pivot = image.Pt(cr.i32(), cr.i32())
+					}
+
+					slice.Keys = append(slice.Keys, key)
+				}
+
+				ase.Slices = append(ase.Slices, slice)
+			}
+
+			if cr.err != nil {
+				return nil, fmt.Errorf("invalid aseprite chunk 0x%04x: %s", chunkType, cr.err)
+			}
+
+			ar.p = chunkStart + chunkSize
+		}
+
+		ar.p = start + size
+		ase.Frames = append(ase.Frames, frame)
+	}
+
+	if !hasPalette {
+		ase.Palette = oldPalette
+	}
+
+	for _, raw := range cels {
+		aseCelImage(ase, raw)
+	}
+
+	return ase, nil
+}
+
+func aseCelRead(r *aseReader, ase *Aseprite, frame int, limits DecodeLimits) (*AsepriteCel, *aseCelRawData, error) {
+	layer := r.u16()
+	x := r.i16()
+	y := r.i16()
+	opacity := r.u8()
+	celType := r.u16()
+	zIndex := r.i16()
+	r.skip(5)
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	if layer >= len(ase.Layers) {
+		return nil, nil, fmt.Errorf("aseprite cel layer out of range: %d", layer)
+	}
+
+	cel := &AsepriteCel{
+		Layer:   layer,
+		Opacity: uint8(opacity),
+		ZIndex:  zIndex,
+	}
+
+	switch celType {
+	case aseCelLinked:
+		link := r.u16()
+		if link >= frame {
+			return nil, nil, fmt.Errorf("aseprite cel links to a later frame: %d", link)
+		}
+
+		for _, c := range ase.Frames[link].Cels {
+			if c.Layer == layer {
+				cel.Image = c.Image
+				cel.Opacity = c.Opacity
+				return cel, nil, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("aseprite cel links to a missing cel on frame %d", link)
+	case aseCelRaw, aseCelCompressed:
+		w := r.u16()
+		h := r.u16()
+		if err := limits.CheckPixels(w, h); err != nil {
+			return nil, nil, err
+		}
+
+		size := w * h * (ase.Depth / 8)
+		var pix []byte
+
+		if celType == aseCelRaw {
+			pix = r.bytes(size)
+		} else {
+			zr, err := zlib.NewReader(bytes.NewReader(r.b[r.p:]))
+			if err != nil {
+				return nil, nil, err
+			}
+			defer zr.Close()
+
+			// reading exactly the expected size keeps the output bounded.
+			pix = make([]byte, size)
+			_, err = io.ReadFull(zr, pix)
+			if err != nil {
+				return nil, nil, err
+			}
+			r.p = len(r.b)
+		}
+
+		// the image is filled in once the palette is known.
+		cel.Image = image.NewNRGBA(image.Rect(x, y, x+w, y+h))
+		return cel, &aseCelRawData{cel: cel, w: w, h: h, pix: pix}, nil
+	}
+
+	// tilemap cels are not supported.
+	return nil, nil, nil
+}
+
+func aseCelImage(ase *Aseprite, raw *aseCelRawData) {
+	img := raw.cel.Image
+	background := ase.Layers[raw.cel.Layer].Background
+
+	for i := range raw.w * raw.h {
+		var c color.NRGBA
+
+		switch ase.Depth {
+		case 32:
+			p := raw.pix[i*4:]
+			c = color.NRGBA{p[0], p[1], p[2], p[3]}
+		case 16:
+			p := raw.pix[i*2:]
+			c = color.NRGBA{p[0], p[0], p[0], p[1]}
+		case 8:
+			index := int(raw.pix[i])
+			if index == ase.TransparentIndex && !background {
+				continue
+			}
+			if index < len(ase.Palette) {
+				c = ase.Palette[index]
+			}
+		}
+
+		o := i * 4
+		img.Pix[o+0] = c.R
+		img.Pix[o+1] = c.G
+		img.Pix[o+2] = c.B
+		img.Pix[o+3] = c.A
+	}
+}
+
+// LayerVisible checks the layer and all of its parent groups.
+// Reference layers are never visible.
+func (a *Aseprite) LayerVisible(layer int) bool {
+	if a.Layers[layer].Reference {
+		return false
+	}
+
+	for layer >= 0 {
+		if !a.Layers[layer].Visible {
+			return false
+		}
+		layer = a.Layers[layer].Parent
+	}
+
+	return true
+}
+
+// Composite draws the visible layers of the frame onto a new canvas.
+func (a *Aseprite) Composite(frame int) *image.NRGBA {
+	return a.CompositeLayers(frame, a.LayerVisible)
+}
+
+// CompositeLayers draws the cels of the frame where include returns true.
+// Cels are ordered by their layer index plus z-index, with the blend mode and opacity of their layer.
+// Group blend modes and opacity are not applied.
+func (a *Aseprite) CompositeLayers(frame int, include func(layer int) bool) *image.NRGBA {
+	canvas := image.NewNRGBA(image.Rect(0, 0, a.Width, a.Height))
+
+	cels := []*AsepriteCel{}
+	for _, c := range a.Frames[frame].Cels {
+		if a.Layers[c.Layer].Type == ASEPRITELAYER_IMAGE && include(c.Layer) {
+			cels = append(cels, c)
+		}
+	}
+
+	sort.SliceStable(cels, func(i, j int) bool {
+		oi := cels[i].Layer + cels[i].ZIndex
+		oj := cels[j].Layer + cels[j].ZIndex
+		if oi == oj {
+			return cels[i].ZIndex < cels[j].ZIndex
+		}
+		return oi < oj
+	})
+
+	for _, c := range cels {
+		layer := a.Layers[c.Layer]
+		opacity := float64(c.Opacity) / 255 * float64(layer.Opacity) / 255
+
+		b := c.Image.Rect.Intersect(canvas.Rect)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				so := c.Image.PixOffset(x, y)
+				if c.Image.Pix[so+3] == 0 {
+					continue
+				}
+
+				do := canvas.PixOffset(x, y)
+				aseBlendPixel(canvas.Pix[do:do+4], c.Image.Pix[so:so+4], opacity, layer.Blend)
+			}
+		}
+	}
+
+	return canvas
+}
+
+// aseBlendPixel composites src over dst using the W3C compositing formulas,
+// so blend modes only affect the area where the backdrop is opaque.
+func aseBlendPixel(dst, src []byte, opacity float64, mode AsepriteBlend) {
+	as := float64(src[3]) / 255 * opacity
+	ab := float64(dst[3]) / 255
+
+	cs := [3]float64{float64(src[0]) / 255, float64(src[1]) / 255, float64(src[2]) / 255}
+	cb := [3]float64{float64(dst[0]) / 255, float64(dst[1]) / 255, float64(dst[2]) / 255}
+
+	blended := cs
+	if mode != ASEPRITEBLEND_NORMAL && ab > 0 {
+		blended = aseBlend(cb, cs, mode)
+	}
+
+	ao := as + ab*(1-as)
+	if ao == 0 {
+		return
+	}
+
+	for i := range 3 {
+		c := (1-ab)*cs[i] + ab*blended[i]
+		co := (as*c + ab*(1-as)*cb[i]) / ao
+		dst[i] = uint8(math.Round(math.Max(0, math.Min(1, co)) * 255))
+	}
+	dst[3] = uint8(math.Round(ao * 255))
+}
+
+func aseBlend(cb, cs [3]float64, mode AsepriteBlend) [3]float64 {
+	switch mode {
+	case ASEPRITEBLEND_HUE:
+		return aseSetLum(aseSetSat(cs, aseSat(cb)), aseLum(cb))
+	case ASEPRITEBLEND_SATURATION:
+		return aseSetLum(aseSetSat(cb, aseSat(cs)), aseLum(cb))
+	case ASEPRITEBLEND_COLOR:
+		return aseSetLum(cs, aseLum(cb))
+	case ASEPRITEBLEND_LUMINOSITY:
+		return aseSetLum(cb, aseLum(cs))
+	}
+
+	out := [3]float64{}
+	for i := range 3 {
+		out[i] = aseBlendChannel(cb[i], cs[i], mode)
+	}
+	return out
+}
+
+func aseBlendChannel(b, s float64, mode AsepriteBlend) float64 {
+	switch mode {
+	case ASEPRITEBLEND_MULTIPLY:
+		return b * s
+	case ASEPRITEBLEND_SCREEN:
+		return b + s - b*s
+	case ASEPRITEBLEND_OVERLAY:
+		return aseBlendChannel(s, b, ASEPRITEBLEND_HARD_LIGHT)
+	case ASEPRITEBLEND_DARKEN:
+		return math.Min(b, s)
+	case ASEPRITEBLEND_LIGHTEN:
+		return math.Max(b, s)
+	case ASEPRITEBLEND_COLOR_DODGE:
+		if b == 0 {
+			return 0
+		}
+		if s == 1 {
+			return 1
+		}
+		return math.Min(1, b/(1-s))
+	case ASEPRITEBLEND_COLOR_BURN:
+		if b == 1 {
+			return 1
+		}
+		if s == 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-b)/s)
+	case ASEPRITEBLEND_HARD_LIGHT:
+		if s <= 0.5 {
+			return b * 2 * s
+		}
+		return aseBlendChannel(b, 2*s-1, ASEPRITEBLEND_SCREEN)
+	case ASEPRITEBLEND_SOFT_LIGHT:
+		if s <= 0.5 {
+			return b - (1-2*s)*b*(1-b)
+		}
+		d := math.Sqrt(b)
+		if b <= 0.25 {
+			d = ((16*b-12)*b + 4) * b
+		}
+		return b + (2*s-1)*(d-b)
+	case ASEPRITEBLEND_DIFFERENCE:
+		return math.Abs(b - s)
+	case ASEPRITEBLEND_EXCLUSION:
+		return b + s - 2*b*s
+	case ASEPRITEBLEND_ADDITION:
+		return math.Min(1, b+s)
+	case ASEPRITEBLEND_SUBTRACT:
+		return math.Max(0, b-s)
+	case ASEPRITEBLEND_DIVIDE:
+		if b == 0 {
+			return 0
+		}
+		if b >= s {
+			return 1
+		}
+		return b / s
+	}
+
+	return s
+}
+
+func aseLum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func aseSat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+func aseSetLum(c [3]float64, l float64) [3]float64 {
+	d := l - aseLum(c)
+	c = [3]float64{c[0] + d, c[1] + d, c[2] + d}
+
+	l = aseLum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+
+	for i := range 3 {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+
+	return c
+}
+
+func aseSetSat(c [3]float64, s float64) [3]float64 {
+	imax, imid, imin := 0, 1, 2
+	if c[imax] < c[imid] {
+		imax, imid = imid, imax
+	}
+	if c[imid] < c[imin] {
+		imid, imin = imin, imid
+	}
+	if c[imax] < c[imid] {
+		imax, imid = imid, imax
+	}
+
+	out := [3]float64{}
+	if c[imax] > c[imin] {
+		out[imid] = (c[imid] - c[imin]) * s / (c[imax] - c[imin])
+		out[imax] = s
+	}
+
+	return out
+}
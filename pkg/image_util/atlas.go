@@ -0,0 +1,751 @@
+package imageutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+type AtlasAlgorithm int
+
+const (
+	ATLASALGORITHM_MAXRECTS AtlasAlgorithm = iota
+	ATLASALGORITHM_SKYLINE
+)
+
+var AtlasAlgorithmList = []AtlasAlgorithm{
+	ATLASALGORITHM_MAXRECTS,
+	ATLASALGORITHM_SKYLINE,
+}
+
+// AtlasRotation is the direction sprites are rotated in when it gives a better fit.
+// TexturePacker JSON expects sprites rotated clockwise, while LibGDX expects them rotated counter clockwise.
+type AtlasRotation int
+
+const (
+	ATLASROTATION_NONE AtlasRotation = iota
+	ATLASROTATION_CW
+	ATLASROTATION_CCW
+)
+
+var AtlasRotationList = []AtlasRotation{
+	ATLASROTATION_NONE,
+	ATLASROTATION_CW,
+	ATLASROTATION_CCW,
+}
+
+type AtlasOptions struct {
+	Algorithm AtlasAlgorithm
+	MaxWidth  int
+	MaxHeight int
+	// Padding is the space between sprites.
+	Padding int
+	// Extrude repeats the edge pixels of each sprite outwards, to avoid bleeding when filtering.
+	Extrude    int
+	PowerOfTwo bool
+	Rotation   AtlasRotation
+}
+
+func DefaultAtlasOptions() *AtlasOptions {
+	return &AtlasOptions{
+		Algorithm: ATLASALGORITHM_MAXRECTS,
+		MaxWidth:  2048,
+		MaxHeight: 2048,
+		Padding:   0,
+		Extrude:   0,
+		Rotation:  ATLASROTATION_NONE,
+	}
+}
+
+func (o *AtlasOptions) Validate() error {
+	if o.MaxWidth < 1 || o.MaxHeight < 1 {
+		return fmt.Errorf("atlas max size must be positive, got: %dx%d", o.MaxWidth, o.MaxHeight)
+	}
+	if o.Padding < 0 {
+		return fmt.Errorf("atlas padding cannot be negative, got: %d", o.Padding)
+	}
+	if o.Extrude < 0 {
+		return fmt.Errorf("atlas extrude cannot be negative, got: %d", o.Extrude)
+	}
+	if o.Algorithm < 0 || int(o.Algorithm) >= len(AtlasAlgorithmList) {
+		return fmt.Errorf("invalid atlas algorithm: %d", o.Algorithm)
+	}
+	if o.Rotation < 0 || int(o.Rotation) >= len(AtlasRotationList) {
+		return fmt.Errorf("invalid atlas rotation: %d", o.Rotation)
+	}
+
+	return nil
+}
+
+type AtlasSprite struct {
+	Name string
+	Page int
+	// X and Y are the top left of the sprite in the page, not including the extrusion.
+	X int
+	Y int
+	// Width and Height are the size of the sprite before it was rotated.
+	Width   int
+	Height  int
+	Rotated bool
+	// OffsetX and OffsetY are where the sprite was trimmed from in the source image,
+	// SourceWidth and SourceHeight are the size of the source image before it was trimmed.
+	OffsetX      int
+	OffsetY      int
+	SourceWidth  int
+	SourceHeight int
+}
+
+func (s *AtlasSprite) Trimmed() bool {
+	return s.OffsetX != 0 || s.OffsetY != 0 || s.SourceWidth != s.Width || s.SourceHeight != s.Height
+}
+
+type AtlasPage struct {
+	// Name is the file name of the page used when exporting.
+	Name   string
+	Width  int
+	Height int
+}
+
+type Atlas struct {
+	Pages    []AtlasPage
+	Sprites  []AtlasSprite
+	Rotation AtlasRotation
+}
+
+type atlasItem struct {
+	index int
+	w, h  int
+}
+
+type atlasPlacement struct {
+	item    atlasItem
+	x, y    int
+	rotated bool
+}
+
+// AtlasPack packs the images into as few pages as possible, each page is kept as small as it can be.
+// Sprites are returned in the same order as the images, page names are left empty.
+func AtlasPack(imgs []image.Image, names []string, options *AtlasOptions) (*Atlas, []*image.NRGBA, error) {
+	if err := options.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(imgs) != len(names) {
+		return nil, nil, fmt.Errorf("atlas has %d images but %d names", len(imgs), len(names))
+	}
+
+	maxWidth, maxHeight := options.MaxWidth, options.MaxHeight
+	if options.PowerOfTwo {
+		maxWidth, maxHeight = atlasFloorPOT(maxWidth), atlasFloorPOT(maxHeight)
+	}
+
+	rotate := options.Rotation != ATLASROTATION_NONE
+	border := options.Extrude*2 + options.Padding
+
+	items := make([]atlasItem, len(imgs))
+	for i, img := range imgs {
+		b := img.Bounds()
+		if b.Empty() {
+			return nil, nil, fmt.Errorf("sprite %s is empty", names[i])
+		}
+		items[i] = atlasItem{index: i, w: b.Dx() + border, h: b.Dy() + border}
+
+		fits := b.Dx()+options.Extrude*2 <= maxWidth && b.Dy()+options.Extrude*2 <= maxHeight
+		if rotate {
+			fits = fits || (b.Dy()+options.Extrude*2 <= maxWidth && b.Dx()+options.Extrude*2 <= maxHeight)
+		}
+		if !fits {
+			return nil, nil, fmt.Errorf("sprite %s is too large for the atlas: %dx%d", names[i], b.Dx(), b.Dy())
+		}
+	}
+
+	// larger sprites first gives a tighter fit with both algorithms.
+	sort.SliceStable(items, func(i, j int) bool {
+		si := max(items[i].w, items[i].h)
+		sj := max(items[j].w, items[j].h)
+		if si == sj {
+			return items[i].w*items[i].h > items[j].w*items[j].h
+		}
+		return si > sj
+	})
+
+	atlas := &Atlas{
+		Sprites:  make([]AtlasSprite, len(imgs)),
+		Rotation: options.Rotation,
+	}
+	pages := []*image.NRGBA{}
+
+	for len(items) > 0 {
+		placed, rest := atlasPackBin(items, maxWidth, maxHeight, options)
+		if len(rest) == 0 {
+			placed = atlasPackSmallest(items, placed, maxWidth, maxHeight, options)
+		}
+
+		width, height := atlasUsed(placed, options)
+		page := image.NewNRGBA(image.Rect(0, 0, width, height))
+		index := len(atlas.Pages)
+
+		for _, p := range placed {
+			img := imgs[p.item.index]
+			b := img.Bounds()
+
+			atlas.Sprites[p.item.index] = AtlasSprite{
+				Name:    names[p.item.index],
+				Page:    index,
+				X:       p.x + options.Extrude,
+				Y:       p.y + options.Extrude,
+				Width:   b.Dx(),
+				Height:  b.Dy(),
+				Rotated: p.rotated,
+
+				SourceWidth:  b.Dx(),
+				SourceHeight: b.Dy(),
+			}
+
+			rotation := ATLASROTATION_NONE
+			if p.rotated {
+				rotation = options.Rotation
+			}
+			atlasDraw(page, img, p.x, p.y, rotation, options.Extrude)
+		}
+
+		atlas.Pages = append(atlas.Pages, AtlasPage{Width: width, Height: height})
+		pages = append(pages, page)
+		items = rest
+	}
+
+	return atlas, pages, nil
+}
+
+func atlasPackBin(items []atlasItem, width, height int, options *AtlasOptions) ([]atlasPlacement, []atlasItem) {
+	// the padding after the last sprite in a row or column is not needed.
+	var bin atlasBin
+	switch options.Algorithm {
+	case ATLASALGORITHM_SKYLINE:
+		bin = newAtlasSkyline(width+options.Padding, height+options.Padding)
+	default:
+		bin = newAtlasMaxRects(width+options.Padding, height+options.Padding)
+	}
+
+	rotate := options.Rotation != ATLASROTATION_NONE
+	placed := []atlasPlacement{}
+	rest := []atlasItem{}
+
+	for _, item := range items {
+		x, y, rotated, ok := bin.insert(item.w, item.h, rotate)
+		if !ok {
+			rest = append(rest, item)
+			continue
+		}
+		placed = append(placed, atlasPlacement{item: item, x: x, y: y, rotated: rotated})
+	}
+
+	return placed, rest
+}
+
+// atlasPackSmallest searches for the smallest page that still fits all of the items.
+func atlasPackSmallest(items []atlasItem, placed []atlasPlacement, maxWidth, maxHeight int, options *AtlasOptions) []atlasPlacement {
+	bestW, bestH := atlasUsed(placed, options)
+	best := placed
+
+	area := 0
+	minSide := 1
+	for _, item := range items {
+		area += (item.w - options.Padding) * (item.h - options.Padding)
+		side := min(item.w, item.h) - options.Padding
+		if options.Rotation == ATLASROTATION_NONE {
+			side = item.w - options.Padding
+		}
+		minSide = max(minSide, side)
+	}
+
+	widths := []int{}
+	if options.PowerOfTwo {
+		for w := atlasCeilPOT(minSide); w <= maxWidth; w *= 2 {
+			widths = append(widths, w)
+		}
+	} else {
+		step := max(1, maxWidth/64)
+		for w := minSide; w < maxWidth; w += step {
+			widths = append(widths, w)
+		}
+		widths = append(widths, maxWidth)
+	}
+
+	for _, w := range widths {
+		// no height at this width can beat the current best.
+		if w*max(1, area/w) >= bestW*bestH {
+			continue
+		}
+
+		fits := func(h int) []atlasPlacement {
+			p, rest := atlasPackBin(items, w, h, options)
+			if len(rest) > 0 {
+				return nil
+			}
+			return p
+		}
+
+		var found []atlasPlacement
+		if options.PowerOfTwo {
+			for h := atlasCeilPOT(max(1, area/w)); h <= maxHeight; h *= 2 {
+				if found = fits(h); found != nil {
+					break
+				}
+			}
+		} else {
+			lo, hi := max(1, area/w), maxHeight
+			for lo < hi {
+				mid := (lo + hi) / 2
+				if p := fits(mid); p != nil {
+					found = p
+					hi = mid
+				} else {
+					lo = mid + 1
+				}
+			}
+			if found == nil {
+				found = fits(hi)
+			}
+		}
+
+		if found == nil {
+			continue
+		}
+
+		fw, fh := atlasUsed(found, options)
+		if fw*fh < bestW*bestH || (fw*fh == bestW*bestH && max(fw, fh) < max(bestW, bestH)) {
+			best, bestW, bestH = found, fw, fh
+		}
+	}
+
+	return best
+}
+
+// atlasUsed is the size of the page needed for the placements.
+func atlasUsed(placed []atlasPlacement, options *AtlasOptions) (int, int) {
+	width, height := 0, 0
+	for _, p := range placed {
+		w, h := p.item.w, p.item.h
+		if p.rotated {
+			w, h = h, w
+		}
+		width = max(width, p.x+w-options.Padding)
+		height = max(height, p.y+h-options.Padding)
+	}
+
+	if options.PowerOfTwo {
+		return atlasCeilPOT(width), atlasCeilPOT(height)
+	}
+	return width, height
+}
+
+func atlasCeilPOT(v int) int {
+	p := 1
+	for p < v {
+		p *= 2
+	}
+	return p
+}
+
+func atlasFloorPOT(v int) int {
+	p := 1
+	for p*2 <= v {
+		p *= 2
+	}
+	return p
+}
+
+// atlasDraw draws the image at x, y with the extrusion included,
+// so the sprite itself begins at x+extrude, y+extrude.
+func atlasDraw(page *image.NRGBA, img image.Image, x, y int, rotation AtlasRotation, extrude int) {
+	src := imageNRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	w, h := sw, sh
+	if rotation != ATLASROTATION_NONE {
+		w, h = sh, sw
+	}
+
+	for dy := -extrude; dy < h+extrude; dy++ {
+		for dx := -extrude; dx < w+extrude; dx++ {
+			cx := min(max(dx, 0), w-1)
+			cy := min(max(dy, 0), h-1)
+
+			sx, sy := cx, cy
+			switch rotation {
+			case ATLASROTATION_CW:
+				sx, sy = cy, sh-1-cx
+			case ATLASROTATION_CCW:
+				sx, sy = sw-1-cy, cx
+			}
+
+			so := src.PixOffset(sx, sy)
+			do := page.PixOffset(x+extrude+dx, y+extrude+dy)
+			copy(page.Pix[do:do+4], src.Pix[so:so+4])
+		}
+	}
+}
+
+type atlasBin interface {
+	insert(w, h int, rotate bool) (x, y int, rotated bool, ok bool)
+}
+
+// atlasMaxRects uses the best short side fit heuristic.
+type atlasMaxRects struct {
+	free []image.Rectangle
+}
+
+func newAtlasMaxRects(width, height int) *atlasMaxRects {
+	return &atlasMaxRects{
+		free: []image.Rectangle{image.Rect(0, 0, width, height)},
+	}
+}
+
+func (b *atlasMaxRects) insert(w, h int, rotate bool) (int, int, bool, bool) {
+	bestShort, bestLong := math.MaxInt, math.MaxInt
+	var best image.Rectangle
+	rotated := false
+
+	try := func(f image.Rectangle, w, h int, rot bool) {
+		if w > f.Dx() || h > f.Dy() {
+			return
+		}
+
+		short := min(f.Dx()-w, f.Dy()-h)
+		long := max(f.Dx()-w, f.Dy()-h)
+		if short < bestShort || (short == bestShort && long < bestLong) {
+			bestShort, bestLong = short, long
+			best = image.Rect(f.Min.X, f.Min.Y, f.Min.X+w, f.Min.Y+h)
+			rotated = rot
+		}
+	}
+
+	for _, f := range b.free {
+		try(f, w, h, false)
+		if rotate && w != h {
+			try(f, h, w, true)
+		}
+	}
+
+	if bestShort == math.MaxInt {
+		return 0, 0, false, false
+	}
+
+	b.split(best)
+	return best.Min.X, best.Min.Y, rotated, true
+}
+
+func (b *atlasMaxRects) split(used image.Rectangle) {
+	free := make([]image.Rectangle, 0, len(b.free)+4)
+
+	for _, f := range b.free {
+		if !f.Overlaps(used) {
+			free = append(free, f)
+			continue
+		}
+
+		if used.Min.X > f.Min.X {
+			free = append(free, image.Rect(f.Min.X, f.Min.Y, used.Min.X, f.Max.Y))
+		}
+		if used.Max.X < f.Max.X {
+			free = append(free, image.Rect(used.Max.X, f.Min.Y, f.Max.X, f.Max.Y))
+		}
+		if used.Min.Y > f.Min.Y {
+			free = append(free, image.Rect(f.Min.X, f.Min.Y, f.Max.X, used.Min.Y))
+		}
+		if used.Max.Y < f.Max.Y {
+			free = append(free, image.Rect(f.Min.X, used.Max.Y, f.Max.X, f.Max.Y))
+		}
+	}
+
+	// remove free rects that are contained by another.
+	pruned := make([]image.Rectangle, 0, len(free))
+	for i, f := range free {
+		contained := false
+		for j, g := range free {
+			if i != j && f.In(g) && (f != g || i > j) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			pruned = append(pruned, f)
+		}
+	}
+
+	b.free = pruned
+}
+
+type atlasSkylineNode struct {
+	x, y, w int
+}
+
+// atlasSkyline uses the bottom left heuristic.
+type atlasSkyline struct {
+	width, height int
+	nodes         []atlasSkylineNode
+}
+
+func newAtlasSkyline(width, height int) *atlasSkyline {
+	return &atlasSkyline{
+		width:  width,
+		height: height,
+		nodes:  []atlasSkylineNode{{0, 0, width}},
+	}
+}
+
+func (b *atlasSkyline) fit(i, w, h int) (int, bool) {
+	x := b.nodes[i].x
+	if x+w > b.width {
+		return 0, false
+	}
+
+	y := 0
+	for j, remaining := i, w; remaining > 0; j++ {
+		if j >= len(b.nodes) {
+			return 0, false
+		}
+		y = max(y, b.nodes[j].y)
+		if y+h > b.height {
+			return 0, false
+		}
+		remaining -= b.nodes[j].w
+	}
+
+	return y, true
+}
+
+func (b *atlasSkyline) insert(w, h int, rotate bool) (int, int, bool, bool) {
+	bestTop, bestX := math.MaxInt, math.MaxInt
+	bestIndex, bestY := -1, 0
+	bestW, bestH := 0, 0
+	rotated := false
+
+	try := func(i, w, h int, rot bool) {
+		y, ok := b.fit(i, w, h)
+		if !ok {
+			return
+		}
+
+		x := b.nodes[i].x
+		if y+h < bestTop || (y+h == bestTop && x < bestX) {
+			bestTop, bestX = y+h, x
+			bestIndex, bestY = i, y
+			bestW, bestH = w, h
+			rotated = rot
+		}
+	}
+
+	for i := range b.nodes {
+		try(i, w, h, false)
+		if rotate && w != h {
+			try(i, h, w, true)
+		}
+	}
+
+	if bestIndex < 0 {
+		return 0, 0, false, false
+	}
+
+	b.place(bestIndex, bestX, bestY+bestH, bestW)
+	return bestX, bestY, rotated, true
+}
+
+func (b *atlasSkyline) place(i, x, y, w int) {
+	node := atlasSkylineNode{x, y, w}
+	b.nodes = append(b.nodes[:i], append([]atlasSkylineNode{node}, b.nodes[i:]...)...)
+
+	// shrink the nodes now under the new one.
+	for j := i + 1; j < len(b.nodes); {
+		end := node.x + node.w
+		if b.nodes[j].x >= end {
+			break
+		}
+
+		shrink := end - b.nodes[j].x
+		b.nodes[j].x += shrink
+		b.nodes[j].w -= shrink
+		if b.nodes[j].w > 0 {
+			break
+		}
+		b.nodes = append(b.nodes[:j], b.nodes[j+1:]...)
+	}
+
+	// merge nodes at the same height.
+	for j := 0; j < len(b.nodes)-1; {
+		if b.nodes[j].y == b.nodes[j+1].y {
+			b.nodes[j].w += b.nodes[j+1].w
+			b.nodes = append(b.nodes[:j+1], b.nodes[j+2:]...)
+			continue
+		}
+		j++
+	}
+}
+
+func (a *Atlas) checkRotation(expected AtlasRotation, format string) error {
+	for _, s := range a.Sprites {
+		if s.Rotated && a.Rotation != expected {
+			return fmt.Errorf("%s requires rotated sprites to be packed with rotation %d, got: %d", format, expected, a.Rotation)
+		}
+	}
+	return nil
+}
+
+type atlasJSONRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type atlasJSONSize struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type atlasJSONFrame struct {
+	Filename         string        `json:"filename,omitempty"`
+	Frame            atlasJSONRect `json:"frame"`
+	Rotated          bool          `json:"rotated"`
+	Trimmed          bool          `json:"trimmed"`
+	SpriteSourceSize atlasJSONRect `json:"spriteSourceSize"`
+	SourceSize       atlasJSONSize `json:"sourceSize"`
+}
+
+type atlasJSONMeta struct {
+	App     string        `json:"app"`
+	Version string        `json:"version"`
+	Image   string        `json:"image"`
+	Format  string        `json:"format"`
+	Size    atlasJSONSize `json:"size"`
+	Scale   string        `json:"scale"`
+}
+
+// JSON exports a single page in the TexturePacker hash or array format.
+// The frame of a rotated sprite keeps its unrotated size, as loaders swap the width and height when rotated is set.
+func (a *Atlas) JSON(page int, array bool) ([]byte, error) {
+	if page < 0 || page >= len(a.Pages) {
+		return nil, fmt.Errorf("atlas page out of range: %d", page)
+	}
+	if err := a.checkRotation(ATLASROTATION_CW, "json"); err != nil {
+		return nil, err
+	}
+
+	frames := []atlasJSONFrame{}
+	hash := map[string]atlasJSONFrame{}
+
+	for _, s := range a.Sprites {
+		if s.Page != page {
+			continue
+		}
+
+		frame := atlasJSONFrame{
+			Frame:            atlasJSONRect{s.X, s.Y, s.Width, s.Height},
+			Rotated:          s.Rotated,
+			Trimmed:          s.Trimmed(),
+			SpriteSourceSize: atlasJSONRect{s.OffsetX, s.OffsetY, s.Width, s.Height},
+			SourceSize:       atlasJSONSize{s.SourceWidth, s.SourceHeight},
+		}
+
+		if array {
+			frame.Filename = s.Name
+			frames = append(frames, frame)
+			continue
+		}
+
+		if _, ok := hash[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate sprite name in atlas: %s", s.Name)
+		}
+		hash[s.Name] = frame
+	}
+
+	meta := atlasJSONMeta{
+		App:     "imgscal",
+		Version: "1.0",
+		Image:   a.Pages[page].Name,
+		Format:  "RGBA8888",
+		Size:    atlasJSONSize{a.Pages[page].Width, a.Pages[page].Height},
+		Scale:   "1",
+	}
+
+	if array {
+		return json.MarshalIndent(struct {
+			Frames []atlasJSONFrame `json:"frames"`
+			Meta   atlasJSONMeta    `json:"meta"`
+		}{frames, meta}, "", "\t")
+	}
+
+	return json.MarshalIndent(struct {
+		Frames map[string]atlasJSONFrame `json:"frames"`
+		Meta   atlasJSONMeta             `json:"meta"`
+	}{hash, meta}, "", "\t")
+}
+
+// LibGDX exports all pages in the LibGDX .atlas format.
+// The size of a rotated sprite is its unrotated size, as LibGDX swaps the width and height when rotate is set.
+func (a *Atlas) LibGDX() (string, error) {
+	if err := a.checkRotation(ATLASROTATION_CCW, "libgdx"); err != nil {
+		return "", err
+	}
+
+	b := strings.Builder{}
+
+	for i, p := range a.Pages {
+		fmt.Fprintf(&b, "\n%s\n", p.Name)
+		fmt.Fprintf(&b, "size: %d, %d\n", p.Width, p.Height)
+		b.WriteString("format: RGBA8888\n")
+		b.WriteString("filter: Nearest, Nearest\n")
+		b.WriteString("repeat: none\n")
+
+		for _, s := range a.Sprites {
+			if s.Page != i {
+				continue
+			}
+
+			fmt.Fprintf(&b, "%s\n", s.Name)
+			fmt.Fprintf(&b, "  rotate: %t\n", s.Rotated)
+			fmt.Fprintf(&b, "  xy: %d, %d\n", s.X, s.Y)
+			fmt.Fprintf(&b, "  size: %d, %d\n", s.Width, s.Height)
+			fmt.Fprintf(&b, "  orig: %d, %d\n", s.SourceWidth, s.SourceHeight)
+			// libgdx offsets are from the bottom left.
+			fmt.Fprintf(&b, "  offset: %d, %d\n", s.OffsetX, s.SourceHeight-s.Height-s.OffsetY)
+			b.WriteString("  index: -1\n")
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Lua exports the atlas as a lua chunk returning a table, with sprites keyed by name.
+// Pages are 1-based to match lua.
+func (a *Atlas) Lua() (string, error) {
+	b := strings.Builder{}
+	b.WriteString("return {\n")
+
+	b.WriteString("\tpages = {\n")
+	for _, p := range a.Pages {
+		fmt.Fprintf(&b, "\t\t{ name = %q, width = %d, height = %d },\n", p.Name, p.Width, p.Height)
+	}
+	b.WriteString("\t},\n")
+
+	names := map[string]bool{}
+	b.WriteString("\tsprites = {\n")
+	for _, s := range a.Sprites {
+		if names[s.Name] {
+			return "", fmt.Errorf("duplicate sprite name in atlas: %s", s.Name)
+		}
+		names[s.Name] = true
+
+		fmt.Fprintf(&b, "\t\t[%q] = { page = %d, x = %d, y = %d, width = %d, height = %d, rotated = %t, offset_x = %d, offset_y = %d, source_width = %d, source_height = %d },\n",
+			s.Name, s.Page+1, s.X, s.Y, s.Width, s.Height, s.Rotated, s.OffsetX, s.OffsetY, s.SourceWidth, s.SourceHeight)
+	}
+	b.WriteString("\t},\n")
+
+	fmt.Fprintf(&b, "\trotation = %d,\n", a.Rotation)
+	b.WriteString("}\n")
+
+	return b.String(), nil
+}
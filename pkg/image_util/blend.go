@@ -0,0 +1,136 @@
+package imageutil
+
+import (
+	"image"
+)
+
+// BlendChannelFunc combines a single channel of the background and foreground,
+// in linear light without alpha premultiplication.
+type BlendChannelFunc func(bg, fg float32) float32
+
+// BlendF32 blends fg over bg without clamping or rounding the result.
+// The output is the size of the overlap between both images, starting at 0,0.
+func BlendF32(bg, fg image.Image, fn BlendChannelFunc) *RGBAF32 {
+	bgSrc := rgbaf32Image(bg)
+	fgSrc := rgbaf32Image(fg)
+	bgRect := bgSrc.Bounds()
+	fgRect := fgSrc.Bounds()
+
+	w := min(bgRect.Dx(), fgRect.Dx())
+	h := min(bgRect.Dy(), fgRect.Dy())
+	dst := NewRGBAF32(image.Rect(0, 0, w, h))
+
+	for y := range h {
+		for x := range w {
+			bR, bG, bB, bA := bgSrc.RGBAF32At(bgRect.Min.X+x, bgRect.Min.Y+y).NRGBA()
+			fR, fG, fB, fA := fgSrc.RGBAF32At(fgRect.Min.X+x, fgRect.Min.Y+y).NRGBA()
+			fA = clampF32(fA)
+
+			a := fA + bA*(1-fA)
+			if a <= 0 {
+				continue
+			}
+
+			// the blend only applies where the background is visible, then it is composited over the background.
+			over := func(b, f float32) float32 {
+				mix := (1-bA)*f + bA*fn(b, f)
+				return (mix*fA + b*bA*(1-fA)) / a
+			}
+
+			dst.SetRGBAF32(x, y, NewColorRGBAF32(over(bR, fR), over(bG, fG), over(bB, fB), a))
+		}
+	}
+
+	return dst
+}
+
+// BlendOpacity mixes the foreground with the background by percent, between 0 and 1.
+func BlendOpacity(percent float32) BlendChannelFunc {
+	percent = clampF32(percent)
+	return func(bg, fg float32) float32 {
+		return fg*percent + (1-percent)*bg
+	}
+}
+
+func BlendNormal(bg, fg float32) float32 {
+	return fg
+}
+
+func BlendAdd(bg, fg float32) float32 {
+	return bg + fg
+}
+
+func BlendMultiply(bg, fg float32) float32 {
+	return bg * fg
+}
+
+func BlendOverlay(bg, fg float32) float32 {
+	if bg > 0.5 {
+		return 1 - (1-2*(bg-0.5))*(1-fg)
+	}
+	return 2 * bg * fg
+}
+
+func BlendSoftLight(bg, fg float32) float32 {
+	return (1-2*fg)*bg*bg + 2*bg*fg
+}
+
+func BlendScreen(bg, fg float32) float32 {
+	return 1 - (1-bg)*(1-fg)
+}
+
+func BlendDifference(bg, fg float32) float32 {
+	if bg > fg {
+		return bg - fg
+	}
+	return fg - bg
+}
+
+func BlendDivide(bg, fg float32) float32 {
+	if fg == 0 {
+		return 1
+	}
+	return bg / fg
+}
+
+func BlendColorBurn(bg, fg float32) float32 {
+	if fg == 0 {
+		return 0
+	}
+	return 1 - (1-bg)/fg
+}
+
+func BlendExclusion(bg, fg float32) float32 {
+	return 0.5 - 2*(bg-0.5)*(fg-0.5)
+}
+
+func BlendColorDodge(bg, fg float32) float32 {
+	if fg == 1 {
+		return 1
+	}
+	return bg / (1 - fg)
+}
+
+func BlendLinearBurn(bg, fg float32) float32 {
+	return bg + fg - 1
+}
+
+func BlendLinearLight(bg, fg float32) float32 {
+	if fg > 0.5 {
+		return bg + 2*fg - 0.5
+	}
+	return bg + 2*fg - 1
+}
+
+// BlendSubtract subtracts the background from the foreground.
+func BlendSubtract(bg, fg float32) float32 {
+	return fg - bg
+}
+
+func BlendDarken(bg, fg float32) float32 {
+	return min(bg, fg)
+}
+
+func BlendLighten(bg, fg float32) float32 {
+	return max(bg, fg)
+}
@@ -0,0 +1,511 @@
+package imageutil
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// BMFontCharsetASCII is the printable ascii characters, used when no characters are given.
+const BMFontCharsetASCII = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+
+type BMFontOptions struct {
+	// Chars are the characters to include, duplicates are ignored.
+	Chars        string
+	Color        color.NRGBA
+	Outline      int
+	OutlineColor color.NRGBA
+	// ShadowX and ShadowY offset the shadow from the glyph, there is no shadow when both are 0.
+	ShadowX     int
+	ShadowY     int
+	ShadowColor color.NRGBA
+	// Padding is transparent space added around each glyph, included in the glyph size.
+	Padding int
+	// Atlas packs the glyphs into pages, its padding is the spacing between glyphs.
+	Atlas *AtlasOptions
+}
+
+func DefaultBMFontOptions() *BMFontOptions {
+	atlas := DefaultAtlasOptions()
+	atlas.MaxWidth = 512
+	atlas.MaxHeight = 512
+	atlas.Padding = 1
+	atlas.PowerOfTwo = true
+
+	return &BMFontOptions{
+		Chars:        BMFontCharsetASCII,
+		Color:        color.NRGBA{255, 255, 255, 255},
+		Outline:      0,
+		OutlineColor: color.NRGBA{0, 0, 0, 255},
+		ShadowX:      0,
+		ShadowY:      0,
+		ShadowColor:  color.NRGBA{0, 0, 0, 128},
+		Padding:      0,
+		Atlas:        atlas,
+	}
+}
+
+func (o *BMFontOptions) Validate() error {
+	if o.Chars == "" {
+		return fmt.Errorf("bmfont must include at least one character")
+	}
+	if o.Outline < 0 {
+		return fmt.Errorf("bmfont outline cannot be negative, got: %d", o.Outline)
+	}
+	if o.Padding < 0 {
+		return fmt.Errorf("bmfont padding cannot be negative, got: %d", o.Padding)
+	}
+	if o.Atlas.Rotation != ATLASROTATION_NONE {
+		return fmt.Errorf("bmfont glyphs cannot be rotated")
+	}
+
+	return o.Atlas.Validate()
+}
+
+type BMFontChar struct {
+	ID     rune
+	X      int
+	Y      int
+	Width  int
+	Height int
+	// XOffset and YOffset are from the cursor to the top left of the glyph, the cursor is at the top of the line.
+	XOffset  int
+	YOffset  int
+	XAdvance int
+	Page     int
+}
+
+type BMFontKerning struct {
+	First  rune
+	Second rune
+	Amount int
+}
+
+// BMFont is an AngelCode bitmap font descriptor.
+type BMFont struct {
+	Face    string
+	Size    int
+	Padding int
+	Spacing int
+	Outline int
+
+	LineHeight int
+	Base       int
+	// ScaleW and ScaleH are the size of every page.
+	ScaleW int
+	ScaleH int
+	// Pages are the file names of each page.
+	Pages    []string
+	Chars    []BMFontChar
+	Kernings []BMFontKerning
+}
+
+// BMFontGenerate renders each character of the face and packs them into pages of the same size.
+// Page names are left empty.
+// Characters missing from the face use its fallback glyph.
+func BMFontGenerate(face font.Face, name string, size int, opts *BMFontOptions) (*BMFont, []*image.NRGBA, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	chars := []rune{}
+	for _, r := range opts.Chars {
+		if !slices.Contains(chars, r) {
+			chars = append(chars, r)
+		}
+	}
+	slices.Sort(chars)
+
+	metrics := face.Metrics()
+	bm := &BMFont{
+		Face:       name,
+		Size:       size,
+		Padding:    opts.Padding,
+		Spacing:    opts.Atlas.Padding,
+		Outline:    opts.Outline,
+		LineHeight: metrics.Height.Ceil(),
+		Base:       metrics.Ascent.Ceil(),
+		Chars:      make([]BMFontChar, len(chars)),
+	}
+
+	// the space needed around the glyph on each side for the effects.
+	margin := opts.Outline + opts.Padding
+	left, right := margin+max(0, -opts.ShadowX), margin+max(0, opts.ShadowX)
+	top, bottom := margin+max(0, -opts.ShadowY), margin+max(0, opts.ShadowY)
+
+	glyphs := []image.Image{}
+	names := []string{}
+	packed := []int{}
+
+	for i, r := range chars {
+		bounds, advance, _ := face.GlyphBounds(r)
+		x0, y0 := bounds.Min.X.Floor(), bounds.Min.Y.Floor()
+		x1, y1 := bounds.Max.X.Ceil(), bounds.Max.Y.Ceil()
+
+		bm.Chars[i] = BMFontChar{
+			ID:       r,
+			XAdvance: advance.Round(),
+		}
+		if x1 <= x0 || y1 <= y0 {
+			continue
+		}
+
+		w, h := x1-x0+left+right, y1-y0+top+bottom
+		dc := gg.NewContext(w, h)
+		dc.SetFontFace(face)
+		dc.SetRGB(1, 1, 1)
+		dc.DrawString(string(r), float64(left-x0), float64(top-y0))
+
+		glyphs = append(glyphs, bmfontEffects(dc.Image().(*image.RGBA), opts))
+		names = append(names, string(r))
+		packed = append(packed, i)
+
+		bm.Chars[i].XOffset = x0 - left
+		bm.Chars[i].YOffset = bm.Base + y0 - top
+	}
+
+	var pages []*image.NRGBA
+	if len(glyphs) > 0 {
+		atlas, atlasPages, err := AtlasPack(glyphs, names, opts.Atlas)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, s := range atlas.Sprites {
+			c := &bm.Chars[packed[i]]
+			c.X, c.Y = s.X, s.Y
+			c.Width, c.Height = s.Width, s.Height
+			c.Page = s.Page
+		}
+		pages = atlasPages
+	} else {
+		pages = []*image.NRGBA{image.NewNRGBA(image.Rect(0, 0, 1, 1))}
+	}
+
+	// pages are packed as small as they can be, but bmfont uses one size for all of them.
+	for _, p := range pages {
+		bm.ScaleW = max(bm.ScaleW, p.Rect.Dx())
+		bm.ScaleH = max(bm.ScaleH, p.Rect.Dy())
+	}
+	for i, p := range pages {
+		if p.Rect.Dx() == bm.ScaleW && p.Rect.Dy() == bm.ScaleH {
+			continue
+		}
+
+		page := image.NewNRGBA(image.Rect(0, 0, bm.ScaleW, bm.ScaleH))
+		for y := range p.Rect.Dy() {
+			copy(page.Pix[y*page.Stride:], p.Pix[y*p.Stride:y*p.Stride+p.Rect.Dx()*4])
+		}
+		pages[i] = page
+	}
+	bm.Pages = make([]string, len(pages))
+
+	for _, first := range chars {
+		for _, second := range chars {
+			if k := face.Kern(first, second).Round(); k != 0 {
+				bm.Kernings = append(bm.Kernings, BMFontKerning{First: first, Second: second, Amount: k})
+			}
+		}
+	}
+
+	return bm, pages, nil
+}
+
+// bmfontEffects colors the glyph coverage, and draws the outline and shadow behind it.
+func bmfontEffects(glyph *image.RGBA, opts *BMFontOptions) *image.NRGBA {
+	w, h := glyph.Rect.Dx(), glyph.Rect.Dy()
+
+	fill := make([]float64, w*h)
+	for i := range fill {
+		fill[i] = float64(glyph.Pix[i*4+3]) / 255
+	}
+
+	shape := fill
+	var outline []float64
+	if opts.Outline > 0 {
+		outline = bmfontDilate(fill, w, h, opts.Outline)
+		shape = outline
+	}
+
+	type layer struct {
+		mask []float64
+		c    color.NRGBA
+		dx   int
+		dy   int
+	}
+	layers := []layer{}
+	if opts.ShadowX != 0 || opts.ShadowY != 0 {
+		layers = append(layers, layer{shape, opts.ShadowColor, opts.ShadowX, opts.ShadowY})
+	}
+	if outline != nil {
+		layers = append(layers, layer{outline, opts.OutlineColor, 0, 0})
+	}
+	layers = append(layers, layer{fill, opts.Color, 0, 0})
+
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			// composited with premultiplied alpha, bottom layer first.
+			var r, g, b, a float64
+
+			for _, l := range layers {
+				sx, sy := x-l.dx, y-l.dy
+				if sx < 0 || sy < 0 || sx >= w || sy >= h {
+					continue
+				}
+
+				la := l.mask[sy*w+sx] * float64(l.c.A) / 255
+				r = float64(l.c.R)/255*la + r*(1-la)
+				g = float64(l.c.G)/255*la + g*(1-la)
+				b = float64(l.c.B)/255*la + b*(1-la)
+				a = la + a*(1-la)
+			}
+
+			if a <= 0 {
+				continue
+			}
+
+			i := y*out.Stride + x*4
+			out.Pix[i] = uint8(math.Round(r / a * 255))
+			out.Pix[i+1] = uint8(math.Round(g / a * 255))
+			out.Pix[i+2] = uint8(math.Round(b / a * 255))
+			out.Pix[i+3] = uint8(math.Round(a * 255))
+		}
+	}
+
+	return out
+}
+
+// bmfontDilate spreads the coverage by radius pixels, using a circle so corners stay round.
+func bmfontDilate(mask []float64, w, h, radius int) []float64 {
+	out := make([]float64, len(mask))
+	r2 := radius * radius
+
+	for y := range h {
+		for x := range w {
+			v := 0.0
+			for oy := max(y-radius, 0); oy <= min(y+radius, h-1); oy++ {
+				for ox := max(x-radius, 0); ox <= min(x+radius, w-1); ox++ {
+					dx, dy := ox-x, oy-y
+					if dx*dx+dy*dy <= r2 {
+						v = math.Max(v, mask[oy*w+ox])
+					}
+				}
+			}
+			out[y*w+x] = v
+		}
+	}
+
+	return out
+}
+
+// Text exports the font in the BMFont text format.
+func (f *BMFont) Text() string {
+	b := strings.Builder{}
+
+	face := strings.ReplaceAll(f.Face, "\"", "")
+	fmt.Fprintf(&b, "info face=\"%s\" size=%d bold=0 italic=0 charset=\"\" unicode=1 stretchH=100 smooth=1 aa=1 padding=%d,%d,%d,%d spacing=%d,%d outline=%d\n",
+		face, f.Size, f.Padding, f.Padding, f.Padding, f.Padding, f.Spacing, f.Spacing, f.Outline)
+	fmt.Fprintf(&b, "common lineHeight=%d base=%d scaleW=%d scaleH=%d pages=%d packed=0 alphaChnl=0 redChnl=0 greenChnl=0 blueChnl=0\n",
+		f.LineHeight, f.Base, f.ScaleW, f.ScaleH, len(f.Pages))
+
+	for i, p := range f.Pages {
+		fmt.Fprintf(&b, "page id=%d file=\"%s\"\n", i, p)
+	}
+
+	fmt.Fprintf(&b, "chars count=%d\n", len(f.Chars))
+	for _, c := range f.Chars {
+		fmt.Fprintf(&b, "char id=%d x=%d y=%d width=%d height=%d xoffset=%d yoffset=%d xadvance=%d page=%d chnl=15\n",
+			c.ID, c.X, c.Y, c.Width, c.Height, c.XOffset, c.YOffset, c.XAdvance, c.Page)
+	}
+
+	if len(f.Kernings) > 0 {
+		fmt.Fprintf(&b, "kernings count=%d\n", len(f.Kernings))
+		for _, k := range f.Kernings {
+			fmt.Fprintf(&b, "kerning first=%d second=%d amount=%d\n", k.First, k.Second, k.Amount)
+		}
+	}
+
+	return b.String()
+}
+
+type bmfontXMLInfo struct {
+	Face     string `xml:"face,attr"`
+	Size     int    `xml:"size,attr"`
+	Bold     int    `xml:"bold,attr"`
+	Italic   int    `xml:"italic,attr"`
+	Charset  string `xml:"charset,attr"`
+	Unicode  int    `xml:"unicode,attr"`
+	StretchH int    `xml:"stretchH,attr"`
+	Smooth   int    `xml:"smooth,attr"`
+	AA       int    `xml:"aa,attr"`
+	Padding  string `xml:"padding,attr"`
+	Spacing  string `xml:"spacing,attr"`
+	Outline  int    `xml:"outline,attr"`
+}
+
+type bmfontXMLCommon struct {
+	LineHeight int `xml:"lineHeight,attr"`
+	Base       int `xml:"base,attr"`
+	ScaleW     int `xml:"scaleW,attr"`
+	ScaleH     int `xml:"scaleH,attr"`
+	Pages      int `xml:"pages,attr"`
+	Packed     int `xml:"packed,attr"`
+	AlphaChnl  int `xml:"alphaChnl,attr"`
+	RedChnl    int `xml:"redChnl,attr"`
+	GreenChnl  int `xml:"greenChnl,attr"`
+	BlueChnl   int `xml:"blueChnl,attr"`
+}
+
+type bmfontXMLPage struct {
+	ID   int    `xml:"id,attr"`
+	File string `xml:"file,attr"`
+}
+
+type bmfontXMLChar struct {
+	ID       int `xml:"id,attr" json:"id"`
+	X        int `xml:"x,attr" json:"x"`
+	Y        int `xml:"y,attr" json:"y"`
+	Width    int `xml:"width,attr" json:"width"`
+	Height   int `xml:"height,attr" json:"height"`
+	XOffset  int `xml:"xoffset,attr" json:"xoffset"`
+	YOffset  int `xml:"yoffset,attr" json:"yoffset"`
+	XAdvance int `xml:"xadvance,attr" json:"xadvance"`
+	Page     int `xml:"page,attr" json:"page"`
+	Chnl     int `xml:"chnl,attr" json:"chnl"`
+}
+
+type bmfontXMLKerning struct {
+	First  int `xml:"first,attr" json:"first"`
+	Second int `xml:"second,attr" json:"second"`
+	Amount int `xml:"amount,attr" json:"amount"`
+}
+
+func (f *BMFont) xmlChars() []bmfontXMLChar {
+	chars := make([]bmfontXMLChar, len(f.Chars))
+	for i, c := range f.Chars {
+		chars[i] = bmfontXMLChar{int(c.ID), c.X, c.Y, c.Width, c.Height, c.XOffset, c.YOffset, c.XAdvance, c.Page, 15}
+	}
+	return chars
+}
+
+func (f *BMFont) xmlKernings() []bmfontXMLKerning {
+	kernings := make([]bmfontXMLKerning, len(f.Kernings))
+	for i, k := range f.Kernings {
+		kernings[i] = bmfontXMLKerning{int(k.First), int(k.Second), k.Amount}
+	}
+	return kernings
+}
+
+// XML exports the font in the BMFont xml format.
+func (f *BMFont) XML() ([]byte, error) {
+	type chars struct {
+		Count int             `xml:"count,attr"`
+		Chars []bmfontXMLChar `xml:"char"`
+	}
+	type kernings struct {
+		Count    int                `xml:"count,attr"`
+		Kernings []bmfontXMLKerning `xml:"kerning"`
+	}
+
+	data := struct {
+		XMLName  xml.Name        `xml:"font"`
+		Info     bmfontXMLInfo   `xml:"info"`
+		Common   bmfontXMLCommon `xml:"common"`
+		Pages    []bmfontXMLPage `xml:"pages>page"`
+		Chars    chars           `xml:"chars"`
+		Kernings *kernings       `xml:"kernings,omitempty"`
+	}{
+		Info: bmfontXMLInfo{
+			Face: f.Face, Size: f.Size, Unicode: 1, StretchH: 100, Smooth: 1, AA: 1,
+			Padding: fmt.Sprintf("%d,%d,%d,%d", f.Padding, f.Padding, f.Padding, f.Padding),
+			Spacing: fmt.Sprintf("%d,%d", f.Spacing, f.Spacing),
+			Outline: f.Outline,
+		},
+		Common: bmfontXMLCommon{
+			LineHeight: f.LineHeight, Base: f.Base, ScaleW: f.ScaleW, ScaleH: f.ScaleH, Pages: len(f.Pages),
+		},
+		Chars: chars{len(f.Chars), f.xmlChars()},
+	}
+
+	for i, p := range f.Pages {
+		data.Pages = append(data.Pages, bmfontXMLPage{i, p})
+	}
+	if len(f.Kernings) > 0 {
+		data.Kernings = &kernings{len(f.Kernings), f.xmlKernings()}
+	}
+
+	b, err := xml.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// JSON exports the font in the json layout commonly used by web and engine loaders,
+// which mirrors the xml format with the padding and spacing as arrays.
+func (f *BMFont) JSON() ([]byte, error) {
+	type info struct {
+		Face     string `json:"face"`
+		Size     int    `json:"size"`
+		Bold     int    `json:"bold"`
+		Italic   int    `json:"italic"`
+		Charset  []rune `json:"charset"`
+		Unicode  int    `json:"unicode"`
+		StretchH int    `json:"stretchH"`
+		Smooth   int    `json:"smooth"`
+		AA       int    `json:"aa"`
+		Padding  []int  `json:"padding"`
+		Spacing  []int  `json:"spacing"`
+		Outline  int    `json:"outline"`
+	}
+	type common struct {
+		LineHeight int `json:"lineHeight"`
+		Base       int `json:"base"`
+		ScaleW     int `json:"scaleW"`
+		ScaleH     int `json:"scaleH"`
+		Pages      int `json:"pages"`
+		Packed     int `json:"packed"`
+		AlphaChnl  int `json:"alphaChnl"`
+		RedChnl    int `json:"redChnl"`
+		GreenChnl  int `json:"greenChnl"`
+		BlueChnl   int `json:"blueChnl"`
+	}
+
+	charset := make([]rune, len(f.Chars))
+	for i, c := range f.Chars {
+		charset[i] = c.ID
+	}
+
+	data := struct {
+		Pages    []string           `json:"pages"`
+		Chars    []bmfontXMLChar    `json:"chars"`
+		Info     info               `json:"info"`
+		Common   common             `json:"common"`
+		Kernings []bmfontXMLKerning `json:"kernings"`
+	}{
+		Pages: f.Pages,
+		Chars: f.xmlChars(),
+		Info: info{
+			Face: f.Face, Size: f.Size, Charset: charset, Unicode: 1, StretchH: 100, Smooth: 1, AA: 1,
+			Padding: []int{f.Padding, f.Padding, f.Padding, f.Padding},
+			Spacing: []int{f.Spacing, f.Spacing},
+			Outline: f.Outline,
+		},
+		Common: common{
+			LineHeight: f.LineHeight, Base: f.Base, ScaleW: f.ScaleW, ScaleH: f.ScaleH, Pages: len(f.Pages),
+		},
+		Kernings: f.xmlKernings(),
+	}
+
+	return json.MarshalIndent(data, "", "\t")
+}
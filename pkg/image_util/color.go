@@ -39,6 +39,11 @@ func Set(img image.Image, x, y, red, green, blue, alpha int) {
 	case *image.CMYK:
 		c := color.CMYKModel.Convert(col)
 		i.Set(x, y, c)
+	case *image.Paletted:
+		i.Set(x, y, col)
+	case *RGBAF32:
+		c := ColorRGBAF32Model.Convert(col)
+		i.Set(x, y, c)
 	}
 }
 
@@ -76,7 +81,12 @@ func GetColor(img image.Image, state *golua.LState, x, y int) *golua.LTable {
 	case *image.CMYK:
 		r, g, b, a := i.CMYKAt(x, y).RGBA()
 		return CMYKToColorTable(state, int(r), int(g), int(b), int(a))
-
+	case *image.Paletted:
+		c := color.RGBAModel.Convert(i.At(x, y)).(color.RGBA)
+		return RGBAColorToColorTable(state, &c)
+	case *RGBAF32:
+		r, g, b, a := i.RGBAF32At(x, y).RGBA()
+		return RGBAToColorTable(state, int(r), int(g), int(b), int(a))
 	}
 
 	return nil
@@ -115,6 +125,12 @@ func ConvertColor(model ColorModel, red, green, blue, alpha int) (int, int, int,
 	case MODEL_CMYK:
 		c := color.CMYKModel.Convert(col)
 		re, gr, bl, al = c.RGBA()
+	case MODEL_PALETTED:
+		// the palette is unknown without an image, so the color is left unchanged.
+		re, gr, bl, al = col.RGBA()
+	case MODEL_RGBAF32:
+		c := ColorRGBAF32Model.Convert(col)
+		re, gr, bl, al = c.RGBA()
 	}
 
 	return int(re), int(gr), int(bl), int(al)
@@ -0,0 +1,371 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Lab is CIELAB with a D65 white point.
+type Lab struct {
+	L float64
+	A float64
+	B float64
+}
+
+func linearToLab(r, g, b float64) Lab {
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+// ColorToLab converts an 8-bit sRGB color to CIELAB, alpha is ignored.
+func ColorToLab(c color.NRGBA) Lab {
+	return linearToLab(srgbLinearTable[c.R], srgbLinearTable[c.G], srgbLinearTable[c.B])
+}
+
+// CIEDE2000 is the perceptual difference between two colors,
+// a difference below 1 is not visible and around 2.3 is just noticeable.
+func CIEDE2000(c1, c2 Lab) float64 {
+	const pow25_7 = 6103515625.0
+
+	cbar := (math.Hypot(c1.A, c1.B) + math.Hypot(c2.A, c2.B)) / 2
+	cbar7 := math.Pow(cbar, 7)
+	g := 0.5 * (1 - math.Sqrt(cbar7/(cbar7+pow25_7)))
+
+	a1 := (1 + g) * c1.A
+	a2 := (1 + g) * c2.A
+	cp1 := math.Hypot(a1, c1.B)
+	cp2 := math.Hypot(a2, c2.B)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	hp1 := hue(c1.B, a1)
+	hp2 := hue(c2.B, a2)
+
+	dL := c2.L - c1.L
+	dC := cp2 - cp1
+
+	dh := 0.0
+	if cp1*cp2 != 0 {
+		dh = hp2 - hp1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(cp1*cp2) * math.Sin(dh*math.Pi/360)
+
+	lbar := (c1.L + c2.L) / 2
+	cpbar := (cp1 + cp2) / 2
+
+	hbar := hp1 + hp2
+	if cp1*cp2 != 0 {
+		switch {
+		case math.Abs(hp1-hp2) <= 180:
+			hbar /= 2
+		case hbar < 360:
+			hbar = (hbar + 360) / 2
+		default:
+			hbar = (hbar - 360) / 2
+		}
+	}
+
+	rad := math.Pi / 180
+	t := 1 - 0.17*math.Cos((hbar-30)*rad) + 0.24*math.Cos(2*hbar*rad) +
+		0.32*math.Cos((3*hbar+6)*rad) - 0.20*math.Cos((4*hbar-63)*rad)
+	dTheta := 30 * math.Exp(-math.Pow((hbar-275)/25, 2))
+
+	cpbar7 := math.Pow(cpbar, 7)
+	rc := 2 * math.Sqrt(cpbar7/(cpbar7+pow25_7))
+	l50 := (lbar - 50) * (lbar - 50)
+	sl := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sc := 1 + 0.045*cpbar
+	sh := 1 + 0.015*cpbar*t
+	rt := -math.Sin(2*dTheta*rad) * rc
+
+	lt := dL / sl
+	ct := dC / sc
+	ht := dH / sh
+
+	return math.Sqrt(lt*lt + ct*ct + ht*ht + rt*ct*ht)
+}
+
+// CompareResult holds the metrics from ImageCompareMetrics.
+type CompareResult struct {
+	// PSNR is in decibels over all four channels, it is infinite when the images are equal.
+	PSNR float64
+	// SSIM is the mean structural similarity of the luma, 1 when the images are equal.
+	SSIM float64
+	// DeltaEMean and DeltaEMax are the CIEDE2000 differences between the pixels.
+	DeltaEMean float64
+	DeltaEMax  float64
+	// Differing is the number of pixels with a delta-E above the threshold.
+	Differing int
+}
+
+// CompareTolerance sets the limits for each metric,
+// DefaultCompareTolerance has every limit disabled.
+type CompareTolerance struct {
+	MinPSNR       float64
+	MinSSIM       float64
+	MaxDeltaEMean float64
+	MaxDeltaE     float64
+	MaxDiffering  int
+	// Threshold is the delta-E a pixel must be above to be counted as differing.
+	Threshold float64
+}
+
+func DefaultCompareTolerance() CompareTolerance {
+	return CompareTolerance{
+		MinPSNR:       0,
+		MinSSIM:       -1,
+		MaxDeltaEMean: math.Inf(1),
+		MaxDeltaE:     math.Inf(1),
+		MaxDiffering:  -1,
+		Threshold:     0,
+	}
+}
+
+// Check returns an error describing the first metric outside of the tolerance.
+func (t CompareTolerance) Check(r *CompareResult) error {
+	switch {
+	case r.PSNR < t.MinPSNR:
+		return fmt.Errorf("psnr %.2f is below %.2f", r.PSNR, t.MinPSNR)
+	case r.SSIM < t.MinSSIM:
+		return fmt.Errorf("ssim %.4f is below %.4f", r.SSIM, t.MinSSIM)
+	case r.DeltaEMean > t.MaxDeltaEMean:
+		return fmt.Errorf("mean delta-e %.3f is above %.3f", r.DeltaEMean, t.MaxDeltaEMean)
+	case r.DeltaEMax > t.MaxDeltaE:
+		return fmt.Errorf("max delta-e %.3f is above %.3f", r.DeltaEMax, t.MaxDeltaE)
+	case t.MaxDiffering >= 0 && r.Differing > t.MaxDiffering:
+		return fmt.Errorf("%d pixels differ, more than %d", r.Differing, t.MaxDiffering)
+	}
+
+	return nil
+}
+
+var (
+	compareDiffColor  = color.NRGBA{255, 0, 0, 255}
+	compareMinorColor = color.NRGBA{255, 200, 0, 255}
+)
+
+// ImageCompareMetrics compares two images of the same size with perceptual metrics.
+// Pixels with a delta-E above the threshold are counted as differing.
+// When diff is true a visual diff is also returned, a faded copy of img1 with differing pixels in red
+// and pixels with a difference at or below the threshold in yellow.
+//
+// Colors are compared after compositing over both black and white, using the larger difference,
+// so fully transparent pixels are equal no matter their color.
+func ImageCompareMetrics(img1, img2 image.Image, threshold float64, diff bool) (*CompareResult, *image.NRGBA, error) {
+	b1, b2 := img1.Bounds(), img2.Bounds()
+	if b1.Dx() != b2.Dx() || b1.Dy() != b2.Dy() {
+		return nil, nil, fmt.Errorf("images must be the same size, got: %dx%d and %dx%d", b1.Dx(), b1.Dy(), b2.Dx(), b2.Dy())
+	}
+
+	src1 := imageNRGBA(img1)
+	src2 := imageNRGBA(img2)
+	width, height := b1.Dx(), b1.Dy()
+	total := width * height
+
+	result := &CompareResult{}
+
+	var out *image.NRGBA
+	if diff {
+		out = image.NewNRGBA(image.Rect(0, 0, width, height))
+	}
+
+	if total == 0 {
+		result.PSNR = math.Inf(1)
+		result.SSIM = 1
+		return result, out, nil
+	}
+
+	luma1 := make([]float64, total)
+	luma2 := make([]float64, total)
+
+	sqErr := 0.0
+	deltaSum := 0.0
+
+	for i := range total {
+		p1 := src1.Pix[i*4 : i*4+4 : i*4+4]
+		p2 := src2.Pix[i*4 : i*4+4 : i*4+4]
+
+		var black1, black2 [3]uint8
+		for c := range 3 {
+			black1[c] = comparePremul(p1[c], p1[3])
+			black2[c] = comparePremul(p2[c], p2[3])
+
+			d := float64(black1[c]) - float64(black2[c])
+			sqErr += d * d
+		}
+		da := float64(p1[3]) - float64(p2[3])
+		sqErr += da * da
+
+		luma1[i] = (0.299*float64(black1[0]) + 0.587*float64(black1[1]) + 0.114*float64(black1[2])) / 255
+		luma2[i] = (0.299*float64(black2[0]) + 0.587*float64(black2[1]) + 0.114*float64(black2[2])) / 255
+
+		delta := 0.0
+		if black1 != black2 || p1[3] != p2[3] {
+			delta = CIEDE2000(compareLab(black1), compareLab(black2))
+
+			if p1[3] != 255 || p2[3] != 255 {
+				var white1, white2 [3]uint8
+				for c := range 3 {
+					white1[c] = black1[c] + 255 - p1[3]
+					white2[c] = black2[c] + 255 - p2[3]
+				}
+				delta = max(delta, CIEDE2000(compareLab(white1), compareLab(white2)))
+			}
+		}
+
+		deltaSum += delta
+		result.DeltaEMax = max(result.DeltaEMax, delta)
+		if delta > threshold {
+			result.Differing++
+		}
+
+		if diff {
+			c := compareDiffColor
+			if delta == 0 {
+				// a faded copy of the image over white.
+				v := uint8(255 - (255-math.Round(luma1[i]*255+float64(255-p1[3])))*0.25)
+				c = color.NRGBA{v, v, v, 255}
+			} else if delta <= threshold {
+				c = compareMinorColor
+			}
+			out.Pix[i*4], out.Pix[i*4+1], out.Pix[i*4+2], out.Pix[i*4+3] = c.R, c.G, c.B, c.A
+		}
+	}
+
+	result.DeltaEMean = deltaSum / float64(total)
+
+	mse := sqErr / float64(total*4) / (255 * 255)
+	if mse == 0 {
+		result.PSNR = math.Inf(1)
+	} else {
+		result.PSNR = 10 * math.Log10(1/mse)
+	}
+
+	result.SSIM = compareSSIM(luma1, luma2, width, height)
+
+	return result, out, nil
+}
+
+func comparePremul(v, a uint8) uint8 {
+	return uint8((uint32(v)*uint32(a) + 127) / 255)
+}
+
+func compareLab(c [3]uint8) Lab {
+	return linearToLab(srgbLinearTable[c[0]], srgbLinearTable[c[1]], srgbLinearTable[c[2]])
+}
+
+// compareSSIM is the mean SSIM using an 11x11 gaussian window with a sigma of 1.5.
+func compareSSIM(x, y []float64, width, height int) float64 {
+	const (
+		c1 = 0.01 * 0.01
+		c2 = 0.03 * 0.03
+	)
+
+	total := width * height
+	xx := make([]float64, total)
+	yy := make([]float64, total)
+	xy := make([]float64, total)
+	for i := range total {
+		xx[i] = x[i] * x[i]
+		yy[i] = y[i] * y[i]
+		xy[i] = x[i] * y[i]
+	}
+
+	kernel := compareGaussian(5, 1.5)
+	tmp := make([]float64, total)
+
+	mx := compareBlur(x, tmp, width, height, kernel)
+	my := compareBlur(y, tmp, width, height, kernel)
+	sxx := compareBlur(xx, tmp, width, height, kernel)
+	syy := compareBlur(yy, tmp, width, height, kernel)
+	sxy := compareBlur(xy, tmp, width, height, kernel)
+
+	sum := 0.0
+	for i := range total {
+		vx := sxx[i] - mx[i]*mx[i]
+		vy := syy[i] - my[i]*my[i]
+		cov := sxy[i] - mx[i]*my[i]
+
+		sum += ((2*mx[i]*my[i] + c1) * (2*cov + c2)) /
+			((mx[i]*mx[i] + my[i]*my[i] + c1) * (vx + vy + c2))
+	}
+
+	return sum / float64(total)
+}
+
+func compareGaussian(radius int, sigma float64) []float64 {
+	kernel := make([]float64, radius*2+1)
+
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	return kernel
+}
+
+// compareBlur applies the separable kernel, edges are clamped.
+func compareBlur(src, tmp []float64, width, height int, kernel []float64) []float64 {
+	radius := len(kernel) / 2
+	dst := make([]float64, len(src))
+
+	for y := range height {
+		row := y * width
+		for x := range width {
+			v := 0.0
+			for k, w := range kernel {
+				sx := min(max(x+k-radius, 0), width-1)
+				v += src[row+sx] * w
+			}
+			tmp[row+x] = v
+		}
+	}
+
+	for y := range height {
+		for x := range width {
+			v := 0.0
+			for k, w := range kernel {
+				sy := min(max(y+k-radius, 0), height-1)
+				v += tmp[sy*width+x] * w
+			}
+			dst[y*width+x] = v
+		}
+	}
+
+	return dst
+}
@@ -29,6 +29,14 @@ func CopyImage(src image.Image, model ColorModel) image.Image {
 		c = image.NewGray16(r)
 	case MODEL_CMYK:
 		c = image.NewCMYK(r)
+	case MODEL_PALETTED:
+		if p, ok := src.(*image.Paletted); ok {
+			c = image.NewPaletted(r, ClonePalette(p.Palette))
+		} else {
+			c = image.NewPaletted(r, QuantizePalette(src, 256))
+		}
+	case MODEL_RGBAF32:
+		c = NewRGBAF32(r)
 	}
 
 	copyImage(c, src)
@@ -36,5 +44,20 @@ func CopyImage(src image.Image, model ColorModel) image.Image {
 }
 
 func copyImage(dst draw.Image, src image.Image) {
+	if f, ok := dst.(*RGBAF32); ok {
+		drawRGBAF32(f, f.Rect, src, src.Bounds().Min)
+		return
+	}
+
 	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
 }
+
+// imageNRGBA returns the image as NRGBA starting at (0,0) with no padding between rows,
+// it is only copied when needed.
+func imageNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) && n.Stride == n.Rect.Dx()*4 {
+		return n
+	}
+
+	return CopyImage(img, MODEL_NRGBA).(*image.NRGBA)
+}
@@ -0,0 +1,594 @@
+package imageutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/bits"
+)
+
+type DDSFormat int
+
+const (
+	DDSFORMAT_RGBA DDSFormat = iota
+	DDSFORMAT_BC1
+	DDSFORMAT_BC3
+)
+
+var DDSFormatList = []DDSFormat{
+	DDSFORMAT_RGBA,
+	DDSFORMAT_BC1,
+	DDSFORMAT_BC3,
+}
+
+const ddsMagic = "DDS "
+
+const (
+	ddsHeaderSize     = 124
+	ddsHeaderDX10Size = 20
+)
+
+const (
+	ddsFlagCaps        = 0x1
+	ddsFlagHeight      = 0x2
+	ddsFlagWidth       = 0x4
+	ddsFlagPitch       = 0x8
+	ddsFlagPixelFormat = 0x1000
+	ddsFlagLinearSize  = 0x80000
+
+	ddsCapsTexture = 0x1000
+)
+
+const (
+	ddsPixelAlphaPixels = 0x1
+	ddsPixelAlpha       = 0x2
+	ddsPixelFourCC      = 0x4
+	ddsPixelRGB         = 0x40
+	ddsPixelLuminance   = 0x20000
+)
+
+// the DXGI formats that can be decoded from a DX10 header.
+const (
+	dxgiR8G8B8A8     = 28
+	dxgiR8G8B8A8SRGB = 29
+	dxgiBC1          = 71
+	dxgiBC1SRGB      = 72
+	dxgiBC3          = 77
+	dxgiBC3SRGB      = 78
+	dxgiB8G8R8A8     = 87
+	dxgiB8G8R8A8SRGB = 91
+)
+
+type ddsHeader struct {
+	width  int
+	height int
+
+	pixelFlags uint32
+	fourCC     string
+	bitCount   int
+	masks      [4]uint32
+}
+
+func ddsHeaderRead(r io.Reader) (*ddsHeader, error) {
+	b := make([]byte, 4+ddsHeaderSize)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+	if string(b[0:4]) != ddsMagic {
+		return nil, fmt.Errorf("invalid dds")
+	}
+
+	b = b[4:]
+	if binary.LittleEndian.Uint32(b[0:4]) != ddsHeaderSize {
+		return nil, fmt.Errorf("invalid dds header size")
+	}
+
+	h := &ddsHeader{
+		height:     int(binary.LittleEndian.Uint32(b[8:12])),
+		width:      int(binary.LittleEndian.Uint32(b[12:16])),
+		pixelFlags: binary.LittleEndian.Uint32(b[76:80]),
+		fourCC:     string(b[80:84]),
+		bitCount:   int(binary.LittleEndian.Uint32(b[84:88])),
+	}
+	for i := range h.masks {
+		h.masks[i] = binary.LittleEndian.Uint32(b[88+i*4:])
+	}
+
+	if h.pixelFlags&ddsPixelFourCC == 0 {
+		h.fourCC = ""
+	}
+
+	if h.fourCC == "DX10" {
+		dx10 := make([]byte, ddsHeaderDX10Size)
+		_, err := io.ReadFull(r, dx10)
+		if err != nil {
+			return nil, err
+		}
+
+		switch binary.LittleEndian.Uint32(dx10[0:4]) {
+		case dxgiBC1, dxgiBC1SRGB:
+			h.fourCC = "DXT1"
+		case dxgiBC3, dxgiBC3SRGB:
+			h.fourCC = "DXT5"
+		case dxgiR8G8B8A8, dxgiR8G8B8A8SRGB:
+			h.fourCC = ""
+			h.pixelFlags = ddsPixelRGB | ddsPixelAlphaPixels
+			h.bitCount = 32
+			h.masks = [4]uint32{0x000000FF, 0x0000FF00, 0x00FF0000, 0xFF000000}
+		case dxgiB8G8R8A8, dxgiB8G8R8A8SRGB:
+			h.fourCC = ""
+			h.pixelFlags = ddsPixelRGB | ddsPixelAlphaPixels
+			h.bitCount = 32
+			h.masks = [4]uint32{0x00FF0000, 0x0000FF00, 0x000000FF, 0xFF000000}
+		default:
+			return nil, fmt.Errorf("unsupported dds dxgi format: %d", binary.LittleEndian.Uint32(dx10[0:4]))
+		}
+	}
+
+	switch h.fourCC {
+	case "", "DXT1", "DXT5":
+	default:
+		return nil, fmt.Errorf("unsupported dds format: %s", h.fourCC)
+	}
+
+	if err := decodeSizeCheck(h.width, h.height, 4); err != nil {
+		return nil, err
+	}
+
+	if h.fourCC == "" {
+		switch h.bitCount {
+		case 8, 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("unsupported dds bit count: %d", h.bitCount)
+		}
+	}
+
+	return h, nil
+}
+
+func DDSDecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := ddsHeaderRead(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      h.width,
+		Height:     h.height,
+	}, nil
+}
+
+// DDSDecode decodes the top level of the first surface,
+// supporting uncompressed formats described by bit masks, BC1 (DXT1) and BC3 (DXT5).
+func DDSDecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	h, err := ddsHeaderRead(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, h.width, h.height))
+
+	switch h.fourCC {
+	case "DXT1":
+		err = ddsBlockDecode(br, img, 8, func(block []byte, out *[16]color.NRGBA) {
+			bcColorDecode(block, out, true)
+		})
+	case "DXT5":
+		err = ddsBlockDecode(br, img, 16, func(block []byte, out *[16]color.NRGBA) {
+			bcColorDecode(block[8:], out, false)
+			bcAlphaDecode(block, out)
+		})
+	default:
+		err = ddsUncompressedDecode(br, img, h)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func ddsUncompressedDecode(r io.Reader, img *image.NRGBA, h *ddsHeader) error {
+	size := h.bitCount / 8
+	row := make([]byte, h.width*size)
+
+	hasAlpha := h.pixelFlags&(ddsPixelAlphaPixels|ddsPixelAlpha) != 0 && h.masks[3] != 0
+	alphaOnly := h.pixelFlags&ddsPixelAlpha != 0 && h.pixelFlags&(ddsPixelRGB|ddsPixelLuminance) == 0
+	luminance := h.pixelFlags&ddsPixelLuminance != 0
+
+	for y := range h.height {
+		_, err := io.ReadFull(r, row)
+		if err != nil {
+			return err
+		}
+
+		for x := range h.width {
+			var v uint32
+			for i := range size {
+				v |= uint32(row[x*size+i]) << (8 * i)
+			}
+
+			c := color.NRGBA{A: 255}
+			switch {
+			case alphaOnly:
+				c.R, c.G, c.B = 255, 255, 255
+			case luminance:
+				c.R = ddsMaskValue(v, h.masks[0])
+				c.G, c.B = c.R, c.R
+			default:
+				c.R = ddsMaskValue(v, h.masks[0])
+				c.G = ddsMaskValue(v, h.masks[1])
+				c.B = ddsMaskValue(v, h.masks[2])
+			}
+			if hasAlpha {
+				c.A = ddsMaskValue(v, h.masks[3])
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return nil
+}
+
+// ddsMaskValue extracts the masked bits and scales them to 8-bits.
+func ddsMaskValue(v, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+
+	shift := bits.TrailingZeros32(mask)
+	top := uint64(mask >> shift)
+	return uint8((uint64((v&mask)>>shift)*255 + top/2) / top)
+}
+
+func ddsBlockDecode(r io.Reader, img *image.NRGBA, blockSize int, decode func(block []byte, out *[16]color.NRGBA)) error {
+	bw := (img.Rect.Dx() + 3) / 4
+	bh := (img.Rect.Dy() + 3) / 4
+
+	row := make([]byte, bw*blockSize)
+	out := [16]color.NRGBA{}
+
+	for by := range bh {
+		_, err := io.ReadFull(r, row)
+		if err != nil {
+			return err
+		}
+
+		for bx := range bw {
+			decode(row[bx*blockSize:(bx+1)*blockSize], &out)
+
+			for i, c := range out {
+				x := bx*4 + i%4
+				y := by*4 + i/4
+				if x < img.Rect.Dx() && y < img.Rect.Dy() {
+					img.SetNRGBA(x, y, c)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func bc565(v uint16) color.NRGBA {
+	r := uint8(v>>11) & 0x1F
+	g := uint8(v>>5) & 0x3F
+	b := uint8(v) & 0x1F
+	return color.NRGBA{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, 255}
+}
+
+func bcPalette(c0, c1 uint16, punchthrough bool) [4]color.NRGBA {
+	a := bc565(c0)
+	b := bc565(c1)
+
+	mix := func(wa, wb, d int) color.NRGBA {
+		return color.NRGBA{
+			uint8((int(a.R)*wa + int(b.R)*wb) / d),
+			uint8((int(a.G)*wa + int(b.G)*wb) / d),
+			uint8((int(a.B)*wa + int(b.B)*wb) / d),
+			255,
+		}
+	}
+
+	if c0 > c1 || !punchthrough {
+		return [4]color.NRGBA{a, b, mix(2, 1, 3), mix(1, 2, 3)}
+	}
+	return [4]color.NRGBA{a, b, mix(1, 1, 2), {}}
+}
+
+// bcColorDecode decodes an 8 byte color block,
+// BC1 uses 3 colors and transparency when c0 <= c1, while BC3 always uses 4 colors.
+func bcColorDecode(block []byte, out *[16]color.NRGBA, punchthrough bool) {
+	c0 := binary.LittleEndian.Uint16(block[0:2])
+	c1 := binary.LittleEndian.Uint16(block[2:4])
+	indices := binary.LittleEndian.Uint32(block[4:8])
+
+	palette := bcPalette(c0, c1, punchthrough)
+	for i := range 16 {
+		out[i] = palette[(indices>>(2*i))&0x03]
+	}
+}
+
+func bcAlphaPalette(a0, a1 uint8) [8]uint8 {
+	p := [8]uint8{a0, a1}
+	if a0 > a1 {
+		for i := 1; i < 7; i++ {
+			p[i+1] = uint8((int(a0)*(7-i) + int(a1)*i) / 7)
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			p[i+1] = uint8((int(a0)*(5-i) + int(a1)*i) / 5)
+		}
+		p[6] = 0
+		p[7] = 255
+	}
+	return p
+}
+
+func bcAlphaDecode(block []byte, out *[16]color.NRGBA) {
+	palette := bcAlphaPalette(block[0], block[1])
+
+	var indices uint64
+	for i := range 6 {
+		indices |= uint64(block[2+i]) << (8 * i)
+	}
+
+	for i := range 16 {
+		out[i].A = palette[(indices>>(3*i))&0x07]
+	}
+}
+
+// DDSEncode writes a single surface without mipmaps.
+// BC1 keeps 1-bit alpha, with pixels under half transparency becoming fully transparent.
+func DDSEncode(w io.Writer, img image.Image, format DDSFormat) error {
+	n := imageNRGBA(img)
+	width := n.Rect.Dx()
+	height := n.Rect.Dy()
+
+	header := make([]byte, 4+ddsHeaderSize)
+	copy(header, ddsMagic)
+	h := header[4:]
+
+	flags := uint32(ddsFlagCaps | ddsFlagHeight | ddsFlagWidth | ddsFlagPixelFormat)
+	blocks := ((width + 3) / 4) * ((height + 3) / 4)
+
+	binary.LittleEndian.PutUint32(h[0:4], ddsHeaderSize)
+	binary.LittleEndian.PutUint32(h[8:12], uint32(height))
+	binary.LittleEndian.PutUint32(h[12:16], uint32(width))
+	binary.LittleEndian.PutUint32(h[72:76], 32) // pixel format size
+	binary.LittleEndian.PutUint32(h[104:108], ddsCapsTexture)
+
+	switch format {
+	case DDSFORMAT_RGBA:
+		flags |= ddsFlagPitch
+		binary.LittleEndian.PutUint32(h[16:20], uint32(width*4))
+		binary.LittleEndian.PutUint32(h[76:80], ddsPixelRGB|ddsPixelAlphaPixels)
+		binary.LittleEndian.PutUint32(h[84:88], 32)
+		binary.LittleEndian.PutUint32(h[88:92], 0x00FF0000)
+		binary.LittleEndian.PutUint32(h[92:96], 0x0000FF00)
+		binary.LittleEndian.PutUint32(h[96:100], 0x000000FF)
+		binary.LittleEndian.PutUint32(h[100:104], 0xFF000000)
+	case DDSFORMAT_BC1:
+		flags |= ddsFlagLinearSize
+		binary.LittleEndian.PutUint32(h[16:20], uint32(blocks*8))
+		binary.LittleEndian.PutUint32(h[76:80], ddsPixelFourCC)
+		copy(h[80:84], "DXT1")
+	case DDSFORMAT_BC3:
+		flags |= ddsFlagLinearSize
+		binary.LittleEndian.PutUint32(h[16:20], uint32(blocks*16))
+		binary.LittleEndian.PutUint32(h[76:80], ddsPixelFourCC)
+		copy(h[80:84], "DXT5")
+	default:
+		return fmt.Errorf("unsupported dds format: %d", format)
+	}
+	binary.LittleEndian.PutUint32(h[4:8], flags)
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header)
+
+	if format == DDSFORMAT_RGBA {
+		px := make([]byte, 4)
+		for i := 0; i < len(n.Pix); i += 4 {
+			px[0], px[1], px[2], px[3] = n.Pix[i+2], n.Pix[i+1], n.Pix[i+0], n.Pix[i+3]
+			bw.Write(px)
+		}
+		return bw.Flush()
+	}
+
+	block := [16]color.NRGBA{}
+	for by := 0; by < height; by += 4 {
+		for bx := 0; bx < width; bx += 4 {
+			// pixels outside of the image repeat the edge.
+			for i := range block {
+				x := min(bx+i%4, width-1)
+				y := min(by+i/4, height-1)
+				block[i] = n.NRGBAAt(x, y)
+			}
+
+			if format == DDSFORMAT_BC1 {
+				bw.Write(bcColorEncode(&block, true))
+			} else {
+				bw.Write(bcAlphaEncode(&block))
+				bw.Write(bcColorEncode(&block, false))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+func bcTo565(c color.NRGBA) uint16 {
+	return uint16(c.R>>3)<<11 | uint16(c.G>>2)<<5 | uint16(c.B>>3)
+}
+
+// bcColorEncode picks the endpoints along the principal axis of the block colors,
+// then maps each pixel to the nearest color of the palette.
+func bcColorEncode(block *[16]color.NRGBA, punchthrough bool) []byte {
+	transparent := false
+	pixels := make([]color.NRGBA, 0, 16)
+	for _, c := range block {
+		if punchthrough && c.A < 128 {
+			transparent = true
+			continue
+		}
+		pixels = append(pixels, c)
+	}
+
+	out := make([]byte, 8)
+	if len(pixels) == 0 {
+		// c0 <= c1 with every index set to transparent.
+		binary.LittleEndian.PutUint32(out[4:8], 0xFFFFFFFF)
+		return out
+	}
+
+	lo, hi := bcEndpoints(pixels)
+	c0 := bcTo565(hi)
+	c1 := bcTo565(lo)
+
+	if transparent {
+		if c0 > c1 {
+			c0, c1 = c1, c0
+		}
+	} else if c0 < c1 {
+		c0, c1 = c1, c0
+	}
+
+	binary.LittleEndian.PutUint16(out[0:2], c0)
+	binary.LittleEndian.PutUint16(out[2:4], c1)
+
+	palette := bcPalette(c0, c1, punchthrough)
+	colors := 4
+	if punchthrough && c0 <= c1 {
+		colors = 3
+	}
+
+	var indices uint32
+	for i, c := range block {
+		index := uint32(3)
+		if !(punchthrough && c.A < 128) {
+			index = uint32(bcNearest(palette[:colors], c))
+		}
+		indices |= index << (2 * i)
+	}
+	binary.LittleEndian.PutUint32(out[4:8], indices)
+
+	return out
+}
+
+func bcNearest(palette []color.NRGBA, c color.NRGBA) int {
+	best := 0
+	bestDist := math.MaxInt
+	for i, p := range palette {
+		dr := int(p.R) - int(c.R)
+		dg := int(p.G) - int(c.G)
+		db := int(p.B) - int(c.B)
+		dist := dr*dr + dg*dg + db*db
+		if dist < bestDist {
+			best = i
+			bestDist = dist
+		}
+	}
+	return best
+}
+
+// bcEndpoints projects the colors onto their principal axis, found with power iteration,
+// and returns the colors at both ends.
+func bcEndpoints(pixels []color.NRGBA) (color.NRGBA, color.NRGBA) {
+	var mean [3]float64
+	for _, c := range pixels {
+		mean[0] += float64(c.R)
+		mean[1] += float64(c.G)
+		mean[2] += float64(c.B)
+	}
+	for i := range mean {
+		mean[i] /= float64(len(pixels))
+	}
+
+	var cov [3][3]float64
+	for _, c := range pixels {
+		d := [3]float64{float64(c.R) - mean[0], float64(c.G) - mean[1], float64(c.B) - mean[2]}
+		for i := range 3 {
+			for j := range 3 {
+				cov[i][j] += d[i] * d[j]
+			}
+		}
+	}
+
+	axis := [3]float64{1, 1, 1}
+	for range 8 {
+		next := [3]float64{}
+		for i := range 3 {
+			next[i] = cov[i][0]*axis[0] + cov[i][1]*axis[1] + cov[i][2]*axis[2]
+		}
+
+		length := math.Sqrt(next[0]*next[0] + next[1]*next[1] + next[2]*next[2])
+		if length == 0 {
+			break
+		}
+		for i := range 3 {
+			axis[i] = next[i] / length
+		}
+	}
+
+	lo, hi := pixels[0], pixels[0]
+	loDot, hiDot := math.Inf(1), math.Inf(-1)
+	for _, c := range pixels {
+		dot := float64(c.R)*axis[0] + float64(c.G)*axis[1] + float64(c.B)*axis[2]
+		if dot < loDot {
+			lo, loDot = c, dot
+		}
+		if dot > hiDot {
+			hi, hiDot = c, dot
+		}
+	}
+
+	return lo, hi
+}
+
+// bcAlphaEncode uses the 8 alpha mode with the min and max alpha of the block as endpoints.
+func bcAlphaEncode(block *[16]color.NRGBA) []byte {
+	a0, a1 := uint8(0), uint8(255)
+	for _, c := range block {
+		a0 = max(a0, c.A)
+		a1 = min(a1, c.A)
+	}
+
+	out := make([]byte, 8)
+	out[0] = a0
+	out[1] = a1
+
+	if a0 == a1 {
+		return out
+	}
+
+	palette := bcAlphaPalette(a0, a1)
+
+	var indices uint64
+	for i, c := range block {
+		best := 0
+		bestDist := 256
+		for j, a := range palette {
+			dist := absInt(int(a) - int(c.A))
+			if dist < bestDist {
+				best = j
+				bestDist = dist
+			}
+		}
+		indices |= uint64(best) << (3 * i)
+	}
+
+	for i := range 6 {
+		out[2+i] = byte(indices >> (8 * i))
+	}
+
+	return out
+}
@@ -15,7 +15,32 @@ import (
 	"golang.org/x/image/tiff"
 )
 
+// DecodeOptions holds settings that are applied after an image is decoded.
+type DecodeOptions struct {
+	// AutoOrient rotates and flips the image to match its EXIF orientation.
+	AutoOrient bool
+
+	// Encoding is only used when decoding from a file,
+	// ENCODING_UNKNOWN uses the file extension.
+	Encoding ImageEncoding
+
+	// Limits are checked before the image is decoded.
+	Limits DecodeLimits
+}
+
+func DefaultDecodeOptions() *DecodeOptions {
+	return &DecodeOptions{
+		AutoOrient: false,
+		Encoding:   ENCODING_UNKNOWN,
+	}
+}
+
 func Decode(r io.ReadSeeker, encoding ImageEncoding) (image.Image, error) {
+	encoding, err := ResolveEncoding(r, encoding)
+	if err != nil {
+		return nil, err
+	}
+
 	switch encoding {
 	case ENCODING_PNG:
 		strip := PNGChunkStripper{
@@ -48,21 +73,42 @@ func Decode(r io.ReadSeeker, encoding ImageEncoding) (image.Image, error) {
 		}
 
 		return imgs[cfg.Largest], nil
+
+	case ENCODING_QOI:
+		return QOIDecode(r)
+
+	// the netpbm decoder handles all of the formats, so the encoding only matters when encoding.
+	case ENCODING_PPM, ENCODING_PGM, ENCODING_PAM, ENCODING_PBM:
+		return PNMDecode(r)
+
+	case ENCODING_TGA:
+		return TGADecode(r)
+
+	case ENCODING_DDS:
+		return DDSDecode(r)
+
+	case ENCODING_HDR:
+		return HDRDecode(r)
+
+	case ENCODING_EXR:
+		return EXRDecode(r)
 	}
 
 	return nil, fmt.Errorf("cannot decode unsupported encoding: %d", encoding)
 }
 
 func DecodeConfig(r io.Reader, encoding ImageEncoding) (int, int, error) {
+	r, encoding, err := resolveEncodingReader(r, encoding)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	var cfg image.Config
-	var err error
 
 	switch encoding {
 	case ENCODING_PNG:
-		strip := PNGChunkStripper{
-			Reader: r,
-		}
-		cfg, err = png.DecodeConfig(&strip)
+		// the header comes before any data chunks, so they don't need to be stripped.
+		cfg, err = png.DecodeConfig(r)
 
 	case ENCODING_JPEG:
 		cfg, err = jpeg.DecodeConfig(r)
@@ -88,6 +134,24 @@ func DecodeConfig(r io.Reader, encoding ImageEncoding) (int, int, error) {
 			Height: fcfg.Entries[fcfg.Largest].Height,
 		}, ferr
 
+	case ENCODING_QOI:
+		cfg, err = QOIDecodeConfig(r)
+
+	case ENCODING_PPM, ENCODING_PGM, ENCODING_PAM, ENCODING_PBM:
+		cfg, err = PNMDecodeConfig(r)
+
+	case ENCODING_TGA:
+		cfg, err = TGADecodeConfig(r)
+
+	case ENCODING_DDS:
+		cfg, err = DDSDecodeConfig(r)
+
+	case ENCODING_HDR:
+		cfg, err = HDRDecodeConfig(r)
+
+	case ENCODING_EXR:
+		cfg, err = EXRDecodeConfig(r)
+
 	default:
 		return 0, 0, fmt.Errorf("unsupported encoding: %d", encoding)
 	}
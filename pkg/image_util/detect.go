@@ -0,0 +1,126 @@
+package imageutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// tga has no signature, so the whole 18 byte header is checked instead.
+const detectHeaderSize = tgaHeaderSize
+
+// DetectEncoding checks the magic bytes at the start of data,
+// ENCODING_UNKNOWN is returned when they don't match any supported encoding.
+func DetectEncoding(data []byte) ImageEncoding {
+	switch {
+	case bytes.HasPrefix(data, []byte(magic)):
+		return ENCODING_PNG
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return ENCODING_JPEG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return ENCODING_GIF
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return ENCODING_TIFF
+	case bytes.HasPrefix(data, []byte("BM")):
+		return ENCODING_BMP
+	// the image count is checked, as an uncompressed tga header can also start with 00 00 02 00.
+	case bytes.HasPrefix(data, []byte{0x00, 0x00, 0x01, 0x00}) && favIconCount(data) > 0:
+		return ENCODING_ICO
+	case bytes.HasPrefix(data, []byte{0x00, 0x00, 0x02, 0x00}) && favIconCount(data) > 0:
+		return ENCODING_CUR
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return ENCODING_WEBP
+	case bytes.HasPrefix(data, []byte(qoiMagic)):
+		return ENCODING_QOI
+	case bytes.HasPrefix(data, []byte(ddsMagic)):
+		return ENCODING_DDS
+	case bytes.HasPrefix(data, []byte(hdrMagicRadiance)), bytes.HasPrefix(data, []byte(hdrMagicRGBE)):
+		return ENCODING_HDR
+	case bytes.HasPrefix(data, []byte(exrMagic)):
+		return ENCODING_EXR
+	case len(data) >= 3 && data[0] == 'P' && isPNMSpace(data[2]):
+		switch data[1] {
+		case '1', '4':
+			return ENCODING_PBM
+		case '2', '5':
+			return ENCODING_PGM
+		case '3', '6':
+			return ENCODING_PPM
+		case '7':
+			return ENCODING_PAM
+		}
+	// checked last as it is only a guess based on the header values.
+	case tgaValidHeader(data):
+		return ENCODING_TGA
+	}
+
+	return ENCODING_UNKNOWN
+}
+
+func favIconCount(data []byte) int {
+	if len(data) < 6 {
+		return 0
+	}
+	return int(data[4]) | int(data[5])<<8
+}
+
+// DetectEncodingReader reads the start of r to detect the encoding,
+// the reader is returned to its starting position afterwards.
+func DetectEncodingReader(r io.ReadSeeker) (ImageEncoding, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ENCODING_UNKNOWN, err
+	}
+
+	header := make([]byte, detectHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ENCODING_UNKNOWN, err
+	}
+
+	_, err = r.Seek(start, io.SeekStart)
+	if err != nil {
+		return ENCODING_UNKNOWN, err
+	}
+
+	return DetectEncoding(header[:n]), nil
+}
+
+// ResolveEncoding detects the encoding when it is ENCODING_AUTO, otherwise it is returned unchanged.
+func ResolveEncoding(r io.ReadSeeker, encoding ImageEncoding) (ImageEncoding, error) {
+	if encoding != ENCODING_AUTO {
+		return encoding, nil
+	}
+
+	encoding, err := DetectEncodingReader(r)
+	if err != nil {
+		return ENCODING_UNKNOWN, err
+	}
+	if encoding == ENCODING_UNKNOWN {
+		return ENCODING_UNKNOWN, fmt.Errorf("could not detect image encoding")
+	}
+
+	return encoding, nil
+}
+
+// resolveEncodingReader is ResolveEncoding for readers that can't seek,
+// the returned reader must be used in place of r.
+func resolveEncodingReader(r io.Reader, encoding ImageEncoding) (io.Reader, ImageEncoding, error) {
+	if encoding != ENCODING_AUTO {
+		return r, encoding, nil
+	}
+
+	br := bufio.NewReader(r)
+	header, err := br.Peek(detectHeaderSize)
+	if err != nil && err != io.EOF {
+		return br, ENCODING_UNKNOWN, err
+	}
+
+	encoding = DetectEncoding(header)
+	if encoding == ENCODING_UNKNOWN {
+		return br, ENCODING_UNKNOWN, fmt.Errorf("could not detect image encoding")
+	}
+
+	return br, encoding, nil
+}
@@ -37,6 +37,10 @@ func DrawRect(base image.Image, sub image.Image, r image.Rectangle) {
 		draw.Draw(img, r, sub, sub.Bounds().Min, draw.Src)
 	case *image.CMYK:
 		draw.Draw(img, r, sub, sub.Bounds().Min, draw.Src)
+	case *image.Paletted:
+		draw.Draw(img, r, sub, sub.Bounds().Min, draw.Src)
+	case *RGBAF32:
+		drawRGBAF32(img, r, sub, sub.Bounds().Min)
 	}
 }
 
@@ -60,6 +64,10 @@ func DrawRectSubimg(base image.Image, sub image.Image, r image.Rectangle, p imag
 		draw.Draw(img, r, sub, p, draw.Src)
 	case *image.CMYK:
 		draw.Draw(img, r, sub, p, draw.Src)
+	case *image.Paletted:
+		draw.Draw(img, r, sub, p, draw.Src)
+	case *RGBAF32:
+		drawRGBAF32(img, r, sub, p)
 	}
 }
 
@@ -102,6 +110,9 @@ func AlphaSet(img image.Image, alpha uint8) {
 			case color.Alpha16:
 				col.A = uint16(alpha)
 				c = col
+			case ColorRGBAF32:
+				r, g, b, _ := col.NRGBA()
+				c = NewColorRGBAF32(r, g, b, float32(alpha)/0xff)
 			}
 
 			imgDraw.Set(x, y, c)
@@ -1,38 +1,187 @@
 package imageutil
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"slices"
 
 	goico "github.com/ArtificialLegacy/go-ico"
+	"github.com/ericpauley/go-quantize/quantize"
 	"github.com/kolesa-team/go-webp/encoder"
 	"github.com/kolesa-team/go-webp/webp"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
 )
 
-func Encode(w io.WriteSeeker, img image.Image, encoding ImageEncoding) error {
+type GIFQuantizer int
+
+const (
+	// GIFQUANTIZER_PLAN9 uses the fixed 256 color plan9 palette,
+	// with fewer than 256 colors the median cut quantizer is used instead,
+	// as the gif encoder would only keep the first colors of the palette.
+	GIFQUANTIZER_PLAN9 GIFQuantizer = iota
+	GIFQUANTIZER_MEDIANCUT
+)
+
+var GIFQuantizerList = []GIFQuantizer{
+	GIFQUANTIZER_PLAN9,
+	GIFQUANTIZER_MEDIANCUT,
+}
+
+// PNGCompression indexes PNGCompressionList, as the png.CompressionLevel values are negative.
+type PNGCompression int
+
+const (
+	PNGCOMPRESSION_DEFAULT PNGCompression = iota
+	PNGCOMPRESSION_NONE
+	PNGCOMPRESSION_SPEED
+	PNGCOMPRESSION_BEST
+)
+
+var PNGCompressionList = []png.CompressionLevel{
+	PNGCOMPRESSION_DEFAULT: png.DefaultCompression,
+	PNGCOMPRESSION_NONE:    png.NoCompression,
+	PNGCOMPRESSION_SPEED:   png.BestSpeed,
+	PNGCOMPRESSION_BEST:    png.BestCompression,
+}
+
+// TIFFCompression indexes TIFFCompressionList,
+// the tiff encoder only supports writing uncompressed and deflate data.
+type TIFFCompression int
+
+const (
+	TIFFCOMPRESSION_NONE TIFFCompression = iota
+	TIFFCOMPRESSION_DEFLATE
+)
+
+var TIFFCompressionList = []tiff.CompressionType{
+	TIFFCOMPRESSION_NONE:    tiff.Uncompressed,
+	TIFFCOMPRESSION_DEFLATE: tiff.Deflate,
+}
+
+// EncodeOptions holds the per-encoding settings used by Encode,
+// options for encodings other than the one being used are ignored.
+type EncodeOptions struct {
+	JPEGQuality int
+
+	PNGCompression png.CompressionLevel
+
+	WebPLossy   bool
+	WebPQuality float32
+	WebPMethod  int
+
+	GIFColors    int
+	GIFQuantizer GIFQuantizer
+	GIFDither    bool
+
+	TIFFCompression tiff.CompressionType
+
+	TGARLE bool
+
+	DDSFormat DDSFormat
+
+	// EXRZip compresses each chunk of 16 scanlines with ZIP.
+	EXRZip bool
+
+	// Metadata is only written for JPEG, PNG and WebP, it is ignored for other encodings.
+	Metadata *Metadata
+}
+
+// DefaultEncodeOptions returns the options used when Encode is given nil.
+// They match the output of Encode before options were supported, except for JPEG and WebP.
+// JPEG used the zero jpeg.Options, which is clamped to a quality of 1, so it now uses jpeg.DefaultQuality.
+// WebP used the libwebp lossless preset, it is still lossless at quality 100 but with method 4 set directly.
+func DefaultEncodeOptions() *EncodeOptions {
+	return &EncodeOptions{
+		JPEGQuality: jpeg.DefaultQuality,
+
+		PNGCompression: png.DefaultCompression,
+
+		WebPLossy:   false,
+		WebPQuality: 100,
+		WebPMethod:  4,
+
+		GIFColors:    256,
+		GIFQuantizer: GIFQUANTIZER_PLAN9,
+		GIFDither:    true,
+
+		TIFFCompression: tiff.Uncompressed,
+
+		TGARLE: false,
+
+		DDSFormat: DDSFORMAT_RGBA,
+
+		EXRZip: false,
+	}
+}
+
+func (o *EncodeOptions) Validate() error {
+	if o.JPEGQuality < 1 || o.JPEGQuality > 100 {
+		return fmt.Errorf("jpeg quality must be between 1 and 100, got: %d", o.JPEGQuality)
+	}
+	if o.WebPQuality < 0 || o.WebPQuality > 100 {
+		return fmt.Errorf("webp quality must be between 0 and 100, got: %f", o.WebPQuality)
+	}
+	if o.WebPMethod < 0 || o.WebPMethod > 6 {
+		return fmt.Errorf("webp method must be between 0 and 6, got: %d", o.WebPMethod)
+	}
+	if !slices.Contains(PNGCompressionList, o.PNGCompression) {
+		return fmt.Errorf("unsupported png compression: %d", o.PNGCompression)
+	}
+	if o.GIFColors < 1 || o.GIFColors > 256 {
+		return fmt.Errorf("gif colors must be between 1 and 256, got: %d", o.GIFColors)
+	}
+
+	if o.TIFFCompression != tiff.Uncompressed && o.TIFFCompression != tiff.Deflate {
+		return fmt.Errorf("unsupported tiff compression: %d", o.TIFFCompression)
+	}
+	if o.DDSFormat < DDSFORMAT_RGBA || o.DDSFormat > DDSFORMAT_BC3 {
+		return fmt.Errorf("unsupported dds format: %d", o.DDSFormat)
+	}
+
+	return nil
+}
+
+// Encode writes img to w, when options is nil the defaults from DefaultEncodeOptions are used.
+func Encode(w io.WriteSeeker, img image.Image, encoding ImageEncoding, options *EncodeOptions) error {
+	if options == nil {
+		options = DefaultEncodeOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	if options.Metadata != nil {
+		switch encoding {
+		case ENCODING_JPEG, ENCODING_PNG, ENCODING_WEBP:
+			return encodeMetadata(w, img, encoding, options)
+		}
+	}
+
 	switch encoding {
 	case ENCODING_PNG:
-		return png.Encode(w, img)
+		enc := png.Encoder{CompressionLevel: options.PNGCompression}
+		return enc.Encode(w, img)
 	case ENCODING_JPEG:
-		return jpeg.Encode(w, img, &jpeg.Options{})
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: options.JPEGQuality})
 	case ENCODING_GIF:
-		return gif.Encode(w, img, &gif.Options{})
+		return gif.Encode(w, img, gifOptions(options))
 	case ENCODING_TIFF:
-		return tiff.Encode(w, img, &tiff.Options{})
+		return tiff.Encode(w, img, &tiff.Options{Compression: options.TIFFCompression})
 	case ENCODING_BMP:
 		return bmp.Encode(w, img)
 	case ENCODING_WEBP:
-		options, err := encoder.NewLosslessEncoderOptions(encoder.PresetDefault, 100)
+		opts, err := webpOptions(options)
 		if err != nil {
 			return err
 		}
-		return webp.Encode(w, img, options)
+		return webp.Encode(w, img, opts)
 	case ENCODING_ICO:
 		imgs := []image.Image{img}
 		ico, err := goico.NewICOConfig(imgs)
@@ -47,7 +196,79 @@ func Encode(w io.WriteSeeker, img image.Image, encoding ImageEncoding) error {
 			return err
 		}
 		return goico.Encode(w, ico, imgs)
+	case ENCODING_QOI:
+		return QOIEncode(w, img)
+	case ENCODING_PPM, ENCODING_PGM, ENCODING_PAM, ENCODING_PBM:
+		return PNMEncode(w, img, encoding)
+	case ENCODING_TGA:
+		return TGAEncode(w, img, options.TGARLE)
+	case ENCODING_DDS:
+		return DDSEncode(w, img, options.DDSFormat)
+	case ENCODING_HDR:
+		return HDREncode(w, img)
+	case ENCODING_EXR:
+		return EXREncode(w, img, options.EXRZip)
 	}
 
 	return fmt.Errorf("cannot encode unsupported encoding: %d", encoding)
 }
+
+// encodeMetadata encodes to a buffer first, as the metadata must be placed before the image data.
+func encodeMetadata(w io.Writer, img image.Image, encoding ImageEncoding, options *EncodeOptions) error {
+	buf := &bytes.Buffer{}
+	var err error
+
+	switch encoding {
+	case ENCODING_PNG:
+		enc := png.Encoder{CompressionLevel: options.PNGCompression}
+		err = enc.Encode(buf, img)
+	case ENCODING_JPEG:
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: options.JPEGQuality})
+	case ENCODING_WEBP:
+		var opts *encoder.Options
+		opts, err = webpOptions(options)
+		if err == nil {
+			err = webp.Encode(buf, img, opts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := metadataWrite(buf.Bytes(), encoding, options.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func gifOptions(options *EncodeOptions) *gif.Options {
+	opts := &gif.Options{
+		NumColors: options.GIFColors,
+		Drawer:    draw.FloydSteinberg,
+	}
+
+	if !options.GIFDither {
+		opts.Drawer = draw.Src
+	}
+
+	if options.GIFQuantizer == GIFQUANTIZER_MEDIANCUT || options.GIFColors < 256 {
+		opts.Quantizer = quantize.MedianCutQuantizer{}
+	}
+
+	return opts
+}
+
+// in lossless mode the quality controls the compression effort instead of the output quality.
+func webpOptions(options *EncodeOptions) (*encoder.Options, error) {
+	opts, err := encoder.NewLossyEncoderOptions(encoder.PresetDefault, options.WebPQuality)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Lossless = !options.WebPLossy
+	opts.Method = options.WebPMethod
+	return opts, nil
+}
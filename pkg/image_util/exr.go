@@ -0,0 +1,580 @@
+package imageutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+const exrMagic = "\x76\x2f\x31\x01"
+
+const (
+	exrVersion = 2
+
+	exrFlagTiled     = 0x200
+	exrFlagDeep      = 0x800
+	exrFlagMultipart = 0x1000
+)
+
+const (
+	exrCompressionNone = 0
+	exrCompressionZIPS = 2
+	exrCompressionZIP  = 3
+)
+
+const (
+	exrPixelUint  = 0
+	exrPixelHalf  = 1
+	exrPixelFloat = 2
+)
+
+// attribute values larger than this are rejected instead of allocated.
+const exrMaxAttributeSize = 1 << 24
+
+const exrMaxZipRatio = 1032
+
+type exrChannel struct {
+	name      string
+	pixelType int32
+	xSampling int32
+	ySampling int32
+}
+
+func (c exrChannel) size() int {
+	if c.pixelType == exrPixelHalf {
+		return 2
+	}
+	return 4
+}
+
+type exrHeader struct {
+	channels    []exrChannel
+	compression byte
+	dataWindow  image.Rectangle
+}
+
+// linesPerChunk is the number of scanlines compressed together.
+func (h *exrHeader) linesPerChunk() int {
+	if h.compression == exrCompressionZIP {
+		return 16
+	}
+	return 1
+}
+
+type exrReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func exrStringRead(r exrReader) (string, error) {
+	var s []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+		if b == 0 {
+			return string(s), nil
+		}
+		if len(s) >= 255 {
+			return "", fmt.Errorf("exr name is too long")
+		}
+		s = append(s, b)
+	}
+}
+
+func exrHeaderRead(r exrReader) (*exrHeader, error) {
+	start := make([]byte, 8)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(start[:4]) != exrMagic {
+		return nil, fmt.Errorf("invalid exr")
+	}
+
+	version := binary.LittleEndian.Uint32(start[4:])
+	if version&0xff != exrVersion {
+		return nil, fmt.Errorf("unsupported exr version: %d", version&0xff)
+	}
+	if version&(exrFlagTiled|exrFlagDeep|exrFlagMultipart) != 0 {
+		return nil, fmt.Errorf("only single part scanline exr images are supported")
+	}
+
+	h := &exrHeader{}
+	hasChannels, hasCompression, hasDataWindow := false, false, false
+
+	for {
+		name, err := exrStringRead(r)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+
+		typ, err := exrStringRead(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var sizeData [4]byte
+		if _, err := io.ReadFull(r, sizeData[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		size := binary.LittleEndian.Uint32(sizeData[:])
+		if size > exrMaxAttributeSize {
+			return nil, fmt.Errorf("exr attribute %s is too large", name)
+		}
+
+		value := make([]byte, size)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		switch {
+		case name == "channels" && typ == "chlist":
+			h.channels, err = exrChannelsParse(value)
+			if err != nil {
+				return nil, err
+			}
+			hasChannels = true
+		case name == "compression" && typ == "compression" && len(value) == 1:
+			h.compression = value[0]
+			hasCompression = true
+		case name == "dataWindow" && typ == "box2i" && len(value) == 16:
+			h.dataWindow = image.Rect(
+				int(int32(binary.LittleEndian.Uint32(value[0:]))),
+				int(int32(binary.LittleEndian.Uint32(value[4:]))),
+				int(int32(binary.LittleEndian.Uint32(value[8:])))+1,
+				int(int32(binary.LittleEndian.Uint32(value[12:])))+1,
+			)
+			hasDataWindow = true
+		}
+	}
+
+	if !hasChannels || !hasCompression || !hasDataWindow {
+		return nil, fmt.Errorf("exr header is missing a required attribute")
+	}
+
+	switch h.compression {
+	case exrCompressionNone, exrCompressionZIPS, exrCompressionZIP:
+	default:
+		return nil, fmt.Errorf("unsupported exr compression: %d", h.compression)
+	}
+
+	if h.dataWindow.Empty() {
+		return nil, fmt.Errorf("invalid exr data window: %s", h.dataWindow)
+	}
+	if err := decodeSizeCheck(h.dataWindow.Dx(), h.dataWindow.Dy(), 16); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func exrChannelsParse(data []byte) ([]exrChannel, error) {
+	r := bytes.NewReader(data)
+	channels := []exrChannel{}
+
+	for {
+		name, err := exrStringRead(r)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			return channels, nil
+		}
+
+		var info [16]byte
+		if _, err := io.ReadFull(r, info[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		c := exrChannel{
+			name:      name,
+			pixelType: int32(binary.LittleEndian.Uint32(info[0:])),
+			xSampling: int32(binary.LittleEndian.Uint32(info[8:])),
+			ySampling: int32(binary.LittleEndian.Uint32(info[12:])),
+		}
+		if c.pixelType < exrPixelUint || c.pixelType > exrPixelFloat {
+			return nil, fmt.Errorf("unsupported exr pixel type: %d", c.pixelType)
+		}
+		if c.xSampling != 1 || c.ySampling != 1 {
+			return nil, fmt.Errorf("subsampled exr channels are not supported")
+		}
+
+		channels = append(channels, c)
+	}
+}
+
+func EXRDecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := exrHeaderRead(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: ColorRGBAF32Model,
+		Width:      h.dataWindow.Dx(),
+		Height:     h.dataWindow.Dy(),
+	}, nil
+}
+
+// EXRDecode decodes a single part scanline OpenEXR image, with no compression or ZIP compression.
+// The R, G, B and A channels are used, or Y for grayscale images, other channels are ignored.
+// The data window is moved to start at 0,0.
+func EXRDecode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bytes.NewReader(data)
+	h, err := exrHeaderRead(br)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := h.dataWindow.Dx(), h.dataWindow.Dy()
+	lines := h.linesPerChunk()
+	chunks := (height + lines - 1) / lines
+
+	// each chunk has an 8 byte offset in the table, so a table that can't fit in the data is truncated.
+	if chunks > br.Len()/8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	offsets := make([]uint64, chunks)
+	if err := binary.Read(br, binary.LittleEndian, offsets); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	lineSize := 0
+	for _, c := range h.channels {
+		lineSize += c.size() * width
+	}
+
+	img := NewRGBAF32(image.Rect(0, 0, width, height))
+	// alpha defaults to opaque when there is no alpha channel.
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 1
+	}
+
+	for _, offset := range offsets {
+		if offset > uint64(len(data)) || uint64(len(data))-offset < 8 {
+			return nil, fmt.Errorf("invalid exr chunk offset: %d", offset)
+		}
+
+		y := int(int32(binary.LittleEndian.Uint32(data[offset:])))
+		size := uint64(binary.LittleEndian.Uint32(data[offset+4:]))
+		if size > uint64(len(data))-offset-8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunk := data[offset+8 : offset+8+size]
+
+		if y < h.dataWindow.Min.Y || y >= h.dataWindow.Max.Y || (y-h.dataWindow.Min.Y)%lines != 0 {
+			return nil, fmt.Errorf("invalid exr chunk line: %d", y)
+		}
+		count := min(lines, h.dataWindow.Max.Y-y)
+
+		raw, err := exrChunkDecompress(chunk, h.compression, count*lineSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for l := range count {
+			exrLineRead(img, h.channels, raw[l*lineSize:(l+1)*lineSize], y-h.dataWindow.Min.Y+l)
+		}
+	}
+
+	return img, nil
+}
+
+// exrChunkDecompress returns the raw chunk data,
+// chunks are stored uncompressed when compression would not make them smaller.
+func exrChunkDecompress(chunk []byte, compression byte, size int) ([]byte, error) {
+	if compression == exrCompressionNone || len(chunk) == size {
+		if len(chunk) != size {
+			return nil, fmt.Errorf("exr chunk size does not match the data window")
+		}
+		return chunk, nil
+	}
+
+	// deflate can't expand data more than about 1032 times, so larger sizes can't be valid and are not allocated.
+	if size/exrMaxZipRatio > len(chunk) {
+		return nil, fmt.Errorf("exr chunk size does not match the data window")
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	tmp := make([]byte, size)
+	if _, err := io.ReadFull(zr, tmp); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	// undo the byte delta predictor.
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = tmp[i-1] + tmp[i] - 128
+	}
+
+	// the even and odd bytes are stored in separate halves.
+	raw := make([]byte, size)
+	half := (size + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			raw[i] = tmp[i/2]
+		} else {
+			raw[i] = tmp[half+i/2]
+		}
+	}
+
+	return raw, nil
+}
+
+// exrLineRead stores a scanline, where each channel is stored in full one after the other.
+func exrLineRead(img *RGBAF32, channels []exrChannel, line []byte, y int) {
+	width := img.Rect.Dx()
+	row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+
+	for _, c := range channels {
+		size := c.size()
+		data := line[:width*size]
+		line = line[width*size:]
+
+		var targets []int
+		switch c.name {
+		case "R":
+			targets = []int{0}
+		case "G":
+			targets = []int{1}
+		case "B":
+			targets = []int{2}
+		case "A":
+			targets = []int{3}
+		case "Y":
+			targets = []int{0, 1, 2}
+		default:
+			continue
+		}
+
+		for x := range width {
+			var v float32
+			switch c.pixelType {
+			case exrPixelUint:
+				v = float32(binary.LittleEndian.Uint32(data[x*4:]))
+			case exrPixelHalf:
+				v = halfToFloat32(binary.LittleEndian.Uint16(data[x*2:]))
+			case exrPixelFloat:
+				v = math.Float32frombits(binary.LittleEndian.Uint32(data[x*4:]))
+			}
+
+			for _, t := range targets {
+				row[x*4+t] = v
+			}
+		}
+	}
+}
+
+// halfToFloat32 converts an IEEE 754 half precision float.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// subnormal halfs are normal as a float32.
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		exp++
+		mant &= 0x3ff
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// EXREncode writes a scanline OpenEXR image with float A, B, G and R channels in linear light.
+// When zip is true each chunk of 16 scanlines is ZIP compressed.
+func EXREncode(w io.Writer, img image.Image, zip bool) error {
+	src := rgbaf32Image(img)
+	b := src.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("cannot encode an empty exr")
+	}
+
+	h := &exrHeader{
+		channels: []exrChannel{
+			{name: "A", pixelType: exrPixelFloat, xSampling: 1, ySampling: 1},
+			{name: "B", pixelType: exrPixelFloat, xSampling: 1, ySampling: 1},
+			{name: "G", pixelType: exrPixelFloat, xSampling: 1, ySampling: 1},
+			{name: "R", pixelType: exrPixelFloat, xSampling: 1, ySampling: 1},
+		},
+		compression: exrCompressionNone,
+		dataWindow:  image.Rect(0, 0, b.Dx(), b.Dy()),
+	}
+	if zip {
+		h.compression = exrCompressionZIP
+	}
+
+	header := exrHeaderWrite(h)
+	lines := h.linesPerChunk()
+	chunks := (b.Dy() + lines - 1) / lines
+
+	data := make([][]byte, chunks)
+	for i := range chunks {
+		y := i * lines
+		count := min(lines, b.Dy()-y)
+
+		raw := make([]byte, 0, count*b.Dx()*16)
+		for l := range count {
+			raw = exrLineWrite(raw, src, b.Min.Y+y+l)
+		}
+
+		chunk, err := exrChunkCompress(raw, h.compression)
+		if err != nil {
+			return err
+		}
+
+		data[i] = binary.LittleEndian.AppendUint32(nil, uint32(y))
+		data[i] = binary.LittleEndian.AppendUint32(data[i], uint32(len(chunk)))
+		data[i] = append(data[i], chunk...)
+	}
+
+	offset := uint64(len(header) + chunks*8)
+	table := make([]byte, 0, chunks*8)
+	for _, d := range data {
+		table = binary.LittleEndian.AppendUint64(table, offset)
+		offset += uint64(len(d))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(table); err != nil {
+		return err
+	}
+	for _, d := range data {
+		if _, err := w.Write(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exrHeaderWrite(h *exrHeader) []byte {
+	buf := []byte(exrMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, exrVersion)
+
+	attribute := func(name, typ string, value []byte) {
+		buf = append(buf, name...)
+		buf = append(buf, 0)
+		buf = append(buf, typ...)
+		buf = append(buf, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(value)))
+		buf = append(buf, value...)
+	}
+
+	box := func(r image.Rectangle) []byte {
+		v := binary.LittleEndian.AppendUint32(nil, uint32(r.Min.X))
+		v = binary.LittleEndian.AppendUint32(v, uint32(r.Min.Y))
+		v = binary.LittleEndian.AppendUint32(v, uint32(r.Max.X-1))
+		return binary.LittleEndian.AppendUint32(v, uint32(r.Max.Y-1))
+	}
+
+	channels := append([]exrChannel{}, h.channels...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+
+	chlist := []byte{}
+	for _, c := range channels {
+		chlist = append(chlist, c.name...)
+		chlist = append(chlist, 0)
+		chlist = binary.LittleEndian.AppendUint32(chlist, uint32(c.pixelType))
+		chlist = append(chlist, 0, 0, 0, 0)
+		chlist = binary.LittleEndian.AppendUint32(chlist, uint32(c.xSampling))
+		chlist = binary.LittleEndian.AppendUint32(chlist, uint32(c.ySampling))
+	}
+	chlist = append(chlist, 0)
+
+	one := binary.LittleEndian.AppendUint32(nil, math.Float32bits(1))
+
+	attribute("channels", "chlist", chlist)
+	attribute("compression", "compression", []byte{h.compression})
+	attribute("dataWindow", "box2i", box(h.dataWindow))
+	attribute("displayWindow", "box2i", box(h.dataWindow))
+	attribute("lineOrder", "lineOrder", []byte{0})
+	attribute("pixelAspectRatio", "float", one)
+	attribute("screenWindowCenter", "v2f", make([]byte, 8))
+	attribute("screenWindowWidth", "float", one)
+
+	return append(buf, 0)
+}
+
+// exrLineWrite appends the A, B, G and R channels of a scanline.
+func exrLineWrite(buf []byte, img *RGBAF32, y int) []byte {
+	b := img.Bounds()
+
+	for _, c := range []int{3, 2, 1, 0} {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := img.Pix[img.PixOffset(x, y)+c]
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		}
+	}
+
+	return buf
+}
+
+func exrChunkCompress(raw []byte, compression byte) ([]byte, error) {
+	if compression == exrCompressionNone {
+		return raw, nil
+	}
+
+	half := (len(raw) + 1) / 2
+	tmp := make([]byte, len(raw))
+	for i, v := range raw {
+		if i%2 == 0 {
+			tmp[i/2] = v
+		} else {
+			tmp[half+i/2] = v
+		}
+	}
+
+	prev := tmp[0]
+	for i := 1; i < len(tmp); i++ {
+		v := tmp[i]
+		tmp[i] = v - prev + 128
+		prev = v
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(tmp); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	// readers treat a chunk the size of the raw data as uncompressed.
+	if buf.Len() >= len(raw) {
+		return raw, nil
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,255 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+)
+
+// SRGBToLinear decodes an srgb value between 0 and 1 into linear light.
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB encodes linear light between 0 and 1 into srgb.
+func LinearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+var (
+	srgbTableOnce sync.Once
+	// srgb16Linear maps a 16 bit srgb value to linear light.
+	srgb16Linear []float32
+	// linear16SRGB maps linear light quantized to 16 bits to a 16 bit srgb value.
+	linear16SRGB []uint16
+)
+
+func srgbTables() {
+	srgbTableOnce.Do(func() {
+		srgb16Linear = make([]float32, 0x10000)
+		linear16SRGB = make([]uint16, 0x10000)
+
+		for i := range 0x10000 {
+			v := float64(i) / 0xffff
+			srgb16Linear[i] = float32(SRGBToLinear(v))
+			linear16SRGB[i] = uint16(math.Round(LinearToSRGB(v) * 0xffff))
+		}
+	})
+}
+
+// ColorRGBAF32 is an alpha-premultiplied color in linear light.
+// The color channels can be greater than 1 for high dynamic range light.
+type ColorRGBAF32 struct {
+	R, G, B, A float32
+}
+
+// RGBA encodes the color as srgb, clamping it between 0 and 1.
+func (c ColorRGBAF32) RGBA() (r, g, b, a uint32) {
+	alpha := clampF32(c.A)
+	if alpha == 0 {
+		return 0, 0, 0, 0
+	}
+
+	srgbTables()
+	encode := func(v float32) uint32 {
+		linear := clampF32(v / c.A)
+		s := linear16SRGB[uint16(linear*0xffff+0.5)]
+		return uint32(float32(s)*alpha + 0.5)
+	}
+
+	return encode(c.R), encode(c.G), encode(c.B), uint32(alpha*0xffff + 0.5)
+}
+
+// NRGBA returns the color without alpha premultiplication, still in linear light.
+func (c ColorRGBAF32) NRGBA() (r, g, b, a float32) {
+	if c.A <= 0 {
+		return 0, 0, 0, 0
+	}
+	return c.R / c.A, c.G / c.A, c.B / c.A, c.A
+}
+
+// NewColorRGBAF32 premultiplies a linear light color.
+func NewColorRGBAF32(r, g, b, a float32) ColorRGBAF32 {
+	return ColorRGBAF32{R: r * a, G: g * a, B: b * a, A: a}
+}
+
+// clampF32 clamps v between 0 and 1, NaN becomes 0.
+func clampF32(v float32) float32 {
+	if !(v > 0) {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// rgbaf32FromRGBA64 decodes an alpha-premultiplied 16 bit srgb color into linear light.
+func rgbaf32FromRGBA64(r, g, b, a uint32) ColorRGBAF32 {
+	if a == 0 {
+		return ColorRGBAF32{}
+	}
+
+	srgbTables()
+	alpha := float32(a) / 0xffff
+	decode := func(v uint32) float32 {
+		return srgb16Linear[min(v*0xffff/a, 0xffff)] * alpha
+	}
+
+	return ColorRGBAF32{R: decode(r), G: decode(g), B: decode(b), A: alpha}
+}
+
+var ColorRGBAF32Model = color.ModelFunc(func(c color.Color) color.Color {
+	if _, ok := c.(ColorRGBAF32); ok {
+		return c
+	}
+	return rgbaf32FromRGBA64(c.RGBA())
+})
+
+// RGBAF32 is an in-memory image of alpha-premultiplied, linear light float32 colors.
+// Values are not clamped, so it can hold high dynamic range light and avoids rounding when chaining operations.
+// When read as a color.Color it is encoded as 16 bit srgb and clamped between 0 and 1.
+type RGBAF32 struct {
+	// Pix holds the R, G, B, A channels of each pixel, each row starts Stride values after the previous.
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+// NewRGBAF32 panics like image.NewRGBA when the size is negative or overflows, decoders check the size before calling it.
+func NewRGBAF32(r image.Rectangle) *RGBAF32 {
+	w, h := r.Dx(), r.Dy()
+	if w < 0 || h < 0 || (w > 0 && h > math.MaxInt/4/w) {
+		panic("imageutil: NewRGBAF32 Rectangle has huge or negative dimensions")
+	}
+
+	return &RGBAF32{
+		Pix:    make([]float32, 4*w*h),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *RGBAF32) ColorModel() color.Model {
+	return ColorRGBAF32Model
+}
+
+func (p *RGBAF32) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *RGBAF32) At(x, y int) color.Color {
+	return p.RGBAF32At(x, y)
+}
+
+func (p *RGBAF32) RGBA64At(x, y int) color.RGBA64 {
+	r, g, b, a := p.RGBAF32At(x, y).RGBA()
+	return color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: uint16(a)}
+}
+
+func (p *RGBAF32) RGBAF32At(x, y int) ColorRGBAF32 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return ColorRGBAF32{}
+	}
+
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	return ColorRGBAF32{R: s[0], G: s[1], B: s[2], A: s[3]}
+}
+
+// PixOffset returns the index of the first channel of the pixel at (x, y).
+func (p *RGBAF32) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *RGBAF32) Set(x, y int, c color.Color) {
+	p.SetRGBAF32(x, y, ColorRGBAF32Model.Convert(c).(ColorRGBAF32))
+}
+
+func (p *RGBAF32) SetRGBA64(x, y int, c color.RGBA64) {
+	p.SetRGBAF32(x, y, rgbaf32FromRGBA64(uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)))
+}
+
+func (p *RGBAF32) SetRGBAF32(x, y int, c ColorRGBAF32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = c.R, c.G, c.B, c.A
+}
+
+// SubImage shares pixels with the original image.
+func (p *RGBAF32) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &RGBAF32{}
+	}
+
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &RGBAF32{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+func (p *RGBAF32) Opaque() bool {
+	if p.Rect.Empty() {
+		return true
+	}
+
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		i := p.PixOffset(p.Rect.Min.X, y)
+		for x := 0; x < p.Rect.Dx(); x++ {
+			if p.Pix[i+x*4+3] < 1 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// drawRGBAF32 draws src over r in dst, copying the values directly when src is also float,
+// so values outside 0 to 1 are kept.
+func drawRGBAF32(dst *RGBAF32, r image.Rectangle, src image.Image, sp image.Point) {
+	orig := r.Min
+	r = r.Intersect(dst.Rect).Intersect(src.Bounds().Add(orig.Sub(sp)))
+	if r.Empty() {
+		return
+	}
+	sp = sp.Add(r.Min.Sub(orig))
+
+	if s, ok := src.(*RGBAF32); ok {
+		for y := range r.Dy() {
+			di := dst.PixOffset(r.Min.X, r.Min.Y+y)
+			si := s.PixOffset(sp.X, sp.Y+y)
+			copy(dst.Pix[di:di+r.Dx()*4], s.Pix[si:si+r.Dx()*4])
+		}
+		return
+	}
+
+	for y := range r.Dy() {
+		for x := range r.Dx() {
+			dst.SetRGBAF32(r.Min.X+x, r.Min.Y+y, rgbaf32FromRGBA64(src.At(sp.X+x, sp.Y+y).RGBA()))
+		}
+	}
+}
+
+// rgbaf32Image returns img as float, only copying it when needed.
+func rgbaf32Image(img image.Image) *RGBAF32 {
+	if f, ok := img.(*RGBAF32); ok {
+		return f
+	}
+
+	return CopyImage(img, MODEL_RGBAF32).(*RGBAF32)
+}
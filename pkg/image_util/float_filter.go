@@ -0,0 +1,116 @@
+package imageutil
+
+import (
+	"image"
+	"math"
+)
+
+// FilterF32Func adjusts an unpremultiplied color in linear light.
+// Values are not clamped, so light above 1 is kept between filters.
+type FilterF32Func func(r, g, b float32) (float32, float32, float32)
+
+// FilterF32 applies the filters in order to each pixel of img, returning a new float image.
+func FilterF32(img image.Image, filters ...FilterF32Func) *RGBAF32 {
+	src := rgbaf32Image(img)
+	b := src.Bounds()
+	dst := NewRGBAF32(image.Rect(0, 0, b.Dx(), b.Dy()))
+
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			r, g, bl, a := src.RGBAF32At(b.Min.X+x, b.Min.Y+y).NRGBA()
+			for _, fn := range filters {
+				r, g, bl = fn(r, g, bl)
+			}
+			dst.SetRGBAF32(x, y, NewColorRGBAF32(r, g, bl, a))
+		}
+	}
+
+	return dst
+}
+
+// filterF32SRGB runs fn on srgb encoded values, matching the filters for 8 and 16 bit images.
+// The srgb curve is extended past 1 instead of clamping.
+func filterF32SRGB(fn func(r, g, b float64) (float64, float64, float64)) FilterF32Func {
+	return func(r, g, b float32) (float32, float32, float32) {
+		sr, sg, sb := fn(LinearToSRGB(float64(r)), LinearToSRGB(float64(g)), LinearToSRGB(float64(b)))
+		return float32(SRGBToLinear(sr)), float32(SRGBToLinear(sg)), float32(SRGBToLinear(sb))
+	}
+}
+
+// filterF32Channel runs the same fn on each srgb encoded channel.
+func filterF32Channel(fn func(v float64) float64) FilterF32Func {
+	return filterF32SRGB(func(r, g, b float64) (float64, float64, float64) {
+		return fn(r), fn(g), fn(b)
+	})
+}
+
+// FilterF32Brightness shifts each channel by the percent, between -100 and 100.
+func FilterF32Brightness(percent float64) FilterF32Func {
+	shift := min(max(percent, -100), 100) / 100
+
+	return filterF32Channel(func(v float64) float64 {
+		return v + shift
+	})
+}
+
+// FilterF32Contrast scales each channel away from or towards the midpoint by the percent, between -100 and 100.
+func FilterF32Contrast(percent float64) FilterF32Func {
+	p := 1 + min(max(percent, -100), 100)/100
+
+	return filterF32Channel(func(v float64) float64 {
+		switch {
+		case p <= 1:
+			return 0.5 + (v-0.5)*p
+		case p < 2:
+			return 0.5 + (v-0.5)/(2-p)
+		case v < 0.5:
+			return 0
+		}
+		return 1
+	})
+}
+
+// FilterF32Gamma raises each channel to 1/gamma, a gamma of 1 keeps the image.
+func FilterF32Gamma(gamma float64) FilterF32Func {
+	e := 1 / max(gamma, 1e-5)
+
+	return filterF32Channel(func(v float64) float64 {
+		return math.Pow(max(v, 0), e)
+	})
+}
+
+// FilterF32Exposure scales the light by 2^stops, in linear light.
+func FilterF32Exposure(stops float64) FilterF32Func {
+	s := float32(math.Exp2(stops))
+
+	return func(r, g, b float32) (float32, float32, float32) {
+		return r * s, g * s, b * s
+	}
+}
+
+// FilterF32Hue rotates the colors around the gray axis by the shift in degrees.
+// HSL is undefined for values above 1, so this is a rotation of the rgb cube instead,
+// it keeps the brightness of grays and moves red towards green for positive shifts.
+func FilterF32Hue(shift float64) FilterF32Func {
+	rad := shift * math.Pi / 180
+	c, s := math.Cos(rad), math.Sin(rad)
+
+	d := c + (1-c)/3
+	p := (1-c)/3 + math.Sqrt(1.0/3)*s
+	n := (1-c)/3 - math.Sqrt(1.0/3)*s
+
+	return filterF32SRGB(func(r, g, b float64) (float64, float64, float64) {
+		return r*d + g*n + b*p, r*p + g*d + b*n, r*n + g*p + b*d
+	})
+}
+
+// FilterF32Saturation scales the distance of each channel from the luma by the percent, between -100 and 500.
+// HSL is undefined for values above 1, so the luma is used as the gray point instead.
+func FilterF32Saturation(percent float64) FilterF32Func {
+	p := 1 + min(max(percent, -100), 500)/100
+
+	return filterF32SRGB(func(r, g, b float64) (float64, float64, float64) {
+		l := 0.2126*r + 0.7152*g + 0.0722*b
+		return l + (r-l)*p, l + (g-l)*p, l + (b-l)*p
+	})
+}
@@ -0,0 +1,284 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+// HashType is a perceptual hash algorithm, all of them produce 64 bit hashes.
+type HashType int
+
+const (
+	// HASH_PERCEPTUAL takes the low frequencies of a 32x32 DCT, it is the most robust to edits.
+	HASH_PERCEPTUAL HashType = iota
+	// HASH_AVERAGE compares each pixel of an 8x8 thumbnail to the mean.
+	HASH_AVERAGE
+	// HASH_DIFFERENCE compares neighbouring pixels of a 9x8 thumbnail.
+	HASH_DIFFERENCE
+	// HASH_WAVELET takes the low frequencies of a haar wavelet transform.
+	HASH_WAVELET
+)
+
+var HashList = []HashType{
+	HASH_PERCEPTUAL,
+	HASH_AVERAGE,
+	HASH_DIFFERENCE,
+	HASH_WAVELET,
+}
+
+// ImageHash computes a perceptual hash of the image,
+// transparent pixels are composited over white.
+func ImageHash(img image.Image, hash HashType) uint64 {
+	switch hash {
+	case HASH_AVERAGE:
+		gray := hashGray(img, 8, 8)
+		return hashBits(gray, hashMean(gray))
+	case HASH_DIFFERENCE:
+		gray := hashGray(img, 9, 8)
+
+		var h uint64
+		for y := range 8 {
+			for x := range 8 {
+				h <<= 1
+				if gray[y*9+x] < gray[y*9+x+1] {
+					h |= 1
+				}
+			}
+		}
+		return h
+	case HASH_WAVELET:
+		return hashWavelet(img)
+	}
+
+	return hashPerceptual(img)
+}
+
+// HashDistance is the hamming distance between two hashes,
+// the number of bits that differ.
+func HashDistance(h1, h2 uint64) int {
+	return bits.OnesCount64(h1 ^ h2)
+}
+
+// HashString formats the hash as 16 hex digits.
+func HashString(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+// HashParse parses a hash created by HashString.
+func HashParse(s string) (uint64, error) {
+	h, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash: %s", s)
+	}
+
+	return h, nil
+}
+
+// HashGroup groups the indexes of hashes that are within the threshold distance of each other.
+// Groups are linked, so two hashes further apart than the threshold can share a group through a third.
+// Only groups with more than one hash are returned, ordered by their first index.
+func HashGroup(hashes []uint64, threshold int) [][]int {
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if HashDistance(hashes[i], hashes[j]) > threshold {
+				continue
+			}
+
+			ri, rj := find(i), find(j)
+			if ri != rj {
+				parent[max(ri, rj)] = min(ri, rj)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	roots := []int{}
+	for i := range hashes {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	result := [][]int{}
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			result = append(result, groups[root])
+		}
+	}
+
+	return result
+}
+
+// hashGray scales the image down to width by height using area averaging,
+// returning the luma of each pixel between 0 and 1.
+func hashGray(img image.Image, width, height int) []float64 {
+	src := imageNRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	gray := make([]float64, width*height)
+	if sw == 0 || sh == 0 {
+		return gray
+	}
+
+	weights := make([]float64, width*height)
+
+	for y := range sh {
+		// the range of output rows covered by this source row.
+		y0 := float64(y) * float64(height) / float64(sh)
+		y1 := float64(y+1) * float64(height) / float64(sh)
+
+		for x := range sw {
+			x0 := float64(x) * float64(width) / float64(sw)
+			x1 := float64(x+1) * float64(width) / float64(sw)
+
+			i := y*src.Stride + x*4
+			a := float64(src.Pix[i+3]) / 255
+			luma := (0.299*float64(src.Pix[i]) + 0.587*float64(src.Pix[i+1]) + 0.114*float64(src.Pix[i+2])) / 255
+			luma = luma*a + 1 - a
+
+			for oy := int(y0); oy < height && float64(oy) < y1; oy++ {
+				wy := math.Min(y1, float64(oy+1)) - math.Max(y0, float64(oy))
+				for ox := int(x0); ox < width && float64(ox) < x1; ox++ {
+					w := wy * (math.Min(x1, float64(ox+1)) - math.Max(x0, float64(ox)))
+					gray[oy*width+ox] += luma * w
+					weights[oy*width+ox] += w
+				}
+			}
+		}
+	}
+
+	for i, w := range weights {
+		if w > 0 {
+			gray[i] /= w
+		}
+	}
+
+	return gray
+}
+
+func hashMean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+func hashMedian(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// hashBits sets a bit for each of the 64 values above the cutoff.
+func hashBits(values []float64, cutoff float64) uint64 {
+	var h uint64
+	for _, v := range values[:64] {
+		h <<= 1
+		if v > cutoff {
+			h |= 1
+		}
+	}
+
+	return h
+}
+
+func hashPerceptual(img image.Image) uint64 {
+	const size = 32
+
+	gray := hashGray(img, size, size)
+
+	// only the top left 8x8 of the dct is needed.
+	cos := make([]float64, 8*size)
+	for k := range 8 {
+		for n := range size {
+			cos[k*size+n] = math.Cos(math.Pi / size * (float64(n) + 0.5) * float64(k))
+		}
+	}
+
+	rows := make([]float64, size*8)
+	for y := range size {
+		for k := range 8 {
+			v := 0.0
+			for x := range size {
+				v += gray[y*size+x] * cos[k*size+x]
+			}
+			rows[y*8+k] = v
+		}
+	}
+
+	dct := make([]float64, 64)
+	for ky := range 8 {
+		for kx := range 8 {
+			v := 0.0
+			for y := range size {
+				v += rows[y*8+kx] * cos[ky*size+y]
+			}
+			dct[ky*8+kx] = v
+		}
+	}
+
+	return hashBits(dct, hashMedian(dct))
+}
+
+// hashWavelet follows the common haar wavelet hash,
+// the lowest frequency is removed before taking the 8x8 approximation.
+func hashWavelet(img image.Image) uint64 {
+	const size = 64
+
+	gray := hashGray(img, size, size)
+
+	// a full haar decomposition with the final approximation set to 0 and reconstructed
+	// is the same as removing the mean.
+	mean := hashMean(gray)
+	for i := range gray {
+		gray[i] -= mean
+	}
+
+	for n := size; n > 8; n /= 2 {
+		gray = hashHaar(gray, n)
+	}
+
+	return hashBits(gray, hashMedian(gray))
+}
+
+// hashHaar applies one level of the 2D haar transform to an n by n image,
+// returning only the n/2 by n/2 approximation.
+func hashHaar(values []float64, n int) []float64 {
+	half := n / 2
+	out := make([]float64, half*half)
+
+	for y := range half {
+		for x := range half {
+			i := y*2*n + x*2
+			out[y*half+x] = (values[i] + values[i+1] + values[i+n] + values[i+n+1]) / 2
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,308 @@
+package imageutil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	hdrMagicRadiance = "#?RADIANCE"
+	hdrMagicRGBE     = "#?RGBE"
+	hdrFormat        = "32-bit_rle_rgbe"
+
+	// scanlines outside of this width can't use the run length encoding.
+	hdrRLEMinWidth = 8
+	hdrRLEMaxWidth = 0x7fff
+)
+
+// hdrHeaderRead reads the header up to and including the resolution line.
+func hdrHeaderRead(r *bufio.Reader) (image.Config, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return image.Config{}, unexpectedEOF(err)
+	}
+	if !strings.HasPrefix(line, hdrMagicRadiance) && !strings.HasPrefix(line, hdrMagicRGBE) {
+		return image.Config{}, fmt.Errorf("invalid hdr")
+	}
+
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return image.Config{}, unexpectedEOF(err)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != hdrFormat {
+			return image.Config{}, fmt.Errorf("unsupported hdr format: %s", format)
+		}
+	}
+
+	line, err = r.ReadString('\n')
+	if err != nil {
+		return image.Config{}, unexpectedEOF(err)
+	}
+
+	var width, height int
+	if _, err := fmt.Sscanf(line, "-Y %d +X %d", &height, &width); err != nil {
+		return image.Config{}, fmt.Errorf("unsupported hdr orientation: %s", strings.TrimSpace(line))
+	}
+	// 16 bytes per pixel for the float32 image.
+	if err := decodeSizeCheck(width, height, 16); err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: ColorRGBAF32Model,
+		Width:      width,
+		Height:     height,
+	}, nil
+}
+
+func HDRDecodeConfig(r io.Reader) (image.Config, error) {
+	return hdrHeaderRead(bufio.NewReader(r))
+}
+
+// HDRDecode decodes a Radiance RGBE image into linear light, only the standard -Y +X orientation is supported.
+func HDRDecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	cfg, err := hdrHeaderRead(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := NewRGBAF32(image.Rect(0, 0, cfg.Width, cfg.Height))
+	scanline := make([]byte, cfg.Width*4)
+
+	for y := range cfg.Height {
+		if err := hdrScanlineRead(br, scanline); err != nil {
+			return nil, err
+		}
+
+		row := img.Pix[y*img.Stride : y*img.Stride+cfg.Width*4]
+		for x := range cfg.Width {
+			rgbe := scanline[x*4 : x*4+4]
+			if rgbe[3] == 0 {
+				row[x*4+3] = 1
+				continue
+			}
+
+			f := float32(math.Ldexp(1, int(rgbe[3])-(128+8)))
+			row[x*4] = (float32(rgbe[0]) + 0.5) * f
+			row[x*4+1] = (float32(rgbe[1]) + 0.5) * f
+			row[x*4+2] = (float32(rgbe[2]) + 0.5) * f
+			row[x*4+3] = 1
+		}
+	}
+
+	return img, nil
+}
+
+// hdrScanlineRead reads a scanline of rgbe pixels, handling both the per channel and the older run length encodings.
+func hdrScanlineRead(r *bufio.Reader, scanline []byte) error {
+	width := len(scanline) / 4
+
+	if width < hdrRLEMinWidth || width > hdrRLEMaxWidth {
+		return hdrFlatRead(r, scanline, 0)
+	}
+
+	if _, err := io.ReadFull(r, scanline[:4]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if scanline[0] != 2 || scanline[1] != 2 || scanline[2]&0x80 != 0 {
+		return hdrFlatRead(r, scanline, 1)
+	}
+	if int(scanline[2])<<8|int(scanline[3]) != width {
+		return fmt.Errorf("hdr scanline width does not match image width")
+	}
+
+	for c := range 4 {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+
+			if count > 128 {
+				n := int(count) - 128
+				if x+n > width {
+					return fmt.Errorf("hdr run overflows scanline")
+				}
+				v, err := r.ReadByte()
+				if err != nil {
+					return unexpectedEOF(err)
+				}
+				for range n {
+					scanline[x*4+c] = v
+					x++
+				}
+			} else {
+				n := int(count)
+				if n == 0 || x+n > width {
+					return fmt.Errorf("invalid hdr literal run")
+				}
+				for range n {
+					v, err := r.ReadByte()
+					if err != nil {
+						return unexpectedEOF(err)
+					}
+					scanline[x*4+c] = v
+					x++
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// hdrFlatRead reads uncompressed pixels, the first read pixels are already in the scanline.
+// A pixel of 1, 1, 1 repeats the previous pixel, using the exponent as the count.
+func hdrFlatRead(r *bufio.Reader, scanline []byte, read int) error {
+	width := len(scanline) / 4
+	shift := 0
+
+	for x := 0; x < width; {
+		px := scanline[x*4 : x*4+4]
+		if x >= read {
+			if _, err := io.ReadFull(r, px); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+
+		if px[0] == 1 && px[1] == 1 && px[2] == 1 {
+			if x == 0 {
+				return fmt.Errorf("hdr run has no previous pixel")
+			}
+
+			n := int(px[3]) << shift
+			if x+n > width {
+				return fmt.Errorf("hdr run overflows scanline")
+			}
+
+			prev := scanline[(x-1)*4 : x*4]
+			for range n {
+				copy(scanline[x*4:x*4+4], prev)
+				x++
+			}
+
+			shift += 8
+			continue
+		}
+
+		shift = 0
+		x++
+	}
+
+	return nil
+}
+
+// HDREncode writes a Radiance RGBE image from linear light, the alpha channel is discarded by compositing over black.
+func HDREncode(w io.Writer, img image.Image) error {
+	src := rgbaf32Image(img)
+	b := src.Bounds()
+
+	bw := bufio.NewWriter(w)
+	_, err := fmt.Fprintf(bw, "%s\nFORMAT=%s\n\n-Y %d +X %d\n", hdrMagicRadiance, hdrFormat, b.Dy(), b.Dx())
+	if err != nil {
+		return err
+	}
+
+	rle := b.Dx() >= hdrRLEMinWidth && b.Dx() <= hdrRLEMaxWidth
+	scanline := make([]byte, b.Dx()*4)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := src.RGBAF32At(x, y)
+			i := (x - b.Min.X) * 4
+			scanline[i], scanline[i+1], scanline[i+2], scanline[i+3] = hdrRGBE(c.R, c.G, c.B)
+		}
+
+		if rle {
+			err = hdrScanlineWrite(bw, scanline)
+		} else {
+			_, err = bw.Write(scanline)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// hdrRGBE shares the exponent of the brightest channel, negative values are written as 0.
+func hdrRGBE(r, g, b float32) (byte, byte, byte, byte) {
+	r, g, b = max(r, 0), max(g, 0), max(b, 0)
+	v := float64(max(r, g, b))
+	if !(v >= 1e-32) {
+		return 0, 0, 0, 0
+	}
+	if math.IsInf(v, 1) {
+		return 255, 255, 255, 255
+	}
+
+	frac, exp := math.Frexp(v)
+	if exp+128 > 255 {
+		return 255, 255, 255, 255
+	}
+
+	scale := frac * 256 / v
+	return byte(float64(r) * scale), byte(float64(g) * scale), byte(float64(b) * scale), byte(exp + 128)
+}
+
+// hdrScanlineWrite run length encodes each channel separately.
+func hdrScanlineWrite(w *bufio.Writer, scanline []byte) error {
+	width := len(scanline) / 4
+	if _, err := w.Write([]byte{2, 2, byte(width >> 8), byte(width)}); err != nil {
+		return err
+	}
+
+	channel := make([]byte, width)
+	for c := range 4 {
+		for x := range width {
+			channel[x] = scanline[x*4+c]
+		}
+
+		for x := 0; x < width; {
+			run := 1
+			for x+run < width && run < 127 && channel[x+run] == channel[x] {
+				run++
+			}
+
+			// short runs are cheaper as part of a literal.
+			if run >= 4 {
+				if _, err := w.Write([]byte{byte(128 + run), channel[x]}); err != nil {
+					return err
+				}
+				x += run
+				continue
+			}
+
+			start := x
+			for x < width && x-start < 128 {
+				if x+3 < width && channel[x] == channel[x+1] && channel[x] == channel[x+2] && channel[x] == channel[x+3] {
+					break
+				}
+				x++
+			}
+
+			if err := w.WriteByte(byte(x - start)); err != nil {
+				return err
+			}
+			if _, err := w.Write(channel[start:x]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
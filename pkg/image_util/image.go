@@ -20,6 +20,17 @@ const (
 	ENCODING_CUR
 	ENCODING_WEBP
 	ENCODING_UNKNOWN
+	// ENCODING_AUTO detects the encoding from the data when decoding.
+	ENCODING_AUTO
+	ENCODING_QOI
+	ENCODING_PPM
+	ENCODING_PGM
+	ENCODING_PAM
+	ENCODING_TGA
+	ENCODING_DDS
+	ENCODING_HDR
+	ENCODING_EXR
+	ENCODING_PBM
 )
 
 var EncodingExts = []string{
@@ -32,6 +43,16 @@ var EncodingExts = []string{
 	".ico",
 	".cur",
 	".webp",
+	".qoi",
+	".ppm",
+	".pgm",
+	".pbm",
+	".pnm",
+	".pam",
+	".tga",
+	".dds",
+	".hdr",
+	".exr",
 }
 
 var EncodingList = []ImageEncoding{
@@ -44,6 +65,16 @@ var EncodingList = []ImageEncoding{
 	ENCODING_CUR,
 	ENCODING_WEBP,
 	ENCODING_UNKNOWN,
+	ENCODING_AUTO,
+	ENCODING_QOI,
+	ENCODING_PPM,
+	ENCODING_PGM,
+	ENCODING_PAM,
+	ENCODING_TGA,
+	ENCODING_DDS,
+	ENCODING_HDR,
+	ENCODING_EXR,
+	ENCODING_PBM,
 }
 
 func EncodingExtension(encoding ImageEncoding) string {
@@ -64,6 +95,24 @@ func EncodingExtension(encoding ImageEncoding) string {
 		return ".cur"
 	case ENCODING_WEBP:
 		return ".webp"
+	case ENCODING_QOI:
+		return ".qoi"
+	case ENCODING_PPM:
+		return ".ppm"
+	case ENCODING_PGM:
+		return ".pgm"
+	case ENCODING_PAM:
+		return ".pam"
+	case ENCODING_TGA:
+		return ".tga"
+	case ENCODING_DDS:
+		return ".dds"
+	case ENCODING_HDR:
+		return ".hdr"
+	case ENCODING_EXR:
+		return ".exr"
+	case ENCODING_PBM:
+		return ".pbm"
 	default:
 		return ".unknown"
 	}
@@ -93,6 +142,26 @@ func ExtensionEncoding(ext string) ImageEncoding {
 		return ENCODING_CUR
 	case ".webp":
 		return ENCODING_WEBP
+	case ".qoi":
+		return ENCODING_QOI
+	case ".ppm":
+		fallthrough
+	case ".pnm":
+		return ENCODING_PPM
+	case ".pgm":
+		return ENCODING_PGM
+	case ".pbm":
+		return ENCODING_PBM
+	case ".pam":
+		return ENCODING_PAM
+	case ".tga":
+		return ENCODING_TGA
+	case ".dds":
+		return ENCODING_DDS
+	case ".hdr":
+		return ENCODING_HDR
+	case ".exr":
+		return ENCODING_EXR
 	}
 
 	return ENCODING_UNKNOWN
@@ -118,6 +187,10 @@ func ImageGetDraw(img image.Image) draw.Image {
 		return i
 	case *image.CMYK:
 		return i
+	case *image.Paletted:
+		return i
+	case *RGBAF32:
+		return i
 	default:
 		return nil
 	}
@@ -22,6 +22,10 @@ func Limit(img image.Image, model ColorModel) (image.Image, ColorModel) {
 		return i, MODEL_GRAY16
 	case *image.CMYK:
 		return i, MODEL_CMYK
+	case *image.Paletted:
+		return i, MODEL_PALETTED
+	case *RGBAF32:
+		return i, MODEL_RGBAF32
 	default:
 		return CopyImage(i, model), model
 	}
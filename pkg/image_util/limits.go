@@ -0,0 +1,261 @@
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"math"
+)
+
+// DecodeLimits guards against decompression bombs by checking the image header before it is decoded.
+// A limit of 0 is unlimited.
+type DecodeLimits struct {
+	// MaxPixels is the max width*height of the image, or of the canvas for animations.
+	MaxPixels int
+	// MaxBytes is the max size of the encoded data.
+	MaxBytes int64
+	// MaxFrames is the max number of frames in an animation.
+	MaxFrames int
+}
+
+type DecodeLimitError struct {
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (e *DecodeLimitError) Error() string {
+	return fmt.Sprintf("image exceeds the decode limit for %s: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+// Merge returns the stricter value of each limit, so a per-call limit can never loosen a global one.
+func (l DecodeLimits) Merge(other DecodeLimits) DecodeLimits {
+	return DecodeLimits{
+		MaxPixels: int(limitMin(int64(l.MaxPixels), int64(other.MaxPixels))),
+		MaxBytes:  limitMin(l.MaxBytes, other.MaxBytes),
+		MaxFrames: int(limitMin(int64(l.MaxFrames), int64(other.MaxFrames))),
+	}
+}
+
+func limitMin(a, b int64) int64 {
+	if a <= 0 {
+		return max(b, 0)
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
+
+// decodeMaxDimension and decodeMaxPixels bound the buffers allocated from a decoded header,
+// so a crafted size fails with an error even when no DecodeLimits are set.
+const (
+	decodeMaxDimension = 1 << 20
+	decodeMaxPixels    = 1 << 30
+)
+
+// decodeSizeCheck validates a size read from an image header before a buffer of bpp bytes per pixel is allocated for it.
+func decodeSizeCheck(width, height, bpp int) error {
+	if width <= 0 || height <= 0 || width > decodeMaxDimension || height > decodeMaxDimension {
+		return fmt.Errorf("invalid image size: %dx%d", width, height)
+	}
+	if width*height > decodeMaxPixels || width*height > math.MaxInt/bpp {
+		return fmt.Errorf("image is too large to decode: %dx%d", width, height)
+	}
+	return nil
+}
+
+func (l DecodeLimits) CheckBytes(size int64) error {
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return &DecodeLimitError{Limit: "max_bytes", Value: size, Max: l.MaxBytes}
+	}
+	return nil
+}
+
+func (l DecodeLimits) CheckPixels(width, height int) error {
+	if width < 0 || height < 0 {
+		return fmt.Errorf("invalid image size: %dx%d", width, height)
+	}
+
+	pixels := int64(width) * int64(height)
+	if l.MaxPixels > 0 && pixels > int64(l.MaxPixels) {
+		return &DecodeLimitError{Limit: "max_pixels", Value: pixels, Max: int64(l.MaxPixels)}
+	}
+	return nil
+}
+
+func (l DecodeLimits) CheckFrames(frames int) error {
+	if l.MaxFrames > 0 && frames > l.MaxFrames {
+		return &DecodeLimitError{Limit: "max_frames", Value: int64(frames), Max: int64(l.MaxFrames)}
+	}
+	return nil
+}
+
+// Check reads the size and header of the image without decoding it,
+// the reader is returned to its starting position.
+func (l DecodeLimits) Check(r io.ReadSeeker, encoding ImageEncoding) error {
+	if l.MaxBytes <= 0 && l.MaxPixels <= 0 {
+		return nil
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if err := l.CheckBytes(end - start); err != nil {
+		return err
+	}
+
+	if l.MaxPixels > 0 {
+		_, err = r.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		width, height, err := DecodeConfig(r, encoding)
+		if err != nil {
+			return err
+		}
+		if err := l.CheckPixels(width, height); err != nil {
+			return err
+		}
+	}
+
+	_, err = r.Seek(start, io.SeekStart)
+	return err
+}
+
+// ReadAll reads r until EOF, failing once more than MaxBytes have been read.
+func (l DecodeLimits) ReadAll(r io.Reader) ([]byte, error) {
+	if l.MaxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, l.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CheckBytes(int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// DecodeLimited checks the limits before decoding the image.
+func DecodeLimited(r io.ReadSeeker, encoding ImageEncoding, limits DecodeLimits) (image.Image, error) {
+	encoding, err := ResolveEncoding(r, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := limits.Check(r, encoding); err != nil {
+		return nil, err
+	}
+
+	return Decode(r, encoding)
+}
+
+// GIFDecodeAll checks the canvas size and frame count before decoding all frames of the gif.
+func GIFDecodeAll(r io.Reader, limits DecodeLimits) (*gif.GIF, error) {
+	data, err := limits.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxPixels > 0 {
+		cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := limits.CheckPixels(cfg.Width, cfg.Height); err != nil {
+			return nil, err
+		}
+	}
+
+	if limits.MaxFrames > 0 {
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := limits.CheckFrames(frames); err != nil {
+			return nil, err
+		}
+	}
+
+	return gif.DecodeAll(bytes.NewReader(data))
+}
+
+// gifFrameCount walks the gif blocks to count the frames without decompressing them.
+func gifFrameCount(data []byte) (int, error) {
+	if len(data) < 13 || string(data[:3]) != "GIF" {
+		return 0, fmt.Errorf("invalid gif")
+	}
+
+	p := 13
+	// global color table
+	if data[10]&0x80 != 0 {
+		p += 3 * (1 << (int(data[10]&0x07) + 1))
+	}
+
+	skipSubBlocks := func() error {
+		for {
+			if p >= len(data) {
+				return fmt.Errorf("unexpected end of gif")
+			}
+			n := int(data[p])
+			p += 1 + n
+			if n == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames := 0
+	for p < len(data) {
+		switch data[p] {
+		case 0x21: // extension
+			p += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if p+10 > len(data) {
+				return 0, fmt.Errorf("unexpected end of gif")
+			}
+			flags := data[p+9]
+			p += 10
+			// local color table
+			if flags&0x80 != 0 {
+				p += 3 * (1 << (int(flags&0x07) + 1))
+			}
+			// lzw minimum code size
+			p++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("invalid gif block: 0x%x", data[p])
+		}
+	}
+
+	return frames, nil
+}
+
+// animationCheckFrame is shared by the apng and webp decoders, frames must fit within the canvas.
+func animationCheckFrame(rect image.Rectangle, width, height int) error {
+	if rect.Empty() || rect.Min.X < 0 || rect.Min.Y < 0 || rect.Max.X > width || rect.Max.Y > height {
+		return fmt.Errorf("animation frame %s is outside of the %dx%d canvas", rect, width, height)
+	}
+	return nil
+}
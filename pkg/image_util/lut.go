@@ -0,0 +1,475 @@
+package imageutil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LUTInterpolation is how colors between the points of a 3D LUT are sampled.
+type LUTInterpolation int
+
+const (
+	// LUTINTERPOLATION_TRILINEAR blends the 8 surrounding points.
+	LUTINTERPOLATION_TRILINEAR LUTInterpolation = iota
+	// LUTINTERPOLATION_TETRAHEDRAL blends the 4 points of the tetrahedron the color is in,
+	// this keeps the neutral axis neutral.
+	LUTINTERPOLATION_TETRAHEDRAL
+)
+
+var LUTInterpolationList = []LUTInterpolation{
+	LUTINTERPOLATION_TRILINEAR,
+	LUTINTERPOLATION_TETRAHEDRAL,
+}
+
+const (
+	LUT_SIZE_MIN = 2
+	LUT_SIZE_MAX = 256
+	LUT_1D_MAX   = 65536
+
+	HALD_LEVEL_MIN = 2
+	HALD_LEVEL_MAX = 16
+)
+
+// LUT is a color lookup table made of an optional 1D shaper followed by an optional 3D cube.
+// Tables store rgb triplets with red changing fastest, matching the .cube format.
+type LUT struct {
+	Title string
+
+	Size1D      int
+	Table1D     []float32
+	Domain1DMin [3]float64
+	Domain1DMax [3]float64
+
+	Size      int
+	Table     []float32
+	DomainMin [3]float64
+	DomainMax [3]float64
+}
+
+// NewLUT creates an identity 3D LUT with the given size.
+func NewLUT(size int) (*LUT, error) {
+	if size < LUT_SIZE_MIN || size > LUT_SIZE_MAX {
+		return nil, fmt.Errorf("lut size must be between %d and %d, got: %d", LUT_SIZE_MIN, LUT_SIZE_MAX, size)
+	}
+
+	l := &LUT{
+		Size:      size,
+		Table:     make([]float32, size*size*size*3),
+		DomainMax: [3]float64{1, 1, 1},
+	}
+
+	step := float32(size - 1)
+	i := 0
+	for b := range size {
+		for g := range size {
+			for r := range size {
+				l.Table[i] = float32(r) / step
+				l.Table[i+1] = float32(g) / step
+				l.Table[i+2] = float32(b) / step
+				i += 3
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// Validate checks that the tables match their sizes and the domains are not empty.
+func (l *LUT) Validate() error {
+	if l.Size == 0 && l.Size1D == 0 {
+		return fmt.Errorf("lut has no 1D or 3D table")
+	}
+
+	if l.Size1D != 0 {
+		if l.Size1D < LUT_SIZE_MIN || l.Size1D > LUT_1D_MAX {
+			return fmt.Errorf("1D lut size must be between %d and %d, got: %d", LUT_SIZE_MIN, LUT_1D_MAX, l.Size1D)
+		}
+		if len(l.Table1D) != l.Size1D*3 {
+			return fmt.Errorf("1D lut expected %d values, got: %d", l.Size1D*3, len(l.Table1D))
+		}
+		for c := range 3 {
+			if l.Domain1DMax[c] <= l.Domain1DMin[c] {
+				return fmt.Errorf("1D lut domain max must be greater than min, got: %v, %v", l.Domain1DMin, l.Domain1DMax)
+			}
+		}
+	}
+
+	if l.Size != 0 {
+		if l.Size < LUT_SIZE_MIN || l.Size > LUT_SIZE_MAX {
+			return fmt.Errorf("3D lut size must be between %d and %d, got: %d", LUT_SIZE_MIN, LUT_SIZE_MAX, l.Size)
+		}
+		if len(l.Table) != l.Size*l.Size*l.Size*3 {
+			return fmt.Errorf("3D lut expected %d values, got: %d", l.Size*l.Size*l.Size*3, len(l.Table))
+		}
+		for c := range 3 {
+			if l.DomainMax[c] <= l.DomainMin[c] {
+				return fmt.Errorf("3D lut domain max must be greater than min, got: %v, %v", l.DomainMin, l.DomainMax)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LUTCubeDecode parses an Adobe or Resolve .cube file.
+// Files with both a 1D and 3D table have the 1D table listed first.
+func LUTCubeDecode(r io.Reader) (*LUT, error) {
+	l := &LUT{
+		Domain1DMax: [3]float64{1, 1, 1},
+		DomainMax:   [3]float64{1, 1, 1},
+	}
+	data := []float32{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		keyword := fields[0]
+
+		if keyword == "TITLE" {
+			l.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(text, "TITLE")), "\"")
+			continue
+		}
+
+		if keyword[0] == '-' || keyword[0] == '.' || (keyword[0] >= '0' && keyword[0] <= '9') {
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected 3 values, got: %d", line, len(fields))
+			}
+			values, err := cubeFloats(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			for _, v := range values {
+				data = append(data, float32(v))
+			}
+			continue
+		}
+
+		values, err := cubeFloats(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		switch keyword {
+		case "LUT_1D_SIZE", "LUT_3D_SIZE":
+			if len(values) != 1 || values[0] != math.Trunc(values[0]) {
+				return nil, fmt.Errorf("line %d: invalid %s", line, keyword)
+			}
+			// the size is checked before it is used to count the table rows.
+			if keyword == "LUT_1D_SIZE" {
+				if values[0] < LUT_SIZE_MIN || values[0] > LUT_1D_MAX {
+					return nil, fmt.Errorf("line %d: 1D lut size must be between %d and %d, got: %g", line, LUT_SIZE_MIN, LUT_1D_MAX, values[0])
+				}
+				l.Size1D = int(values[0])
+			} else {
+				if values[0] < LUT_SIZE_MIN || values[0] > LUT_SIZE_MAX {
+					return nil, fmt.Errorf("line %d: 3D lut size must be between %d and %d, got: %g", line, LUT_SIZE_MIN, LUT_SIZE_MAX, values[0])
+				}
+				l.Size = int(values[0])
+			}
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			if len(values) != 3 {
+				return nil, fmt.Errorf("line %d: %s expects 3 values", line, keyword)
+			}
+			// the domain applies to whichever table is in the file.
+			if keyword == "DOMAIN_MIN" {
+				copy(l.Domain1DMin[:], values)
+				copy(l.DomainMin[:], values)
+			} else {
+				copy(l.Domain1DMax[:], values)
+				copy(l.DomainMax[:], values)
+			}
+		case "LUT_1D_INPUT_RANGE", "LUT_3D_INPUT_RANGE":
+			if len(values) != 2 {
+				return nil, fmt.Errorf("line %d: %s expects 2 values", line, keyword)
+			}
+			if keyword == "LUT_1D_INPUT_RANGE" {
+				l.Domain1DMin = [3]float64{values[0], values[0], values[0]}
+				l.Domain1DMax = [3]float64{values[1], values[1], values[1]}
+			} else {
+				l.DomainMin = [3]float64{values[0], values[0], values[0]}
+				l.DomainMax = [3]float64{values[1], values[1], values[1]}
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword: %s", line, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	size1D := l.Size1D * 3
+	size3D := l.Size * l.Size * l.Size * 3
+	if len(data) != size1D+size3D {
+		return nil, fmt.Errorf("expected %d values, got: %d", size1D+size3D, len(data))
+	}
+
+	if l.Size1D != 0 {
+		l.Table1D = data[:size1D]
+	}
+	if l.Size != 0 {
+		l.Table = data[size1D:]
+	}
+
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func cubeFloats(fields []string) ([]float64, error) {
+	values := make([]float64, len(fields))
+
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", f)
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// HaldLevel returns the level of a HaldCLUT image,
+// an image of level L is L^3 pixels square and holds a cube of size L^2.
+func HaldLevel(width, height int) (int, error) {
+	if width != height {
+		return 0, fmt.Errorf("haldclut must be square, got: %dx%d", width, height)
+	}
+
+	for level := HALD_LEVEL_MIN; level <= HALD_LEVEL_MAX; level++ {
+		if level*level*level == width {
+			return level, nil
+		}
+	}
+
+	return 0, fmt.Errorf("haldclut size must be the cube of a level between %d and %d, got: %d", HALD_LEVEL_MIN, HALD_LEVEL_MAX, width)
+}
+
+// LUTHaldDecode reads a 3D LUT from a HaldCLUT image.
+func LUTHaldDecode(img image.Image) (*LUT, error) {
+	bounds := img.Bounds()
+	level, err := HaldLevel(bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return nil, err
+	}
+
+	size := level * level
+	l := &LUT{
+		Size:      size,
+		Table:     make([]float32, size*size*size*3),
+		DomainMax: [3]float64{1, 1, 1},
+	}
+
+	width := bounds.Dx()
+	for i := range size * size * size {
+		c := color.NRGBA64Model.Convert(img.At(bounds.Min.X+i%width, bounds.Min.Y+i/width)).(color.NRGBA64)
+		l.Table[i*3] = float32(c.R) / 0xffff
+		l.Table[i*3+1] = float32(c.G) / 0xffff
+		l.Table[i*3+2] = float32(c.B) / 0xffff
+	}
+
+	return l, nil
+}
+
+// LUTHaldIdentity creates an identity HaldCLUT image,
+// it is 16-bit to keep the precision of larger levels.
+func LUTHaldIdentity(level int) (*image.NRGBA64, error) {
+	if level < HALD_LEVEL_MIN || level > HALD_LEVEL_MAX {
+		return nil, fmt.Errorf("haldclut level must be between %d and %d, got: %d", HALD_LEVEL_MIN, HALD_LEVEL_MAX, level)
+	}
+
+	size := level * level
+	width := size * level
+	img := image.NewNRGBA64(image.Rect(0, 0, width, width))
+
+	step := float64(size - 1)
+	i := 0
+	for b := range size {
+		for g := range size {
+			for r := range size {
+				img.SetNRGBA64(i%width, i/width, color.NRGBA64{
+					R: uint16(math.Round(float64(r) / step * 0xffff)),
+					G: uint16(math.Round(float64(g) / step * 0xffff)),
+					B: uint16(math.Round(float64(b) / step * 0xffff)),
+					A: 0xffff,
+				})
+				i++
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// Apply maps the colors of the image through the LUT, alpha is kept as is.
+// Strength mixes between the original colors at 0 and the graded colors at 1.
+func (l *LUT) Apply(img image.Image, interp LUTInterpolation, strength float64) *image.NRGBA64 {
+	out := CopyImage(img, MODEL_NRGBA64).(*image.NRGBA64)
+
+	for i := 0; i < len(out.Pix); i += 8 {
+		if out.Pix[i+6] == 0 && out.Pix[i+7] == 0 {
+			continue
+		}
+
+		var src [3]float64
+		for c := range 3 {
+			src[c] = float64(uint16(out.Pix[i+c*2])<<8|uint16(out.Pix[i+c*2+1])) / 0xffff
+		}
+
+		dst := l.Lookup(src, interp)
+
+		for c := range 3 {
+			v := src[c] + (dst[c]-src[c])*strength
+			v16 := uint16(math.Round(math.Max(0, math.Min(1, v)) * 0xffff))
+			out.Pix[i+c*2] = uint8(v16 >> 8)
+			out.Pix[i+c*2+1] = uint8(v16)
+		}
+	}
+
+	return out
+}
+
+// Lookup maps a single color with components between 0 and 1.
+func (l *LUT) Lookup(c [3]float64, interp LUTInterpolation) [3]float64 {
+	if l.Size1D != 0 {
+		for i := range 3 {
+			c[i] = l.lookup1D(lutNormalize(c[i], l.Domain1DMin[i], l.Domain1DMax[i]), i)
+		}
+	}
+
+	if l.Size != 0 {
+		var p [3]float64
+		for i := range 3 {
+			p[i] = lutNormalize(c[i], l.DomainMin[i], l.DomainMax[i]) * float64(l.Size-1)
+		}
+
+		if interp == LUTINTERPOLATION_TETRAHEDRAL {
+			c = l.tetrahedral(p)
+		} else {
+			c = l.trilinear(p)
+		}
+	}
+
+	return c
+}
+
+func lutNormalize(v, min, max float64) float64 {
+	return math.Max(0, math.Min(1, (v-min)/(max-min)))
+}
+
+func (l *LUT) lookup1D(v float64, channel int) float64 {
+	p := v * float64(l.Size1D-1)
+	i := int(p)
+	if i >= l.Size1D-1 {
+		return float64(l.Table1D[(l.Size1D-1)*3+channel])
+	}
+
+	f := p - float64(i)
+	a := float64(l.Table1D[i*3+channel])
+	b := float64(l.Table1D[(i+1)*3+channel])
+	return a + (b-a)*f
+}
+
+// cell returns the index of the lower corner of the cell containing p,
+// with the fractional position inside the cell.
+func (l *LUT) cell(p [3]float64) ([3]int, [3]float64) {
+	var i [3]int
+	var f [3]float64
+
+	for c := range 3 {
+		i[c] = int(p[c])
+		if i[c] >= l.Size-1 {
+			i[c] = l.Size - 2
+		}
+		f[c] = p[c] - float64(i[c])
+	}
+
+	return i, f
+}
+
+func (l *LUT) point(r, g, b int) [3]float64 {
+	i := ((b*l.Size+g)*l.Size + r) * 3
+	return [3]float64{float64(l.Table[i]), float64(l.Table[i+1]), float64(l.Table[i+2])}
+}
+
+func (l *LUT) trilinear(p [3]float64) [3]float64 {
+	i, f := l.cell(p)
+
+	var out [3]float64
+	for corner := range 8 {
+		dr, dg, db := corner&1, (corner>>1)&1, (corner>>2)&1
+
+		w := 1.0
+		for c, d := range [3]int{dr, dg, db} {
+			if d == 1 {
+				w *= f[c]
+			} else {
+				w *= 1 - f[c]
+			}
+		}
+		if w == 0 {
+			continue
+		}
+
+		v := l.point(i[0]+dr, i[1]+dg, i[2]+db)
+		for c := range 3 {
+			out[c] += v[c] * w
+		}
+	}
+
+	return out
+}
+
+func (l *LUT) tetrahedral(p [3]float64) [3]float64 {
+	i, f := l.cell(p)
+	fr, fg, fb := f[0], f[1], f[2]
+
+	c000 := l.point(i[0], i[1], i[2])
+	c111 := l.point(i[0]+1, i[1]+1, i[2]+1)
+
+	var w0, w1, w2, w3 float64
+	var c1, c2 [3]float64
+
+	switch {
+	case fr > fg && fg > fb:
+		c1, c2 = l.point(i[0]+1, i[1], i[2]), l.point(i[0]+1, i[1]+1, i[2])
+		w0, w1, w2, w3 = 1-fr, fr-fg, fg-fb, fb
+	case fr > fg && fr > fb:
+		c1, c2 = l.point(i[0]+1, i[1], i[2]), l.point(i[0]+1, i[1], i[2]+1)
+		w0, w1, w2, w3 = 1-fr, fr-fb, fb-fg, fg
+	case fr > fg:
+		c1, c2 = l.point(i[0], i[1], i[2]+1), l.point(i[0]+1, i[1], i[2]+1)
+		w0, w1, w2, w3 = 1-fb, fb-fr, fr-fg, fg
+	case fb > fg:
+		c1, c2 = l.point(i[0], i[1], i[2]+1), l.point(i[0], i[1]+1, i[2]+1)
+		w0, w1, w2, w3 = 1-fb, fb-fg, fg-fr, fr
+	case fb > fr:
+		c1, c2 = l.point(i[0], i[1]+1, i[2]), l.point(i[0], i[1]+1, i[2]+1)
+		w0, w1, w2, w3 = 1-fg, fg-fb, fb-fr, fr
+	default:
+		c1, c2 = l.point(i[0], i[1]+1, i[2]), l.point(i[0]+1, i[1]+1, i[2])
+		w0, w1, w2, w3 = 1-fg, fg-fr, fr-fb, fb
+	}
+
+	var out [3]float64
+	for c := range 3 {
+		out[c] = c000[c]*w0 + c1[c]*w1 + c2[c]*w2 + c111[c]*w3
+	}
+
+	return out
+}
@@ -0,0 +1,967 @@
+package imageutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	ORIENTATION_NORMAL = iota + 1
+	ORIENTATION_FLIP_HORIZONTAL
+	ORIENTATION_ROTATE_180
+	ORIENTATION_FLIP_VERTICAL
+	ORIENTATION_TRANSPOSE
+	ORIENTATION_ROTATE_90
+	ORIENTATION_TRANSVERSE
+	ORIENTATION_ROTATE_270
+)
+
+// Metadata holds the EXIF and XMP fields read from an image.
+// Only these fields are kept, any other EXIF tags are dropped when the metadata is written.
+type Metadata struct {
+	Orientation int
+
+	Description string
+	Make        string
+	Model       string
+	Software    string
+	Artist      string
+	Copyright   string
+
+	DateTime         string
+	DateTimeOriginal string
+
+	LensModel    string
+	ExposureTime float64
+	FNumber      float64
+	ISO          int
+	FocalLength  float64
+
+	GPS *MetadataGPS
+
+	XMP string
+}
+
+// MetadataGPS uses signed decimal degrees, south and west are negative.
+// Altitude is in meters and is negative below sea level.
+type MetadataGPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+const (
+	exifTagDescription      uint16 = 0x010E
+	exifTagMake             uint16 = 0x010F
+	exifTagModel            uint16 = 0x0110
+	exifTagOrientation      uint16 = 0x0112
+	exifTagSoftware         uint16 = 0x0131
+	exifTagDateTime         uint16 = 0x0132
+	exifTagArtist           uint16 = 0x013B
+	exifTagXMP              uint16 = 0x02BC
+	exifTagCopyright        uint16 = 0x8298
+	exifTagExifIFD          uint16 = 0x8769
+	exifTagGPSIFD           uint16 = 0x8825
+	exifTagExposureTime     uint16 = 0x829A
+	exifTagFNumber          uint16 = 0x829D
+	exifTagISO              uint16 = 0x8827
+	exifTagDateTimeOriginal uint16 = 0x9003
+	exifTagFocalLength      uint16 = 0x920A
+	exifTagLensModel        uint16 = 0xA434
+
+	gpsTagVersion      uint16 = 0x0000
+	gpsTagLatitudeRef  uint16 = 0x0001
+	gpsTagLatitude     uint16 = 0x0002
+	gpsTagLongitudeRef uint16 = 0x0003
+	gpsTagLongitude    uint16 = 0x0004
+	gpsTagAltitudeRef  uint16 = 0x0005
+	gpsTagAltitude     uint16 = 0x0006
+)
+
+const (
+	exifTypeByte      uint16 = 1
+	exifTypeASCII     uint16 = 2
+	exifTypeShort     uint16 = 3
+	exifTypeLong      uint16 = 4
+	exifTypeRational  uint16 = 5
+	exifTypeUndefined uint16 = 7
+	exifTypeSLong     uint16 = 9
+	exifTypeSRational uint16 = 10
+)
+
+var exifTypeSize = map[uint16]uint32{
+	exifTypeByte:      1,
+	exifTypeASCII:     1,
+	exifTypeShort:     2,
+	exifTypeLong:      4,
+	exifTypeRational:  8,
+	exifTypeUndefined: 1,
+	exifTypeSLong:     4,
+	exifTypeSRational: 8,
+}
+
+const jpegExifHeader = "Exif\x00\x00"
+const jpegXMPHeader = "http://ns.adobe.com/xap/1.0/\x00"
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+// max payload of a jpeg segment, the length field includes its own 2 bytes.
+const jpegSegmentMax = 0xFFFF - 2
+
+// MetadataDecode reads the metadata of an image without decoding it,
+// the reader is returned to its starting position afterwards.
+// A nil Metadata is returned when the image has none, or the encoding cannot hold any.
+func MetadataDecode(r io.ReadSeeker, encoding ImageEncoding) (*Metadata, error) {
+	encoding, err := ResolveEncoding(r, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.Seek(start, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var exif, xmp []byte
+
+	switch encoding {
+	case ENCODING_JPEG:
+		exif, xmp, err = metadataExtractJPEG(data)
+	case ENCODING_PNG:
+		exif, xmp, err = metadataExtractPNG(data)
+	case ENCODING_WEBP:
+		exif, xmp, err = metadataExtractWebP(data)
+	case ENCODING_TIFF:
+		exif = data
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if exif == nil && xmp == nil {
+		return nil, nil
+	}
+
+	meta := &Metadata{
+		XMP: string(xmp),
+	}
+
+	if exif != nil {
+		err = metadataParseEXIF(exif, meta)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, nil
+}
+
+func metadataExtractJPEG(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, nil, fmt.Errorf("invalid jpeg")
+	}
+
+	var exif, xmp []byte
+
+	p := 2
+	for p+4 <= len(data) {
+		if data[p] != 0xFF {
+			return nil, nil, fmt.Errorf("invalid jpeg marker at %d", p)
+		}
+
+		marker := data[p+1]
+		if marker == 0xFF {
+			p++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			p += 2
+			continue
+		}
+		// metadata is always before the scan data.
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		ln := int(binary.BigEndian.Uint16(data[p+2 : p+4]))
+		if ln < 2 || p+2+ln > len(data) {
+			return nil, nil, fmt.Errorf("invalid jpeg segment length at %d", p)
+		}
+		payload := data[p+4 : p+2+ln]
+
+		if marker == 0xE1 {
+			if exif == nil && bytes.HasPrefix(payload, []byte(jpegExifHeader)) {
+				exif = payload[len(jpegExifHeader):]
+			} else if xmp == nil && bytes.HasPrefix(payload, []byte(jpegXMPHeader)) {
+				xmp = payload[len(jpegXMPHeader):]
+			}
+		}
+
+		p += 2 + ln
+	}
+
+	return exif, xmp, nil
+}
+
+func metadataExtractPNG(data []byte) ([]byte, []byte, error) {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return nil, nil, fmt.Errorf("invalid png")
+	}
+
+	var exif, xmp []byte
+
+	p := len(magic)
+	for p+8 <= len(data) {
+		ln := int(binary.BigEndian.Uint32(data[p : p+4]))
+		typ := string(data[p+4 : p+8])
+		if ln < 0 || p+12+ln > len(data) {
+			return nil, nil, fmt.Errorf("invalid png chunk length at %d", p)
+		}
+		chunk := data[p+8 : p+8+ln]
+
+		switch typ {
+		case "eXIf":
+			exif = chunk
+		case "iTXt":
+			text, ok, err := pngITXtXMP(chunk)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				xmp = text
+			}
+		case "IEND":
+			return exif, xmp, nil
+		}
+
+		p += 12 + ln
+	}
+
+	return exif, xmp, nil
+}
+
+func pngITXtXMP(chunk []byte) ([]byte, bool, error) {
+	keyword, rest, ok := bytes.Cut(chunk, []byte{0})
+	if !ok || string(keyword) != pngXMPKeyword || len(rest) < 2 {
+		return nil, false, nil
+	}
+
+	compressed := rest[0] == 1
+	rest = rest[2:]
+
+	// language tag, then the translated keyword.
+	for range 2 {
+		_, rest, ok = bytes.Cut(rest, []byte{0})
+		if !ok {
+			return nil, false, fmt.Errorf("invalid png iTXt chunk")
+		}
+	}
+
+	if !compressed {
+		return rest, true, nil
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return nil, false, err
+	}
+	defer zr.Close()
+
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return text, true, nil
+}
+
+func metadataExtractWebP(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, nil, fmt.Errorf("invalid webp")
+	}
+
+	var exif, xmp []byte
+
+	p := 12
+	for p+8 <= len(data) {
+		typ := string(data[p : p+4])
+		ln := int(binary.LittleEndian.Uint32(data[p+4 : p+8]))
+		if ln < 0 || p+8+ln > len(data) {
+			return nil, nil, fmt.Errorf("invalid webp chunk length at %d", p)
+		}
+		chunk := data[p+8 : p+8+ln]
+
+		switch typ {
+		case "EXIF":
+			// some writers keep the jpeg header in the chunk.
+			exif = bytes.TrimPrefix(chunk, []byte(jpegExifHeader))
+		case "XMP ":
+			xmp = chunk
+		}
+
+		p += 8 + ln + ln%2
+	}
+
+	return exif, xmp, nil
+}
+
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type exifReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newEXIFReader(data []byte) (*exifReader, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("exif data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, fmt.Errorf("invalid exif byte order")
+	}
+
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, 0, fmt.Errorf("invalid exif header")
+	}
+
+	return &exifReader{data: data, order: order}, order.Uint32(data[4:8]), nil
+}
+
+func (e *exifReader) ifd(offset uint32) (map[uint16]exifEntry, error) {
+	if uint64(offset)+2 > uint64(len(e.data)) {
+		return nil, fmt.Errorf("exif ifd offset out of range: %d", offset)
+	}
+
+	n := uint32(e.order.Uint16(e.data[offset : offset+2]))
+	if uint64(offset)+2+uint64(n)*12 > uint64(len(e.data)) {
+		return nil, fmt.Errorf("exif ifd at %d is truncated", offset)
+	}
+
+	entries := map[uint16]exifEntry{}
+
+	for ind := range n {
+		p := offset + 2 + ind*12
+		tag := e.order.Uint16(e.data[p : p+2])
+		typ := e.order.Uint16(e.data[p+2 : p+4])
+		count := e.order.Uint32(e.data[p+4 : p+8])
+
+		size, ok := exifTypeSize[typ]
+		if !ok {
+			continue
+		}
+
+		ln := uint64(size) * uint64(count)
+		var value []byte
+
+		if ln <= 4 {
+			value = e.data[p+8 : p+8+uint32(ln)]
+		} else {
+			off := uint64(e.order.Uint32(e.data[p+8 : p+12]))
+			if off+ln > uint64(len(e.data)) {
+				continue
+			}
+			value = e.data[off : off+ln]
+		}
+
+		entries[tag] = exifEntry{typ: typ, count: count, value: value}
+	}
+
+	return entries, nil
+}
+
+func (e *exifReader) ascii(entry exifEntry) string {
+	if entry.typ != exifTypeASCII {
+		return ""
+	}
+	return strings.TrimRight(string(entry.value), "\x00 ")
+}
+
+func (e *exifReader) uint(entry exifEntry) int {
+	if uint32(len(entry.value)) < exifTypeSize[entry.typ] {
+		return 0
+	}
+
+	switch entry.typ {
+	case exifTypeByte:
+		return int(entry.value[0])
+	case exifTypeShort:
+		return int(e.order.Uint16(entry.value))
+	case exifTypeLong:
+		return int(e.order.Uint32(entry.value))
+	}
+	return 0
+}
+
+// rational returns 0 when the entry is not a rational or is too short, so a malformed field is skipped.
+func (e *exifReader) rational(entry exifEntry, ind int) float64 {
+	if entry.typ != exifTypeRational && entry.typ != exifTypeSRational {
+		return 0
+	}
+	if uint32(ind) >= entry.count || len(entry.value) < (ind+1)*8 {
+		return 0
+	}
+	v := entry.value[ind*8:]
+
+	switch entry.typ {
+	case exifTypeRational:
+		num, den := e.order.Uint32(v[0:4]), e.order.Uint32(v[4:8])
+		if den == 0 {
+			return 0
+		}
+		return float64(num) / float64(den)
+	case exifTypeSRational:
+		num, den := int32(e.order.Uint32(v[0:4])), int32(e.order.Uint32(v[4:8]))
+		if den == 0 {
+			return 0
+		}
+		return float64(num) / float64(den)
+	}
+	return 0
+}
+
+func metadataParseEXIF(data []byte, meta *Metadata) error {
+	e, offset, err := newEXIFReader(data)
+	if err != nil {
+		return err
+	}
+
+	ifd0, err := e.ifd(offset)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := ifd0[exifTagOrientation]; ok {
+		meta.Orientation = e.uint(v)
+	}
+	meta.Description = e.ascii(ifd0[exifTagDescription])
+	meta.Make = e.ascii(ifd0[exifTagMake])
+	meta.Model = e.ascii(ifd0[exifTagModel])
+	meta.Software = e.ascii(ifd0[exifTagSoftware])
+	meta.Artist = e.ascii(ifd0[exifTagArtist])
+	meta.Copyright = e.ascii(ifd0[exifTagCopyright])
+	meta.DateTime = e.ascii(ifd0[exifTagDateTime])
+
+	// only tiff files store xmp inside of the ifd.
+	if v, ok := ifd0[exifTagXMP]; ok && meta.XMP == "" {
+		meta.XMP = string(v.value)
+	}
+
+	if v, ok := ifd0[exifTagExifIFD]; ok {
+		sub, err := e.ifd(uint32(e.uint(v)))
+		if err != nil {
+			return err
+		}
+
+		meta.DateTimeOriginal = e.ascii(sub[exifTagDateTimeOriginal])
+		meta.LensModel = e.ascii(sub[exifTagLensModel])
+		meta.ExposureTime = e.rational(sub[exifTagExposureTime], 0)
+		meta.FNumber = e.rational(sub[exifTagFNumber], 0)
+		meta.FocalLength = e.rational(sub[exifTagFocalLength], 0)
+		if v, ok := sub[exifTagISO]; ok {
+			meta.ISO = e.uint(v)
+		}
+	}
+
+	if v, ok := ifd0[exifTagGPSIFD]; ok {
+		gps, err := e.ifd(uint32(e.uint(v)))
+		if err != nil {
+			return err
+		}
+
+		lat, latOk := gps[gpsTagLatitude]
+		lon, lonOk := gps[gpsTagLongitude]
+
+		if latOk && lonOk {
+			meta.GPS = &MetadataGPS{
+				Latitude:  e.degrees(lat),
+				Longitude: e.degrees(lon),
+				Altitude:  e.rational(gps[gpsTagAltitude], 0),
+			}
+
+			if e.ascii(gps[gpsTagLatitudeRef]) == "S" {
+				meta.GPS.Latitude = -meta.GPS.Latitude
+			}
+			if e.ascii(gps[gpsTagLongitudeRef]) == "W" {
+				meta.GPS.Longitude = -meta.GPS.Longitude
+			}
+			if v, ok := gps[gpsTagAltitudeRef]; ok && e.uint(v) == 1 {
+				meta.GPS.Altitude = -meta.GPS.Altitude
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *exifReader) degrees(entry exifEntry) float64 {
+	return e.rational(entry, 0) + e.rational(entry, 1)/60 + e.rational(entry, 2)/3600
+}
+
+type exifEntryWrite struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+var exifOrder = binary.BigEndian
+
+func exifASCII(tag uint16, s string) exifEntryWrite {
+	return exifEntryWrite{tag: tag, typ: exifTypeASCII, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func exifShort(tag uint16, v int) exifEntryWrite {
+	return exifEntryWrite{tag: tag, typ: exifTypeShort, count: 1, value: exifOrder.AppendUint16(nil, uint16(v))}
+}
+
+func exifLong(tag uint16, v uint32) exifEntryWrite {
+	return exifEntryWrite{tag: tag, typ: exifTypeLong, count: 1, value: exifOrder.AppendUint32(nil, v)}
+}
+
+func exifRational(tag uint16, vs ...float64) exifEntryWrite {
+	value := []byte{}
+	for _, v := range vs {
+		num, den := rationalFromFloat(v)
+		value = exifOrder.AppendUint32(value, num)
+		value = exifOrder.AppendUint32(value, den)
+	}
+	return exifEntryWrite{tag: tag, typ: exifTypeRational, count: uint32(len(vs)), value: value}
+}
+
+// exposure times are kept as 1/n when possible, as that is how cameras write them.
+func rationalFromFloat(v float64) (uint32, uint32) {
+	v = math.Abs(v)
+
+	if v > 0 && v < 1 {
+		inv := 1 / v
+		if math.Abs(inv-math.Round(inv)) < 1e-6 {
+			return 1, uint32(math.Round(inv))
+		}
+	}
+
+	const den = 10000
+	return uint32(math.Round(v * den)), den
+}
+
+func exifIFDWrite(entries []exifEntryWrite, offset uint32) []byte {
+	slices.SortFunc(entries, func(a, b exifEntryWrite) int {
+		return int(a.tag) - int(b.tag)
+	})
+
+	size := uint32(2 + 12*len(entries) + 4)
+	ifd := exifOrder.AppendUint16(nil, uint16(len(entries)))
+	data := []byte{}
+
+	for _, entry := range entries {
+		ifd = exifOrder.AppendUint16(ifd, entry.tag)
+		ifd = exifOrder.AppendUint16(ifd, entry.typ)
+		ifd = exifOrder.AppendUint32(ifd, entry.count)
+
+		if len(entry.value) <= 4 {
+			v := [4]byte{}
+			copy(v[:], entry.value)
+			ifd = append(ifd, v[:]...)
+			continue
+		}
+
+		ifd = exifOrder.AppendUint32(ifd, offset+size+uint32(len(data)))
+		data = append(data, entry.value...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+
+	// no next ifd.
+	ifd = exifOrder.AppendUint32(ifd, 0)
+
+	return append(ifd, data...)
+}
+
+// MetadataEncodeEXIF builds a big endian EXIF block from the metadata,
+// nil is returned when there are no EXIF fields to write.
+func MetadataEncodeEXIF(meta *Metadata) []byte {
+	ifd0 := []exifEntryWrite{}
+	sub := []exifEntryWrite{}
+	gps := []exifEntryWrite{}
+
+	if meta.Orientation != 0 {
+		ifd0 = append(ifd0, exifShort(exifTagOrientation, meta.Orientation))
+	}
+
+	for _, field := range []struct {
+		tag   uint16
+		value string
+	}{
+		{exifTagDescription, meta.Description},
+		{exifTagMake, meta.Make},
+		{exifTagModel, meta.Model},
+		{exifTagSoftware, meta.Software},
+		{exifTagArtist, meta.Artist},
+		{exifTagCopyright, meta.Copyright},
+		{exifTagDateTime, meta.DateTime},
+	} {
+		if field.value != "" {
+			ifd0 = append(ifd0, exifASCII(field.tag, field.value))
+		}
+	}
+
+	if meta.DateTimeOriginal != "" {
+		sub = append(sub, exifASCII(exifTagDateTimeOriginal, meta.DateTimeOriginal))
+	}
+	if meta.LensModel != "" {
+		sub = append(sub, exifASCII(exifTagLensModel, meta.LensModel))
+	}
+	if meta.ExposureTime != 0 {
+		sub = append(sub, exifRational(exifTagExposureTime, meta.ExposureTime))
+	}
+	if meta.FNumber != 0 {
+		sub = append(sub, exifRational(exifTagFNumber, meta.FNumber))
+	}
+	if meta.FocalLength != 0 {
+		sub = append(sub, exifRational(exifTagFocalLength, meta.FocalLength))
+	}
+	if meta.ISO != 0 {
+		sub = append(sub, exifShort(exifTagISO, meta.ISO))
+	}
+
+	if meta.GPS != nil {
+		latRef, lonRef, altRef := "N", "E", byte(0)
+		if meta.GPS.Latitude < 0 {
+			latRef = "S"
+		}
+		if meta.GPS.Longitude < 0 {
+			lonRef = "W"
+		}
+		if meta.GPS.Altitude < 0 {
+			altRef = 1
+		}
+
+		gps = append(gps,
+			exifEntryWrite{tag: gpsTagVersion, typ: exifTypeByte, count: 4, value: []byte{2, 3, 0, 0}},
+			exifASCII(gpsTagLatitudeRef, latRef),
+			exifRational(gpsTagLatitude, degreesSplit(meta.GPS.Latitude)...),
+			exifASCII(gpsTagLongitudeRef, lonRef),
+			exifRational(gpsTagLongitude, degreesSplit(meta.GPS.Longitude)...),
+			exifEntryWrite{tag: gpsTagAltitudeRef, typ: exifTypeByte, count: 1, value: []byte{altRef}},
+			exifRational(gpsTagAltitude, meta.GPS.Altitude),
+		)
+	}
+
+	if len(ifd0) == 0 && len(sub) == 0 && len(gps) == 0 {
+		return nil
+	}
+
+	// pointer values don't change the size of ifd0, so they can be filled in after.
+	if len(sub) > 0 {
+		ifd0 = append(ifd0, exifLong(exifTagExifIFD, 0))
+	}
+	if len(gps) > 0 {
+		ifd0 = append(ifd0, exifLong(exifTagGPSIFD, 0))
+	}
+
+	offset := uint32(8)
+	next := offset + uint32(len(exifIFDWrite(ifd0, offset)))
+
+	var subData, gpsData []byte
+
+	for ind, entry := range ifd0 {
+		switch entry.tag {
+		case exifTagExifIFD:
+			ifd0[ind] = exifLong(exifTagExifIFD, next)
+			subData = exifIFDWrite(sub, next)
+			next += uint32(len(subData))
+		case exifTagGPSIFD:
+			ifd0[ind] = exifLong(exifTagGPSIFD, next)
+			gpsData = exifIFDWrite(gps, next)
+			next += uint32(len(gpsData))
+		}
+	}
+
+	data := []byte("MM")
+	data = exifOrder.AppendUint16(data, 42)
+	data = exifOrder.AppendUint32(data, offset)
+	data = append(data, exifIFDWrite(ifd0, offset)...)
+	data = append(data, subData...)
+	data = append(data, gpsData...)
+
+	return data
+}
+
+func degreesSplit(v float64) []float64 {
+	v = math.Abs(v)
+	deg := math.Floor(v)
+	min := math.Floor((v - deg) * 60)
+	sec := (v - deg - min/60) * 3600
+
+	return []float64{deg, min, sec}
+}
+
+// metadataWrite adds the metadata to already encoded image data,
+// encodings that cannot hold metadata are returned unchanged.
+func metadataWrite(data []byte, encoding ImageEncoding, meta *Metadata) ([]byte, error) {
+	exif := MetadataEncodeEXIF(meta)
+	xmp := []byte(meta.XMP)
+
+	if exif == nil && len(xmp) == 0 {
+		return data, nil
+	}
+
+	switch encoding {
+	case ENCODING_JPEG:
+		return metadataWriteJPEG(data, exif, xmp)
+	case ENCODING_PNG:
+		return metadataWritePNG(data, exif, xmp)
+	case ENCODING_WEBP:
+		return metadataWriteWebP(data, exif, xmp)
+	}
+
+	return data, nil
+}
+
+func metadataWriteJPEG(data, exif, xmp []byte) ([]byte, error) {
+	segment := func(header string, payload []byte) ([]byte, error) {
+		ln := len(header) + len(payload)
+		if ln > jpegSegmentMax {
+			return nil, fmt.Errorf("jpeg metadata segment too large: %d bytes", ln)
+		}
+
+		b := []byte{0xFF, 0xE1}
+		b = binary.BigEndian.AppendUint16(b, uint16(ln+2))
+		b = append(b, header...)
+		return append(b, payload...), nil
+	}
+
+	out := slices.Clone(data[:2])
+
+	if exif != nil {
+		b, err := segment(jpegExifHeader, exif)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	if len(xmp) > 0 {
+		b, err := segment(jpegXMPHeader, xmp)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+
+	return append(out, data[2:]...), nil
+}
+
+func pngChunk(typ string, chunk []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(chunk)))
+	b = append(b, typ...)
+	b = append(b, chunk...)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(chunk)
+
+	return binary.BigEndian.AppendUint32(b, crc.Sum32())
+}
+
+func metadataWritePNG(data, exif, xmp []byte) ([]byte, error) {
+	// the IHDR chunk is always first and has a fixed size.
+	const ihdrEnd = len(magic) + 12 + 13
+	if len(data) < ihdrEnd {
+		return nil, fmt.Errorf("invalid png")
+	}
+
+	out := slices.Clone(data[:ihdrEnd])
+
+	if exif != nil {
+		out = append(out, pngChunk("eXIf", exif)...)
+	}
+	if len(xmp) > 0 {
+		chunk := append([]byte(pngXMPKeyword), 0, 0, 0, 0, 0)
+		chunk = append(chunk, xmp...)
+		out = append(out, pngChunk("iTXt", chunk)...)
+	}
+
+	return append(out, data[ihdrEnd:]...), nil
+}
+
+const (
+	webpFlagAlpha = 0x10
+	webpFlagEXIF  = 0x08
+	webpFlagXMP   = 0x04
+)
+
+func webpChunk(typ string, chunk []byte) []byte {
+	b := append([]byte(typ), binary.LittleEndian.AppendUint32(nil, uint32(len(chunk)))...)
+	b = append(b, chunk...)
+	if len(chunk)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// metadataWriteWebP converts simple webp files to the extended format,
+// the metadata chunks must come after the image data.
+func metadataWriteWebP(data, exif, xmp []byte) ([]byte, error) {
+	if len(data) < 20 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("invalid webp")
+	}
+
+	body := slices.Clone(data[12:])
+	first := string(body[0:4])
+
+	switch first {
+	case "VP8X":
+		body[8] |= webpFlagEXIF * boolByte(exif != nil)
+		body[8] |= webpFlagXMP * boolByte(len(xmp) > 0)
+
+	case "VP8 ", "VP8L":
+		width, height, alpha, err := webpCanvas(body)
+		if err != nil {
+			return nil, err
+		}
+
+		vp8x := make([]byte, 10)
+		vp8x[0] = webpFlagEXIF*boolByte(exif != nil) | webpFlagXMP*boolByte(len(xmp) > 0) | webpFlagAlpha*boolByte(alpha)
+		putUint24(vp8x[4:7], uint32(width-1))
+		putUint24(vp8x[7:10], uint32(height-1))
+
+		body = append(webpChunk("VP8X", vp8x), body...)
+
+	default:
+		return nil, fmt.Errorf("unknown webp chunk: %s", first)
+	}
+
+	if exif != nil {
+		body = append(body, webpChunk("EXIF", exif)...)
+	}
+	if len(xmp) > 0 {
+		body = append(body, webpChunk("XMP ", xmp)...)
+	}
+
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(4+len(body)))
+	out = append(out, "WEBP"...)
+
+	return append(out, body...), nil
+}
+
+func webpCanvas(body []byte) (int, int, bool, error) {
+	chunk := body[8:]
+
+	switch string(body[0:4]) {
+	case "VP8 ":
+		if len(chunk) < 10 {
+			return 0, 0, false, fmt.Errorf("invalid webp VP8 chunk")
+		}
+		width := int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3FFF)
+		return width, height, false, nil
+
+	case "VP8L":
+		if len(chunk) < 5 || chunk[0] != 0x2F {
+			return 0, 0, false, fmt.Errorf("invalid webp VP8L chunk")
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:5])
+		width := int(bits&0x3FFF) + 1
+		height := int((bits>>14)&0x3FFF) + 1
+		alpha := (bits>>28)&1 == 1
+		return width, height, alpha, nil
+	}
+
+	return 0, 0, false, fmt.Errorf("unknown webp chunk: %s", body[0:4])
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// MetadataOrient returns a new image with the EXIF orientation applied,
+// so that it displays upright with an orientation of ORIENTATION_NORMAL.
+func MetadataOrient(img image.Image, orientation int) image.Image {
+	if orientation <= ORIENTATION_NORMAL || orientation > ORIENTATION_ROTATE_270 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= ORIENTATION_TRANSPOSE {
+		dw, dh = h, w
+	}
+
+	var dst draw.Image
+	if p, ok := img.(*image.Paletted); ok {
+		dst = image.NewPaletted(image.Rect(0, 0, dw, dh), ClonePalette(p.Palette))
+	} else {
+		_, model := Limit(img, MODEL_RGBA)
+		dst = ImageGetDraw(NewImage(dw, dh, model))
+	}
+
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+
+			switch orientation {
+			case ORIENTATION_FLIP_HORIZONTAL:
+				sx, sy = w-1-x, y
+			case ORIENTATION_ROTATE_180:
+				sx, sy = w-1-x, h-1-y
+			case ORIENTATION_FLIP_VERTICAL:
+				sx, sy = x, h-1-y
+			case ORIENTATION_TRANSPOSE:
+				sx, sy = y, x
+			case ORIENTATION_ROTATE_90:
+				sx, sy = y, h-1-x
+			case ORIENTATION_TRANSVERSE:
+				sx, sy = w-1-y, h-1-x
+			case ORIENTATION_ROTATE_270:
+				sx, sy = w-1-y, x
+			}
+
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
@@ -12,6 +12,8 @@ const (
 	MODEL_GRAY
 	MODEL_GRAY16
 	MODEL_CMYK
+	MODEL_PALETTED
+	MODEL_RGBAF32
 )
 
 var ModelList = []ColorModel{
@@ -24,4 +26,6 @@ var ModelList = []ColorModel{
 	MODEL_GRAY,
 	MODEL_GRAY16,
 	MODEL_CMYK,
+	MODEL_PALETTED,
+	MODEL_RGBAF32,
 }
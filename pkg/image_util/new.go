@@ -30,6 +30,10 @@ func NewImage(width, height int, model ColorModel) image.Image {
 		img = image.NewGray16(rect)
 	case MODEL_CMYK:
 		img = image.NewCMYK(rect)
+	case MODEL_PALETTED:
+		img = image.NewPaletted(rect, DefaultPalette())
+	case MODEL_RGBAF32:
+		img = NewRGBAF32(rect)
 	}
 
 	return img
@@ -0,0 +1,404 @@
+package imageutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+type NineSliceMode int
+
+const (
+	NINESLICE_STRETCH NineSliceMode = iota
+	// NINESLICE_TILE repeats the source region from its top left, the last repeat is cut off.
+	NINESLICE_TILE
+)
+
+var NineSliceModeList = []NineSliceMode{
+	NINESLICE_STRETCH,
+	NINESLICE_TILE,
+}
+
+// NineSlice holds the insets of the corners from each edge of the image,
+// and the padding of the content area used by nine-patches.
+type NineSlice struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+
+	PaddingLeft   int `json:"padding_left"`
+	PaddingTop    int `json:"padding_top"`
+	PaddingRight  int `json:"padding_right"`
+	PaddingBottom int `json:"padding_bottom"`
+}
+
+// Validate checks that the insets and padding fit within an image of width by height.
+func (s NineSlice) Validate(width, height int) error {
+	for _, v := range []int{s.Left, s.Top, s.Right, s.Bottom, s.PaddingLeft, s.PaddingTop, s.PaddingRight, s.PaddingBottom} {
+		if v < 0 {
+			return fmt.Errorf("nine-slice insets must not be negative")
+		}
+	}
+
+	if s.Left+s.Right > width || s.Top+s.Bottom > height {
+		return fmt.Errorf("nine-slice insets %d,%d,%d,%d do not fit in %dx%d", s.Left, s.Top, s.Right, s.Bottom, width, height)
+	}
+	if s.PaddingLeft+s.PaddingRight > width || s.PaddingTop+s.PaddingBottom > height {
+		return fmt.Errorf("nine-slice padding %d,%d,%d,%d does not fit in %dx%d", s.PaddingLeft, s.PaddingTop, s.PaddingRight, s.PaddingBottom, width, height)
+	}
+
+	return nil
+}
+
+type NineSliceOptions struct {
+	Edge   NineSliceMode
+	Center NineSliceMode
+	// Smooth uses bilinear sampling when stretching, otherwise nearest neighbor is used.
+	// Samples never cross into a neighboring region.
+	Smooth bool
+}
+
+func DefaultNineSliceOptions() NineSliceOptions {
+	return NineSliceOptions{
+		Edge:   NINESLICE_STRETCH,
+		Center: NINESLICE_STRETCH,
+		Smooth: false,
+	}
+}
+
+func (o NineSliceOptions) Validate() error {
+	if o.Edge < 0 || int(o.Edge) >= len(NineSliceModeList) {
+		return fmt.Errorf("invalid nine-slice edge mode: %d", o.Edge)
+	}
+	if o.Center < 0 || int(o.Center) >= len(NineSliceModeList) {
+		return fmt.Errorf("invalid nine-slice center mode: %d", o.Center)
+	}
+
+	return nil
+}
+
+// NineSliceResize resizes the image to width by height, keeping the corners at their size.
+// When the size is smaller than the corners, the corners are scaled down to fit.
+func NineSliceResize(img image.Image, slice NineSlice, width, height int, opts NineSliceOptions) (*image.NRGBA, error) {
+	src := imageNRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	if err := slice.Validate(sw, sh); err != nil {
+		return nil, err
+	}
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("invalid nine-slice size: %dx%d", width, height)
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	cols := nineSliceSpans(slice.Left, slice.Right, sw, width)
+	rows := nineSliceSpans(slice.Top, slice.Bottom, sh, height)
+
+	for ry, row := range rows {
+		for rx, col := range cols {
+			mode := NINESLICE_STRETCH
+			if rx == 1 && ry == 1 {
+				mode = opts.Center
+			} else if rx == 1 || ry == 1 {
+				mode = opts.Edge
+			}
+
+			nineSliceDraw(out, src, col, row, mode, opts.Smooth)
+		}
+	}
+
+	return out, nil
+}
+
+// nineSliceSpan maps a range of source pixels to a range of output pixels.
+type nineSliceSpan struct {
+	src0, src1 int
+	dst0, dst1 int
+}
+
+func nineSliceSpans(start, end, size, target int) [3]nineSliceSpan {
+	dstStart, dstEnd := start, end
+	if start+end > target {
+		dstStart = int(math.Round(float64(start) * float64(target) / float64(start+end)))
+		dstEnd = target - dstStart
+	}
+
+	return [3]nineSliceSpan{
+		{0, start, 0, dstStart},
+		{start, size - end, dstStart, target - dstEnd},
+		{size - end, size, target - dstEnd, target},
+	}
+}
+
+func nineSliceDraw(out, src *image.NRGBA, col, row nineSliceSpan, mode NineSliceMode, smooth bool) {
+	sw, sh := col.src1-col.src0, row.src1-row.src0
+	dw, dh := col.dst1-col.dst0, row.dst1-row.dst0
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return
+	}
+
+	for y := range dh {
+		for x := range dw {
+			i := (row.dst0+y)*out.Stride + (col.dst0+x)*4
+
+			if mode == NINESLICE_TILE {
+				j := (row.src0+y%sh)*src.Stride + (col.src0+x%sw)*4
+				copy(out.Pix[i:i+4], src.Pix[j:j+4])
+				continue
+			}
+
+			// the center of the output pixel, mapped into the source region.
+			fx := (float64(x)+0.5)*float64(sw)/float64(dw) - 0.5
+			fy := (float64(y)+0.5)*float64(sh)/float64(dh) - 0.5
+
+			if !smooth {
+				sx := min(max(int(math.Round(fx)), 0), sw-1)
+				sy := min(max(int(math.Round(fy)), 0), sh-1)
+				j := (row.src0+sy)*src.Stride + (col.src0+sx)*4
+				copy(out.Pix[i:i+4], src.Pix[j:j+4])
+				continue
+			}
+
+			fx = math.Max(0, math.Min(fx, float64(sw-1)))
+			fy = math.Max(0, math.Min(fy, float64(sh-1)))
+			x0, y0 := int(fx), int(fy)
+			x1, y1 := min(x0+1, sw-1), min(y0+1, sh-1)
+			tx, ty := fx-float64(x0), fy-float64(y0)
+
+			at := func(px, py int) [4]float64 {
+				j := (row.src0+py)*src.Stride + (col.src0+px)*4
+				a := float64(src.Pix[j+3])
+				// premultiply so transparent pixels don't bleed their color.
+				return [4]float64{float64(src.Pix[j]) * a, float64(src.Pix[j+1]) * a, float64(src.Pix[j+2]) * a, a}
+			}
+
+			c00, c10, c01, c11 := at(x0, y0), at(x1, y0), at(x0, y1), at(x1, y1)
+			var c [4]float64
+			for k := range 4 {
+				top := c00[k] + (c10[k]-c00[k])*tx
+				bottom := c01[k] + (c11[k]-c01[k])*tx
+				c[k] = top + (bottom-top)*ty
+			}
+
+			if c[3] <= 0 {
+				copy(out.Pix[i:i+4], []uint8{0, 0, 0, 0})
+				continue
+			}
+			for k := range 3 {
+				out.Pix[i+k] = uint8(math.Round(math.Min(c[k]/c[3], 255)))
+			}
+			out.Pix[i+3] = uint8(math.Round(c[3]))
+		}
+	}
+}
+
+// ninePatchMarker is the opaque black used to mark the stretch and padding areas.
+var ninePatchMarker = color.NRGBA{0, 0, 0, 255}
+
+// ninePatchLayout is the opaque red used for optical bounds, which are ignored.
+var ninePatchLayout = color.NRGBA{255, 0, 0, 255}
+
+// NinePatchDecode reads the guide markers from the 1 pixel border of an Android .9.png,
+// returning the image without the border.
+// Multiple stretch areas on an edge are merged into one, as a nine-slice only has one.
+// When the padding is not marked, it matches the stretch area.
+func NinePatchDecode(img image.Image) (*image.NRGBA, NineSlice, error) {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	slice := NineSlice{}
+
+	if w < 3 || h < 3 {
+		return nil, slice, fmt.Errorf("nine-patch must be at least 3x3, got: %dx%d", w, h)
+	}
+
+	// span finds the first and last marked pixel along the border, relative to the content.
+	span := func(edge string, count int, at func(i int) color.NRGBA) (int, int, bool, error) {
+		first, last := -1, -1
+
+		for i := range count {
+			c := at(i + 1)
+			switch {
+			case c == ninePatchMarker:
+				if first < 0 {
+					first = i
+				}
+				last = i
+			case c.A == 0 || c == ninePatchLayout:
+			default:
+				return 0, 0, false, fmt.Errorf("invalid nine-patch marker on the %s edge at %d: %v", edge, i, c)
+			}
+		}
+
+		if first < 0 {
+			return 0, 0, false, nil
+		}
+		return first, count - 1 - last, true, nil
+	}
+
+	cw, ch := w-2, h-2
+	var ok bool
+	var err error
+
+	slice.Left, slice.Right, ok, err = span("top", cw, func(i int) color.NRGBA { return src.NRGBAAt(i, 0) })
+	if err != nil {
+		return nil, slice, err
+	}
+	if !ok {
+		return nil, slice, fmt.Errorf("nine-patch is missing the top stretch marker")
+	}
+
+	slice.Top, slice.Bottom, ok, err = span("left", ch, func(i int) color.NRGBA { return src.NRGBAAt(0, i) })
+	if err != nil {
+		return nil, slice, err
+	}
+	if !ok {
+		return nil, slice, fmt.Errorf("nine-patch is missing the left stretch marker")
+	}
+
+	slice.PaddingLeft, slice.PaddingRight, ok, err = span("bottom", cw, func(i int) color.NRGBA { return src.NRGBAAt(i, h-1) })
+	if err != nil {
+		return nil, slice, err
+	}
+	if !ok {
+		slice.PaddingLeft, slice.PaddingRight = slice.Left, slice.Right
+	}
+
+	slice.PaddingTop, slice.PaddingBottom, ok, err = span("right", ch, func(i int) color.NRGBA { return src.NRGBAAt(w-1, i) })
+	if err != nil {
+		return nil, slice, err
+	}
+	if !ok {
+		slice.PaddingTop, slice.PaddingBottom = slice.Top, slice.Bottom
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, cw, ch))
+	for y := range ch {
+		copy(out.Pix[y*out.Stride:y*out.Stride+cw*4], src.Pix[(y+1)*src.Stride+4:])
+	}
+
+	return out, slice, nil
+}
+
+// NinePatchEncode adds a 1 pixel border to the image with the guide markers of an Android .9.png.
+// The stretch area must not be empty, so at least one pixel is always marked.
+func NinePatchEncode(img image.Image, slice NineSlice) (*image.NRGBA, error) {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	if err := slice.Validate(w, h); err != nil {
+		return nil, err
+	}
+	if slice.Left+slice.Right >= w || slice.Top+slice.Bottom >= h {
+		return nil, fmt.Errorf("nine-patch stretch area must not be empty")
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, w+2, h+2))
+	for y := range h {
+		copy(out.Pix[(y+1)*out.Stride+4:], src.Pix[y*src.Stride:y*src.Stride+w*4])
+	}
+
+	for x := slice.Left; x < w-slice.Right; x++ {
+		out.SetNRGBA(x+1, 0, ninePatchMarker)
+	}
+	for y := slice.Top; y < h-slice.Bottom; y++ {
+		out.SetNRGBA(0, y+1, ninePatchMarker)
+	}
+	for x := slice.PaddingLeft; x < w-slice.PaddingRight; x++ {
+		out.SetNRGBA(x+1, h+1, ninePatchMarker)
+	}
+	for y := slice.PaddingTop; y < h-slice.PaddingBottom; y++ {
+		out.SetNRGBA(w+1, y+1, ninePatchMarker)
+	}
+
+	return out, nil
+}
+
+// NineSliceFromAseprite converts the center of an Aseprite 9-slice key into insets,
+// the padding matches the center.
+func NineSliceFromAseprite(key AsepriteSliceKey) NineSlice {
+	left := key.Center.Min.X
+	top := key.Center.Min.Y
+	right := key.Bounds.Dx() - key.Center.Max.X
+	bottom := key.Bounds.Dy() - key.Center.Max.Y
+
+	return NineSlice{
+		Left: left, Top: top, Right: right, Bottom: bottom,
+		PaddingLeft: left, PaddingTop: top, PaddingRight: right, PaddingBottom: bottom,
+	}
+}
+
+// NineSliceDecodeJSON reads a sidecar file containing the fields of a NineSlice,
+// missing padding fields match the insets.
+func NineSliceDecodeJSON(r io.Reader) (NineSlice, error) {
+	var data struct {
+		NineSlice
+		PaddingLeft   *int `json:"padding_left"`
+		PaddingTop    *int `json:"padding_top"`
+		PaddingRight  *int `json:"padding_right"`
+		PaddingBottom *int `json:"padding_bottom"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return NineSlice{}, fmt.Errorf("invalid nine-slice json: %s", err)
+	}
+
+	slice := data.NineSlice
+	slice.PaddingLeft = nineSlicePadding(data.PaddingLeft, slice.Left)
+	slice.PaddingTop = nineSlicePadding(data.PaddingTop, slice.Top)
+	slice.PaddingRight = nineSlicePadding(data.PaddingRight, slice.Right)
+	slice.PaddingBottom = nineSlicePadding(data.PaddingBottom, slice.Bottom)
+
+	return slice, nil
+}
+
+func nineSlicePadding(v *int, inset int) int {
+	if v == nil {
+		return inset
+	}
+	return *v
+}
+
+// NineSliceEncodeJSON writes the sidecar format read by NineSliceDecodeJSON.
+func NineSliceEncodeJSON(slice NineSlice) ([]byte, error) {
+	return json.MarshalIndent(slice, "", "\t")
+}
+
+// NineSliceDecodeAsepriteJSON reads the 9-slices from the meta of an Aseprite json export,
+// using the first key of each slice. Slices without a center are skipped.
+func NineSliceDecodeAsepriteJSON(r io.Reader) (map[string]NineSlice, error) {
+	var data struct {
+		Meta struct {
+			Slices []struct {
+				Name string `json:"name"`
+				Keys []struct {
+					Bounds atlasJSONRect  `json:"bounds"`
+					Center *atlasJSONRect `json:"center"`
+				} `json:"keys"`
+			} `json:"slices"`
+		} `json:"meta"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid aseprite json: %s", err)
+	}
+
+	slices := map[string]NineSlice{}
+	for _, s := range data.Meta.Slices {
+		if len(s.Keys) == 0 || s.Keys[0].Center == nil {
+			continue
+		}
+
+		k := s.Keys[0]
+		slices[s.Name] = NineSliceFromAseprite(AsepriteSliceKey{
+			Bounds: image.Rect(k.Bounds.X, k.Bounds.Y, k.Bounds.X+k.Bounds.W, k.Bounds.Y+k.Bounds.H),
+			Center: image.Rect(k.Center.X, k.Center.Y, k.Center.X+k.Center.W, k.Center.Y+k.Center.H),
+		})
+	}
+
+	return slices, nil
+}
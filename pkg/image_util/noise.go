@@ -0,0 +1,308 @@
+package imageutil
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ojrac/opensimplex-go"
+)
+
+// Noise is a 2D noise function returning values roughly between -1 and 1.
+// When period is above 0 the noise repeats every period units on both axes,
+// so an image covering exactly one period tiles seamlessly.
+type Noise interface {
+	Eval2(x, y float64, period int) float64
+}
+
+type WorleyDistance int
+
+const (
+	// WORLEYDISTANCE_F1 is the distance to the closest feature point.
+	WORLEYDISTANCE_F1 WorleyDistance = iota
+	// WORLEYDISTANCE_F2 is the distance to the second closest feature point.
+	WORLEYDISTANCE_F2
+	// WORLEYDISTANCE_F2_F1 is F2 minus F1, which outlines the cells.
+	WORLEYDISTANCE_F2_F1
+)
+
+var WorleyDistanceList = []WorleyDistance{
+	WORLEYDISTANCE_F1,
+	WORLEYDISTANCE_F2,
+	WORLEYDISTANCE_F2_F1,
+}
+
+type WorleyMetric int
+
+const (
+	WORLEYMETRIC_EUCLIDEAN WorleyMetric = iota
+	WORLEYMETRIC_MANHATTAN
+	WORLEYMETRIC_CHEBYSHEV
+)
+
+var WorleyMetricList = []WorleyMetric{
+	WORLEYMETRIC_EUCLIDEAN,
+	WORLEYMETRIC_MANHATTAN,
+	WORLEYMETRIC_CHEBYSHEV,
+}
+
+type FractalType int
+
+const (
+	// FRACTAL_FBM sums the octaves.
+	FRACTAL_FBM FractalType = iota
+	// FRACTAL_TURBULENCE sums the absolute value of the octaves, creating creases at 0.
+	FRACTAL_TURBULENCE
+	// FRACTAL_RIDGED is a ridged multifractal, sharp ridges where each octave is weighted by the previous.
+	FRACTAL_RIDGED
+)
+
+var FractalTypeList = []FractalType{
+	FRACTAL_FBM,
+	FRACTAL_TURBULENCE,
+	FRACTAL_RIDGED,
+}
+
+const NOISE_OCTAVES_MAX = 16
+
+// noiseHash mixes the lattice position with the seed.
+func noiseHash(seed int64, x, y int) uint32 {
+	h := uint32(seed) ^ uint32(seed>>32)*0x9e3779b9
+	h ^= uint32(x) * 0x27d4eb2d
+	h = noiseMix(h)
+	h ^= uint32(y) * 0x165667b1
+	return noiseMix(h)
+}
+
+func noiseMix(h uint32) uint32 {
+	h ^= h >> 15
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// noiseWrap wraps a lattice coordinate into the period, when there is one.
+func noiseWrap(i, period int) int {
+	if period <= 0 {
+		return i
+	}
+	return ((i % period) + period) % period
+}
+
+func noiseFade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func noiseLerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// NoisePerlin is classic gradient noise with quintic interpolation.
+type NoisePerlin struct {
+	Seed int64
+}
+
+func (n *NoisePerlin) Eval2(x, y float64, period int) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	ix, iy := int(x0), int(y0)
+	fx, fy := x-x0, y-y0
+
+	grad := func(cx, cy int, dx, dy float64) float64 {
+		h := noiseHash(n.Seed, noiseWrap(cx, period), noiseWrap(cy, period))
+		angle := float64(h) / (1 << 32) * 2 * math.Pi
+		return math.Cos(angle)*dx + math.Sin(angle)*dy
+	}
+
+	u, v := noiseFade(fx), noiseFade(fy)
+	a := noiseLerp(grad(ix, iy, fx, fy), grad(ix+1, iy, fx-1, fy), u)
+	b := noiseLerp(grad(ix, iy+1, fx, fy-1), grad(ix+1, iy+1, fx-1, fy-1), u)
+
+	// 2D perlin noise is within sqrt(0.5), so it is scaled to fill the range.
+	return math.Max(-1, math.Min(1, noiseLerp(a, b, v)*math.Sqrt2))
+}
+
+// NoiseValue interpolates random values placed on a lattice.
+type NoiseValue struct {
+	Seed int64
+}
+
+func (n *NoiseValue) Eval2(x, y float64, period int) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	ix, iy := int(x0), int(y0)
+
+	value := func(cx, cy int) float64 {
+		h := noiseHash(n.Seed, noiseWrap(cx, period), noiseWrap(cy, period))
+		return float64(h)/(1<<32)*2 - 1
+	}
+
+	u, v := noiseFade(x-x0), noiseFade(y-y0)
+	a := noiseLerp(value(ix, iy), value(ix+1, iy), u)
+	b := noiseLerp(value(ix, iy+1), value(ix+1, iy+1), u)
+
+	return noiseLerp(a, b, v)
+}
+
+// NoiseWorley is cellular noise, with one feature point placed in each cell of a lattice.
+// The distance is mapped from 0 to 1 into -1 to 1.
+type NoiseWorley struct {
+	Seed     int64
+	Distance WorleyDistance
+	Metric   WorleyMetric
+	// Jitter is how far the feature points can move from the center of their cell, between 0 and 1.
+	Jitter float64
+}
+
+func (n *NoiseWorley) Eval2(x, y float64, period int) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	ix, iy := int(x0), int(y0)
+
+	f1, f2 := math.Inf(1), math.Inf(1)
+
+	for cy := iy - 2; cy <= iy+2; cy++ {
+		for cx := ix - 2; cx <= ix+2; cx++ {
+			wx, wy := noiseWrap(cx, period), noiseWrap(cy, period)
+			hx := noiseHash(n.Seed, wx, wy)
+			hy := noiseMix(hx ^ 0x5bd1e995)
+
+			px := float64(cx) + 0.5 + (float64(hx)/(1<<32)-0.5)*n.Jitter
+			py := float64(cy) + 0.5 + (float64(hy)/(1<<32)-0.5)*n.Jitter
+
+			dx, dy := math.Abs(px-x), math.Abs(py-y)
+
+			var d float64
+			switch n.Metric {
+			case WORLEYMETRIC_MANHATTAN:
+				d = dx + dy
+			case WORLEYMETRIC_CHEBYSHEV:
+				d = math.Max(dx, dy)
+			default:
+				d = math.Hypot(dx, dy)
+			}
+
+			if d < f1 {
+				f1, f2 = d, f1
+			} else if d < f2 {
+				f2 = d
+			}
+		}
+	}
+
+	var v float64
+	switch n.Distance {
+	case WORLEYDISTANCE_F2:
+		v = f2
+	case WORLEYDISTANCE_F2_F1:
+		v = f2 - f1
+	default:
+		v = f1
+	}
+
+	return math.Min(v, 1)*2 - 1
+}
+
+// NoiseSimplex wraps OpenSimplex, periodic noise is sampled from 4D on the surface of a torus.
+type NoiseSimplex struct {
+	noise opensimplex.Noise
+}
+
+func NewNoiseSimplex(seed int64) *NoiseSimplex {
+	return &NoiseSimplex{noise: opensimplex.New(seed)}
+}
+
+func (n *NoiseSimplex) Eval2(x, y float64, period int) float64 {
+	if period <= 0 {
+		return n.noise.Eval2(x, y)
+	}
+
+	p := float64(period)
+	r := p / (2 * math.Pi)
+	ax := x / p * 2 * math.Pi
+	ay := y / p * 2 * math.Pi
+
+	return math.Max(-1, math.Min(1, n.noise.Eval4(r*math.Cos(ax), r*math.Sin(ax), r*math.Cos(ay), r*math.Sin(ay))))
+}
+
+// NoiseFractal layers octaves of the source noise,
+// each octave has its frequency multiplied by lacunarity and its amplitude by gain.
+// Periodic noise only stays periodic when lacunarity is a whole number.
+type NoiseFractal struct {
+	Source     Noise
+	Type       FractalType
+	Octaves    int
+	Lacunarity float64
+	Gain       float64
+}
+
+func (n *NoiseFractal) Validate() error {
+	if n.Octaves < 1 || n.Octaves > NOISE_OCTAVES_MAX {
+		return fmt.Errorf("octaves must be between 1 and %d, got: %d", NOISE_OCTAVES_MAX, n.Octaves)
+	}
+	if n.Lacunarity <= 0 {
+		return fmt.Errorf("lacunarity must be greater than 0, got: %f", n.Lacunarity)
+	}
+	if n.Gain <= 0 {
+		return fmt.Errorf("gain must be greater than 0, got: %f", n.Gain)
+	}
+
+	return nil
+}
+
+func (n *NoiseFractal) Eval2(x, y float64, period int) float64 {
+	sum := 0.0
+	norm := 0.0
+	amp := 1.0
+	freq := 1.0
+	weight := 1.0
+
+	for octave := range n.Octaves {
+		p := 0
+		if period > 0 {
+			p = int(math.Round(float64(period) * freq))
+		}
+
+		// offset each octave so the lattices don't line up at the origin.
+		offset := float64(octave) * 31.7
+		v := n.Source.Eval2(x*freq+offset, y*freq+offset, p)
+
+		switch n.Type {
+		case FRACTAL_TURBULENCE:
+			v = math.Abs(v)
+		case FRACTAL_RIDGED:
+			v = 1 - math.Abs(v)
+			v *= v
+			v *= weight
+			weight = math.Max(0, math.Min(1, v*2))
+		}
+
+		sum += v * amp
+		norm += amp
+		amp *= n.Gain
+		freq *= n.Lacunarity
+	}
+
+	sum /= norm
+	if n.Type != FRACTAL_FBM {
+		// turbulence and ridged are between 0 and 1.
+		sum = sum*2 - 1
+	}
+
+	return sum
+}
+
+// NoiseWarp offsets the position given to the source by the warp noise, scaled by strength.
+type NoiseWarp struct {
+	Source   Noise
+	Warp     Noise
+	Strength float64
+}
+
+func (n *NoiseWarp) Eval2(x, y float64, period int) float64 {
+	// a constant offset for the y axis keeps it from matching the x axis, without breaking the period.
+	const offset = 57.31
+
+	wx := n.Warp.Eval2(x, y, period)
+	wy := n.Warp.Eval2(x+offset, y+offset, period)
+
+	return n.Source.Eval2(x+wx*n.Strength, y+wy*n.Strength, period)
+}
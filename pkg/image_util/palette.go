@@ -0,0 +1,62 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+
+	"github.com/ericpauley/go-quantize/quantize"
+)
+
+// DefaultPalette is used for new paletted images,
+// index 0 is transparent to match the zero value of the other color models.
+func DefaultPalette() color.Palette {
+	pal := make(color.Palette, 0, len(palette.WebSafe)+1)
+	pal = append(pal, color.Transparent)
+	pal = append(pal, palette.WebSafe...)
+
+	return pal
+}
+
+func ClonePalette(pal color.Palette) color.Palette {
+	c := make(color.Palette, len(pal))
+	copy(c, pal)
+
+	return c
+}
+
+// QuantizePalette creates a palette of up to size colors from img,
+// the first index is reserved for transparency.
+func QuantizePalette(img image.Image, size int) color.Palette {
+	size = max(size, 2)
+
+	q := quantize.MedianCutQuantizer{}
+	pal := q.Quantize(make(color.Palette, 0, size-1), img)
+
+	return append(color.Palette{color.Transparent}, pal...)
+}
+
+func PaletteIndex(img *image.Paletted, x, y int) int {
+	return int(img.ColorIndexAt(x, y))
+}
+
+// PaletteIndexSet sets the palette index of a pixel, out of range indexes are ignored.
+func PaletteIndexSet(img *image.Paletted, x, y, index int) {
+	if index < 0 || index >= len(img.Palette) {
+		return
+	}
+
+	img.SetColorIndex(x, y, uint8(index))
+}
+
+// PaletteSet replaces the palette of img, pixels keep their index.
+// Pixels with an index outside of the new palette are set to 0.
+func PaletteSet(img *image.Paletted, pal color.Palette) {
+	img.Palette = pal
+
+	for i, v := range img.Pix {
+		if int(v) >= len(pal) {
+			img.Pix[i] = 0
+		}
+	}
+}
@@ -0,0 +1,719 @@
+package imageutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/crazy3lf/colorconv"
+)
+
+type PaletteFormat int
+
+const (
+	PALETTEFORMAT_HEX PaletteFormat = iota
+	PALETTEFORMAT_GPL
+	PALETTEFORMAT_JASC
+	PALETTEFORMAT_ACO
+	PALETTEFORMAT_ASE
+	PALETTEFORMAT_PNG
+	PALETTEFORMAT_UNKNOWN
+)
+
+var PaletteFormatList = []PaletteFormat{
+	PALETTEFORMAT_HEX,
+	PALETTEFORMAT_GPL,
+	PALETTEFORMAT_JASC,
+	PALETTEFORMAT_ACO,
+	PALETTEFORMAT_ASE,
+	PALETTEFORMAT_PNG,
+	PALETTEFORMAT_UNKNOWN,
+}
+
+type PaletteColor struct {
+	Color color.NRGBA
+	// Name is empty when the format doesn't store names.
+	Name string
+}
+
+type PaletteFile struct {
+	// Name and Columns are only stored by .gpl files.
+	Name    string
+	Columns int
+	Colors  []PaletteColor
+}
+
+func PaletteFormatExtension(format PaletteFormat) string {
+	switch format {
+	case PALETTEFORMAT_HEX:
+		return ".hex"
+	case PALETTEFORMAT_GPL:
+		return ".gpl"
+	case PALETTEFORMAT_JASC:
+		return ".pal"
+	case PALETTEFORMAT_ACO:
+		return ".aco"
+	case PALETTEFORMAT_ASE:
+		return ".ase"
+	case PALETTEFORMAT_PNG:
+		return ".png"
+	default:
+		return ".unknown"
+	}
+}
+
+func ExtensionPaletteFormat(ext string) PaletteFormat {
+	switch strings.ToLower(ext) {
+	case ".hex", ".txt":
+		return PALETTEFORMAT_HEX
+	case ".gpl":
+		return PALETTEFORMAT_GPL
+	case ".pal":
+		return PALETTEFORMAT_JASC
+	case ".aco":
+		return PALETTEFORMAT_ACO
+	case ".ase":
+		return PALETTEFORMAT_ASE
+	case ".png":
+		return PALETTEFORMAT_PNG
+	}
+
+	return PALETTEFORMAT_UNKNOWN
+}
+
+// DetectPaletteFormat checks the content of data to find the palette format,
+// hex files are detected when every line is a hex color.
+func DetectPaletteFormat(data []byte) PaletteFormat {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIMP Palette")):
+		return PALETTEFORMAT_GPL
+	case bytes.HasPrefix(data, []byte("JASC-PAL")):
+		return PALETTEFORMAT_JASC
+	case bytes.HasPrefix(data, []byte("ASEF")):
+		return PALETTEFORMAT_ASE
+	case bytes.HasPrefix(data, []byte(magic)):
+		return PALETTEFORMAT_PNG
+	case acoValid(data):
+		return PALETTEFORMAT_ACO
+	case hexValid(data):
+		return PALETTEFORMAT_HEX
+	}
+
+	return PALETTEFORMAT_UNKNOWN
+}
+
+// PaletteDecode reads a palette file, use PALETTEFORMAT_UNKNOWN to detect the format from data.
+func PaletteDecode(data []byte, format PaletteFormat) (*PaletteFile, PaletteFormat, error) {
+	if format == PALETTEFORMAT_UNKNOWN {
+		format = DetectPaletteFormat(data)
+	}
+
+	var p *PaletteFile
+	var err error
+
+	switch format {
+	case PALETTEFORMAT_HEX:
+		p, err = hexDecode(data)
+	case PALETTEFORMAT_GPL:
+		p, err = gplDecode(data)
+	case PALETTEFORMAT_JASC:
+		p, err = jascDecode(data)
+	case PALETTEFORMAT_ACO:
+		p, err = acoDecode(data)
+	case PALETTEFORMAT_ASE:
+		p, err = aseSwatchDecode(data)
+	case PALETTEFORMAT_PNG:
+		p, err = pngSwatchDecode(data)
+	default:
+		return nil, format, fmt.Errorf("unknown palette format")
+	}
+
+	return p, format, err
+}
+
+func PaletteEncode(w io.Writer, p *PaletteFile, format PaletteFormat) error {
+	switch format {
+	case PALETTEFORMAT_HEX:
+		return hexEncode(w, p)
+	case PALETTEFORMAT_GPL:
+		return gplEncode(w, p)
+	case PALETTEFORMAT_JASC:
+		return jascEncode(w, p)
+	case PALETTEFORMAT_ACO:
+		return acoEncode(w, p)
+	case PALETTEFORMAT_ASE:
+		return aseSwatchEncode(w, p)
+	case PALETTEFORMAT_PNG:
+		return pngSwatchEncode(w, p)
+	}
+
+	return fmt.Errorf("unknown palette format: %d", format)
+}
+
+// paletteLines splits text into trimmed lines, handling both line endings.
+func paletteLines(data []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	return lines
+}
+
+func hexParse(s string) (color.NRGBA, bool) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.NRGBA{}, false
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+
+	if len(s) == 6 {
+		return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, true
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+func hexValid(data []byte) bool {
+	found := false
+	for _, line := range paletteLines(data) {
+		if line == "" {
+			continue
+		}
+		if _, ok := hexParse(line); !ok {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func hexDecode(data []byte) (*PaletteFile, error) {
+	p := &PaletteFile{}
+
+	for i, line := range paletteLines(data) {
+		if line == "" {
+			continue
+		}
+
+		c, ok := hexParse(line)
+		if !ok {
+			return nil, fmt.Errorf("invalid hex color on line %d: %s", i+1, line)
+		}
+		p.Colors = append(p.Colors, PaletteColor{Color: c})
+	}
+
+	return p, nil
+}
+
+// hexEncode writes each color as rrggbb, alpha is discarded to match lospec.
+func hexEncode(w io.Writer, p *PaletteFile) error {
+	for _, c := range p.Colors {
+		if _, err := fmt.Fprintf(w, "%02x%02x%02x\n", c.Color.R, c.Color.G, c.Color.B); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func gplDecode(data []byte) (*PaletteFile, error) {
+	lines := paletteLines(data)
+	if len(lines) == 0 || lines[0] != "GIMP Palette" {
+		return nil, fmt.Errorf("missing gpl header")
+	}
+
+	p := &PaletteFile{}
+	alpha := false
+
+	for i, line := range lines[1:] {
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "Name:"):
+			p.Name = strings.TrimSpace(strings.TrimPrefix(line, "Name:"))
+			continue
+		case strings.HasPrefix(line, "Columns:"):
+			columns, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Columns:")))
+			if err != nil {
+				return nil, fmt.Errorf("invalid gpl columns on line %d: %s", i+2, line)
+			}
+			p.Columns = columns
+			continue
+		case strings.HasPrefix(line, "Channels:"):
+			alpha = strings.TrimSpace(strings.TrimPrefix(line, "Channels:")) == "RGBA"
+			continue
+		}
+
+		fields := strings.Fields(line)
+		channels := 3
+		if alpha {
+			channels = 4
+		}
+		if len(fields) < channels {
+			return nil, fmt.Errorf("invalid gpl color on line %d: %s", i+2, line)
+		}
+
+		values := [4]uint8{0, 0, 0, 255}
+		for ch := range channels {
+			v, err := strconv.Atoi(fields[ch])
+			if err != nil || v < 0 || v > 255 {
+				return nil, fmt.Errorf("invalid gpl color on line %d: %s", i+2, line)
+			}
+			values[ch] = uint8(v)
+		}
+
+		name := ""
+		if len(fields) > channels {
+			// the name is kept as is, including any inner whitespace.
+			// unicode.IsSpace matches the whitespace used by strings.Fields to split the values.
+			rest := line
+			for range channels {
+				rest = strings.TrimSpace(rest)
+				if end := strings.IndexFunc(rest, unicode.IsSpace); end >= 0 {
+					rest = rest[end:]
+				} else {
+					rest = ""
+				}
+			}
+			name = strings.TrimSpace(rest)
+		}
+
+		p.Colors = append(p.Colors, PaletteColor{
+			Color: color.NRGBA{values[0], values[1], values[2], values[3]},
+			Name:  name,
+		})
+	}
+
+	return p, nil
+}
+
+// gplEncode writes an RGB palette, unless a color isn't opaque then the RGBA channels header is used.
+func gplEncode(w io.Writer, p *PaletteFile) error {
+	alpha := false
+	for _, c := range p.Colors {
+		if c.Color.A != 255 {
+			alpha = true
+		}
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString("GIMP Palette\n")
+	if p.Name != "" {
+		fmt.Fprintf(b, "Name: %s\n", p.Name)
+	}
+	if p.Columns > 0 {
+		fmt.Fprintf(b, "Columns: %d\n", p.Columns)
+	}
+	if alpha {
+		b.WriteString("Channels: RGBA\n")
+	}
+	b.WriteString("#\n")
+
+	for _, c := range p.Colors {
+		fmt.Fprintf(b, "%3d %3d %3d", c.Color.R, c.Color.G, c.Color.B)
+		if alpha {
+			fmt.Fprintf(b, " %3d", c.Color.A)
+		}
+		if c.Name != "" {
+			fmt.Fprintf(b, "\t%s", c.Name)
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func jascDecode(data []byte) (*PaletteFile, error) {
+	lines := paletteLines(data)
+	if len(lines) < 3 || lines[0] != "JASC-PAL" {
+		return nil, fmt.Errorf("missing jasc header")
+	}
+
+	count, err := strconv.Atoi(lines[2])
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid jasc color count: %s", lines[2])
+	}
+
+	p := &PaletteFile{}
+	for i, line := range lines[3:] {
+		if line == "" {
+			continue
+		}
+		if len(p.Colors) == count {
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid jasc color on line %d: %s", i+4, line)
+		}
+
+		values := [3]uint8{}
+		for ch := range values {
+			v, err := strconv.Atoi(fields[ch])
+			if err != nil || v < 0 || v > 255 {
+				return nil, fmt.Errorf("invalid jasc color on line %d: %s", i+4, line)
+			}
+			values[ch] = uint8(v)
+		}
+
+		p.Colors = append(p.Colors, PaletteColor{Color: color.NRGBA{values[0], values[1], values[2], 255}})
+	}
+
+	if len(p.Colors) != count {
+		return nil, fmt.Errorf("jasc palette has %d colors, expected %d", len(p.Colors), count)
+	}
+
+	return p, nil
+}
+
+// jascEncode discards names and alpha, as the format doesn't store them.
+func jascEncode(w io.Writer, p *PaletteFile) error {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "JASC-PAL\r\n0100\r\n%d\r\n", len(p.Colors))
+	for _, c := range p.Colors {
+		fmt.Fprintf(b, "%d %d %d\r\n", c.Color.R, c.Color.G, c.Color.B)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+const (
+	acoSpaceRGB  = 0
+	acoSpaceHSB  = 1
+	acoSpaceCMYK = 2
+	acoSpaceLab  = 7
+	acoSpaceGray = 8
+)
+
+// acoValid checks that the version 1 section fits within the data, as .aco files have no signature.
+func acoValid(data []byte) bool {
+	if len(data) < 4 || binary.BigEndian.Uint16(data) != 1 {
+		return false
+	}
+
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	size := 4 + count*10
+	return count > 0 && (len(data) == size || (len(data) >= size+2 && binary.BigEndian.Uint16(data[size:]) == 2))
+}
+
+func acoColor(space uint16, w, x, y, z uint16) (color.NRGBA, error) {
+	switch space {
+	case acoSpaceRGB:
+		return color.NRGBA{uint8(w >> 8), uint8(x >> 8), uint8(y >> 8), 255}, nil
+	case acoSpaceHSB:
+		r, g, b, err := colorconv.HSVToRGB(math.Mod(float64(w)/65535*360, 360), float64(x)/65535, float64(y)/65535)
+		return color.NRGBA{r, g, b, 255}, err
+	case acoSpaceCMYK:
+		// 0 is full ink.
+		c := 1 - float64(w)/65535
+		m := 1 - float64(x)/65535
+		ye := 1 - float64(y)/65535
+		k := 1 - float64(z)/65535
+		return color.NRGBA{
+			uint8(math.Round(255 * (1 - c) * (1 - k))),
+			uint8(math.Round(255 * (1 - m) * (1 - k))),
+			uint8(math.Round(255 * (1 - ye) * (1 - k))),
+			255,
+		}, nil
+	case acoSpaceLab:
+		return labD50ToColor(float64(w)/100, float64(int16(x))/100, float64(int16(y))/100), nil
+	case acoSpaceGray:
+		// 10000 is black.
+		v := uint8(math.Round(255 * (1 - min(float64(w), 10000)/10000)))
+		return color.NRGBA{v, v, v, 255}, nil
+	}
+
+	return color.NRGBA{}, fmt.Errorf("unsupported aco color space: %d", space)
+}
+
+func acoDecode(data []byte) (*PaletteFile, error) {
+	r := bytes.NewReader(data)
+
+	var header [2]uint16
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || header[0] != 1 {
+		return nil, fmt.Errorf("invalid aco header")
+	}
+
+	p := &PaletteFile{Colors: make([]PaletteColor, 0, header[1])}
+	for range header[1] {
+		var entry [5]uint16
+		if err := binary.Read(r, binary.BigEndian, &entry); err != nil {
+			return nil, fmt.Errorf("aco file is truncated")
+		}
+
+		c, err := acoColor(entry[0], entry[1], entry[2], entry[3], entry[4])
+		if err != nil {
+			return nil, err
+		}
+		p.Colors = append(p.Colors, PaletteColor{Color: c})
+	}
+
+	// version 2 repeats the colors with names.
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || header[0] != 2 {
+		return p, nil
+	}
+
+	named := make([]PaletteColor, 0, header[1])
+	for range header[1] {
+		var entry [5]uint16
+		if err := binary.Read(r, binary.BigEndian, &entry); err != nil {
+			return nil, fmt.Errorf("aco file is truncated")
+		}
+		c, err := acoColor(entry[0], entry[1], entry[2], entry[3], entry[4])
+		if err != nil {
+			return nil, err
+		}
+
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || int(length)*2 > r.Len() {
+			return nil, fmt.Errorf("aco file is truncated")
+		}
+		name := make([]uint16, length)
+		binary.Read(r, binary.BigEndian, name)
+
+		named = append(named, PaletteColor{Color: c, Name: utf16String(name)})
+	}
+
+	p.Colors = named
+	return p, nil
+}
+
+// utf16String decodes a string, stopping at the null terminator.
+func utf16String(s []uint16) string {
+	for i, v := range s {
+		if v == 0 {
+			s = s[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(s))
+}
+
+func utf16Null(s string) []uint16 {
+	return append(utf16.Encode([]rune(s)), 0)
+}
+
+// acoEncode writes both the version 1 and named version 2 sections, alpha is discarded.
+func acoEncode(w io.Writer, p *PaletteFile) error {
+	if len(p.Colors) > math.MaxUint16 {
+		return fmt.Errorf("too many colors for aco: %d", len(p.Colors))
+	}
+
+	b := &bytes.Buffer{}
+	rgb := func(c color.NRGBA) []uint16 {
+		return []uint16{acoSpaceRGB, uint16(c.R) * 257, uint16(c.G) * 257, uint16(c.B) * 257, 0}
+	}
+
+	binary.Write(b, binary.BigEndian, []uint16{1, uint16(len(p.Colors))})
+	for _, c := range p.Colors {
+		binary.Write(b, binary.BigEndian, rgb(c.Color))
+	}
+
+	binary.Write(b, binary.BigEndian, []uint16{2, uint16(len(p.Colors))})
+	for _, c := range p.Colors {
+		binary.Write(b, binary.BigEndian, rgb(c.Color))
+		name := utf16Null(c.Name)
+		binary.Write(b, binary.BigEndian, uint32(len(name)))
+		binary.Write(b, binary.BigEndian, name)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+const (
+	aseSwatchGroupStart = 0xC001
+	aseSwatchGroupEnd   = 0xC002
+	aseSwatchColor      = 0x0001
+)
+
+// aseSwatchDecode reads an Adobe Swatch Exchange file, groups are flattened.
+func aseSwatchDecode(data []byte) (*PaletteFile, error) {
+	if len(data) < 12 || string(data[:4]) != "ASEF" {
+		return nil, fmt.Errorf("invalid ase header")
+	}
+
+	count := binary.BigEndian.Uint32(data[8:])
+	data = data[12:]
+	p := &PaletteFile{}
+
+	for range count {
+		if len(data) < 6 {
+			return nil, fmt.Errorf("ase file is truncated")
+		}
+		typ := binary.BigEndian.Uint16(data)
+		length := binary.BigEndian.Uint32(data[2:])
+		if uint32(len(data)-6) < length {
+			return nil, fmt.Errorf("ase file is truncated")
+		}
+		block := data[6 : 6+length]
+		data = data[6+length:]
+
+		if typ != aseSwatchColor {
+			continue
+		}
+
+		if len(block) < 2 {
+			return nil, fmt.Errorf("ase color block is truncated")
+		}
+		nameLength := int(binary.BigEndian.Uint16(block))
+		if len(block) < 2+nameLength*2+4 {
+			return nil, fmt.Errorf("ase color block is truncated")
+		}
+		name := make([]uint16, nameLength)
+		for i := range name {
+			name[i] = binary.BigEndian.Uint16(block[2+i*2:])
+		}
+		block = block[2+nameLength*2:]
+
+		model := string(block[:4])
+		block = block[4:]
+
+		values := make([]float64, len(block)/4)
+		for i := range values {
+			values[i] = float64(math.Float32frombits(binary.BigEndian.Uint32(block[i*4:])))
+		}
+
+		need := map[string]int{"RGB ": 3, "CMYK": 4, "LAB ": 3, "Gray": 1}[model]
+		if need == 0 {
+			return nil, fmt.Errorf("unsupported ase color model: %q", model)
+		}
+		if len(values) < need {
+			return nil, fmt.Errorf("ase color block is truncated")
+		}
+
+		channel := func(v float64) uint8 {
+			return uint8(math.Round(min(max(v, 0), 1) * 255))
+		}
+
+		var c color.NRGBA
+		switch model {
+		case "RGB ":
+			c = color.NRGBA{channel(values[0]), channel(values[1]), channel(values[2]), 255}
+		case "CMYK":
+			k := values[3]
+			c = color.NRGBA{channel((1 - values[0]) * (1 - k)), channel((1 - values[1]) * (1 - k)), channel((1 - values[2]) * (1 - k)), 255}
+		case "LAB ":
+			c = labD50ToColor(values[0]*100, values[1], values[2])
+		case "Gray":
+			c = color.NRGBA{channel(values[0]), channel(values[0]), channel(values[0]), 255}
+		}
+
+		p.Colors = append(p.Colors, PaletteColor{Color: c, Name: utf16String(name)})
+	}
+
+	return p, nil
+}
+
+// aseSwatchEncode writes each color as a global RGB swatch, alpha is discarded.
+func aseSwatchEncode(w io.Writer, p *PaletteFile) error {
+	b := &bytes.Buffer{}
+	b.WriteString("ASEF")
+	binary.Write(b, binary.BigEndian, []uint16{1, 0})
+	binary.Write(b, binary.BigEndian, uint32(len(p.Colors)))
+
+	for _, c := range p.Colors {
+		name := utf16Null(c.Name)
+
+		block := &bytes.Buffer{}
+		binary.Write(block, binary.BigEndian, uint16(len(name)))
+		binary.Write(block, binary.BigEndian, name)
+		block.WriteString("RGB ")
+		binary.Write(block, binary.BigEndian, []float32{
+			float32(c.Color.R) / 255,
+			float32(c.Color.G) / 255,
+			float32(c.Color.B) / 255,
+		})
+		// 2 is a normal color, rather than global or spot.
+		binary.Write(block, binary.BigEndian, uint16(2))
+
+		binary.Write(b, binary.BigEndian, uint16(aseSwatchColor))
+		binary.Write(b, binary.BigEndian, uint32(block.Len()))
+		b.Write(block.Bytes())
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// pngSwatchDecode reads the first row of the image, repeated neighbouring pixels are read as one color
+// so swatches that are wider than a pixel are supported.
+func pngSwatchDecode(data []byte) (*PaletteFile, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	src := imageNRGBA(img)
+	p := &PaletteFile{}
+
+	for x := range src.Rect.Dx() {
+		c := src.NRGBAAt(x, 0)
+		if len(p.Colors) > 0 && p.Colors[len(p.Colors)-1].Color == c {
+			continue
+		}
+		p.Colors = append(p.Colors, PaletteColor{Color: c})
+	}
+
+	return p, nil
+}
+
+// pngSwatchEncode writes a 1 pixel high image with a pixel for each color.
+func pngSwatchEncode(w io.Writer, p *PaletteFile) error {
+	if len(p.Colors) == 0 {
+		return fmt.Errorf("cannot write an empty palette as a png")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, len(p.Colors), 1))
+	for x, c := range p.Colors {
+		img.SetNRGBA(x, 0, c.Color)
+	}
+
+	return png.Encode(w, img)
+}
+
+// labD50ToColor converts CIELAB with a D50 white point, as used by Adobe, to sRGB.
+func labD50ToColor(l, a, b float64) color.NRGBA {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+
+	x := 0.96422 * finv(fx)
+	y := finv(fy)
+	z := 0.82521 * finv(fz)
+
+	// Bradford adapted D50 XYZ to linear sRGB.
+	r := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	g := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	bl := 0.0719453*x - 0.2289914*y + 1.4052427*z
+
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(min(max(LinearToSRGB(min(max(v, 0), 1)), 0), 1) * 255))
+	}
+
+	return color.NRGBA{channel(r), channel(g), channel(bl), 255}
+}
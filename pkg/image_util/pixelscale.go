@@ -0,0 +1,535 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// PixelScaler is an upscaling algorithm designed for pixel art,
+// unlike the generic resamplers these don't blur hard edges.
+// The hq2x, hq3x and hq4x lookup table scalers are not implemented.
+type PixelScaler int
+
+const (
+	// PIXELSCALER_NEAREST repeats each pixel, it supports any integer factor.
+	PIXELSCALER_NEAREST PixelScaler = iota
+	// PIXELSCALER_EPX is Scale2x/Scale3x, Scale4x is Scale2x applied twice.
+	PIXELSCALER_EPX
+	// PIXELSCALER_CORNERBLEND is a simplified scaler inspired by hqx, it is not hq2x, hq3x or hq4x.
+	// Each corner of a pixel is blended with its two edge neighbours when both differ from it by the hqx YUV thresholds,
+	// then the corners are interpolated across the output block, without the hqx lookup tables.
+	PIXELSCALER_CORNERBLEND
+	// PIXELSCALER_XBR uses the xBR level 2 edge detection rules.
+	// Instead of the fixed blend weights of the reference implementation, each sub pixel is blended by how much
+	// of it is covered by the edge line, so the output approximates xBR and won't match it pixel for pixel.
+	PIXELSCALER_XBR
+)
+
+var PixelScalerList = []PixelScaler{
+	PIXELSCALER_NEAREST,
+	PIXELSCALER_EPX,
+	PIXELSCALER_CORNERBLEND,
+	PIXELSCALER_XBR,
+}
+
+// PixelScaleValid returns an error when the factor is not supported by the scaler.
+func PixelScaleValid(scaler PixelScaler, factor int) error {
+	switch scaler {
+	case PIXELSCALER_NEAREST:
+		if factor < 1 {
+			return fmt.Errorf("nearest scale factor must be at least 1, got: %d", factor)
+		}
+	case PIXELSCALER_EPX, PIXELSCALER_CORNERBLEND, PIXELSCALER_XBR:
+		if factor < 2 || factor > 4 {
+			return fmt.Errorf("pixel scale factor must be 2, 3 or 4, got: %d", factor)
+		}
+	default:
+		return fmt.Errorf("invalid pixel scaler: %d", scaler)
+	}
+
+	return nil
+}
+
+// PixelScale upscales the image by an integer factor,
+// the result is always NRGBA so it can be converted back to the source color model.
+func PixelScale(img image.Image, scaler PixelScaler, factor int) (*image.NRGBA, error) {
+	if err := PixelScaleValid(scaler, factor); err != nil {
+		return nil, err
+	}
+
+	src := newPixelGrid(imageNRGBA(img))
+
+	switch scaler {
+	case PIXELSCALER_EPX:
+		if factor == 4 {
+			return scaleEPX(newPixelGrid(scaleEPX(src, 2)), 2), nil
+		}
+		return scaleEPX(src, factor), nil
+	case PIXELSCALER_CORNERBLEND:
+		return scaleCornerBlend(src, factor), nil
+	case PIXELSCALER_XBR:
+		return scaleXBR(src, factor), nil
+	}
+
+	return scaleNearest(src, factor), nil
+}
+
+// pixelGrid holds the source pixels with every fully transparent pixel cleared,
+// so they compare as equal no matter what color they hold.
+type pixelGrid struct {
+	width  int
+	height int
+	pix    []color.NRGBA
+}
+
+func newPixelGrid(img *image.NRGBA) *pixelGrid {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	g := &pixelGrid{width: w, height: h, pix: make([]color.NRGBA, w*h)}
+
+	for i := range g.pix {
+		p := img.Pix[i*4 : i*4+4 : i*4+4]
+		if p[3] == 0 {
+			continue
+		}
+		g.pix[i] = color.NRGBA{p[0], p[1], p[2], p[3]}
+	}
+
+	return g
+}
+
+// at returns the pixel at x,y with the edges extended outwards.
+func (g *pixelGrid) at(x, y int) color.NRGBA {
+	x = min(max(x, 0), g.width-1)
+	y = min(max(y, 0), g.height-1)
+	return g.pix[y*g.width+x]
+}
+
+func (g *pixelGrid) output(factor int) *image.NRGBA {
+	return image.NewNRGBA(image.Rect(0, 0, g.width*factor, g.height*factor))
+}
+
+func pixelSet(img *image.NRGBA, x, y int, c color.NRGBA) {
+	i := img.PixOffset(x, y)
+	s := img.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = c.R, c.G, c.B, c.A
+}
+
+func scaleNearest(g *pixelGrid, factor int) *image.NRGBA {
+	out := g.output(factor)
+
+	for y := range g.height {
+		for x := range g.width {
+			c := g.pix[y*g.width+x]
+			for sy := range factor {
+				for sx := range factor {
+					pixelSet(out, x*factor+sx, y*factor+sy, c)
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+func scaleEPX(g *pixelGrid, factor int) *image.NRGBA {
+	out := g.output(factor)
+	block := make([]color.NRGBA, factor*factor)
+
+	for y := range g.height {
+		for x := range g.width {
+			a, b, c := g.at(x-1, y-1), g.at(x, y-1), g.at(x+1, y-1)
+			d, e, f := g.at(x-1, y), g.at(x, y), g.at(x+1, y)
+			gg, h, i := g.at(x-1, y+1), g.at(x, y+1), g.at(x+1, y+1)
+
+			for n := range block {
+				block[n] = e
+			}
+
+			if b != h && d != f {
+				if factor == 2 {
+					if d == b {
+						block[0] = d
+					}
+					if b == f {
+						block[1] = f
+					}
+					if d == h {
+						block[2] = d
+					}
+					if h == f {
+						block[3] = f
+					}
+				} else {
+					if d == b {
+						block[0] = d
+					}
+					if (d == b && e != c) || (b == f && e != a) {
+						block[1] = b
+					}
+					if b == f {
+						block[2] = f
+					}
+					if (d == b && e != gg) || (d == h && e != a) {
+						block[3] = d
+					}
+					if (b == f && e != i) || (h == f && e != c) {
+						block[5] = f
+					}
+					if d == h {
+						block[6] = d
+					}
+					if (d == h && e != i) || (h == f && e != gg) {
+						block[7] = h
+					}
+					if h == f {
+						block[8] = f
+					}
+				}
+			}
+
+			for sy := range factor {
+				for sx := range factor {
+					pixelSet(out, x*factor+sx, y*factor+sy, block[sy*factor+sx])
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// pixelYUV is a pixel converted to YUV for comparisons, alpha is kept as is.
+type pixelYUV struct {
+	y, u, v, a float64
+}
+
+func newPixelYUV(c color.NRGBA) pixelYUV {
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	return pixelYUV{
+		y: 0.299*r + 0.587*g + 0.114*b,
+		u: -0.169*r - 0.331*g + 0.5*b,
+		v: 0.5*r - 0.419*g - 0.081*b,
+		a: float64(c.A),
+	}
+}
+
+func (g *pixelGrid) yuv() []pixelYUV {
+	yuv := make([]pixelYUV, len(g.pix))
+	for i, c := range g.pix {
+		yuv[i] = newPixelYUV(c)
+	}
+	return yuv
+}
+
+func yuvAt(yuv []pixelYUV, g *pixelGrid, x, y int) pixelYUV {
+	x = min(max(x, 0), g.width-1)
+	y = min(max(y, 0), g.height-1)
+	return yuv[y*g.width+x]
+}
+
+// pixelMix blends colors with premultiplied alpha, so transparent pixels don't bleed their color.
+type pixelMix struct {
+	r, g, b, a, w float64
+}
+
+func (m *pixelMix) add(c color.NRGBA, w float64) {
+	a := float64(c.A) * w
+	m.r += float64(c.R) * a
+	m.g += float64(c.G) * a
+	m.b += float64(c.B) * a
+	m.a += a
+	m.w += w
+}
+
+func (m *pixelMix) color() color.NRGBA {
+	if m.a == 0 || m.w == 0 {
+		return color.NRGBA{}
+	}
+
+	return color.NRGBA{
+		R: uint8(math.Round(min(m.r/m.a, 255))),
+		G: uint8(math.Round(min(m.g/m.a, 255))),
+		B: uint8(math.Round(min(m.b/m.a, 255))),
+		A: uint8(math.Round(min(m.a/m.w, 255))),
+	}
+}
+
+func pixelBlend(c1, c2 color.NRGBA, t float64) color.NRGBA {
+	if t <= 0 {
+		return c1
+	}
+	if t >= 1 {
+		return c2
+	}
+
+	m := pixelMix{}
+	m.add(c1, 1-t)
+	m.add(c2, t)
+	return m.color()
+}
+
+// hqxDiff uses the thresholds from hqx, with an extra one for alpha.
+func hqxDiff(c1, c2 pixelYUV) bool {
+	if c1.a == 0 && c2.a == 0 {
+		return false
+	}
+
+	return math.Abs(c1.y-c2.y) > 48 ||
+		math.Abs(c1.u-c2.u) > 7 ||
+		math.Abs(c1.v-c2.v) > 6 ||
+		math.Abs(c1.a-c2.a) > 32
+}
+
+// pixelCorners are the offsets of the 4 corners of a pixel, in the order top left, top right, bottom left, bottom right.
+var pixelCorners = [4][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}}
+
+// pixelCornerWeights finds how much each corner of the source pixel affects a sub pixel of the output block.
+// Sub pixels touching a corner take the corner's color, the weight fades out towards the center of the block,
+// and sub pixels between two corners are shared between them.
+func pixelCornerWeights(factor int) [][4]float64 {
+	weights := make([][4]float64, factor*factor)
+
+	for sy := range factor {
+		for sx := range factor {
+			u := (float64(sx) + 0.5) / float64(factor)
+			v := (float64(sy) + 0.5) / float64(factor)
+
+			w := [4]float64{}
+			total := 0.0
+			for k, c := range pixelCorners {
+				cu := float64(c[0]+1) / 2
+				cv := float64(c[1]+1) / 2
+				dist := math.Abs(u-cu) + math.Abs(v-cv)
+				w[k] = min(max(1-(dist-0.5)*4, 0), 1)
+				total += w[k]
+			}
+
+			if total > 1 {
+				for k := range w {
+					w[k] /= total
+				}
+			}
+
+			weights[sy*factor+sx] = w
+		}
+	}
+
+	return weights
+}
+
+func scaleCornerBlend(g *pixelGrid, factor int) *image.NRGBA {
+	out := g.output(factor)
+	yuv := g.yuv()
+	weights := pixelCornerWeights(factor)
+
+	for y := range g.height {
+		for x := range g.width {
+			e := g.pix[y*g.width+x]
+			ey := yuv[y*g.width+x]
+
+			corners := [4]color.NRGBA{}
+			for k, c := range pixelCorners {
+				// the two edge neighbours of the corner.
+				n1, n1y := g.at(x, y+c[1]), yuvAt(yuv, g, x, y+c[1])
+				n2, n2y := g.at(x+c[0], y), yuvAt(yuv, g, x+c[0], y)
+
+				diff1 := hqxDiff(ey, n1y)
+				diff2 := hqxDiff(ey, n2y)
+
+				m := pixelMix{}
+				switch {
+				case diff1 && diff2 && !hqxDiff(n1y, n2y):
+					// an edge crosses the corner.
+					m.add(e, 2)
+					m.add(n1, 3)
+					m.add(n2, 3)
+				case diff1 && diff2:
+					m.add(e, 2)
+					m.add(n1, 1)
+					m.add(n2, 1)
+				default:
+					// straight edges and lone diagonal pixels are kept sharp.
+					m.add(e, 1)
+				}
+				corners[k] = m.color()
+			}
+
+			for sy := range factor {
+				for sx := range factor {
+					w := weights[sy*factor+sx]
+					m := pixelMix{}
+					m.add(e, max(1-w[0]-w[1]-w[2]-w[3], 0))
+					for k := range corners {
+						if w[k] > 0 {
+							m.add(corners[k], w[k])
+						}
+					}
+					pixelSet(out, x*factor+sx, y*factor+sy, m.color())
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+func xbrDist(c1, c2 pixelYUV) float64 {
+	return 48*math.Abs(c1.y-c2.y) + 7*math.Abs(c1.u-c2.u) + 6*math.Abs(c1.v-c2.v) + 48*math.Abs(c1.a-c2.a)
+}
+
+// xbrSamples is how many samples are taken along each axis of a sub pixel,
+// to find how much of it is covered by the edge.
+const xbrSamples = 4
+
+type xbrEdge int
+
+const (
+	xbrEdgeNone xbrEdge = iota
+	xbrEdgeNormal
+	xbrEdgeShallow
+	xbrEdgeSteep
+	xbrEdgeBoth
+)
+
+// xbrCoverage returns how much of each sub pixel is past the edge line,
+// in the local space of the bottom right corner.
+func xbrCoverage(factor int, edge xbrEdge) []float64 {
+	cover := make([]float64, factor*factor)
+	step := 1 / float64(factor*xbrSamples)
+
+	for sy := range factor {
+		for sx := range factor {
+			hits := 0.0
+			for py := range xbrSamples {
+				for px := range xbrSamples {
+					u := (float64(sx*xbrSamples+px) + 0.5) * step
+					v := (float64(sy*xbrSamples+py) + 0.5) * step
+					hits += xbrInside(edge, u, v)
+				}
+			}
+			cover[sy*factor+sx] = hits / (xbrSamples * xbrSamples)
+		}
+	}
+
+	return cover
+}
+
+// xbrInside returns 1 when the point is past the edge line, and 0.5 when it is on the line.
+func xbrInside(edge xbrEdge, u, v float64) float64 {
+	side := func(d float64) float64 {
+		if math.Abs(d) < 1e-9 {
+			return 0.5
+		}
+		if d > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	switch edge {
+	case xbrEdgeNormal:
+		return side(u + v - 1.5)
+	case xbrEdgeShallow:
+		return side(u + 2*v - 2)
+	case xbrEdgeSteep:
+		return side(2*u + v - 2)
+	case xbrEdgeBoth:
+		return max(side(u+2*v-2), side(2*u+v-2))
+	}
+
+	return 0
+}
+
+func scaleXBR(g *pixelGrid, factor int) *image.NRGBA {
+	out := g.output(factor)
+	yuv := g.yuv()
+
+	coverage := [][]float64{nil}
+	for edge := xbrEdgeNormal; edge <= xbrEdgeBoth; edge++ {
+		coverage = append(coverage, xbrCoverage(factor, edge))
+	}
+
+	block := make([]color.NRGBA, factor*factor)
+
+	for y := range g.height {
+		for x := range g.width {
+			e := g.pix[y*g.width+x]
+			for n := range block {
+				block[n] = e
+			}
+
+			for _, c := range pixelCorners {
+				dx, dy := c[0], c[1]
+				// p returns the neighbour rotated so the corner being checked is always the bottom right.
+				p := func(ox, oy int) pixelYUV {
+					return yuvAt(yuv, g, x+ox*dx, y+oy*dy)
+				}
+
+				ey := p(0, 0)
+				b, cc, d := p(0, -1), p(1, -1), p(-1, 0)
+				f, gg, h, i := p(1, 0), p(-1, 1), p(0, 1), p(1, 1)
+				f4, h5, i4, i5 := p(2, 0), p(0, 2), p(2, 1), p(1, 2)
+
+				if ey == f || ey == h {
+					continue
+				}
+
+				wEdge := xbrDist(ey, cc) + xbrDist(ey, gg) + xbrDist(i, f4) + xbrDist(i, h5) + 4*xbrDist(h, f)
+				wCross := xbrDist(h, d) + xbrDist(h, i5) + xbrDist(f, i4) + xbrDist(f, b) + 4*xbrDist(ey, i)
+				if wEdge >= wCross {
+					continue
+				}
+
+				fc, hc := g.at(x+dx, y), g.at(x, y+dy)
+				px := fc
+				if xbrDist(ey, f) > xbrDist(ey, h) {
+					px = hc
+				}
+
+				ke := xbrDist(f, gg)
+				ki := xbrDist(h, cc)
+				shallow := ke*2 <= ki && ey != gg && d != gg
+				steep := ki*2 <= ke && ey != cc && b != cc
+
+				edge := xbrEdgeNormal
+				switch {
+				case shallow && steep:
+					edge = xbrEdgeBoth
+				case shallow:
+					edge = xbrEdgeShallow
+				case steep:
+					edge = xbrEdgeSteep
+				}
+
+				cover := coverage[edge]
+				for sy := range factor {
+					for sx := range factor {
+						// mirror the sub pixel into the bottom right corner's space.
+						lx, ly := sx, sy
+						if dx < 0 {
+							lx = factor - 1 - sx
+						}
+						if dy < 0 {
+							ly = factor - 1 - sy
+						}
+
+						if t := cover[ly*factor+lx]; t > 0 {
+							n := sy*factor + sx
+							block[n] = pixelBlend(block[n], px, t)
+						}
+					}
+				}
+			}
+
+			for sy := range factor {
+				for sx := range factor {
+					pixelSet(out, x*factor+sx, y*factor+sy, block[sy*factor+sx])
+				}
+			}
+		}
+	}
+
+	return out
+}
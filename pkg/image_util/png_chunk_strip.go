@@ -1,6 +1,7 @@
 package imageutil
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
@@ -18,6 +19,10 @@ const checksumLength = 4
 const dataChunk uint32 = 0x69_73_63_4C // iscL
 const dataKeyLength = 8
 
+// pngChunkMaxLength is the max chunk length allowed by the png spec.
+const pngChunkMaxLength = 1<<31 - 1
+const pngChunkPrealloc = 1 << 16
+
 type PNGDataError string
 
 func (e PNGDataError) Error() string {
@@ -197,19 +202,27 @@ func (r *PNGChunkStripper) Read(p []byte) (int, error) {
 		}
 
 		if data {
-			b := make([]byte, r.chunkLength+8)
+			if r.chunkLength < dataKeyLength+checksumLength {
+				r.err = NewPNGDataErrorf("invalid data chunk length %d", r.chunkLength-checksumLength)
+				r.ErrList = append(r.ErrList, r.err)
+				continue
+			}
+
+			// the buffer grows as the chunk is read, so a crafted length can't allocate more than the data that exists.
+			b := bytes.NewBuffer(make([]byte, 8, 8+min(r.chunkLength, pngChunkPrealloc)))
 
-			binary.BigEndian.PutUint32(b[0:4], r.chunkLength-4)
-			binary.BigEndian.PutUint32(b[4:8], r.chunkType)
+			binary.BigEndian.PutUint32(b.Bytes()[0:4], r.chunkLength-checksumLength)
+			binary.BigEndian.PutUint32(b.Bytes()[4:8], r.chunkType)
 
-			_, err := io.ReadFull(r.Reader, b[8:])
+			_, err := io.CopyN(b, r.Reader, int64(r.chunkLength))
 			if err != nil {
+				err = unexpectedEOF(err)
 				r.err = err
 				r.ErrList = append(r.ErrList, err)
 				continue
 			}
 
-			dc, err := PNGDataChunkRead(b)
+			dc, err := PNGDataChunkRead(b.Bytes())
 			if err != nil {
 				r.err = err
 				r.ErrList = append(r.ErrList, err)
@@ -259,7 +272,14 @@ func (r *PNGChunkStripper) Read(p []byte) (int, error) {
 		}
 
 		if r.magic {
-			r.chunkLength = binary.BigEndian.Uint32(r.buffer[:4]) + checksumLength
+			length := binary.BigEndian.Uint32(r.buffer[:4])
+			if length > pngChunkMaxLength {
+				r.err = NewPNGDataErrorf("invalid chunk length %d", length)
+				r.ErrList = append(r.ErrList, r.err)
+				continue
+			}
+
+			r.chunkLength = length + checksumLength
 			r.chunkType = binary.BigEndian.Uint32(r.buffer[4:])
 
 			if r.chunkType == dataChunk {
@@ -0,0 +1,484 @@
+package imageutil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// pnmHeader covers both the netpbm formats (P1-P6) and PAM (P7).
+type pnmHeader struct {
+	format byte
+	width  int
+	height int
+	depth  int
+	maxval int
+}
+
+type pnmReader struct {
+	r *bufio.Reader
+}
+
+func isPNMSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// token skips whitespace and comments, the single whitespace byte after the token is consumed.
+func (p *pnmReader) token() (string, error) {
+	for {
+		b, err := p.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		if b == '#' {
+			_, err := p.r.ReadString('\n')
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		if isPNMSpace(b) {
+			continue
+		}
+
+		tok := []byte{b}
+		for {
+			b, err := p.r.ReadByte()
+			if err == io.EOF {
+				return string(tok), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			if isPNMSpace(b) {
+				return string(tok), nil
+			}
+			tok = append(tok, b)
+		}
+	}
+}
+
+func (p *pnmReader) int() (int, error) {
+	tok, err := p.token()
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.Atoi(tok)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid pnm value: %s", tok)
+	}
+	return v, nil
+}
+
+func (p *pnmReader) header() (*pnmHeader, error) {
+	magic := make([]byte, 2)
+	_, err := io.ReadFull(p.r, magic)
+	if err != nil {
+		return nil, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return nil, fmt.Errorf("invalid pnm")
+	}
+
+	h := &pnmHeader{format: magic[1]}
+	if h.format == '7' {
+		return h, p.headerPAM(h)
+	}
+
+	if h.width, err = p.int(); err != nil {
+		return nil, err
+	}
+	if h.height, err = p.int(); err != nil {
+		return nil, err
+	}
+
+	switch h.format {
+	case '1', '4':
+		h.depth = 1
+		h.maxval = 1
+	case '2', '5':
+		h.depth = 1
+	case '3', '6':
+		h.depth = 3
+	}
+
+	if h.maxval == 0 {
+		if h.maxval, err = p.int(); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, h.validate()
+}
+
+func (p *pnmReader) headerPAM(h *pnmHeader) error {
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid pam header line: %s", strings.TrimSpace(line))
+		}
+
+		// the depth is enough to decode the standard tuple types.
+		if fields[0] == "TUPLTYPE" {
+			continue
+		}
+
+		v, err := strconv.Atoi(fields[1])
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid pam header value: %s", strings.TrimSpace(line))
+		}
+
+		switch fields[0] {
+		case "WIDTH":
+			h.width = v
+		case "HEIGHT":
+			h.height = v
+		case "DEPTH":
+			h.depth = v
+		case "MAXVAL":
+			h.maxval = v
+		}
+	}
+
+	if h.depth < 1 || h.depth > 4 {
+		return fmt.Errorf("unsupported pam depth: %d", h.depth)
+	}
+
+	return h.validate()
+}
+
+func (h *pnmHeader) validate() error {
+	if h.maxval < 1 || h.maxval > 65535 {
+		return fmt.Errorf("invalid pnm maxval: %d", h.maxval)
+	}
+	// the samples take 2 bytes per channel, and the largest output model takes 8 bytes per pixel.
+	return decodeSizeCheck(h.width, h.height, max(h.depth*2, 8))
+}
+
+func PNMDecodeConfig(r io.Reader) (image.Config, error) {
+	p := &pnmReader{r: bufio.NewReader(r)}
+	h, err := p.header()
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: h.model(),
+		Width:      h.width,
+		Height:     h.height,
+	}, nil
+}
+
+func (h *pnmHeader) model() color.Model {
+	wide := h.maxval > 255
+
+	switch h.depth {
+	case 1:
+		if wide {
+			return color.Gray16Model
+		}
+		return color.GrayModel
+	case 3:
+		if wide {
+			return color.RGBA64Model
+		}
+		return color.RGBAModel
+	}
+
+	if wide {
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel
+}
+
+// PNMDecode decodes PBM, PGM, PPM and PAM in both plain and raw forms.
+// Images with a maxval over 255 are decoded to 16-bit color models.
+func PNMDecode(r io.Reader) (image.Image, error) {
+	p := &pnmReader{r: bufio.NewReader(r)}
+	h, err := p.header()
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := p.samples(h)
+	if err != nil {
+		return nil, err
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	count := h.width * h.height
+
+	// bitmaps store black as 1, the PAM BLACKANDWHITE tuple stores white as 1.
+	if h.format == '1' || h.format == '4' {
+		for i, v := range samples {
+			samples[i] = 1 - v
+		}
+	}
+
+	scale := func(v uint16, to int) uint16 {
+		if h.maxval == to {
+			return v
+		}
+		return uint16((int(v)*to + h.maxval/2) / h.maxval)
+	}
+
+	if h.maxval > 255 {
+		switch h.depth {
+		case 1:
+			img := image.NewGray16(rect)
+			for i := range count {
+				img.SetGray16(i%h.width, i/h.width, color.Gray16{Y: scale(samples[i], 65535)})
+			}
+			return img, nil
+		case 3:
+			img := image.NewRGBA64(rect)
+			for i := range count {
+				s := samples[i*3:]
+				img.SetRGBA64(i%h.width, i/h.width, color.RGBA64{scale(s[0], 65535), scale(s[1], 65535), scale(s[2], 65535), 0xFFFF})
+			}
+			return img, nil
+		}
+
+		img := image.NewNRGBA64(rect)
+		for i := range count {
+			s := samples[i*h.depth:]
+			c := color.NRGBA64{A: 0xFFFF}
+			if h.depth == 2 {
+				c.R, c.G, c.B, c.A = scale(s[0], 65535), scale(s[0], 65535), scale(s[0], 65535), scale(s[1], 65535)
+			} else {
+				c.R, c.G, c.B, c.A = scale(s[0], 65535), scale(s[1], 65535), scale(s[2], 65535), scale(s[3], 65535)
+			}
+			img.SetNRGBA64(i%h.width, i/h.width, c)
+		}
+		return img, nil
+	}
+
+	switch h.depth {
+	case 1:
+		img := image.NewGray(rect)
+		for i := range count {
+			img.Pix[i] = uint8(scale(samples[i], 255))
+		}
+		return img, nil
+	case 3:
+		img := image.NewRGBA(rect)
+		for i := range count {
+			img.Pix[i*4+0] = uint8(scale(samples[i*3+0], 255))
+			img.Pix[i*4+1] = uint8(scale(samples[i*3+1], 255))
+			img.Pix[i*4+2] = uint8(scale(samples[i*3+2], 255))
+			img.Pix[i*4+3] = 255
+		}
+		return img, nil
+	}
+
+	img := image.NewNRGBA(rect)
+	for i := range count {
+		s := samples[i*h.depth:]
+		if h.depth == 2 {
+			g := uint8(scale(s[0], 255))
+			img.Pix[i*4+0], img.Pix[i*4+1], img.Pix[i*4+2] = g, g, g
+			img.Pix[i*4+3] = uint8(scale(s[1], 255))
+		} else {
+			for c := range 4 {
+				img.Pix[i*4+c] = uint8(scale(s[c], 255))
+			}
+		}
+	}
+	return img, nil
+}
+
+func (p *pnmReader) samples(h *pnmHeader) ([]uint16, error) {
+	if h.width == 0 || h.height == 0 {
+		return nil, fmt.Errorf("invalid pnm size: %dx%d", h.width, h.height)
+	}
+
+	samples := make([]uint16, h.width*h.height*h.depth)
+
+	switch h.format {
+	case '1':
+		// plain bitmaps don't need whitespace between the bits.
+		for i := range samples {
+			for {
+				b, err := p.r.ReadByte()
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				if b == '#' {
+					p.r.ReadString('\n')
+					continue
+				}
+				if b == '0' || b == '1' {
+					samples[i] = uint16(b - '0')
+					break
+				}
+				if !isPNMSpace(b) {
+					return nil, fmt.Errorf("invalid pbm value: %c", b)
+				}
+			}
+		}
+	case '2', '3':
+		for i := range samples {
+			v, err := p.int()
+			if err != nil {
+				return nil, err
+			}
+			if v > h.maxval {
+				return nil, fmt.Errorf("pnm value is larger than maxval: %d", v)
+			}
+			samples[i] = uint16(v)
+		}
+	case '4':
+		row := make([]byte, (h.width+7)/8)
+		for y := range h.height {
+			_, err := io.ReadFull(p.r, row)
+			if err != nil {
+				return nil, err
+			}
+			for x := range h.width {
+				samples[y*h.width+x] = uint16(row[x/8]>>(7-x%8)) & 1
+			}
+		}
+	default:
+		size := 1
+		if h.maxval > 255 {
+			size = 2
+		}
+
+		raw := make([]byte, len(samples)*size)
+		_, err := io.ReadFull(p.r, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range samples {
+			if size == 2 {
+				samples[i] = uint16(raw[i*2])<<8 | uint16(raw[i*2+1])
+			} else {
+				samples[i] = uint16(raw[i])
+			}
+			if int(samples[i]) > h.maxval {
+				return nil, fmt.Errorf("pnm value is larger than maxval: %d", samples[i])
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// PNMEncode writes raw PBM, PGM, PPM or PAM depending on the encoding.
+// 16-bit images are written with a maxval of 65535.
+// PBM, PGM and PPM have no alpha channel, so the image is drawn over black.
+func PNMEncode(w io.Writer, img image.Image, encoding ImageEncoding) error {
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+
+	if encoding == ENCODING_PBM {
+		return pbmEncode(bw, img)
+	}
+
+	wide := false
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model, color.Alpha16Model:
+		wide = true
+	}
+
+	maxval := 255
+	if wide {
+		maxval = 65535
+	}
+
+	header := ""
+
+	switch encoding {
+	case ENCODING_PGM:
+		header = fmt.Sprintf("P5\n%d %d\n%d\n", b.Dx(), b.Dy(), maxval)
+	case ENCODING_PPM:
+		header = fmt.Sprintf("P6\n%d %d\n%d\n", b.Dx(), b.Dy(), maxval)
+	case ENCODING_PAM:
+		header = fmt.Sprintf("P7\nWIDTH %d\nHEIGHT %d\nDEPTH 4\nMAXVAL %d\nTUPLTYPE RGB_ALPHA\nENDHDR\n", b.Dx(), b.Dy(), maxval)
+	default:
+		return fmt.Errorf("unsupported pnm encoding: %d", encoding)
+	}
+	bw.WriteString(header)
+
+	sample := func(v uint16) {
+		if wide {
+			bw.WriteByte(byte(v >> 8))
+		}
+		bw.WriteByte(byte(v))
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.At(x, y)
+
+			switch {
+			case encoding == ENCODING_PGM && wide:
+				sample(color.Gray16Model.Convert(c).(color.Gray16).Y)
+			case encoding == ENCODING_PGM:
+				sample(uint16(color.GrayModel.Convert(c).(color.Gray).Y))
+			case encoding == ENCODING_PPM:
+				// RGBA() is already drawn over black.
+				r, g, b, _ := c.RGBA()
+				if !wide {
+					r, g, b = r>>8, g>>8, b>>8
+				}
+				sample(uint16(r))
+				sample(uint16(g))
+				sample(uint16(b))
+			case wide:
+				n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+				sample(n.R)
+				sample(n.G)
+				sample(n.B)
+				sample(n.A)
+			default:
+				n := color.NRGBAModel.Convert(c).(color.NRGBA)
+				sample(uint16(n.R))
+				sample(uint16(n.G))
+				sample(uint16(n.B))
+				sample(uint16(n.A))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// pbmEncode writes a raw bitmap, pixels darker than half gray are black.
+// Each row is packed into bytes starting from the most significant bit, and a set bit is black.
+func pbmEncode(bw *bufio.Writer, img image.Image) error {
+	b := img.Bounds()
+	fmt.Fprintf(bw, "P4\n%d %d\n", b.Dx(), b.Dy())
+
+	row := make([]byte, (b.Dx()+7)/8)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		clear(row)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+				i := x - b.Min.X
+				row[i/8] |= 0x80 >> (i % 8)
+			}
+		}
+		bw.Write(row)
+	}
+
+	return bw.Flush()
+}
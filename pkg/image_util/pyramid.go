@@ -0,0 +1,319 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/gift"
+)
+
+type PyramidOptions struct {
+	Resampling gift.Resampling
+	// GammaCorrect downsamples in linear light, so bright and dark details average to the correct brightness.
+	GammaCorrect bool
+}
+
+func DefaultPyramidOptions() PyramidOptions {
+	return PyramidOptions{
+		Resampling:   gift.LanczosResampling,
+		GammaCorrect: true,
+	}
+}
+
+func (o PyramidOptions) Validate() error {
+	if o.Resampling == nil {
+		return fmt.Errorf("pyramid resampling cannot be nil")
+	}
+
+	return nil
+}
+
+type MipOptions struct {
+	PyramidOptions
+	// Levels is the number of levels including the source, 0 continues until the image is 1x1.
+	Levels int
+}
+
+func DefaultMipOptions() MipOptions {
+	return MipOptions{
+		PyramidOptions: DefaultPyramidOptions(),
+		Levels:         0,
+	}
+}
+
+func (o MipOptions) Validate() error {
+	if o.Levels < 0 {
+		return fmt.Errorf("mip levels cannot be negative, got: %d", o.Levels)
+	}
+
+	return o.PyramidOptions.Validate()
+}
+
+type DZIOptions struct {
+	PyramidOptions
+	// TileSize does not include the overlap, tiles not on an edge are TileSize+Overlap*2 pixels.
+	TileSize int
+	Overlap  int
+	Encoding ImageEncoding
+}
+
+func DefaultDZIOptions() DZIOptions {
+	return DZIOptions{
+		PyramidOptions: DefaultPyramidOptions(),
+		TileSize:       254,
+		Overlap:        1,
+		Encoding:       ENCODING_PNG,
+	}
+}
+
+func (o DZIOptions) Validate() error {
+	if o.TileSize < 1 {
+		return fmt.Errorf("dzi tile size must be positive, got: %d", o.TileSize)
+	}
+	if o.Overlap < 0 {
+		return fmt.Errorf("dzi overlap cannot be negative, got: %d", o.Overlap)
+	}
+
+	return o.PyramidOptions.Validate()
+}
+
+type XYZOptions struct {
+	PyramidOptions
+	TileSize int
+	Encoding ImageEncoding
+}
+
+func DefaultXYZOptions() XYZOptions {
+	return XYZOptions{
+		PyramidOptions: DefaultPyramidOptions(),
+		TileSize:       256,
+		Encoding:       ENCODING_PNG,
+	}
+}
+
+func (o XYZOptions) Validate() error {
+	if o.TileSize < 1 {
+		return fmt.Errorf("xyz tile size must be positive, got: %d", o.TileSize)
+	}
+
+	return o.PyramidOptions.Validate()
+}
+
+// MipChain returns the source followed by each level at half the size of the previous, rounding up.
+func MipChain(img image.Image, opts MipOptions) ([]*image.NRGBA, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	levels := pyramidDepth(max(b.Dx(), b.Dy())) + 1
+	if opts.Levels > 0 {
+		levels = min(levels, opts.Levels)
+	}
+
+	chain := make([]*image.NRGBA, 0, levels)
+	err := pyramidWalk(img, levels, opts.PyramidOptions, func(_ int, level *image.NRGBA) error {
+		chain = append(chain, level)
+		return nil
+	})
+
+	return chain, err
+}
+
+// DZIWrite writes a Deep Zoom image to dir, as name.dzi and the tiles in name_files/level/col_row.
+// Only the current level is kept in memory, and each tile is written as soon as it is cut.
+func DZIWrite(img image.Image, dir, name string, opts DZIOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("cannot tile an empty image")
+	}
+
+	maxLevel := pyramidDepth(max(b.Dx(), b.Dy()))
+	files := path.Join(dir, name+"_files")
+	ext := EncodingExtension(opts.Encoding)
+
+	err := pyramidWalk(img, maxLevel+1, opts.PyramidOptions, func(i int, level *image.NRGBA) error {
+		levelDir := path.Join(files, strconv.Itoa(maxLevel-i))
+		if err := os.MkdirAll(levelDir, 0o777); err != nil {
+			return err
+		}
+
+		lb := level.Bounds()
+		for row := 0; row*opts.TileSize < lb.Dy(); row++ {
+			for col := 0; col*opts.TileSize < lb.Dx(); col++ {
+				rect := image.Rect(
+					col*opts.TileSize-opts.Overlap, row*opts.TileSize-opts.Overlap,
+					(col+1)*opts.TileSize+opts.Overlap, (row+1)*opts.TileSize+opts.Overlap,
+				).Intersect(lb)
+
+				tile := level.SubImage(rect)
+				if err := pyramidTileWrite(path.Join(levelDir, fmt.Sprintf("%d_%d%s", col, row, ext)), tile, opts.Encoding); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dzi := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="%s" Overlap="%d" TileSize="%d">
+	<Size Width="%d" Height="%d"/>
+</Image>
+`, strings.TrimPrefix(ext, "."), opts.Overlap, opts.TileSize, b.Dx(), b.Dy())
+
+	return os.WriteFile(path.Join(dir, name+".dzi"), []byte(dzi), 0o666)
+}
+
+// XYZWrite writes slippy map tiles to dir as z/x/y.
+// The image is placed at the top left of the map, with zoom 0 fitting the whole image in a single tile.
+// Tiles are always TileSize, partial tiles are padded with transparency and tiles outside the image are skipped.
+func XYZWrite(img image.Image, dir string, opts XYZOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("cannot tile an empty image")
+	}
+
+	maxZoom := pyramidDepth((max(b.Dx(), b.Dy()) + opts.TileSize - 1) / opts.TileSize)
+	ext := EncodingExtension(opts.Encoding)
+
+	return pyramidWalk(img, maxZoom+1, opts.PyramidOptions, func(i int, level *image.NRGBA) error {
+		zoomDir := path.Join(dir, strconv.Itoa(maxZoom-i))
+
+		lb := level.Bounds()
+		for x := 0; x*opts.TileSize < lb.Dx(); x++ {
+			colDir := path.Join(zoomDir, strconv.Itoa(x))
+			if err := os.MkdirAll(colDir, 0o777); err != nil {
+				return err
+			}
+
+			for y := 0; y*opts.TileSize < lb.Dy(); y++ {
+				rect := image.Rect(x*opts.TileSize, y*opts.TileSize, (x+1)*opts.TileSize, (y+1)*opts.TileSize)
+
+				tile := image.NewNRGBA(image.Rect(0, 0, opts.TileSize, opts.TileSize))
+				draw.Draw(tile, tile.Rect, level, rect.Min, draw.Src)
+
+				if err := pyramidTileWrite(path.Join(colDir, strconv.Itoa(y)+ext), tile, opts.Encoding); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func pyramidTileWrite(pth string, tile image.Image, encoding ImageEncoding) error {
+	f, err := os.OpenFile(pth, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return Encode(f, tile, encoding, nil)
+}
+
+// pyramidDepth is the number of times size can be halved, rounding up, before reaching 1.
+func pyramidDepth(size int) int {
+	depth := 0
+	for size > 1 {
+		size = (size + 1) / 2
+		depth++
+	}
+	return depth
+}
+
+// pyramidWalk calls fn with each level, starting at the source, until levels have been visited.
+// Each level is resampled from the previous one, at 16 bits per channel to avoid banding down the chain.
+func pyramidWalk(img image.Image, levels int, opts PyramidOptions, fn func(i int, level *image.NRGBA) error) error {
+	b := img.Bounds()
+
+	current := image.NewNRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(current, current.Rect, img, b.Min, draw.Src)
+	if opts.GammaCorrect {
+		pyramidLinearize(current)
+	}
+
+	for i := range levels {
+		if i > 0 {
+			w := (b.Dx() + (1 << i) - 1) >> i
+			h := (b.Dy() + (1 << i) - 1) >> i
+
+			next := image.NewNRGBA64(image.Rect(0, 0, w, h))
+			gift.New(gift.Resize(w, h, opts.Resampling)).Draw(next, current)
+			current = next
+		}
+
+		if err := fn(i, pyramidOutput(current, opts.GammaCorrect)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	pyramidTableOnce   sync.Once
+	pyramidLinearTable []uint16
+	pyramidSRGBTable   []uint8
+)
+
+func pyramidTables() {
+	pyramidTableOnce.Do(func() {
+		pyramidLinearTable = make([]uint16, 0x10000)
+		pyramidSRGBTable = make([]uint8, 0x10000)
+
+		for i := range 0x10000 {
+			v := float64(i) / 0xffff
+			pyramidLinearTable[i] = uint16(math.Round(SRGBToLinear(v) * 0xffff))
+			pyramidSRGBTable[i] = uint8(math.Round(LinearToSRGB(v) * 0xff))
+		}
+	})
+}
+
+func pyramidLinearize(img *image.NRGBA64) {
+	pyramidTables()
+
+	for i := 0; i < len(img.Pix); i += 8 {
+		for c := 0; c < 6; c += 2 {
+			v := pyramidLinearTable[uint16(img.Pix[i+c])<<8|uint16(img.Pix[i+c+1])]
+			img.Pix[i+c] = uint8(v >> 8)
+			img.Pix[i+c+1] = uint8(v)
+		}
+	}
+}
+
+// pyramidOutput converts a level back to 8 bits per channel, and back to srgb when it was linearized.
+func pyramidOutput(img *image.NRGBA64, linear bool) *image.NRGBA {
+	out := image.NewNRGBA(img.Rect)
+	for i, j := 0, 0; i < len(img.Pix); i, j = i+8, j+4 {
+		for c := range 4 {
+			v := uint16(img.Pix[i+c*2])<<8 | uint16(img.Pix[i+c*2+1])
+			if linear && c < 3 {
+				out.Pix[j+c] = pyramidSRGBTable[v]
+			} else {
+				out.Pix[j+c] = uint8((uint32(v)*0xff + 0x7fff) / 0xffff)
+			}
+		}
+	}
+
+	return out
+}
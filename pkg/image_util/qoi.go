@@ -0,0 +1,208 @@
+package imageutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+const qoiMagic = "qoif"
+
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xC0
+	qoiOpRGB   = 0xFE
+	qoiOpRGBA  = 0xFF
+
+	qoiMask = 0xC0
+)
+
+const qoiHeaderSize = 14
+
+var qoiEnd = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+func qoiHash(c color.NRGBA) int {
+	return (int(c.R)*3 + int(c.G)*5 + int(c.B)*7 + int(c.A)*11) % 64
+}
+
+func QOIDecodeConfig(r io.Reader) (image.Config, error) {
+	header := make([]byte, qoiHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	if string(header[0:4]) != qoiMagic {
+		return image.Config{}, fmt.Errorf("invalid qoi")
+	}
+
+	width := int(binary.BigEndian.Uint32(header[4:8]))
+	height := int(binary.BigEndian.Uint32(header[8:12]))
+	if err := decodeSizeCheck(width, height, 4); err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      width,
+		Height:     height,
+	}, nil
+}
+
+func QOIDecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	cfg, err := QOIDecodeConfig(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+
+	index := [64]color.NRGBA{}
+	px := color.NRGBA{0, 0, 0, 255}
+	run := 0
+
+	for p := 0; p < len(img.Pix); p += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			switch {
+			case b == qoiOpRGB:
+				var rgb [3]byte
+				if _, err := io.ReadFull(br, rgb[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px.R, px.G, px.B = rgb[0], rgb[1], rgb[2]
+			case b == qoiOpRGBA:
+				var rgba [4]byte
+				if _, err := io.ReadFull(br, rgba[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px = color.NRGBA{rgba[0], rgba[1], rgba[2], rgba[3]}
+			case b&qoiMask == qoiOpIndex:
+				px = index[b]
+			case b&qoiMask == qoiOpDiff:
+				px.R += (b>>4)&0x03 - 2
+				px.G += (b>>2)&0x03 - 2
+				px.B += b&0x03 - 2
+			case b&qoiMask == qoiOpLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				dg := b&0x3F - 32
+				px.R += dg - 8 + (b2>>4)&0x0F
+				px.G += dg
+				px.B += dg - 8 + b2&0x0F
+			case b&qoiMask == qoiOpRun:
+				run = int(b & 0x3F)
+			}
+
+			index[qoiHash(px)] = px
+		}
+
+		img.Pix[p+0] = px.R
+		img.Pix[p+1] = px.G
+		img.Pix[p+2] = px.B
+		img.Pix[p+3] = px.A
+	}
+
+	return img, nil
+}
+
+// unexpectedEOF is used by decoders reading byte by byte, where EOF always means the data is truncated.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// QOIEncode writes 3 channels when the image is opaque, otherwise 4.
+func QOIEncode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	n := imageNRGBA(img)
+
+	channels := byte(4)
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		channels = 3
+	}
+
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, qoiHeaderSize)
+	copy(header, qoiMagic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(header[8:12], uint32(b.Dy()))
+	header[12] = channels
+	header[13] = 0 // sRGB with linear alpha
+	bw.Write(header)
+
+	index := [64]color.NRGBA{}
+	prev := color.NRGBA{0, 0, 0, 255}
+	run := 0
+	last := len(n.Pix) - 4
+
+	for p := 0; p < len(n.Pix); p += 4 {
+		px := color.NRGBA{n.Pix[p], n.Pix[p+1], n.Pix[p+2], n.Pix[p+3]}
+
+		if px == prev {
+			run++
+			if run == 62 || p == last {
+				bw.WriteByte(qoiOpRun | byte(run-1))
+				run = 0
+			}
+			continue
+		}
+
+		if run > 0 {
+			bw.WriteByte(qoiOpRun | byte(run-1))
+			run = 0
+		}
+
+		hash := qoiHash(px)
+		if index[hash] == px {
+			bw.WriteByte(qoiOpIndex | byte(hash))
+			prev = px
+			continue
+		}
+		index[hash] = px
+
+		if px.A != prev.A {
+			bw.Write([]byte{qoiOpRGBA, px.R, px.G, px.B, px.A})
+			prev = px
+			continue
+		}
+
+		dr := int8(px.R - prev.R)
+		dg := int8(px.G - prev.G)
+		db := int8(px.B - prev.B)
+		drg := dr - dg
+		dbg := db - dg
+
+		switch {
+		case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+			bw.WriteByte(qoiOpDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+		case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+			bw.Write([]byte{qoiOpLuma | byte(dg+32), byte(drg+8)<<4 | byte(dbg+8)})
+		default:
+			bw.Write([]byte{qoiOpRGB, px.R, px.G, px.B})
+		}
+
+		prev = px
+	}
+
+	bw.Write(qoiEnd)
+	return bw.Flush()
+}
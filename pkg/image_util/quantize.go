@@ -0,0 +1,638 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/ericpauley/go-quantize/quantize"
+)
+
+type Quantizer int
+
+const (
+	QUANTIZER_MEDIANCUT Quantizer = iota
+	// QUANTIZER_KMEANS starts from the median cut palette and refines it with k-means in OKLab.
+	QUANTIZER_KMEANS
+)
+
+var QuantizerList = []Quantizer{
+	QUANTIZER_MEDIANCUT,
+	QUANTIZER_KMEANS,
+}
+
+type Dither int
+
+const (
+	DITHER_NONE Dither = iota
+	DITHER_FLOYDSTEINBERG
+	DITHER_ATKINSON
+	DITHER_BAYER
+	DITHER_BLUENOISE
+)
+
+var DitherList = []Dither{
+	DITHER_NONE,
+	DITHER_FLOYDSTEINBERG,
+	DITHER_ATKINSON,
+	DITHER_BAYER,
+	DITHER_BLUENOISE,
+}
+
+// quantizeAlphaThreshold is the alpha below which a pixel is treated as transparent.
+const quantizeAlphaThreshold = 128
+
+type DitherOptions struct {
+	Dither Dither
+	// Strength scales the diffused error, or the spread of the ordered dithers.
+	Strength float64
+	// BayerSize is the size of the Bayer matrix, it must be 2, 4 or 8.
+	BayerSize int
+}
+
+func DefaultDitherOptions() *DitherOptions {
+	return &DitherOptions{
+		Dither:    DITHER_NONE,
+		Strength:  1,
+		BayerSize: 4,
+	}
+}
+
+func (o *DitherOptions) Validate() error {
+	if o.Dither < 0 || int(o.Dither) >= len(DitherList) {
+		return fmt.Errorf("invalid dither: %d", o.Dither)
+	}
+	if o.Strength < 0 || o.Strength > 1 {
+		return fmt.Errorf("dither strength must be between 0 and 1, got: %f", o.Strength)
+	}
+	if o.BayerSize != 2 && o.BayerSize != 4 && o.BayerSize != 8 {
+		return fmt.Errorf("bayer size must be 2, 4 or 8, got: %d", o.BayerSize)
+	}
+
+	return nil
+}
+
+// OKLab is a perceptual color space, the euclidean distance between two colors is close to how different they look.
+type OKLab struct {
+	L float64
+	A float64
+	B float64
+}
+
+var srgbLinearTable = func() [256]float64 {
+	t := [256]float64{}
+	for i := range t {
+		t[i] = SRGBToLinear(float64(i) / 255)
+	}
+	return t
+}()
+
+func linearToOKLab(r, g, b float64) OKLab {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return OKLab{
+		L: 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		A: 1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		B: 0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// ColorToOKLab converts an 8-bit sRGB color to OKLab, alpha is ignored.
+func ColorToOKLab(c color.NRGBA) OKLab {
+	return linearToOKLab(srgbLinearTable[c.R], srgbLinearTable[c.G], srgbLinearTable[c.B])
+}
+
+// OKLabToColor converts back to an opaque 8-bit sRGB color, colors outside of sRGB are clamped.
+func OKLabToColor(c OKLab) color.NRGBA {
+	l := c.L + 0.3963377774*c.A + 0.2158037573*c.B
+	m := c.L - 0.1055613458*c.A - 0.0638541728*c.B
+	s := c.L - 0.0894841775*c.A - 1.2914855480*c.B
+
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	r := 4.0767416621*l - 3.3077115913*m + 0.2309699292*s
+	g := -1.2684380046*l + 2.6097574011*m - 0.3413193965*s
+	b := -0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(min(max(LinearToSRGB(min(max(v, 0), 1)), 0), 1) * 255))
+	}
+
+	return color.NRGBA{channel(r), channel(g), channel(b), 255}
+}
+
+// OKLabDistance returns the squared euclidean distance between two colors.
+func OKLabDistance(c1, c2 OKLab) float64 {
+	dl, da, db := c1.L-c2.L, c1.A-c2.A, c1.B-c2.B
+	return dl*dl + da*da + db*db
+}
+
+// QuantizeColors creates a palette of up to size colors that best represents img.
+// When the image has transparent pixels, the first color is transparent and counts towards the size.
+func QuantizeColors(img image.Image, size int, quantizer Quantizer) color.Palette {
+	size = min(max(size, 1), 256)
+	src := imageNRGBA(img)
+
+	transparent := false
+	opaque := image.NewRGBA(src.Rect)
+	for i := 0; i < len(src.Pix); i += 4 {
+		if src.Pix[i+3] < quantizeAlphaThreshold {
+			transparent = true
+			continue
+		}
+		copy(opaque.Pix[i:i+3], src.Pix[i:i+3])
+		opaque.Pix[i+3] = 255
+	}
+
+	colors := size
+	if transparent && size > 1 {
+		colors--
+	}
+
+	q := quantize.MedianCutQuantizer{
+		Aggregation: quantize.Mean,
+		// transparent pixels are left out of the palette.
+		Weighting: func(img image.Image, x, y int) uint32 {
+			return uint32(opaque.Pix[opaque.PixOffset(x, y)+3] / 255)
+		},
+	}
+	pal := q.Quantize(make(color.Palette, 0, colors), opaque)
+
+	if quantizer == QUANTIZER_KMEANS && len(pal) > 1 {
+		pal = quantizeKMeans(src, pal)
+	}
+
+	result := make(color.Palette, 0, size)
+	if transparent && size > 1 {
+		result = append(result, color.NRGBA{})
+	}
+	for _, c := range pal {
+		result = append(result, color.NRGBAModel.Convert(c))
+	}
+
+	if len(result) == 0 {
+		result = append(result, color.NRGBA{})
+	}
+
+	return result
+}
+
+// quantizeKMeansSamples limits how many pixels are used when refining the palette.
+const quantizeKMeansSamples = 1 << 16
+
+func quantizeKMeans(src *image.NRGBA, pal color.Palette) color.Palette {
+	pixels := len(src.Pix) / 4
+	step := max(pixels/quantizeKMeansSamples, 1)
+
+	points := make([]OKLab, 0, min(pixels, quantizeKMeansSamples))
+	for i := 0; i < pixels; i += step {
+		p := src.Pix[i*4 : i*4+4 : i*4+4]
+		if p[3] < quantizeAlphaThreshold {
+			continue
+		}
+		points = append(points, ColorToOKLab(color.NRGBA{p[0], p[1], p[2], 255}))
+	}
+
+	centers := make([]OKLab, len(pal))
+	for i, c := range pal {
+		centers[i] = ColorToOKLab(color.NRGBAModel.Convert(c).(color.NRGBA))
+	}
+
+	assign := make([]int, len(points))
+	sums := make([]OKLab, len(centers))
+	counts := make([]int, len(centers))
+
+	for iter := range 16 {
+		changed := iter == 0
+		for i, p := range points {
+			if best := oklabNearest(centers, p); best != assign[i] {
+				assign[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		clear(sums)
+		clear(counts)
+		for i, p := range points {
+			k := assign[i]
+			sums[k].L += p.L
+			sums[k].A += p.A
+			sums[k].B += p.B
+			counts[k]++
+		}
+
+		for k := range centers {
+			if counts[k] == 0 {
+				continue
+			}
+			n := float64(counts[k])
+			centers[k] = OKLab{sums[k].L / n, sums[k].A / n, sums[k].B / n}
+		}
+	}
+
+	result := make(color.Palette, len(centers))
+	for i, c := range centers {
+		result[i] = OKLabToColor(c)
+	}
+
+	return result
+}
+
+func oklabNearest(colors []OKLab, c OKLab) int {
+	best := 0
+	bestDist := math.Inf(1)
+
+	for i, p := range colors {
+		if d := OKLabDistance(p, c); d < bestDist {
+			best = i
+			bestDist = d
+		}
+	}
+
+	return best
+}
+
+// paletteMatcher finds the closest palette color to a pixel in OKLab,
+// opaque pixels only match opaque colors and transparent pixels match the most transparent color.
+type paletteMatcher struct {
+	colors      []OKLab
+	opaque      []int
+	transparent int
+}
+
+func newPaletteMatcher(pal color.Palette) *paletteMatcher {
+	m := &paletteMatcher{
+		colors:      make([]OKLab, len(pal)),
+		opaque:      []int{},
+		transparent: -1,
+	}
+
+	minAlpha := 256
+	for i, c := range pal {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		m.colors[i] = ColorToOKLab(n)
+
+		if n.A >= quantizeAlphaThreshold {
+			m.opaque = append(m.opaque, i)
+		} else if int(n.A) < minAlpha {
+			minAlpha = int(n.A)
+			m.transparent = i
+		}
+	}
+
+	return m
+}
+
+func (m *paletteMatcher) match(c OKLab) int {
+	if len(m.opaque) == 0 {
+		return oklabNearest(m.colors, c)
+	}
+
+	best := m.opaque[0]
+	bestDist := math.Inf(1)
+	for _, i := range m.opaque {
+		if d := OKLabDistance(m.colors[i], c); d < bestDist {
+			best = i
+			bestDist = d
+		}
+	}
+
+	return best
+}
+
+// spread is the average distance in sRGB between each opaque palette color and its nearest neighbour,
+// used to scale the ordered dithers to the palette.
+func paletteSpread(pal color.Palette, indexes []int) float64 {
+	if len(indexes) < 2 {
+		return 0
+	}
+
+	total := 0.0
+	for _, i := range indexes {
+		c1 := color.NRGBAModel.Convert(pal[i]).(color.NRGBA)
+		nearest := math.Inf(1)
+		for _, j := range indexes {
+			if i == j {
+				continue
+			}
+			c2 := color.NRGBAModel.Convert(pal[j]).(color.NRGBA)
+			dr, dg, db := float64(c1.R)-float64(c2.R), float64(c1.G)-float64(c2.G), float64(c1.B)-float64(c2.B)
+			nearest = min(nearest, math.Sqrt(dr*dr+dg*dg+db*db))
+		}
+		total += nearest
+	}
+
+	return total / float64(len(indexes)) / math.Sqrt(3)
+}
+
+// PaletteApply maps every pixel of img to the closest color in pal using OKLab distance.
+// Pixels with an alpha below 128 use the most transparent color in the palette, if it has one.
+func PaletteApply(img image.Image, pal color.Palette, opts *DitherOptions) *image.Paletted {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewPaletted(image.Rect(0, 0, w, h), ClonePalette(pal))
+
+	if len(pal) == 0 || w == 0 || h == 0 {
+		return out
+	}
+
+	m := newPaletteMatcher(pal)
+
+	switch opts.Dither {
+	case DITHER_FLOYDSTEINBERG, DITHER_ATKINSON:
+		paletteApplyDiffusion(src, out, m, opts)
+	case DITHER_BAYER, DITHER_BLUENOISE:
+		paletteApplyOrdered(src, out, pal, m, opts)
+	default:
+		for y := range h {
+			for x := range w {
+				i := y*src.Stride + x*4
+				p := src.Pix[i : i+4 : i+4]
+				if p[3] < quantizeAlphaThreshold && m.transparent >= 0 {
+					out.Pix[y*out.Stride+x] = uint8(m.transparent)
+					continue
+				}
+				out.Pix[y*out.Stride+x] = uint8(m.match(ColorToOKLab(color.NRGBA{p[0], p[1], p[2], 255})))
+			}
+		}
+	}
+
+	return out
+}
+
+type ditherWeight struct {
+	x, y   int
+	weight float64
+}
+
+var (
+	ditherFloydSteinberg = []ditherWeight{{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16}}
+	ditherAtkinson       = []ditherWeight{{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8}}
+)
+
+// paletteApplyDiffusion spreads the error of each pixel in OKLab, scanning in a serpentine order.
+func paletteApplyDiffusion(src *image.NRGBA, out *image.Paletted, m *paletteMatcher, opts *DitherOptions) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	kernel := ditherFloydSteinberg
+	if opts.Dither == DITHER_ATKINSON {
+		kernel = ditherAtkinson
+	}
+
+	lab := make([]OKLab, w*h)
+	for y := range h {
+		for x := range w {
+			i := y*src.Stride + x*4
+			lab[y*w+x] = ColorToOKLab(color.NRGBA{src.Pix[i], src.Pix[i+1], src.Pix[i+2], 255})
+		}
+	}
+
+	for y := range h {
+		reverse := y%2 == 1
+		for n := range w {
+			x := n
+			if reverse {
+				x = w - 1 - n
+			}
+
+			if src.Pix[y*src.Stride+x*4+3] < quantizeAlphaThreshold && m.transparent >= 0 {
+				out.Pix[y*out.Stride+x] = uint8(m.transparent)
+				continue
+			}
+
+			c := lab[y*w+x]
+			index := m.match(c)
+			out.Pix[y*out.Stride+x] = uint8(index)
+
+			p := m.colors[index]
+			el := (c.L - p.L) * opts.Strength
+			ea := (c.A - p.A) * opts.Strength
+			eb := (c.B - p.B) * opts.Strength
+
+			for _, k := range kernel {
+				kx, ky := x+k.x, y+k.y
+				if reverse {
+					kx = x - k.x
+				}
+				if kx < 0 || kx >= w || ky >= h {
+					continue
+				}
+
+				t := &lab[ky*w+kx]
+				t.L += el * k.weight
+				t.A += ea * k.weight
+				t.B += eb * k.weight
+			}
+		}
+	}
+}
+
+// paletteApplyOrdered offsets each pixel by a threshold map before matching it.
+func paletteApplyOrdered(src *image.NRGBA, out *image.Paletted, pal color.Palette, m *paletteMatcher, opts *DitherOptions) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	var threshold []float64
+	var size int
+	if opts.Dither == DITHER_BAYER {
+		threshold, size = bayerMatrix(opts.BayerSize), opts.BayerSize
+	} else {
+		threshold, size = blueNoise(), blueNoiseSize
+	}
+
+	spread := paletteSpread(pal, m.opaque) * opts.Strength
+
+	for y := range h {
+		for x := range w {
+			i := y*src.Stride + x*4
+			p := src.Pix[i : i+4 : i+4]
+			if p[3] < quantizeAlphaThreshold && m.transparent >= 0 {
+				out.Pix[y*out.Stride+x] = uint8(m.transparent)
+				continue
+			}
+
+			offset := (threshold[(y%size)*size+x%size] - 0.5) * spread
+			channel := func(v uint8) uint8 {
+				return uint8(min(max(math.Round(float64(v)+offset), 0), 255))
+			}
+
+			c := color.NRGBA{channel(p[0]), channel(p[1]), channel(p[2]), 255}
+			out.Pix[y*out.Stride+x] = uint8(m.match(ColorToOKLab(c)))
+		}
+	}
+}
+
+// bayerMatrix returns the normalized threshold map of the given size, which must be a power of two.
+func bayerMatrix(size int) []float64 {
+	m := []int{0}
+	for n := 1; n < size; n *= 2 {
+		next := make([]int, n*n*4)
+		for y := range n {
+			for x := range n {
+				v := m[y*n+x] * 4
+				next[y*n*2+x] = v
+				next[y*n*2+x+n] = v + 2
+				next[(y+n)*n*2+x] = v + 3
+				next[(y+n)*n*2+x+n] = v + 1
+			}
+		}
+		m = next
+	}
+
+	result := make([]float64, len(m))
+	for i, v := range m {
+		result[i] = (float64(v) + 0.5) / float64(len(m))
+	}
+	return result
+}
+
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce  sync.Once
+	blueNoiseTable []float64
+)
+
+// blueNoise returns a tileable blue noise threshold map generated with the void and cluster method,
+// it is created the first time it is needed.
+func blueNoise() []float64 {
+	blueNoiseOnce.Do(func() {
+		blueNoiseTable = blueNoiseGenerate(blueNoiseSize, 1.5)
+	})
+
+	return blueNoiseTable
+}
+
+func blueNoiseGenerate(size int, sigma float64) []float64 {
+	n := size * size
+
+	kernel := make([]float64, n)
+	for y := range size {
+		for x := range size {
+			dx := min(x, size-x)
+			dy := min(y, size-y)
+			kernel[y*size+x] = math.Exp(-float64(dx*dx+dy*dy) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := make([]bool, n)
+	energy := make([]float64, n)
+
+	update := func(i int, add bool) {
+		pattern[i] = add
+		sign := 1.0
+		if !add {
+			sign = -1
+		}
+
+		ix, iy := i%size, i/size
+		for y := range size {
+			ky := ((y - iy + size) % size) * size
+			for x := range size {
+				energy[y*size+x] += sign * kernel[ky+(x-ix+size)%size]
+			}
+		}
+	}
+
+	// the extreme energies of the pixels that are, or aren't set.
+	tightest := func() int {
+		best, bestEnergy := -1, math.Inf(-1)
+		for i, v := range pattern {
+			if v && energy[i] > bestEnergy {
+				best, bestEnergy = i, energy[i]
+			}
+		}
+		return best
+	}
+	largestVoid := func() int {
+		best, bestEnergy := -1, math.Inf(1)
+		for i, v := range pattern {
+			if !v && energy[i] < bestEnergy {
+				best, bestEnergy = i, energy[i]
+			}
+		}
+		return best
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	initial := n / 10
+	for _, i := range rng.Perm(n)[:initial] {
+		update(i, true)
+	}
+
+	// move points from clusters into voids until the pattern is evenly distributed.
+	for range n {
+		cluster := tightest()
+		update(cluster, false)
+		void := largestVoid()
+		update(void, true)
+		if void == cluster {
+			break
+		}
+	}
+
+	rank := make([]int, n)
+	saved := make([]bool, n)
+	copy(saved, pattern)
+	savedEnergy := make([]float64, n)
+	copy(savedEnergy, energy)
+
+	for r := initial - 1; r >= 0; r-- {
+		i := tightest()
+		update(i, false)
+		rank[i] = r
+	}
+
+	copy(pattern, saved)
+	copy(energy, savedEnergy)
+
+	for r := initial; r < n; r++ {
+		i := largestVoid()
+		update(i, true)
+		rank[i] = r
+	}
+
+	result := make([]float64, n)
+	for i, r := range rank {
+		result[i] = (float64(r) + 0.5) / float64(n)
+	}
+	return result
+}
+
+// PaletteSwap replaces every color in from with the color at the same index in to.
+// Paletted images have their palette entries replaced, other images have their pixels replaced.
+func PaletteSwap(img image.Image, from, to []color.NRGBA) {
+	lookup := map[color.NRGBA]color.NRGBA{}
+	for i := range min(len(from), len(to)) {
+		if _, ok := lookup[from[i]]; !ok {
+			lookup[from[i]] = to[i]
+		}
+	}
+
+	if p, ok := img.(*image.Paletted); ok {
+		for i, c := range p.Palette {
+			if n, ok := lookup[color.NRGBAModel.Convert(c).(color.NRGBA)]; ok {
+				p.Palette[i] = n
+			}
+		}
+		return
+	}
+
+	dst := ImageGetDraw(img)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if n, ok := lookup[c]; ok {
+				dst.Set(x, y, n)
+			}
+		}
+	}
+}
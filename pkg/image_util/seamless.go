@@ -0,0 +1,319 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+)
+
+type SeamlessMode int
+
+const (
+	// SEAMLESS_BLEND offsets the image by half its size and blends the original back over the seams.
+	SEAMLESS_BLEND SeamlessMode = iota
+	// SEAMLESS_MIRROR places the image next to mirrored copies of itself, doubling the size.
+	SEAMLESS_MIRROR
+	// SEAMLESS_QUILT rebuilds the image from overlapping patches joined along minimum error cuts.
+	SEAMLESS_QUILT
+)
+
+var SeamlessModeList = []SeamlessMode{
+	SEAMLESS_BLEND,
+	SEAMLESS_MIRROR,
+	SEAMLESS_QUILT,
+}
+
+type SeamlessOptions struct {
+	Mode SeamlessMode
+	// Border is the width in pixels of the blend from the edges, for SEAMLESS_BLEND.
+	Border int
+	// PatchSize and Overlap are the size of each patch and how much they overlap, for SEAMLESS_QUILT.
+	PatchSize int
+	Overlap   int
+	// Candidates is the number of random patches compared when placing each patch.
+	Candidates int
+	Seed       int64
+}
+
+func DefaultSeamlessOptions() SeamlessOptions {
+	return SeamlessOptions{
+		Mode:       SEAMLESS_BLEND,
+		Border:     32,
+		PatchSize:  64,
+		Overlap:    16,
+		Candidates: 128,
+		Seed:       0,
+	}
+}
+
+func (o SeamlessOptions) Validate() error {
+	if o.Mode < 0 || int(o.Mode) >= len(SeamlessModeList) {
+		return fmt.Errorf("invalid seamless mode: %d", o.Mode)
+	}
+	if o.Border < 1 {
+		return fmt.Errorf("seamless border must be at least 1, got: %d", o.Border)
+	}
+	if o.PatchSize < 2 {
+		return fmt.Errorf("seamless patch size must be at least 2, got: %d", o.PatchSize)
+	}
+	if o.Overlap < 1 || o.Overlap >= o.PatchSize {
+		return fmt.Errorf("seamless overlap must be between 1 and the patch size, got: %d", o.Overlap)
+	}
+	if o.Candidates < 1 {
+		return fmt.Errorf("seamless candidates must be at least 1, got: %d", o.Candidates)
+	}
+
+	return nil
+}
+
+// Seamless creates a version of the image that tiles without visible seams.
+// Sizes in the options are clamped to fit within the image.
+// SEAMLESS_MIRROR doubles the size, and SEAMLESS_QUILT rounds the size to a whole number of patches.
+// Images too small to hold a patch of 2x2 pixels use SEAMLESS_BLEND instead of SEAMLESS_QUILT.
+func Seamless(img image.Image, opts SeamlessOptions) *image.NRGBA {
+	src := imageNRGBA(img)
+
+	switch opts.Mode {
+	case SEAMLESS_MIRROR:
+		return seamlessMirror(src)
+	case SEAMLESS_QUILT:
+		if src.Rect.Dx() >= 2 && src.Rect.Dy() >= 2 {
+			return seamlessQuilt(src, opts)
+		}
+	}
+
+	return seamlessBlend(src, opts.Border)
+}
+
+// TilePreview repeats the image nx times horizontally and ny times vertically.
+func TilePreview(img image.Image, nx, ny int) *image.NRGBA {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w*nx, h*ny))
+
+	for y := range h * ny {
+		row := src.Pix[(y%h)*src.Stride : (y%h)*src.Stride+w*4]
+		for tx := range nx {
+			copy(out.Pix[y*out.Stride+tx*w*4:], row)
+		}
+	}
+
+	return out
+}
+
+func seamlessBlend(src *image.NRGBA, border int) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	border = max(min(border, w/2, h/2), 1)
+
+	// the offset image tiles, as its edges come from the middle of the source,
+	// the source is blended over the middle to hide the seams the offset moved there.
+	for y := range h {
+		oy := (y + h/2) % h
+		dy := min(y, h-1-y)
+
+		for x := range w {
+			ox := (x + w/2) % w
+			dx := min(x, w-1-x)
+
+			t := math.Min(float64(min(dx, dy))/float64(border), 1)
+			t = t * t * (3 - 2*t)
+
+			i := y*src.Stride + x*4
+			j := oy*src.Stride + ox*4
+			for c := range 4 {
+				v := float64(src.Pix[i+c])*t + float64(src.Pix[j+c])*(1-t)
+				out.Pix[y*out.Stride+x*4+c] = uint8(math.Round(v))
+			}
+		}
+	}
+
+	return out
+}
+
+func seamlessMirror(src *image.NRGBA) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w*2, h*2))
+
+	for y := range h * 2 {
+		sy := y
+		if y >= h {
+			sy = h*2 - 1 - y
+		}
+
+		for x := range w * 2 {
+			sx := x
+			if x >= w {
+				sx = w*2 - 1 - x
+			}
+
+			copy(out.Pix[y*out.Stride+x*4:y*out.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+
+	return out
+}
+
+// seamlessQuilt follows the image quilting of Efros and Freeman,
+// with the patches placed on a torus so the last row and column overlap the first.
+func seamlessQuilt(src *image.NRGBA, opts SeamlessOptions) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	// there must be at least 2 patches on each axis, or a patch would overlap itself.
+	patch := max(min(opts.PatchSize, w/2, h/2), 2)
+	overlap := max(min(opts.Overlap, patch/2), 1)
+	step := patch - overlap
+
+	nx := max(int(math.Round(float64(w)/float64(step))), 2)
+	ny := max(int(math.Round(float64(h)/float64(step))), 2)
+	cw, ch := nx*step, ny*step
+
+	out := image.NewNRGBA(image.Rect(0, 0, cw, ch))
+	filled := make([]bool, cw*ch)
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	// the squared difference between a placed pixel and a source pixel.
+	diff := func(ox, oy, sx, sy int) float64 {
+		i := oy*out.Stride + ox*4
+		j := sy*src.Stride + sx*4
+		d := 0.0
+		for c := range 4 {
+			v := float64(out.Pix[i+c]) - float64(src.Pix[j+c])
+			d += v * v
+		}
+		return d
+	}
+
+	for py := range ny {
+		for px := range nx {
+			x0, y0 := px*step, py*step
+
+			// pick the candidate that best matches the pixels already placed.
+			bestX, bestY := rng.Intn(w-patch+1), rng.Intn(h-patch+1)
+			if px > 0 || py > 0 {
+				best := math.Inf(1)
+				for range opts.Candidates {
+					sx, sy := rng.Intn(w-patch+1), rng.Intn(h-patch+1)
+
+					err := 0.0
+					for y := range patch {
+						oy := (y0 + y) % ch
+						for x := range patch {
+							ox := (x0 + x) % cw
+							if filled[oy*cw+ox] {
+								err += diff(ox, oy, sx+x, sy+y)
+							}
+						}
+						if err >= best {
+							break
+						}
+					}
+
+					if err < best {
+						best, bestX, bestY = err, sx, sy
+					}
+				}
+			}
+
+			// keep is true for pixels that stay as the already placed pixels.
+			keep := make([]bool, patch*patch)
+			cost := func(x, y int) float64 {
+				ox, oy := (x0+x)%cw, (y0+y)%ch
+				if !filled[oy*cw+ox] {
+					return 0
+				}
+				return diff(ox, oy, bestX+x, bestY+y)
+			}
+
+			if px > 0 {
+				quiltCut(keep, patch, overlap, cost, false, false)
+			}
+			if px == nx-1 {
+				quiltCut(keep, patch, overlap, cost, false, true)
+			}
+			if py > 0 {
+				quiltCut(keep, patch, overlap, cost, true, false)
+			}
+			if py == ny-1 {
+				quiltCut(keep, patch, overlap, cost, true, true)
+			}
+
+			for y := range patch {
+				oy := (y0 + y) % ch
+				for x := range patch {
+					ox := (x0 + x) % cw
+					if filled[oy*cw+ox] && keep[y*patch+x] {
+						continue
+					}
+
+					copy(out.Pix[oy*out.Stride+ox*4:oy*out.Stride+ox*4+4], src.Pix[(bestY+y)*src.Stride+(bestX+x)*4:])
+					filled[oy*cw+ox] = true
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// quiltCut finds the minimum error path through one overlapping edge of a patch,
+// marking the pixels between the path and the edge to keep.
+// Horizontal cuts run across the top or bottom edge, far selects the right or bottom edge.
+func quiltCut(keep []bool, patch, overlap int, cost func(x, y int) float64, horizontal, far bool) {
+	// u runs along the edge and v across the overlap, with v 0 at the edge.
+	at := func(u, v int) (int, int) {
+		if far {
+			v = patch - 1 - v
+		}
+		if horizontal {
+			return u, v
+		}
+		return v, u
+	}
+
+	total := make([]float64, patch*overlap)
+	for u := range patch {
+		for v := range overlap {
+			x, y := at(u, v)
+			c := cost(x, y)
+
+			if u > 0 {
+				prev := total[(u-1)*overlap+v]
+				if v > 0 {
+					prev = math.Min(prev, total[(u-1)*overlap+v-1])
+				}
+				if v < overlap-1 {
+					prev = math.Min(prev, total[(u-1)*overlap+v+1])
+				}
+				c += prev
+			}
+
+			total[u*overlap+v] = c
+		}
+	}
+
+	v := 0
+	for i := 1; i < overlap; i++ {
+		if total[(patch-1)*overlap+i] < total[(patch-1)*overlap+v] {
+			v = i
+		}
+	}
+
+	for u := patch - 1; u >= 0; u-- {
+		for i := range v {
+			x, y := at(u, i)
+			keep[y*patch+x] = true
+		}
+
+		if u > 0 {
+			next := v
+			for _, nv := range []int{v - 1, v + 1} {
+				if nv >= 0 && nv < overlap && total[(u-1)*overlap+nv] < total[(u-1)*overlap+next] {
+					next = nv
+				}
+			}
+			v = next
+		}
+	}
+}
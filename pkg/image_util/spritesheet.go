@@ -2,7 +2,9 @@ package imageutil
 
 import (
 	"image"
+	"image/color"
 	"math"
+	"sort"
 )
 
 func SpritesheetToFramesTable(img image.Image, copy bool, sheet map[string]any) []image.Image {
@@ -111,3 +113,174 @@ func FramesToSpritesheet(imgs []image.Image, model ColorModel, count, width, hei
 
 	return img
 }
+
+// SpriteDetectOptions controls which pixels are treated as background when detecting sprites.
+type SpriteDetectOptions struct {
+	// AlphaThreshold is the max alpha of a background pixel.
+	AlphaThreshold uint8
+	// UseKey treats pixels matching Key as background, in addition to transparent pixels.
+	UseKey bool
+	Key    color.NRGBA
+	// KeyTolerance is the max difference of each channel from Key.
+	KeyTolerance int
+	// MergeDistance merges sprites with a gap between their bounds smaller than this many pixels.
+	MergeDistance int
+	MinWidth      int
+	MinHeight     int
+}
+
+func DefaultSpriteDetectOptions() *SpriteDetectOptions {
+	return &SpriteDetectOptions{
+		MinWidth:  1,
+		MinHeight: 1,
+	}
+}
+
+func (o *SpriteDetectOptions) background(c color.NRGBA) bool {
+	if c.A <= o.AlphaThreshold {
+		return true
+	}
+	if !o.UseKey {
+		return false
+	}
+
+	diff := func(a, b uint8) int {
+		d := int(a) - int(b)
+		return max(d, -d)
+	}
+	return diff(c.R, o.Key.R) <= o.KeyTolerance && diff(c.G, o.Key.G) <= o.KeyTolerance &&
+		diff(c.B, o.Key.B) <= o.KeyTolerance && diff(c.A, o.Key.A) <= o.KeyTolerance
+}
+
+// SpritesheetDetect finds the bounds of the 8-connected regions of non background pixels.
+// Overlapping bounds are always merged, and the result is sorted in rows from top to bottom, then left to right.
+func SpritesheetDetect(img image.Image, options *SpriteDetectOptions) []image.Rectangle {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	mask := make([]bool, w*h)
+	for y := range h {
+		for x := range w {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			mask[y*w+x] = !options.background(c)
+		}
+	}
+
+	rects := []image.Rectangle{}
+	visited := make([]bool, w*h)
+	stack := []int{}
+
+	for start := range mask {
+		if !mask[start] || visited[start] {
+			continue
+		}
+
+		rect := image.Rect(start%w, start/w, start%w+1, start/w+1)
+		visited[start] = true
+		stack = append(stack[:0], start)
+
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			px, py := p%w, p/w
+			rect = rect.Union(image.Rect(px, py, px+1, py+1))
+
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := px+dx, py+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h {
+						continue
+					}
+					n := ny*w + nx
+					if mask[n] && !visited[n] {
+						visited[n] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+
+		rects = append(rects, rect.Add(b.Min))
+	}
+
+	rects = spriteMerge(rects, options.MergeDistance)
+
+	filtered := []image.Rectangle{}
+	for _, r := range rects {
+		if r.Dx() >= options.MinWidth && r.Dy() >= options.MinHeight {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return spriteSortRows(filtered)
+}
+
+// spriteMerge merges rects until none are within distance of each other.
+func spriteMerge(rects []image.Rectangle, distance int) []image.Rectangle {
+	// overlapping rects have a negative gap, so they are merged even when distance is 0.
+	near := func(a, b image.Rectangle) bool {
+		dx := max(a.Min.X-b.Max.X, b.Min.X-a.Max.X)
+		dy := max(a.Min.Y-b.Max.Y, b.Min.Y-a.Max.Y)
+		return dx < distance && dy < distance
+	}
+
+	for merged := true; merged; {
+		merged = false
+
+		for i := 0; i < len(rects); i++ {
+			for j := i + 1; j < len(rects); j++ {
+				if near(rects[i], rects[j]) {
+					rects[i] = rects[i].Union(rects[j])
+					rects = append(rects[:j], rects[j+1:]...)
+					merged = true
+					j = i
+				}
+			}
+		}
+	}
+
+	return rects
+}
+
+// spriteSortRows groups rects into rows by their vertical overlap with the first rect in the row.
+func spriteSortRows(rects []image.Rectangle) []image.Rectangle {
+	sort.SliceStable(rects, func(i, j int) bool {
+		return rects[i].Min.Y < rects[j].Min.Y
+	})
+
+	sorted := make([]image.Rectangle, 0, len(rects))
+	for i := 0; i < len(rects); {
+		row := rects[i]
+		j := i + 1
+		for j < len(rects) && rects[j].Min.Y < row.Max.Y {
+			j++
+		}
+
+		line := rects[i:j]
+		sort.SliceStable(line, func(a, b int) bool {
+			return line[a].Min.X < line[b].Min.X
+		})
+		sorted = append(sorted, line...)
+		i = j
+	}
+
+	return sorted
+}
+
+// SpriteTrim returns the bounds of the pixels with an alpha above threshold,
+// the rect is empty when the image is fully transparent.
+func SpriteTrim(img image.Image, threshold uint8) image.Rectangle {
+	b := img.Bounds()
+	rect := image.Rectangle{}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			if uint8(a>>8) > threshold {
+				rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return rect
+}
@@ -26,6 +26,10 @@ func SubImage(img image.Image, x1, y1, x2, y2 int, copy bool) image.Image {
 		return subimg(nimg, rect, copy, MODEL_GRAY16)
 	case *image.CMYK:
 		return subimg(nimg, rect, copy, MODEL_CMYK)
+	case *image.Paletted:
+		return subimg(nimg, rect, copy, MODEL_PALETTED)
+	case *RGBAF32:
+		return subimg(nimg, rect, copy, MODEL_RGBAF32)
 	}
 
 	return nil
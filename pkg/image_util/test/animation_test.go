@@ -0,0 +1,130 @@
+package image_util_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+// animationTest has a full first frame, and a second frame covering only part of the canvas.
+func animationTest() *imageutil.Animation {
+	first := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			first.Set(x, y, color.NRGBA{uint8(x * 16), uint8(y * 16), 100, 255})
+		}
+	}
+
+	second := image.NewNRGBA(image.Rect(4, 4, 12, 12))
+	for y := 4; y < 12; y++ {
+		for x := 4; x < 12; x++ {
+			second.Set(x, y, color.NRGBA{255, 0, uint8(x * 20), 255})
+		}
+	}
+
+	return &imageutil.Animation{
+		Frames:    []image.Image{first, second},
+		Delay:     []int{10, 25},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalNone},
+		LoopCount: 0,
+	}
+}
+
+func animationCheck(t *testing.T, name string, anim *imageutil.Animation, original *imageutil.Animation) {
+	if len(anim.Frames) != len(original.Frames) {
+		t.Fatalf("%s: expected %d frames, got %d", name, len(original.Frames), len(anim.Frames))
+	}
+
+	for i, d := range original.Delay {
+		if anim.Delay[i] != d {
+			t.Errorf("%s: expected delay %d for frame %d, got %d", name, d, i, anim.Delay[i])
+		}
+	}
+	if anim.LoopCount != original.LoopCount {
+		t.Errorf("%s: expected loop count %d, got %d", name, original.LoopCount, anim.LoopCount)
+	}
+
+	if !imageutil.ImageCompare(anim.Frames[0], original.Frames[0]) {
+		t.Errorf("%s: first frame does not match", name)
+	}
+
+	// the second frame is composited over the first.
+	frame := anim.Frames[1]
+	if frame.Bounds() != original.Frames[0].Bounds() {
+		t.Fatalf("%s: expected composited frame to cover the canvas, got %s", name, frame.Bounds())
+	}
+	if !colorEqual(frame.At(0, 0), original.Frames[0].At(0, 0)) {
+		t.Errorf("%s: expected the first frame to show outside of the second", name)
+	}
+	if !colorEqual(frame.At(6, 6), original.Frames[1].At(6, 6)) {
+		t.Errorf("%s: expected the second frame to be drawn at its bounds", name)
+	}
+}
+
+func colorEqual(c1, c2 color.Color) bool {
+	r1, g1, b1, a1 := c1.RGBA()
+	r2, g2, b2, a2 := c2.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+func TestAPNGRoundTrip(t *testing.T) {
+	anim := animationTest()
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.APNGEncode(w, anim, nil)
+	if err != nil {
+		t.Fatalf("failed to encode apng: %s", err)
+	}
+
+	// the first frame is the default image, so png decoders without apng support still work.
+	_, err = imageutil.Decode(bytes.NewReader(w.Bytes()), imageutil.ENCODING_PNG)
+	if err != nil {
+		t.Fatalf("failed to decode apng as png: %s", err)
+	}
+
+	out, err := imageutil.APNGDecode(bytes.NewReader(w.Bytes()), imageutil.DecodeLimits{})
+	if err != nil {
+		t.Fatalf("failed to decode apng: %s", err)
+	}
+
+	animationCheck(t, "apng", out, anim)
+}
+
+func TestWebPAnimRoundTrip(t *testing.T) {
+	anim := animationTest()
+	anim.LoopCount = 2
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.WebPAnimEncode(w, anim, nil)
+	if err != nil {
+		t.Fatalf("failed to encode webp: %s", err)
+	}
+
+	out, err := imageutil.WebPAnimDecode(bytes.NewReader(w.Bytes()), imageutil.DecodeLimits{})
+	if err != nil {
+		t.Fatalf("failed to decode webp: %s", err)
+	}
+
+	animationCheck(t, "webp", out, anim)
+}
+
+func TestAPNGStill(t *testing.T) {
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, gradientImage(64, 64, false), imageutil.ENCODING_PNG, nil)
+	if err != nil {
+		t.Fatalf("failed to encode png: %s", err)
+	}
+
+	out, err := imageutil.APNGDecode(bytes.NewReader(w.Bytes()), imageutil.DecodeLimits{})
+	if err != nil {
+		t.Fatalf("failed to decode png: %s", err)
+	}
+	if len(out.Frames) != 1 {
+		t.Errorf("expected a single frame, got %d", len(out.Frames))
+	}
+}
@@ -0,0 +1,248 @@
+package image_util_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+type aseBuilder struct {
+	bytes.Buffer
+}
+
+func (b *aseBuilder) u8(v int)  { b.WriteByte(byte(v)) }
+func (b *aseBuilder) u16(v int) { binary.Write(b, binary.LittleEndian, uint16(v)) }
+func (b *aseBuilder) u32(v int) { binary.Write(b, binary.LittleEndian, uint32(v)) }
+func (b *aseBuilder) zero(n int) {
+	b.Write(make([]byte, n))
+}
+func (b *aseBuilder) str(s string) {
+	b.u16(len(s))
+	b.WriteString(s)
+}
+
+func aseChunk(typ int, data []byte) []byte {
+	b := &aseBuilder{}
+	b.u32(len(data) + 6)
+	b.u16(typ)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func aseFrame(duration int, chunks ...[]byte) []byte {
+	data := bytes.Join(chunks, nil)
+
+	b := &aseBuilder{}
+	b.u32(len(data) + 16)
+	b.u16(0xF1FA)
+	b.u16(len(chunks))
+	b.u16(duration)
+	b.zero(2)
+	b.u32(len(chunks))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func aseLayer(name string, flags, level, blend, opacity int) []byte {
+	b := &aseBuilder{}
+	b.u16(flags)
+	b.u16(0)
+	b.u16(level)
+	b.zero(4)
+	b.u16(blend)
+	b.u8(opacity)
+	b.zero(3)
+	b.str(name)
+	return aseChunk(0x2004, b.Bytes())
+}
+
+func aseCel(layer, x, y, w, h int, pix []byte, compress bool) []byte {
+	b := &aseBuilder{}
+	b.u16(layer)
+	b.u16(x)
+	b.u16(y)
+	b.u8(255)
+	if compress {
+		b.u16(2)
+	} else {
+		b.u16(0)
+	}
+	b.zero(7)
+	b.u16(w)
+	b.u16(h)
+
+	if compress {
+		zw := zlib.NewWriter(b)
+		zw.Write(pix)
+		zw.Close()
+	} else {
+		b.Write(pix)
+	}
+	return aseChunk(0x2005, b.Bytes())
+}
+
+func aseLinkedCel(layer, frame int) []byte {
+	b := &aseBuilder{}
+	b.u16(layer)
+	b.zero(5)
+	b.u16(1)
+	b.zero(7)
+	b.u16(frame)
+	return aseChunk(0x2005, b.Bytes())
+}
+
+func aseFill(w, h int, c color.NRGBA) []byte {
+	pix := []byte{}
+	for range w * h {
+		pix = append(pix, c.R, c.G, c.B, c.A)
+	}
+	return pix
+}
+
+func aseTestFile() []byte {
+	tags := &aseBuilder{}
+	tags.u16(1)
+	tags.zero(8)
+	tags.u16(0)
+	tags.u16(1)
+	tags.u8(2)
+	tags.u16(3)
+	tags.zero(10)
+	tags.str("walk")
+
+	palette := &aseBuilder{}
+	palette.u32(2)
+	palette.u32(0)
+	palette.u32(1)
+	palette.zero(8)
+	palette.u16(0)
+	palette.Write([]byte{255, 0, 0, 255})
+	palette.u16(1)
+	palette.Write([]byte{0, 0, 255, 128})
+	palette.str("blue")
+
+	slice := &aseBuilder{}
+	slice.u32(1)
+	slice.u32(3)
+	slice.zero(4)
+	slice.str("panel")
+	slice.u32(0)
+	slice.u32(0)
+	slice.u32(0)
+	slice.u32(4)
+	slice.u32(4)
+	slice.u32(1)
+	slice.u32(1)
+	slice.u32(2)
+	slice.u32(2)
+	slice.u32(2)
+	slice.u32(3)
+
+	frame1 := aseFrame(100,
+		aseChunk(0x2019, palette.Bytes()),
+		aseLayer("bg", 1|8, 0, 0, 255),
+		aseLayer("shade", 1, 0, 1, 255),
+		aseLayer("hidden", 0, 0, 0, 255),
+		aseChunk(0x2018, tags.Bytes()),
+		aseChunk(0x2022, slice.Bytes()),
+		aseCel(0, 0, 0, 4, 4, aseFill(4, 4, color.NRGBA{200, 100, 50, 255}), false),
+		aseCel(1, 2, 2, 4, 4, aseFill(4, 4, color.NRGBA{128, 128, 128, 255}), true),
+		aseCel(2, 0, 0, 4, 4, aseFill(4, 4, color.NRGBA{0, 255, 0, 255}), false),
+	)
+	frame2 := aseFrame(150,
+		aseLinkedCel(0, 0),
+	)
+
+	b := &aseBuilder{}
+	b.u32(0)
+	b.u16(0xA5E0)
+	b.u16(2)
+	b.u16(4)
+	b.u16(4)
+	b.u16(32)
+	b.u32(1)
+	b.zero(128 - b.Len())
+	b.Write(frame1)
+	b.Write(frame2)
+
+	data := b.Bytes()
+	binary.LittleEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func TestAsepriteDecode(t *testing.T) {
+	ase, err := imageutil.AsepriteDecode(bytes.NewReader(aseTestFile()), imageutil.DecodeLimits{})
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+
+	if ase.Width != 4 || ase.Height != 4 || len(ase.Frames) != 2 {
+		t.Fatalf("unexpected file: %dx%d with %d frames", ase.Width, ase.Height, len(ase.Frames))
+	}
+	if ase.Frames[0].Duration != 100 || ase.Frames[1].Duration != 150 {
+		t.Errorf("unexpected durations: %d %d", ase.Frames[0].Duration, ase.Frames[1].Duration)
+	}
+
+	if len(ase.Layers) != 3 || ase.Layers[1].Blend != imageutil.ASEPRITEBLEND_MULTIPLY || !ase.Layers[0].Background {
+		t.Errorf("unexpected layers: %+v", ase.Layers)
+	}
+	if ase.LayerVisible(2) {
+		t.Error("expected hidden layer to not be visible")
+	}
+
+	if len(ase.Tags) != 1 {
+		t.Fatalf("expected 1 tag, got %d", len(ase.Tags))
+	}
+	tag := ase.Tags[0]
+	if tag.Name != "walk" || tag.From != 0 || tag.To != 1 || tag.Direction != imageutil.ASEPRITEDIRECTION_PINGPONG || tag.Repeat != 3 {
+		t.Errorf("unexpected tag: %+v", tag)
+	}
+
+	if len(ase.Palette) != 2 || ase.Palette[1] != (color.NRGBA{0, 0, 255, 128}) {
+		t.Errorf("unexpected palette: %v", ase.Palette)
+	}
+
+	if len(ase.Slices) != 1 || len(ase.Slices[0].Keys) != 1 {
+		t.Fatalf("unexpected slices: %+v", ase.Slices)
+	}
+	key := ase.Slices[0].Keys[0]
+	if !ase.Slices[0].NineSlice || key.Center != image.Rect(1, 1, 3, 3) || key.Pivot != image.Pt(2, 3) {
+		t.Errorf("unexpected slice key: %+v", key)
+	}
+
+	img := ase.Composite(0)
+	if c := img.NRGBAAt(0, 0); c != (color.NRGBA{200, 100, 50, 255}) {
+		t.Errorf("expected background color, got %v", c)
+	}
+	// 128/255 multiplied with the background.
+	if c := img.NRGBAAt(3, 3); c != (color.NRGBA{100, 50, 25, 255}) {
+		t.Errorf("expected multiplied color, got %v", c)
+	}
+
+	img = ase.Composite(1)
+	if c := img.NRGBAAt(3, 3); c != (color.NRGBA{200, 100, 50, 255}) {
+		t.Errorf("expected linked cel, got %v", c)
+	}
+
+	img = ase.CompositeLayers(0, func(layer int) bool { return layer == 2 })
+	if c := img.NRGBAAt(0, 0); c != (color.NRGBA{0, 255, 0, 255}) {
+		t.Errorf("expected hidden layer to be drawn when included, got %v", c)
+	}
+}
+
+func TestAsepriteDecodeLimits(t *testing.T) {
+	_, err := imageutil.AsepriteDecode(bytes.NewReader(aseTestFile()), imageutil.DecodeLimits{MaxFrames: 1})
+	if _, ok := err.(*imageutil.DecodeLimitError); !ok {
+		t.Errorf("expected frame limit error, got %v", err)
+	}
+
+	_, err = imageutil.AsepriteDecode(bytes.NewReader(aseTestFile()), imageutil.DecodeLimits{MaxPixels: 8})
+	if _, ok := err.(*imageutil.DecodeLimitError); !ok {
+		t.Errorf("expected pixel limit error, got %v", err)
+	}
+}
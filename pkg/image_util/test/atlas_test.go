@@ -0,0 +1,368 @@
+package image_util_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func atlasTestImages() ([]image.Image, []string) {
+	imgs := []image.Image{}
+	names := []string{}
+
+	for i := range 24 {
+		w := 4 + (i*7)%29
+		h := 3 + (i*11)%17
+
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := range h {
+			for x := range w {
+				img.SetNRGBA(x, y, color.NRGBA{uint8(i * 10), uint8(x), uint8(y), 255})
+			}
+		}
+
+		imgs = append(imgs, img)
+		names = append(names, fmt.Sprintf("sprite_%d", i))
+	}
+
+	return imgs, names
+}
+
+// atlasCheck validates that sprites don't overlap, fit in their page and match the source pixels.
+func atlasCheck(t *testing.T, atlas *imageutil.Atlas, pages []*image.NRGBA, imgs []image.Image, options *imageutil.AtlasOptions) {
+	t.Helper()
+
+	if len(atlas.Pages) != len(pages) {
+		t.Fatalf("expected %d pages, got %d", len(pages), len(atlas.Pages))
+	}
+
+	for i, s := range atlas.Sprites {
+		page := pages[s.Page]
+		w, h := s.Width, s.Height
+		if s.Rotated {
+			w, h = h, w
+		}
+
+		rect := image.Rect(s.X, s.Y, s.X+w, s.Y+h)
+		outer := rect.Inset(-options.Extrude)
+		if !outer.In(page.Rect) {
+			t.Errorf("sprite %d is outside of its page: %s in %s", i, outer, page.Rect)
+		}
+
+		for j, o := range atlas.Sprites[:i] {
+			if o.Page != s.Page {
+				continue
+			}
+			ow, oh := o.Width, o.Height
+			if o.Rotated {
+				ow, oh = oh, ow
+			}
+			other := image.Rect(o.X, o.Y, o.X+ow, o.Y+oh).Inset(-options.Extrude - options.Padding)
+			if other.Inset(options.Padding).Overlaps(outer) || (options.Padding > 0 && other.Overlaps(outer)) {
+				t.Errorf("sprites %d and %d overlap", i, j)
+			}
+		}
+
+		src := imgs[i].(*image.NRGBA)
+		for y := range s.Height {
+			for x := range s.Width {
+				px, py := s.X+x, s.Y+y
+				switch {
+				case s.Rotated && atlas.Rotation == imageutil.ATLASROTATION_CW:
+					px, py = s.X+s.Height-1-y, s.Y+x
+				case s.Rotated && atlas.Rotation == imageutil.ATLASROTATION_CCW:
+					px, py = s.X+y, s.Y+s.Width-1-x
+				}
+
+				if page.NRGBAAt(px, py) != src.NRGBAAt(x, y) {
+					t.Fatalf("sprite %d has the wrong pixel at %d,%d", i, x, y)
+				}
+			}
+		}
+
+		if options.Extrude > 0 {
+			if page.NRGBAAt(rect.Min.X-1, rect.Min.Y-1) != page.NRGBAAt(rect.Min.X, rect.Min.Y) {
+				t.Errorf("sprite %d is not extruded", i)
+			}
+		}
+	}
+}
+
+func TestAtlasPack(t *testing.T) {
+	imgs, names := atlasTestImages()
+
+	tests := []struct {
+		name    string
+		options func(o *imageutil.AtlasOptions)
+	}{
+		{"maxrects", func(o *imageutil.AtlasOptions) {}},
+		{"skyline", func(o *imageutil.AtlasOptions) { o.Algorithm = imageutil.ATLASALGORITHM_SKYLINE }},
+		{"padding", func(o *imageutil.AtlasOptions) { o.Padding = 2; o.Extrude = 1 }},
+		{"rotate cw", func(o *imageutil.AtlasOptions) { o.Rotation = imageutil.ATLASROTATION_CW }},
+		{"rotate ccw", func(o *imageutil.AtlasOptions) {
+			o.Rotation = imageutil.ATLASROTATION_CCW
+			o.Algorithm = imageutil.ATLASALGORITHM_SKYLINE
+		}},
+		{"pages", func(o *imageutil.AtlasOptions) { o.MaxWidth = 48; o.MaxHeight = 48; o.Padding = 1 }},
+		{"power of two", func(o *imageutil.AtlasOptions) { o.PowerOfTwo = true; o.MaxWidth = 100; o.MaxHeight = 100 }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := imageutil.DefaultAtlasOptions()
+			test.options(options)
+
+			atlas, pages, err := imageutil.AtlasPack(imgs, names, options)
+			if err != nil {
+				t.Fatalf("failed to pack: %s", err)
+			}
+
+			atlasCheck(t, atlas, pages, imgs, options)
+
+			for _, p := range pages {
+				w, h := p.Rect.Dx(), p.Rect.Dy()
+				if w > options.MaxWidth || h > options.MaxHeight {
+					t.Errorf("page is larger than the max size: %dx%d", w, h)
+				}
+				if options.PowerOfTwo && (w&(w-1) != 0 || h&(h-1) != 0) {
+					t.Errorf("page is not a power of two: %dx%d", w, h)
+				}
+			}
+		})
+	}
+}
+
+func TestAtlasPackTooLarge(t *testing.T) {
+	options := imageutil.DefaultAtlasOptions()
+	options.MaxWidth = 16
+	options.MaxHeight = 16
+
+	_, _, err := imageutil.AtlasPack([]image.Image{image.NewNRGBA(image.Rect(0, 0, 20, 4))}, []string{"wide"}, options)
+	if err == nil {
+		t.Error("expected error for a sprite larger than the atlas")
+	}
+
+	options.Rotation = imageutil.ATLASROTATION_CW
+	options.MaxHeight = 32
+	_, _, err = imageutil.AtlasPack([]image.Image{image.NewNRGBA(image.Rect(0, 0, 20, 4))}, []string{"wide"}, options)
+	if err != nil {
+		t.Errorf("expected sprite to fit when rotated: %s", err)
+	}
+}
+
+func TestAtlasExport(t *testing.T) {
+	imgs, names := atlasTestImages()
+
+	atlas, _, err := imageutil.AtlasPack(imgs, names, imageutil.DefaultAtlasOptions())
+	if err != nil {
+		t.Fatalf("failed to pack: %s", err)
+	}
+	atlas.Pages[0].Name = "atlas.png"
+
+	data, err := atlas.JSON(0, false)
+	if err != nil {
+		t.Fatalf("failed to export json: %s", err)
+	}
+
+	hash := struct {
+		Frames map[string]struct {
+			Frame struct{ X, Y, W, H int }
+		}
+		Meta struct{ Image string }
+	}{}
+	if err := json.Unmarshal(data, &hash); err != nil {
+		t.Fatalf("invalid json: %s", err)
+	}
+	if len(hash.Frames) != len(imgs) || hash.Meta.Image != "atlas.png" {
+		t.Errorf("unexpected json export: %d frames, image %s", len(hash.Frames), hash.Meta.Image)
+	}
+	if f := hash.Frames["sprite_3"].Frame; f.X != atlas.Sprites[3].X || f.W != atlas.Sprites[3].Width {
+		t.Errorf("unexpected frame for sprite_3: %+v", f)
+	}
+
+	data, err = atlas.JSON(0, true)
+	if err != nil {
+		t.Fatalf("failed to export json array: %s", err)
+	}
+	if !strings.Contains(string(data), `"filename": "sprite_0"`) {
+		t.Error("expected array export to include filenames")
+	}
+
+	gdx, err := atlas.LibGDX()
+	if err != nil {
+		t.Fatalf("failed to export libgdx: %s", err)
+	}
+	if !strings.HasPrefix(gdx, "\natlas.png\nsize: ") || !strings.Contains(gdx, "sprite_5\n  rotate: false\n") {
+		t.Errorf("unexpected libgdx export:\n%s", gdx)
+	}
+
+	src, err := atlas.Lua()
+	if err != nil {
+		t.Fatalf("failed to export lua: %s", err)
+	}
+	if !strings.HasPrefix(src, "return {") || !strings.Contains(src, `["sprite_0"] = { page = 1,`) {
+		t.Errorf("unexpected lua export:\n%s", src)
+	}
+
+	atlas.Rotation = imageutil.ATLASROTATION_CCW
+	atlas.Sprites[0].Rotated = true
+	if _, err := atlas.JSON(0, false); err == nil {
+		t.Error("expected json export to reject counter clockwise rotation")
+	}
+}
+
+// atlasRegionCheck reads a sprite the way a loader does, from the region it stores in the page,
+// and compares it to the source image after undoing the rotation.
+func atlasRegionCheck(t *testing.T, name string, page *image.NRGBA, src *image.NRGBA, region image.Rectangle, rotation imageutil.AtlasRotation) {
+	t.Helper()
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if rotation != imageutil.ATLASROTATION_NONE {
+		w, h = h, w
+	}
+	if region.Dx() != w || region.Dy() != h {
+		t.Fatalf("%s: expected a %dx%d region in the page, got %s", name, w, h, region)
+	}
+
+	for y := range src.Rect.Dy() {
+		for x := range src.Rect.Dx() {
+			px, py := x, y
+			switch rotation {
+			case imageutil.ATLASROTATION_CW:
+				px, py = region.Dx()-1-y, x
+			case imageutil.ATLASROTATION_CCW:
+				px, py = y, region.Dy()-1-x
+			}
+
+			if page.NRGBAAt(region.Min.X+px, region.Min.Y+py) != src.NRGBAAt(x, y) {
+				t.Fatalf("%s: wrong pixel at %d,%d", name, x, y)
+			}
+		}
+	}
+}
+
+func TestAtlasExportRotated(t *testing.T) {
+	imgs, names := atlasTestImages()
+
+	options := imageutil.DefaultAtlasOptions()
+	options.Rotation = imageutil.ATLASROTATION_CW
+	atlas, pages, err := imageutil.AtlasPack(imgs, names, options)
+	if err != nil {
+		t.Fatalf("failed to pack: %s", err)
+	}
+
+	rotated := 0
+	for p := range atlas.Pages {
+		data, err := atlas.JSON(p, false)
+		if err != nil {
+			t.Fatalf("failed to export json: %s", err)
+		}
+
+		hash := struct {
+			Frames map[string]struct {
+				Frame   struct{ X, Y, W, H int }
+				Rotated bool
+			}
+		}{}
+		if err := json.Unmarshal(data, &hash); err != nil {
+			t.Fatalf("invalid json: %s", err)
+		}
+
+		for i, s := range atlas.Sprites {
+			if s.Page != p {
+				continue
+			}
+
+			// the frame keeps the unrotated size, loaders such as pixi swap it when rotated is set.
+			f := hash.Frames[s.Name]
+			region := image.Rect(f.Frame.X, f.Frame.Y, f.Frame.X+f.Frame.W, f.Frame.Y+f.Frame.H)
+			rotation := imageutil.ATLASROTATION_NONE
+			if f.Rotated {
+				region.Max = region.Min.Add(image.Pt(f.Frame.H, f.Frame.W))
+				rotation = imageutil.ATLASROTATION_CW
+				rotated++
+			}
+
+			atlasRegionCheck(t, "json "+s.Name, pages[p], imgs[i].(*image.NRGBA), region, rotation)
+		}
+	}
+	if rotated == 0 {
+		t.Fatal("expected some sprites to be rotated")
+	}
+
+	options.Rotation = imageutil.ATLASROTATION_CCW
+	atlas, pages, err = imageutil.AtlasPack(imgs, names, options)
+	if err != nil {
+		t.Fatalf("failed to pack: %s", err)
+	}
+	for i := range atlas.Pages {
+		atlas.Pages[i].Name = fmt.Sprintf("atlas_%d.png", i)
+	}
+
+	gdx, err := atlas.LibGDX()
+	if err != nil {
+		t.Fatalf("failed to export libgdx: %s", err)
+	}
+
+	rotated = 0
+	for i, s := range atlas.Sprites {
+		var rotate bool
+		var x, y, w, h int
+		entry := fmt.Sprintf("\n%s\n  rotate: %%t\n  xy: %%d, %%d\n  size: %%d, %%d\n", s.Name)
+		start := strings.Index(gdx, fmt.Sprintf("\n%s\n", s.Name))
+		if start < 0 {
+			t.Fatalf("missing libgdx region for %s", s.Name)
+		}
+		if _, err := fmt.Sscanf(gdx[start:], entry, &rotate, &x, &y, &w, &h); err != nil {
+			t.Fatalf("invalid libgdx region for %s: %s", s.Name, err)
+		}
+
+		// the size keeps the unrotated size, libgdx swaps it when rotate is set.
+		region := image.Rect(x, y, x+w, y+h)
+		rotation := imageutil.ATLASROTATION_NONE
+		if rotate {
+			region.Max = region.Min.Add(image.Pt(h, w))
+			rotation = imageutil.ATLASROTATION_CCW
+			rotated++
+		}
+
+		atlasRegionCheck(t, "libgdx "+s.Name, pages[s.Page], imgs[i].(*image.NRGBA), region, rotation)
+	}
+	if rotated == 0 {
+		t.Fatal("expected some sprites to be rotated")
+	}
+}
+
+func TestAtlasExportTrimmed(t *testing.T) {
+	atlas := &imageutil.Atlas{
+		Pages: []imageutil.AtlasPage{{Name: "atlas.png", Width: 16, Height: 16}},
+		Sprites: []imageutil.AtlasSprite{{
+			Name: "trimmed", X: 1, Y: 2, Width: 4, Height: 6,
+			OffsetX: 3, OffsetY: 1, SourceWidth: 10, SourceHeight: 12,
+		}},
+	}
+
+	data, err := atlas.JSON(0, true)
+	if err != nil {
+		t.Fatalf("failed to export json: %s", err)
+	}
+	if !strings.Contains(string(data), `"trimmed": true`) || !strings.Contains(string(data), `"sourceSize": {
+				"w": 10,
+				"h": 12`) {
+		t.Errorf("expected trimmed json export:\n%s", data)
+	}
+
+	gdx, err := atlas.LibGDX()
+	if err != nil {
+		t.Fatalf("failed to export libgdx: %s", err)
+	}
+	// libgdx offsets are from the bottom left: 12 - 6 - 1.
+	if !strings.Contains(gdx, "  orig: 10, 12\n  offset: 3, 5\n") {
+		t.Errorf("expected trimmed libgdx export:\n%s", gdx)
+	}
+}
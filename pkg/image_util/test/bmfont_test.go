@@ -0,0 +1,145 @@
+package image_util_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// bmfontKernFace adds kerning to AV, as the go fonts do not have a kern table.
+type bmfontKernFace struct {
+	font.Face
+}
+
+func (f bmfontKernFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if r0 == 'A' && r1 == 'V' {
+		return fixed.I(-2)
+	}
+	return 0
+}
+
+func TestBMFontGenerate(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := bmfontKernFace{truetype.NewFace(f, &truetype.Options{Size: 24})}
+
+	opts := imageutil.DefaultBMFontOptions()
+	opts.Chars = "AVA ao"
+	opts.Outline = 2
+	opts.ShadowX = 2
+	opts.ShadowY = 2
+
+	bm, pages, err := imageutil.BMFontGenerate(face, "Go Regular", 24, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bm.Chars) != 5 {
+		t.Fatalf("expected duplicate characters to be removed, got %d chars", len(bm.Chars))
+	}
+	if len(pages) != 1 || len(bm.Pages) != 1 {
+		t.Fatalf("expected a single page, got %d", len(pages))
+	}
+	if b := pages[0].Bounds(); b.Dx() != bm.ScaleW || b.Dy() != bm.ScaleH {
+		t.Errorf("expected the page to match the scale, got %v", b)
+	}
+
+	for _, c := range bm.Chars {
+		if c.ID == ' ' {
+			if c.Width != 0 || c.XAdvance <= 0 {
+				t.Errorf("expected space to only advance, got %+v", c)
+			}
+			continue
+		}
+
+		if c.Width <= 0 || c.Height <= 0 || c.X+c.Width > bm.ScaleW || c.Y+c.Height > bm.ScaleH {
+			t.Errorf("invalid glyph rect: %+v", c)
+		}
+
+		// the glyph has white fill, a black outline and a translucent black shadow.
+		white, outline := false, false
+		for y := c.Y; y < c.Y+c.Height; y++ {
+			for x := c.X; x < c.X+c.Width; x++ {
+				p := pages[0].NRGBAAt(x, y)
+				if p.A == 255 && p.R == 255 {
+					white = true
+				}
+				if p.A == 255 && p.R == 0 {
+					outline = true
+				}
+			}
+		}
+		if !white || !outline {
+			t.Errorf("expected fill and outline for %q, got fill: %t, outline: %t", c.ID, white, outline)
+		}
+	}
+
+	kerned := false
+	for _, k := range bm.Kernings {
+		if k.First == 'A' && k.Second == 'V' && k.Amount == -2 {
+			kerned = true
+		}
+	}
+	if !kerned || len(bm.Kernings) != 1 {
+		t.Errorf("expected negative kerning for AV, got %+v", bm.Kernings)
+	}
+
+	bm.Pages[0] = "font_0.png"
+
+	text := bm.Text()
+	for _, s := range []string{"info face=\"Go Regular\" size=24", "page id=0 file=\"font_0.png\"", "chars count=5", "char id=65 ", "kerning first=65 second=86 amount=-2"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("expected text to contain %q", s)
+		}
+	}
+
+	b, err := bm.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x struct {
+		Pages []struct {
+			File string `xml:"file,attr"`
+		} `xml:"pages>page"`
+		Chars struct {
+			Count int `xml:"count,attr"`
+		} `xml:"chars"`
+	}
+	if err := xml.Unmarshal(b, &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Chars.Count != 5 || len(x.Pages) != 1 || x.Pages[0].File != "font_0.png" {
+		t.Errorf("unexpected xml: %s", b)
+	}
+
+	b, err = bm.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j struct {
+		Chars  []map[string]int `json:"chars"`
+		Common struct {
+			Base int `json:"base"`
+		} `json:"common"`
+	}
+	if err := json.Unmarshal(b, &j); err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Chars) != 5 || j.Common.Base != bm.Base {
+		t.Errorf("unexpected json: %s", b)
+	}
+
+	opts.Atlas.Rotation = imageutil.ATLASROTATION_CW
+	if _, _, err := imageutil.BMFontGenerate(face, "Go Regular", 24, opts); err == nil {
+		t.Error("expected error for rotated glyphs")
+	}
+}
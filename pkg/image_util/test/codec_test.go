@@ -0,0 +1,252 @@
+package image_util_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func codecRoundTrip(t *testing.T, img image.Image, encoding imageutil.ImageEncoding, options *imageutil.EncodeOptions) image.Image {
+	t.Helper()
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, img, encoding, options)
+	if err != nil {
+		t.Fatalf("failed to encode %d: %s", encoding, err)
+	}
+
+	if detected := imageutil.DetectEncoding(w.Bytes()); detected != encoding {
+		t.Errorf("expected detected encoding %d, got %d", encoding, detected)
+	}
+
+	width, height, err := imageutil.DecodeConfig(bytes.NewReader(w.Bytes()), encoding)
+	if err != nil || width != img.Bounds().Dx() || height != img.Bounds().Dy() {
+		t.Errorf("failed to decode config for %d: %d %d %v", encoding, width, height, err)
+	}
+
+	out, err := imageutil.Decode(bytes.NewReader(w.Bytes()), encoding)
+	if err != nil {
+		t.Fatalf("failed to decode %d: %s", encoding, err)
+	}
+	if out.Bounds() != img.Bounds() {
+		t.Fatalf("expected bounds %s for %d, got %s", img.Bounds(), encoding, out.Bounds())
+	}
+
+	return out
+}
+
+// codecMaxDiff is the largest difference of any non-premultiplied channel.
+func codecMaxDiff(img1, img2 image.Image) int {
+	diff := 0
+	b := img1.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c1 := color.NRGBAModel.Convert(img1.At(x, y)).(color.NRGBA)
+			c2 := color.NRGBAModel.Convert(img2.At(x, y)).(color.NRGBA)
+
+			for _, d := range []int{
+				int(c1.R) - int(c2.R), int(c1.G) - int(c2.G),
+				int(c1.B) - int(c2.B), int(c1.A) - int(c2.A),
+			} {
+				diff = max(diff, max(d, -d))
+			}
+		}
+	}
+
+	return diff
+}
+
+func TestCodecLossless(t *testing.T) {
+	// an odd size, so block based encodings need padding.
+	img := gradientImage(37, 21, true)
+
+	tgaRLE := imageutil.DefaultEncodeOptions()
+	tgaRLE.TGARLE = true
+
+	tests := []struct {
+		name     string
+		encoding imageutil.ImageEncoding
+		options  *imageutil.EncodeOptions
+	}{
+		{"qoi", imageutil.ENCODING_QOI, nil},
+		{"pam", imageutil.ENCODING_PAM, nil},
+		{"tga", imageutil.ENCODING_TGA, nil},
+		{"tga rle", imageutil.ENCODING_TGA, tgaRLE},
+		{"dds", imageutil.ENCODING_DDS, nil},
+	}
+
+	for _, test := range tests {
+		out := codecRoundTrip(t, img, test.encoding, test.options)
+		if diff := codecMaxDiff(img, out); diff != 0 {
+			t.Errorf("%s: expected lossless round trip, max difference is %d", test.name, diff)
+		}
+	}
+}
+
+func TestCodecOpaque(t *testing.T) {
+	img := gradientImage(64, 64, false)
+
+	for _, encoding := range []imageutil.ImageEncoding{imageutil.ENCODING_QOI, imageutil.ENCODING_PPM} {
+		out := codecRoundTrip(t, img, encoding, nil)
+		if diff := codecMaxDiff(img, out); diff != 0 {
+			t.Errorf("%d: expected lossless round trip, max difference is %d", encoding, diff)
+		}
+	}
+
+	gray := image.NewGray(img.Bounds())
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+
+	for _, encoding := range []imageutil.ImageEncoding{imageutil.ENCODING_PGM, imageutil.ENCODING_TGA} {
+		out := codecRoundTrip(t, gray, encoding, nil)
+		if _, ok := out.(*image.Gray); !ok {
+			t.Errorf("%d: expected gray image, got %T", encoding, out)
+		}
+		if diff := codecMaxDiff(gray, out); diff != 0 {
+			t.Errorf("%d: expected lossless round trip, max difference is %d", encoding, diff)
+		}
+	}
+}
+
+func TestCodecPNM16(t *testing.T) {
+	img := image.NewNRGBA64(image.Rect(0, 0, 8, 8))
+	for y := range 8 {
+		for x := range 8 {
+			img.SetNRGBA64(x, y, color.NRGBA64{uint16(x * 8191), uint16(y * 8191), 1234, 0xFFFF - uint16(x)})
+		}
+	}
+
+	out := codecRoundTrip(t, img, imageutil.ENCODING_PAM, nil)
+	if !imageutil.ImageCompare(img, out) {
+		t.Error("expected 16-bit pam to round trip")
+	}
+}
+
+func TestCodecPBM(t *testing.T) {
+	// an odd width so the rows need padding.
+	gray := image.NewGray(image.Rect(0, 0, 11, 3))
+	for i := range gray.Pix {
+		if i%3 == 0 {
+			gray.Pix[i] = 255
+		}
+	}
+
+	out := codecRoundTrip(t, gray, imageutil.ENCODING_PBM, nil)
+	if diff := codecMaxDiff(gray, out); diff != 0 {
+		t.Errorf("expected a black and white image to round trip, max difference is %d", diff)
+	}
+
+	if encoding := imageutil.ExtensionEncoding(".pbm"); encoding != imageutil.ENCODING_PBM {
+		t.Errorf("expected .pbm to encode as a bitmap, got %d", encoding)
+	}
+}
+
+func TestCodecPNMPlain(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		color color.Color
+	}{
+		{"pbm", "P1\n# comment\n2 2\n1 0\n0 1\n", color.Gray{0}},
+		{"pgm", "P2 2 2 15 15 0 0 15", color.Gray{255}},
+		{"ppm", "P3\n2 2\n255\n255 0 0  0 0 0\n0 0 0  0 0 0\n", color.RGBA{255, 0, 0, 255}},
+	}
+
+	for _, test := range tests {
+		img, err := imageutil.Decode(bytes.NewReader([]byte(test.data)), imageutil.ENCODING_AUTO)
+		if err != nil {
+			t.Fatalf("%s: failed to decode: %s", test.name, err)
+		}
+		if img.Bounds().Dx() != 2 || img.Bounds().Dy() != 2 {
+			t.Fatalf("%s: expected 2x2 image, got %s", test.name, img.Bounds())
+		}
+		if img.At(0, 0) != test.color {
+			t.Errorf("%s: expected %v at (0, 0), got %v", test.name, test.color, img.At(0, 0))
+		}
+	}
+}
+
+func TestCodecDDSCompressed(t *testing.T) {
+	img := gradientImage(37, 21, true)
+
+	bc3 := imageutil.DefaultEncodeOptions()
+	bc3.DDSFormat = imageutil.DDSFORMAT_BC3
+	out := codecRoundTrip(t, img, imageutil.ENCODING_DDS, bc3)
+	if diff := codecMaxDiff(img, out); diff > 48 {
+		t.Errorf("bc3: max difference is too large: %d", diff)
+	}
+
+	// bc1 only keeps 1-bit alpha, so check with an opaque image.
+	opaque := gradientImage(37, 21, false)
+	opaque.SetNRGBA(0, 0, color.NRGBA{})
+
+	bc1 := imageutil.DefaultEncodeOptions()
+	bc1.DDSFormat = imageutil.DDSFORMAT_BC1
+	out = codecRoundTrip(t, opaque, imageutil.ENCODING_DDS, bc1)
+
+	_, _, _, a := out.At(0, 0).RGBA()
+	if a != 0 {
+		t.Errorf("bc1: expected transparent pixel to be kept")
+	}
+	opaque.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	out.(*image.NRGBA).SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	if diff := codecMaxDiff(opaque, out); diff > 48 {
+		t.Errorf("bc1: max difference is too large: %d", diff)
+	}
+}
+
+// codecDecodeFails checks that crafted headers return an error instead of panicking.
+func codecDecodeFails(t *testing.T, name string, data []byte, encoding imageutil.ImageEncoding) {
+	t.Helper()
+
+	defer func() {
+		if p := recover(); p != nil {
+			t.Errorf("%s: decoder panicked: %v", name, p)
+		}
+	}()
+
+	if _, err := imageutil.Decode(bytes.NewReader(data), encoding); err == nil {
+		t.Errorf("%s: expected decode to fail", name)
+	}
+}
+
+func TestCodecQOIHugeSize(t *testing.T) {
+	data := append([]byte("qoif"), 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 4, 0)
+	codecDecodeFails(t, "qoi", data, imageutil.ENCODING_QOI)
+}
+
+func TestCodecPNMHugeSize(t *testing.T) {
+	codecDecodeFails(t, "pnm", []byte("P5\n4611686018427387904 4\n255\n"), imageutil.ENCODING_PGM)
+}
+
+func TestCodecDDSHugeSize(t *testing.T) {
+	header := make([]byte, 124)
+	binary.LittleEndian.PutUint32(header[0:], 124)
+	binary.LittleEndian.PutUint32(header[8:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(header[12:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(header[76:], 0x40)
+	binary.LittleEndian.PutUint32(header[84:], 32)
+
+	codecDecodeFails(t, "dds", append([]byte("DDS "), header...), imageutil.ENCODING_DDS)
+}
+
+func TestCodecTGAHugeSize(t *testing.T) {
+	data := make([]byte, 20)
+	data[2] = 2
+	binary.LittleEndian.PutUint16(data[12:], 0xFFFF)
+	binary.LittleEndian.PutUint16(data[14:], 0xFFFF)
+	data[16] = 32
+	data[17] = 0x08
+
+	codecDecodeFails(t, "tga", data, imageutil.ENCODING_TGA)
+
+	if _, _, err := imageutil.DecodeConfig(bytes.NewReader(data), imageutil.ENCODING_TGA); err == nil {
+		t.Error("tga: expected decode config to fail")
+	}
+}
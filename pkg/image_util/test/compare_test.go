@@ -0,0 +1,115 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestCIEDE2000(t *testing.T) {
+	// pairs from the Sharma, Wu and Dalal test data.
+	tests := []struct {
+		c1, c2   imageutil.Lab
+		expected float64
+	}{
+		{imageutil.Lab{L: 50, A: 2.6772, B: -79.7751}, imageutil.Lab{L: 50, A: 0, B: -82.7485}, 2.0425},
+		{imageutil.Lab{L: 50, A: 2.5, B: 0}, imageutil.Lab{L: 50, A: 0, B: -2.5}, 4.3065},
+		{imageutil.Lab{L: 50, A: 2.5, B: 0}, imageutil.Lab{L: 73, A: 25, B: -18}, 27.1492},
+		{imageutil.Lab{L: 2.0776, A: 0.0795, B: -1.1350}, imageutil.Lab{L: 0.9033, A: -0.0636, B: -0.5514}, 0.9082},
+	}
+
+	for _, test := range tests {
+		if d := imageutil.CIEDE2000(test.c1, test.c2); math.Abs(d-test.expected) > 1e-4 {
+			t.Errorf("unexpected delta-e for %+v and %+v: %f, expected %f", test.c1, test.c2, d, test.expected)
+		}
+	}
+
+	white := imageutil.ColorToLab(color.NRGBA{255, 255, 255, 255})
+	if math.Abs(white.L-100) > 1e-3 || math.Abs(white.A) > 1e-3 || math.Abs(white.B) > 1e-3 {
+		t.Errorf("unexpected lab for white: %+v", white)
+	}
+}
+
+func TestImageCompareMetricsEqual(t *testing.T) {
+	img1 := gradientImage(32, 32, false)
+	img2 := gradientImage(32, 32, false)
+	// transparent pixels are equal no matter their color.
+	img1.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 0})
+	img2.SetNRGBA(0, 0, color.NRGBA{0, 0, 255, 0})
+
+	r, diff, err := imageutil.ImageCompareMetrics(img1, img2, 0, true)
+	if err != nil {
+		t.Fatalf("failed to compare: %s", err)
+	}
+
+	if !math.IsInf(r.PSNR, 1) || math.Abs(r.SSIM-1) > 1e-9 || r.DeltaEMax != 0 || r.Differing != 0 {
+		t.Errorf("expected equal images, got %+v", r)
+	}
+	if diff.Rect != img1.Rect {
+		t.Errorf("unexpected diff size: %s", diff.Rect)
+	}
+	for i := 0; i < len(diff.Pix); i += 4 {
+		if diff.Pix[i] != diff.Pix[i+1] || diff.Pix[i+1] != diff.Pix[i+2] {
+			t.Fatalf("expected diff of equal images to be gray, got %v", diff.Pix[i:i+4])
+		}
+	}
+}
+
+func TestImageCompareMetrics(t *testing.T) {
+	img1 := gradientImage(32, 32, false)
+	img2 := gradientImage(32, 32, false)
+
+	// slight noise over the whole image, with a few very different pixels.
+	for i := 0; i < len(img2.Pix); i += 4 {
+		img2.Pix[i+2]++
+	}
+	img2.SetNRGBA(5, 5, color.NRGBA{255, 255, 255, 255})
+	img2.SetNRGBA(20, 10, color.NRGBA{0, 0, 0, 255})
+	img2.SetNRGBA(30, 30, color.NRGBA{0, 0, 0, 0})
+
+	r, diff, err := imageutil.ImageCompareMetrics(img1, img2, 5, true)
+	if err != nil {
+		t.Fatalf("failed to compare: %s", err)
+	}
+
+	if r.Differing != 3 {
+		t.Errorf("expected 3 differing pixels, got %d", r.Differing)
+	}
+	if r.PSNR < 20 || r.PSNR > 50 {
+		t.Errorf("unexpected psnr: %f", r.PSNR)
+	}
+	if r.SSIM > 0.99 || r.SSIM < 0.5 {
+		t.Errorf("unexpected ssim: %f", r.SSIM)
+	}
+	if r.DeltaEMax < 50 || r.DeltaEMean > 5 {
+		t.Errorf("unexpected delta-e: %f %f", r.DeltaEMean, r.DeltaEMax)
+	}
+
+	if c := diff.NRGBAAt(5, 5); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected differing pixel to be red, got %v", c)
+	}
+	if c := diff.NRGBAAt(6, 5); c != (color.NRGBA{255, 200, 0, 255}) {
+		t.Errorf("expected minor difference to be yellow, got %v", c)
+	}
+
+	tolerance := imageutil.DefaultCompareTolerance()
+	if err := tolerance.Check(r); err != nil {
+		t.Errorf("expected default tolerance to pass, got %s", err)
+	}
+	tolerance.MaxDiffering = 2
+	if err := tolerance.Check(r); err == nil {
+		t.Error("expected tolerance to fail with too many differing pixels")
+	}
+	tolerance = imageutil.DefaultCompareTolerance()
+	tolerance.MinPSNR = 60
+	if err := tolerance.Check(r); err == nil {
+		t.Error("expected tolerance to fail with a low psnr")
+	}
+
+	if _, _, err := imageutil.ImageCompareMetrics(img1, image.NewNRGBA(image.Rect(0, 0, 2, 2)), 0, false); err == nil {
+		t.Error("expected error for different sizes")
+	}
+}
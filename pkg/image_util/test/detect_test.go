@@ -0,0 +1,66 @@
+package image_util_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	img := gradientImage(64, 64, false)
+
+	for _, encoding := range []imageutil.ImageEncoding{
+		imageutil.ENCODING_PNG,
+		imageutil.ENCODING_JPEG,
+		imageutil.ENCODING_GIF,
+		imageutil.ENCODING_TIFF,
+		imageutil.ENCODING_BMP,
+		imageutil.ENCODING_ICO,
+		imageutil.ENCODING_CUR,
+		imageutil.ENCODING_WEBP,
+	} {
+		w := byteseeker.NewByteSeeker(1000, 1000)
+		err := imageutil.Encode(w, img, encoding, nil)
+		if err != nil {
+			t.Fatalf("failed to encode %d: %s", encoding, err)
+		}
+		// the ico encoder seeks back to write the header.
+		w.Seek(0, io.SeekEnd)
+
+		detected := imageutil.DetectEncoding(w.Bytes())
+		if detected != encoding {
+			t.Errorf("expected encoding %d, got %d", encoding, detected)
+		}
+
+		// go-ico can't decode the opaque png entries that it encodes.
+		if encoding == imageutil.ENCODING_ICO || encoding == imageutil.ENCODING_CUR {
+			continue
+		}
+
+		out, err := imageutil.Decode(bytes.NewReader(w.Bytes()), imageutil.ENCODING_AUTO)
+		if err != nil {
+			t.Errorf("failed to decode %d with auto encoding: %s", encoding, err)
+		} else if out.Bounds() != img.Bounds() {
+			t.Errorf("expected bounds %s for %d, got %s", img.Bounds(), encoding, out.Bounds())
+		}
+
+		width, height, err := imageutil.DecodeConfig(bytes.NewReader(w.Bytes()), imageutil.ENCODING_AUTO)
+		if err != nil || width != img.Bounds().Dx() || height != img.Bounds().Dy() {
+			t.Errorf("failed to decode config for %d with auto encoding: %d %d %v", encoding, width, height, err)
+		}
+	}
+}
+
+func TestDetectEncodingUnknown(t *testing.T) {
+	if e := imageutil.DetectEncoding([]byte("not an image")); e != imageutil.ENCODING_UNKNOWN {
+		t.Errorf("expected unknown encoding, got %d", e)
+	}
+
+	_, err := imageutil.Decode(bytes.NewReader([]byte("not an image")), imageutil.ENCODING_AUTO)
+	if err == nil {
+		t.Error("expected error when the encoding can't be detected")
+	}
+}
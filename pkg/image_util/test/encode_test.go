@@ -0,0 +1,111 @@
+package image_util_test
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func encodeSize(t *testing.T, img image.Image, encoding imageutil.ImageEncoding, options *imageutil.EncodeOptions) int {
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, img, encoding, options)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	return len(w.Bytes())
+}
+
+func TestEncodeJPEGQuality(t *testing.T) {
+	img := gradientImage(64, 64, false)
+
+	low := imageutil.DefaultEncodeOptions()
+	low.JPEGQuality = 10
+	high := imageutil.DefaultEncodeOptions()
+	high.JPEGQuality = 100
+
+	lowSize := encodeSize(t, img, imageutil.ENCODING_JPEG, low)
+	highSize := encodeSize(t, img, imageutil.ENCODING_JPEG, high)
+
+	if lowSize >= highSize {
+		t.Errorf("expected lower quality to be smaller, low=%d high=%d", lowSize, highSize)
+	}
+}
+
+func TestEncodeGIFColors(t *testing.T) {
+	img := gradientImage(64, 64, false)
+
+	opts := imageutil.DefaultEncodeOptions()
+	opts.GIFColors = 4
+	opts.GIFQuantizer = imageutil.GIFQUANTIZER_MEDIANCUT
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, img, imageutil.ENCODING_GIF, opts)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	out, err := imageutil.Decode(bytes.NewReader(w.Bytes()), imageutil.ENCODING_GIF)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+
+	pal, ok := out.(*image.Paletted)
+	if !ok {
+		t.Fatalf("expected paletted image, got %T", out)
+	}
+	if len(pal.Palette) > 4 {
+		t.Errorf("expected at most 4 colors, got %d", len(pal.Palette))
+	}
+}
+
+func TestEncodeGIFColorsPlan9(t *testing.T) {
+	opts := imageutil.DefaultEncodeOptions()
+	opts.GIFColors = 4
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, gradientImage(64, 64, false), imageutil.ENCODING_GIF, opts)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	out, err := imageutil.Decode(bytes.NewReader(w.Bytes()), imageutil.ENCODING_GIF)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+
+	// the first 4 colors of the plan9 palette are black and dark blues.
+	for _, c := range out.(*image.Paletted).Palette {
+		if r, _, _, _ := c.RGBA(); r > 0x8000 {
+			return
+		}
+	}
+	t.Errorf("expected the palette to be quantized from the image, got %v", out.(*image.Paletted).Palette)
+}
+
+func TestEncodeOptionsValidate(t *testing.T) {
+	opts := imageutil.DefaultEncodeOptions()
+	if err := opts.Validate(); err != nil {
+		t.Errorf("default options should be valid: %s", err)
+	}
+
+	opts.JPEGQuality = 0
+	if err := opts.Validate(); err == nil {
+		t.Error("expected error for jpeg quality of 0")
+	}
+
+	opts = imageutil.DefaultEncodeOptions()
+	opts.GIFColors = 300
+	if err := opts.Validate(); err == nil {
+		t.Error("expected error for 300 gif colors")
+	}
+
+	opts = imageutil.DefaultEncodeOptions()
+	opts.PNGCompression = 5
+	if err := opts.Validate(); err == nil {
+		t.Error("expected error for an unknown png compression")
+	}
+}
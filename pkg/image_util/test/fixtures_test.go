@@ -0,0 +1,163 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// gradientImage is the general purpose test image, red increases across x, green across y and blue is a pattern of both.
+// With alpha the image fades from opaque on the left to an alpha of 147 on the right.
+// The middle row is a single color, to exercise run length encodings.
+func gradientImage(w, h int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := range h {
+		for x := range w {
+			c := color.NRGBA{uint8(x * 255 / max(w-1, 1)), uint8(y * 255 / max(h-1, 1)), uint8(128 + (x^y)*2), 255}
+			if alpha {
+				c.A = uint8(255 - x*108/max(w-1, 1))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	for x := range w {
+		img.SetNRGBA(x, h/2, color.NRGBA{10, 20, 30, 255})
+	}
+
+	return img
+}
+
+// grayGradientImage goes from black on the left to white on the right, with a transparent top row.
+func grayGradientImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 1; y < h; y++ {
+		for x := range w {
+			v := uint8(x * 255 / max(w-1, 1))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	return img
+}
+
+// checkerImage alternates black and white pixels, the worst case for downsampling.
+func checkerImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := range h {
+		for x := range w {
+			if (x+y)%2 == 0 {
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+			}
+		}
+	}
+
+	return img
+}
+
+// blobImage draws a few overlapping circles, scaled to the given size.
+func blobImage(size int, brightness int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+
+	for y := range size {
+		for x := range size {
+			fx, fy := float64(x)/float64(size), float64(y)/float64(size)
+			v := 40
+			if math.Hypot(fx-0.3, fy-0.3) < 0.2 {
+				v = 220
+			}
+			if math.Hypot(fx-0.7, fy-0.6) < 0.25 {
+				v = 140
+			}
+			v = min(max(v+int(fx*30)+brightness, 0), 255)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(v / 2), 90, 255})
+		}
+	}
+
+	return img
+}
+
+// domeImage is a height map with a smooth bump in the center.
+func domeImage(size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	c := float64(size-1) / 2
+
+	for y := range size {
+		for x := range size {
+			d := math.Hypot(float64(x)-c, float64(y)-c) / c
+			v := uint8(math.Round(math.Max(0, 1-d*d) * 255))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	return img
+}
+
+// pixelArtImage is 8x8 with a red diagonal line and a blue square in the bottom right.
+func pixelArtImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+
+	for i := range 5 {
+		img.SetNRGBA(i, i, color.NRGBA{255, 0, 0, 255})
+	}
+	for y := 5; y < 8; y++ {
+		for x := 5; x < 8; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{0, 0, 255, 255})
+		}
+	}
+	// a transparent pixel with a color, this should still match the other transparent pixels.
+	img.SetNRGBA(7, 0, color.NRGBA{0, 255, 0, 0})
+
+	return img
+}
+
+// nineSliceImage is 8x8 with red corners, green edges and a blue center,
+// using insets of 2 on every side. The first row and column after the corners are marked to show tiling.
+func nineSliceImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+
+	for y := range 8 {
+		for x := range 8 {
+			edgeX := x < 2 || x >= 6
+			edgeY := y < 2 || y >= 6
+
+			var c color.NRGBA
+			switch {
+			case edgeX && edgeY:
+				c = color.NRGBA{255, 0, 0, 255}
+			case edgeX || edgeY:
+				c = color.NRGBA{0, 255, 0, 255}
+			default:
+				c = color.NRGBA{0, 0, 255, 255}
+			}
+			if x == 2 || y == 2 {
+				c.R = 100
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// palettedImage is 8x8 and cycles through a 4 color palette, the first color is transparent.
+func palettedImage() *image.Paletted {
+	pal := color.Palette{
+		color.RGBA{0, 0, 0, 0},
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 255, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, 8, 8), pal)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i % len(pal))
+	}
+
+	return img
+}
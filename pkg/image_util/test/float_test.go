@@ -0,0 +1,281 @@
+package image_util_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func floatClose(a, b, tolerance float32) bool {
+	return math.Abs(float64(a-b)) <= float64(tolerance)
+}
+
+func TestRGBAF32Convert(t *testing.T) {
+	img := gradientImage(37, 21, true)
+
+	f := imageutil.CopyImage(img, imageutil.MODEL_RGBAF32)
+	if _, model := imageutil.Limit(f, imageutil.MODEL_NRGBA); model != imageutil.MODEL_RGBAF32 {
+		t.Errorf("expected limit to keep the float model, got %d", model)
+	}
+
+	out := imageutil.CopyImage(f, imageutil.MODEL_NRGBA)
+	if diff := codecMaxDiff(img, out); diff != 0 {
+		t.Errorf("expected lossless round trip through float, max difference is %d", diff)
+	}
+
+	c := f.(*imageutil.RGBAF32).RGBAF32At(0, 10)
+	r, _, _, a := c.NRGBA()
+	if !floatClose(r, float32(imageutil.SRGBToLinear(10.0/255)), 1e-4) || a != 1 {
+		t.Errorf("expected the float color to be in linear light, got %f %f", r, a)
+	}
+}
+
+func TestRGBAF32Copy(t *testing.T) {
+	img := imageutil.FilterF32(gradientImage(37, 21, true), imageutil.FilterF32Exposure(2))
+
+	sub := imageutil.SubImage(img, 10, 5, 30, 15, true).(*imageutil.RGBAF32)
+	if sub.Bounds() != image.Rect(0, 0, 20, 10) {
+		t.Fatalf("unexpected sub image bounds: %s", sub.Bounds())
+	}
+
+	want := img.RGBAF32At(30-1, 15-1)
+	if got := sub.RGBAF32At(19, 9); got != want {
+		t.Errorf("expected float values to be copied exactly, got %v want %v", got, want)
+	}
+	if want.R <= 1 {
+		t.Fatalf("expected a test value above 1, got %f", want.R)
+	}
+
+	imageutil.Set(sub, 0, 0, 255, 0, 0, 255)
+	if got := sub.RGBAF32At(0, 0); got != (imageutil.ColorRGBAF32{R: 1, A: 1}) {
+		t.Errorf("expected set to store linear red, got %v", got)
+	}
+}
+
+func TestHDRRoundTrip(t *testing.T) {
+	for _, width := range []int{5, 37} {
+		img := imageutil.NewRGBAF32(image.Rect(0, 0, width, 9))
+		for y := range 9 {
+			for x := range width {
+				img.SetRGBAF32(x, y, imageutil.ColorRGBAF32{R: float32(x) * 10, G: float32(y) / 10, B: 0.25, A: 1})
+			}
+		}
+
+		out := codecRoundTrip(t, img, imageutil.ENCODING_HDR, nil).(*imageutil.RGBAF32)
+
+		for y := range 9 {
+			for x := range width {
+				want := img.RGBAF32At(x, y)
+				got := out.RGBAF32At(x, y)
+				// rgbe shares an 8 bit mantissa across the channels.
+				tolerance := max(want.R, want.G, want.B) / 128
+				if !floatClose(got.R, want.R, tolerance) || !floatClose(got.G, want.G, tolerance) || !floatClose(got.B, want.B, tolerance) || got.A != 1 {
+					t.Fatalf("width %d: expected %v at %d,%d, got %v", width, want, x, y, got)
+				}
+			}
+		}
+	}
+}
+
+func TestEXRRoundTrip(t *testing.T) {
+	img := imageutil.FilterF32(gradientImage(37, 21, true), imageutil.FilterF32Exposure(2))
+
+	zip := imageutil.DefaultEncodeOptions()
+	zip.EXRZip = true
+
+	for _, options := range []*imageutil.EncodeOptions{nil, zip} {
+		out := codecRoundTrip(t, img, imageutil.ENCODING_EXR, options).(*imageutil.RGBAF32)
+
+		for y := range 21 {
+			for x := range 37 {
+				if want, got := img.RGBAF32At(x, y), out.RGBAF32At(x, y); want != got {
+					t.Fatalf("expected %v at %d,%d, got %v", want, x, y, got)
+				}
+			}
+		}
+	}
+}
+
+// exrHalfGray builds an uncompressed exr with a single half Y channel and a data window starting at 4,2.
+func exrHalfGray(values []uint16) []byte {
+	buf := []byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0}
+	attribute := func(name, typ string, value []byte) {
+		buf = append(buf, name+"\x00"+typ+"\x00"...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(value)))
+		buf = append(buf, value...)
+	}
+
+	chlist := append([]byte("Y\x00"), 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0)
+	window := binary.LittleEndian.AppendUint32(nil, 4)
+	window = binary.LittleEndian.AppendUint32(window, 2)
+	window = binary.LittleEndian.AppendUint32(window, uint32(4+len(values)-1))
+	window = binary.LittleEndian.AppendUint32(window, 2)
+
+	attribute("channels", "chlist", chlist)
+	attribute("compression", "compression", []byte{0})
+	attribute("dataWindow", "box2i", window)
+	buf = append(buf, 0)
+
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(buf)+8))
+	buf = binary.LittleEndian.AppendUint32(buf, 2)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(values)*2))
+	for _, v := range values {
+		buf = binary.LittleEndian.AppendUint16(buf, v)
+	}
+
+	return buf
+}
+
+func TestEXRHalf(t *testing.T) {
+	data := exrHalfGray([]uint16{0x3c00, 0x4500, 0xc000, 0x0001})
+
+	if encoding := imageutil.DetectEncoding(data); encoding != imageutil.ENCODING_EXR {
+		t.Errorf("expected exr to be detected, got %d", encoding)
+	}
+
+	img, err := imageutil.Decode(bytes.NewReader(data), imageutil.ENCODING_EXR)
+	if err != nil {
+		t.Fatalf("failed to decode exr: %s", err)
+	}
+
+	out := img.(*imageutil.RGBAF32)
+	if out.Bounds() != image.Rect(0, 0, 4, 1) {
+		t.Fatalf("expected the data window to start at 0,0, got %s", out.Bounds())
+	}
+
+	for x, want := range []float32{1, 5, -2, float32(math.Ldexp(1, -24))} {
+		c := out.RGBAF32At(x, 0)
+		if c.R != want || c.G != want || c.B != want || c.A != 1 {
+			t.Errorf("expected gray %g at %d, got %v", want, x, c)
+		}
+	}
+}
+
+func TestHDRHugeSize(t *testing.T) {
+	data := append([]byte("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 2305843009213693952 +X 8\n"), make([]byte, 32)...)
+	codecDecodeFails(t, "hdr", data, imageutil.ENCODING_HDR)
+}
+
+func TestEXRHugeSize(t *testing.T) {
+	data := exrHalfGray([]uint16{0x3c00})
+	window := bytes.Index(data, []byte("dataWindow\x00box2i\x00")) + len("dataWindow\x00box2i\x00") + 4
+
+	// a window 2^32 pixels wide.
+	wide := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(wide[window:], 0x80000000)
+	binary.LittleEndian.PutUint32(wide[window+8:], 0x7fffffff)
+	codecDecodeFails(t, "exr wide", wide, imageutil.ENCODING_EXR)
+
+	// a window taller than the offset table that follows the header.
+	tall := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(tall[window+12:], 1<<20)
+	codecDecodeFails(t, "exr tall", tall, imageutil.ENCODING_EXR)
+}
+
+func TestToneMap(t *testing.T) {
+	img := imageutil.NewRGBAF32(image.Rect(0, 0, 2, 1))
+	img.SetRGBAF32(0, 0, imageutil.ColorRGBAF32{R: 1, G: 1, B: 1, A: 1})
+	img.SetRGBAF32(1, 0, imageutil.ColorRGBAF32{R: 1000, G: 1000, B: 1000, A: 1})
+
+	opts := imageutil.DefaultToneMapOptions()
+	out, err := imageutil.ToneMap(img, opts)
+	if err != nil {
+		t.Fatalf("failed to tone map: %s", err)
+	}
+	if c := out.RGBAF32At(0, 0); !floatClose(c.R, 0.5, 1e-6) || !floatClose(c.B, 0.5, 1e-6) {
+		t.Errorf("expected reinhard to map 1 to 0.5, got %v", c)
+	}
+	if c := out.RGBAF32At(1, 0); c.R >= 1 || c.R < 0.99 {
+		t.Errorf("expected reinhard to map bright values just below 1, got %v", c)
+	}
+
+	opts.White = 1
+	opts.Exposure = -1
+	out, _ = imageutil.ToneMap(img, opts)
+	// 0.5 * (1 + 0.5) / (1 + 0.5)
+	if c := out.RGBAF32At(0, 0); !floatClose(c.R, 0.5, 1e-6) {
+		t.Errorf("expected exposure to halve the input, got %v", c)
+	}
+	if c := out.RGBAF32At(1, 0); c.R != 1 {
+		t.Errorf("expected values above white to clamp to 1, got %v", c)
+	}
+
+	opts = imageutil.DefaultToneMapOptions()
+	opts.Operator = imageutil.TONEMAP_ACES
+	out, _ = imageutil.ToneMap(img, opts)
+	if c := out.RGBAF32At(0, 0); !floatClose(c.G, 0.8038, 1e-3) {
+		t.Errorf("expected aces to map 1 to about 0.8, got %v", c)
+	}
+	if c := out.RGBAF32At(1, 0); c.G != 1 {
+		t.Errorf("expected aces to clamp bright values to 1, got %v", c)
+	}
+
+	opts.Operator = 5
+	if _, err := imageutil.ToneMap(img, opts); err == nil {
+		t.Errorf("expected an invalid operator to fail")
+	}
+}
+
+func TestBlendF32(t *testing.T) {
+	bg := imageutil.NewRGBAF32(image.Rect(0, 0, 3, 2))
+	fg := imageutil.NewRGBAF32(image.Rect(0, 0, 2, 3))
+	for y := range 3 {
+		for x := range 3 {
+			bg.SetRGBAF32(x, y, imageutil.ColorRGBAF32{R: 0.75, G: 0.5, B: 2, A: 1})
+			fg.SetRGBAF32(x, y, imageutil.NewColorRGBAF32(0.75, 0.25, 0, 0.5))
+		}
+	}
+
+	out := imageutil.BlendF32(bg, fg, imageutil.BlendAdd)
+	if out.Bounds() != image.Rect(0, 0, 2, 2) {
+		t.Fatalf("expected the overlapping size, got %s", out.Bounds())
+	}
+
+	c := out.RGBAF32At(1, 1)
+	want := imageutil.ColorRGBAF32{R: 1.125, G: 0.625, B: 2, A: 1}
+	if !floatClose(c.R, want.R, 1e-6) || !floatClose(c.G, want.G, 1e-6) || !floatClose(c.B, want.B, 1e-6) || c.A != want.A {
+		t.Errorf("expected add to keep values above 1, got %v want %v", c, want)
+	}
+}
+
+func TestFilterF32(t *testing.T) {
+	img := imageutil.NewRGBAF32(image.Rect(0, 0, 2, 1))
+	img.SetRGBAF32(0, 0, imageutil.NewColorRGBAF32(4, 2, 0.5, 0.5))
+	img.SetRGBAF32(1, 0, imageutil.ColorRGBAF32{R: 3, G: 3, B: 3, A: 1})
+
+	// each pair undoes itself, so the values only survive when nothing clamps between filters.
+	out := imageutil.FilterF32(img,
+		imageutil.FilterF32Exposure(2),
+		imageutil.FilterF32Brightness(20),
+		imageutil.FilterF32Hue(90),
+		imageutil.FilterF32Gamma(2),
+		imageutil.FilterF32Gamma(0.5),
+		imageutil.FilterF32Hue(-90),
+		imageutil.FilterF32Brightness(-20),
+		imageutil.FilterF32Exposure(-2),
+	)
+	for x := range 2 {
+		want := img.RGBAF32At(x, 0)
+		c := out.RGBAF32At(x, 0)
+		if !floatClose(c.R, want.R, 1e-3) || !floatClose(c.G, want.G, 1e-3) || !floatClose(c.B, want.B, 1e-3) || c.A != want.A {
+			t.Errorf("expected values above 1 to survive the chain at %d, got %v want %v", x, c, want)
+		}
+	}
+
+	out = imageutil.FilterF32(img,
+		imageutil.FilterF32Contrast(50),
+		imageutil.FilterF32Saturation(50),
+		imageutil.FilterF32Hue(45),
+	)
+	r, g, b, _ := out.RGBAF32At(0, 0).NRGBA()
+	if max(r, g, b) <= 4 {
+		t.Errorf("expected contrast and saturation to push the brightest channel further above 1, got %f %f %f", r, g, b)
+	}
+	if c := out.RGBAF32At(1, 0); !floatClose(c.R, c.G, 1e-4) || !floatClose(c.G, c.B, 1e-4) || c.R <= 3 {
+		t.Errorf("expected gray to stay gray and above 1, got %v", c)
+	}
+}
@@ -0,0 +1,83 @@
+package image_util_test
+
+import (
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestImageHash(t *testing.T) {
+	src := blobImage(128, 0)
+	similar := blobImage(97, 12)
+
+	different := blobImage(128, 0)
+	for y := range 128 {
+		for x := range 128 {
+			c := different.NRGBAAt(x, y)
+			different.SetNRGBA(127-y, x, color.NRGBA{255 - c.R, c.G, c.B, 255})
+		}
+	}
+
+	for _, hash := range imageutil.HashList {
+		h := imageutil.ImageHash(src, hash)
+
+		if h == 0 || h == math.MaxUint64 {
+			t.Errorf("expected hash %d to have mixed bits, got %016x", hash, h)
+		}
+		if d := imageutil.HashDistance(h, imageutil.ImageHash(src, hash)); d != 0 {
+			t.Errorf("expected hash %d to be stable, got distance %d", hash, d)
+		}
+		if d := imageutil.HashDistance(h, imageutil.ImageHash(similar, hash)); d > 8 {
+			t.Errorf("expected resized image to be similar for %d, got distance %d", hash, d)
+		}
+		if d := imageutil.HashDistance(h, imageutil.ImageHash(different, hash)); d < 16 {
+			t.Errorf("expected rotated and inverted image to differ for %d, got distance %d", hash, d)
+		}
+	}
+}
+
+func TestHashString(t *testing.T) {
+	s := imageutil.HashString(0x00ff00000000abcd)
+	if s != "00ff00000000abcd" {
+		t.Errorf("unexpected hash string: %s", s)
+	}
+
+	h, err := imageutil.HashParse(s)
+	if err != nil || h != 0x00ff00000000abcd {
+		t.Errorf("unexpected parsed hash: %x, %v", h, err)
+	}
+
+	if _, err := imageutil.HashParse("not a hash"); err == nil {
+		t.Error("expected error for invalid hash")
+	}
+}
+
+func TestHashGroup(t *testing.T) {
+	hashes := []uint64{
+		0b0000,
+		0xffff0000,
+		0b0011,
+		0xffff0001,
+		0xff00ff00ff00,
+		0b1111,
+	}
+
+	groups := imageutil.HashGroup(hashes, 2)
+	expected := [][]int{{0, 2, 5}, {1, 3}}
+
+	if len(groups) != len(expected) {
+		t.Fatalf("unexpected groups: %v", groups)
+	}
+	for i, g := range groups {
+		if !slices.Equal(g, expected[i]) {
+			t.Errorf("unexpected group %d: %v, expected %v", i, g, expected[i])
+		}
+	}
+
+	if groups := imageutil.HashGroup(hashes, 0); len(groups) != 0 {
+		t.Errorf("expected no groups with a threshold of 0, got %v", groups)
+	}
+}
@@ -0,0 +1,164 @@
+package image_util_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"runtime"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func limitsCheck(t *testing.T, name string, err error, limit string) {
+	t.Helper()
+
+	var lerr *imageutil.DecodeLimitError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("%s: expected a decode limit error, got: %v", name, err)
+	}
+	if lerr.Limit != limit {
+		t.Errorf("%s: expected limit %s, got %s", name, limit, lerr.Limit)
+	}
+}
+
+// pngBomb is a png header claiming a huge image, the decoder would allocate for it before reading any pixel data.
+func pngBomb() []byte {
+	buf := &bytes.Buffer{}
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	b := buf.Bytes()
+
+	// width and height in the IHDR chunk, followed by its crc.
+	copy(b[16:24], []byte{0, 1, 0, 0, 0, 1, 0, 0})
+	binary.BigEndian.PutUint32(b[29:33], crc32.ChecksumIEEE(b[12:29]))
+	return b
+}
+
+func TestDecodeLimitsMerge(t *testing.T) {
+	global := imageutil.DecodeLimits{MaxPixels: 100, MaxBytes: 0, MaxFrames: 10}
+	call := imageutil.DecodeLimits{MaxPixels: 1000, MaxBytes: 50, MaxFrames: 0}
+
+	limits := global.Merge(call)
+	if limits.MaxPixels != 100 || limits.MaxBytes != 50 || limits.MaxFrames != 10 {
+		t.Errorf("expected the stricter limits, got %+v", limits)
+	}
+}
+
+func TestDecodeLimitsPixels(t *testing.T) {
+	_, err := imageutil.DecodeLimited(bytes.NewReader(pngBomb()), imageutil.ENCODING_PNG, imageutil.DecodeLimits{MaxPixels: 1 << 24})
+	limitsCheck(t, "png", err, "max_pixels")
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err = imageutil.Encode(w, gradientImage(64, 64, false), imageutil.ENCODING_PNG, nil)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	_, err = imageutil.DecodeLimited(bytes.NewReader(w.Bytes()), imageutil.ENCODING_AUTO, imageutil.DecodeLimits{MaxPixels: 64 * 64})
+	if err != nil {
+		t.Errorf("expected image within limits to decode: %s", err)
+	}
+}
+
+// pngChunkBomb is a paletted png with a data chunk claiming a huge length between the IHDR and PLTE chunks.
+func pngChunkBomb() []byte {
+	buf := &bytes.Buffer{}
+	png.Encode(buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White}))
+	b := buf.Bytes()
+
+	chunk := make([]byte, 24)
+	binary.BigEndian.PutUint32(chunk[0:4], 1<<31-1)
+	copy(chunk[4:8], "iscL")
+
+	// the signature is 8 bytes and the IHDR chunk is 25 bytes.
+	return append(append(append([]byte{}, b[:33]...), chunk...), b[33:]...)
+}
+
+func TestDecodeLimitsPNGChunkLength(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// the chunk is truncated, so both fail, but only after reading the data that exists.
+	err := imageutil.DecodeLimits{MaxPixels: 64}.Check(bytes.NewReader(pngChunkBomb()), imageutil.ENCODING_PNG)
+	if err == nil {
+		t.Error("expected check to fail")
+	}
+
+	_, err = imageutil.Decode(bytes.NewReader(pngChunkBomb()), imageutil.ENCODING_PNG)
+	if err == nil {
+		t.Error("expected decode to fail")
+	}
+
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<24 {
+		t.Errorf("allocated %d bytes for a chunk that was not in the data", alloc)
+	}
+}
+
+func TestDecodeLimitsBytes(t *testing.T) {
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, gradientImage(64, 64, false), imageutil.ENCODING_PNG, nil)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	_, err = imageutil.DecodeLimited(bytes.NewReader(w.Bytes()), imageutil.ENCODING_PNG, imageutil.DecodeLimits{MaxBytes: 100})
+	limitsCheck(t, "png", err, "max_bytes")
+
+	_, err = imageutil.DecodeLimits{MaxBytes: 100}.ReadAll(bytes.NewReader(w.Bytes()))
+	limitsCheck(t, "read", err, "max_bytes")
+}
+
+func TestDecodeLimitsFrames(t *testing.T) {
+	anim := animationTest()
+
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.APNGEncode(w, anim, nil)
+	if err != nil {
+		t.Fatalf("failed to encode apng: %s", err)
+	}
+	_, err = imageutil.APNGDecode(bytes.NewReader(w.Bytes()), imageutil.DecodeLimits{MaxFrames: 1})
+	limitsCheck(t, "apng", err, "max_frames")
+	_, err = imageutil.APNGDecode(bytes.NewReader(w.Bytes()), imageutil.DecodeLimits{MaxPixels: 100})
+	limitsCheck(t, "apng", err, "max_pixels")
+
+	w = byteseeker.NewByteSeeker(1000, 1000)
+	err = imageutil.WebPAnimEncode(w, anim, nil)
+	if err != nil {
+		t.Fatalf("failed to encode webp: %s", err)
+	}
+	_, err = imageutil.WebPAnimDecode(bytes.NewReader(w.Bytes()), imageutil.DecodeLimits{MaxFrames: 1})
+	limitsCheck(t, "webp", err, "max_frames")
+
+	palette := color.Palette{color.Black, color.White}
+	gf := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 8, 8), palette),
+			image.NewPaletted(image.Rect(0, 0, 8, 8), palette),
+			image.NewPaletted(image.Rect(0, 0, 8, 8), palette),
+		},
+		Delay: []int{0, 0, 0},
+	}
+	buf := &bytes.Buffer{}
+	err = gif.EncodeAll(buf, gf)
+	if err != nil {
+		t.Fatalf("failed to encode gif: %s", err)
+	}
+
+	_, err = imageutil.GIFDecodeAll(bytes.NewReader(buf.Bytes()), imageutil.DecodeLimits{MaxFrames: 2})
+	limitsCheck(t, "gif", err, "max_frames")
+
+	out, err := imageutil.GIFDecodeAll(bytes.NewReader(buf.Bytes()), imageutil.DecodeLimits{MaxFrames: 3})
+	if err != nil {
+		t.Fatalf("expected gif within limits to decode: %s", err)
+	}
+	if len(out.Image) != 3 {
+		t.Errorf("expected 3 frames, got %d", len(out.Image))
+	}
+}
@@ -0,0 +1,169 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestLUTCubeDecode(t *testing.T) {
+	data := `# inverts the colors
+TITLE "Invert"
+DOMAIN_MIN 0 0 0
+DOMAIN_MAX 1 1 1
+LUT_3D_SIZE 2
+
+1 1 1
+0 1 1
+1 0 1
+0 0 1
+1 1 0
+0 1 0
+1 0 0
+0 0 0
+`
+
+	l, err := imageutil.LUTCubeDecode(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if l.Title != "Invert" || l.Size != 2 || l.Size1D != 0 {
+		t.Fatalf("unexpected lut header: %q %d %d", l.Title, l.Size, l.Size1D)
+	}
+
+	src := gradientImage(16, 16, true)
+	src.SetNRGBA(0, 0, color.NRGBA{})
+	want := src.NRGBAAt(3, 5)
+	want = color.NRGBA{255 - want.R, 255 - want.G, 255 - want.B, want.A}
+
+	for _, interp := range imageutil.LUTInterpolationList {
+		out := l.Apply(src, interp, 1)
+
+		c := color.NRGBAModel.Convert(out.At(3, 5)).(color.NRGBA)
+		if c != want {
+			t.Errorf("unexpected inverted color for %d: %v, expected %v", interp, c, want)
+		}
+		if c := out.NRGBA64At(0, 0); c != (color.NRGBA64{}) {
+			t.Errorf("expected transparent pixel to be unchanged for %d, got %v", interp, c)
+		}
+	}
+}
+
+func TestLUTCubeDecode1D(t *testing.T) {
+	data := "LUT_1D_SIZE 3\nLUT_3D_SIZE 2\n" +
+		// a shaper that squares the input.
+		"0 0 0\n0.25 0.25 0.25\n1 1 1\n" +
+		"0 0 0\n1 0 0\n0 1 0\n1 1 0\n0 0 1\n1 0 1\n0 1 1\n1 1 1\n"
+
+	l, err := imageutil.LUTCubeDecode(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if l.Size1D != 3 || l.Size != 2 {
+		t.Fatalf("unexpected sizes: %d %d", l.Size1D, l.Size)
+	}
+
+	c := l.Lookup([3]float64{0.5, 0.75, 1}, imageutil.LUTINTERPOLATION_TRILINEAR)
+	expected := [3]float64{0.25, 0.625, 1}
+	for i := range 3 {
+		if math.Abs(c[i]-expected[i]) > 1e-6 {
+			t.Errorf("unexpected shaped color: %v, expected %v", c, expected)
+			break
+		}
+	}
+}
+
+func TestLUTCubeDecodeInvalid(t *testing.T) {
+	invalid := []string{
+		"LUT_3D_SIZE 2\n0 0 0\n",
+		"LUT_3D_SIZE 1\n0 0 0\n",
+		"0 0 0\n",
+		"LUT_3D_SIZE 2\nUNKNOWN 1\n",
+		"LUT_3D_SIZE 2\n0 0\n",
+		"LUT_1D_SIZE 2\nDOMAIN_MIN 1 1 1\nDOMAIN_MAX 0 0 0\n0 0 0\n1 1 1\n",
+		"LUT_1D_SIZE 2\nLUT_3D_SIZE -1\n0 0 0\n",
+		"LUT_1D_SIZE -3\n0 0 0\n",
+		"LUT_3D_SIZE 1e30\n0 0 0\n",
+	}
+
+	for _, data := range invalid {
+		if _, err := imageutil.LUTCubeDecode(strings.NewReader(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestLUTIdentity(t *testing.T) {
+	src := gradientImage(16, 16, true)
+	src.SetNRGBA(0, 0, color.NRGBA{})
+
+	l, err := imageutil.NewLUT(17)
+	if err != nil {
+		t.Fatalf("failed to create lut: %s", err)
+	}
+
+	for _, interp := range imageutil.LUTInterpolationList {
+		out := l.Apply(src, interp, 1)
+
+		for y := range 16 {
+			for x := range 16 {
+				c := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA)
+				if c != src.NRGBAAt(x, y) {
+					t.Fatalf("expected identity lut to keep colors for %d at %d,%d: %v, got %v", interp, x, y, src.NRGBAAt(x, y), c)
+				}
+			}
+		}
+	}
+}
+
+func TestLUTHald(t *testing.T) {
+	hald, err := imageutil.LUTHaldIdentity(4)
+	if err != nil {
+		t.Fatalf("failed to create haldclut: %s", err)
+	}
+	if hald.Rect != image.Rect(0, 0, 64, 64) {
+		t.Fatalf("unexpected haldclut size: %s", hald.Rect)
+	}
+
+	l, err := imageutil.LUTHaldDecode(hald)
+	if err != nil {
+		t.Fatalf("failed to decode haldclut: %s", err)
+	}
+
+	identity, _ := imageutil.NewLUT(16)
+	if l.Size != 16 || len(l.Table) != len(identity.Table) {
+		t.Fatalf("unexpected haldclut lut size: %d", l.Size)
+	}
+	for i, v := range l.Table {
+		if math.Abs(float64(v-identity.Table[i])) > 1e-4 {
+			t.Fatalf("expected haldclut identity to match at %d: %f, got %f", i, identity.Table[i], v)
+		}
+	}
+
+	if _, err := imageutil.LUTHaldDecode(image.NewNRGBA(image.Rect(0, 0, 60, 60))); err == nil {
+		t.Error("expected error for an invalid haldclut size")
+	}
+	if _, err := imageutil.LUTHaldIdentity(1); err == nil {
+		t.Error("expected error for an invalid haldclut level")
+	}
+}
+
+func TestLUTStrength(t *testing.T) {
+	l, err := imageutil.LUTCubeDecode(strings.NewReader("LUT_1D_SIZE 2\n1 1 1\n0 0 0\n"))
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 100, 255})
+
+	out := l.Apply(src, imageutil.LUTINTERPOLATION_TRILINEAR, 0.5)
+	c := color.NRGBAModel.Convert(out.At(0, 0)).(color.NRGBA)
+	if c != (color.NRGBA{128, 128, 128, 255}) {
+		t.Errorf("expected half strength invert to be gray, got %v", c)
+	}
+}
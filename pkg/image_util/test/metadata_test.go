@@ -0,0 +1,157 @@
+package image_util_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func metadataTest() *imageutil.Metadata {
+	return &imageutil.Metadata{
+		Orientation:      imageutil.ORIENTATION_ROTATE_90,
+		Make:             "Maker",
+		Model:            "Camera 1",
+		Copyright:        "(c) test",
+		DateTime:         "2024:01:02 03:04:05",
+		DateTimeOriginal: "2024:01:02 03:04:05",
+		ExposureTime:     1.0 / 250,
+		FNumber:          2.8,
+		ISO:              400,
+		FocalLength:      35,
+		GPS: &imageutil.MetadataGPS{
+			Latitude:  51.5,
+			Longitude: -0.125,
+			Altitude:  -12,
+		},
+		XMP: "<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"></x:xmpmeta>",
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	img := gradientImage(64, 64, false)
+	expected := metadataTest()
+
+	for _, encoding := range []imageutil.ImageEncoding{imageutil.ENCODING_JPEG, imageutil.ENCODING_PNG, imageutil.ENCODING_WEBP} {
+		opts := imageutil.DefaultEncodeOptions()
+		opts.Metadata = expected
+
+		w := byteseeker.NewByteSeeker(1000, 1000)
+		err := imageutil.Encode(w, img, encoding, opts)
+		if err != nil {
+			t.Fatalf("failed to encode %d: %s", encoding, err)
+		}
+
+		meta, err := imageutil.MetadataDecode(bytes.NewReader(w.Bytes()), encoding)
+		if err != nil {
+			t.Fatalf("failed to read metadata %d: %s", encoding, err)
+		}
+		if meta == nil {
+			t.Fatalf("expected metadata for %d", encoding)
+		}
+
+		if meta.Orientation != expected.Orientation || meta.Make != expected.Make || meta.Model != expected.Model ||
+			meta.Copyright != expected.Copyright || meta.DateTimeOriginal != expected.DateTimeOriginal ||
+			meta.ISO != expected.ISO || meta.XMP != expected.XMP {
+			t.Errorf("metadata does not match for %d: %+v", encoding, meta)
+		}
+		if math.Abs(meta.ExposureTime-expected.ExposureTime) > 1e-9 || math.Abs(meta.FNumber-expected.FNumber) > 1e-4 {
+			t.Errorf("exposure does not match for %d: %f %f", encoding, meta.ExposureTime, meta.FNumber)
+		}
+		if meta.GPS == nil ||
+			math.Abs(meta.GPS.Latitude-expected.GPS.Latitude) > 1e-6 ||
+			math.Abs(meta.GPS.Longitude-expected.GPS.Longitude) > 1e-6 ||
+			meta.GPS.Altitude != expected.GPS.Altitude {
+			t.Errorf("gps does not match for %d: %+v", encoding, meta.GPS)
+		}
+
+		_, err = imageutil.Decode(bytes.NewReader(w.Bytes()), encoding)
+		if err != nil {
+			t.Errorf("failed to decode image with metadata %d: %s", encoding, err)
+		}
+	}
+}
+
+func TestMetadataNone(t *testing.T) {
+	w := byteseeker.NewByteSeeker(1000, 1000)
+	err := imageutil.Encode(w, gradientImage(64, 64, false), imageutil.ENCODING_JPEG, nil)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	meta, err := imageutil.MetadataDecode(bytes.NewReader(w.Bytes()), imageutil.ENCODING_JPEG)
+	if err != nil {
+		t.Fatalf("failed to read metadata: %s", err)
+	}
+	if meta != nil {
+		t.Errorf("expected no metadata, got %+v", meta)
+	}
+}
+
+func TestMetadataBadRational(t *testing.T) {
+	// a tiff header with an exif ifd where the exposure is 3 shorts and the f-number is a long.
+	data := []byte("II*\x00")
+	data = binary.LittleEndian.AppendUint32(data, 8)
+	entry := func(tag, typ uint16, count, value uint32) {
+		data = binary.LittleEndian.AppendUint16(data, tag)
+		data = binary.LittleEndian.AppendUint16(data, typ)
+		data = binary.LittleEndian.AppendUint32(data, count)
+		data = binary.LittleEndian.AppendUint32(data, value)
+	}
+
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	entry(0x8769, 4, 1, 26)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	entry(0x829A, 3, 3, 56)
+	entry(0x829D, 4, 1, 7)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = append(data, 1, 0, 2, 0, 3, 0)
+
+	meta, err := imageutil.MetadataDecode(bytes.NewReader(data), imageutil.ENCODING_TIFF)
+	if err != nil {
+		t.Fatalf("failed to read metadata: %s", err)
+	}
+	if meta.ExposureTime != 0 || meta.FNumber != 0 {
+		t.Errorf("expected fields with the wrong type to be skipped, got %f %f", meta.ExposureTime, meta.FNumber)
+	}
+}
+
+func TestMetadataOrient(t *testing.T) {
+	// 3x2 image with a single marked pixel at the top left.
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+	red := color.RGBA{255, 0, 0, 255}
+
+	tests := []struct {
+		orientation int
+		width       int
+		x, y        int
+	}{
+		{imageutil.ORIENTATION_NORMAL, 3, 0, 0},
+		{imageutil.ORIENTATION_FLIP_HORIZONTAL, 3, 2, 0},
+		{imageutil.ORIENTATION_ROTATE_180, 3, 2, 1},
+		{imageutil.ORIENTATION_FLIP_VERTICAL, 3, 0, 1},
+		{imageutil.ORIENTATION_TRANSPOSE, 2, 0, 0},
+		{imageutil.ORIENTATION_ROTATE_90, 2, 1, 0},
+		{imageutil.ORIENTATION_TRANSVERSE, 2, 1, 2},
+		{imageutil.ORIENTATION_ROTATE_270, 2, 0, 2},
+	}
+
+	for _, test := range tests {
+		out := imageutil.MetadataOrient(img, test.orientation)
+		if out.Bounds().Dx() != test.width {
+			t.Errorf("orientation %d: expected width %d, got %d", test.orientation, test.width, out.Bounds().Dx())
+		}
+		if out.At(test.x, test.y) != red {
+			t.Errorf("orientation %d: expected marked pixel at (%d, %d)", test.orientation, test.x, test.y)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+var nineSliceTestSlice = imageutil.NineSlice{Left: 2, Top: 2, Right: 2, Bottom: 2, PaddingLeft: 2, PaddingTop: 2, PaddingRight: 2, PaddingBottom: 2}
+
+func TestNineSliceResize(t *testing.T) {
+	img := nineSliceImage()
+
+	out, err := imageutil.NineSliceResize(img, nineSliceTestSlice, 20, 12, imageutil.DefaultNineSliceOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := out.Bounds(); b.Dx() != 20 || b.Dy() != 12 {
+		t.Fatalf("unexpected size: %v", b)
+	}
+
+	for _, p := range []image.Point{{0, 0}, {1, 1}, {19, 0}, {18, 11}, {0, 10}} {
+		if c := out.NRGBAAt(p.X, p.Y); c != (color.NRGBA{255, 0, 0, 255}) {
+			t.Errorf("expected corner at %v, got %v", p, c)
+		}
+	}
+	if c := out.NRGBAAt(10, 0); c.G != 255 || c.B != 0 {
+		t.Errorf("expected top edge, got %v", c)
+	}
+	if c := out.NRGBAAt(10, 6); c.B != 255 {
+		t.Errorf("expected center, got %v", c)
+	}
+
+	opts := imageutil.DefaultNineSliceOptions()
+	opts.Edge = imageutil.NINESLICE_TILE
+	opts.Center = imageutil.NINESLICE_TILE
+	tiled, err := imageutil.NineSliceResize(img, nineSliceTestSlice, 20, 12, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the center is 4 pixels wide in the source, so the dark column repeats every 4 pixels.
+	for x := 2; x < 18; x++ {
+		dark := (x-2)%4 == 0
+		if c := tiled.NRGBAAt(x, 0); (c.R == 100) != dark {
+			t.Errorf("expected tiled top edge at %d to be dark: %t, got %v", x, dark, c)
+		}
+		if c := tiled.NRGBAAt(x, 5); c.B != 255 {
+			t.Errorf("expected tiled center at %d, got %v", x, c)
+		}
+	}
+
+	small, err := imageutil.NineSliceResize(img, nineSliceTestSlice, 2, 8, imageutil.DefaultNineSliceOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := small.NRGBAAt(0, 0); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected corners to shrink to fit, got %v", c)
+	}
+
+	if _, err := imageutil.NineSliceResize(img, imageutil.NineSlice{Left: 5, Right: 5}, 20, 20, opts); err == nil {
+		t.Error("expected error for insets larger than the image")
+	}
+}
+
+func TestNineSliceSmooth(t *testing.T) {
+	img := nineSliceImage()
+
+	opts := imageutil.DefaultNineSliceOptions()
+	opts.Smooth = true
+	out, err := imageutil.NineSliceResize(img, nineSliceTestSlice, 40, 40, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sampling never crosses regions, so the corners stay pure red and the center pure blue.
+	if c := out.NRGBAAt(1, 1); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected pure corner, got %v", c)
+	}
+	if c := out.NRGBAAt(38, 20); c.R != 0 || c.B != 0 {
+		t.Errorf("expected the edge to not blend with the center, got %v", c)
+	}
+}
+
+func TestNinePatch(t *testing.T) {
+	img := nineSliceImage()
+	slice := imageutil.NineSlice{Left: 2, Top: 3, Right: 1, Bottom: 2, PaddingLeft: 1, PaddingTop: 1, PaddingRight: 1, PaddingBottom: 2}
+
+	encoded, err := imageutil.NinePatchEncode(img, slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := encoded.Bounds(); b.Dx() != 10 || b.Dy() != 10 {
+		t.Fatalf("expected a 1 pixel border, got %v", b)
+	}
+	if c := encoded.NRGBAAt(3, 0); c != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("expected a stretch marker, got %v", c)
+	}
+	if c := encoded.NRGBAAt(0, 0); c.A != 0 {
+		t.Errorf("expected the border corner to be transparent, got %v", c)
+	}
+
+	decoded, decodedSlice, err := imageutil.NinePatchDecode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedSlice != slice {
+		t.Errorf("expected %+v, got %+v", slice, decodedSlice)
+	}
+	for y := range 8 {
+		for x := range 8 {
+			if decoded.NRGBAAt(x, y) != img.NRGBAAt(x, y) {
+				t.Fatalf("expected the content to be unchanged at %d,%d", x, y)
+			}
+		}
+	}
+
+	// without padding markers the padding matches the stretch area.
+	for x := range 10 {
+		encoded.SetNRGBA(x, 9, color.NRGBA{})
+	}
+	encoded.SetNRGBA(9, 5, color.NRGBA{255, 0, 0, 255})
+	_, decodedSlice, err = imageutil.NinePatchDecode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedSlice.PaddingLeft != slice.Left || decodedSlice.PaddingRight != slice.Right {
+		t.Errorf("expected padding to match the stretch area, got %+v", decodedSlice)
+	}
+
+	encoded.SetNRGBA(0, 5, color.NRGBA{0, 0, 255, 255})
+	if _, _, err := imageutil.NinePatchDecode(encoded); err == nil {
+		t.Error("expected error for an invalid marker color")
+	}
+
+	if _, _, err := imageutil.NinePatchDecode(img); err == nil {
+		t.Error("expected error for an image without markers")
+	}
+}
+
+func TestNineSliceJSON(t *testing.T) {
+	slice, err := imageutil.NineSliceDecodeJSON(strings.NewReader(`{"left": 4, "top": 3, "right": 2, "bottom": 1, "padding_top": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := imageutil.NineSlice{Left: 4, Top: 3, Right: 2, Bottom: 1, PaddingLeft: 4, PaddingTop: 0, PaddingRight: 2, PaddingBottom: 1}
+	if slice != expected {
+		t.Errorf("expected %+v, got %+v", expected, slice)
+	}
+
+	b, err := imageutil.NineSliceEncodeJSON(slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := imageutil.NineSliceDecodeJSON(strings.NewReader(string(b)))
+	if err != nil || again != slice {
+		t.Errorf("expected json to round trip, got %+v, %v", again, err)
+	}
+}
+
+func TestNineSliceAsepriteJSON(t *testing.T) {
+	data := `{
+		"frames": {},
+		"meta": {
+			"slices": [
+				{"name": "button", "color": "#0000ffff", "keys": [
+					{"frame": 0, "bounds": {"x": 10, "y": 10, "w": 16, "h": 12}, "center": {"x": 3, "y": 4, "w": 8, "h": 5}}
+				]},
+				{"name": "hitbox", "color": "#ff0000ff", "keys": [
+					{"frame": 0, "bounds": {"x": 0, "y": 0, "w": 4, "h": 4}}
+				]}
+			]
+		}
+	}`
+
+	slices, err := imageutil.NineSliceDecodeAsepriteJSON(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slices) != 1 {
+		t.Fatalf("expected only the 9-slice, got %v", slices)
+	}
+
+	expected := imageutil.NineSlice{Left: 3, Top: 4, Right: 5, Bottom: 3, PaddingLeft: 3, PaddingTop: 4, PaddingRight: 5, PaddingBottom: 3}
+	if slices["button"] != expected {
+		t.Errorf("expected %+v, got %+v", expected, slices["button"])
+	}
+}
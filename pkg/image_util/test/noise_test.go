@@ -0,0 +1,136 @@
+package image_util_test
+
+import (
+	"math"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func noiseTestSources(seed int64) map[string]imageutil.Noise {
+	return map[string]imageutil.Noise{
+		"perlin":  &imageutil.NoisePerlin{Seed: seed},
+		"value":   &imageutil.NoiseValue{Seed: seed},
+		"worley":  &imageutil.NoiseWorley{Seed: seed, Distance: imageutil.WORLEYDISTANCE_F1, Jitter: 1},
+		"cells":   &imageutil.NoiseWorley{Seed: seed, Distance: imageutil.WORLEYDISTANCE_F2_F1, Metric: imageutil.WORLEYMETRIC_MANHATTAN, Jitter: 0.8},
+		"simplex": imageutil.NewNoiseSimplex(seed),
+		"fbm": &imageutil.NoiseFractal{
+			Source:     &imageutil.NoisePerlin{Seed: seed},
+			Type:       imageutil.FRACTAL_FBM,
+			Octaves:    5,
+			Lacunarity: 2,
+			Gain:       0.5,
+		},
+		"ridged": &imageutil.NoiseFractal{
+			Source:     &imageutil.NoiseValue{Seed: seed},
+			Type:       imageutil.FRACTAL_RIDGED,
+			Octaves:    4,
+			Lacunarity: 2,
+			Gain:       0.5,
+		},
+		"warp": &imageutil.NoiseWarp{
+			Source: &imageutil.NoiseFractal{
+				Source:     imageutil.NewNoiseSimplex(seed),
+				Type:       imageutil.FRACTAL_TURBULENCE,
+				Octaves:    3,
+				Lacunarity: 3,
+				Gain:       0.5,
+			},
+			Warp:     &imageutil.NoisePerlin{Seed: seed + 1},
+			Strength: 2,
+		},
+	}
+}
+
+func TestNoiseRange(t *testing.T) {
+	for name, n := range noiseTestSources(42) {
+		low, high := math.Inf(1), math.Inf(-1)
+
+		for y := range 64 {
+			for x := range 64 {
+				v := n.Eval2(float64(x)*0.173, float64(y)*0.173, 0)
+				if v < -1 || v > 1 || math.IsNaN(v) {
+					t.Fatalf("noise %s out of range at %d,%d: %f", name, x, y, v)
+				}
+				low = math.Min(low, v)
+				high = math.Max(high, v)
+			}
+		}
+
+		if high-low < 0.5 {
+			t.Errorf("expected noise %s to vary, got range %f to %f", name, low, high)
+		}
+
+		if v1, v2 := n.Eval2(3.3, 1.7, 0), n.Eval2(3.3, 1.7, 0); v1 != v2 {
+			t.Errorf("expected noise %s to be deterministic, got %f and %f", name, v1, v2)
+		}
+	}
+}
+
+func TestNoiseSeed(t *testing.T) {
+	a := noiseTestSources(1)
+	b := noiseTestSources(2)
+
+	for name := range a {
+		same := true
+		for i := range 16 {
+			x := float64(i) * 0.61
+			if a[name].Eval2(x, x*0.5, 0) != b[name].Eval2(x, x*0.5, 0) {
+				same = false
+				break
+			}
+		}
+		if same {
+			t.Errorf("expected noise %s to change with the seed", name)
+		}
+	}
+}
+
+func TestNoisePeriodic(t *testing.T) {
+	const period = 4
+
+	for name, n := range noiseTestSources(7) {
+		for i := range 32 {
+			x := float64(i) * 0.37
+			y := float64(i) * 0.21
+
+			v := n.Eval2(x, y, period)
+			if d := math.Abs(v - n.Eval2(x+period, y, period)); d > 1e-6 {
+				t.Fatalf("expected noise %s to repeat on x at %f,%f: difference %f", name, x, y, d)
+			}
+			if d := math.Abs(v - n.Eval2(x, y-period, period)); d > 1e-6 {
+				t.Fatalf("expected noise %s to repeat on y at %f,%f: difference %f", name, x, y, d)
+			}
+		}
+	}
+}
+
+func TestNoiseWorleyDistance(t *testing.T) {
+	// without jitter the feature points are at the center of each cell.
+	n := &imageutil.NoiseWorley{Seed: 3, Jitter: 0}
+
+	if v := n.Eval2(2.5, 7.5, 0); v != -1 {
+		t.Errorf("expected F1 at a feature point to be -1, got %f", v)
+	}
+	if v := n.Eval2(3, 7.5, 0); math.Abs(v-0) > 1e-9 {
+		t.Errorf("expected F1 half way between feature points to be 0, got %f", v)
+	}
+
+	n.Distance = imageutil.WORLEYDISTANCE_F2_F1
+	if v := n.Eval2(3, 7.5, 0); v != -1 {
+		t.Errorf("expected F2-F1 on a cell edge to be -1, got %f", v)
+	}
+}
+
+func TestNoiseFractalValidate(t *testing.T) {
+	n := &imageutil.NoiseFractal{Source: &imageutil.NoisePerlin{}, Octaves: 0, Lacunarity: 2, Gain: 0.5}
+	if n.Validate() == nil {
+		t.Error("expected error for 0 octaves")
+	}
+
+	n.Octaves = 4
+	n.Lacunarity = 0
+	if n.Validate() == nil {
+		t.Error("expected error for 0 lacunarity")
+	}
+}
@@ -0,0 +1,143 @@
+package image_util_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func paletteFileTest() *imageutil.PaletteFile {
+	return &imageutil.PaletteFile{
+		Name:    "Test Palette",
+		Columns: 4,
+		Colors: []imageutil.PaletteColor{
+			{Color: color.NRGBA{255, 0, 0, 255}, Name: "Red"},
+			{Color: color.NRGBA{12, 200, 99, 255}, Name: "Sea Green"},
+			{Color: color.NRGBA{0, 0, 0, 255}, Name: "Black"},
+			{Color: color.NRGBA{250, 250, 250, 255}, Name: "Off White"},
+		},
+	}
+}
+
+func TestPaletteFileRoundTrip(t *testing.T) {
+	named := map[imageutil.PaletteFormat]bool{
+		imageutil.PALETTEFORMAT_GPL: true,
+		imageutil.PALETTEFORMAT_ACO: true,
+		imageutil.PALETTEFORMAT_ASE: true,
+	}
+
+	for _, format := range imageutil.PaletteFormatList {
+		if format == imageutil.PALETTEFORMAT_UNKNOWN {
+			continue
+		}
+
+		src := paletteFileTest()
+		b := &bytes.Buffer{}
+		if err := imageutil.PaletteEncode(b, src, format); err != nil {
+			t.Fatalf("failed to encode %d: %s", format, err)
+		}
+
+		if detected := imageutil.DetectPaletteFormat(b.Bytes()); detected != format {
+			t.Errorf("expected format %d to be detected, got %d", format, detected)
+		}
+
+		p, detected, err := imageutil.PaletteDecode(b.Bytes(), imageutil.PALETTEFORMAT_UNKNOWN)
+		if err != nil {
+			t.Fatalf("failed to decode %d: %s", format, err)
+		}
+		if detected != format {
+			t.Errorf("expected decoded format %d, got %d", format, detected)
+		}
+
+		if len(p.Colors) != len(src.Colors) {
+			t.Fatalf("expected %d colors for %d, got %d", len(src.Colors), format, len(p.Colors))
+		}
+		for i, c := range p.Colors {
+			if c.Color != src.Colors[i].Color {
+				t.Errorf("unexpected color %d for %d: %v, expected %v", i, format, c.Color, src.Colors[i].Color)
+			}
+			if named[format] && c.Name != src.Colors[i].Name {
+				t.Errorf("unexpected name %d for %d: %q, expected %q", i, format, c.Name, src.Colors[i].Name)
+			}
+		}
+
+		if format == imageutil.PALETTEFORMAT_GPL && (p.Name != src.Name || p.Columns != src.Columns) {
+			t.Errorf("expected gpl header to be kept, got %q with %d columns", p.Name, p.Columns)
+		}
+	}
+}
+
+func TestPaletteFileHex(t *testing.T) {
+	p, format, err := imageutil.PaletteDecode([]byte("ff0000\r\n#00ff00\n0000ff80\n\n"), imageutil.PALETTEFORMAT_UNKNOWN)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if format != imageutil.PALETTEFORMAT_HEX || len(p.Colors) != 3 {
+		t.Fatalf("unexpected hex palette: %d with %d colors", format, len(p.Colors))
+	}
+	if p.Colors[2].Color != (color.NRGBA{0, 0, 255, 128}) {
+		t.Errorf("unexpected color with alpha: %v", p.Colors[2].Color)
+	}
+
+	if f := imageutil.DetectPaletteFormat([]byte("not a palette\n")); f != imageutil.PALETTEFORMAT_UNKNOWN {
+		t.Errorf("expected unknown format, got %d", f)
+	}
+}
+
+func TestPaletteFileGPL(t *testing.T) {
+	data := "GIMP Palette\nName: Mixed\n# comment\n  0 128 255\tSky  Blue\n255 255 255\n"
+
+	p, _, err := imageutil.PaletteDecode([]byte(data), imageutil.PALETTEFORMAT_UNKNOWN)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if len(p.Colors) != 2 || p.Colors[0].Name != "Sky  Blue" || p.Colors[1].Name != "" {
+		t.Errorf("unexpected gpl colors: %+v", p.Colors)
+	}
+	if p.Colors[0].Color != (color.NRGBA{0, 128, 255, 255}) {
+		t.Errorf("unexpected gpl color: %v", p.Colors[0].Color)
+	}
+}
+
+func TestPaletteFileGPLVerticalTab(t *testing.T) {
+	data := "GIMP Palette\n255\v0\v0\vred\n"
+
+	p, _, err := imageutil.PaletteDecode([]byte(data), imageutil.PALETTEFORMAT_UNKNOWN)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if len(p.Colors) != 1 || p.Colors[0].Name != "red" || p.Colors[0].Color != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("unexpected gpl colors: %+v", p.Colors)
+	}
+}
+
+func TestPaletteFileACOSpaces(t *testing.T) {
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.BigEndian, []uint16{
+		1, 3,
+		// cmyk where 65535 is no ink, so this is pure cyan.
+		2, 0, 65535, 65535, 65535,
+		// lab white.
+		7, 10000, 0, 0, 0,
+		// grayscale at 50%.
+		8, 5000, 0, 0, 0,
+	})
+
+	p, format, err := imageutil.PaletteDecode(b.Bytes(), imageutil.PALETTEFORMAT_UNKNOWN)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if format != imageutil.PALETTEFORMAT_ACO {
+		t.Fatalf("expected aco format, got %d", format)
+	}
+
+	expected := []color.NRGBA{{0, 255, 255, 255}, {255, 255, 255, 255}, {128, 128, 128, 255}}
+	for i, c := range p.Colors {
+		if c.Color != expected[i] {
+			t.Errorf("unexpected color %d: %v, expected %v", i, c.Color, expected[i])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package image_util_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/byteseeker"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestLimitPaletted(t *testing.T) {
+	img := palettedImage()
+
+	out, model := imageutil.Limit(img, imageutil.MODEL_RGBA)
+	if model != imageutil.MODEL_PALETTED {
+		t.Errorf("expected paletted model, got %d", model)
+	}
+	if _, ok := out.(*image.Paletted); !ok {
+		t.Errorf("expected paletted image, got %T", out)
+	}
+}
+
+func TestCopyImagePaletted(t *testing.T) {
+	img := palettedImage()
+
+	out := imageutil.CopyImage(img, imageutil.MODEL_PALETTED).(*image.Paletted)
+	if len(out.Palette) != len(img.Palette) {
+		t.Fatalf("expected palette of %d colors, got %d", len(img.Palette), len(out.Palette))
+	}
+	if !bytes.Equal(out.Pix, img.Pix) {
+		t.Error("expected copied indexes to match")
+	}
+
+	rgba := imageutil.CopyImage(img, imageutil.MODEL_RGBA)
+	quantized := imageutil.CopyImage(rgba, imageutil.MODEL_PALETTED).(*image.Paletted)
+	if len(quantized.Palette) > 256 {
+		t.Errorf("expected at most 256 colors, got %d", len(quantized.Palette))
+	}
+	if !imageutil.ImageCompare(rgba, quantized) {
+		t.Error("expected quantized image to match the source colors")
+	}
+}
+
+func TestEncodePaletted(t *testing.T) {
+	img := palettedImage()
+
+	for _, encoding := range []imageutil.ImageEncoding{imageutil.ENCODING_PNG, imageutil.ENCODING_GIF} {
+		w := byteseeker.NewByteSeeker(1000, 1000)
+		err := imageutil.Encode(w, img, encoding, nil)
+		if err != nil {
+			t.Fatalf("failed to encode %d: %s", encoding, err)
+		}
+
+		out, err := imageutil.Decode(bytes.NewReader(w.Bytes()), encoding)
+		if err != nil {
+			t.Fatalf("failed to decode %d: %s", encoding, err)
+		}
+
+		pal, ok := out.(*image.Paletted)
+		if !ok {
+			t.Fatalf("expected indexed output for %d, got %T", encoding, out)
+		}
+		if !bytes.Equal(pal.Pix, img.Pix) {
+			t.Errorf("expected indexes to be kept for %d", encoding)
+		}
+	}
+}
+
+func TestPaletteSet(t *testing.T) {
+	img := palettedImage()
+
+	imageutil.PaletteSet(img, color.Palette{color.Black, color.White})
+	for i, v := range img.Pix {
+		if v >= 2 {
+			t.Fatalf("expected index below 2 at %d, got %d", i, v)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestPixelScale(t *testing.T) {
+	src := pixelArtImage()
+
+	for _, scaler := range imageutil.PixelScalerList {
+		for factor := 2; factor <= 4; factor++ {
+			out, err := imageutil.PixelScale(src, scaler, factor)
+			if err != nil {
+				t.Fatalf("failed to scale %d by %d: %s", scaler, factor, err)
+			}
+
+			if out.Rect != image.Rect(0, 0, 8*factor, 8*factor) {
+				t.Fatalf("unexpected size for %d by %d: %s", scaler, factor, out.Rect)
+			}
+
+			// the inside of the blue square and the far corner of the background are unchanged.
+			if c := out.NRGBAAt(7*factor-1+factor/2, 7*factor-1+factor/2); c != (color.NRGBA{0, 0, 255, 255}) {
+				t.Errorf("expected blue inside square for %d by %d, got %v", scaler, factor, c)
+			}
+			if c := out.NRGBAAt(0, 8*factor-1); c.A != 0 {
+				t.Errorf("expected transparent background for %d by %d, got %v", scaler, factor, c)
+			}
+
+			for y := range out.Rect.Dy() {
+				for x := range out.Rect.Dx() {
+					c := out.NRGBAAt(x, y)
+					if c.A == 0 && c != (color.NRGBA{}) {
+						t.Fatalf("transparent pixel kept its color for %d by %d at %d,%d: %v", scaler, factor, x, y, c)
+					}
+					if c.G != 0 {
+						t.Fatalf("color bled from a transparent pixel for %d by %d at %d,%d: %v", scaler, factor, x, y, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPixelScaleNearest(t *testing.T) {
+	src := pixelArtImage()
+
+	out, err := imageutil.PixelScale(src, imageutil.PIXELSCALER_NEAREST, 5)
+	if err != nil {
+		t.Fatalf("failed to scale: %s", err)
+	}
+
+	for y := range 40 {
+		for x := range 40 {
+			want := src.NRGBAAt(x/5, y/5)
+			if want.A == 0 {
+				want = color.NRGBA{}
+			}
+			if c := out.NRGBAAt(x, y); c != want {
+				t.Fatalf("unexpected pixel at %d,%d: %v, expected %v", x, y, c, want)
+			}
+		}
+	}
+}
+
+func TestPixelScaleEPX(t *testing.T) {
+	src := pixelArtImage()
+
+	out, err := imageutil.PixelScale(src, imageutil.PIXELSCALER_EPX, 2)
+	if err != nil {
+		t.Fatalf("failed to scale: %s", err)
+	}
+
+	// the steps of the diagonal line are filled in and the outer corners are cut.
+	if c := out.NRGBAAt(2, 1); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the step of the diagonal to be filled, got %v", c)
+	}
+	if c := out.NRGBAAt(1, 1); c.A != 0 {
+		t.Errorf("expected the corner of the diagonal to be cut, got %v", c)
+	}
+
+	for factor := 2; factor <= 4; factor++ {
+		out, err := imageutil.PixelScale(src, imageutil.PIXELSCALER_EPX, factor)
+		if err != nil {
+			t.Fatalf("failed to scale: %s", err)
+		}
+
+		for i := 0; i < len(out.Pix); i += 4 {
+			c := color.NRGBA{out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3]}
+			if c != (color.NRGBA{}) && c != (color.NRGBA{255, 0, 0, 255}) && c != (color.NRGBA{0, 0, 255, 255}) {
+				t.Fatalf("expected no new colors with a factor of %d, got %v", factor, c)
+			}
+		}
+	}
+}
+
+func TestPixelScaleSmooth(t *testing.T) {
+	src := pixelArtImage()
+
+	for _, scaler := range []imageutil.PixelScaler{imageutil.PIXELSCALER_CORNERBLEND, imageutil.PIXELSCALER_XBR} {
+		out, err := imageutil.PixelScale(src, scaler, 4)
+		if err != nil {
+			t.Fatalf("failed to scale: %s", err)
+		}
+
+		// the diagonal line is anti-aliased against the transparent background.
+		blended := false
+		for i := 3; i < len(out.Pix); i += 4 {
+			if out.Pix[i] != 0 && out.Pix[i] != 255 {
+				blended = true
+				break
+			}
+		}
+		if !blended {
+			t.Errorf("expected %d to smooth the diagonal", scaler)
+		}
+
+		// straight edges stay sharp.
+		if c := out.NRGBAAt(26, 19); c.A != 0 {
+			t.Errorf("expected %d to keep the top edge of the square sharp, got %v", scaler, c)
+		}
+		if c := out.NRGBAAt(26, 20); c != (color.NRGBA{0, 0, 255, 255}) {
+			t.Errorf("expected %d to keep the top edge of the square sharp, got %v", scaler, c)
+		}
+	}
+}
+
+func TestPixelScaleInvalid(t *testing.T) {
+	src := pixelArtImage()
+
+	if _, err := imageutil.PixelScale(src, imageutil.PIXELSCALER_CORNERBLEND, 5); err == nil {
+		t.Error("expected an error for an unsupported factor")
+	}
+	if _, err := imageutil.PixelScale(src, imageutil.PIXELSCALER_NEAREST, 0); err == nil {
+		t.Error("expected an error for a zero factor")
+	}
+	if _, err := imageutil.PixelScale(src, imageutil.PixelScaler(-1), 2); err == nil {
+		t.Error("expected an error for an invalid scaler")
+	}
+}
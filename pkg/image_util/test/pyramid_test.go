@@ -0,0 +1,137 @@
+package image_util_test
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/disintegration/gift"
+)
+
+func pyramidTestDecode(t *testing.T, pth string) image.Image {
+	t.Helper()
+
+	f, err := os.Open(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestMipChain(t *testing.T) {
+	img := checkerImage(16, 8)
+
+	opts := imageutil.DefaultMipOptions()
+	opts.Resampling = gift.BoxResampling
+	chain, err := imageutil.MipChain(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []image.Point{{16, 8}, {8, 4}, {4, 2}, {2, 1}, {1, 1}}
+	if len(chain) != len(sizes) {
+		t.Fatalf("expected %d levels, got %d", len(sizes), len(chain))
+	}
+	for i, s := range sizes {
+		if chain[i].Bounds().Size() != s {
+			t.Errorf("expected level %d to be %v, got %v", i, s, chain[i].Bounds().Size())
+		}
+	}
+
+	// black and white average to half the light, which is brighter than half the srgb value.
+	if c := chain[1].NRGBAAt(0, 0); c.R < 180 || c.R > 195 || c.A != 255 {
+		t.Errorf("expected gamma correct average, got %v", c)
+	}
+
+	opts.GammaCorrect = false
+	opts.Levels = 2
+	chain, err = imageutil.MipChain(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected levels to be limited, got %d", len(chain))
+	}
+	if c := chain[1].NRGBAAt(0, 0); c.R < 125 || c.R > 130 {
+		t.Errorf("expected srgb average, got %v", c)
+	}
+}
+
+func TestDZIWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := imageutil.DZIWrite(checkerImage(600, 300), dir, "scan", imageutil.DefaultDZIOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	dzi, err := os.ReadFile(path.Join(dir, "scan.dzi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`Format="png"`, `Overlap="1"`, `TileSize="254"`, `Width="600"`, `Height="300"`} {
+		if !strings.Contains(string(dzi), s) {
+			t.Errorf("expected dzi to contain %s, got %s", s, dzi)
+		}
+	}
+
+	// 600 halves 10 times to reach 1.
+	files := path.Join(dir, "scan_files")
+	tiles := map[string]image.Point{
+		"10/0_0.png": {255, 255},
+		"10/1_0.png": {256, 255},
+		"10/2_1.png": {93, 47},
+		"9/1_0.png":  {47, 150},
+		"0/0_0.png":  {1, 1},
+	}
+	for name, size := range tiles {
+		if s := pyramidTestDecode(t, path.Join(files, name)).Bounds().Size(); s != size {
+			t.Errorf("expected %s to be %v, got %v", name, size, s)
+		}
+	}
+
+	if _, err := os.Stat(path.Join(files, "10/3_0.png")); err == nil {
+		t.Error("expected no tiles past the edge of the image")
+	}
+	if _, err := os.Stat(path.Join(files, "11")); err == nil {
+		t.Error("expected no levels past the full size")
+	}
+}
+
+func TestXYZWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := imageutil.XYZWrite(checkerImage(600, 300), dir, imageutil.DefaultXYZOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 600 needs 3 tiles at 256, so there are 2 zoom levels above 0.
+	for _, name := range []string{"2/0/0.png", "2/2/1.png", "1/1/0.png", "0/0/0.png"} {
+		if s := pyramidTestDecode(t, path.Join(dir, name)).Bounds().Size(); s != (image.Point{256, 256}) {
+			t.Errorf("expected %s to be a full tile, got %v", name, s)
+		}
+	}
+
+	tile := pyramidTestDecode(t, path.Join(dir, "0/0/0.png"))
+	if _, _, _, a := tile.At(149, 74).RGBA(); a == 0 {
+		t.Error("expected the image in the top left of the tile")
+	}
+	if _, _, _, a := tile.At(150, 74).RGBA(); a != 0 {
+		t.Error("expected padding to be transparent")
+	}
+
+	for _, name := range []string{"2/0/2.png", "2/3", "1/1/1.png", "3"} {
+		if _, err := os.Stat(path.Join(dir, name)); err == nil {
+			t.Errorf("expected %s to not exist", name)
+		}
+	}
+}
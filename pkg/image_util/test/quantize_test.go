@@ -0,0 +1,150 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestOKLab(t *testing.T) {
+	white := imageutil.ColorToOKLab(color.NRGBA{255, 255, 255, 255})
+	if math.Abs(white.L-1) > 1e-3 || math.Abs(white.A) > 1e-3 || math.Abs(white.B) > 1e-3 {
+		t.Errorf("unexpected oklab for white: %+v", white)
+	}
+
+	for _, c := range []color.NRGBA{{255, 0, 0, 255}, {12, 200, 99, 255}, {0, 0, 0, 255}} {
+		if back := imageutil.OKLabToColor(imageutil.ColorToOKLab(c)); back != c {
+			t.Errorf("expected %v to round trip, got %v", c, back)
+		}
+	}
+}
+
+func TestQuantizeColors(t *testing.T) {
+	img := grayGradientImage(64, 16)
+
+	for _, q := range imageutil.QuantizerList {
+		pal := imageutil.QuantizeColors(img, 8, q)
+		if len(pal) != 8 {
+			t.Fatalf("expected 8 colors for %d, got %d", q, len(pal))
+		}
+		if _, _, _, a := pal[0].RGBA(); a != 0 {
+			t.Errorf("expected the first color to be transparent for %d, got %v", q, pal[0])
+		}
+		for _, c := range pal[1:] {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				t.Errorf("expected opaque colors for %d, got %v", q, c)
+			}
+		}
+	}
+
+	opaque := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	opaque.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	opaque.SetNRGBA(1, 0, color.NRGBA{0, 0, 255, 255})
+	pal := imageutil.QuantizeColors(opaque, 16, imageutil.QUANTIZER_KMEANS)
+	if len(pal) != 2 {
+		t.Errorf("expected only the colors in the image, got %v", pal)
+	}
+}
+
+func TestPaletteApply(t *testing.T) {
+	img := grayGradientImage(64, 16)
+	pal := color.Palette{
+		color.NRGBA{0, 0, 0, 0},
+		color.NRGBA{0, 0, 0, 255},
+		color.NRGBA{255, 255, 255, 255},
+	}
+
+	for _, dither := range imageutil.DitherList {
+		opts := imageutil.DefaultDitherOptions()
+		opts.Dither = dither
+
+		out := imageutil.PaletteApply(img, pal, opts)
+		if out.Rect != img.Rect {
+			t.Fatalf("unexpected size for %d: %s", dither, out.Rect)
+		}
+
+		white := 0
+		for y := range 16 {
+			for x := range 64 {
+				index := out.ColorIndexAt(x, y)
+				if y == 0 {
+					if index != 0 {
+						t.Fatalf("expected transparent pixels to use index 0 for %d, got %d", dither, index)
+					}
+					continue
+				}
+				if index == 0 {
+					t.Fatalf("expected opaque pixels to not be transparent for %d at %d,%d", dither, x, y)
+				}
+				if index == 2 {
+					white++
+				}
+			}
+		}
+
+		if dither == imageutil.DITHER_NONE {
+			// without dithering the gradient is split in two.
+			for y := 1; y < 16; y++ {
+				if out.ColorIndexAt(0, y) != 1 || out.ColorIndexAt(63, y) != 2 {
+					t.Fatalf("expected gradient to go from black to white")
+				}
+			}
+			continue
+		}
+
+		// with dithering the mid tones are a mix of black and white pixels.
+		mixed := false
+		for y := 1; y < 16; y++ {
+			if out.ColorIndexAt(24, y) != out.ColorIndexAt(24, 1) || out.ColorIndexAt(25, y) != out.ColorIndexAt(24, y) {
+				mixed = true
+			}
+		}
+		if !mixed {
+			t.Errorf("expected %d to dither the mid tones", dither)
+		}
+		if white < 64*15/4 || white > 64*15*3/4 {
+			t.Errorf("expected roughly half of the pixels to be white for %d, got %d", dither, white)
+		}
+	}
+}
+
+func TestDitherOptionsValidate(t *testing.T) {
+	opts := imageutil.DefaultDitherOptions()
+	opts.BayerSize = 3
+	if opts.Validate() == nil {
+		t.Error("expected error for invalid bayer size")
+	}
+
+	opts = imageutil.DefaultDitherOptions()
+	opts.Strength = 2
+	if opts.Validate() == nil {
+		t.Error("expected error for invalid strength")
+	}
+}
+
+func TestPaletteSwap(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	green := color.NRGBA{0, 255, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, red)
+	img.SetNRGBA(1, 0, blue)
+
+	imageutil.PaletteSwap(img, []color.NRGBA{red}, []color.NRGBA{green})
+	if img.NRGBAAt(0, 0) != green || img.NRGBAAt(1, 0) != blue {
+		t.Errorf("unexpected swap result: %v %v", img.NRGBAAt(0, 0), img.NRGBAAt(1, 0))
+	}
+
+	pimg := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{red, blue})
+	pimg.SetColorIndex(1, 0, 1)
+
+	// swapping both ways at once does not chain the replacements.
+	imageutil.PaletteSwap(pimg, []color.NRGBA{red, blue}, []color.NRGBA{blue, red})
+	if pimg.At(0, 0) != blue || pimg.At(1, 0) != red {
+		t.Errorf("unexpected paletted swap result: %v %v", pimg.At(0, 0), pimg.At(1, 0))
+	}
+}
@@ -0,0 +1,160 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+// seamlessWrapDiff is the mean difference across the horizontal and vertical wrap of the image.
+func seamlessWrapDiff(img *image.NRGBA) float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	sum := 0.0
+
+	for y := range h {
+		sum += math.Abs(float64(img.NRGBAAt(0, y).R) - float64(img.NRGBAAt(w-1, y).R))
+	}
+	for x := range w {
+		sum += math.Abs(float64(img.NRGBAAt(x, 0).R) - float64(img.NRGBAAt(x, h-1).R))
+	}
+
+	return sum / float64(w+h)
+}
+
+// seamlessInteriorDiff is the mean difference between neighbouring pixels inside the image.
+func seamlessInteriorDiff(img *image.NRGBA) float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	sum := 0.0
+
+	for y := range h - 1 {
+		for x := range w - 1 {
+			c := float64(img.NRGBAAt(x, y).R)
+			sum += math.Abs(c - float64(img.NRGBAAt(x+1, y).R))
+			sum += math.Abs(c - float64(img.NRGBAAt(x, y+1).R))
+		}
+	}
+
+	return sum / float64((w-1)*(h-1)*2)
+}
+
+func TestSeamlessBlend(t *testing.T) {
+	// a diagonal gradient has a seam from white to black when tiled.
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := range 48 {
+		for x := range 64 {
+			v := uint8((x*2 + y*2) * 255 / (63*2 + 47*2))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	if d := seamlessWrapDiff(img); d < 100 {
+		t.Fatalf("expected the source to have a seam, got %f", d)
+	}
+
+	opts := imageutil.DefaultSeamlessOptions()
+	opts.Border = 16
+	out := imageutil.Seamless(img, opts)
+
+	if out.Bounds() != img.Bounds() {
+		t.Errorf("expected blend to keep the size, got %v", out.Bounds())
+	}
+	if d := seamlessWrapDiff(out); d > 8 {
+		t.Errorf("expected blend to remove the seam, got %f", d)
+	}
+	if c := out.NRGBAAt(32, 24); c != img.NRGBAAt(32, 24) {
+		t.Errorf("expected the center to be unchanged, got %v and %v", c, img.NRGBAAt(32, 24))
+	}
+}
+
+func TestSeamlessMirror(t *testing.T) {
+	img := blobImage(20, 0)
+
+	opts := imageutil.DefaultSeamlessOptions()
+	opts.Mode = imageutil.SEAMLESS_MIRROR
+	out := imageutil.Seamless(img, opts)
+
+	if b := out.Bounds(); b.Dx() != 40 || b.Dy() != 40 {
+		t.Fatalf("expected mirror to double the size, got %v", b)
+	}
+	for i := range 40 {
+		if out.NRGBAAt(0, i) != out.NRGBAAt(39, i) || out.NRGBAAt(i, 0) != out.NRGBAAt(i, 39) {
+			t.Fatalf("expected mirrored edges to match at %d", i)
+		}
+	}
+	if out.NRGBAAt(5, 7) != img.NRGBAAt(5, 7) || out.NRGBAAt(34, 32) != img.NRGBAAt(5, 7) {
+		t.Error("expected the quadrants to be mirrors of the source")
+	}
+}
+
+func TestSeamlessQuilt(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 96, 96))
+	for y := range 96 {
+		for x := range 96 {
+			v := uint8(128 + 120*math.Sin(float64(x)*0.23+float64(y)*0.17))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, 255 - v, 255})
+		}
+	}
+
+	if wrap, interior := seamlessWrapDiff(img), seamlessInteriorDiff(img); wrap < interior*4 {
+		t.Fatalf("expected the source to have a seam, got %f and %f", wrap, interior)
+	}
+
+	opts := imageutil.DefaultSeamlessOptions()
+	opts.Mode = imageutil.SEAMLESS_QUILT
+	opts.PatchSize = 24
+	opts.Overlap = 6
+	opts.Seed = 5
+	out := imageutil.Seamless(img, opts)
+
+	if b := out.Bounds(); b.Dx()%18 != 0 || b.Dy()%18 != 0 || b.Dx() < 72 {
+		t.Fatalf("expected the size to be whole patches, got %v", b)
+	}
+	for i := 3; i < len(out.Pix); i += 4 {
+		if out.Pix[i] != 255 {
+			t.Fatalf("expected every pixel to be filled, pixel %d has alpha %d", i/4, out.Pix[i])
+		}
+	}
+
+	wrap, interior := seamlessWrapDiff(out), seamlessInteriorDiff(out)
+	if wrap > interior*1.5 {
+		t.Errorf("expected the wrap to look like the interior, got %f and %f", wrap, interior)
+	}
+
+	again := imageutil.Seamless(img, opts)
+	for i := range out.Pix {
+		if out.Pix[i] != again.Pix[i] {
+			t.Fatal("expected quilting to be deterministic for a seed")
+		}
+	}
+}
+
+func TestSeamlessQuiltSmall(t *testing.T) {
+	opts := imageutil.DefaultSeamlessOptions()
+	opts.Mode = imageutil.SEAMLESS_QUILT
+
+	for _, rect := range []image.Rectangle{image.Rect(0, 0, 1, 64), image.Rect(0, 0, 64, 1), image.Rect(0, 0, 0, 0), image.Rect(0, 0, 2, 3)} {
+		out := imageutil.Seamless(image.NewNRGBA(rect), opts)
+		if (rect.Dx() < 2 || rect.Dy() < 2) && out.Bounds().Size() != rect.Size() {
+			t.Errorf("expected %v to fall back to blending, got %v", rect, out.Bounds())
+		}
+	}
+}
+
+func TestTilePreview(t *testing.T) {
+	img := blobImage(10, 0)
+	out := imageutil.TilePreview(img, 3, 2)
+
+	if b := out.Bounds(); b.Dx() != 30 || b.Dy() != 20 {
+		t.Fatalf("unexpected preview size: %v", b)
+	}
+	for y := range 20 {
+		for x := range 30 {
+			if out.NRGBAAt(x, y) != img.NRGBAAt(x%10, y%10) {
+				t.Fatalf("unexpected pixel at %d,%d", x, y)
+			}
+		}
+	}
+}
@@ -89,3 +89,84 @@ func TestFramesToSpritesheet(t *testing.T) {
 		}
 	}
 }
+
+func TestSpritesheetDetect(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	fill := func(r image.Rectangle, c color.NRGBA) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+
+	red := color.NRGBA{255, 0, 0, 255}
+	// two sprites in the first row, with the second one lower.
+	fill(image.Rect(20, 4, 26, 10), red)
+	fill(image.Rect(2, 2, 8, 8), red)
+	// a sprite split in two parts by a 1 pixel gap.
+	fill(image.Rect(2, 15, 8, 18), red)
+	fill(image.Rect(2, 19, 8, 22), red)
+	// a single pixel of noise.
+	fill(image.Rect(30, 25, 31, 26), red)
+
+	opts := imageutil.DefaultSpriteDetectOptions()
+	rects := imageutil.SpritesheetDetect(img, opts)
+	expected := []image.Rectangle{
+		image.Rect(2, 2, 8, 8),
+		image.Rect(20, 4, 26, 10),
+		image.Rect(2, 15, 8, 18),
+		image.Rect(2, 19, 8, 22),
+		image.Rect(30, 25, 31, 26),
+	}
+	if len(rects) != len(expected) {
+		t.Fatalf("expected %d sprites, got %v", len(expected), rects)
+	}
+	for i, r := range expected {
+		if rects[i] != r {
+			t.Errorf("expected sprite %d to be %s, got %s", i, r, rects[i])
+		}
+	}
+
+	opts.MergeDistance = 2
+	opts.MinWidth = 2
+	rects = imageutil.SpritesheetDetect(img, opts)
+	if len(rects) != 3 || rects[2] != image.Rect(2, 15, 8, 22) {
+		t.Errorf("expected merged sprites without noise, got %v", rects)
+	}
+
+	// an opaque background removed with a key color.
+	bg := color.NRGBA{255, 0, 255, 255}
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] == 0 {
+			img.Pix[i-3], img.Pix[i-2], img.Pix[i-1], img.Pix[i] = bg.R, bg.G, bg.B, bg.A
+		}
+	}
+
+	opts = imageutil.DefaultSpriteDetectOptions()
+	if rects = imageutil.SpritesheetDetect(img, opts); len(rects) != 1 {
+		t.Errorf("expected a single sprite without a key, got %v", rects)
+	}
+
+	opts.UseKey = true
+	opts.Key = bg
+	if rects = imageutil.SpritesheetDetect(img, opts); len(rects) != len(expected) {
+		t.Errorf("expected %d sprites with a key, got %v", len(expected), rects)
+	}
+}
+
+func TestSpriteTrim(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	img.SetNRGBA(3, 4, color.NRGBA{255, 0, 0, 255})
+	img.SetNRGBA(10, 12, color.NRGBA{255, 0, 0, 10})
+
+	if rect := imageutil.SpriteTrim(img, 0); rect != image.Rect(3, 4, 11, 13) {
+		t.Errorf("unexpected trim: %s", rect)
+	}
+	if rect := imageutil.SpriteTrim(img, 10); rect != image.Rect(3, 4, 4, 5) {
+		t.Errorf("unexpected trim with threshold: %s", rect)
+	}
+	if rect := imageutil.SpriteTrim(image.NewNRGBA(image.Rect(0, 0, 4, 4)), 0); !rect.Empty() {
+		t.Errorf("expected empty trim, got %s", rect)
+	}
+}
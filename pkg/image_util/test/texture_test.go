@@ -0,0 +1,152 @@
+package image_util_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+)
+
+func TestNormalMap(t *testing.T) {
+	img := domeImage(33)
+
+	for _, kernel := range imageutil.NormalKernelList {
+		opts := imageutil.DefaultNormalOptions()
+		opts.Kernel = kernel
+
+		gl := imageutil.NormalMap(img, opts)
+
+		if c := gl.NRGBAAt(16, 16); c.R != 128 || c.G != 128 || c.B != 255 {
+			t.Errorf("expected flat normal at the peak for kernel %d, got %v", kernel, c)
+		}
+		// the left side faces left, and the top faces up with green up.
+		if c := gl.NRGBAAt(8, 16); c.R >= 128 {
+			t.Errorf("expected left side to face left for kernel %d, got %v", kernel, c)
+		}
+		if c := gl.NRGBAAt(16, 8); c.G <= 128 {
+			t.Errorf("expected top side to face up for kernel %d, got %v", kernel, c)
+		}
+
+		opts.Convention = imageutil.NORMALCONVENTION_DIRECTX
+		dx := imageutil.NormalMap(img, opts)
+
+		if c := dx.NRGBAAt(16, 8); c.G >= 128 {
+			t.Errorf("expected directx green to be flipped for kernel %d, got %v", kernel, c)
+		}
+		if gl.NRGBAAt(16, 8).R != dx.NRGBAAt(16, 8).R {
+			t.Errorf("expected directx red to match opengl for kernel %d", kernel)
+		}
+	}
+
+	opts := imageutil.DefaultNormalOptions()
+	opts.Strength = 0
+	if opts.Validate() == nil {
+		t.Error("expected error for a strength of 0")
+	}
+}
+
+func TestHeightFromNormal(t *testing.T) {
+	src := domeImage(33)
+
+	for _, convention := range imageutil.NormalConventionList {
+		nopts := imageutil.DefaultNormalOptions()
+		nopts.Convention = convention
+		normal := imageutil.NormalMap(src, nopts)
+
+		hopts := imageutil.DefaultHeightOptions()
+		hopts.Convention = convention
+		height := imageutil.HeightFromNormal(normal, hopts)
+
+		center := height.Gray16At(16, 16).Y
+		for _, p := range []image.Point{{2, 2}, {30, 2}, {2, 30}, {30, 30}, {16, 4}, {4, 16}} {
+			if v := height.Gray16At(p.X, p.Y).Y; v >= center {
+				t.Errorf("expected %v to be lower than the center for convention %d, got %d >= %d", p, convention, v, center)
+			}
+		}
+		if center < 0xe000 {
+			t.Errorf("expected center to be near the top of the range for convention %d, got %d", convention, center)
+		}
+	}
+}
+
+func TestAmbientOcclusion(t *testing.T) {
+	// a pit in the middle of a flat plane.
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := range 32 {
+		for x := range 32 {
+			v := uint8(255)
+			if x >= 12 && x < 20 && y >= 12 && y < 20 {
+				v = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	ao := imageutil.AmbientOcclusion(img, imageutil.DefaultAOOptions())
+
+	if v := ao.GrayAt(2, 2).Y; v != 255 {
+		t.Errorf("expected flat ground to be unoccluded, got %d", v)
+	}
+	corner, center := ao.GrayAt(12, 12).Y, ao.GrayAt(15, 15).Y
+	if corner >= center || center >= 255 {
+		t.Errorf("expected the pit to be occluded and darkest in the corner, got corner %d and center %d", corner, center)
+	}
+
+	opts := imageutil.DefaultAOOptions()
+	opts.Strength = 0
+	if v := imageutil.AmbientOcclusion(img, opts).GrayAt(12, 12).Y; v != 255 {
+		t.Errorf("expected no occlusion with a strength of 0, got %d", v)
+	}
+}
+
+func TestSignedDistanceField(t *testing.T) {
+	// a filled circle with a radius of 10.
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := range 40 {
+		for x := range 40 {
+			if math.Hypot(float64(x)-19.5, float64(y)-19.5) < 10 {
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+	}
+
+	results := map[imageutil.SDFAlgorithm]*image.Gray{}
+	for _, algorithm := range imageutil.SDFAlgorithmList {
+		opts := imageutil.DefaultSDFOptions()
+		opts.Algorithm = algorithm
+		opts.Spread = 16
+		sdf := imageutil.SignedDistanceField(img, opts)
+		results[algorithm] = sdf
+
+		// the center is about 10 pixels from the edge, the corner is further than the spread.
+		if v := float64(sdf.GrayAt(19, 19).Y); math.Abs(v-(0.5+9.2/32)*255) > 4 {
+			t.Errorf("unexpected center distance for algorithm %d: %f", algorithm, v)
+		}
+		if v := sdf.GrayAt(0, 0).Y; v != 0 {
+			t.Errorf("expected the corner to be clamped to 0 for algorithm %d, got %d", algorithm, v)
+		}
+		if in, out := sdf.GrayAt(19, 10).Y, sdf.GrayAt(19, 9).Y; in < 128 || out >= 128 {
+			t.Errorf("expected the edge at 128 for algorithm %d, got %d inside and %d outside", algorithm, in, out)
+		}
+	}
+
+	for i := range results[imageutil.SDF_8SSEDT].Pix {
+		a, b := int(results[imageutil.SDF_8SSEDT].Pix[i]), int(results[imageutil.SDF_FELZENSZWALB].Pix[i])
+		if a-b > 2 || b-a > 2 {
+			t.Fatalf("expected the algorithms to be close at %d, got %d and %d", i, a, b)
+		}
+	}
+
+	opts := imageutil.DefaultSDFOptions()
+	opts.Scale = 4
+	if b := imageutil.SignedDistanceField(img, opts).Bounds(); b.Dx() != 10 || b.Dy() != 10 {
+		t.Errorf("expected scaled size of 10x10, got %v", b)
+	}
+
+	empty := imageutil.SignedDistanceField(image.NewNRGBA(image.Rect(0, 0, 4, 4)), imageutil.DefaultSDFOptions())
+	if v := empty.GrayAt(1, 1).Y; v != 0 {
+		t.Errorf("expected an empty image to be fully outside, got %d", v)
+	}
+}
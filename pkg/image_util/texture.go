@@ -0,0 +1,641 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// NormalKernel is the edge detection kernel used to find the slope of a height map.
+type NormalKernel int
+
+const (
+	NORMALKERNEL_SOBEL NormalKernel = iota
+	// NORMALKERNEL_SCHARR is more accurate for diagonal slopes.
+	NORMALKERNEL_SCHARR
+)
+
+var NormalKernelList = []NormalKernel{
+	NORMALKERNEL_SOBEL,
+	NORMALKERNEL_SCHARR,
+}
+
+// NormalConvention is the direction of the green channel in a normal map.
+type NormalConvention int
+
+const (
+	// NORMALCONVENTION_OPENGL has green pointing up, used by Blender, Godot and Unity.
+	NORMALCONVENTION_OPENGL NormalConvention = iota
+	// NORMALCONVENTION_DIRECTX has green pointing down, used by Unreal.
+	NORMALCONVENTION_DIRECTX
+)
+
+var NormalConventionList = []NormalConvention{
+	NORMALCONVENTION_OPENGL,
+	NORMALCONVENTION_DIRECTX,
+}
+
+// SDFAlgorithm is the distance transform used for signed distance fields.
+type SDFAlgorithm int
+
+const (
+	// SDF_8SSEDT is the 8 point sequential signed euclidean distance transform, fast but not always exact.
+	SDF_8SSEDT SDFAlgorithm = iota
+	// SDF_FELZENSZWALB is the exact euclidean distance transform by Felzenszwalb and Huttenlocher.
+	SDF_FELZENSZWALB
+)
+
+var SDFAlgorithmList = []SDFAlgorithm{
+	SDF_8SSEDT,
+	SDF_FELZENSZWALB,
+}
+
+type NormalOptions struct {
+	Kernel     NormalKernel
+	Convention NormalConvention
+	// Strength scales the slope, higher values create steeper normals.
+	Strength float64
+	// Wrap samples across the edges of the image, for tileable textures.
+	Wrap bool
+}
+
+func DefaultNormalOptions() NormalOptions {
+	return NormalOptions{
+		Kernel:     NORMALKERNEL_SOBEL,
+		Convention: NORMALCONVENTION_OPENGL,
+		Strength:   4,
+		Wrap:       false,
+	}
+}
+
+func (o NormalOptions) Validate() error {
+	if o.Kernel < 0 || int(o.Kernel) >= len(NormalKernelList) {
+		return fmt.Errorf("invalid normal kernel: %d", o.Kernel)
+	}
+	if o.Convention < 0 || int(o.Convention) >= len(NormalConventionList) {
+		return fmt.Errorf("invalid normal convention: %d", o.Convention)
+	}
+	if o.Strength <= 0 {
+		return fmt.Errorf("normal strength must be greater than 0, got: %f", o.Strength)
+	}
+
+	return nil
+}
+
+type HeightOptions struct {
+	Convention NormalConvention
+	// Iterations of the poisson solver, more iterations recover larger shapes.
+	Iterations int
+	Wrap       bool
+}
+
+func DefaultHeightOptions() HeightOptions {
+	return HeightOptions{
+		Convention: NORMALCONVENTION_OPENGL,
+		Iterations: 256,
+		Wrap:       false,
+	}
+}
+
+func (o HeightOptions) Validate() error {
+	if o.Convention < 0 || int(o.Convention) >= len(NormalConventionList) {
+		return fmt.Errorf("invalid normal convention: %d", o.Convention)
+	}
+	if o.Iterations < 0 {
+		return fmt.Errorf("height iterations must not be negative, got: %d", o.Iterations)
+	}
+
+	return nil
+}
+
+type AOOptions struct {
+	// Radius in pixels that is searched for occluders.
+	Radius int
+	// Directions is the number of directions searched around each pixel.
+	Directions int
+	// Depth is the height in pixels of a white pixel in the height map.
+	Depth    float64
+	Strength float64
+	Wrap     bool
+}
+
+func DefaultAOOptions() AOOptions {
+	return AOOptions{
+		Radius:     8,
+		Directions: 8,
+		Depth:      8,
+		Strength:   1,
+		Wrap:       false,
+	}
+}
+
+func (o AOOptions) Validate() error {
+	if o.Radius < 1 {
+		return fmt.Errorf("ao radius must be at least 1, got: %d", o.Radius)
+	}
+	if o.Directions < 1 {
+		return fmt.Errorf("ao directions must be at least 1, got: %d", o.Directions)
+	}
+	if o.Depth <= 0 {
+		return fmt.Errorf("ao depth must be greater than 0, got: %f", o.Depth)
+	}
+	if o.Strength < 0 {
+		return fmt.Errorf("ao strength must not be negative, got: %f", o.Strength)
+	}
+
+	return nil
+}
+
+type SDFOptions struct {
+	Algorithm SDFAlgorithm
+	// Spread is the distance in source pixels between the edge and the ends of the range.
+	Spread float64
+	// Scale divides the size of the output, the distance is found at full size first.
+	Scale int
+	// Threshold is the alpha a pixel must be at or above to be inside the shape.
+	Threshold uint8
+}
+
+func DefaultSDFOptions() SDFOptions {
+	return SDFOptions{
+		Algorithm: SDF_FELZENSZWALB,
+		Spread:    8,
+		Scale:     1,
+		Threshold: 128,
+	}
+}
+
+func (o SDFOptions) Validate() error {
+	if o.Algorithm < 0 || int(o.Algorithm) >= len(SDFAlgorithmList) {
+		return fmt.Errorf("invalid sdf algorithm: %d", o.Algorithm)
+	}
+	if o.Spread <= 0 {
+		return fmt.Errorf("sdf spread must be greater than 0, got: %f", o.Spread)
+	}
+	if o.Scale < 1 {
+		return fmt.Errorf("sdf scale must be at least 1, got: %d", o.Scale)
+	}
+
+	return nil
+}
+
+// heightField is a grayscale copy of an image with values between 0 and 1.
+type heightField struct {
+	width  int
+	height int
+	values []float64
+	wrap   bool
+}
+
+func newHeightField(img image.Image, wrap bool) *heightField {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	f := &heightField{width: w, height: h, values: make([]float64, w*h), wrap: wrap}
+	for i := range f.values {
+		p := src.Pix[i*4:]
+		f.values[i] = (0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])) / 255
+	}
+
+	return f
+}
+
+// at returns the value at x,y, either wrapping or clamping to the edges.
+func (f *heightField) at(x, y int) float64 {
+	if f.wrap {
+		x = ((x % f.width) + f.width) % f.width
+		y = ((y % f.height) + f.height) % f.height
+	} else {
+		x = min(max(x, 0), f.width-1)
+		y = min(max(y, 0), f.height-1)
+	}
+
+	return f.values[y*f.width+x]
+}
+
+// NormalMap creates a tangent space normal map, using the luma of the image as the height.
+func NormalMap(img image.Image, opts NormalOptions) *image.NRGBA {
+	f := newHeightField(img, opts.Wrap)
+	out := image.NewNRGBA(image.Rect(0, 0, f.width, f.height))
+
+	// the weights of the outer and center rows, and the sum of one side of the kernel.
+	outer, center := 1.0, 2.0
+	if opts.Kernel == NORMALKERNEL_SCHARR {
+		outer, center = 3.0, 10.0
+	}
+	// the columns are 2 pixels apart, so dividing by twice the weights gives the slope per pixel.
+	norm := 2 * (outer*2 + center)
+
+	for y := range f.height {
+		for x := range f.width {
+			gx := (outer*(f.at(x+1, y-1)-f.at(x-1, y-1)) +
+				center*(f.at(x+1, y)-f.at(x-1, y)) +
+				outer*(f.at(x+1, y+1)-f.at(x-1, y+1))) / norm
+			gy := (outer*(f.at(x-1, y+1)-f.at(x-1, y-1)) +
+				center*(f.at(x, y+1)-f.at(x, y-1)) +
+				outer*(f.at(x+1, y+1)-f.at(x+1, y-1))) / norm
+
+			// image y points down, so a slope down the image faces the normal up.
+			nx := -gx * opts.Strength
+			ny := gy * opts.Strength
+			if opts.Convention == NORMALCONVENTION_DIRECTX {
+				ny = -ny
+			}
+			nz := 1.0
+
+			l := math.Sqrt(nx*nx + ny*ny + nz*nz)
+			i := y*out.Stride + x*4
+			out.Pix[i] = normalChannel(nx / l)
+			out.Pix[i+1] = normalChannel(ny / l)
+			out.Pix[i+2] = normalChannel(nz / l)
+			out.Pix[i+3] = 255
+		}
+	}
+
+	return out
+}
+
+func normalChannel(v float64) uint8 {
+	return uint8(math.Round((v*0.5 + 0.5) * 255))
+}
+
+// HeightFromNormal recovers a height map from a normal map by solving the poisson equation,
+// the result is normalized to use the full range.
+func HeightFromNormal(img image.Image, opts HeightOptions) *image.Gray16 {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewGray16(image.Rect(0, 0, w, h))
+	if w == 0 || h == 0 {
+		return out
+	}
+
+	// the slope to the right and down of each pixel.
+	gx := make([]float64, w*h)
+	gy := make([]float64, w*h)
+	for i := range gx {
+		nx := float64(src.Pix[i*4])/255*2 - 1
+		ny := float64(src.Pix[i*4+1])/255*2 - 1
+		nz := math.Max(float64(src.Pix[i*4+2])/255*2-1, 0.05)
+
+		if opts.Convention == NORMALCONVENTION_DIRECTX {
+			ny = -ny
+		}
+
+		gx[i] = -nx / nz
+		gy[i] = ny / nz
+	}
+
+	index := func(x, y int) (int, bool) {
+		if opts.Wrap {
+			return ((y+h)%h)*w + (x+w)%w, true
+		}
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0, false
+		}
+		return y*w + x, true
+	}
+
+	// the divergence of the slopes, using central differences.
+	div := make([]float64, w*h)
+	for y := range h {
+		for x := range w {
+			v := 0.0
+			if i, ok := index(x+1, y); ok {
+				v += gx[i] / 2
+			}
+			if i, ok := index(x-1, y); ok {
+				v -= gx[i] / 2
+			}
+			if i, ok := index(x, y+1); ok {
+				v += gy[i] / 2
+			}
+			if i, ok := index(x, y-1); ok {
+				v -= gy[i] / 2
+			}
+			div[y*w+x] = v
+		}
+	}
+
+	// start from integrating the rows and columns, then refine with gauss-seidel.
+	heights := make([]float64, w*h)
+	for y := range h {
+		sum := 0.0
+		for x := range w {
+			sum += gx[y*w+x]
+			heights[y*w+x] = sum / 2
+		}
+	}
+	for x := range w {
+		sum := 0.0
+		for y := range h {
+			sum += gy[y*w+x]
+			heights[y*w+x] += sum / 2
+		}
+	}
+
+	// over-relaxation converges faster than plain gauss-seidel.
+	const omega = 1.9
+	for range opts.Iterations {
+		for y := range h {
+			for x := range w {
+				sum := 0.0
+				n := 0.0
+				for _, o := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					if i, ok := index(x+o[0], y+o[1]); ok {
+						sum += heights[i]
+						n++
+					}
+				}
+				if n == 0 {
+					continue
+				}
+
+				i := y*w + x
+				target := (sum - div[i]) / n
+				heights[i] += omega * (target - heights[i])
+			}
+		}
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range heights {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	scale := 0.0
+	if high > low {
+		scale = 1 / (high - low)
+	}
+
+	for y := range h {
+		for x := range w {
+			v := (heights[y*w+x] - low) * scale
+			out.SetGray16(x, y, color.Gray16{Y: uint16(math.Round(v * 0xffff))})
+		}
+	}
+
+	return out
+}
+
+// AmbientOcclusion approximates ambient occlusion from a height map,
+// by finding the highest horizon in each direction around a pixel.
+// White is unoccluded.
+func AmbientOcclusion(img image.Image, opts AOOptions) *image.Gray {
+	f := newHeightField(img, opts.Wrap)
+	out := image.NewGray(image.Rect(0, 0, f.width, f.height))
+
+	dirs := make([][2]float64, opts.Directions)
+	for i := range dirs {
+		angle := float64(i) / float64(opts.Directions) * 2 * math.Pi
+		dirs[i] = [2]float64{math.Cos(angle), math.Sin(angle)}
+	}
+
+	for y := range f.height {
+		for x := range f.width {
+			base := f.values[y*f.width+x] * opts.Depth
+			occlusion := 0.0
+
+			for _, d := range dirs {
+				horizon := 0.0
+
+				for step := 1; step <= opts.Radius; step++ {
+					sx := x + int(math.Round(d[0]*float64(step)))
+					sy := y + int(math.Round(d[1]*float64(step)))
+					if !f.wrap && (sx < 0 || sy < 0 || sx >= f.width || sy >= f.height) {
+						break
+					}
+
+					rise := f.at(sx, sy)*opts.Depth - base
+					if rise <= 0 {
+						continue
+					}
+
+					// the sine of the elevation angle, weighted to fade out with distance.
+					dist := float64(step)
+					sin := rise / math.Sqrt(rise*rise+dist*dist)
+					sin *= 1 - dist/float64(opts.Radius+1)
+					horizon = math.Max(horizon, sin)
+				}
+
+				occlusion += horizon
+			}
+
+			occlusion /= float64(len(dirs))
+			v := math.Max(0, 1-occlusion*opts.Strength)
+			out.Pix[y*out.Stride+x] = uint8(math.Round(v * 255))
+		}
+	}
+
+	return out
+}
+
+// SignedDistanceField creates a distance field from the alpha of the image.
+// The edge is at 128, inside the shape is brighter and a distance of spread reaches 255 or 0.
+func SignedDistanceField(img image.Image, opts SDFOptions) *image.Gray {
+	src := imageNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	inside := make([]bool, w*h)
+	for i := range inside {
+		inside[i] = src.Pix[i*4+3] >= opts.Threshold
+	}
+
+	var distIn, distOut []float64
+	if opts.Algorithm == SDF_8SSEDT {
+		// distance from outside pixels to the shape, and from inside pixels to the outside.
+		distOut = sdf8SSEDT(inside, w, h, true)
+		distIn = sdf8SSEDT(inside, w, h, false)
+	} else {
+		distOut = sdfFelzenszwalb(inside, w, h, true)
+		distIn = sdfFelzenszwalb(inside, w, h, false)
+	}
+
+	signed := make([]float64, w*h)
+	for i := range signed {
+		// the edge is between pixels, so half a pixel is removed from each side.
+		if inside[i] {
+			signed[i] = distIn[i] - 0.5
+		} else {
+			signed[i] = -(distOut[i] - 0.5)
+		}
+	}
+
+	ow := (w + opts.Scale - 1) / opts.Scale
+	oh := (h + opts.Scale - 1) / opts.Scale
+	out := image.NewGray(image.Rect(0, 0, ow, oh))
+
+	for oy := range oh {
+		for ox := range ow {
+			sum := 0.0
+			n := 0
+			for y := oy * opts.Scale; y < min((oy+1)*opts.Scale, h); y++ {
+				for x := ox * opts.Scale; x < min((ox+1)*opts.Scale, w); x++ {
+					sum += signed[y*w+x]
+					n++
+				}
+			}
+
+			v := 0.5 + sum/float64(n)/(2*opts.Spread)
+			out.Pix[oy*out.Stride+ox] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+		}
+	}
+
+	return out
+}
+
+// sdfInf is larger than any distance in an image, while staying safe to square.
+const sdfInf = 1e10
+
+// sdf8SSEDT finds the distance from each pixel to the closest pixel where inside matches target.
+func sdf8SSEDT(inside []bool, w, h int, target bool) []float64 {
+	type offset struct{ dx, dy int }
+
+	grid := make([]offset, w*h)
+	far := offset{1 << 14, 1 << 14}
+	for i, in := range inside {
+		if in != target {
+			grid[i] = far
+		}
+	}
+
+	dist := func(o offset) int {
+		return o.dx*o.dx + o.dy*o.dy
+	}
+	compare := func(x, y, ox, oy int) {
+		nx, ny := x+ox, y+oy
+		if nx < 0 || ny < 0 || nx >= w || ny >= h {
+			return
+		}
+
+		o := grid[ny*w+nx]
+		o.dx += ox
+		o.dy += oy
+		if dist(o) < dist(grid[y*w+x]) {
+			grid[y*w+x] = o
+		}
+	}
+
+	for y := range h {
+		for x := range w {
+			compare(x, y, -1, 0)
+			compare(x, y, 0, -1)
+			compare(x, y, -1, -1)
+			compare(x, y, 1, -1)
+		}
+		for x := w - 1; x >= 0; x-- {
+			compare(x, y, 1, 0)
+		}
+	}
+
+	for y := h - 1; y >= 0; y-- {
+		for x := w - 1; x >= 0; x-- {
+			compare(x, y, 1, 0)
+			compare(x, y, 0, 1)
+			compare(x, y, -1, 1)
+			compare(x, y, 1, 1)
+		}
+		for x := range w {
+			compare(x, y, -1, 0)
+		}
+	}
+
+	result := make([]float64, w*h)
+	for i, o := range grid {
+		if o == far {
+			result[i] = sdfInf
+			continue
+		}
+		result[i] = math.Sqrt(float64(dist(o)))
+	}
+
+	return result
+}
+
+// sdfFelzenszwalb finds the exact distance from each pixel to the closest pixel where inside matches target.
+func sdfFelzenszwalb(inside []bool, w, h int, target bool) []float64 {
+	grid := make([]float64, w*h)
+	for i, in := range inside {
+		if in != target {
+			grid[i] = sdfInf
+		}
+	}
+
+	n := max(w, h)
+	f := make([]float64, n)
+	d := make([]float64, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+
+	for x := range w {
+		for y := range h {
+			f[y] = grid[y*w+x]
+		}
+		sdfTransform1D(f[:h], d[:h], v, z)
+		for y := range h {
+			grid[y*w+x] = d[y]
+		}
+	}
+
+	for y := range h {
+		copy(f[:w], grid[y*w:y*w+w])
+		sdfTransform1D(f[:w], d[:w], v, z)
+		copy(grid[y*w:y*w+w], d[:w])
+	}
+
+	for i, sq := range grid {
+		if sq >= sdfInf {
+			grid[i] = sdfInf
+			continue
+		}
+		grid[i] = math.Sqrt(sq)
+	}
+
+	return grid
+}
+
+// sdfTransform1D is the 1D squared distance transform, using the lower envelope of parabolas.
+func sdfTransform1D(f, d []float64, v []int, z []float64) {
+	n := len(f)
+	if n == 0 {
+		return
+	}
+
+	k := 0
+	v[0] = 0
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+
+	for q := 1; q < n; q++ {
+		var s float64
+		for {
+			p := v[k]
+			s = ((f[q] + float64(q*q)) - (f[p] + float64(p*p))) / float64(2*q-2*p)
+			if s > z[k] || k == 0 {
+				break
+			}
+			k--
+		}
+
+		if s <= z[k] {
+			// only reached when k is 0 and the first parabola is fully covered.
+			v[0] = q
+			z[1] = math.Inf(1)
+			continue
+		}
+
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+
+	k = 0
+	for q := range n {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		p := v[k]
+		d[q] = float64((q-p)*(q-p)) + f[p]
+	}
+}
@@ -0,0 +1,390 @@
+package imageutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	tgaTypeColorMapped = 1
+	tgaTypeTrueColor   = 2
+	tgaTypeGray        = 3
+	tgaTypeRLE         = 8
+)
+
+const (
+	tgaDescriptorAlpha = 0x0F
+	tgaDescriptorRight = 0x10
+	tgaDescriptorTop   = 0x20
+)
+
+const tgaHeaderSize = 18
+
+type tgaHeader struct {
+	idLength     int
+	colorMapType byte
+	imageType    byte
+	mapStart     int
+	mapLength    int
+	mapDepth     int
+	width        int
+	height       int
+	depth        int
+	descriptor   byte
+}
+
+func tgaHeaderParse(b []byte) (*tgaHeader, error) {
+	h := &tgaHeader{
+		idLength:     int(b[0]),
+		colorMapType: b[1],
+		imageType:    b[2],
+		mapStart:     int(binary.LittleEndian.Uint16(b[3:5])),
+		mapLength:    int(binary.LittleEndian.Uint16(b[5:7])),
+		mapDepth:     int(b[7]),
+		width:        int(binary.LittleEndian.Uint16(b[12:14])),
+		height:       int(binary.LittleEndian.Uint16(b[14:16])),
+		depth:        int(b[16]),
+		descriptor:   b[17],
+	}
+
+	if h.colorMapType > 1 {
+		return nil, fmt.Errorf("invalid tga color map type: %d", h.colorMapType)
+	}
+
+	switch h.imageType &^ tgaTypeRLE {
+	case tgaTypeColorMapped:
+		if h.colorMapType != 1 {
+			return nil, fmt.Errorf("color mapped tga is missing its color map")
+		}
+		if h.depth != 8 && h.depth != 16 {
+			return nil, fmt.Errorf("unsupported tga color map index depth: %d", h.depth)
+		}
+		if !tgaColorDepth(h.mapDepth) {
+			return nil, fmt.Errorf("unsupported tga color map depth: %d", h.mapDepth)
+		}
+	case tgaTypeTrueColor:
+		if !tgaColorDepth(h.depth) {
+			return nil, fmt.Errorf("unsupported tga depth: %d", h.depth)
+		}
+	case tgaTypeGray:
+		if h.depth != 8 && h.depth != 16 {
+			return nil, fmt.Errorf("unsupported tga gray depth: %d", h.depth)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tga image type: %d", h.imageType)
+	}
+
+	return h, nil
+}
+
+func tgaColorDepth(depth int) bool {
+	return depth == 15 || depth == 16 || depth == 24 || depth == 32
+}
+
+// tgaValidHeader is used when detecting the encoding, as tga has no magic bytes.
+func tgaValidHeader(b []byte) bool {
+	if len(b) < tgaHeaderSize {
+		return false
+	}
+
+	h, err := tgaHeaderParse(b)
+	if err != nil {
+		return false
+	}
+
+	return h.width > 0 && h.height > 0 && h.descriptor&0xC0 == 0 && (h.colorMapType == 1 || h.mapLength == 0)
+}
+
+func TGADecodeConfig(r io.Reader) (image.Config, error) {
+	b := make([]byte, tgaHeaderSize)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	h, err := tgaHeaderParse(b)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if err := decodeSizeCheck(h.width, h.height, 4); err != nil {
+		return image.Config{}, err
+	}
+
+	model := color.NRGBAModel
+	if h.imageType&^tgaTypeRLE == tgaTypeGray && h.depth == 8 {
+		model = color.GrayModel
+	}
+
+	return image.Config{
+		ColorModel: model,
+		Width:      h.width,
+		Height:     h.height,
+	}, nil
+}
+
+// TGADecode supports color mapped, true color and gray images, with or without RLE compression.
+// 8-bit gray images are decoded as image.Gray, all others as image.NRGBA.
+func TGADecode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	b := make([]byte, tgaHeaderSize)
+	_, err := io.ReadFull(br, b)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := tgaHeaderParse(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeSizeCheck(h.width, h.height, 4); err != nil {
+		return nil, err
+	}
+
+	_, err = br.Discard(h.idLength)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	// 16-bit colors only have an alpha bit when the descriptor says so,
+	// 32-bit colors always use their alpha as many encoders leave the descriptor empty.
+	alpha := h.descriptor&tgaDescriptorAlpha != 0
+
+	var colorMap []color.NRGBA
+	if h.colorMapType == 1 {
+		size := (h.mapDepth + 7) / 8
+		data := make([]byte, h.mapLength*size)
+		_, err := io.ReadFull(br, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.imageType&^tgaTypeRLE == tgaTypeColorMapped {
+			colorMap = make([]color.NRGBA, h.mapStart+h.mapLength)
+			for i := range h.mapLength {
+				colorMap[h.mapStart+i] = tgaColor(data[i*size:], h.mapDepth, alpha)
+			}
+		}
+	}
+
+	size := (h.depth + 7) / 8
+	data := make([]byte, h.width*h.height*size)
+
+	if h.imageType&tgaTypeRLE != 0 {
+		err = tgaRLEDecode(br, data, size)
+	} else {
+		_, err = io.ReadFull(br, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	gray := h.imageType&^tgaTypeRLE == tgaTypeGray && h.depth == 8
+	var img image.Image
+	if gray {
+		img = image.NewGray(rect)
+	} else {
+		img = image.NewNRGBA(rect)
+	}
+
+	for i := range h.width * h.height {
+		x := i % h.width
+		y := i / h.width
+		if h.descriptor&tgaDescriptorRight != 0 {
+			x = h.width - 1 - x
+		}
+		if h.descriptor&tgaDescriptorTop == 0 {
+			y = h.height - 1 - y
+		}
+
+		p := data[i*size:]
+
+		if gray {
+			img.(*image.Gray).Pix[y*h.width+x] = p[0]
+			continue
+		}
+
+		var c color.NRGBA
+		switch h.imageType &^ tgaTypeRLE {
+		case tgaTypeColorMapped:
+			index := int(p[0])
+			if size == 2 {
+				index = int(binary.LittleEndian.Uint16(p))
+			}
+			if index >= len(colorMap) {
+				return nil, fmt.Errorf("tga color map index out of range: %d", index)
+			}
+			c = colorMap[index]
+		case tgaTypeTrueColor:
+			c = tgaColor(p, h.depth, alpha)
+		case tgaTypeGray:
+			// 16-bit gray is a gray and alpha pair.
+			c = color.NRGBA{p[0], p[0], p[0], p[1]}
+		}
+
+		img.(*image.NRGBA).SetNRGBA(x, y, c)
+	}
+
+	return img, nil
+}
+
+func tgaColor(p []byte, depth int, alpha bool) color.NRGBA {
+	switch depth {
+	case 15, 16:
+		v := binary.LittleEndian.Uint16(p)
+		c := color.NRGBA{
+			R: tgaExpand5(v >> 10),
+			G: tgaExpand5(v >> 5),
+			B: tgaExpand5(v),
+			A: 255,
+		}
+		if depth == 16 && alpha && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 24:
+		return color.NRGBA{p[2], p[1], p[0], 255}
+	}
+
+	return color.NRGBA{p[2], p[1], p[0], p[3]}
+}
+
+func tgaExpand5(v uint16) uint8 {
+	v &= 0x1F
+	return uint8(v<<3 | v>>2)
+}
+
+func tgaRLEDecode(r *bufio.Reader, data []byte, size int) error {
+	pixel := make([]byte, size)
+
+	for p := 0; p < len(data); {
+		head, err := r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		count := int(head&0x7F) + 1
+		if p+count*size > len(data) {
+			return fmt.Errorf("tga rle packet is larger than the image")
+		}
+
+		if head&0x80 != 0 {
+			_, err := io.ReadFull(r, pixel)
+			if err != nil {
+				return err
+			}
+			for range count {
+				copy(data[p:], pixel)
+				p += size
+			}
+		} else {
+			_, err := io.ReadFull(r, data[p:p+count*size])
+			if err != nil {
+				return err
+			}
+			p += count * size
+		}
+	}
+
+	return nil
+}
+
+// TGAEncode writes a 32-bit top-left origin image, or an 8-bit gray image for image.Gray.
+func TGAEncode(w io.Writer, img image.Image, rle bool) error {
+	b := img.Bounds()
+	if b.Dx() > 0xFFFF || b.Dy() > 0xFFFF {
+		return fmt.Errorf("image is too large for tga: %dx%d", b.Dx(), b.Dy())
+	}
+
+	var data []byte
+	size := 4
+	header := make([]byte, tgaHeaderSize)
+	header[2] = tgaTypeTrueColor
+	header[16] = 32
+	header[17] = tgaDescriptorTop | 8
+
+	if g, ok := img.(*image.Gray); ok {
+		size = 1
+		header[2] = tgaTypeGray
+		header[16] = 8
+		header[17] = tgaDescriptorTop
+
+		data = make([]byte, 0, b.Dx()*b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			data = append(data, g.Pix[g.PixOffset(b.Min.X, y):g.PixOffset(b.Max.X, y)]...)
+		}
+	} else {
+		n := imageNRGBA(img)
+		data = make([]byte, len(n.Pix))
+		for i := 0; i < len(n.Pix); i += 4 {
+			data[i+0] = n.Pix[i+2]
+			data[i+1] = n.Pix[i+1]
+			data[i+2] = n.Pix[i+0]
+			data[i+3] = n.Pix[i+3]
+		}
+	}
+
+	binary.LittleEndian.PutUint16(header[12:14], uint16(b.Dx()))
+	binary.LittleEndian.PutUint16(header[14:16], uint16(b.Dy()))
+
+	if rle {
+		header[2] |= tgaTypeRLE
+		data = tgaRLEEncode(data, size, b.Dx())
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header)
+	bw.Write(data)
+	return bw.Flush()
+}
+
+// tgaRLEEncode packs each row separately, as packets crossing rows are not allowed.
+func tgaRLEEncode(data []byte, size, width int) []byte {
+	out := make([]byte, 0, len(data))
+	stride := width * size
+
+	for row := 0; row < len(data); row += stride {
+		line := data[row : row+stride]
+
+		for x := 0; x < width; {
+			// count how many times the current pixel repeats.
+			run := 1
+			for x+run < width && run < 128 && pixelEqual(line, x, x+run, size) {
+				run++
+			}
+
+			if run > 1 {
+				out = append(out, 0x80|byte(run-1))
+				out = append(out, line[x*size:(x+1)*size]...)
+				x += run
+				continue
+			}
+
+			// collect pixels until the next repeat.
+			raw := 1
+			for x+raw < width && raw < 128 && !(x+raw+1 < width && pixelEqual(line, x+raw, x+raw+1, size)) {
+				raw++
+			}
+
+			out = append(out, byte(raw-1))
+			out = append(out, line[x*size:(x+raw)*size]...)
+			x += raw
+		}
+	}
+
+	return out
+}
+
+func pixelEqual(line []byte, a, b, size int) bool {
+	for i := range size {
+		if line[a*size+i] != line[b*size+i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+type ToneMapOperator int
+
+const (
+	TONEMAP_REINHARD ToneMapOperator = iota
+	TONEMAP_ACES
+)
+
+var ToneMapOperatorList = []ToneMapOperator{
+	TONEMAP_REINHARD,
+	TONEMAP_ACES,
+}
+
+type ToneMapOptions struct {
+	Operator ToneMapOperator
+	// Exposure is in stops, each stop doubles the brightness before mapping.
+	Exposure float64
+	// White is the luminance mapped to 1 by the Reinhard operator, 0 disables it so only infinity maps to 1.
+	White float64
+}
+
+func DefaultToneMapOptions() ToneMapOptions {
+	return ToneMapOptions{
+		Operator: TONEMAP_REINHARD,
+		Exposure: 0,
+		White:    0,
+	}
+}
+
+func (o ToneMapOptions) Validate() error {
+	if o.Operator < TONEMAP_REINHARD || o.Operator > TONEMAP_ACES {
+		return fmt.Errorf("unsupported tone map operator: %d", o.Operator)
+	}
+	if o.White < 0 {
+		return fmt.Errorf("tone map white cannot be negative, got: %f", o.White)
+	}
+
+	return nil
+}
+
+// ToneMap compresses high dynamic range light to between 0 and 1, keeping the result in linear light.
+// Reinhard scales each pixel by its luminance, which keeps the hue, while ACES maps each channel for a filmic contrast.
+func ToneMap(img image.Image, opts ToneMapOptions) (*RGBAF32, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	src := rgbaf32Image(img)
+	b := src.Bounds()
+	dst := NewRGBAF32(image.Rect(0, 0, b.Dx(), b.Dy()))
+
+	exposure := float32(math.Exp2(opts.Exposure))
+	white2 := float32(opts.White * opts.White)
+
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			r, g, bl, a := src.RGBAF32At(b.Min.X+x, b.Min.Y+y).NRGBA()
+			r, g, bl = max(r*exposure, 0), max(g*exposure, 0), max(bl*exposure, 0)
+
+			switch opts.Operator {
+			case TONEMAP_REINHARD:
+				l := 0.2126*r + 0.7152*g + 0.0722*bl
+				if l > 0 {
+					ld := l / (1 + l)
+					if white2 > 0 {
+						ld = l * (1 + l/white2) / (1 + l)
+					}
+					s := ld / l
+					r, g, bl = r*s, g*s, bl*s
+				}
+			case TONEMAP_ACES:
+				r, g, bl = toneMapACES(r), toneMapACES(g), toneMapACES(bl)
+			}
+
+			dst.SetRGBAF32(x, y, NewColorRGBAF32(clampF32(r), clampF32(g), clampF32(bl), a))
+		}
+	}
+
+	return dst, nil
+}
+
+// toneMapACES is the fit of the ACES filmic curve by Krzysztof Narkowicz.
+func toneMapACES(v float32) float32 {
+	return (v * (2.51*v + 0.03)) / (v*(2.43*v+0.59) + 0.14)
+}
@@ -0,0 +1,281 @@
+package imageutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/kolesa-team/go-webp/decoder"
+	"github.com/kolesa-team/go-webp/webp"
+)
+
+const webpFlagAnimation = 0x02
+
+const (
+	webpFrameDispose = 0x01
+	webpFrameNoBlend = 0x02
+)
+
+type webpChunkData struct {
+	typ  string
+	data []byte
+}
+
+func webpChunks(data []byte) ([]webpChunkData, error) {
+	chunks := []webpChunkData{}
+
+	p := 0
+	for p+8 <= len(data) {
+		typ := string(data[p : p+4])
+		ln := int(binary.LittleEndian.Uint32(data[p+4 : p+8]))
+		if p+8+ln > len(data) {
+			return nil, fmt.Errorf("invalid webp chunk length at %d", p)
+		}
+
+		chunks = append(chunks, webpChunkData{typ: typ, data: data[p+8 : p+8+ln]})
+		p += 8 + ln + ln%2
+	}
+
+	return chunks, nil
+}
+
+func webpFile(chunks ...webpChunkData) []byte {
+	body := []byte("WEBP")
+	for _, c := range chunks {
+		body = append(body, webpChunk(c.typ, c.data)...)
+	}
+
+	b := []byte("RIFF")
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)))
+	return append(b, body...)
+}
+
+// WebPAnimDecode decodes all frames of an animated WebP, composited onto the full canvas.
+// A WebP without animation is returned as a single frame.
+func WebPAnimDecode(r io.Reader, limits DecodeLimits) (*Animation, error) {
+	data, err := limits.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("invalid webp")
+	}
+
+	chunks, err := webpChunks(data[12:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chunks) == 0 || chunks[0].typ != "VP8X" || len(chunks[0].data) < 10 || chunks[0].data[0]&webpFlagAnimation == 0 {
+		if limits.MaxPixels > 0 {
+			cfg, err := webp.DecodeConfig(bytes.NewReader(data), &decoder.Options{})
+			if err != nil {
+				return nil, err
+			}
+			if err := limits.CheckPixels(cfg.Width, cfg.Height); err != nil {
+				return nil, err
+			}
+		}
+
+		img, err := webp.Decode(bytes.NewReader(data), &decoder.Options{})
+		if err != nil {
+			return nil, err
+		}
+
+		return &Animation{
+			Frames:   []image.Image{img},
+			Delay:    []int{0},
+			Disposal: []byte{gif.DisposalNone},
+		}, nil
+	}
+
+	vp8x := chunks[0].data
+	width := int(uint24(vp8x[4:7])) + 1
+	height := int(uint24(vp8x[7:10])) + 1
+	if err := limits.CheckPixels(width, height); err != nil {
+		return nil, err
+	}
+
+	frames := 0
+	for _, c := range chunks[1:] {
+		if c.typ == "ANMF" {
+			frames++
+		}
+	}
+	if err := limits.CheckFrames(frames); err != nil {
+		return nil, err
+	}
+
+	comp := newAnimationCompositor(width, height)
+
+	anim := &Animation{
+		Frames:   []image.Image{},
+		Delay:    []int{},
+		Disposal: []byte{},
+	}
+
+	for _, c := range chunks[1:] {
+		switch c.typ {
+		case "ANIM":
+			if len(c.data) < 6 {
+				return nil, fmt.Errorf("invalid webp ANIM chunk")
+			}
+			anim.LoopCount = playsToLoopCount(int(binary.LittleEndian.Uint16(c.data[4:6])))
+
+		case "ANMF":
+			if len(c.data) < 16 {
+				return nil, fmt.Errorf("invalid webp ANMF chunk")
+			}
+
+			x := int(uint24(c.data[0:3])) * 2
+			y := int(uint24(c.data[3:6])) * 2
+			w := int(uint24(c.data[6:9])) + 1
+			h := int(uint24(c.data[9:12])) + 1
+			duration := int(uint24(c.data[12:15]))
+			flags := c.data[15]
+
+			if err := animationCheckFrame(image.Rect(x, y, x+w, y+h), width, height); err != nil {
+				return nil, fmt.Errorf("invalid webp frame %d: %s", len(anim.Frames), err)
+			}
+
+			img, err := webpFrameDecode(c.data[16:], w, h)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode webp frame %d: %s", len(anim.Frames), err)
+			}
+
+			frame := image.NewNRGBA(image.Rect(x, y, x+w, y+h))
+			draw.Draw(frame, frame.Rect, img, img.Bounds().Min, draw.Src)
+
+			dispose := byte(gif.DisposalNone)
+			if flags&webpFrameDispose != 0 {
+				dispose = gif.DisposalBackground
+			}
+
+			anim.Frames = append(anim.Frames, comp.frame(frame, flags&webpFrameNoBlend == 0, dispose))
+			anim.Delay = append(anim.Delay, (duration+5)/10)
+			anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+		}
+	}
+
+	if len(anim.Frames) == 0 {
+		return nil, fmt.Errorf("animated webp has no frames")
+	}
+
+	return anim, nil
+}
+
+// webpFrameDecode wraps the frame data as a standalone webp so it can use the webp decoder.
+func webpFrameDecode(data []byte, width, height int) (image.Image, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	hasAlpha := false
+	for _, c := range chunks {
+		if c.typ == "ALPH" {
+			hasAlpha = true
+		}
+	}
+
+	if hasAlpha {
+		vp8x := make([]byte, 10)
+		vp8x[0] = webpFlagAlpha
+		putUint24(vp8x[4:7], uint32(width-1))
+		putUint24(vp8x[7:10], uint32(height-1))
+
+		chunks = append([]webpChunkData{{typ: "VP8X", data: vp8x}}, chunks...)
+	}
+
+	return webp.Decode(bytes.NewReader(webpFile(chunks...)), &decoder.Options{})
+}
+
+// WebPAnimEncode writes the animation as an animated WebP, each frame is encoded using the webp options.
+// WebP cannot restore the previous frame, so gif.DisposalPrevious is written as dispose to background.
+func WebPAnimEncode(w io.Writer, anim *Animation, options *EncodeOptions) error {
+	if options == nil {
+		options = DefaultEncodeOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if err := anim.Validate(); err != nil {
+		return err
+	}
+
+	opts, err := webpOptions(options)
+	if err != nil {
+		return err
+	}
+
+	canvas := anim.Canvas()
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpFlagAnimation | webpFlagAlpha
+	putUint24(vp8x[4:7], uint32(canvas.Dx()-1))
+	putUint24(vp8x[7:10], uint32(canvas.Dy()-1))
+
+	animChunk := make([]byte, 6)
+	binary.LittleEndian.PutUint16(animChunk[4:6], uint16(loopCountToPlays(anim.LoopCount)))
+
+	chunks := []webpChunkData{
+		{typ: "VP8X", data: vp8x},
+		{typ: "ANIM", data: animChunk},
+	}
+
+	for i, f := range anim.Frames {
+		frame := animationFrameNRGBA(f)
+
+		// frame offsets are stored divided by 2.
+		if frame.Rect.Min.X%2 != 0 || frame.Rect.Min.Y%2 != 0 {
+			rect := image.Rect(frame.Rect.Min.X&^1, frame.Rect.Min.Y&^1, frame.Rect.Max.X, frame.Rect.Max.Y)
+			even := image.NewNRGBA(rect)
+			draw.Draw(even, frame.Rect, frame, frame.Rect.Min, draw.Src)
+			frame = even
+		}
+
+		buf := &bytes.Buffer{}
+		err := webp.Encode(buf, frame, opts)
+		if err != nil {
+			return fmt.Errorf("failed to encode webp frame %d: %s", i, err)
+		}
+
+		frameChunks, err := webpChunks(buf.Bytes()[12:])
+		if err != nil {
+			return err
+		}
+
+		anmf := make([]byte, 16)
+		putUint24(anmf[0:3], uint32(frame.Rect.Min.X/2))
+		putUint24(anmf[3:6], uint32(frame.Rect.Min.Y/2))
+		putUint24(anmf[6:9], uint32(frame.Rect.Dx()-1))
+		putUint24(anmf[9:12], uint32(frame.Rect.Dy()-1))
+		putUint24(anmf[12:15], uint32(anim.Delay[i]*10))
+
+		switch anim.disposal(i) {
+		case gif.DisposalBackground, gif.DisposalPrevious:
+			anmf[15] = webpFrameDispose
+		}
+
+		for _, c := range frameChunks {
+			switch c.typ {
+			case "ALPH", "VP8 ", "VP8L":
+				anmf = append(anmf, webpChunk(c.typ, c.data)...)
+			}
+		}
+
+		chunks = append(chunks, webpChunkData{typ: "ANMF", data: anmf})
+	}
+
+	_, err = w.Write(webpFile(chunks...))
+	return err
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
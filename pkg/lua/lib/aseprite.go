@@ -0,0 +1,354 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua"
+	golua "github.com/yuin/gopher-lua"
+)
+
+const LIB_ASEPRITE = "aseprite"
+
+/// @lib Aseprite
+/// @import aseprite
+/// @desc
+/// Library for importing .ase and .aseprite files.
+/// @section
+/// Frames are returned as images, so they can be used with spritesheet.from_frames or a gamemaker sprite.
+
+func RegisterAseprite(r *lua.Runner, lg *log.Logger) {
+	lib, tab := lua.NewLib(LIB_ASEPRITE, r, r.State, lg)
+
+	/// @func decode(path, name, encoding, model?, options?) -> struct<aseprite.File>
+	/// @arg path {string}
+	/// @arg name {string} - Each frame is named with the frame index appended.
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<aseprite.File>}
+	/// @desc
+	/// Frames are composited from the visible layers.
+	lib.CreateFunction(tab, "decode",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			ase := asepriteDecodeFile(r, lg, state, args["path"].(string), args["options"].(*golua.LTable))
+
+			t := asepriteTable(r, lib, lg, state, &d, ase, args["name"].(string), args["encoding"].(int), args["model"].(int), ase.LayerVisible)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func decode_string(data, name, encoding, model?, options?) -> struct<aseprite.File>
+	/// @arg data {string}
+	/// @arg name {string} - Each frame is named with the frame index appended.
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<aseprite.File>}
+	/// @desc
+	/// Frames are composited from the visible layers.
+	lib.CreateFunction(tab, "decode_string",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "data"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
+			ase, err := imageutil.AsepriteDecode(strings.NewReader(args["data"].(string)), opts.Limits)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode aseprite: %s", log.LEVEL_ERROR, err))
+			}
+
+			t := asepriteTable(r, lib, lg, state, &d, ase, args["name"].(string), args["encoding"].(int), args["model"].(int), ase.LayerVisible)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func decode_layers(path, name, encoding, layers, model?, options?) -> struct<aseprite.File>
+	/// @arg path {string}
+	/// @arg name {string} - Each frame is named with the frame index appended.
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg layers {[]string} - The names of the layers to composite, hidden layers are included when named.
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<aseprite.File>}
+	lib.CreateFunction(tab, "decode_layers",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			lua.ArgArray("layers", lua.ArrayType{Type: lua.STRING}, false),
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			ase := asepriteDecodeFile(r, lg, state, args["path"].(string), args["options"].(*golua.LTable))
+
+			names := []string{}
+			for _, v := range args["layers"].([]any) {
+				names = append(names, v.(string))
+			}
+
+			for _, name := range names {
+				if !slices.ContainsFunc(ase.Layers, func(l imageutil.AsepriteLayer) bool { return l.Name == name }) {
+					lua.Error(state, lg.Appendf("aseprite layer does not exist: %s", log.LEVEL_ERROR, name))
+				}
+			}
+
+			include := func(layer int) bool {
+				return slices.Contains(names, ase.Layers[layer].Name)
+			}
+
+			t := asepriteTable(r, lib, lg, state, &d, ase, args["name"].(string), args["encoding"].(int), args["model"].(int), include)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @constants LayerType {int}
+	/// @const LAYER_IMAGE
+	/// @const LAYER_GROUP
+	/// @const LAYER_TILEMAP - Tilemap layers are not drawn.
+	tab.RawSetString("LAYER_IMAGE", golua.LNumber(imageutil.ASEPRITELAYER_IMAGE))
+	tab.RawSetString("LAYER_GROUP", golua.LNumber(imageutil.ASEPRITELAYER_GROUP))
+	tab.RawSetString("LAYER_TILEMAP", golua.LNumber(imageutil.ASEPRITELAYER_TILEMAP))
+
+	/// @constants BlendMode {int}
+	/// @const BLEND_NORMAL
+	/// @const BLEND_MULTIPLY
+	/// @const BLEND_SCREEN
+	/// @const BLEND_OVERLAY
+	/// @const BLEND_DARKEN
+	/// @const BLEND_LIGHTEN
+	/// @const BLEND_COLOR_DODGE
+	/// @const BLEND_COLOR_BURN
+	/// @const BLEND_HARD_LIGHT
+	/// @const BLEND_SOFT_LIGHT
+	/// @const BLEND_DIFFERENCE
+	/// @const BLEND_EXCLUSION
+	/// @const BLEND_HUE
+	/// @const BLEND_SATURATION
+	/// @const BLEND_COLOR
+	/// @const BLEND_LUMINOSITY
+	/// @const BLEND_ADDITION
+	/// @const BLEND_SUBTRACT
+	/// @const BLEND_DIVIDE
+	tab.RawSetString("BLEND_NORMAL", golua.LNumber(imageutil.ASEPRITEBLEND_NORMAL))
+	tab.RawSetString("BLEND_MULTIPLY", golua.LNumber(imageutil.ASEPRITEBLEND_MULTIPLY))
+	tab.RawSetString("BLEND_SCREEN", golua.LNumber(imageutil.ASEPRITEBLEND_SCREEN))
+	tab.RawSetString("BLEND_OVERLAY", golua.LNumber(imageutil.ASEPRITEBLEND_OVERLAY))
+	tab.RawSetString("BLEND_DARKEN", golua.LNumber(imageutil.ASEPRITEBLEND_DARKEN))
+	tab.RawSetString("BLEND_LIGHTEN", golua.LNumber(imageutil.ASEPRITEBLEND_LIGHTEN))
+	tab.RawSetString("BLEND_COLOR_DODGE", golua.LNumber(imageutil.ASEPRITEBLEND_COLOR_DODGE))
+	tab.RawSetString("BLEND_COLOR_BURN", golua.LNumber(imageutil.ASEPRITEBLEND_COLOR_BURN))
+	tab.RawSetString("BLEND_HARD_LIGHT", golua.LNumber(imageutil.ASEPRITEBLEND_HARD_LIGHT))
+	tab.RawSetString("BLEND_SOFT_LIGHT", golua.LNumber(imageutil.ASEPRITEBLEND_SOFT_LIGHT))
+	tab.RawSetString("BLEND_DIFFERENCE", golua.LNumber(imageutil.ASEPRITEBLEND_DIFFERENCE))
+	tab.RawSetString("BLEND_EXCLUSION", golua.LNumber(imageutil.ASEPRITEBLEND_EXCLUSION))
+	tab.RawSetString("BLEND_HUE", golua.LNumber(imageutil.ASEPRITEBLEND_HUE))
+	tab.RawSetString("BLEND_SATURATION", golua.LNumber(imageutil.ASEPRITEBLEND_SATURATION))
+	tab.RawSetString("BLEND_COLOR", golua.LNumber(imageutil.ASEPRITEBLEND_COLOR))
+	tab.RawSetString("BLEND_LUMINOSITY", golua.LNumber(imageutil.ASEPRITEBLEND_LUMINOSITY))
+	tab.RawSetString("BLEND_ADDITION", golua.LNumber(imageutil.ASEPRITEBLEND_ADDITION))
+	tab.RawSetString("BLEND_SUBTRACT", golua.LNumber(imageutil.ASEPRITEBLEND_SUBTRACT))
+	tab.RawSetString("BLEND_DIVIDE", golua.LNumber(imageutil.ASEPRITEBLEND_DIVIDE))
+
+	/// @constants Direction {int}
+	/// @const DIRECTION_FORWARD
+	/// @const DIRECTION_REVERSE
+	/// @const DIRECTION_PINGPONG
+	/// @const DIRECTION_PINGPONG_REVERSE
+	tab.RawSetString("DIRECTION_FORWARD", golua.LNumber(imageutil.ASEPRITEDIRECTION_FORWARD))
+	tab.RawSetString("DIRECTION_REVERSE", golua.LNumber(imageutil.ASEPRITEDIRECTION_REVERSE))
+	tab.RawSetString("DIRECTION_PINGPONG", golua.LNumber(imageutil.ASEPRITEDIRECTION_PINGPONG))
+	tab.RawSetString("DIRECTION_PINGPONG_REVERSE", golua.LNumber(imageutil.ASEPRITEDIRECTION_PINGPONG_REVERSE))
+}
+
+func asepriteDecodeFile(r *lua.Runner, lg *log.Logger, state *golua.LState, path string, options *golua.LTable) *imageutil.Aseprite {
+	opts := decodeOptionsBuild(r, state, lg, options)
+
+	file, err := os.Stat(path)
+	if err != nil {
+		lua.Error(state, lg.Appendf("invalid aseprite path provided: %s", log.LEVEL_ERROR, path))
+	}
+	if file.IsDir() {
+		lua.Error(state, lg.Append("cannot load a directory as an aseprite file", log.LEVEL_ERROR))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+	}
+	defer f.Close()
+
+	ase, err := imageutil.AsepriteDecode(f, opts.Limits)
+	if err != nil {
+		lua.Error(state, lg.Appendf("failed to decode aseprite: %s", log.LEVEL_ERROR, err))
+	}
+
+	return ase
+}
+
+func asepriteTable(r *lua.Runner, lib *lua.Lib, lg *log.Logger, state *golua.LState, d *lua.TaskData, ase *imageutil.Aseprite, name string, encoding, model int, include func(layer int) bool) *golua.LTable {
+	/// @struct File
+	/// @prop width {int}
+	/// @prop height {int}
+	/// @prop img {[]int<collection.IMAGE>}
+	/// @prop duration {[]int} - In milliseconds.
+	/// @prop layers {[]struct<aseprite.Layer>}
+	/// @prop tags {[]struct<aseprite.Tag>}
+	/// @prop slices {[]struct<aseprite.Slice>}
+	/// @prop palette {[]struct<image.ColorRGBA>}
+	/// @prop transparent_index {int} - Palette index of the transparent color, starting at 0 like image.pixel_index, so the color is palette[transparent_index+1]. Only used by indexed files.
+
+	enc := lua.ParseEnum(encoding, imageutil.EncodingList, lib)
+	mdl := lua.ParseEnum(model, imageutil.ModelList, lib)
+
+	t := state.NewTable()
+	t.RawSetString("width", golua.LNumber(ase.Width))
+	t.RawSetString("height", golua.LNumber(ase.Height))
+
+	img := state.NewTable()
+	duration := state.NewTable()
+	for fi, f := range ase.Frames {
+		frameName := fmt.Sprintf("%s_%d", name, fi)
+		img.RawSetInt(fi+1, golua.LNumber(r.IC.ScheduleAdd(state, frameName, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+			imghere, mhere := imageutil.Limit(ase.CompositeLayers(fi, include), mdl)
+
+			i.Self = &collection.ItemImage{
+				Name:     frameName,
+				Image:    imghere,
+				Encoding: enc,
+				Model:    mhere,
+			}
+		})))
+		duration.RawSetInt(fi+1, golua.LNumber(f.Duration))
+	}
+	t.RawSetString("img", img)
+	t.RawSetString("duration", duration)
+
+	layers := state.NewTable()
+	for i, l := range ase.Layers {
+		/// @struct Layer
+		/// @prop name {string}
+		/// @prop type {int<aseprite.LayerType>}
+		/// @prop blend {int<aseprite.BlendMode>}
+		/// @prop opacity {int} - Between 0 and 255.
+		/// @prop visible {bool} - False when the layer or one of its parent groups is hidden.
+		/// @prop background {bool}
+		/// @prop reference {bool}
+		/// @prop level {int} - The depth of the layer in the group tree.
+		/// @prop parent {int} - Index of the parent group in layers, 0 for top level layers.
+
+		lt := state.NewTable()
+		lt.RawSetString("name", golua.LString(l.Name))
+		lt.RawSetString("type", golua.LNumber(l.Type))
+		lt.RawSetString("blend", golua.LNumber(l.Blend))
+		lt.RawSetString("opacity", golua.LNumber(l.Opacity))
+		lt.RawSetString("visible", golua.LBool(ase.LayerVisible(i)))
+		lt.RawSetString("background", golua.LBool(l.Background))
+		lt.RawSetString("reference", golua.LBool(l.Reference))
+		lt.RawSetString("level", golua.LNumber(l.Level))
+		lt.RawSetString("parent", golua.LNumber(l.Parent+1))
+		layers.RawSetInt(i+1, lt)
+	}
+	t.RawSetString("layers", layers)
+
+	tags := state.NewTable()
+	for i, g := range ase.Tags {
+		/// @struct Tag
+		/// @prop name {string}
+		/// @prop from {int} - Index of the first frame in img.
+		/// @prop to {int} - Index of the last frame in img, inclusive.
+		/// @prop direction {int<aseprite.Direction>}
+		/// @prop repeat {int} - 0 is infinite.
+
+		gt := state.NewTable()
+		gt.RawSetString("name", golua.LString(g.Name))
+		gt.RawSetString("from", golua.LNumber(g.From+1))
+		gt.RawSetString("to", golua.LNumber(g.To+1))
+		gt.RawSetString("direction", golua.LNumber(g.Direction))
+		gt.RawSetString("repeat", golua.LNumber(g.Repeat))
+		tags.RawSetInt(i+1, gt)
+	}
+	t.RawSetString("tags", tags)
+
+	sliceTable := state.NewTable()
+	for i, s := range ase.Slices {
+		/// @struct Slice
+		/// @prop name {string}
+		/// @prop nine_slice {bool}
+		/// @prop has_pivot {bool}
+		/// @prop keys {[]struct<aseprite.SliceKey>}
+
+		st := state.NewTable()
+		st.RawSetString("name", golua.LString(s.Name))
+		st.RawSetString("nine_slice", golua.LBool(s.NineSlice))
+		st.RawSetString("has_pivot", golua.LBool(s.HasPivot))
+
+		keys := state.NewTable()
+		for j, k := range s.Keys {
+			/// @struct SliceKey
+			/// @prop frame {int} - Index of the frame in img, the key applies until the next key.
+			/// @prop x {int}
+			/// @prop y {int}
+			/// @prop width {int}
+			/// @prop height {int}
+			/// @prop center_x {int} - Relative to the slice bounds, only set for 9-slices.
+			/// @prop center_y {int}
+			/// @prop center_width {int}
+			/// @prop center_height {int}
+			/// @prop pivot_x {int} - Relative to the slice bounds, only set when has_pivot is true.
+			/// @prop pivot_y {int}
+
+			kt := state.NewTable()
+			kt.RawSetString("frame", golua.LNumber(k.Frame+1))
+			kt.RawSetString("x", golua.LNumber(k.Bounds.Min.X))
+			kt.RawSetString("y", golua.LNumber(k.Bounds.Min.Y))
+			kt.RawSetString("width", golua.LNumber(k.Bounds.Dx()))
+			kt.RawSetString("height", golua.LNumber(k.Bounds.Dy()))
+			if s.NineSlice {
+				kt.RawSetString("center_x", golua.LNumber(k.Center.Min.X))
+				kt.RawSetString("center_y", golua.LNumber(k.Center.Min.Y))
+				kt.RawSetString("center_width", golua.LNumber(k.Center.Dx()))
+				kt.RawSetString("center_height", golua.LNumber(k.Center.Dy()))
+			}
+			if s.HasPivot {
+				kt.RawSetString("pivot_x", golua.LNumber(k.Pivot.X))
+				kt.RawSetString("pivot_y", golua.LNumber(k.Pivot.Y))
+			}
+			keys.RawSetInt(j+1, kt)
+		}
+		st.RawSetString("keys", keys)
+
+		sliceTable.RawSetInt(i+1, st)
+	}
+	t.RawSetString("slices", sliceTable)
+
+	palette := state.NewTable()
+	for i, c := range ase.Palette {
+		palette.RawSetInt(i+1, imageutil.RGBAToColorTable(state, int(c.R), int(c.G), int(c.B), int(c.A)))
+	}
+	t.RawSetString("palette", palette)
+	t.RawSetString("transparent_index", golua.LNumber(ase.TransparentIndex))
+
+	return t
+}
@@ -124,7 +124,7 @@ func RegisterBase64(r *lua.Runner, lg *log.Logger) {
 			})
 
 			wb := byteseeker.NewByteSeeker(20000, 1000)
-			err := imageutil.Encode(wb, img, encoding)
+			err := imageutil.Encode(wb, img, encoding, nil)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to encode image: %s", log.LEVEL_ERROR, err))
 			}
@@ -166,7 +166,7 @@ func RegisterBase64(r *lua.Runner, lg *log.Logger) {
 					defer f.Close()
 
 					wb := byteseeker.NewByteSeeker(20000, 1000)
-					err = imageutil.Encode(wb, i.Self.Image, i.Self.Encoding)
+					err = imageutil.Encode(wb, i.Self.Image, i.Self.Encoding, nil)
 					if err != nil {
 						lua.Error(state, i.Lg.Appendf("failed to encode image: %s", log.LEVEL_ERROR, err))
 					}
@@ -232,7 +232,12 @@ func RegisterBase64(r *lua.Runner, lg *log.Logger) {
 					}
 
 					bs := byteseeker.NewByteSeekerFromBytes(dd, 1000, true)
-					img, err := imageutil.Decode(bs, encoding)
+					encoding, err := imageutil.ResolveEncoding(bs, encoding)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to decode image: %s", log.LEVEL_ERROR, err))
+					}
+
+					img, err := imageutil.DecodeLimited(bs, encoding, decodeLimits(r))
 					if err != nil {
 						lua.Error(state, i.Lg.Appendf("failed to decode image: %s", log.LEVEL_ERROR, err))
 					}
@@ -300,7 +305,12 @@ func RegisterBase64(r *lua.Runner, lg *log.Logger) {
 					}
 
 					bs := byteseeker.NewByteSeekerFromBytes(dd, 1000, true)
-					img, err := imageutil.Decode(bs, encoding)
+					encoding, err := imageutil.ResolveEncoding(bs, encoding)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to decode image: %s", log.LEVEL_ERROR, err))
+					}
+
+					img, err := imageutil.DecodeLimited(bs, encoding, decodeLimits(r))
 					if err != nil {
 						lua.Error(state, i.Lg.Appendf("failed to decode image: %s", log.LEVEL_ERROR, err))
 					}
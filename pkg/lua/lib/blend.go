@@ -17,6 +17,9 @@ const LIB_BLEND = "blend"
 /// @import blend
 /// @desc
 /// Combines images using different blend modes.
+/// @section
+/// When either image uses image.MODEL_RGBAF32 the blend is done in linear light without rounding,
+/// and the new image uses image.MODEL_RGBAF32.
 
 func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 	lib, tab := lua.NewLib(LIB_BLEND, r, r.State, lg)
@@ -35,7 +38,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Add)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Add, imageutil.BlendAdd)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -50,7 +53,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Add)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Add, imageutil.BlendAdd)
 			return 0
 		})
 
@@ -68,7 +71,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.ColorBurn)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.ColorBurn, imageutil.BlendColorBurn)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -83,7 +86,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.ColorBurn)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.ColorBurn, imageutil.BlendColorBurn)
 			return 0
 		})
 
@@ -101,7 +104,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.ColorDodge)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.ColorDodge, imageutil.BlendColorDodge)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -116,7 +119,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.ColorDodge)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.ColorDodge, imageutil.BlendColorDodge)
 			return 0
 		})
 
@@ -134,7 +137,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Darken)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Darken, imageutil.BlendDarken)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -149,7 +152,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Darken)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Darken, imageutil.BlendDarken)
 			return 0
 		})
 
@@ -167,7 +170,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Difference)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Difference, imageutil.BlendDifference)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -182,7 +185,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Difference)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Difference, imageutil.BlendDifference)
 			return 0
 		})
 
@@ -200,7 +203,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Divide)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Divide, imageutil.BlendDivide)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -215,7 +218,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Divide)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Divide, imageutil.BlendDivide)
 			return 0
 		})
 
@@ -233,7 +236,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Exclusion)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Exclusion, imageutil.BlendExclusion)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -248,7 +251,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Exclusion)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Exclusion, imageutil.BlendExclusion)
 			return 0
 		})
 
@@ -266,7 +269,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Lighten)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Lighten, imageutil.BlendLighten)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -281,7 +284,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Lighten)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Lighten, imageutil.BlendLighten)
 			return 0
 		})
 
@@ -299,7 +302,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.LinearBurn)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.LinearBurn, imageutil.BlendLinearBurn)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -314,7 +317,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.LinearBurn)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.LinearBurn, imageutil.BlendLinearBurn)
 			return 0
 		})
 
@@ -332,7 +335,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.LinearLight)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.LinearLight, imageutil.BlendLinearLight)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -347,7 +350,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.LinearLight)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.LinearLight, imageutil.BlendLinearLight)
 			return 0
 		})
 
@@ -365,7 +368,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Multiply)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Multiply, imageutil.BlendMultiply)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -380,7 +383,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Multiply)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Multiply, imageutil.BlendMultiply)
 			return 0
 		})
 
@@ -398,7 +401,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Normal)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Normal, imageutil.BlendNormal)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -413,7 +416,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Normal)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Normal, imageutil.BlendNormal)
 			return 0
 		})
 
@@ -431,7 +434,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Overlay)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Overlay, imageutil.BlendOverlay)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -446,7 +449,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Overlay)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Overlay, imageutil.BlendOverlay)
 			return 0
 		})
 
@@ -464,7 +467,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Screen)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Screen, imageutil.BlendScreen)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -479,7 +482,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Screen)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Screen, imageutil.BlendScreen)
 			return 0
 		})
 
@@ -497,7 +500,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.SoftLight)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.SoftLight, imageutil.BlendSoftLight)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -512,7 +515,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.SoftLight)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.SoftLight, imageutil.BlendSoftLight)
 			return 0
 		})
 
@@ -530,7 +533,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Subtract)
+			id := blendImages(r, lib, state, lg, args["bg"].(int), args["fg"].(int), args["name"].(string), d.Lib, d.Name, args["encoding"].(int), blend.Subtract, imageutil.BlendSubtract)
 
 			state.Push(golua.LNumber(id))
 			return 1
@@ -545,7 +548,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "fg"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Subtract)
+			blendImagesInplace(r, lib, state, lg, args["bg"].(int), args["fg"].(int), d.Lib, d.Name, blend.Subtract, imageutil.BlendSubtract)
 			return 0
 		})
 
@@ -569,6 +572,7 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 
 			var img image.Image
 			var blended image.Image
+			model := imageutil.MODEL_RGBA
 
 			r.IC.SchedulePipe(state, args["bg"].(int), args["fg"].(int),
 				&collection.Task[collection.ItemImage]{
@@ -582,7 +586,10 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 					Lib:  d.Lib,
 					Name: d.Name,
 					Fn: func(i *collection.Item[collection.ItemImage]) {
-						blended = blend.Opacity(img, i.Self.Image, args["percent"].(float64))
+						percent := args["percent"].(float64)
+						blended, model = blendImagesFn(img, i.Self.Image, func(bg, fg image.Image) *image.RGBA {
+							return blend.Opacity(bg, fg, percent)
+						}, imageutil.BlendOpacity(float32(percent)))
 						blendReady <- struct{}{}
 					},
 					Fail: func(i *collection.Item[collection.ItemImage]) {
@@ -592,12 +599,12 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 
 			name := args["name"].(string)
 			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
-				<-blendReady
+				i.Wait(blendReady)
 				i.Self = &collection.ItemImage{
 					Image:    blended,
 					Encoding: lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib),
 					Name:     name,
-					Model:    imageutil.MODEL_RGBA,
+					Model:    model,
 				}
 			})
 
@@ -630,8 +637,11 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 					Lib:  d.Lib,
 					Name: d.Name,
 					Fn: func(i *collection.Item[collection.ItemImage]) {
-						blended := blend.Opacity(img, i.Self.Image, args["percent"].(float64))
-						if i.Self.Model == imageutil.MODEL_RGBA {
+						percent := args["percent"].(float64)
+						blended, model := blendImagesFn(i.Self.Image, img, func(bg, fg image.Image) *image.RGBA {
+							return blend.Opacity(bg, fg, percent)
+						}, imageutil.BlendOpacity(float32(percent)))
+						if i.Self.Model == model {
 							i.Self.Image = blended
 						} else {
 							i.Self.Image = imageutil.CopyImage(blended, i.Self.Model)
@@ -643,11 +653,12 @@ func RegisterBlend(r *lua.Runner, lg *log.Logger) {
 		})
 }
 
-func blendImages(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *log.Logger, id1, id2 int, name, dl, dn string, encoding int, fn func(image.Image, image.Image) *image.RGBA) int {
+func blendImages(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *log.Logger, id1, id2 int, name, dl, dn string, encoding int, fn func(image.Image, image.Image) *image.RGBA, fnf imageutil.BlendChannelFunc) int {
 	blendReady := make(chan struct{}, 2)
 
 	var img image.Image
 	var blended image.Image
+	model := imageutil.MODEL_RGBA
 
 	r.IC.SchedulePipe(state, id1, id2,
 		&collection.Task[collection.ItemImage]{
@@ -661,7 +672,7 @@ func blendImages(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *log.Logge
 			Lib:  dl,
 			Name: dn,
 			Fn: func(i *collection.Item[collection.ItemImage]) {
-				blended = fn(img, i.Self.Image)
+				blended, model = blendImagesFn(img, i.Self.Image, fn, fnf)
 				blendReady <- struct{}{}
 			},
 			Fail: func(i *collection.Item[collection.ItemImage]) {
@@ -670,19 +681,19 @@ func blendImages(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *log.Logge
 		})
 
 	id := r.IC.ScheduleAdd(state, name, lg, dl, dn, func(i *collection.Item[collection.ItemImage]) {
-		<-blendReady
+		i.Wait(blendReady)
 		i.Self = &collection.ItemImage{
 			Image:    blended,
 			Encoding: lua.ParseEnum(encoding, imageutil.EncodingList, lib),
 			Name:     name,
-			Model:    imageutil.MODEL_RGBA,
+			Model:    model,
 		}
 	})
 
 	return id
 }
 
-func blendImagesInplace(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *log.Logger, id1, id2 int, dl, dn string, fn func(image.Image, image.Image) *image.RGBA) {
+func blendImagesInplace(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *log.Logger, id1, id2 int, dl, dn string, fn func(image.Image, image.Image) *image.RGBA, fnf imageutil.BlendChannelFunc) {
 	var img image.Image
 
 	r.IC.SchedulePipe(state, id2, id1,
@@ -697,8 +708,8 @@ func blendImagesInplace(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *lo
 			Lib:  dl,
 			Name: dn,
 			Fn: func(i *collection.Item[collection.ItemImage]) {
-				blended := fn(i.Self.Image, img)
-				if i.Self.Model == imageutil.MODEL_RGBA {
+				blended, model := blendImagesFn(i.Self.Image, img, fn, fnf)
+				if i.Self.Model == model {
 					i.Self.Image = blended
 				} else {
 					i.Self.Image = imageutil.CopyImage(blended, i.Self.Model)
@@ -706,3 +717,14 @@ func blendImagesInplace(r *lua.Runner, lib *lua.Lib, state *golua.LState, lg *lo
 			},
 		})
 }
+
+// blendImagesFn uses the float blend when either image is float, so the result is not rounded to 8 bits.
+func blendImagesFn(bg, fg image.Image, fn func(image.Image, image.Image) *image.RGBA, fnf imageutil.BlendChannelFunc) (image.Image, imageutil.ColorModel) {
+	_, bgFloat := bg.(*imageutil.RGBAF32)
+	_, fgFloat := fg.(*imageutil.RGBAF32)
+	if bgFloat || fgFloat {
+		return imageutil.BlendF32(bg, fg, fnf), imageutil.MODEL_RGBAF32
+	}
+
+	return fn(bg, fg), imageutil.MODEL_RGBA
+}
@@ -0,0 +1,391 @@
+package lib
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"strings"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua"
+	"github.com/fogleman/gg"
+	golua "github.com/yuin/gopher-lua"
+)
+
+const LIB_BMFONT = "bmfont"
+
+/// @lib Bitmap Font
+/// @import bmfont
+/// @desc
+/// Library for generating AngelCode BMFont bitmap fonts from TrueType fonts.
+/// @section
+/// Glyphs are rendered the same way as context.draw_string, then packed into pages with the atlas packer.
+
+func RegisterBMFont(r *lua.Runner, lg *log.Logger) {
+	lib, tab := lua.NewLib(LIB_BMFONT, r, r.State, lg)
+
+	/// @func generate(path, size, name, encoding, options?) -> struct<bmfont.Font>
+	/// @arg path {string} - Path to a TrueType font, the file name is used as the face name.
+	/// @arg size {int} - The size of the font in points.
+	/// @arg name {string} - Each page is named with the page index appended.
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? options {struct<bmfont.Options>}
+	/// @returns {struct<bmfont.Font>}
+	/// @blocking
+	/// @desc
+	/// Renders each character and packs them into pages, all pages are the same size.
+	lib.CreateFunction(tab, "generate",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.INT, Name: "size"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := bmfontOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			path := args["path"].(string)
+			size := args["size"].(int)
+			if size < 1 {
+				lua.Error(state, lg.Appendf("font size must be positive, got: %d", log.LEVEL_ERROR, size))
+			}
+
+			face, err := gg.LoadFontFace(path, float64(size))
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to load font %s: %s", log.LEVEL_ERROR, path, err))
+			}
+
+			faceName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			bm, pages, err := imageutil.BMFontGenerate(face, faceName, size, opts)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to generate bitmap font: %s", log.LEVEL_ERROR, err))
+			}
+
+			name := args["name"].(string)
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+
+			pageIds := make([]int, len(pages))
+			for ind, page := range pages {
+				pageName := fmt.Sprintf("%s_%d", name, ind)
+				bm.Pages[ind] = pageName + imageutil.EncodingExtension(encoding)
+
+				pageIds[ind] = r.IC.ScheduleAdd(state, pageName, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+					i.Self = &collection.ItemImage{
+						Name:     pageName,
+						Image:    page,
+						Encoding: encoding,
+						Model:    imageutil.MODEL_NRGBA,
+					}
+				})
+			}
+
+			state.Push(bmfontTable(state, bm, pageIds))
+			return 1
+		})
+
+	/// @func text(font) -> string
+	/// @arg font {struct<bmfont.Font>}
+	/// @returns {string}
+	/// @desc
+	/// Exports the font as a BMFont text .fnt file.
+	lib.CreateFunction(tab, "text",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "font"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			bm := bmfontBuild(state, lg, args["font"].(*golua.LTable))
+
+			state.Push(golua.LString(bm.Text()))
+			return 1
+		})
+
+	/// @func xml(font) -> string
+	/// @arg font {struct<bmfont.Font>}
+	/// @returns {string}
+	/// @desc
+	/// Exports the font as a BMFont xml .fnt file.
+	lib.CreateFunction(tab, "xml",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "font"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			bm := bmfontBuild(state, lg, args["font"].(*golua.LTable))
+
+			data, err := bm.XML()
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to export bitmap font: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(data))
+			return 1
+		})
+
+	/// @func json(font) -> string
+	/// @arg font {struct<bmfont.Font>}
+	/// @returns {string}
+	/// @desc
+	/// Exports the font in the json layout used by web and engine loaders, which mirrors the xml format.
+	lib.CreateFunction(tab, "json",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "font"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			bm := bmfontBuild(state, lg, args["font"].(*golua.LTable))
+
+			data, err := bm.JSON()
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to export bitmap font: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(data))
+			return 1
+		})
+
+	/// @constants Charset {string}
+	/// @const CHARSET_ASCII - The printable ascii characters.
+	tab.RawSetString("CHARSET_ASCII", golua.LString(imageutil.BMFontCharsetASCII))
+}
+
+func bmfontOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.BMFontOptions {
+	/// @struct Options
+	/// @prop chars {string} - The characters to include. Defaults to bmfont.CHARSET_ASCII.
+	/// @prop color {struct<image.Color>} - Defaults to white.
+	/// @prop outline {int} - The width of the outline, defaults to 0.
+	/// @prop outline_color {struct<image.Color>} - Defaults to black.
+	/// @prop shadow_x {int} - Offset of the shadow, there is no shadow when both offsets are 0. Defaults to 0.
+	/// @prop shadow_y {int} - Defaults to 0.
+	/// @prop shadow_color {struct<image.Color>} - Defaults to black at half opacity.
+	/// @prop padding {int} - Transparent space around each glyph, defaults to 0.
+	/// @prop spacing {int} - Space between glyphs in the page, defaults to 1.
+	/// @prop algorithm {int<spritesheet.AtlasAlgorithm>} - Defaults to spritesheet.ATLASALGORITHM_MAXRECTS.
+	/// @prop max_width {int} - Defaults to 512.
+	/// @prop max_height {int} - Defaults to 512.
+	/// @prop power_of_two {bool} - Defaults to true.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultBMFontOptions()
+
+	number := func(key string, v golua.LValue) int {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("bmfont option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return int(n)
+	}
+	col := func(key string, v golua.LValue) color.NRGBA {
+		ct, ok := v.(*golua.LTable)
+		if !ok {
+			lua.Error(state, lg.Appendf("bmfont option %s must be a color, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		cr, cg, cb, ca := imageutil.ColorTableToRGBA(ct)
+		return color.NRGBA{R: cr, G: cg, B: cb, A: ca}
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "chars":
+			s, ok := v.(golua.LString)
+			if !ok {
+				lua.Error(state, lg.Appendf("bmfont option %s must be a string, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			opts.Chars = string(s)
+		case "color":
+			opts.Color = col(key, v)
+		case "outline":
+			opts.Outline = number(key, v)
+		case "outline_color":
+			opts.OutlineColor = col(key, v)
+		case "shadow_x":
+			opts.ShadowX = number(key, v)
+		case "shadow_y":
+			opts.ShadowY = number(key, v)
+		case "shadow_color":
+			opts.ShadowColor = col(key, v)
+		case "padding":
+			opts.Padding = number(key, v)
+		case "spacing":
+			opts.Atlas.Padding = number(key, v)
+		case "algorithm":
+			opts.Atlas.Algorithm = imageutil.AtlasAlgorithm(number(key, v))
+		case "max_width":
+			opts.Atlas.MaxWidth = number(key, v)
+		case "max_height":
+			opts.Atlas.MaxHeight = number(key, v)
+		case "power_of_two":
+			b, ok := v.(golua.LBool)
+			if !ok {
+				lua.Error(state, lg.Appendf("bmfont option %s must be a bool, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			opts.Atlas.PowerOfTwo = bool(b)
+		default:
+			lua.Error(state, lg.Appendf("unknown bmfont option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid bmfont options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func bmfontTable(state *golua.LState, bm *imageutil.BMFont, pageIds []int) *golua.LTable {
+	/// @struct Font
+	/// @prop face {string}
+	/// @prop size {int}
+	/// @prop padding {int}
+	/// @prop spacing {int}
+	/// @prop outline {int}
+	/// @prop line_height {int} - The distance between lines.
+	/// @prop base {int} - The distance from the top of the line to the baseline.
+	/// @prop scale_w {int} - The width of every page.
+	/// @prop scale_h {int} - The height of every page.
+	/// @prop pages {[]struct<bmfont.Page>}
+	/// @prop chars {[]struct<bmfont.Char>}
+	/// @prop kernings {[]struct<bmfont.Kerning>}
+
+	/// @struct Page
+	/// @prop img {int<collection.IMAGE>}
+	/// @prop name {string} - The file name used in the descriptor, defaults to the image name with the encoding's extension.
+
+	/// @struct Char
+	/// @prop id {int} - The unicode code point.
+	/// @prop x {int}
+	/// @prop y {int}
+	/// @prop width {int} - Characters without a visible glyph, such as space, have a size of 0.
+	/// @prop height {int}
+	/// @prop xoffset {int} - Offset from the cursor to the left of the glyph.
+	/// @prop yoffset {int} - Offset from the top of the line to the top of the glyph.
+	/// @prop xadvance {int}
+	/// @prop page {int} - Index into pages.
+
+	/// @struct Kerning
+	/// @prop first {int}
+	/// @prop second {int}
+	/// @prop amount {int}
+
+	t := state.NewTable()
+
+	t.RawSetString("face", golua.LString(bm.Face))
+	t.RawSetString("size", golua.LNumber(bm.Size))
+	t.RawSetString("padding", golua.LNumber(bm.Padding))
+	t.RawSetString("spacing", golua.LNumber(bm.Spacing))
+	t.RawSetString("outline", golua.LNumber(bm.Outline))
+	t.RawSetString("line_height", golua.LNumber(bm.LineHeight))
+	t.RawSetString("base", golua.LNumber(bm.Base))
+	t.RawSetString("scale_w", golua.LNumber(bm.ScaleW))
+	t.RawSetString("scale_h", golua.LNumber(bm.ScaleH))
+
+	pages := state.NewTable()
+	for i, p := range bm.Pages {
+		pt := state.NewTable()
+		pt.RawSetString("img", golua.LNumber(pageIds[i]))
+		pt.RawSetString("name", golua.LString(p))
+		pages.RawSetInt(i+1, pt)
+	}
+	t.RawSetString("pages", pages)
+
+	chars := state.NewTable()
+	for i, c := range bm.Chars {
+		ct := state.NewTable()
+		ct.RawSetString("id", golua.LNumber(c.ID))
+		ct.RawSetString("x", golua.LNumber(c.X))
+		ct.RawSetString("y", golua.LNumber(c.Y))
+		ct.RawSetString("width", golua.LNumber(c.Width))
+		ct.RawSetString("height", golua.LNumber(c.Height))
+		ct.RawSetString("xoffset", golua.LNumber(c.XOffset))
+		ct.RawSetString("yoffset", golua.LNumber(c.YOffset))
+		ct.RawSetString("xadvance", golua.LNumber(c.XAdvance))
+		ct.RawSetString("page", golua.LNumber(c.Page+1))
+		chars.RawSetInt(i+1, ct)
+	}
+	t.RawSetString("chars", chars)
+
+	kernings := state.NewTable()
+	for i, k := range bm.Kernings {
+		kt := state.NewTable()
+		kt.RawSetString("first", golua.LNumber(k.First))
+		kt.RawSetString("second", golua.LNumber(k.Second))
+		kt.RawSetString("amount", golua.LNumber(k.Amount))
+		kernings.RawSetInt(i+1, kt)
+	}
+	t.RawSetString("kernings", kernings)
+
+	return t
+}
+
+func bmfontBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.BMFont {
+	number := func(t *golua.LTable, key string) int {
+		n, ok := t.RawGetString(key).(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("bmfont field %s must be a number", log.LEVEL_ERROR, key))
+		}
+		return int(n)
+	}
+	table := func(t *golua.LTable, key string) *golua.LTable {
+		v, ok := t.RawGetString(key).(*golua.LTable)
+		if !ok {
+			lua.Error(state, lg.Appendf("bmfont field %s must be a table", log.LEVEL_ERROR, key))
+		}
+		return v
+	}
+	entry := func(t *golua.LTable, key string, i int) *golua.LTable {
+		v, ok := t.RawGetInt(i + 1).(*golua.LTable)
+		if !ok {
+			lua.Error(state, lg.Appendf("bmfont %s must be tables", log.LEVEL_ERROR, key))
+		}
+		return v
+	}
+
+	bm := &imageutil.BMFont{
+		Face:       t.RawGetString("face").String(),
+		Size:       number(t, "size"),
+		Padding:    number(t, "padding"),
+		Spacing:    number(t, "spacing"),
+		Outline:    number(t, "outline"),
+		LineHeight: number(t, "line_height"),
+		Base:       number(t, "base"),
+		ScaleW:     number(t, "scale_w"),
+		ScaleH:     number(t, "scale_h"),
+	}
+
+	pages := table(t, "pages")
+	for i := range pages.Len() {
+		pt := entry(pages, "pages", i)
+		bm.Pages = append(bm.Pages, pt.RawGetString("name").String())
+	}
+
+	chars := table(t, "chars")
+	for i := range chars.Len() {
+		ct := entry(chars, "chars", i)
+		bm.Chars = append(bm.Chars, imageutil.BMFontChar{
+			ID:       rune(number(ct, "id")),
+			X:        number(ct, "x"),
+			Y:        number(ct, "y"),
+			Width:    number(ct, "width"),
+			Height:   number(ct, "height"),
+			XOffset:  number(ct, "xoffset"),
+			YOffset:  number(ct, "yoffset"),
+			XAdvance: number(ct, "xadvance"),
+			Page:     number(ct, "page") - 1,
+		})
+	}
+
+	kernings := table(t, "kernings")
+	for i := range kernings.Len() {
+		kt := entry(kernings, "kernings", i)
+		bm.Kernings = append(bm.Kernings, imageutil.BMFontKerning{
+			First:  rune(number(kt, "first")),
+			Second: rune(number(kt, "second")),
+			Amount: number(kt, "amount"),
+		})
+	}
+
+	return bm
+}
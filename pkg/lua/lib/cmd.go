@@ -2,7 +2,6 @@ package lib
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/ArtificialLegacy/imgscal/pkg/collection"
 	"github.com/ArtificialLegacy/imgscal/pkg/log"
@@ -19,6 +18,7 @@ const LIB_CMD = "cmd"
 /// Library for parsing command-line arguments.
 /// @section
 /// Cannot be used when the workflow was called from the workflow selection menu.
+/// In batch mode the arguments after -- are parsed, e.g. imgscal run <workflow> -i <glob> -- <args>.
 
 func RegisterCmd(r *lua.Runner, lg *log.Logger) {
 	lib, tab := lua.NewLib(LIB_CMD, r, r.State, lg)
@@ -35,7 +35,7 @@ func RegisterCmd(r *lua.Runner, lg *log.Logger) {
 				return 2
 			}
 
-			err := r.CMDParser.Parse(os.Args[1:])
+			err := r.CMDParser.Parse(r.CLIArgs)
 			if err != nil {
 				state.Push(golua.LFalse)
 				state.Push(golua.LString(err.Error()))
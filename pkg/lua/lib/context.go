@@ -188,7 +188,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					img = i.Self.Image
 					imageReady <- struct{}{}
-					<-imageFinish
+					i.Wait(imageFinish)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					imageReady <- struct{}{}
@@ -206,7 +206,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemContext]) {
-					<-imageReady
+					i.Wait(imageReady)
 
 					i.Self = &collection.ItemContext{
 						Context: gg.NewContextForImage(img),
@@ -237,8 +237,9 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "id"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			imageFinish := make(chan struct{})
-			imageReady := make(chan struct{})
+			// buffered so the image task can signal while holding its worker, before the context task has started.
+			imageFinish := make(chan struct{}, 2)
+			imageReady := make(chan struct{}, 2)
 			var img *image.RGBA
 
 			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
@@ -253,7 +254,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 						img = rgba.(*image.RGBA)
 					}
 					imageReady <- struct{}{}
-					<-imageFinish
+					i.Wait(imageFinish)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					close(imageReady)
@@ -271,7 +272,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemContext]) {
-					<-imageReady
+					i.Wait(imageReady)
 
 					i.Self = &collection.ItemContext{
 						Context: gg.NewContextForRGBA(img),
@@ -315,7 +316,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemContext]) {
 					context = i.Self.Context
 					contextReady <- struct{}{}
-					<-contextFinish
+					i.Wait(contextFinish)
 				},
 				Fail: func(i *collection.Item[collection.ItemContext]) {
 					contextReady <- struct{}{}
@@ -331,7 +332,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-contextReady
+					i.Wait(contextReady)
 
 					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
 
@@ -381,7 +382,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemContext]) {
 					context = i.Self.Context
 					contextReady <- struct{}{}
-					<-contextFinish
+					i.Wait(contextFinish)
 				},
 				Fail: func(i *collection.Item[collection.ItemContext]) {
 					contextReady <- struct{}{}
@@ -397,7 +398,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-contextReady
+					i.Wait(contextReady)
 
 					img := context.AsMask()
 
@@ -450,7 +451,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemContext]) {
-					<-imgReady
+					i.Wait(imgReady)
 					err := i.Self.Context.SetMask(img)
 					if err != nil {
 						state.Error(golua.LString(lg.Append("failed to set image mask, image may be the wrong size.", log.LEVEL_ERROR)), 0)
@@ -1014,7 +1015,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					img = i.Self.Image
 					imgReady <- struct{}{}
-					<-imgFinish
+					i.Wait(imgFinish)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					imgReady <- struct{}{}
@@ -1025,7 +1026,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemContext]) {
-					<-imgReady
+					i.Wait(imgReady)
 					i.Self.Context.DrawImage(img, args["x"].(int), args["y"].(int))
 					imgFinish <- struct{}{}
 				},
@@ -1066,7 +1067,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					img = i.Self.Image
 					imgReady <- struct{}{}
-					<-imgFinish
+					i.Wait(imgFinish)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					imgReady <- struct{}{}
@@ -1077,7 +1078,7 @@ func RegisterContext(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemContext]) {
-					<-imgReady
+					i.Wait(imgReady)
 					i.Self.Context.DrawImageAnchored(img, args["x"].(int), args["y"].(int), args["ax"].(float64), args["ay"].(float64))
 					imgFinish <- struct{}{}
 				},
@@ -1,7 +1,9 @@
 package lib
 
 import (
+	"fmt"
 	"image"
+	"image/draw"
 
 	"github.com/ArtificialLegacy/imgscal/pkg/collection"
 	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
@@ -17,6 +19,12 @@ const LIB_FILTER = "filter"
 /// @import filter
 /// @desc
 /// Library for applying lists of filters onto images.
+/// @section
+/// When the source image of draw uses image.MODEL_RGBAF32 and every filter is brightness, contrast, exposure,
+/// gamma, hue or saturation, the filters run in float and values above 1 are kept.
+/// Any other filter, and draw_at or draw_at_xy, converts float images to 16 bits per channel in srgb first,
+/// so values outside of 0 to 1 are clamped and high dynamic range light is lost.
+/// Use image.tonemap first to keep the bright areas, blend keeps float images without clamping.
 
 func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	lib, tab := lua.NewLib(LIB_FILTER, r, r.State, lg)
@@ -28,6 +36,7 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	/// @arg? disableParallelization {bool}
 	/// @desc
 	/// Applies the filters to image1 with the output going into image2.
+	/// Float images keep values above 1 when every filter supports float, see the section above.
 	lib.CreateFunction(tab, "draw",
 		[]lua.Arg{
 			{Type: lua.INT, Name: "id1"},
@@ -53,6 +62,17 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 					Fn: func(i *collection.Item[collection.ItemImage]) {
 						scheduledState = collection.NewThread(state, args["id2"].(int), collection.TYPE_IMAGE)
 
+						if src, ok := img.(*imageutil.RGBAF32); ok {
+							if ff, ok := buildFloatFilterList(scheduledState, floatFilters, args["filters"].(*golua.LTable)); ok {
+								out := imageutil.FilterF32(src, ff...)
+								pt := i.Self.Image.Bounds().Min
+								imageutil.DrawRect(i.Self.Image, out, image.Rectangle{Min: pt, Max: pt.Add(out.Bounds().Size())})
+
+								scheduledState.Close()
+								return
+							}
+						}
+
 						g := buildFilterList(scheduledState, filters, args["filters"].(*golua.LTable))
 						if args["disableParallelization"].(bool) {
 							g.SetParallelization(false)
@@ -433,6 +453,22 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
+	/// @func exposure(stops) -> struct<filter.FilterExposure>
+	/// @arg stops {float} - Each stop doubles the light, negative stops halve it.
+	/// @returns {struct<filter.FilterExposure>}
+	/// @desc
+	/// Scales the colors in linear light.
+	lib.CreateFunction(tab, "exposure",
+		[]lua.Arg{
+			{Type: lua.FLOAT, Name: "stops"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			t := exposureTable(state, args["stops"].(float64))
+
+			state.Push(t)
+			return 1
+		})
+
 	/// @func flip_horizontal() -> struct<filter.FilterFlipHorizontal>
 	/// @returns {struct<filter.FilterFlipHorizontal>}
 	lib.CreateFunction(tab, "flip_horizontal",
@@ -821,6 +857,142 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
+	/// @func pixel_scale(scaler, factor) -> struct<filter.FilterPixelScale>
+	/// @arg scaler {int<filter.PixelScaler>}
+	/// @arg factor {int}
+	/// @returns {struct<filter.FilterPixelScale>}
+	/// @desc
+	/// Upscales by an integer factor without blurring hard edges, for pixel art.
+	/// Nearest supports any factor of 1 or more, the others only support 2, 3 and 4.
+	/// Alpha is taken into account when comparing and blending pixels.
+	/// The hq2x, hq3x and hq4x lookup table scalers are not available, use corner blend or xBR instead.
+	lib.CreateFunction(tab, "pixel_scale",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "scaler"},
+			{Type: lua.INT, Name: "factor"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			scaler := lua.ParseEnum(args["scaler"].(int), imageutil.PixelScalerList, lib)
+			factor := args["factor"].(int)
+
+			err := imageutil.PixelScaleValid(scaler, factor)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid pixel scale: %s", log.LEVEL_ERROR, err))
+			}
+
+			t := pixelScaleTable(state, int(scaler), factor)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func lut(lut, interpolation, strength) -> struct<filter.FilterLUT>
+	/// @arg lut {struct<filter.LUT>}
+	/// @arg interpolation {int<filter.LUTInterpolation>}
+	/// @arg strength {float} - Mixes between the original colors at 0 and the graded colors at 1.
+	/// @returns {struct<filter.FilterLUT>}
+	/// @desc
+	/// Applies a color grade from a 1D or 3D lookup table, alpha is left unchanged.
+	lib.CreateFunction(tab, "lut",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "lut"},
+			{Type: lua.INT, Name: "interpolation"},
+			{Type: lua.FLOAT, Name: "strength"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			lt := args["lut"].(*golua.LTable)
+			interp := lua.ParseEnum(args["interpolation"].(int), imageutil.LUTInterpolationList, lib)
+
+			_, err := lutBuildTable(lt)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid lut: %s", log.LEVEL_ERROR, err))
+			}
+
+			t := lutFilterTable(state, lt, int(interp), args["strength"].(float64))
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func lut_hald(id) -> struct<filter.LUT>
+	/// @arg id {int<collection.IMAGE>}
+	/// @returns {struct<filter.LUT>}
+	/// @blocking
+	/// @desc
+	/// Reads a 3D lut from a HaldCLUT image, a level L image is L^3 pixels square.
+	lib.CreateFunction(tab, "lut_hald",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			var l *imageutil.LUT
+			var err error
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					l, err = imageutil.LUTHaldDecode(i.Self.Image)
+				},
+			})
+
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to read haldclut: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(lutTable(state, l))
+			return 1
+		})
+
+	/// @func hald_identity(name, encoding, level, model?) -> int<collection.IMAGE>
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg level {int} - Between 2 and 16, the image is level^3 pixels square.
+	/// @arg? model {int<image.ColorModel>}
+	/// @returns {int<collection.IMAGE>}
+	/// @desc
+	/// Creates an identity HaldCLUT, color grading it and loading it with lut_hald gives back the same grade.
+	/// A 16-bit model should be used for levels above 8 to keep the precision.
+	lib.CreateFunction(tab, "hald_identity",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "level"},
+			{Type: lua.INT, Name: "model", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			name := args["name"].(string)
+			level := args["level"].(int)
+
+			img, err := imageutil.LUTHaldIdentity(level)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to create haldclut: %s", log.LEVEL_ERROR, err))
+			}
+
+			chLog := log.NewLogger(fmt.Sprintf("image_%s", name), lg)
+			lg.Append(fmt.Sprintf("child log created: image_%s", name), log.LEVEL_INFO)
+
+			id := r.IC.AddItem(&chLog)
+
+			r.IC.Schedule(state, id, &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+					i.Self = &collection.ItemImage{
+						Image:    imageutil.CopyImage(img, model),
+						Encoding: lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib),
+						Name:     name,
+						Model:    model,
+					}
+				},
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
 	/// @func color_func(fn) -> struct<filter.FilterColorFunc>
 	/// @arg fn {function(r float, g float, b float, a float) -> float, float, float, float}
 	/// @returns struct<filter.FilterColorFunc>
@@ -902,6 +1074,22 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("RESAMPLING_LINEAR", golua.LNumber(RESAMPLING_LINEAR))
 	tab.RawSetString("RESAMPLING_NEARESTNEIGHBOR", golua.LNumber(RESAMPLING_NEARESTNEIGHBOR))
 
+	/// @constants PixelScaler {int}
+	/// @const PIXELSCALER_NEAREST - Repeats each pixel.
+	/// @const PIXELSCALER_EPX - Scale2x and Scale3x, a factor of 4 applies Scale2x twice.
+	/// @const PIXELSCALER_CORNERBLEND - A simplified scaler inspired by hqx, not hq2x, hq3x or hq4x. Blends the corners of each pixel with neighbours that differ in YUV.
+	/// @const PIXELSCALER_XBR - Uses the xBR level 2 edge rules, but blends by how much of each sub pixel the edge covers, so it approximates the reference xBR output rather than matching it.
+	tab.RawSetString("PIXELSCALER_NEAREST", golua.LNumber(imageutil.PIXELSCALER_NEAREST))
+	tab.RawSetString("PIXELSCALER_EPX", golua.LNumber(imageutil.PIXELSCALER_EPX))
+	tab.RawSetString("PIXELSCALER_CORNERBLEND", golua.LNumber(imageutil.PIXELSCALER_CORNERBLEND))
+	tab.RawSetString("PIXELSCALER_XBR", golua.LNumber(imageutil.PIXELSCALER_XBR))
+
+	/// @constants LUTInterpolation {int}
+	/// @const LUTINTERPOLATION_TRILINEAR - Blends the 8 surrounding points of the cube.
+	/// @const LUTINTERPOLATION_TETRAHEDRAL - Blends 4 surrounding points, keeps grays neutral and is closer to most grading software.
+	tab.RawSetString("LUTINTERPOLATION_TRILINEAR", golua.LNumber(imageutil.LUTINTERPOLATION_TRILINEAR))
+	tab.RawSetString("LUTINTERPOLATION_TETRAHEDRAL", golua.LNumber(imageutil.LUTINTERPOLATION_TETRAHEDRAL))
+
 	/// @constants FilterType {string}
 	/// @const FILTER_BRIGHTNESS
 	/// @const FILTER_COLOR_BALANCE
@@ -912,6 +1100,7 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	/// @const FILTER_CONVOLUTION
 	/// @const FILTER_CROP
 	/// @const FILTER_CROP_TO_SIZE
+	/// @const FILTER_EXPOSURE
 	/// @const FILTER_FLIP_HORIZONTAL
 	/// @const FILTER_FLIP_VERTICAL
 	/// @const FILTER_GAMMA
@@ -941,6 +1130,8 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	/// @const FILTER_RESIZE_TO_FIT
 	/// @const FILTER_COLOR_FUNC
 	/// @const FILTER_COLOR_FUNC_UNSAFE
+	/// @const FILTER_PIXEL_SCALE
+	/// @const FILTER_LUT
 	tab.RawSetString("FILTER_BRIGHTNESS", golua.LString(FILTER_BRIGHTNESS))
 	tab.RawSetString("FILTER_COLOR_BALANCE", golua.LString(FILTER_COLOR_BALANCE))
 	tab.RawSetString("FILTER_COLORIZE", golua.LString(FILTER_COLORIZE))
@@ -950,6 +1141,7 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("FILTER_CONVOLUTION", golua.LString(FILTER_CONVOLUTION))
 	tab.RawSetString("FILTER_CROP", golua.LString(FILTER_CROP))
 	tab.RawSetString("FILTER_CROP_TO_SIZE", golua.LString(FILTER_CROP_TO_SIZE))
+	tab.RawSetString("FILTER_EXPOSURE", golua.LString(FILTER_EXPOSURE))
 	tab.RawSetString("FILTER_FLIP_HORIZONTAL", golua.LString(FILTER_FLIP_HORIZONTAL))
 	tab.RawSetString("FILTER_FLIP_VERTICAL", golua.LString(FILTER_FLIP_VERTICAL))
 	tab.RawSetString("FILTER_GAMMA", golua.LString(FILTER_GAMMA))
@@ -979,6 +1171,8 @@ func RegisterFilter(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("FILTER_RESIZE_TO_FIT", golua.LString(FILTER_RESIZE_TO_FIT))
 	tab.RawSetString("FILTER_COLOR_FUNC", golua.LString(FILTER_COLOR_FUNC))
 	tab.RawSetString("FILTER_COLOR_FUNC_UNSAFE", golua.LString(FILTER_COLOR_FUNC_UNSAFE))
+	tab.RawSetString("FILTER_PIXEL_SCALE", golua.LString(FILTER_PIXEL_SCALE))
+	tab.RawSetString("FILTER_LUT", golua.LString(FILTER_LUT))
 }
 
 var samplers = []gift.Resampling{
@@ -1007,6 +1201,7 @@ const (
 	FILTER_CONVOLUTION               = "convolution"
 	FILTER_CROP                      = "crop"
 	FILTER_CROP_TO_SIZE              = "crop_to_size"
+	FILTER_EXPOSURE                  = "exposure"
 	FILTER_FLIP_HORIZONTAL           = "flip_horizontal"
 	FILTER_FLIP_VERTICAL             = "flip_vertical"
 	FILTER_GAMMA                     = "gamma"
@@ -1036,6 +1231,8 @@ const (
 	FILTER_RESIZE_TO_FIT             = "resize_to_fit"
 	FILTER_COLOR_FUNC                = "color_func"
 	FILTER_COLOR_FUNC_UNSAFE         = "color_func_unsafe"
+	FILTER_PIXEL_SCALE               = "pixel_scale"
+	FILTER_LUT                       = "lut"
 )
 
 type filterList map[string]func(state *golua.LState, t *golua.LTable) gift.Filter
@@ -1050,6 +1247,7 @@ var filters = filterList{
 	FILTER_CONVOLUTION:               convolutionBuild,
 	FILTER_CROP:                      cropBuild,
 	FILTER_CROP_TO_SIZE:              cropToSizeBuild,
+	FILTER_EXPOSURE:                  exposureBuild,
 	FILTER_FLIP_HORIZONTAL:           flipHorizontalBuild,
 	FILTER_FLIP_VERTICAL:             flipVerticalBuild,
 	FILTER_GAMMA:                     gammaBuild,
@@ -1079,6 +1277,37 @@ var filters = filterList{
 	FILTER_RESIZE_TO_FIT:             resizeToFitBuild,
 	FILTER_COLOR_FUNC:                colorFuncBuild,
 	FILTER_COLOR_FUNC_UNSAFE:         colorFuncUnsafeBuild,
+	FILTER_PIXEL_SCALE:               pixelScaleBuild,
+	FILTER_LUT:                       lutFilterBuild,
+}
+
+type floatFilterList map[string]func(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func
+
+// floatFilters are the filters that can run on float images without clamping.
+var floatFilters = floatFilterList{
+	FILTER_BRIGHTNESS: brightnessFloatBuild,
+	FILTER_CONTRAST:   contrastFloatBuild,
+	FILTER_EXPOSURE:   exposureFloatBuild,
+	FILTER_GAMMA:      gammaFloatBuild,
+	FILTER_HUE:        hueFloatBuild,
+	FILTER_SATURATION: saturationFloatBuild,
+}
+
+// buildFloatFilterList returns false when any of the filters can't run in float.
+func buildFloatFilterList(state *golua.LState, filterList floatFilterList, t *golua.LTable) ([]imageutil.FilterF32Func, bool) {
+	filters := []imageutil.FilterF32Func{}
+
+	for i := range t.Len() {
+		ft := state.GetTable(t, golua.LNumber(i+1)).(*golua.LTable)
+		f := state.GetTable(ft, golua.LString("type")).(golua.LString)
+		build, ok := filterList[string(f)]
+		if !ok {
+			return nil, false
+		}
+		filters = append(filters, build(state, ft))
+	}
+
+	return filters, true
 }
 
 func buildFilterList(state *golua.LState, filterList filterList, t *golua.LTable) *gift.GIFT {
@@ -1117,6 +1346,12 @@ func brightnessBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	return f
 }
 
+func brightnessFloatBuild(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func {
+	percent := t.RawGetString("percent").(golua.LNumber)
+
+	return imageutil.FilterF32Brightness(float64(percent))
+}
+
 func colorBalanceTable(state *golua.LState, percentRed, percentGreen, percentBlue float64) *golua.LTable {
 	/// @struct FilterColorBalance
 	/// @prop type {string<filter.FilterType>}
@@ -1216,6 +1451,12 @@ func contrastBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	return f
 }
 
+func contrastFloatBuild(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func {
+	percent := t.RawGetString("percent").(golua.LNumber)
+
+	return imageutil.FilterF32Contrast(float64(percent))
+}
+
 func convolutionTable(state *golua.LState, kernel golua.LValue, normalize, alpha, abs bool, delta float64) *golua.LTable {
 	/// @struct FilterConvolution
 	/// @prop type {string<filter.FilterType>}
@@ -1306,6 +1547,38 @@ func cropToSizeBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	return f
 }
 
+func exposureTable(state *golua.LState, stops float64) *golua.LTable {
+	/// @struct FilterExposure
+	/// @prop type {string<filter.FilterType>}
+	/// @prop stops {float}
+
+	t := state.NewTable()
+	t.RawSetString("type", golua.LString(FILTER_EXPOSURE))
+	t.RawSetString("stops", golua.LNumber(stops))
+
+	return t
+}
+
+func exposureBuild(state *golua.LState, t *golua.LTable) gift.Filter {
+	fn := exposureFloatBuild(state, t)
+
+	f := gift.ColorFunc(func(r0, g0, b0, a0 float32) (r, g, b, a float32) {
+		r, g, b = fn(
+			float32(imageutil.SRGBToLinear(float64(r0))),
+			float32(imageutil.SRGBToLinear(float64(g0))),
+			float32(imageutil.SRGBToLinear(float64(b0))),
+		)
+		return float32(imageutil.LinearToSRGB(float64(r))), float32(imageutil.LinearToSRGB(float64(g))), float32(imageutil.LinearToSRGB(float64(b))), a0
+	})
+	return f
+}
+
+func exposureFloatBuild(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func {
+	stops := t.RawGetString("stops").(golua.LNumber)
+
+	return imageutil.FilterF32Exposure(float64(stops))
+}
+
 func flipHorizontalTable(state *golua.LState) *golua.LTable {
 	/// @struct FilterFlipHorizontal
 	/// @prop type {string<filter.FilterType>}
@@ -1355,6 +1628,12 @@ func gammaBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	return f
 }
 
+func gammaFloatBuild(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func {
+	gamma := t.RawGetString("gamma").(golua.LNumber)
+
+	return imageutil.FilterF32Gamma(float64(gamma))
+}
+
 func gaussianBlurTable(state *golua.LState, sigma float64) *golua.LTable {
 	/// @struct FilterGaussianBlur
 	/// @prop type {string<filter.FilterType>}
@@ -1495,6 +1774,12 @@ func hueBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	return f
 }
 
+func hueFloatBuild(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func {
+	shift := t.RawGetString("shift").(golua.LNumber)
+
+	return imageutil.FilterF32Hue(float64(shift))
+}
+
 func saturationTable(state *golua.LState, percent float64) *golua.LTable {
 	/// @struct FilterSaturation
 	/// @prop type {string<filter.FilterType>}
@@ -1514,6 +1799,12 @@ func saturationBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	return f
 }
 
+func saturationFloatBuild(state *golua.LState, t *golua.LTable) imageutil.FilterF32Func {
+	percent := t.RawGetString("percent").(golua.LNumber)
+
+	return imageutil.FilterF32Saturation(float64(percent))
+}
+
 func sepiaTable(state *golua.LState, percent float64) *golua.LTable {
 	/// @struct FilterSepia
 	/// @prop type {string<filter.FilterType>}
@@ -1898,3 +2189,238 @@ func colorFuncUnsafeBuild(state *golua.LState, t *golua.LTable) gift.Filter {
 	})
 	return f
 }
+
+func pixelScaleTable(state *golua.LState, scaler, factor int) *golua.LTable {
+	/// @struct FilterPixelScale
+	/// @prop type {string<filter.FilterType>}
+	/// @prop scaler {int<filter.PixelScaler>}
+	/// @prop factor {int}
+
+	t := state.NewTable()
+	t.RawSetString("type", golua.LString(FILTER_PIXEL_SCALE))
+	t.RawSetString("scaler", golua.LNumber(scaler))
+	t.RawSetString("factor", golua.LNumber(factor))
+
+	return t
+}
+
+func pixelScaleBuild(state *golua.LState, t *golua.LTable) gift.Filter {
+	scaler := t.RawGetString("scaler").(golua.LNumber)
+	factor := t.RawGetString("factor").(golua.LNumber)
+
+	// the table can be changed after filter.pixel_scale, so it is validated again before drawing.
+	err := imageutil.PixelScaleValid(imageutil.PixelScaler(scaler), int(factor))
+	if err != nil {
+		state.Error(golua.LString(fmt.Sprintf("invalid pixel scale: %s", err)), 0)
+	}
+
+	return &pixelScaleFilter{
+		scaler: imageutil.PixelScaler(scaler),
+		factor: int(factor),
+	}
+}
+
+// pixelScaleFilter wraps the pixel art scalers to be used with gift.
+type pixelScaleFilter struct {
+	scaler imageutil.PixelScaler
+	factor int
+}
+
+func (f *pixelScaleFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	if f.factor < 1 {
+		return image.Rectangle{}
+	}
+
+	return image.Rect(0, 0, srcBounds.Dx()*f.factor, srcBounds.Dy()*f.factor)
+}
+
+func (f *pixelScaleFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	// the scale is validated when the filter is built, so this can't fail.
+	out, err := imageutil.PixelScale(src, f.scaler, f.factor)
+	if err != nil {
+		return
+	}
+
+	draw.Draw(dst, dst.Bounds(), out, image.Point{}, draw.Src)
+}
+
+func lutTable(state *golua.LState, l *imageutil.LUT) *golua.LTable {
+	/// @struct LUT
+	/// @prop title {string}
+	/// @prop size {int} - Size of the 3D table, 0 when there is only a 1D table.
+	/// @prop data {[]float} - RGB triplets of the 3D table, with red changing fastest.
+	/// @prop domain_min {[]float} - Input values for each channel mapped to the first point of the 3D table.
+	/// @prop domain_max {[]float} - Input values for each channel mapped to the last point of the 3D table.
+	/// @prop size_1d {int} - Size of the 1D table, 0 when there is only a 3D table.
+	/// @prop data_1d {[]float} - RGB triplets of the 1D table, this is applied before the 3D table.
+	/// @prop domain_1d_min {[]float}
+	/// @prop domain_1d_max {[]float}
+
+	t := state.NewTable()
+	t.RawSetString("title", golua.LString(l.Title))
+	t.RawSetString("size", golua.LNumber(l.Size))
+	t.RawSetString("data", lutFloatTable(state, l.Table))
+	t.RawSetString("domain_min", lutFloatTable(state, l.DomainMin[:]))
+	t.RawSetString("domain_max", lutFloatTable(state, l.DomainMax[:]))
+	t.RawSetString("size_1d", golua.LNumber(l.Size1D))
+	t.RawSetString("data_1d", lutFloatTable(state, l.Table1D))
+	t.RawSetString("domain_1d_min", lutFloatTable(state, l.Domain1DMin[:]))
+	t.RawSetString("domain_1d_max", lutFloatTable(state, l.Domain1DMax[:]))
+
+	return t
+}
+
+func lutFloatTable[T float32 | float64](state *golua.LState, values []T) *golua.LTable {
+	t := state.CreateTable(len(values), 0)
+	for i, v := range values {
+		t.RawSetInt(i+1, golua.LNumber(v))
+	}
+
+	return t
+}
+
+func lutFloats(t *golua.LTable, field string) ([]float64, error) {
+	v, ok := t.RawGetString(field).(*golua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a table", field)
+	}
+
+	values := make([]float64, v.Len())
+	for i := range values {
+		n, ok := v.RawGetInt(i + 1).(golua.LNumber)
+		if !ok {
+			return nil, fmt.Errorf("%s must only contain numbers", field)
+		}
+		values[i] = float64(n)
+	}
+
+	return values, nil
+}
+
+func lutDomain(t *golua.LTable, field string, domain *[3]float64) error {
+	values, err := lutFloats(t, field)
+	if err != nil {
+		return err
+	}
+	if len(values) != 3 {
+		return fmt.Errorf("%s must have 3 values, got: %d", field, len(values))
+	}
+
+	copy(domain[:], values)
+	return nil
+}
+
+func lutBuildTable(t *golua.LTable) (*imageutil.LUT, error) {
+	l := &imageutil.LUT{}
+
+	title, ok := t.RawGetString("title").(golua.LString)
+	if ok {
+		l.Title = string(title)
+	}
+
+	size, ok := t.RawGetString("size").(golua.LNumber)
+	if !ok {
+		return nil, fmt.Errorf("size must be a number")
+	}
+	l.Size = int(size)
+
+	size1D, ok := t.RawGetString("size_1d").(golua.LNumber)
+	if !ok {
+		return nil, fmt.Errorf("size_1d must be a number")
+	}
+	l.Size1D = int(size1D)
+
+	if l.Size != 0 {
+		data, err := lutFloats(t, "data")
+		if err != nil {
+			return nil, err
+		}
+		l.Table = make([]float32, len(data))
+		for i, v := range data {
+			l.Table[i] = float32(v)
+		}
+
+		if err := lutDomain(t, "domain_min", &l.DomainMin); err != nil {
+			return nil, err
+		}
+		if err := lutDomain(t, "domain_max", &l.DomainMax); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.Size1D != 0 {
+		data, err := lutFloats(t, "data_1d")
+		if err != nil {
+			return nil, err
+		}
+		l.Table1D = make([]float32, len(data))
+		for i, v := range data {
+			l.Table1D[i] = float32(v)
+		}
+
+		if err := lutDomain(t, "domain_1d_min", &l.Domain1DMin); err != nil {
+			return nil, err
+		}
+		if err := lutDomain(t, "domain_1d_max", &l.Domain1DMax); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func lutFilterTable(state *golua.LState, lut *golua.LTable, interpolation int, strength float64) *golua.LTable {
+	/// @struct FilterLUT
+	/// @prop type {string<filter.FilterType>}
+	/// @prop lut {struct<filter.LUT>}
+	/// @prop interpolation {int<filter.LUTInterpolation>}
+	/// @prop strength {float}
+
+	t := state.NewTable()
+	t.RawSetString("type", golua.LString(FILTER_LUT))
+	t.RawSetString("lut", lut)
+	t.RawSetString("interpolation", golua.LNumber(interpolation))
+	t.RawSetString("strength", golua.LNumber(strength))
+
+	return t
+}
+
+func lutFilterBuild(state *golua.LState, t *golua.LTable) gift.Filter {
+	interpolation := t.RawGetString("interpolation").(golua.LNumber)
+	strength := t.RawGetString("strength").(golua.LNumber)
+
+	// the lut is validated when the filter is created, so errors here are ignored.
+	l, _ := lutBuildTable(t.RawGetString("lut").(*golua.LTable))
+
+	return &lutFilter{
+		lut:           l,
+		interpolation: imageutil.LUTInterpolation(interpolation),
+		strength:      float64(strength),
+	}
+}
+
+// lutFilter wraps color lookup tables to be used with gift,
+// an invalid lut leaves the image unchanged.
+type lutFilter struct {
+	lut           *imageutil.LUT
+	interpolation imageutil.LUTInterpolation
+	strength      float64
+}
+
+func (f *lutFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func (f *lutFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	if f.lut == nil {
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+		return
+	}
+
+	out := f.lut.Apply(src, f.interpolation, f.strength)
+	draw.Draw(dst, dst.Bounds(), out, image.Point{}, draw.Src)
+}
@@ -1766,7 +1766,7 @@ func datafileBuild(state *golua.LState, t *golua.LTable, r *lua.Runner, lg *log.
 		})
 
 		b := byteseeker.NewByteSeeker(1000, 500)
-		err := imageutil.Encode(b, img, encoding)
+		err := imageutil.Encode(b, img, encoding, nil)
 		if err != nil {
 			state.Error(golua.LString(lg.Append(fmt.Sprintf("failed to encode image: %s", data), log.LEVEL_ERROR)), 0)
 			return nil
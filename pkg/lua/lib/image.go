@@ -472,7 +472,7 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-simgReady
+					i.Wait(simgReady)
 					i.Self = &collection.ItemImage{
 						Image:    simg,
 						Name:     name,
@@ -533,7 +533,7 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-cimgReady
+					i.Wait(cimgReady)
 					i.Self = &collection.ItemImage{
 						Image:    cimg,
 						Name:     name,
@@ -587,7 +587,7 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-cimgReady
+					i.Wait(cimgReady)
 					i.Self.Image = cimg
 					i.Self.Model = model
 				},
@@ -754,6 +754,470 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 			return 0
 		})
 
+	/// @func pixel_float(id, x, y) -> struct<image.ColorFloat>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg x {int}
+	/// @arg y {int}
+	/// @returns {struct<image.ColorFloat>}
+	/// @blocking
+	/// @desc
+	/// Returns the pixel in linear light, without rounding when the image uses image.MODEL_RGBAF32.
+	lib.CreateFunction(tab, "pixel_float",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "x"},
+			{Type: lua.INT, Name: "y"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			var col imageutil.ColorRGBAF32
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					x := args["x"].(int) + i.Self.Image.Bounds().Min.X
+					y := args["y"].(int) + i.Self.Image.Bounds().Min.Y
+
+					col = imageutil.ColorRGBAF32Model.Convert(i.Self.Image.At(x, y)).(imageutil.ColorRGBAF32)
+				},
+			})
+
+			/// @struct ColorFloat
+			/// @prop red {float}
+			/// @prop green {float}
+			/// @prop blue {float}
+			/// @prop alpha {float}
+			/// @desc
+			/// Channels are in linear light without alpha premultiplication,
+			/// the colors can be above 1 for high dynamic range images.
+
+			red, green, blue, alpha := col.NRGBA()
+			t := state.NewTable()
+			t.RawSetString("red", golua.LNumber(red))
+			t.RawSetString("green", golua.LNumber(green))
+			t.RawSetString("blue", golua.LNumber(blue))
+			t.RawSetString("alpha", golua.LNumber(alpha))
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func pixel_float_set(id, x, y, color)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg x {int}
+	/// @arg y {int}
+	/// @arg color {struct<image.ColorFloat>}
+	/// @desc
+	/// Values are only kept outside of 0 to 1 when the image uses image.MODEL_RGBAF32.
+	lib.CreateFunction(tab, "pixel_float_set",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "x"},
+			{Type: lua.INT, Name: "y"},
+			{Type: lua.RAW_TABLE, Name: "color"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			t := args["color"].(*golua.LTable)
+			channel := func(key string) float32 {
+				v, ok := t.RawGetString(key).(golua.LNumber)
+				if !ok {
+					lua.Error(state, lg.Appendf("float color %s must be a number, got: %s", log.LEVEL_ERROR, key, t.RawGetString(key).Type()))
+				}
+				return float32(v)
+			}
+			col := imageutil.NewColorRGBAF32(channel("red"), channel("green"), channel("blue"), channel("alpha"))
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					x := args["x"].(int) + i.Self.Image.Bounds().Min.X
+					y := args["y"].(int) + i.Self.Image.Bounds().Min.Y
+
+					if dimg := imageutil.ImageGetDraw(i.Self.Image); dimg != nil {
+						dimg.Set(x, y, col)
+					}
+				},
+			})
+			return 0
+		})
+
+	/// @func srgb_to_linear(v) -> float
+	/// @arg v {float} - Between 0 and 1.
+	/// @returns {float}
+	lib.CreateFunction(tab, "srgb_to_linear",
+		[]lua.Arg{
+			{Type: lua.FLOAT, Name: "v"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			state.Push(golua.LNumber(imageutil.SRGBToLinear(args["v"].(float64))))
+			return 1
+		})
+
+	/// @func linear_to_srgb(v) -> float
+	/// @arg v {float} - Between 0 and 1.
+	/// @returns {float}
+	lib.CreateFunction(tab, "linear_to_srgb",
+		[]lua.Arg{
+			{Type: lua.FLOAT, Name: "v"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			state.Push(golua.LNumber(imageutil.LinearToSRGB(args["v"].(float64))))
+			return 1
+		})
+
+	/// @func tonemap(id, name, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string} - The name of the new image.
+	/// @arg? options {struct<image.ToneMapOptions>}
+	/// @returns {int<collection.IMAGE>}
+	/// @desc
+	/// Compresses high dynamic range light to between 0 and 1,
+	/// the new image uses image.MODEL_RGBAF32 and the encoding of the source.
+	lib.CreateFunction(tab, "tonemap",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := toneMapOptionsBuild(state, lg, lib, args["options"].(*golua.LTable))
+
+			mapReady := make(chan struct{}, 2)
+			var mapped image.Image
+			var encoding imageutil.ImageEncoding
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					img, err := imageutil.ToneMap(i.Self.Image, opts)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to tone map image: %s", log.LEVEL_ERROR, err))
+					}
+
+					mapped = img
+					encoding = i.Self.Encoding
+					mapReady <- struct{}{}
+				},
+				Fail: func(i *collection.Item[collection.ItemImage]) {
+					mapReady <- struct{}{}
+				},
+			})
+
+			name := args["name"].(string)
+			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+				i.Wait(mapReady)
+				i.Self = &collection.ItemImage{
+					Name:     name,
+					Image:    mapped,
+					Encoding: encoding,
+					Model:    imageutil.MODEL_RGBAF32,
+				}
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func pixel_index(id, x, y) -> int
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg x {int}
+	/// @arg y {int}
+	/// @returns {int}
+	/// @blocking
+	/// @desc
+	/// Returns the palette index of the pixel, the image must use the paletted color model.
+	/// Indexes start at 0, so the color is at index+1 in the list returned by palette.
+	lib.CreateFunction(tab, "pixel_index",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "x"},
+			{Type: lua.INT, Name: "y"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			index := 0
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					img, ok := i.Self.Image.(*image.Paletted)
+					if !ok {
+						state.Error(golua.LString(i.Lg.Append("image.pixel_index requires a paletted image", log.LEVEL_ERROR)), 0)
+					}
+
+					x := args["x"].(int) + img.Bounds().Min.X
+					y := args["y"].(int) + img.Bounds().Min.Y
+
+					index = imageutil.PaletteIndex(img, x, y)
+				},
+			})
+
+			state.Push(golua.LNumber(index))
+			return 1
+		})
+
+	/// @func pixel_index_set(id, x, y, index)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg x {int}
+	/// @arg y {int}
+	/// @arg index {int}
+	/// @desc
+	/// Sets the palette index of the pixel, the image must use the paletted color model.
+	/// Indexes outside of the palette are ignored.
+	lib.CreateFunction(tab, "pixel_index_set",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "x"},
+			{Type: lua.INT, Name: "y"},
+			{Type: lua.INT, Name: "index"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					img, ok := i.Self.Image.(*image.Paletted)
+					if !ok {
+						state.Error(golua.LString(i.Lg.Append("image.pixel_index_set requires a paletted image", log.LEVEL_ERROR)), 0)
+					}
+
+					x := args["x"].(int) + img.Bounds().Min.X
+					y := args["y"].(int) + img.Bounds().Min.Y
+
+					imageutil.PaletteIndexSet(img, x, y, args["index"].(int))
+				},
+			})
+			return 0
+		})
+
+	/// @func palette(id) -> []struct<image.ColorRGBA>
+	/// @arg id {int<collection.IMAGE>}
+	/// @returns {[]struct<image.ColorRGBA>}
+	/// @blocking
+	/// @desc
+	/// Returns the palette of the image, the image must use the paletted color model.
+	/// The first color in the list is index 0.
+	lib.CreateFunction(tab, "palette",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			var pal color.Palette
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					img, ok := i.Self.Image.(*image.Paletted)
+					if !ok {
+						state.Error(golua.LString(i.Lg.Append("image.palette requires a paletted image", log.LEVEL_ERROR)), 0)
+					}
+
+					pal = imageutil.ClonePalette(img.Palette)
+				},
+			})
+
+			t := state.NewTable()
+			for ind, c := range pal {
+				rgba := color.RGBAModel.Convert(c).(color.RGBA)
+				t.RawSetInt(ind+1, imageutil.RGBAColorToColorTable(state, &rgba))
+			}
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func palette_set(id, palette)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg palette {[]struct<image.Color>} - Must contain between 1 and 256 colors.
+	/// @desc
+	/// Replaces the palette of the image, the image must use the paletted color model.
+	/// Pixels keep their index, pixels with an index outside of the new palette are set to 0.
+	lib.CreateFunction(tab, "palette_set",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			lua.ArgArray("palette", lua.ArrayType{Type: lua.RAW_TABLE}, false),
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			colors := args["palette"].([]any)
+			if len(colors) < 1 || len(colors) > 256 {
+				lua.Error(state, lg.Appendf("palette must contain between 1 and 256 colors, got: %d", log.LEVEL_ERROR, len(colors)))
+			}
+
+			pal := make(color.Palette, len(colors))
+			for ind, c := range colors {
+				pal[ind] = *imageutil.ColorTableToRGBAColor(c.(*golua.LTable))
+			}
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					img, ok := i.Self.Image.(*image.Paletted)
+					if !ok {
+						state.Error(golua.LString(i.Lg.Append("image.palette_set requires a paletted image", log.LEVEL_ERROR)), 0)
+					}
+
+					imageutil.PaletteSet(img, pal)
+				},
+			})
+			return 0
+		})
+
+	/// @func metadata(id) -> struct<image.Metadata>?
+	/// @arg id {int<collection.IMAGE>}
+	/// @returns {struct<image.Metadata>?} - Nil if the image has no metadata.
+	/// @blocking
+	lib.CreateFunction(tab, "metadata",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			var meta *imageutil.Metadata
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					if i.Self.Metadata != nil {
+						cp := *i.Self.Metadata
+						meta = &cp
+					}
+				},
+			})
+
+			if meta == nil {
+				state.Push(golua.LNil)
+			} else {
+				state.Push(metadataTable(state, meta))
+			}
+			return 1
+		})
+
+	/// @func metadata_set(id, metadata, replace?)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg metadata {struct<image.Metadata>}
+	/// @arg? replace {bool} - When true the existing metadata is discarded, instead of only overwriting the fields given.
+	/// @desc
+	/// The metadata is written when the image is encoded as a jpeg, png or webp.
+	lib.CreateFunction(tab, "metadata_set",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.RAW_TABLE, Name: "metadata"},
+			{Type: lua.BOOL, Name: "replace", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			replace := args["replace"].(bool)
+
+			apply := metadataBuild(state, lg, args["metadata"].(*golua.LTable))
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					meta := &imageutil.Metadata{}
+					if i.Self.Metadata != nil && !replace {
+						*meta = *i.Self.Metadata
+					}
+
+					apply(meta)
+					i.Self.Metadata = meta
+				},
+			})
+			return 0
+		})
+
+	/// @func metadata_strip(id)
+	/// @arg id {int<collection.IMAGE>}
+	/// @desc
+	/// Removes all metadata from the image, so none is written when encoding.
+	lib.CreateFunction(tab, "metadata_strip",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					i.Self.Metadata = nil
+				},
+			})
+			return 0
+		})
+
+	/// @func metadata_copy(id, src)
+	/// @arg id {int<collection.IMAGE>} - The image to copy the metadata to.
+	/// @arg src {int<collection.IMAGE>} - The image to copy the metadata from.
+	/// @desc
+	/// Replaces the metadata of the image with a copy of the metadata from src.
+	lib.CreateFunction(tab, "metadata_copy",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "src"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			var meta *imageutil.Metadata
+			metaReady := make(chan struct{}, 1)
+
+			r.IC.Schedule(state, args["src"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					if i.Self.Metadata != nil {
+						cp := *i.Self.Metadata
+						if cp.GPS != nil {
+							gps := *cp.GPS
+							cp.GPS = &gps
+						}
+						meta = &cp
+					}
+					metaReady <- struct{}{}
+				},
+				Fail: func(i *collection.Item[collection.ItemImage]) {
+					lg.Append("failed to copy metadata", log.LEVEL_ERROR)
+					metaReady <- struct{}{}
+				},
+			})
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					i.Wait(metaReady)
+					i.Self.Metadata = meta
+				},
+			})
+			return 0
+		})
+
+	/// @func orient(id)
+	/// @arg id {int<collection.IMAGE>}
+	/// @desc
+	/// Applies the orientation stored in the metadata to the image, and resets it to image.ORIENTATION_NORMAL.
+	/// Does nothing if the image has no metadata.
+	lib.CreateFunction(tab, "orient",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					if i.Self.Metadata == nil {
+						return
+					}
+
+					i.Self.Image = imageutil.MetadataOrient(i.Self.Image, i.Self.Metadata.Orientation)
+					i.Self.Metadata.Orientation = imageutil.ORIENTATION_NORMAL
+				},
+			})
+			return 0
+		})
+
 	/// @func point(x?, y?) -> struct<image.Point>
 	/// @arg? x {int}
 	/// @arg? y {int}
@@ -2201,7 +2665,7 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					img = i.Self.Image
 					imgReady <- struct{}{}
-					<-imgFinished
+					i.Wait(imgFinished)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					imgReady <- struct{}{}
@@ -2212,7 +2676,7 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-imgReady
+					i.Wait(imgReady)
 					equal = imageutil.ImageCompare(img, i.Self.Image)
 					imgFinished <- struct{}{}
 				},
@@ -2225,6 +2689,195 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
+	/// @func compare_metrics(id1, id2, options?) -> struct<image.CompareResult>, int<collection.IMAGE>?
+	/// @arg id1 {int<collection.IMAGE>}
+	/// @arg id2 {int<collection.IMAGE>}
+	/// @arg? options {struct<image.CompareOptions>}
+	/// @returns {struct<image.CompareResult>}
+	/// @returns {int<collection.IMAGE>?} - The visual diff, only when enabled in the options.
+	/// @blocking
+	/// @desc
+	/// Compares two images of the same size with perceptual metrics.
+	/// Colors are compared over both a black and white background,
+	/// so fully transparent pixels are equal no matter their color.
+	/// The visual diff is a faded copy of image1, with pixels above the threshold in red
+	/// and smaller differences in yellow.
+	lib.CreateFunction(tab, "compare_metrics",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id1"},
+			{Type: lua.INT, Name: "id2"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct CompareOptions
+			/// @prop? threshold {float} - The CIEDE2000 delta-e a pixel must be above to count as differing, defaults to 0.
+			/// @prop? diff {bool} - Creates a visual diff image, defaults to false.
+			/// @prop? diff_name {string} - Name of the diff image, defaults to "diff".
+
+			threshold := 0.0
+			diff := false
+			diffName := "diff"
+
+			args["options"].(*golua.LTable).ForEach(func(k, v golua.LValue) {
+				key := k.String()
+
+				switch key {
+				case "threshold":
+					n, ok := v.(golua.LNumber)
+					if !ok {
+						lua.Error(state, lg.Appendf("compare option threshold must be a number, got: %s", log.LEVEL_ERROR, v.Type()))
+					}
+					threshold = float64(n)
+				case "diff":
+					diff = golua.LVAsBool(v)
+				case "diff_name":
+					diffName = v.String()
+				default:
+					lua.Error(state, lg.Appendf("unknown compare option: %s", log.LEVEL_ERROR, key))
+				}
+			})
+
+			imgReady := make(chan struct{}, 2)
+			imgFinished := make(chan struct{}, 2)
+
+			var img image.Image
+			var result *imageutil.CompareResult
+			var diffImg *image.NRGBA
+			var encoding imageutil.ImageEncoding
+			var err error
+
+			id1 := args["id1"].(int)
+			id2 := args["id2"].(int)
+
+			if id1 == id2 {
+				<-r.IC.Schedule(state, id1, &collection.Task[collection.ItemImage]{
+					Lib:  d.Lib,
+					Name: d.Name,
+					Fn: func(i *collection.Item[collection.ItemImage]) {
+						result, diffImg, err = imageutil.ImageCompareMetrics(i.Self.Image, i.Self.Image, threshold, diff)
+						encoding = i.Self.Encoding
+					},
+				})
+			} else {
+				r.IC.Schedule(state, id1, &collection.Task[collection.ItemImage]{
+					Lib:  d.Lib,
+					Name: d.Name,
+					Fn: func(i *collection.Item[collection.ItemImage]) {
+						img = i.Self.Image
+						encoding = i.Self.Encoding
+						imgReady <- struct{}{}
+						i.Wait(imgFinished)
+					},
+					Fail: func(i *collection.Item[collection.ItemImage]) {
+						imgReady <- struct{}{}
+					},
+				})
+
+				<-r.IC.Schedule(state, id2, &collection.Task[collection.ItemImage]{
+					Lib:  d.Lib,
+					Name: d.Name,
+					Fn: func(i *collection.Item[collection.ItemImage]) {
+						i.Wait(imgReady)
+						result, diffImg, err = imageutil.ImageCompareMetrics(img, i.Self.Image, threshold, diff)
+						imgFinished <- struct{}{}
+					},
+					Fail: func(i *collection.Item[collection.ItemImage]) {
+						imgFinished <- struct{}{}
+					},
+				})
+			}
+
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to compare images: %s", log.LEVEL_ERROR, err))
+			}
+			if result == nil {
+				lua.Error(state, lg.Append("failed to compare images", log.LEVEL_ERROR))
+			}
+
+			state.Push(compareResultTable(state, result))
+
+			if !diff {
+				state.Push(golua.LNil)
+				return 2
+			}
+
+			chLog := log.NewLogger(fmt.Sprintf("image_%s", diffName), lg)
+			lg.Append(fmt.Sprintf("child log created: image_%s", diffName), log.LEVEL_INFO)
+
+			id := r.IC.AddItem(&chLog)
+
+			r.IC.Schedule(state, id, &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					i.Self = &collection.ItemImage{
+						Image:    diffImg,
+						Encoding: encoding,
+						Name:     diffName,
+						Model:    imageutil.MODEL_NRGBA,
+					}
+				},
+			})
+
+			state.Push(golua.LNumber(id))
+			return 2
+		})
+
+	/// @func hash(id, hash?) -> string
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg? hash {int<image.Hash>} - Defaults to image.HASH_PERCEPTUAL.
+	/// @returns {string} - The 64 bit hash as 16 hex digits.
+	/// @blocking
+	/// @desc
+	/// Perceptual hashes are close for images that look alike, even after resizing or recompressing.
+	/// Use hash_distance to compare them, transparent pixels are treated as white.
+	lib.CreateFunction(tab, "hash",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "hash", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			hash := lua.ParseEnum(args["hash"].(int), imageutil.HashList, lib)
+			var h uint64
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					h = imageutil.ImageHash(i.Self.Image, hash)
+				},
+			})
+
+			state.Push(golua.LString(imageutil.HashString(h)))
+			return 1
+		})
+
+	/// @func hash_distance(hash1, hash2) -> int
+	/// @arg hash1 {string}
+	/// @arg hash2 {string}
+	/// @returns {int} - The number of bits that differ, between 0 and 64.
+	/// @desc
+	/// Both hashes should be created with the same hash type.
+	/// Images with a distance of around 10 or less are usually near-duplicates.
+	lib.CreateFunction(tab, "hash_distance",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "hash1"},
+			{Type: lua.STRING, Name: "hash2"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			h1, err := imageutil.HashParse(args["hash1"].(string))
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to compare hashes: %s", log.LEVEL_ERROR, err))
+			}
+			h2, err := imageutil.HashParse(args["hash2"].(string))
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to compare hashes: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LNumber(imageutil.HashDistance(h1, h2)))
+			return 1
+		})
+
 	/// @func ext_to_encoding(ext) -> int<image.Encoding>
 	/// @arg ext {string}
 	/// @returns {int<image.Encoding>}
@@ -2407,6 +3060,8 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 	/// @const MODEL_GRAY
 	/// @const MODEL_GRAY16
 	/// @const MODEL_CMYK
+	/// @const MODEL_PALETTED
+	/// @const MODEL_RGBAF32 - Linear light float32 channels that are not clamped, for high dynamic range images and to avoid banding.
 	tab.RawSetString("MODEL_RGBA", golua.LNumber(imageutil.MODEL_RGBA))
 	tab.RawSetString("MODEL_RGBA64", golua.LNumber(imageutil.MODEL_RGBA64))
 	tab.RawSetString("MODEL_NRGBA", golua.LNumber(imageutil.MODEL_NRGBA))
@@ -2416,6 +3071,8 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("MODEL_GRAY", golua.LNumber(imageutil.MODEL_GRAY))
 	tab.RawSetString("MODEL_GRAY16", golua.LNumber(imageutil.MODEL_GRAY16))
 	tab.RawSetString("MODEL_CMYK", golua.LNumber(imageutil.MODEL_CMYK))
+	tab.RawSetString("MODEL_PALETTED", golua.LNumber(imageutil.MODEL_PALETTED))
+	tab.RawSetString("MODEL_RGBAF32", golua.LNumber(imageutil.MODEL_RGBAF32))
 
 	/// @constants Encoding {int}
 	/// @const ENCODING_PNG
@@ -2425,6 +3082,18 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 	/// @const ENCODING_BMP
 	/// @const ENCODING_ICO
 	/// @const ENCODING_CUR
+	/// @const ENCODING_WEBP
+	/// @const ENCODING_UNKNOWN
+	/// @const ENCODING_AUTO - Detects the encoding from the image data, only valid when decoding.
+	/// @const ENCODING_QOI
+	/// @const ENCODING_PPM - Decodes all netpbm formats.
+	/// @const ENCODING_PGM - Decodes all netpbm formats.
+	/// @const ENCODING_PAM - Decodes all netpbm formats.
+	/// @const ENCODING_TGA
+	/// @const ENCODING_DDS
+	/// @const ENCODING_HDR - Radiance RGBE, decodes to image.MODEL_RGBAF32.
+	/// @const ENCODING_EXR - OpenEXR with no compression or ZIP compression, decodes to image.MODEL_RGBAF32.
+	/// @const ENCODING_PBM - Decodes all netpbm formats, encodes a black and white bitmap split at half gray.
 	tab.RawSetString("ENCODING_PNG", golua.LNumber(imageutil.ENCODING_PNG))
 	tab.RawSetString("ENCODING_JPEG", golua.LNumber(imageutil.ENCODING_JPEG))
 	tab.RawSetString("ENCODING_GIF", golua.LNumber(imageutil.ENCODING_GIF))
@@ -2432,6 +3101,18 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("ENCODING_BMP", golua.LNumber(imageutil.ENCODING_BMP))
 	tab.RawSetString("ENCODING_ICO", golua.LNumber(imageutil.ENCODING_ICO))
 	tab.RawSetString("ENCODING_CUR", golua.LNumber(imageutil.ENCODING_CUR))
+	tab.RawSetString("ENCODING_WEBP", golua.LNumber(imageutil.ENCODING_WEBP))
+	tab.RawSetString("ENCODING_UNKNOWN", golua.LNumber(imageutil.ENCODING_UNKNOWN))
+	tab.RawSetString("ENCODING_AUTO", golua.LNumber(imageutil.ENCODING_AUTO))
+	tab.RawSetString("ENCODING_QOI", golua.LNumber(imageutil.ENCODING_QOI))
+	tab.RawSetString("ENCODING_PPM", golua.LNumber(imageutil.ENCODING_PPM))
+	tab.RawSetString("ENCODING_PGM", golua.LNumber(imageutil.ENCODING_PGM))
+	tab.RawSetString("ENCODING_PAM", golua.LNumber(imageutil.ENCODING_PAM))
+	tab.RawSetString("ENCODING_TGA", golua.LNumber(imageutil.ENCODING_TGA))
+	tab.RawSetString("ENCODING_DDS", golua.LNumber(imageutil.ENCODING_DDS))
+	tab.RawSetString("ENCODING_HDR", golua.LNumber(imageutil.ENCODING_HDR))
+	tab.RawSetString("ENCODING_EXR", golua.LNumber(imageutil.ENCODING_EXR))
+	tab.RawSetString("ENCODING_PBM", golua.LNumber(imageutil.ENCODING_PBM))
 
 	/// @constants ColorType {string}
 	/// @const COLOR_TYPE_RGBA
@@ -2467,6 +3148,54 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("GIFDISPOSAL_BACKGROUND", golua.LNumber(gif.DisposalBackground))
 	tab.RawSetString("GIFDISPOSAL_PREVIOUS", golua.LNumber(gif.DisposalPrevious))
 
+	/// @constants PNGCompression {int}
+	/// @const PNGCOMPRESSION_DEFAULT
+	/// @const PNGCOMPRESSION_NONE
+	/// @const PNGCOMPRESSION_SPEED
+	/// @const PNGCOMPRESSION_BEST
+	tab.RawSetString("PNGCOMPRESSION_DEFAULT", golua.LNumber(imageutil.PNGCOMPRESSION_DEFAULT))
+	tab.RawSetString("PNGCOMPRESSION_NONE", golua.LNumber(imageutil.PNGCOMPRESSION_NONE))
+	tab.RawSetString("PNGCOMPRESSION_SPEED", golua.LNumber(imageutil.PNGCOMPRESSION_SPEED))
+	tab.RawSetString("PNGCOMPRESSION_BEST", golua.LNumber(imageutil.PNGCOMPRESSION_BEST))
+
+	/// @constants GIFQuantizer {int}
+	/// @const GIFQUANTIZER_PLAN9
+	/// @const GIFQUANTIZER_MEDIANCUT
+	tab.RawSetString("GIFQUANTIZER_PLAN9", golua.LNumber(imageutil.GIFQUANTIZER_PLAN9))
+	tab.RawSetString("GIFQUANTIZER_MEDIANCUT", golua.LNumber(imageutil.GIFQUANTIZER_MEDIANCUT))
+
+	/// @constants TIFFCompression {int}
+	/// @const TIFFCOMPRESSION_NONE
+	/// @const TIFFCOMPRESSION_DEFLATE
+	tab.RawSetString("TIFFCOMPRESSION_NONE", golua.LNumber(imageutil.TIFFCOMPRESSION_NONE))
+	tab.RawSetString("TIFFCOMPRESSION_DEFLATE", golua.LNumber(imageutil.TIFFCOMPRESSION_DEFLATE))
+
+	/// @constants DDSFormat {int}
+	/// @const DDSFORMAT_RGBA - Uncompressed 32-bit color.
+	/// @const DDSFORMAT_BC1 - Also known as DXT1, only keeps 1-bit alpha.
+	/// @const DDSFORMAT_BC3 - Also known as DXT5.
+	tab.RawSetString("DDSFORMAT_RGBA", golua.LNumber(imageutil.DDSFORMAT_RGBA))
+	tab.RawSetString("DDSFORMAT_BC1", golua.LNumber(imageutil.DDSFORMAT_BC1))
+	tab.RawSetString("DDSFORMAT_BC3", golua.LNumber(imageutil.DDSFORMAT_BC3))
+
+	/// @constants Orientation {int}
+	/// @const ORIENTATION_NORMAL
+	/// @const ORIENTATION_FLIP_HORIZONTAL
+	/// @const ORIENTATION_ROTATE_180
+	/// @const ORIENTATION_FLIP_VERTICAL
+	/// @const ORIENTATION_TRANSPOSE
+	/// @const ORIENTATION_ROTATE_90
+	/// @const ORIENTATION_TRANSVERSE
+	/// @const ORIENTATION_ROTATE_270
+	tab.RawSetString("ORIENTATION_NORMAL", golua.LNumber(imageutil.ORIENTATION_NORMAL))
+	tab.RawSetString("ORIENTATION_FLIP_HORIZONTAL", golua.LNumber(imageutil.ORIENTATION_FLIP_HORIZONTAL))
+	tab.RawSetString("ORIENTATION_ROTATE_180", golua.LNumber(imageutil.ORIENTATION_ROTATE_180))
+	tab.RawSetString("ORIENTATION_FLIP_VERTICAL", golua.LNumber(imageutil.ORIENTATION_FLIP_VERTICAL))
+	tab.RawSetString("ORIENTATION_TRANSPOSE", golua.LNumber(imageutil.ORIENTATION_TRANSPOSE))
+	tab.RawSetString("ORIENTATION_ROTATE_90", golua.LNumber(imageutil.ORIENTATION_ROTATE_90))
+	tab.RawSetString("ORIENTATION_TRANSVERSE", golua.LNumber(imageutil.ORIENTATION_TRANSVERSE))
+	tab.RawSetString("ORIENTATION_ROTATE_270", golua.LNumber(imageutil.ORIENTATION_ROTATE_270))
+
 	/// @constants WebPPreset {int}
 	/// @const WEBPPRESET_DEFAULT
 	/// @const WEBPPRESET_PICTURE
@@ -2480,20 +3209,42 @@ func RegisterImage(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("WEBPPRESET_DRAWING", golua.LNumber(encoder.PresetDrawing))
 	tab.RawSetString("WEBPPRESET_ICON", golua.LNumber(encoder.PresetIcon))
 	tab.RawSetString("WEBPPRESET_TEXT", golua.LNumber(encoder.PresetText))
+
+	/// @constants Hash {int}
+	/// @const HASH_PERCEPTUAL - pHash, takes the low frequencies of a DCT, the most robust to edits.
+	/// @const HASH_AVERAGE - aHash, compares each pixel of an 8x8 thumbnail to the mean.
+	/// @const HASH_DIFFERENCE - dHash, compares neighbouring pixels of a 9x8 thumbnail.
+	/// @const HASH_WAVELET - wHash, takes the low frequencies of a haar wavelet transform.
+	tab.RawSetString("HASH_PERCEPTUAL", golua.LNumber(imageutil.HASH_PERCEPTUAL))
+	tab.RawSetString("HASH_AVERAGE", golua.LNumber(imageutil.HASH_AVERAGE))
+	tab.RawSetString("HASH_DIFFERENCE", golua.LNumber(imageutil.HASH_DIFFERENCE))
+	tab.RawSetString("HASH_WAVELET", golua.LNumber(imageutil.HASH_WAVELET))
+
+	/// @constants ToneMapOperator {int}
+	/// @const TONEMAP_REINHARD - Scales each pixel by its luminance, keeping the hue.
+	/// @const TONEMAP_ACES - Filmic curve applied to each channel, with more contrast.
+	tab.RawSetString("TONEMAP_REINHARD", golua.LNumber(imageutil.TONEMAP_REINHARD))
+	tab.RawSetString("TONEMAP_ACES", golua.LNumber(imageutil.TONEMAP_ACES))
 }
 
 func gifTable(r *lua.Runner, lg *log.Logger, state *golua.LState, d *lua.TaskData, gf *gif.GIF, name string, encoding imageutil.ImageEncoding, model imageutil.ColorModel) *golua.LTable {
+	return animationTable(r, lg, state, d, imageutil.AnimationFromGIF(gf), name, encoding, model)
+}
+
+func animationTable(r *lua.Runner, lg *log.Logger, state *golua.LState, d *lua.TaskData, anim *imageutil.Animation, name string, encoding imageutil.ImageEncoding, model imageutil.ColorModel) *golua.LTable {
 	/// @struct GIF
 	/// @prop img {[]int<collection.IMAGE>}
-	/// @prop delay {[]int}
+	/// @prop delay {[]int} - In 100ths of a second.
 	/// @prop disposal {[]int<image.GIFDisposal>}
 	/// @prop loop_count {int}
 	/// @prop background_index {int}
+	/// @desc
+	/// Also used for APNG and animated WebP, in which case background_index is ignored.
 
 	t := state.NewTable()
 
 	img := state.NewTable()
-	for i, v := range gf.Image {
+	for i, v := range anim.Frames {
 		frameName := fmt.Sprintf("%s_%d", name, i)
 		img.RawSetInt(i+1, golua.LNumber(r.IC.ScheduleAdd(state, frameName, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
 			imghere, mhere := imageutil.Limit(v, model)
@@ -2509,19 +3260,19 @@ func gifTable(r *lua.Runner, lg *log.Logger, state *golua.LState, d *lua.TaskDat
 	t.RawSetString("img", img)
 
 	delay := state.NewTable()
-	for i, v := range gf.Delay {
+	for i, v := range anim.Delay {
 		delay.RawSetInt(i+1, golua.LNumber(v))
 	}
 	t.RawSetString("delay", delay)
 
 	disposal := state.NewTable()
-	for i, v := range gf.Disposal {
+	for i, v := range anim.Disposal {
 		disposal.RawSetInt(i+1, golua.LNumber(v))
 	}
 	t.RawSetString("disposal", disposal)
 
-	t.RawSetString("loop_count", golua.LNumber(gf.LoopCount))
-	t.RawSetString("background_index", golua.LNumber(gf.BackgroundIndex))
+	t.RawSetString("loop_count", golua.LNumber(anim.LoopCount))
+	t.RawSetString("background_index", golua.LNumber(anim.BackgroundIndex))
 
 	return t
 }
@@ -2557,6 +3308,12 @@ func gifBuild(r *lua.Runner, d *lua.TaskData, state *golua.LState, t *golua.LTab
 			Lib:  d.Lib,
 			Name: d.Name,
 			Fn: func(i *collection.Item[collection.ItemImage]) {
+				if p, ok := i.Self.Image.(*image.Paletted); ok {
+					img[ind] = p
+					wg.Done()
+					return
+				}
+
 				bounds := i.Self.Image.Bounds()
 				q := quantize.MedianCutQuantizer{}
 				pal := q.Quantize(make([]color.Color, 0, 255), i.Self.Image)
@@ -2583,3 +3340,258 @@ func gifBuild(r *lua.Runner, d *lua.TaskData, state *golua.LState, t *golua.LTab
 
 	return gf
 }
+
+// animationBuild collects the frames without converting them, unlike gifBuild.
+func animationBuild(r *lua.Runner, d *lua.TaskData, state *golua.LState, t *golua.LTable) *imageutil.Animation {
+	loopCount := int(t.RawGetString("loop_count").(golua.LNumber))
+
+	delayTable := t.RawGetString("delay").(*golua.LTable)
+	delay := make([]int, delayTable.Len())
+	for i := range delayTable.Len() {
+		delay[i] = int(delayTable.RawGetInt(i + 1).(golua.LNumber))
+	}
+
+	var disposal []byte
+	if disposalTable, ok := t.RawGetString("disposal").(*golua.LTable); ok && disposalTable.Len() > 0 {
+		disposal = make([]byte, disposalTable.Len())
+		for i := range disposalTable.Len() {
+			disposal[i] = byte(disposalTable.RawGetInt(i + 1).(golua.LNumber))
+		}
+	}
+
+	imgTable := t.RawGetString("img").(*golua.LTable)
+	img := make([]image.Image, imgTable.Len())
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(img))
+
+	for ind := range imgTable.Len() {
+		r.IC.Schedule(state, int(imgTable.RawGetInt(ind+1).(golua.LNumber)), &collection.Task[collection.ItemImage]{
+			Lib:  d.Lib,
+			Name: d.Name,
+			Fn: func(i *collection.Item[collection.ItemImage]) {
+				img[ind] = i.Self.Image
+				wg.Done()
+			},
+			Fail: func(i *collection.Item[collection.ItemImage]) {
+				wg.Done()
+			},
+		})
+	}
+
+	wg.Wait()
+
+	return &imageutil.Animation{
+		Frames:    img,
+		Delay:     delay,
+		Disposal:  disposal,
+		LoopCount: loopCount,
+	}
+}
+
+func metadataTable(state *golua.LState, meta *imageutil.Metadata) *golua.LTable {
+	/// @struct Metadata
+	/// @prop orientation {int<image.Orientation>} - 0 when the image has no orientation.
+	/// @prop description {string}
+	/// @prop make {string} - The camera maker.
+	/// @prop model {string} - The camera model.
+	/// @prop software {string}
+	/// @prop artist {string}
+	/// @prop copyright {string}
+	/// @prop datetime {string} - When the file was last changed, in the format "YYYY:MM:DD HH:MM:SS".
+	/// @prop datetime_original {string} - When the photo was taken, in the format "YYYY:MM:DD HH:MM:SS".
+	/// @prop lens_model {string}
+	/// @prop exposure_time {float} - In seconds.
+	/// @prop f_number {float}
+	/// @prop iso {int}
+	/// @prop focal_length {float} - In millimeters.
+	/// @prop gps {struct<image.MetadataGPS>?} - Nil when there is no location.
+	/// @prop xmp {string} - The raw XMP packet.
+	/// @desc
+	/// Missing text fields are empty strings, and missing number fields are 0.
+
+	t := state.NewTable()
+
+	t.RawSetString("orientation", golua.LNumber(meta.Orientation))
+	t.RawSetString("description", golua.LString(meta.Description))
+	t.RawSetString("make", golua.LString(meta.Make))
+	t.RawSetString("model", golua.LString(meta.Model))
+	t.RawSetString("software", golua.LString(meta.Software))
+	t.RawSetString("artist", golua.LString(meta.Artist))
+	t.RawSetString("copyright", golua.LString(meta.Copyright))
+	t.RawSetString("datetime", golua.LString(meta.DateTime))
+	t.RawSetString("datetime_original", golua.LString(meta.DateTimeOriginal))
+	t.RawSetString("lens_model", golua.LString(meta.LensModel))
+	t.RawSetString("exposure_time", golua.LNumber(meta.ExposureTime))
+	t.RawSetString("f_number", golua.LNumber(meta.FNumber))
+	t.RawSetString("iso", golua.LNumber(meta.ISO))
+	t.RawSetString("focal_length", golua.LNumber(meta.FocalLength))
+	t.RawSetString("xmp", golua.LString(meta.XMP))
+
+	if meta.GPS != nil {
+		/// @struct MetadataGPS
+		/// @prop latitude {float} - Decimal degrees, negative is south.
+		/// @prop longitude {float} - Decimal degrees, negative is west.
+		/// @prop altitude {float} - Meters, negative is below sea level.
+
+		gps := state.NewTable()
+		gps.RawSetString("latitude", golua.LNumber(meta.GPS.Latitude))
+		gps.RawSetString("longitude", golua.LNumber(meta.GPS.Longitude))
+		gps.RawSetString("altitude", golua.LNumber(meta.GPS.Altitude))
+		t.RawSetString("gps", gps)
+	}
+
+	return t
+}
+
+// metadataBuild parses the table on the calling thread,
+// the returned function overwrites the fields that were set in the table.
+func metadataBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) func(meta *imageutil.Metadata) {
+	fields := []func(meta *imageutil.Metadata){}
+
+	number := func(key string, v golua.LValue) float64 {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("metadata field %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return float64(n)
+	}
+	str := func(key string, v golua.LValue) string {
+		s, ok := v.(golua.LString)
+		if !ok {
+			lua.Error(state, lg.Appendf("metadata field %s must be a string, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return string(s)
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "orientation":
+			value := int(number(key, v))
+			if value < 0 || value > imageutil.ORIENTATION_ROTATE_270 {
+				lua.Error(state, lg.Appendf("invalid metadata orientation: %d", log.LEVEL_ERROR, value))
+			}
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Orientation = value })
+		case "description":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Description = value })
+		case "make":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Make = value })
+		case "model":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Model = value })
+		case "software":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Software = value })
+		case "artist":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Artist = value })
+		case "copyright":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.Copyright = value })
+		case "datetime":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.DateTime = value })
+		case "datetime_original":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.DateTimeOriginal = value })
+		case "lens_model":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.LensModel = value })
+		case "exposure_time":
+			value := number(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.ExposureTime = value })
+		case "f_number":
+			value := number(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.FNumber = value })
+		case "iso":
+			value := int(number(key, v))
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.ISO = value })
+		case "focal_length":
+			value := number(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.FocalLength = value })
+		case "xmp":
+			value := str(key, v)
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.XMP = value })
+		case "gps":
+			gt, ok := v.(*golua.LTable)
+			if !ok {
+				lua.Error(state, lg.Appendf("metadata field gps must be a table, got: %s", log.LEVEL_ERROR, v.Type()))
+			}
+			gps := imageutil.MetadataGPS{
+				Latitude:  number("gps.latitude", gt.RawGetString("latitude")),
+				Longitude: number("gps.longitude", gt.RawGetString("longitude")),
+			}
+			if alt := gt.RawGetString("altitude"); alt != golua.LNil {
+				gps.Altitude = number("gps.altitude", alt)
+			}
+			fields = append(fields, func(meta *imageutil.Metadata) { meta.GPS = &gps })
+		default:
+			lua.Error(state, lg.Appendf("unknown metadata field: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	return func(meta *imageutil.Metadata) {
+		for _, field := range fields {
+			field(meta)
+		}
+	}
+}
+
+func compareResultTable(state *golua.LState, result *imageutil.CompareResult) *golua.LTable {
+	/// @struct CompareResult
+	/// @prop psnr {float} - Peak signal to noise ratio in decibels over all four channels, math.huge when the images are equal.
+	/// @prop ssim {float} - Mean structural similarity of the luma, 1 when the images are equal.
+	/// @prop delta_e_mean {float} - Mean CIEDE2000 difference of all pixels.
+	/// @prop delta_e_max {float} - Largest CIEDE2000 difference of any pixel.
+	/// @prop differing {int} - Number of pixels with a difference above the threshold.
+
+	t := state.NewTable()
+	t.RawSetString("psnr", golua.LNumber(result.PSNR))
+	t.RawSetString("ssim", golua.LNumber(result.SSIM))
+	t.RawSetString("delta_e_mean", golua.LNumber(result.DeltaEMean))
+	t.RawSetString("delta_e_max", golua.LNumber(result.DeltaEMax))
+	t.RawSetString("differing", golua.LNumber(result.Differing))
+
+	return t
+}
+
+func toneMapOptionsBuild(state *golua.LState, lg *log.Logger, lib *lua.Lib, t *golua.LTable) imageutil.ToneMapOptions {
+	/// @struct ToneMapOptions
+	/// @prop operator {int<image.ToneMapOperator>} - Defaults to image.TONEMAP_REINHARD.
+	/// @prop exposure {float} - In stops, each stop doubles the brightness before mapping. Defaults to 0.
+	/// @prop white {float} - The luminance mapped to 1 by Reinhard, 0 only maps infinity to 1. Defaults to 0.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultToneMapOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("tone map option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+
+		switch key {
+		case "operator":
+			opts.Operator = lua.ParseEnum(int(n), imageutil.ToneMapOperatorList, lib)
+		case "exposure":
+			opts.Exposure = float64(n)
+		case "white":
+			opts.White = float64(n)
+		default:
+			lua.Error(state, lg.Appendf("unknown tone map option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid tone map options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
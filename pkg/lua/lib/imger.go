@@ -1198,7 +1198,7 @@ func RegisterImger(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					imgOut = i.Self.Image
 					imgReady <- struct{}{}
-					<-imgFinished
+					i.Wait(imgFinished)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					imgReady <- struct{}{}
@@ -1214,7 +1214,7 @@ func RegisterImger(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-imgReady
+					i.Wait(imgReady)
 
 					var imgSave image.Image
 					var model imageutil.ColorModel
@@ -2178,7 +2178,7 @@ func imgerFilterNew(r *lua.Runner, lg *log.Logger, d lua.TaskData, state *golua.
 		Fn: func(i *collection.Item[collection.ItemImage]) {
 			var model imageutil.ColorModel
 
-			<-imgReady
+			i.Wait(imgReady)
 
 			var imgSave image.Image
 
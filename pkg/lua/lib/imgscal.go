@@ -48,6 +48,11 @@ var Builtins = map[string]func(r *lua.Runner, lg *log.Logger){
 	LIB_SHADER:      RegisterShader,
 	LIB_NET:         RegisterNet,
 	LIB_PIPE:        RegisterPipe,
+	LIB_ASEPRITE:    RegisterAseprite,
+	LIB_TEXTURE:     RegisterTexture,
+	LIB_NINESLICE:   RegisterNineSlice,
+	LIB_BMFONT:      RegisterBMFont,
+	LIB_PYRAMID:     RegisterPyramid,
 }
 
 func tableBuilderFunc(state *golua.LState, t *golua.LTable, name string, fn func(state *golua.LState, t *golua.LTable)) {
@@ -63,6 +68,9 @@ func tableBuilderFunc(state *golua.LState, t *golua.LTable, name string, fn func
 
 /// @struct WorkflowInit
 /// @prop is_cli {bool}
+/// @prop is_batch {bool} - If the workflow was called from 'imgscal run'.
+/// @prop batch_input {string} - The file given to this run of the workflow, empty when not in batch mode.
+/// @prop batch_output {string} - The output directory given to the batch run, empty when not in batch mode.
 /// @method debug() - Open the lua debug library to the workflow.
 /// @method verbose() - Enable verbose logging when running the workflow.
 /// @method import([]string<imgscal_Imports>) - Array containing the import names for built-in libraries.
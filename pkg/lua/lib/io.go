@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/gif"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -19,7 +21,6 @@ import (
 	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
 	"github.com/ArtificialLegacy/imgscal/pkg/log"
 	"github.com/ArtificialLegacy/imgscal/pkg/lua"
-	"github.com/crazy3lf/colorconv"
 	"github.com/kolesa-team/go-webp/encoder"
 	"github.com/kolesa-team/go-webp/webp"
 	golua "github.com/yuin/gopher-lua"
@@ -35,16 +36,20 @@ const LIB_IO = "io"
 func RegisterIO(r *lua.Runner, lg *log.Logger) {
 	lib, tab := lua.NewLib(LIB_IO, r, r.State, lg)
 
-	/// @func decode(path, model?) -> int<collection.IMAGE>
+	/// @func decode(path, model?, options?) -> int<collection.IMAGE>
 	/// @arg path {string} - The path to grab the image from.
 	/// @arg? model {int<image.ColorModel>} - Used only to specify default when there is an unsupported color model.
+	/// @arg? options {struct<io.DecodeOptions>}
 	/// @returns {int<collection.IMAGE>}
 	lib.CreateFunction(tab, "decode",
 		[]lua.Arg{
 			{Type: lua.STRING, Name: "path"},
 			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
 			file, err := os.Stat(args["path"].(string))
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("invalid image path provided to io.decode: %s", args["path"]), log.LEVEL_ERROR)), 0)
@@ -69,20 +74,22 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 					}
 					defer f.Close()
 
-					encoding := imageutil.ExtensionEncoding(path.Ext(file.Name()))
-					img, err := imageutil.Decode(f, encoding)
+					encoding := opts.Encoding
+					if encoding == imageutil.ENCODING_UNKNOWN {
+						encoding = imageutil.ExtensionEncoding(path.Ext(file.Name()))
+					}
+					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+					img, encoding, model, meta, err := imageDecode(i.Lg, f, encoding, model, opts)
 					if err != nil {
 						state.Error(golua.LString(i.Lg.Append(fmt.Sprintf("provided file is an invalid image: %s", err), log.LEVEL_ERROR)), 0)
 					}
 
-					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
-					img, model = imageutil.Limit(img, model)
-
 					i.Self = &collection.ItemImage{
 						Name:     name,
 						Image:    img,
 						Encoding: encoding,
 						Model:    model,
+						Metadata: meta,
 					}
 				},
 			})
@@ -91,11 +98,12 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
-	/// @func decode_string(name, encoding, data, model?) -> int<collection.IMAGE>
+	/// @func decode_string(name, encoding, data, model?, options?) -> int<collection.IMAGE>
 	/// @arg name {string}
-	/// @arg encoding {int<image.Encoding>}
+	/// @arg encoding {int<image.Encoding>} - Use image.ENCODING_AUTO to detect the encoding from the data.
 	/// @arg data {string}
 	/// @arg? model {int<image.ColorModel>} - Used only to specify default when there is an unsupported color model.
+	/// @arg? options {struct<io.DecodeOptions>}
 	/// @returns {int<collection.IMAGE>}
 	lib.CreateFunction(tab, "decode_string",
 		[]lua.Arg{
@@ -103,8 +111,10 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 			{Type: lua.STRING, Name: "data"},
 			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
 			name := args["name"].(string)
 
 			chLog := log.NewLogger(fmt.Sprintf("image_%s", name), lg)
@@ -117,20 +127,19 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
 
-					img, err := imageutil.Decode(strings.NewReader(args["data"].(string)), encoding)
+					img, encoding, model, meta, err := imageDecode(i.Lg, strings.NewReader(args["data"].(string)), encoding, model, opts)
 					if err != nil {
 						state.Error(golua.LString(i.Lg.Append(fmt.Sprintf("provided data is an invalid image: %s", err), log.LEVEL_ERROR)), 0)
 					}
 
-					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
-					img, model = imageutil.Limit(img, model)
-
 					i.Self = &collection.ItemImage{
 						Name:     name,
 						Image:    img,
 						Encoding: encoding,
 						Model:    model,
+						Metadata: meta,
 					}
 				},
 			})
@@ -195,17 +204,115 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 3
 		})
 
-	/// @func decode_into(path, id, model?)
+	/// @func detect_encoding(path) -> int<image.Encoding>
+	/// @arg path {string}
+	/// @returns {int<image.Encoding>} - image.ENCODING_UNKNOWN if the file is not a supported image.
+	/// @desc
+	/// Detects the encoding from the start of the file, ignoring the file extension.
+	lib.CreateFunction(tab, "detect_encoding",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			f, err := os.Open(args["path"].(string))
+			if err != nil {
+				lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+			}
+			defer f.Close()
+
+			encoding, err := imageutil.DetectEncodingReader(f)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to read file: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LNumber(encoding))
+			return 1
+		})
+
+	/// @func detect_encoding_string(data) -> int<image.Encoding>
+	/// @arg data {string}
+	/// @returns {int<image.Encoding>} - image.ENCODING_UNKNOWN if the data is not a supported image.
+	lib.CreateFunction(tab, "detect_encoding_string",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "data"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			encoding := imageutil.DetectEncoding([]byte(args["data"].(string)))
+
+			state.Push(golua.LNumber(encoding))
+			return 1
+		})
+
+	/// @func decode_metadata(path) -> struct<image.Metadata>?
+	/// @arg path {string} - The path to grab the image from.
+	/// @returns {struct<image.Metadata>?} - Nil if the image has no metadata.
+	/// @desc
+	/// Reads the EXIF and XMP metadata of an image without decoding it.
+	/// Only jpeg, png, webp and tiff images can contain metadata.
+	lib.CreateFunction(tab, "decode_metadata",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			f, err := os.Open(args["path"].(string))
+			if err != nil {
+				lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+			}
+			defer f.Close()
+
+			encoding := imageutil.ExtensionEncoding(path.Ext(f.Name()))
+			meta, err := imageutil.MetadataDecode(f, encoding)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to read image metadata: %s", log.LEVEL_ERROR, err))
+			}
+
+			if meta == nil {
+				state.Push(golua.LNil)
+			} else {
+				state.Push(metadataTable(state, meta))
+			}
+			return 1
+		})
+
+	/// @func decode_metadata_string(encoding, data) -> struct<image.Metadata>?
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg data {string}
+	/// @returns {struct<image.Metadata>?} - Nil if the image has no metadata.
+	lib.CreateFunction(tab, "decode_metadata_string",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.STRING, Name: "data"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+			meta, err := imageutil.MetadataDecode(strings.NewReader(args["data"].(string)), encoding)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to read image metadata: %s", log.LEVEL_ERROR, err))
+			}
+
+			if meta == nil {
+				state.Push(golua.LNil)
+			} else {
+				state.Push(metadataTable(state, meta))
+			}
+			return 1
+		})
+
+	/// @func decode_into(path, id, model?, options?)
 	/// @arg path {string} - The path to grab the image from.
 	/// @arg id {int<collection.INT>} - Image ID to overwrite with decoded image.
 	/// @arg? model {int<image.ColorModel>} - Used only to specify default when there is an unsupported color model.
+	/// @arg? options {struct<io.DecodeOptions>}
 	lib.CreateFunction(tab, "decode_into",
 		[]lua.Arg{
 			{Type: lua.STRING, Name: "path"},
 			{Type: lua.INT, Name: "id"},
 			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
 			file, err := os.Stat(args["path"].(string))
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("invalid image path provided to io.decode_into: %s", args["path"]), log.LEVEL_ERROR)), 0)
@@ -227,20 +334,22 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 					}
 					defer f.Close()
 
-					encoding := imageutil.ExtensionEncoding(path.Ext(file.Name()))
-					img, err := imageutil.Decode(f, encoding)
+					encoding := opts.Encoding
+					if encoding == imageutil.ENCODING_UNKNOWN {
+						encoding = imageutil.ExtensionEncoding(path.Ext(file.Name()))
+					}
+					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+					img, encoding, model, meta, err := imageDecode(i.Lg, f, encoding, model, opts)
 					if err != nil {
 						state.Error(golua.LString(i.Lg.Append(fmt.Sprintf("provided file is an invalid image: %s", err), log.LEVEL_ERROR)), 0)
 					}
 
-					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
-					img, model = imageutil.Limit(img, model)
-
 					i.Self = &collection.ItemImage{
 						Name:     name,
 						Image:    img,
 						Encoding: encoding,
 						Model:    model,
+						Metadata: meta,
 					}
 				},
 			})
@@ -248,12 +357,13 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 0
 		})
 
-	/// @func decode_into_string(name, encoding, data, id, model?)
+	/// @func decode_into_string(name, encoding, data, id, model?, options?)
 	/// @arg name {string}
 	/// @arg encoding {int<image.Encoding>}
 	/// @arg data {string}
 	/// @arg id {int<collection.INT>} - Image ID to overwrite with decoded image.
 	/// @arg? model {int<image.ColorModel>} - Used only to specify default when there is an unsupported color model.
+	/// @arg? options {struct<io.DecodeOptions>}
 	lib.CreateFunction(tab, "decode_into_string",
 		[]lua.Arg{
 			{Type: lua.STRING, Name: "name"},
@@ -261,8 +371,10 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.STRING, Name: "data"},
 			{Type: lua.INT, Name: "id"},
 			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
 			name := args["name"].(string)
 			id := args["id"].(int)
 
@@ -271,19 +383,19 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
-					img, err := imageutil.Decode(strings.NewReader(args["data"].(string)), encoding)
+					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+					img, encoding, model, meta, err := imageDecode(i.Lg, strings.NewReader(args["data"].(string)), encoding, model, opts)
 					if err != nil {
 						state.Error(golua.LString(i.Lg.Append(fmt.Sprintf("provided data is an invalid image: %s", err), log.LEVEL_ERROR)), 0)
 					}
 
-					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
-					img, model = imageutil.Limit(img, model)
-
 					i.Self = &collection.ItemImage{
 						Name:     name,
 						Image:    img,
 						Encoding: encoding,
 						Model:    model,
+						Metadata: meta,
 					}
 				},
 			})
@@ -317,7 +429,7 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			defer f.Close()
 
 			encoding := imageutil.ExtensionEncoding(path.Ext(file.Name()))
-			img, err := imageutil.Decode(f, encoding)
+			img, err := imageutil.DecodeLimited(f, encoding, decodeLimits(r))
 			if err != nil {
 				lua.Error(state, lg.Appendf("provided file is an invalid image: %s", log.LEVEL_ERROR, err))
 			}
@@ -347,7 +459,7 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
 			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
-			img, err := imageutil.Decode(strings.NewReader(args["data"].(string)), encoding)
+			img, err := imageutil.DecodeLimited(strings.NewReader(args["data"].(string)), encoding, decodeLimits(r))
 			if err != nil {
 				lua.Error(state, lg.Appendf("provided data is an invalid image: %s", log.LEVEL_ERROR, err))
 			}
@@ -387,6 +499,11 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 
 			id := r.IC.AddItem(&chLog)
 
+			err = decodeLimits(r).Check(f, imageutil.ENCODING_PNG)
+			if err != nil {
+				lua.Error(state, lg.Appendf("provided file is an invalid image: %s", log.LEVEL_ERROR, err))
+			}
+
 			img, chunks, err := imageutil.PNGDataChunkDecode(f)
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("provided file is an invalid image: %s", err), log.LEVEL_ERROR)), 0)
@@ -439,7 +556,13 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 
 			id := r.IC.AddItem(&chLog)
 
-			img, chunks, err := imageutil.PNGDataChunkDecode(strings.NewReader(args["data"].(string)))
+			data := strings.NewReader(args["data"].(string))
+			err := decodeLimits(r).Check(data, imageutil.ENCODING_PNG)
+			if err != nil {
+				lua.Error(state, lg.Appendf("provided data is an invalid image: %s", log.LEVEL_ERROR, err))
+			}
+
+			img, chunks, err := imageutil.PNGDataChunkDecode(data)
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("provided data is an invalid image: %s", err), log.LEVEL_ERROR)), 0)
 			}
@@ -499,6 +622,11 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			}
 			defer f.Close()
 
+			err = decodeLimits(r).Check(f, imageutil.ENCODING_ICO)
+			if err != nil {
+				lua.Error(state, lg.Appendf("provided file is an invalid favicon: %s", log.LEVEL_ERROR, err))
+			}
+
 			cfg, imgs, err := goico.Decode(f)
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("provided file is an invalid favicon: %s", err), log.LEVEL_ERROR)), 0)
@@ -558,7 +686,13 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "model", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			cfg, imgs, err := goico.Decode(strings.NewReader(args["data"].(string)))
+			data := strings.NewReader(args["data"].(string))
+			err := decodeLimits(r).Check(data, imageutil.ENCODING_ICO)
+			if err != nil {
+				lua.Error(state, lg.Appendf("provided data is an invalid favicon: %s", log.LEVEL_ERROR, err))
+			}
+
+			cfg, imgs, err := goico.Decode(data)
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("provided data is an invalid favicon: %s", err), log.LEVEL_ERROR)), 0)
 			}
@@ -630,6 +764,11 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			}
 			defer f.Close()
 
+			err = decodeLimits(r).Check(f, imageutil.ENCODING_ICO)
+			if err != nil {
+				lua.Error(state, lg.Appendf("provided file is an invalid favicon: %s", log.LEVEL_ERROR, err))
+			}
+
 			cfg, imgs, err := goico.Decode(f)
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("provided file is an invalid favicon: %s", err), log.LEVEL_ERROR)), 0)
@@ -698,7 +837,13 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "model", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			cfg, imgs, err := goico.Decode(strings.NewReader(args["data"].(string)))
+			data := strings.NewReader(args["data"].(string))
+			err := decodeLimits(r).Check(data, imageutil.ENCODING_ICO)
+			if err != nil {
+				lua.Error(state, lg.Appendf("provided data is an invalid favicon: %s", log.LEVEL_ERROR, err))
+			}
+
+			cfg, imgs, err := goico.Decode(data)
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("provided data is an invalid favicon: %s", err), log.LEVEL_ERROR)), 0)
 			}
@@ -845,11 +990,12 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
-	/// @func decode_gif(path, name, encoding, model?) -> struct<image.GIF>
+	/// @func decode_gif(path, name, encoding, model?, options?) -> struct<image.GIF>
 	/// @arg path {string}
 	/// @arg name {string}
 	/// @arg encoding {int<image.Encoding>}
 	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
 	/// @returns {struct<image.GIF>}
 	lib.CreateFunction(tab, "decode_gif",
 		[]lua.Arg{
@@ -857,8 +1003,11 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.STRING, Name: "name"},
 			{Type: lua.INT, Name: "encoding"},
 			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
 			file, err := os.Stat(args["path"].(string))
 			if err != nil {
 				state.Error(golua.LString(lg.Append(fmt.Sprintf("invalid image path provided to io.decode_gif: %s", args["path"]), log.LEVEL_ERROR)), 0)
@@ -873,7 +1022,7 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			}
 			defer f.Close()
 
-			gf, err := gif.DecodeAll(f)
+			gf, err := imageutil.GIFDecodeAll(f, opts.Limits)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to decode gif: %s", log.LEVEL_ERROR, err))
 			}
@@ -888,11 +1037,12 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
-	/// @func decode_gif_string(data, name, encoding, model?) -> struct<image.GIF>
+	/// @func decode_gif_string(data, name, encoding, model?, options?) -> struct<image.GIF>
 	/// @arg data {string}
 	/// @arg name {string}
 	/// @arg encoding {int<image.Encoding>}
 	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
 	/// @returns {struct<image.GIF>}
 	lib.CreateFunction(tab, "decode_gif_string",
 		[]lua.Arg{
@@ -900,9 +1050,12 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.STRING, Name: "name"},
 			{Type: lua.INT, Name: "encoding"},
 			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			gf, err := gif.DecodeAll(strings.NewReader(args["data"].(string)))
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
+			gf, err := imageutil.GIFDecodeAll(strings.NewReader(args["data"].(string)), opts.Limits)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to decode gif: %s", log.LEVEL_ERROR, err))
 			}
@@ -917,6 +1070,156 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
+	/// @func decode_apng(path, name, encoding, model?, options?) -> struct<image.GIF>
+	/// @arg path {string}
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<image.GIF>}
+	/// @desc
+	/// Each frame is composited onto the full canvas, so all frames have a disposal of image.GIFDISPOSAL_BACKGROUND.
+	/// A png without animation is returned as a single frame.
+	lib.CreateFunction(tab, "decode_apng",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
+			f, err := os.Open(args["path"].(string))
+			if err != nil {
+				lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+			}
+			defer f.Close()
+
+			anim, err := imageutil.APNGDecode(f, opts.Limits)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode apng: %s", log.LEVEL_ERROR, err))
+			}
+
+			name := args["name"].(string)
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+			t := animationTable(r, lg, state, &d, anim, name, encoding, model)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func decode_apng_string(data, name, encoding, model?, options?) -> struct<image.GIF>
+	/// @arg data {string}
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<image.GIF>}
+	lib.CreateFunction(tab, "decode_apng_string",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "data"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
+			anim, err := imageutil.APNGDecode(strings.NewReader(args["data"].(string)), opts.Limits)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode apng: %s", log.LEVEL_ERROR, err))
+			}
+
+			name := args["name"].(string)
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+			t := animationTable(r, lg, state, &d, anim, name, encoding, model)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func decode_webp_anim(path, name, encoding, model?, options?) -> struct<image.GIF>
+	/// @arg path {string}
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<image.GIF>}
+	/// @desc
+	/// Each frame is composited onto the full canvas, so all frames have a disposal of image.GIFDISPOSAL_BACKGROUND.
+	/// A webp without animation is returned as a single frame.
+	lib.CreateFunction(tab, "decode_webp_anim",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
+			f, err := os.Open(args["path"].(string))
+			if err != nil {
+				lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+			}
+			defer f.Close()
+
+			anim, err := imageutil.WebPAnimDecode(f, opts.Limits)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode webp: %s", log.LEVEL_ERROR, err))
+			}
+
+			name := args["name"].(string)
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+			t := animationTable(r, lg, state, &d, anim, name, encoding, model)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func decode_webp_anim_string(data, name, encoding, model?, options?) -> struct<image.GIF>
+	/// @arg data {string}
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? model {int<image.Model>}
+	/// @arg? options {struct<io.DecodeOptions>} - Only the decode limits are used.
+	/// @returns {struct<image.GIF>}
+	lib.CreateFunction(tab, "decode_webp_anim_string",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "data"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := decodeOptionsBuild(r, state, lg, args["options"].(*golua.LTable))
+
+			anim, err := imageutil.WebPAnimDecode(strings.NewReader(args["data"].(string)), opts.Limits)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode webp: %s", log.LEVEL_ERROR, err))
+			}
+
+			name := args["name"].(string)
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+			t := animationTable(r, lg, state, &d, anim, name, encoding, model)
+
+			state.Push(t)
+			return 1
+		})
+
 	/// @func load_embedded(embedded, model?) -> int<collection.IMAGE>
 	/// @arg embedded {int<io.Embedded>}
 	/// @arg? model {int<image.ColorModel>} - Used only to specify default of unsupported color models.
@@ -987,15 +1290,19 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
-	/// @func encode(id, path)
+	/// @func encode(id, path, options?)
 	/// @arg id {int<collection.IMAGE>} - The image id to encode and save to file.
 	/// @arg path {string} - The directory path to save the file to.
+	/// @arg? options {struct<io.EncodeOptions>} - Options for the encoding used by the image.
 	lib.CreateFunction(tab, "encode",
 		[]lua.Arg{
 			{Type: lua.INT, Name: "id"},
 			{Type: lua.STRING, Name: "path"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := encodeOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
 			_, err := os.Stat(args["path"].(string))
 			if err != nil {
 				os.MkdirAll(args["path"].(string), 0o777)
@@ -1013,7 +1320,9 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 					defer f.Close()
 
 					i.Lg.Append(fmt.Sprintf("encoding using %d", i.Self.Encoding), log.LEVEL_INFO)
-					err = imageutil.Encode(f, i.Self.Image, i.Self.Encoding)
+					itemOpts := *opts
+					itemOpts.Metadata = i.Self.Metadata
+					err = imageutil.Encode(f, i.Self.Image, i.Self.Encoding, &itemOpts)
 					if err != nil {
 						state.Error(golua.LString(i.Lg.Append(fmt.Sprintf("cannot write image to file: %s", err), log.LEVEL_ERROR)), 0)
 					}
@@ -1022,15 +1331,18 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 0
 		})
 
-	/// @func encode_string(id) -> string
+	/// @func encode_string(id, options?) -> string
 	/// @arg id {int<collection.IMAGE>} - The image id to encode and save to file.
+	/// @arg? options {struct<io.EncodeOptions>} - Options for the encoding used by the image.
 	/// @returns {string}
 	/// @blocking
 	lib.CreateFunction(tab, "encode_string",
 		[]lua.Arg{
 			{Type: lua.INT, Name: "id"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := encodeOptionsBuild(state, lg, args["options"].(*golua.LTable))
 			var data string
 
 			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
@@ -1040,7 +1352,9 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 					strwriter := byteseeker.NewByteSeeker(20000, 1000)
 
 					i.Lg.Append(fmt.Sprintf("encoding using %d", i.Self.Encoding), log.LEVEL_INFO)
-					err := imageutil.Encode(strwriter, i.Self.Image, i.Self.Encoding)
+					itemOpts := *opts
+					itemOpts.Metadata = i.Self.Metadata
+					err := imageutil.Encode(strwriter, i.Self.Image, i.Self.Encoding, &itemOpts)
 					if err != nil {
 						state.Error(golua.LString(i.Lg.Append(fmt.Sprintf("cannot write image to string: %s", err), log.LEVEL_ERROR)), 0)
 					}
@@ -1411,6 +1725,134 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
+	/// @func encode_apng(name, anim, path, options?)
+	/// @arg name {string} - Excluding the extension.
+	/// @arg anim {struct<image.GIF>}
+	/// @arg path {string} - The directory path to save the file to.
+	/// @arg? options {struct<io.EncodeOptions>} - Only png_compression is used, frames are always written as 8-bit RGBA.
+	/// @blocking
+	lib.CreateFunction(tab, "encode_apng",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "anim"},
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := encodeOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			_, err := os.Stat(args["path"].(string))
+			if err != nil {
+				os.MkdirAll(args["path"].(string), 0o777)
+			}
+
+			name := args["name"].(string)
+
+			f, err := os.OpenFile(path.Join(args["path"].(string), name+".png"), os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o666)
+			if err != nil {
+				lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+			}
+			defer f.Close()
+
+			anim := animationBuild(r, &d, state, args["anim"].(*golua.LTable))
+
+			err = imageutil.APNGEncode(f, anim, opts)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to encode apng: %s", log.LEVEL_ERROR, err))
+			}
+
+			return 0
+		})
+
+	/// @func encode_apng_string(anim, options?) -> string
+	/// @arg anim {struct<image.GIF>}
+	/// @arg? options {struct<io.EncodeOptions>} - Only png_compression is used, frames are always written as 8-bit RGBA.
+	/// @returns {string}
+	/// @blocking
+	lib.CreateFunction(tab, "encode_apng_string",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "anim"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := encodeOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			strwriter := byteseeker.NewByteSeeker(20000, 1000)
+			anim := animationBuild(r, &d, state, args["anim"].(*golua.LTable))
+
+			err := imageutil.APNGEncode(strwriter, anim, opts)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to encode apng: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(strwriter.Bytes()))
+			return 1
+		})
+
+	/// @func encode_webp_anim(name, anim, path, options?)
+	/// @arg name {string} - Excluding the extension.
+	/// @arg anim {struct<image.GIF>}
+	/// @arg path {string} - The directory path to save the file to.
+	/// @arg? options {struct<io.EncodeOptions>} - Only the webp options are used. WebP cannot restore previous frames, so image.GIFDISPOSAL_PREVIOUS is written as background.
+	/// @blocking
+	lib.CreateFunction(tab, "encode_webp_anim",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "anim"},
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := encodeOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			_, err := os.Stat(args["path"].(string))
+			if err != nil {
+				os.MkdirAll(args["path"].(string), 0o777)
+			}
+
+			name := args["name"].(string)
+
+			f, err := os.OpenFile(path.Join(args["path"].(string), name+".webp"), os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o666)
+			if err != nil {
+				lua.Error(state, lg.Append("cannot open provided file", log.LEVEL_ERROR))
+			}
+			defer f.Close()
+
+			anim := animationBuild(r, &d, state, args["anim"].(*golua.LTable))
+
+			err = imageutil.WebPAnimEncode(f, anim, opts)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to encode webp: %s", log.LEVEL_ERROR, err))
+			}
+
+			return 0
+		})
+
+	/// @func encode_webp_anim_string(anim, options?) -> string
+	/// @arg anim {struct<image.GIF>}
+	/// @arg? options {struct<io.EncodeOptions>} - Only the webp options are used. WebP cannot restore previous frames, so image.GIFDISPOSAL_PREVIOUS is written as background.
+	/// @returns {string}
+	/// @blocking
+	lib.CreateFunction(tab, "encode_webp_anim_string",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "anim"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := encodeOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			strwriter := byteseeker.NewByteSeeker(20000, 1000)
+			anim := animationBuild(r, &d, state, args["anim"].(*golua.LTable))
+
+			err := imageutil.WebPAnimEncode(strwriter, anim, opts)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to encode webp: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(strwriter.Bytes()))
+			return 1
+		})
+
 	/// @func encode_webp(id, path, preset, lossy, level)
 	/// @arg id {int<collection.IMAGE>} - The image id to encode and save to file.
 	/// @arg path {string} - The directory path to save the file to.
@@ -1510,11 +1952,14 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
-	/// @func load_palette(path) -> []struct<image.Color>
-	/// @arg path {string} - Path to a .hex file for the palette.
-	/// @returns {[]struct<image.Color>}
+	/// @func load_palette(path) -> []struct<image.ColorRGBA>, struct<io.PaletteInfo>
+	/// @arg path {string} - Path to a .hex, .gpl, JASC .pal, .aco, .ase or .png palette file.
+	/// @returns {[]struct<image.ColorRGBA>}
+	/// @returns {struct<io.PaletteInfo>}
 	/// @desc
-	/// Use to load a hex color palette file; For example, from lospec.
+	/// Use to load a color palette file; For example, from lospec.
+	/// The format is detected from the content of the file.
+	/// For .png files the first row is read, with repeated neighbouring pixels read as one color.
 	lib.CreateFunction(tab, "load_palette",
 		[]lua.Arg{
 			{Type: lua.STRING, Name: "path"},
@@ -1523,55 +1968,120 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			pth := args["path"].(string)
 			b, err := os.ReadFile(pth)
 			if err != nil {
-				lua.Error(state, lg.Appendf("failed to read hex file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
+				lua.Error(state, lg.Appendf("failed to read palette file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
 			}
 
-			hexValues := strings.Split(string(b), "\n")
-			colors := state.NewTable()
+			p, format, err := imageutil.PaletteDecode(b, imageutil.PALETTEFORMAT_UNKNOWN)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to parse palette file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
+			}
 
-			for i, v := range hexValues {
-				r, g, b, err := colorconv.HexToRGB(v)
-				if err != nil {
-					lua.Error(state, lg.Appendf("failed to parse hex color: %s with error (%s)", log.LEVEL_ERROR, v, err))
-				}
+			/// @struct PaletteInfo
+			/// @prop format {int<io.PaletteFormat>}
+			/// @prop name {string} - Only stored by .gpl files, otherwise empty.
+			/// @prop columns {int} - Only stored by .gpl files, otherwise 0.
+			/// @prop names {[]string} - The name of each color, empty when the format doesn't store names.
 
-				colors.RawSetInt(i+1, imageutil.RGBAToColorTable(state, int(r), int(g), int(b), 255))
+			colors := state.NewTable()
+			names := state.NewTable()
+			for i, c := range p.Colors {
+				colors.RawSetInt(i+1, imageutil.RGBAToColorTable(state, int(c.Color.R), int(c.Color.G), int(c.Color.B), int(c.Color.A)))
+				names.RawSetInt(i+1, golua.LString(c.Name))
 			}
 
+			info := state.NewTable()
+			info.RawSetString("format", golua.LNumber(format))
+			info.RawSetString("name", golua.LString(p.Name))
+			info.RawSetString("columns", golua.LNumber(p.Columns))
+			info.RawSetString("names", names)
+
 			state.Push(colors)
-			return 1
+			state.Push(info)
+			return 2
 		})
 
-	/// @func save_palette(path, colors)
-	/// @arg path {string} - File to save hex data to, filename should end in .hex.
+	/// @func save_palette(path, colors, options?)
+	/// @arg path {string}
 	/// @arg colors {[]struct<image.Color>}
+	/// @arg? options {struct<io.PaletteOptions>}
 	/// @desc
-	/// Discards alpha channels.
+	/// The format is taken from the file extension unless set in the options, unknown extensions are saved as .hex.
+	/// Alpha is only kept by .gpl and .png files.
 	lib.CreateFunction(tab, "save_palette",
 		[]lua.Arg{
 			{Type: lua.STRING, Name: "path"},
 			lua.ArgArray("colors", lua.ArrayType{Type: lua.RAW_TABLE}, false),
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
 			pth := args["path"].(string)
 			colors := args["colors"].([]any)
 
+			p := &imageutil.PaletteFile{Colors: make([]imageutil.PaletteColor, len(colors))}
+			for i, v := range colors {
+				r, g, b, a := imageutil.ColorTableToRGBA(v.(*golua.LTable))
+				p.Colors[i].Color = color.NRGBA{r, g, b, a}
+			}
+
+			format := imageutil.ExtensionPaletteFormat(path.Ext(pth))
+			if format == imageutil.PALETTEFORMAT_UNKNOWN {
+				format = imageutil.PALETTEFORMAT_HEX
+			}
+			format = paletteOptionsBuild(state, lg, args["options"].(*golua.LTable), p, format)
+
 			fs, err := os.OpenFile(pth, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o666)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to open file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
 			}
 			defer fs.Close()
 
-			for _, v := range colors {
-				col := v.(*golua.LTable)
-				r, g, b, _ := imageutil.ColorTableToRGBA(col)
-
-				fmt.Fprintf(fs, "%02x%02x%02x\n", r, g, b)
+			err = imageutil.PaletteEncode(fs, p, format)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to write palette file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
 			}
 
 			return 0
 		})
 
+	/// @func load_lut(path) -> struct<filter.LUT>
+	/// @arg path {string}
+	/// @returns {struct<filter.LUT>}
+	/// @desc
+	/// Loads an Adobe or Resolve .cube file, or a HaldCLUT image.
+	/// Images are detected from their contents, everything else is parsed as a .cube file.
+	lib.CreateFunction(tab, "load_lut",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			pth := args["path"].(string)
+			b, err := os.ReadFile(pth)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to read lut file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
+			}
+
+			var l *imageutil.LUT
+
+			if encoding := imageutil.DetectEncoding(b); encoding != imageutil.ENCODING_UNKNOWN {
+				img, err := imageutil.DecodeLimited(bytes.NewReader(b), encoding, decodeLimits(r))
+				if err != nil {
+					lua.Error(state, lg.Appendf("failed to decode haldclut: %s with error (%s)", log.LEVEL_ERROR, pth, err))
+				}
+				l, err = imageutil.LUTHaldDecode(img)
+				if err != nil {
+					lua.Error(state, lg.Appendf("failed to read haldclut: %s with error (%s)", log.LEVEL_ERROR, pth, err))
+				}
+			} else {
+				l, err = imageutil.LUTCubeDecode(bytes.NewReader(b))
+				if err != nil {
+					lua.Error(state, lg.Appendf("failed to parse lut file: %s with error (%s)", log.LEVEL_ERROR, pth, err))
+				}
+			}
+
+			state.Push(lutTable(state, l))
+			return 1
+		})
+
 	/// @func remove(path, all?)
 	/// @arg path {string}
 	/// @arg? all {bool} - If to remove all directories going to the given path.
@@ -1666,6 +2176,118 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 			return 1
 		})
 
+	/// @func dir_img_duplicates(path, options?) -> [][]string
+	/// @arg path {string} - The directory path to scan for images.
+	/// @arg? options {struct<io.DuplicateOptions>}
+	/// @returns {[][]string} - Groups of paths to images that look alike, images without a near-duplicate are left out.
+	/// @desc
+	/// Hashes each image found by dir_img and groups them by hash distance.
+	/// Groups are linked, so two images further apart than the threshold can share a group through a third.
+	/// Images that fail to decode or exceed the decode limits are skipped with a warning.
+	/// Up to max_workers images are decoded at once.
+	lib.CreateFunction(tab, "dir_img_duplicates",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct DuplicateOptions
+			/// @prop? hash {int<image.Hash>} - Defaults to image.HASH_PERCEPTUAL.
+			/// @prop? threshold {int} - The largest hash distance between near-duplicates, defaults to 8. 0 only groups identical hashes, negative values are an error.
+
+			hash := imageutil.HASH_PERCEPTUAL
+			threshold := 8
+
+			args["options"].(*golua.LTable).ForEach(func(k, v golua.LValue) {
+				key := k.String()
+
+				n, ok := v.(golua.LNumber)
+				if !ok {
+					lua.Error(state, lg.Appendf("duplicate option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+				}
+
+				switch key {
+				case "hash":
+					hash = lua.ParseEnum(int(n), imageutil.HashList, lib)
+				case "threshold":
+					threshold = int(n)
+					if threshold < 0 {
+						lua.Error(state, lg.Appendf("duplicate threshold cannot be negative, got: %d", log.LEVEL_ERROR, threshold))
+					}
+				default:
+					lua.Error(state, lg.Appendf("unknown duplicate option: %s", log.LEVEL_ERROR, key))
+				}
+			})
+
+			files := parseDir("io.dir_img_duplicates", args["path"].(string), imageutil.EncodingExts, state, lg)
+
+			paths := make([]string, files.Len())
+			hashes := make([]uint64, files.Len())
+			valid := make([]bool, files.Len())
+			for i := range paths {
+				paths[i] = files.RawGetInt(i + 1).String()
+			}
+
+			limits := decodeLimits(r)
+			wg := sync.WaitGroup{}
+			wg.Add(len(paths))
+			// decoding runs outside of the collections, so the pool is sized from the scheduler to respect max_workers.
+			workers := make(chan struct{}, r.Scheduler.Limit())
+
+			for ind, pth := range paths {
+				workers <- struct{}{}
+				go func() {
+					defer func() {
+						// a decoder panic only skips the image, as these goroutines are outside of the collection's recovery.
+						if p := recover(); p != nil {
+							lg.Appendf("skipping image that panicked while decoding: %s (%v)", log.LEVEL_WARN, pth, p)
+						}
+						<-workers
+						wg.Done()
+					}()
+
+					f, err := os.Open(pth)
+					if err != nil {
+						lg.Appendf("skipping image that failed to open: %s (%s)", log.LEVEL_WARN, pth, err)
+						return
+					}
+					defer f.Close()
+
+					img, err := imageutil.DecodeLimited(f, imageutil.ENCODING_AUTO, limits)
+					if err != nil {
+						lg.Appendf("skipping image that failed to decode: %s (%s)", log.LEVEL_WARN, pth, err)
+						return
+					}
+
+					hashes[ind] = imageutil.ImageHash(img, hash)
+					valid[ind] = true
+				}()
+			}
+
+			wg.Wait()
+
+			validPaths := []string{}
+			validHashes := []uint64{}
+			for i, ok := range valid {
+				if ok {
+					validPaths = append(validPaths, paths[i])
+					validHashes = append(validHashes, hashes[i])
+				}
+			}
+
+			t := state.NewTable()
+			for i, group := range imageutil.HashGroup(validHashes, threshold) {
+				gt := state.NewTable()
+				for j, ind := range group {
+					gt.RawSetInt(j+1, golua.LString(validPaths[ind]))
+				}
+				t.RawSetInt(i+1, gt)
+			}
+
+			state.Push(t)
+			return 1
+		})
+
 	/// @func dir_txt(path) -> []string
 	/// @arg path {string} - The directory path to scan for txt.
 	/// @returns {[]string} - Array containing paths to each valid txt in the directory.
@@ -1913,6 +2535,20 @@ func RegisterIO(r *lua.Runner, lg *log.Logger) {
 	tab.RawSetString("EMBEDDED_ICON_192x192", golua.LNumber(EMBEDDED_ICON_192x192))
 	tab.RawSetString("EMBEDDED_ICON_512x512", golua.LNumber(EMBEDDED_ICON_512x512))
 
+	/// @constants PaletteFormat {int}
+	/// @const PALETTEFORMAT_HEX - Lospec .hex files.
+	/// @const PALETTEFORMAT_GPL - GIMP .gpl files.
+	/// @const PALETTEFORMAT_JASC - Paint Shop Pro .pal files.
+	/// @const PALETTEFORMAT_ACO - Photoshop .aco swatches.
+	/// @const PALETTEFORMAT_ASE - Adobe Swatch Exchange .ase files.
+	/// @const PALETTEFORMAT_PNG - An image with a pixel for each color.
+	tab.RawSetString("PALETTEFORMAT_HEX", golua.LNumber(imageutil.PALETTEFORMAT_HEX))
+	tab.RawSetString("PALETTEFORMAT_GPL", golua.LNumber(imageutil.PALETTEFORMAT_GPL))
+	tab.RawSetString("PALETTEFORMAT_JASC", golua.LNumber(imageutil.PALETTEFORMAT_JASC))
+	tab.RawSetString("PALETTEFORMAT_ACO", golua.LNumber(imageutil.PALETTEFORMAT_ACO))
+	tab.RawSetString("PALETTEFORMAT_ASE", golua.LNumber(imageutil.PALETTEFORMAT_ASE))
+	tab.RawSetString("PALETTEFORMAT_PNG", golua.LNumber(imageutil.PALETTEFORMAT_PNG))
+
 	/// @constants ICOType {int}
 	/// @const ICOTYPE_ICO
 	/// @const ICOTYPE_CUR
@@ -2055,3 +2691,233 @@ func parseDirRecursiveFilter(pathstr string, filter []string, state *golua.LStat
 
 	return t
 }
+
+func encodeOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.EncodeOptions {
+	/// @struct EncodeOptions
+	/// @prop jpeg_quality {int} - Between 1 and 100, defaults to 75.
+	/// @prop png_compression {int<image.PNGCompression>} - Defaults to image.PNGCOMPRESSION_DEFAULT.
+	/// @prop webp_lossy {bool} - Defaults to false.
+	/// @prop webp_quality {float} - Between 0 and 100, defaults to 100. When lossless this is the compression effort.
+	/// @prop webp_method {int} - Between 0 (fast) and 6 (slower but smaller), defaults to 4.
+	/// @prop gif_colors {int} - Between 1 and 256, defaults to 256.
+	/// @prop gif_quantizer {int<image.GIFQuantizer>} - Defaults to image.GIFQUANTIZER_PLAN9, which uses median cut when gif_colors is below 256.
+	/// @prop gif_dither {bool} - Defaults to true.
+	/// @prop tiff_compression {int<image.TIFFCompression>} - Defaults to image.TIFFCOMPRESSION_NONE.
+	/// @prop tga_rle {bool} - Defaults to false.
+	/// @prop dds_format {int<image.DDSFormat>} - Defaults to image.DDSFORMAT_RGBA.
+	/// @prop exr_zip {bool} - Compresses each chunk of 16 scanlines with ZIP, defaults to false.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+	/// Only the fields for the encoding being used are applied.
+
+	opts := imageutil.DefaultEncodeOptions()
+
+	number := func(key string, v golua.LValue) golua.LNumber {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("encode option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return n
+	}
+	boolean := func(key string, v golua.LValue) bool {
+		b, ok := v.(golua.LBool)
+		if !ok {
+			lua.Error(state, lg.Appendf("encode option %s must be a bool, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return bool(b)
+	}
+	enum := func(key string, v golua.LValue, length int) int {
+		n := int(number(key, v))
+		if n < 0 || n >= length {
+			lua.Error(state, lg.Appendf("invalid enum value for encode option %s: %d", log.LEVEL_ERROR, key, n))
+		}
+		return n
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "jpeg_quality":
+			opts.JPEGQuality = int(number(key, v))
+		case "png_compression":
+			opts.PNGCompression = imageutil.PNGCompressionList[enum(key, v, len(imageutil.PNGCompressionList))]
+		case "webp_lossy":
+			opts.WebPLossy = boolean(key, v)
+		case "webp_quality":
+			opts.WebPQuality = float32(number(key, v))
+		case "webp_method":
+			opts.WebPMethod = int(number(key, v))
+		case "gif_colors":
+			opts.GIFColors = int(number(key, v))
+		case "gif_quantizer":
+			opts.GIFQuantizer = imageutil.GIFQuantizerList[enum(key, v, len(imageutil.GIFQuantizerList))]
+		case "gif_dither":
+			opts.GIFDither = boolean(key, v)
+		case "tiff_compression":
+			opts.TIFFCompression = imageutil.TIFFCompressionList[enum(key, v, len(imageutil.TIFFCompressionList))]
+		case "tga_rle":
+			opts.TGARLE = boolean(key, v)
+		case "dds_format":
+			opts.DDSFormat = imageutil.DDSFormatList[enum(key, v, len(imageutil.DDSFormatList))]
+		case "exr_zip":
+			opts.EXRZip = boolean(key, v)
+		default:
+			lua.Error(state, lg.Appendf("unknown encode option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid encode options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func decodeOptionsBuild(r *lua.Runner, state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.DecodeOptions {
+	/// @struct DecodeOptions
+	/// @prop auto_orient {bool} - Applies the EXIF orientation to the image after decoding, defaults to false.
+	/// @prop encoding {int<image.Encoding>} - Overrides the encoding from the file extension, use image.ENCODING_AUTO to detect it from the file contents. Ignored when decoding from a string.
+	/// @prop max_pixels {int} - The max width*height of the image, or the canvas of an animation.
+	/// @prop max_bytes {int} - The max size of the encoded image data.
+	/// @prop max_frames {int} - The max number of frames, only used by animation decoders.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+	/// The limits are checked before the image is decoded, failing the decode when exceeded.
+	/// They can only be stricter than the decode limits set in the config, 0 uses the config value.
+
+	opts := imageutil.DefaultDecodeOptions()
+	limits := imageutil.DecodeLimits{}
+
+	limit := func(key string, v golua.LValue) int64 {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("decode option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		if n < 0 {
+			lua.Error(state, lg.Appendf("decode option %s cannot be negative: %d", log.LEVEL_ERROR, key, int64(n)))
+		}
+		return int64(n)
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "auto_orient":
+			b, ok := v.(golua.LBool)
+			if !ok {
+				lua.Error(state, lg.Appendf("decode option %s must be a bool, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			opts.AutoOrient = bool(b)
+		case "encoding":
+			n, ok := v.(golua.LNumber)
+			if !ok {
+				lua.Error(state, lg.Appendf("decode option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			if int(n) < 0 || int(n) >= len(imageutil.EncodingList) {
+				lua.Error(state, lg.Appendf("invalid enum value for decode option %s: %d", log.LEVEL_ERROR, key, int(n)))
+			}
+			opts.Encoding = imageutil.EncodingList[int(n)]
+		case "max_pixels":
+			limits.MaxPixels = int(limit(key, v))
+		case "max_bytes":
+			limits.MaxBytes = limit(key, v)
+		case "max_frames":
+			limits.MaxFrames = int(limit(key, v))
+		default:
+			lua.Error(state, lg.Appendf("unknown decode option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	opts.Limits = decodeLimits(r).Merge(limits)
+
+	return opts
+}
+
+// decodeLimits are the global decode limits from the config.
+func decodeLimits(r *lua.Runner) imageutil.DecodeLimits {
+	return imageutil.DecodeLimits{
+		MaxPixels: r.Config.DecodeMaxPixels,
+		MaxBytes:  r.Config.DecodeMaxBytes,
+		MaxFrames: r.Config.DecodeMaxFrames,
+	}
+}
+
+// imageDecode checks the decode limits and decodes the image along with its metadata,
+// metadata that fails to parse is logged and dropped instead of failing the decode.
+// The returned encoding is the detected one when image.ENCODING_AUTO is used.
+func imageDecode(lg *log.Logger, r io.ReadSeeker, encoding imageutil.ImageEncoding, model imageutil.ColorModel, opts *imageutil.DecodeOptions) (image.Image, imageutil.ImageEncoding, imageutil.ColorModel, *imageutil.Metadata, error) {
+	encoding, err := imageutil.ResolveEncoding(r, encoding)
+	if err != nil {
+		return nil, encoding, model, nil, err
+	}
+
+	err = opts.Limits.Check(r, encoding)
+	if err != nil {
+		return nil, encoding, model, nil, err
+	}
+
+	meta, err := imageutil.MetadataDecode(r, encoding)
+	if err != nil {
+		lg.Append(fmt.Sprintf("failed to read image metadata: %s", err), log.LEVEL_WARN)
+		meta = nil
+	}
+
+	img, err := imageutil.Decode(r, encoding)
+	if err != nil {
+		return nil, encoding, model, nil, err
+	}
+
+	img, model = imageutil.Limit(img, model)
+
+	if opts.AutoOrient && meta != nil {
+		img = imageutil.MetadataOrient(img, meta.Orientation)
+		meta.Orientation = imageutil.ORIENTATION_NORMAL
+	}
+
+	return img, encoding, model, meta, nil
+}
+
+func paletteOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable, p *imageutil.PaletteFile, format imageutil.PaletteFormat) imageutil.PaletteFormat {
+	/// @struct PaletteOptions
+	/// @prop format {int<io.PaletteFormat>} - Overrides the format from the file extension.
+	/// @prop name {string} - The name of the palette, only used by .gpl files.
+	/// @prop columns {int} - Only used by .gpl files.
+	/// @prop names {[]string} - The name of each color, used by .gpl, .aco and .ase files.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "format":
+			n, ok := v.(golua.LNumber)
+			if !ok || int(n) < 0 || int(n) >= len(imageutil.PaletteFormatList) || imageutil.PaletteFormat(n) == imageutil.PALETTEFORMAT_UNKNOWN {
+				lua.Error(state, lg.Appendf("invalid palette format: %s", log.LEVEL_ERROR, v))
+			}
+			format = imageutil.PaletteFormat(n)
+		case "name":
+			p.Name = v.String()
+		case "columns":
+			n, ok := v.(golua.LNumber)
+			if !ok || n < 0 {
+				lua.Error(state, lg.Appendf("palette option columns must be a positive number, got: %s", log.LEVEL_ERROR, v))
+			}
+			p.Columns = int(n)
+		case "names":
+			names, ok := v.(*golua.LTable)
+			if !ok {
+				lua.Error(state, lg.Appendf("palette option names must be a list of strings, got: %s", log.LEVEL_ERROR, v.Type()))
+			}
+			for i := range min(names.Len(), len(p.Colors)) {
+				p.Colors[i].Name = names.RawGetInt(i + 1).String()
+			}
+		default:
+			lua.Error(state, lg.Appendf("unknown palette option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	return format
+}
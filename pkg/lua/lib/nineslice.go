@@ -0,0 +1,444 @@
+package lib
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua"
+	golua "github.com/yuin/gopher-lua"
+)
+
+const LIB_NINESLICE = "nineslice"
+
+/// @lib Nine Slice
+/// @import nineslice
+/// @desc
+/// Library for scaling UI assets with 9-slices, and reading and writing Android nine-patches.
+/// @section
+/// A 9-slice splits an image into corners that keep their size,
+/// edges that scale along one axis and a center that scales along both.
+
+func RegisterNineSlice(r *lua.Runner, lg *log.Logger) {
+	lib, tab := lua.NewLib(LIB_NINESLICE, r, r.State, lg)
+
+	/// @func new(left, top, right, bottom) -> struct<nineslice.NineSlice>
+	/// @arg left {int}
+	/// @arg top {int}
+	/// @arg right {int}
+	/// @arg bottom {int}
+	/// @returns {struct<nineslice.NineSlice>} - The padding matches the insets.
+	lib.CreateFunction(tab, "new",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "left"},
+			{Type: lua.INT, Name: "top"},
+			{Type: lua.INT, Name: "right"},
+			{Type: lua.INT, Name: "bottom"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			left, top, right, bottom := args["left"].(int), args["top"].(int), args["right"].(int), args["bottom"].(int)
+
+			t := nineSliceTable(state, imageutil.NineSlice{
+				Left: left, Top: top, Right: right, Bottom: bottom,
+				PaddingLeft: left, PaddingTop: top, PaddingRight: right, PaddingBottom: bottom,
+			})
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func resize(id, name, slice, width, height, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg slice {struct<nineslice.NineSlice>}
+	/// @arg width {int}
+	/// @arg height {int}
+	/// @arg? options {struct<nineslice.ResizeOptions>}
+	/// @returns {int<collection.IMAGE>} - A new image using the NRGBA color model.
+	/// @desc
+	/// When the size is smaller than the corners, the corners are scaled down to fit.
+	lib.CreateFunction(tab, "resize",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "slice"},
+			{Type: lua.INT, Name: "width"},
+			{Type: lua.INT, Name: "height"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			slice := nineSliceBuild(state, lg, args["slice"].(*golua.LTable))
+			opts := nineSliceOptionsBuild(state, lg, args["options"].(*golua.LTable))
+			width, height := args["width"].(int), args["height"].(int)
+
+			var img image.Image
+			var encoding imageutil.ImageEncoding
+			ready := make(chan struct{}, 1)
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					out, err := imageutil.NineSliceResize(i.Self.Image, slice, width, height, opts)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to resize nine-slice: %s", log.LEVEL_ERROR, err))
+					}
+
+					img = out
+					encoding = i.Self.Encoding
+					ready <- struct{}{}
+				},
+				Fail: func(i *collection.Item[collection.ItemImage]) {
+					ready <- struct{}{}
+				},
+			})
+
+			name := args["name"].(string)
+			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+				i.Wait(ready)
+				i.Self = &collection.ItemImage{
+					Name:     name,
+					Image:    img,
+					Encoding: encoding,
+					Model:    imageutil.MODEL_NRGBA,
+				}
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func ninepatch_decode(id, name) -> int<collection.IMAGE>, struct<nineslice.NineSlice>
+	/// @arg id {int<collection.IMAGE>} - An image loaded from a .9.png, including the 1 pixel border.
+	/// @arg name {string}
+	/// @returns {int<collection.IMAGE>} - A new image without the border, using the NRGBA color model.
+	/// @returns {struct<nineslice.NineSlice>}
+	/// @blocking
+	/// @desc
+	/// Multiple stretch areas on an edge are merged into one.
+	/// When the padding is not marked, it matches the stretch area.
+	/// Red optical bound markers are ignored.
+	lib.CreateFunction(tab, "ninepatch_decode",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			var img image.Image
+			var encoding imageutil.ImageEncoding
+			var slice imageutil.NineSlice
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					out, s, err := imageutil.NinePatchDecode(i.Self.Image)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to decode nine-patch: %s", log.LEVEL_ERROR, err))
+					}
+
+					img = out
+					slice = s
+					encoding = i.Self.Encoding
+				},
+			})
+
+			name := args["name"].(string)
+			chLog := log.NewLogger(fmt.Sprintf("image_%s", name), lg)
+			lg.Append(fmt.Sprintf("child log created: image_%s", name), log.LEVEL_INFO)
+
+			id := r.IC.AddItem(&chLog)
+
+			r.IC.Schedule(state, id, &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					i.Self = &collection.ItemImage{
+						Name:     name,
+						Image:    img,
+						Encoding: encoding,
+						Model:    imageutil.MODEL_NRGBA,
+					}
+				},
+			})
+
+			state.Push(golua.LNumber(id))
+			state.Push(nineSliceTable(state, slice))
+			return 2
+		})
+
+	/// @func ninepatch_encode(id, name, slice) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg slice {struct<nineslice.NineSlice>}
+	/// @returns {int<collection.IMAGE>} - A new image with the 1 pixel border of a .9.png, using the NRGBA color model.
+	/// @desc
+	/// The stretch area must not be empty. The image should be saved with a name ending in .9.png.
+	lib.CreateFunction(tab, "ninepatch_encode",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "slice"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			slice := nineSliceBuild(state, lg, args["slice"].(*golua.LTable))
+
+			var img image.Image
+			var encoding imageutil.ImageEncoding
+			ready := make(chan struct{}, 1)
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					out, err := imageutil.NinePatchEncode(i.Self.Image, slice)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to encode nine-patch: %s", log.LEVEL_ERROR, err))
+					}
+
+					img = out
+					encoding = i.Self.Encoding
+					ready <- struct{}{}
+				},
+				Fail: func(i *collection.Item[collection.ItemImage]) {
+					ready <- struct{}{}
+				},
+			})
+
+			name := args["name"].(string)
+			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+				i.Wait(ready)
+				i.Self = &collection.ItemImage{
+					Name:     name,
+					Image:    img,
+					Encoding: encoding,
+					Model:    imageutil.MODEL_NRGBA,
+				}
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func from_aseprite(key) -> struct<nineslice.NineSlice>
+	/// @arg key {struct<aseprite.SliceKey>} - A key from a slice with nine_slice set.
+	/// @returns {struct<nineslice.NineSlice>} - The padding matches the insets.
+	/// @desc
+	/// The insets are relative to the slice bounds,
+	/// so the slice should be cut out of the frame with image.subimg before resizing.
+	lib.CreateFunction(tab, "from_aseprite",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "key"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			t := args["key"].(*golua.LTable)
+
+			field := func(name string) int {
+				v, ok := t.RawGetString(name).(golua.LNumber)
+				if !ok {
+					lua.Error(state, lg.Appendf("aseprite slice key is missing %s, it must be from a 9-slice", log.LEVEL_ERROR, name))
+				}
+				return int(v)
+			}
+
+			width, height := field("width"), field("height")
+			cx, cy := field("center_x"), field("center_y")
+
+			slice := imageutil.NineSliceFromAseprite(imageutil.AsepriteSliceKey{
+				Bounds: image.Rect(0, 0, width, height),
+				Center: image.Rect(cx, cy, cx+field("center_width"), cy+field("center_height")),
+			})
+
+			state.Push(nineSliceTable(state, slice))
+			return 1
+		})
+
+	/// @func load_json(path) -> struct<nineslice.NineSlice>
+	/// @arg path {string}
+	/// @returns {struct<nineslice.NineSlice>}
+	/// @desc
+	/// Loads a json sidecar file with the fields of nineslice.NineSlice.
+	/// Missing padding fields match the insets.
+	lib.CreateFunction(tab, "load_json",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			f, err := os.Open(args["path"].(string))
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to open nine-slice file: %s", log.LEVEL_ERROR, err))
+			}
+			defer f.Close()
+
+			slice, err := imageutil.NineSliceDecodeJSON(f)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode nine-slice file: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(nineSliceTable(state, slice))
+			return 1
+		})
+
+	/// @func save_json(path, slice)
+	/// @arg path {string}
+	/// @arg slice {struct<nineslice.NineSlice>}
+	/// @desc
+	/// Saves a json sidecar file that can be loaded with nineslice.load_json.
+	lib.CreateFunction(tab, "save_json",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.RAW_TABLE, Name: "slice"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			slice := nineSliceBuild(state, lg, args["slice"].(*golua.LTable))
+
+			b, err := imageutil.NineSliceEncodeJSON(slice)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to encode nine-slice: %s", log.LEVEL_ERROR, err))
+			}
+
+			err = os.WriteFile(args["path"].(string), b, 0o666)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to save nine-slice file: %s", log.LEVEL_ERROR, err))
+			}
+
+			return 0
+		})
+
+	/// @func load_aseprite_json(path) -> table<any>
+	/// @arg path {string}
+	/// @returns {table<any>} - A table of nineslice.NineSlice structs, keyed by slice name.
+	/// @desc
+	/// Loads the 9-slices from the meta of a json file exported by Aseprite,
+	/// using the first key of each slice. Slices without a center are skipped.
+	lib.CreateFunction(tab, "load_aseprite_json",
+		[]lua.Arg{
+			{Type: lua.STRING, Name: "path"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			f, err := os.Open(args["path"].(string))
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to open aseprite json file: %s", log.LEVEL_ERROR, err))
+			}
+			defer f.Close()
+
+			slices, err := imageutil.NineSliceDecodeAsepriteJSON(f)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to decode aseprite json file: %s", log.LEVEL_ERROR, err))
+			}
+
+			t := state.NewTable()
+			for name, slice := range slices {
+				t.RawSetString(name, nineSliceTable(state, slice))
+			}
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @constants Mode {int}
+	/// @const MODE_STRETCH
+	/// @const MODE_TILE - Repeats the region from its top left, the last repeat is cut off.
+	tab.RawSetString("MODE_STRETCH", golua.LNumber(imageutil.NINESLICE_STRETCH))
+	tab.RawSetString("MODE_TILE", golua.LNumber(imageutil.NINESLICE_TILE))
+}
+
+func nineSliceTable(state *golua.LState, slice imageutil.NineSlice) *golua.LTable {
+	/// @struct NineSlice
+	/// @prop left {int} - The width of the left corners.
+	/// @prop top {int} - The height of the top corners.
+	/// @prop right {int} - The width of the right corners.
+	/// @prop bottom {int} - The height of the bottom corners.
+	/// @prop padding_left {int} - The insets of the content area, used by nine-patches.
+	/// @prop padding_top {int}
+	/// @prop padding_right {int}
+	/// @prop padding_bottom {int}
+
+	t := state.NewTable()
+
+	t.RawSetString("left", golua.LNumber(slice.Left))
+	t.RawSetString("top", golua.LNumber(slice.Top))
+	t.RawSetString("right", golua.LNumber(slice.Right))
+	t.RawSetString("bottom", golua.LNumber(slice.Bottom))
+	t.RawSetString("padding_left", golua.LNumber(slice.PaddingLeft))
+	t.RawSetString("padding_top", golua.LNumber(slice.PaddingTop))
+	t.RawSetString("padding_right", golua.LNumber(slice.PaddingRight))
+	t.RawSetString("padding_bottom", golua.LNumber(slice.PaddingBottom))
+
+	return t
+}
+
+// nineSliceBuild reads a nine-slice table, missing padding fields match the insets.
+func nineSliceBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.NineSlice {
+	field := func(name string, fallback *int) int {
+		switch v := t.RawGetString(name).(type) {
+		case golua.LNumber:
+			return int(v)
+		case *golua.LNilType:
+			if fallback != nil {
+				return *fallback
+			}
+		}
+
+		lua.Error(state, lg.Appendf("nine-slice field %s must be a number", log.LEVEL_ERROR, name))
+		return 0
+	}
+
+	slice := imageutil.NineSlice{}
+	slice.Left = field("left", nil)
+	slice.Top = field("top", nil)
+	slice.Right = field("right", nil)
+	slice.Bottom = field("bottom", nil)
+	slice.PaddingLeft = field("padding_left", &slice.Left)
+	slice.PaddingTop = field("padding_top", &slice.Top)
+	slice.PaddingRight = field("padding_right", &slice.Right)
+	slice.PaddingBottom = field("padding_bottom", &slice.Bottom)
+
+	return slice
+}
+
+func nineSliceOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.NineSliceOptions {
+	/// @struct ResizeOptions
+	/// @prop edge {int<nineslice.Mode>} - How the edges fill their space. Defaults to nineslice.MODE_STRETCH.
+	/// @prop center {int<nineslice.Mode>} - How the center fills its space. Defaults to nineslice.MODE_STRETCH.
+	/// @prop smooth {bool} - Use bilinear sampling when stretching instead of nearest neighbor. Defaults to false.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+	/// Sampling never crosses into a neighboring region.
+
+	opts := imageutil.DefaultNineSliceOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "edge", "center":
+			n, ok := v.(golua.LNumber)
+			if !ok {
+				lua.Error(state, lg.Appendf("nine-slice option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			if key == "edge" {
+				opts.Edge = imageutil.NineSliceMode(n)
+			} else {
+				opts.Center = imageutil.NineSliceMode(n)
+			}
+		case "smooth":
+			b, ok := v.(golua.LBool)
+			if !ok {
+				lua.Error(state, lg.Appendf("nine-slice option %s must be a boolean, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			opts.Smooth = bool(b)
+		default:
+			lua.Error(state, lg.Appendf("unknown nine-slice option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid nine-slice options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
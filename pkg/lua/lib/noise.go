@@ -2,6 +2,7 @@ package lib
 
 import (
 	"fmt"
+	"image"
 	"math"
 
 	"github.com/ArtificialLegacy/imgscal/pkg/collection"
@@ -288,4 +289,657 @@ func RegisterNoise(r *lua.Runner, lg *log.Logger) {
 			state.Push(golua.LNumber(v))
 			return 1
 		})
+
+	/// @func perlin(seed) -> struct<noise.NoisePerlin>
+	/// @arg seed {int}
+	/// @returns {struct<noise.NoisePerlin>}
+	/// @desc
+	/// Classic gradient noise, with features around 1 unit apart.
+	lib.CreateFunction(tab, "perlin",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "seed"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct NoisePerlin
+			/// @prop type {string<noise.NoiseType>}
+			/// @prop seed {int}
+
+			t := state.NewTable()
+			t.RawSetString("type", golua.LString(NOISE_PERLIN))
+			t.RawSetString("seed", golua.LNumber(args["seed"].(int)))
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func value(seed) -> struct<noise.NoiseValue>
+	/// @arg seed {int}
+	/// @returns {struct<noise.NoiseValue>}
+	/// @desc
+	/// Smoothly interpolates random values placed 1 unit apart, blockier than perlin noise.
+	lib.CreateFunction(tab, "value",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "seed"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct NoiseValue
+			/// @prop type {string<noise.NoiseType>}
+			/// @prop seed {int}
+
+			t := state.NewTable()
+			t.RawSetString("type", golua.LString(NOISE_VALUE))
+			t.RawSetString("seed", golua.LNumber(args["seed"].(int)))
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func simplex(seed) -> struct<noise.NoiseSimplex>
+	/// @arg seed {int}
+	/// @returns {struct<noise.NoiseSimplex>}
+	/// @desc
+	/// The same noise as simplex_2d, tileable simplex noise is sampled from 4D.
+	lib.CreateFunction(tab, "simplex",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "seed"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct NoiseSimplex
+			/// @prop type {string<noise.NoiseType>}
+			/// @prop seed {int}
+
+			t := state.NewTable()
+			t.RawSetString("type", golua.LString(NOISE_SIMPLEX))
+			t.RawSetString("seed", golua.LNumber(args["seed"].(int)))
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func worley(seed, distance, metric, jitter) -> struct<noise.NoiseWorley>
+	/// @arg seed {int}
+	/// @arg distance {int<noise.WorleyDistance>}
+	/// @arg metric {int<noise.WorleyMetric>}
+	/// @arg jitter {float} - Between 0 and 1, how far feature points can move from the center of their cell.
+	/// @returns {struct<noise.NoiseWorley>}
+	/// @desc
+	/// Cellular noise with one feature point in each 1 unit cell.
+	/// Distances from 0 to 1 are mapped to noise values from -1 to 1.
+	lib.CreateFunction(tab, "worley",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "seed"},
+			{Type: lua.INT, Name: "distance"},
+			{Type: lua.INT, Name: "metric"},
+			{Type: lua.FLOAT, Name: "jitter"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct NoiseWorley
+			/// @prop type {string<noise.NoiseType>}
+			/// @prop seed {int}
+			/// @prop distance {int<noise.WorleyDistance>}
+			/// @prop metric {int<noise.WorleyMetric>}
+			/// @prop jitter {float}
+
+			t := state.NewTable()
+			t.RawSetString("type", golua.LString(NOISE_WORLEY))
+			t.RawSetString("seed", golua.LNumber(args["seed"].(int)))
+			t.RawSetString("distance", golua.LNumber(lua.ParseEnum(args["distance"].(int), imageutil.WorleyDistanceList, lib)))
+			t.RawSetString("metric", golua.LNumber(lua.ParseEnum(args["metric"].(int), imageutil.WorleyMetricList, lib)))
+			t.RawSetString("jitter", golua.LNumber(args["jitter"].(float64)))
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func fbm(source, octaves, lacunarity, gain) -> struct<noise.NoiseFractal>
+	/// @arg source {struct<noise.Noise>}
+	/// @arg octaves {int} - Between 1 and 16.
+	/// @arg lacunarity {float} - Frequency multiplier for each octave, usually 2.
+	/// @arg gain {float} - Amplitude multiplier for each octave, usually 0.5.
+	/// @returns {struct<noise.NoiseFractal>}
+	/// @desc
+	/// Fractal brownian motion, sums octaves of the source noise.
+	/// Tileable noise only stays tileable with a whole number lacunarity.
+	lib.CreateFunction(tab, "fbm",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "source"},
+			{Type: lua.INT, Name: "octaves"},
+			{Type: lua.FLOAT, Name: "lacunarity"},
+			{Type: lua.FLOAT, Name: "gain"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			t := noiseFractalTable(state, lg, imageutil.FRACTAL_FBM, args)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func turbulence(source, octaves, lacunarity, gain) -> struct<noise.NoiseFractal>
+	/// @arg source {struct<noise.Noise>}
+	/// @arg octaves {int} - Between 1 and 16.
+	/// @arg lacunarity {float} - Frequency multiplier for each octave, usually 2.
+	/// @arg gain {float} - Amplitude multiplier for each octave, usually 0.5.
+	/// @returns {struct<noise.NoiseFractal>}
+	/// @desc
+	/// Sums the absolute value of each octave, creating creases where the source crosses 0.
+	/// Tileable noise only stays tileable with a whole number lacunarity.
+	lib.CreateFunction(tab, "turbulence",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "source"},
+			{Type: lua.INT, Name: "octaves"},
+			{Type: lua.FLOAT, Name: "lacunarity"},
+			{Type: lua.FLOAT, Name: "gain"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			t := noiseFractalTable(state, lg, imageutil.FRACTAL_TURBULENCE, args)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func ridged(source, octaves, lacunarity, gain) -> struct<noise.NoiseFractal>
+	/// @arg source {struct<noise.Noise>}
+	/// @arg octaves {int} - Between 1 and 16.
+	/// @arg lacunarity {float} - Frequency multiplier for each octave, usually 2.
+	/// @arg gain {float} - Amplitude multiplier for each octave, usually 0.5.
+	/// @returns {struct<noise.NoiseFractal>}
+	/// @desc
+	/// Ridged multifractal, inverts the absolute value of each octave to create sharp ridges,
+	/// with each octave weighted by the previous one.
+	/// Tileable noise only stays tileable with a whole number lacunarity.
+	lib.CreateFunction(tab, "ridged",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "source"},
+			{Type: lua.INT, Name: "octaves"},
+			{Type: lua.FLOAT, Name: "lacunarity"},
+			{Type: lua.FLOAT, Name: "gain"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			t := noiseFractalTable(state, lg, imageutil.FRACTAL_RIDGED, args)
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func warp(source, warp, strength) -> struct<noise.NoiseWarp>
+	/// @arg source {struct<noise.Noise>}
+	/// @arg warp {struct<noise.Noise>} - Noise used to offset the position given to the source.
+	/// @arg strength {float} - The largest offset, in noise units.
+	/// @returns {struct<noise.NoiseWarp>}
+	/// @desc
+	/// Domain warping, the source is sampled at a position moved by the warp noise.
+	lib.CreateFunction(tab, "warp",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "source"},
+			{Type: lua.RAW_TABLE, Name: "warp"},
+			{Type: lua.FLOAT, Name: "strength"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			/// @struct NoiseWarp
+			/// @prop type {string<noise.NoiseType>}
+			/// @prop source {struct<noise.Noise>}
+			/// @prop warp {struct<noise.Noise>}
+			/// @prop strength {float}
+
+			t := state.NewTable()
+			t.RawSetString("type", golua.LString(NOISE_WARP))
+			t.RawSetString("source", args["source"].(*golua.LTable))
+			t.RawSetString("warp", args["warp"].(*golua.LTable))
+			t.RawSetString("strength", golua.LNumber(args["strength"].(float64)))
+
+			if _, err := noiseBuild(t, 0); err != nil {
+				lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func eval_2d(noise, x, y, normalize?, period?) -> float
+	/// @arg noise {struct<noise.Noise>}
+	/// @arg x {float}
+	/// @arg y {float}
+	/// @arg? normalize {bool} - Use noise values between (0,1) instead of (-1,1).
+	/// @arg? period {int} - When above 0, the noise repeats every period units on both axes.
+	/// @returns {float}
+	lib.CreateFunction(tab, "eval_2d",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "noise"},
+			{Type: lua.FLOAT, Name: "x"},
+			{Type: lua.FLOAT, Name: "y"},
+			{Type: lua.BOOL, Name: "normalize", Optional: true},
+			{Type: lua.INT, Name: "period", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			n, err := noiseBuild(args["noise"].(*golua.LTable), 0)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+			}
+
+			v := n.Eval2(args["x"].(float64), args["y"].(float64), args["period"].(int))
+			if args["normalize"].(bool) {
+				v = (v + 1) / 2
+			}
+
+			state.Push(golua.LNumber(v))
+			return 1
+		})
+
+	/// @func image_new(noise, coef, normalize, name, encoding, width, height, model?, disableColor?, disableAlpha?) -> int<collection.IMAGE>
+	/// @arg noise {struct<noise.Noise>}
+	/// @arg coef {float}
+	/// @arg normalize {bool} - Use noise values between (0,1) instead of (-1,1).
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg width {int}
+	/// @arg height {int}
+	/// @arg? model {int<image.ColorModel>}
+	/// @arg? disableColor {bool} - Don't set r,g,b values using noise.
+	/// @arg? disableAlpha {bool} - Don't set alpha values using noise.
+	/// @returns {int<collection.IMAGE>}
+	/// @desc
+	/// Works the same as simplex_image_new, using any noise.
+	lib.CreateFunction(tab, "image_new",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "noise"},
+			{Type: lua.FLOAT, Name: "coef"},
+			{Type: lua.BOOL, Name: "normalize"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "width"},
+			{Type: lua.INT, Name: "height"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.BOOL, Name: "disableColor", Optional: true},
+			{Type: lua.BOOL, Name: "disableAlpha", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			n, err := noiseBuild(args["noise"].(*golua.LTable), 0)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+			}
+
+			coef := args["coef"].(float64)
+			id := noiseImageNew(r, lib, lg, state, d, args, n, coef, coef, 0)
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func image_map(noise, coef, id, normalize, disableColor?, disableAlpha?, keep?)
+	/// @arg noise {struct<noise.Noise>}
+	/// @arg coef {float}
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg normalize {bool} - Use noise values between (0,1) instead of (-1,1).
+	/// @arg? disableColor {bool} - Don't set r,g,b values using noise.
+	/// @arg? disableAlpha {bool} - Don't set alpha values using noise.
+	/// @arg? keep {bool} - Maintain color or alpha channels if they're disabled.
+	/// @desc
+	/// Works the same as simplex_image_map, using any noise.
+	lib.CreateFunction(tab, "image_map",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "noise"},
+			{Type: lua.FLOAT, Name: "coef"},
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.BOOL, Name: "normalize"},
+			{Type: lua.BOOL, Name: "disableColor", Optional: true},
+			{Type: lua.BOOL, Name: "disableAlpha", Optional: true},
+			{Type: lua.BOOL, Name: "keep", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			n, err := noiseBuild(args["noise"].(*golua.LTable), 0)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+			}
+
+			coef := args["coef"].(float64)
+			noiseImageMap(r, state, d, args, n, func(width, height int) (float64, float64) { return coef, coef }, 0)
+
+			return 0
+		})
+
+	/// @func image_new_tileable(noise, period, normalize, name, encoding, width, height, model?, disableColor?, disableAlpha?) -> int<collection.IMAGE>
+	/// @arg noise {struct<noise.Noise>}
+	/// @arg period {int} - How many noise units the image covers on each axis.
+	/// @arg normalize {bool} - Use noise values between (0,1) instead of (-1,1).
+	/// @arg name {string}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg width {int}
+	/// @arg height {int}
+	/// @arg? model {int<image.ColorModel>}
+	/// @arg? disableColor {bool} - Don't set r,g,b values using noise.
+	/// @arg? disableAlpha {bool} - Don't set alpha values using noise.
+	/// @returns {int<collection.IMAGE>}
+	/// @desc
+	/// Creates an image of exactly one period of the noise, so it tiles seamlessly.
+	/// Non-square images stretch the noise to fit.
+	lib.CreateFunction(tab, "image_new_tileable",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "noise"},
+			{Type: lua.INT, Name: "period"},
+			{Type: lua.BOOL, Name: "normalize"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.INT, Name: "width"},
+			{Type: lua.INT, Name: "height"},
+			{Type: lua.INT, Name: "model", Optional: true},
+			{Type: lua.BOOL, Name: "disableColor", Optional: true},
+			{Type: lua.BOOL, Name: "disableAlpha", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			n, err := noiseBuild(args["noise"].(*golua.LTable), 0)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+			}
+
+			period := args["period"].(int)
+			if period < 1 {
+				lua.Error(state, lg.Appendf("noise period must be at least 1, got: %d", log.LEVEL_ERROR, period))
+			}
+
+			cx := float64(period) / float64(args["width"].(int))
+			cy := float64(period) / float64(args["height"].(int))
+			id := noiseImageNew(r, lib, lg, state, d, args, n, cx, cy, period)
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func image_map_tileable(noise, period, id, normalize, disableColor?, disableAlpha?, keep?)
+	/// @arg noise {struct<noise.Noise>}
+	/// @arg period {int} - How many noise units the image covers on each axis.
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg normalize {bool} - Use noise values between (0,1) instead of (-1,1).
+	/// @arg? disableColor {bool} - Don't set r,g,b values using noise.
+	/// @arg? disableAlpha {bool} - Don't set alpha values using noise.
+	/// @arg? keep {bool} - Maintain color or alpha channels if they're disabled.
+	/// @desc
+	/// Maps exactly one period of the noise onto the image, so it tiles seamlessly.
+	lib.CreateFunction(tab, "image_map_tileable",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "noise"},
+			{Type: lua.INT, Name: "period"},
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.BOOL, Name: "normalize"},
+			{Type: lua.BOOL, Name: "disableColor", Optional: true},
+			{Type: lua.BOOL, Name: "disableAlpha", Optional: true},
+			{Type: lua.BOOL, Name: "keep", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			n, err := noiseBuild(args["noise"].(*golua.LTable), 0)
+			if err != nil {
+				lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+			}
+
+			period := args["period"].(int)
+			if period < 1 {
+				lua.Error(state, lg.Appendf("noise period must be at least 1, got: %d", log.LEVEL_ERROR, period))
+			}
+
+			noiseImageMap(r, state, d, args, n, func(width, height int) (float64, float64) {
+				return float64(period) / float64(width), float64(period) / float64(height)
+			}, period)
+
+			return 0
+		})
+
+	/// @constants NoiseType {string}
+	/// @const NOISE_PERLIN
+	/// @const NOISE_VALUE
+	/// @const NOISE_SIMPLEX
+	/// @const NOISE_WORLEY
+	/// @const NOISE_FRACTAL
+	/// @const NOISE_WARP
+	tab.RawSetString("NOISE_PERLIN", golua.LString(NOISE_PERLIN))
+	tab.RawSetString("NOISE_VALUE", golua.LString(NOISE_VALUE))
+	tab.RawSetString("NOISE_SIMPLEX", golua.LString(NOISE_SIMPLEX))
+	tab.RawSetString("NOISE_WORLEY", golua.LString(NOISE_WORLEY))
+	tab.RawSetString("NOISE_FRACTAL", golua.LString(NOISE_FRACTAL))
+	tab.RawSetString("NOISE_WARP", golua.LString(NOISE_WARP))
+
+	/// @constants WorleyDistance {int}
+	/// @const WORLEYDISTANCE_F1 - Distance to the closest feature point.
+	/// @const WORLEYDISTANCE_F2 - Distance to the second closest feature point.
+	/// @const WORLEYDISTANCE_F2_F1 - F2 minus F1, outlines the cells.
+	tab.RawSetString("WORLEYDISTANCE_F1", golua.LNumber(imageutil.WORLEYDISTANCE_F1))
+	tab.RawSetString("WORLEYDISTANCE_F2", golua.LNumber(imageutil.WORLEYDISTANCE_F2))
+	tab.RawSetString("WORLEYDISTANCE_F2_F1", golua.LNumber(imageutil.WORLEYDISTANCE_F2_F1))
+
+	/// @constants WorleyMetric {int}
+	/// @const WORLEYMETRIC_EUCLIDEAN
+	/// @const WORLEYMETRIC_MANHATTAN
+	/// @const WORLEYMETRIC_CHEBYSHEV
+	tab.RawSetString("WORLEYMETRIC_EUCLIDEAN", golua.LNumber(imageutil.WORLEYMETRIC_EUCLIDEAN))
+	tab.RawSetString("WORLEYMETRIC_MANHATTAN", golua.LNumber(imageutil.WORLEYMETRIC_MANHATTAN))
+	tab.RawSetString("WORLEYMETRIC_CHEBYSHEV", golua.LNumber(imageutil.WORLEYMETRIC_CHEBYSHEV))
+
+	/// @constants FractalType {int}
+	/// @const FRACTAL_FBM
+	/// @const FRACTAL_TURBULENCE
+	/// @const FRACTAL_RIDGED
+	tab.RawSetString("FRACTAL_FBM", golua.LNumber(imageutil.FRACTAL_FBM))
+	tab.RawSetString("FRACTAL_TURBULENCE", golua.LNumber(imageutil.FRACTAL_TURBULENCE))
+	tab.RawSetString("FRACTAL_RIDGED", golua.LNumber(imageutil.FRACTAL_RIDGED))
+}
+
+const (
+	NOISE_PERLIN  = "perlin"
+	NOISE_VALUE   = "value"
+	NOISE_SIMPLEX = "simplex"
+	NOISE_WORLEY  = "worley"
+	NOISE_FRACTAL = "fractal"
+	NOISE_WARP    = "warp"
+)
+
+// noiseDepthMax limits how deeply noise can be nested, this also catches tables that reference themselves.
+const noiseDepthMax = 32
+
+func noiseFractalTable(state *golua.LState, lg *log.Logger, fractal imageutil.FractalType, args map[string]any) *golua.LTable {
+	/// @struct NoiseFractal
+	/// @prop type {string<noise.NoiseType>}
+	/// @prop fractal {int<noise.FractalType>}
+	/// @prop source {struct<noise.Noise>}
+	/// @prop octaves {int}
+	/// @prop lacunarity {float}
+	/// @prop gain {float}
+
+	t := state.NewTable()
+	t.RawSetString("type", golua.LString(NOISE_FRACTAL))
+	t.RawSetString("fractal", golua.LNumber(fractal))
+	t.RawSetString("source", args["source"].(*golua.LTable))
+	t.RawSetString("octaves", golua.LNumber(args["octaves"].(int)))
+	t.RawSetString("lacunarity", golua.LNumber(args["lacunarity"].(float64)))
+	t.RawSetString("gain", golua.LNumber(args["gain"].(float64)))
+
+	if _, err := noiseBuild(t, 0); err != nil {
+		lua.Error(state, lg.Appendf("invalid noise: %s", log.LEVEL_ERROR, err))
+	}
+
+	return t
+}
+
+func noiseBuild(t *golua.LTable, depth int) (imageutil.Noise, error) {
+	/// @interface Noise
+	/// @prop type {string<noise.NoiseType>}
+
+	if depth > noiseDepthMax {
+		return nil, fmt.Errorf("noise is nested more than %d times", noiseDepthMax)
+	}
+
+	number := func(key string) (float64, error) {
+		v, ok := t.RawGetString(key).(golua.LNumber)
+		if !ok {
+			return 0, fmt.Errorf("noise field %s must be a number", key)
+		}
+		return float64(v), nil
+	}
+	source := func(key string) (imageutil.Noise, error) {
+		v, ok := t.RawGetString(key).(*golua.LTable)
+		if !ok {
+			return nil, fmt.Errorf("noise field %s must be a noise table", key)
+		}
+		return noiseBuild(v, depth+1)
+	}
+
+	seed, _ := number("seed")
+
+	switch typ := t.RawGetString("type").String(); typ {
+	case NOISE_PERLIN:
+		return &imageutil.NoisePerlin{Seed: int64(seed)}, nil
+	case NOISE_VALUE:
+		return &imageutil.NoiseValue{Seed: int64(seed)}, nil
+	case NOISE_SIMPLEX:
+		return imageutil.NewNoiseSimplex(int64(seed)), nil
+	case NOISE_WORLEY:
+		distance, err := number("distance")
+		if err != nil {
+			return nil, err
+		}
+		metric, err := number("metric")
+		if err != nil {
+			return nil, err
+		}
+		jitter, err := number("jitter")
+		if err != nil {
+			return nil, err
+		}
+
+		return &imageutil.NoiseWorley{
+			Seed:     int64(seed),
+			Distance: imageutil.WorleyDistance(distance),
+			Metric:   imageutil.WorleyMetric(metric),
+			Jitter:   jitter,
+		}, nil
+	case NOISE_FRACTAL:
+		src, err := source("source")
+		if err != nil {
+			return nil, err
+		}
+		fractal, err := number("fractal")
+		if err != nil {
+			return nil, err
+		}
+		octaves, err := number("octaves")
+		if err != nil {
+			return nil, err
+		}
+		lacunarity, err := number("lacunarity")
+		if err != nil {
+			return nil, err
+		}
+		gain, err := number("gain")
+		if err != nil {
+			return nil, err
+		}
+
+		n := &imageutil.NoiseFractal{
+			Source:     src,
+			Type:       imageutil.FractalType(fractal),
+			Octaves:    int(octaves),
+			Lacunarity: lacunarity,
+			Gain:       gain,
+		}
+		if err := n.Validate(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case NOISE_WARP:
+		src, err := source("source")
+		if err != nil {
+			return nil, err
+		}
+		warp, err := source("warp")
+		if err != nil {
+			return nil, err
+		}
+		strength, err := number("strength")
+		if err != nil {
+			return nil, err
+		}
+
+		return &imageutil.NoiseWarp{Source: src, Warp: warp, Strength: strength}, nil
+	default:
+		return nil, fmt.Errorf("unknown noise type: %s", typ)
+	}
+}
+
+func noiseImageNew(r *lua.Runner, lib *lua.Lib, lg *log.Logger, state *golua.LState, d lua.TaskData, args map[string]any, n imageutil.Noise, cx, cy float64, period int) int {
+	name := args["name"].(string)
+
+	chLog := log.NewLogger(fmt.Sprintf("image_%s", name), lg)
+	lg.Append(fmt.Sprintf("child log created: image_%s", name), log.LEVEL_INFO)
+
+	id := r.IC.AddItem(&chLog)
+
+	r.IC.Schedule(state, id, &collection.Task[collection.ItemImage]{
+		Lib:  d.Lib,
+		Name: d.Name,
+		Fn: func(i *collection.Item[collection.ItemImage]) {
+			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+
+			i.Self = &collection.ItemImage{
+				Image:    imageutil.NewImage(args["width"].(int), args["height"].(int), model),
+				Encoding: lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib),
+				Name:     name,
+				Model:    model,
+			}
+
+			noiseImageFill(i.Self.Image, n, cx, cy, period, args["normalize"].(bool), args["disableColor"].(bool), args["disableAlpha"].(bool), false)
+		},
+	})
+
+	return id
+}
+
+func noiseImageMap(r *lua.Runner, state *golua.LState, d lua.TaskData, args map[string]any, n imageutil.Noise, coef func(width, height int) (float64, float64), period int) {
+	r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+		Lib:  d.Lib,
+		Name: d.Name,
+		Fn: func(i *collection.Item[collection.ItemImage]) {
+			bounds := i.Self.Image.Bounds()
+			cx, cy := coef(bounds.Dx(), bounds.Dy())
+
+			noiseImageFill(i.Self.Image, n, cx, cy, period, args["normalize"].(bool), args["disableColor"].(bool), args["disableAlpha"].(bool), args["keep"].(bool))
+		},
+	})
+}
+
+// noiseImageFill sets each pixel from the noise in the same way as the simplex image functions.
+func noiseImageFill(img image.Image, n imageutil.Noise, cx, cy float64, period int, normalize, dc, da, keep bool) {
+	bounds := img.Bounds()
+
+	for iy := bounds.Min.Y; iy < bounds.Max.Y; iy++ {
+		for ix := bounds.Min.X; ix < bounds.Max.X; ix++ {
+			px := ix - bounds.Min.X
+			py := iy - bounds.Min.Y
+
+			v := n.Eval2(float64(px)*cx, float64(py)*cy, period)
+			if normalize {
+				v = (v + 1) / 2
+			}
+			cv := int(math.Round(255 * v))
+			cr, cg, cb, ca := imageutil.Get(img, ix, iy)
+
+			if dc {
+				if !keep {
+					cr = 255
+					cg = 255
+					cb = 255
+				}
+			} else {
+				cr = cv
+				cg = cv
+				cb = cv
+			}
+
+			if da {
+				if !keep {
+					ca = 255
+				}
+			} else {
+				ca = cv
+			}
+
+			imageutil.Set(img, ix, iy, cr, cg, cb, ca)
+		}
+	}
 }
@@ -1,6 +1,10 @@
 package lib
 
 import (
+	"image"
+	"image/color"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
 	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
 	"github.com/ArtificialLegacy/imgscal/pkg/log"
 	"github.com/ArtificialLegacy/imgscal/pkg/lua"
@@ -12,10 +16,10 @@ const LIB_PALETTE = "palette"
 /// @lib Palette
 /// @import palette
 /// @desc
-/// A collection of common color palettes.
+/// A collection of common color palettes, and tools for quantizing images to a palette.
 
 func RegisterPalette(r *lua.Runner, lg *log.Logger) {
-	lib, tab := lua.NewLib(LIB_BIT, r, r.State, lg)
+	lib, tab := lua.NewLib(LIB_PALETTE, r, r.State, lg)
 
 	/// @func dracula() -> struct<palette.Dracula>
 	/// @returns {struct<palette.Dracula>} - The Dracula color palette.
@@ -82,6 +86,296 @@ func RegisterPalette(r *lua.Runner, lg *log.Logger) {
 			state.Push(t)
 			return 1
 		})
+
+	/// @func quantize(id, name, size, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg size {int} - The max number of colors, between 1 and 256.
+	/// @arg? options {struct<palette.QuantizeOptions>}
+	/// @returns {int<collection.IMAGE>} - A new image using the paletted color model.
+	/// @desc
+	/// Creates a palette from the colors in the image, and maps the image to it.
+	/// When the image has pixels with an alpha below 128, index 0 is transparent and counts towards the size.
+	lib.CreateFunction(tab, "quantize",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "size"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			size := args["size"].(int)
+			if size < 1 || size > 256 {
+				lua.Error(state, lg.Appendf("palette size must be between 1 and 256, got: %d", log.LEVEL_ERROR, size))
+			}
+
+			quantizer, opts := quantizeOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			var img image.Image
+			var encoding imageutil.ImageEncoding
+			ready := make(chan struct{}, 1)
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					pal := imageutil.QuantizeColors(i.Self.Image, size, quantizer)
+					img = imageutil.PaletteApply(i.Self.Image, pal, opts)
+					encoding = i.Self.Encoding
+					ready <- struct{}{}
+				},
+				Fail: func(i *collection.Item[collection.ItemImage]) {
+					ready <- struct{}{}
+				},
+			})
+
+			name := args["name"].(string)
+			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+				i.Wait(ready)
+				i.Self = &collection.ItemImage{
+					Name:     name,
+					Image:    img,
+					Encoding: encoding,
+					Model:    imageutil.MODEL_PALETTED,
+				}
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func quantize_colors(id, size, quantizer?) -> []struct<image.ColorRGBA>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg size {int} - The max number of colors, between 1 and 256.
+	/// @arg? quantizer {int<palette.Quantizer>} - Defaults to palette.QUANTIZER_MEDIANCUT.
+	/// @returns {[]struct<image.ColorRGBA>}
+	/// @blocking
+	/// @desc
+	/// Creates a palette from the colors in the image, without changing the image.
+	/// When the image has pixels with an alpha below 128, the first color is transparent.
+	lib.CreateFunction(tab, "quantize_colors",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.INT, Name: "size"},
+			{Type: lua.INT, Name: "quantizer", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			size := args["size"].(int)
+			if size < 1 || size > 256 {
+				lua.Error(state, lg.Appendf("palette size must be between 1 and 256, got: %d", log.LEVEL_ERROR, size))
+			}
+			quantizer := lua.ParseEnum(args["quantizer"].(int), imageutil.QuantizerList, lib)
+
+			var pal color.Palette
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					pal = imageutil.QuantizeColors(i.Self.Image, size, quantizer)
+				},
+			})
+
+			t := state.NewTable()
+			for ind, c := range pal {
+				rgba := color.RGBAModel.Convert(c).(color.RGBA)
+				t.RawSetInt(ind+1, imageutil.RGBAColorToColorTable(state, &rgba))
+			}
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func apply(id, name, colors, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg colors {[]struct<image.Color>} - Must contain between 1 and 256 colors.
+	/// @arg? options {struct<palette.DitherOptions>}
+	/// @returns {int<collection.IMAGE>} - A new image using the paletted color model, with colors as the palette.
+	/// @desc
+	/// Maps each pixel to the perceptually closest color, using OKLab.
+	/// Pixels with an alpha below 128 use the most transparent color if there is one with an alpha below 128,
+	/// other pixels only use colors with an alpha of at least 128.
+	lib.CreateFunction(tab, "apply",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			lua.ArgArray("colors", lua.ArrayType{Type: lua.RAW_TABLE}, false),
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			pal := paletteBuild(state, lg, args["colors"].([]any))
+			opts := ditherOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			var img image.Image
+			var encoding imageutil.ImageEncoding
+			ready := make(chan struct{}, 1)
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					img = imageutil.PaletteApply(i.Self.Image, pal, opts)
+					encoding = i.Self.Encoding
+					ready <- struct{}{}
+				},
+				Fail: func(i *collection.Item[collection.ItemImage]) {
+					ready <- struct{}{}
+				},
+			})
+
+			name := args["name"].(string)
+			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+				i.Wait(ready)
+				i.Self = &collection.ItemImage{
+					Name:     name,
+					Image:    img,
+					Encoding: encoding,
+					Model:    imageutil.MODEL_PALETTED,
+				}
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func swap(id, old, new)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg old {[]struct<image.Color>}
+	/// @arg new {[]struct<image.Color>} - Must be the same length as old.
+	/// @desc
+	/// Replaces each color in old with the color at the same index in new, colors must match exactly.
+	/// For paletted images the palette is changed, otherwise each pixel is replaced.
+	lib.CreateFunction(tab, "swap",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			lua.ArgArray("old", lua.ArrayType{Type: lua.RAW_TABLE}, false),
+			lua.ArgArray("new", lua.ArrayType{Type: lua.RAW_TABLE}, false),
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			oldColors := args["old"].([]any)
+			newColors := args["new"].([]any)
+			if len(oldColors) != len(newColors) {
+				lua.Error(state, lg.Appendf("palette swap requires the same number of colors, got: %d and %d", log.LEVEL_ERROR, len(oldColors), len(newColors)))
+			}
+
+			from := make([]color.NRGBA, len(oldColors))
+			to := make([]color.NRGBA, len(newColors))
+			for ind := range oldColors {
+				cr, cg, cb, ca := imageutil.ColorTableToRGBA(oldColors[ind].(*golua.LTable))
+				from[ind] = color.NRGBA{cr, cg, cb, ca}
+				cr, cg, cb, ca = imageutil.ColorTableToRGBA(newColors[ind].(*golua.LTable))
+				to[ind] = color.NRGBA{cr, cg, cb, ca}
+			}
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					imageutil.PaletteSwap(i.Self.Image, from, to)
+				},
+			})
+			return 0
+		})
+
+	/// @constants Quantizer {int}
+	/// @const QUANTIZER_MEDIANCUT
+	/// @const QUANTIZER_KMEANS - Refines the median cut palette with k-means in OKLab, slower but more accurate.
+	tab.RawSetString("QUANTIZER_MEDIANCUT", golua.LNumber(imageutil.QUANTIZER_MEDIANCUT))
+	tab.RawSetString("QUANTIZER_KMEANS", golua.LNumber(imageutil.QUANTIZER_KMEANS))
+
+	/// @constants Dither {int}
+	/// @const DITHER_NONE
+	/// @const DITHER_FLOYDSTEINBERG - Error diffusion.
+	/// @const DITHER_ATKINSON - Error diffusion that only spreads 3/4 of the error, keeping more contrast.
+	/// @const DITHER_BAYER - Ordered dithering with a Bayer matrix.
+	/// @const DITHER_BLUENOISE - Ordered dithering with a blue noise texture, avoiding the patterns of Bayer.
+	tab.RawSetString("DITHER_NONE", golua.LNumber(imageutil.DITHER_NONE))
+	tab.RawSetString("DITHER_FLOYDSTEINBERG", golua.LNumber(imageutil.DITHER_FLOYDSTEINBERG))
+	tab.RawSetString("DITHER_ATKINSON", golua.LNumber(imageutil.DITHER_ATKINSON))
+	tab.RawSetString("DITHER_BAYER", golua.LNumber(imageutil.DITHER_BAYER))
+	tab.RawSetString("DITHER_BLUENOISE", golua.LNumber(imageutil.DITHER_BLUENOISE))
+}
+
+func paletteBuild(state *golua.LState, lg *log.Logger, colors []any) color.Palette {
+	if len(colors) < 1 || len(colors) > 256 {
+		lua.Error(state, lg.Appendf("palette must contain between 1 and 256 colors, got: %d", log.LEVEL_ERROR, len(colors)))
+	}
+
+	pal := make(color.Palette, len(colors))
+	for ind, c := range colors {
+		cr, cg, cb, ca := imageutil.ColorTableToRGBA(c.(*golua.LTable))
+		pal[ind] = color.NRGBA{cr, cg, cb, ca}
+	}
+
+	return pal
+}
+
+func ditherOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.DitherOptions {
+	/// @struct DitherOptions
+	/// @prop dither {int<palette.Dither>} - Defaults to palette.DITHER_NONE.
+	/// @prop strength {float} - Between 0 and 1, scales the diffused error or the spread of ordered dithering. Defaults to 1.
+	/// @prop bayer_size {int} - The size of the Bayer matrix, either 2, 4 or 8. Defaults to 4.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultDitherOptions()
+	ditherOptionsParse(state, lg, t, opts, nil)
+	return opts
+}
+
+func quantizeOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) (imageutil.Quantizer, *imageutil.DitherOptions) {
+	/// @struct QuantizeOptions
+	/// @prop quantizer {int<palette.Quantizer>} - Defaults to palette.QUANTIZER_MEDIANCUT.
+	/// @prop dither {int<palette.Dither>} - Defaults to palette.DITHER_NONE.
+	/// @prop strength {float} - Between 0 and 1, scales the diffused error or the spread of ordered dithering. Defaults to 1.
+	/// @prop bayer_size {int} - The size of the Bayer matrix, either 2, 4 or 8. Defaults to 4.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	quantizer := imageutil.QUANTIZER_MEDIANCUT
+	opts := imageutil.DefaultDitherOptions()
+	ditherOptionsParse(state, lg, t, opts, &quantizer)
+	return quantizer, opts
+}
+
+// ditherOptionsParse fills opts from the table, the quantizer key is only allowed when quantizer is not nil.
+func ditherOptionsParse(state *golua.LState, lg *log.Logger, t *golua.LTable, opts *imageutil.DitherOptions, quantizer *imageutil.Quantizer) {
+	number := func(key string, v golua.LValue) float64 {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("palette option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return float64(n)
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "quantizer":
+			if quantizer == nil {
+				lua.Error(state, lg.Appendf("unknown palette option: %s", log.LEVEL_ERROR, key))
+			}
+			q := int(number(key, v))
+			if q < 0 || q >= len(imageutil.QuantizerList) {
+				lua.Error(state, lg.Appendf("invalid quantizer: %d", log.LEVEL_ERROR, q))
+			}
+			*quantizer = imageutil.Quantizer(q)
+		case "dither":
+			opts.Dither = imageutil.Dither(number(key, v))
+		case "strength":
+			opts.Strength = number(key, v)
+		case "bayer_size":
+			opts.BayerSize = int(number(key, v))
+		default:
+			lua.Error(state, lg.Appendf("unknown palette option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid palette options: %s", log.LEVEL_ERROR, err))
+	}
 }
 
 func draculaTable(state *golua.LState) *golua.LTable {
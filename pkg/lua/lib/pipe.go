@@ -19,6 +19,8 @@ const LIB_PIPE = "pipe"
 /// @import pipe
 /// @desc
 /// Library for piping data in and out of a cli workflow.
+/// @section
+/// Cannot be used in batch mode, as every run in the batch would share stdin and stdout.
 
 func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 	lib, tab := lua.NewLib(LIB_PIPE, r, r.State, lg)
@@ -28,8 +30,8 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 	lib.CreateFunction(tab, "in_string",
 		[]lua.Arg{},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
 			b, err := io.ReadAll(os.Stdin)
@@ -46,8 +48,8 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 	lib.CreateFunction(tab, "in_bytes",
 		[]lua.Arg{},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
 			b, err := io.ReadAll(os.Stdin)
@@ -66,7 +68,7 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 
 	/// @func in_image(name, encoding, model?) -> int<collection.IMAGE>
 	/// @arg name {string}
-	/// @arg encoding {int<image.Encoding>}
+	/// @arg encoding {int<image.Encoding>} - Use image.ENCODING_AUTO to detect the encoding from the data.
 	/// @arg? model {int<image.ColorModel>} - Used only to specify default when there is an unsupported color model.
 	/// @returns {int<collection.IMAGE>}
 	lib.CreateFunction(tab, "in_image",
@@ -76,11 +78,12 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "model", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
-			b, err := io.ReadAll(os.Stdin)
+			limits := decodeLimits(r)
+			b, err := limits.ReadAll(os.Stdin)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to read from stdin: %s", log.LEVEL_ERROR, err))
 			}
@@ -89,8 +92,12 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
 			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
 
+			if encoding == imageutil.ENCODING_AUTO {
+				encoding = imageutil.DetectEncoding(b)
+			}
+
 			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
-				img, err := imageutil.Decode(strings.NewReader(string(b)), encoding)
+				img, err := imageutil.DecodeLimited(strings.NewReader(string(b)), encoding, limits)
 				if err != nil {
 					lua.Error(state, i.Lg.Appendf("piped data is an invalid image: %s", log.LEVEL_ERROR, err))
 				}
@@ -119,11 +126,12 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "model", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
-			b, err := io.ReadAll(os.Stdin)
+			limits := decodeLimits(r)
+			b, err := limits.ReadAll(os.Stdin)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to read from stdin: %s", log.LEVEL_ERROR, err))
 			}
@@ -131,7 +139,7 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
 			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
 
-			img, err := imageutil.Decode(strings.NewReader(string(b)), encoding)
+			img, err := imageutil.DecodeLimited(strings.NewReader(string(b)), encoding, limits)
 			if err != nil {
 				lua.Error(state, lg.Appendf("piped data is an invalid image: %s", log.LEVEL_ERROR, err))
 			}
@@ -154,8 +162,8 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.STRING, Name: "str"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
 			str := args["str"].(string)
@@ -175,8 +183,8 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			lua.ArgArray("b", lua.ArrayType{Type: lua.INT}, false),
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
 			bl := args["b"].([]any)
@@ -199,8 +207,8 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "id"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
 			id := args["id"].(int)
@@ -209,7 +217,7 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					err := imageutil.Encode(os.Stdout, i.Self.Image, i.Self.Encoding)
+					err := imageutil.Encode(os.Stdout, i.Self.Image, i.Self.Encoding, nil)
 					if err != nil {
 						lua.Error(state, i.Lg.Appendf("failed to encode image: %s", log.LEVEL_ERROR, err))
 					}
@@ -228,8 +236,8 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 			{Type: lua.INT, Name: "encoding"},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
-			if !r.CLIMode {
-				lua.Error(state, lg.Append("can only use the pipe library in cli mode", log.LEVEL_ERROR))
+			if !r.CLIMode || r.BatchMode {
+				lua.Error(state, lg.Append("can only use the pipe library in cli mode, outside of a batch", log.LEVEL_ERROR))
 			}
 
 			id := args["id"].(int)
@@ -240,7 +248,7 @@ func RegisterPipe(r *lua.Runner, lg *log.Logger) {
 				lua.Error(state, lg.Appendf("failed to retrieve image: %s", log.LEVEL_ERROR, err))
 			}
 
-			err = imageutil.Encode(os.Stdout, item.Image, encoding)
+			err = imageutil.Encode(os.Stdout, item.Image, encoding, nil)
 			if err != nil {
 				lua.Error(state, lg.Appendf("failed to encode image: %s", log.LEVEL_ERROR, err))
 			}
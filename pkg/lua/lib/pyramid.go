@@ -0,0 +1,277 @@
+package lib
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua"
+	golua "github.com/yuin/gopher-lua"
+)
+
+const LIB_PYRAMID = "pyramid"
+
+/// @lib Pyramid
+/// @import pyramid
+/// @desc
+/// Library for building mipmaps and tiled image pyramids, such as Deep Zoom images and XYZ map tiles.
+/// @section
+/// Each level is resampled from the previous one at half the size, rounding up.
+/// Tiles are written to disk as they are cut, so only the current level is kept in memory.
+
+func RegisterPyramid(r *lua.Runner, lg *log.Logger) {
+	lib, tab := lua.NewLib(LIB_PYRAMID, r, r.State, lg)
+
+	/// @func mipmaps(id, name, options?) -> []int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string} - Each level is named with the level index appended.
+	/// @arg? options {struct<pyramid.MipOptions>}
+	/// @returns {[]int<collection.IMAGE>} - Starts with a copy of the source, down to 1x1 unless the levels are limited.
+	/// @blocking
+	/// @desc
+	/// Each level uses the encoding and color model of the source.
+	lib.CreateFunction(tab, "mipmaps",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := mipOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			var chain []*image.NRGBA
+			var encoding imageutil.ImageEncoding
+			var model imageutil.ColorModel
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					var err error
+					chain, err = imageutil.MipChain(i.Self.Image, opts)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to build mipmaps: %s", log.LEVEL_ERROR, err))
+					}
+
+					encoding = i.Self.Encoding
+					model = i.Self.Model
+				},
+			})
+
+			name := args["name"].(string)
+			ids := state.NewTable()
+
+			for ind, level := range chain {
+				levelName := fmt.Sprintf("%s_%d", name, ind)
+				ids.RawSetInt(ind+1, golua.LNumber(r.IC.ScheduleAdd(state, levelName, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+					imghere, mhere := imageutil.Limit(level, model)
+
+					i.Self = &collection.ItemImage{
+						Name:     levelName,
+						Image:    imghere,
+						Encoding: encoding,
+						Model:    mhere,
+					}
+				})))
+			}
+
+			state.Push(ids)
+			return 1
+		})
+
+	/// @func dzi(id, path, name, options?)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg path {string} - The directory to write to, it is created if it does not exist.
+	/// @arg name {string} - Writes name.dzi, with the tiles in name_files/level/col_row.
+	/// @arg? options {struct<pyramid.DZIOptions>}
+	/// @desc
+	/// Writes a Deep Zoom image, where level 0 is 1x1 and the last level is the full size.
+	lib.CreateFunction(tab, "dzi",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := dziOptionsBuild(state, lg, lib, args["options"].(*golua.LTable))
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					err := imageutil.DZIWrite(i.Self.Image, args["path"].(string), args["name"].(string), opts)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to write dzi: %s", log.LEVEL_ERROR, err))
+					}
+				},
+			})
+
+			return 0
+		})
+
+	/// @func xyz(id, path, options?)
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg path {string} - The directory to write to, tiles are written as z/x/y.
+	/// @arg? options {struct<pyramid.XYZOptions>}
+	/// @desc
+	/// Writes slippy map tiles, with the image in the top left of the map.
+	/// Zoom 0 fits the whole image in a single tile, and the last zoom is the full size.
+	/// Tiles are always the full tile size, partial tiles are padded with transparency.
+	lib.CreateFunction(tab, "xyz",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "path"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := xyzOptionsBuild(state, lg, lib, args["options"].(*golua.LTable))
+
+			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					err := imageutil.XYZWrite(i.Self.Image, args["path"].(string), opts)
+					if err != nil {
+						lua.Error(state, i.Lg.Appendf("failed to write xyz tiles: %s", log.LEVEL_ERROR, err))
+					}
+				},
+			})
+
+			return 0
+		})
+}
+
+func pyramidNumber(state *golua.LState, lg *log.Logger, key string, v golua.LValue) int {
+	n, ok := v.(golua.LNumber)
+	if !ok {
+		lua.Error(state, lg.Appendf("pyramid option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+	}
+	return int(n)
+}
+
+// pyramidOption sets the options shared by every pyramid, returning false for other keys.
+func pyramidOption(state *golua.LState, lg *log.Logger, opts *imageutil.PyramidOptions, key string, v golua.LValue) bool {
+	switch key {
+	case "resampling":
+		resampling := pyramidNumber(state, lg, key, v)
+		if resampling < 0 || resampling >= len(samplers) {
+			lua.Error(state, lg.Appendf("invalid resampling: %d", log.LEVEL_ERROR, resampling))
+		}
+		opts.Resampling = samplers[resampling]
+	case "gamma_correct":
+		b, ok := v.(golua.LBool)
+		if !ok {
+			lua.Error(state, lg.Appendf("pyramid option %s must be a bool, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		opts.GammaCorrect = bool(b)
+	default:
+		return false
+	}
+
+	return true
+}
+
+func mipOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.MipOptions {
+	/// @struct MipOptions
+	/// @prop resampling {int<filter.Resampling>} - Defaults to filter.RESAMPLING_LANCZOS.
+	/// @prop gamma_correct {bool} - Downsample in linear light. Defaults to true.
+	/// @prop levels {int} - The number of levels including the source, 0 continues until 1x1. Defaults to 0.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultMipOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+		if pyramidOption(state, lg, &opts.PyramidOptions, key, v) {
+			return
+		}
+
+		switch key {
+		case "levels":
+			opts.Levels = pyramidNumber(state, lg, key, v)
+		default:
+			lua.Error(state, lg.Appendf("unknown mip option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid mip options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func dziOptionsBuild(state *golua.LState, lg *log.Logger, lib *lua.Lib, t *golua.LTable) imageutil.DZIOptions {
+	/// @struct DZIOptions
+	/// @prop resampling {int<filter.Resampling>} - Defaults to filter.RESAMPLING_LANCZOS.
+	/// @prop gamma_correct {bool} - Downsample in linear light. Defaults to true.
+	/// @prop tile_size {int} - The size of each tile without the overlap. Defaults to 254.
+	/// @prop overlap {int} - Pixels shared with each neighboring tile. Defaults to 1.
+	/// @prop encoding {int<image.Encoding>} - Defaults to image.ENCODING_PNG.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultDZIOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+		if pyramidOption(state, lg, &opts.PyramidOptions, key, v) {
+			return
+		}
+
+		switch key {
+		case "tile_size":
+			opts.TileSize = pyramidNumber(state, lg, key, v)
+		case "overlap":
+			opts.Overlap = pyramidNumber(state, lg, key, v)
+		case "encoding":
+			opts.Encoding = lua.ParseEnum(pyramidNumber(state, lg, key, v), imageutil.EncodingList, lib)
+		default:
+			lua.Error(state, lg.Appendf("unknown dzi option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid dzi options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func xyzOptionsBuild(state *golua.LState, lg *log.Logger, lib *lua.Lib, t *golua.LTable) imageutil.XYZOptions {
+	/// @struct XYZOptions
+	/// @prop resampling {int<filter.Resampling>} - Defaults to filter.RESAMPLING_LANCZOS.
+	/// @prop gamma_correct {bool} - Downsample in linear light. Defaults to true.
+	/// @prop tile_size {int} - Defaults to 256.
+	/// @prop encoding {int<image.Encoding>} - Defaults to image.ENCODING_PNG.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultXYZOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+		if pyramidOption(state, lg, &opts.PyramidOptions, key, v) {
+			return
+		}
+
+		switch key {
+		case "tile_size":
+			opts.TileSize = pyramidNumber(state, lg, key, v)
+		case "encoding":
+			opts.Encoding = lua.ParseEnum(pyramidNumber(state, lg, key, v), imageutil.EncodingList, lib)
+		default:
+			lua.Error(state, lg.Appendf("unknown xyz option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid xyz options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
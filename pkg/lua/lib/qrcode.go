@@ -96,7 +96,7 @@ func RegisterQRCode(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-imgReady
+					i.Wait(imgReady)
 					i.Self = &collection.ItemImage{
 						Image:    img,
 						Name:     name,
@@ -3,6 +3,7 @@ package lib
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"sync"
 
 	"github.com/ArtificialLegacy/imgscal/pkg/collection"
@@ -358,7 +359,7 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 					Fn: func(i *collection.Item[collection.ItemImage]) {
 						imgList[ind] = i.Self.Image
 						wg.Done()
-						<-finish
+						i.Wait(finish)
 					},
 				})
 			}
@@ -377,7 +378,7 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
 					encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
 
-					wg.Wait()
+					i.WaitGroup(&wg)
 
 					img := imageutil.FramesToSpritesheetTable(imgList, model, sheet)
 					i.Self = &collection.ItemImage{
@@ -429,7 +430,7 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 					Fn: func(i *collection.Item[collection.ItemImage]) {
 						imgList[ind] = i.Self.Image
 						wg.Done()
-						<-finish
+						i.Wait(finish)
 					},
 				})
 			}
@@ -440,7 +441,7 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
 
-					wg.Wait()
+					i.WaitGroup(&wg)
 
 					img := imageutil.FramesToSpritesheetTable(imgList, model, sheet)
 					i.Self = &collection.ItemImage{
@@ -483,8 +484,9 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 			var model imageutil.ColorModel
 
 			var imgs []image.Image
-			ready := make(chan struct{})
-			finish := make(chan struct{})
+			// buffered so the source task can signal while holding its worker, before the new image's task has started.
+			ready := make(chan struct{}, 2)
+			finish := make(chan struct{}, 2)
 
 			r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
 				Lib:  d.Lib,
@@ -498,7 +500,7 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 					model = i.Self.Model
 
 					ready <- struct{}{}
-					<-finish
+					i.Wait(finish)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					ready <- struct{}{}
@@ -518,7 +520,7 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					sheet := args["sheetout"].(map[string]any)
 
-					<-ready
+					i.Wait(ready)
 
 					img := imageutil.FramesToSpritesheetTable(imgs, model, sheet)
 					i.Self = &collection.ItemImage{
@@ -590,6 +592,572 @@ func RegisterSpritesheet(r *lua.Runner, lg *log.Logger) {
 
 			return 0
 		})
+
+	/// @func detect(id, options?) -> []struct<spritesheet.Bounds>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg? options {struct<spritesheet.DetectOptions>}
+	/// @returns {[]struct<spritesheet.Bounds>}
+	/// @blocking
+	/// @desc
+	/// Finds the bounds of each sprite in a spritesheet that isn't laid out in a grid.
+	/// Sprites are connected regions of non background pixels, sorted in rows from top to bottom, then left to right.
+	lib.CreateFunction(tab, "detect",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := spriteDetectOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			var rects []image.Rectangle
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					rects = imageutil.SpritesheetDetect(i.Self.Image, opts)
+				},
+			})
+
+			t := state.NewTable()
+			for ind, rect := range rects {
+				t.RawSetInt(ind+1, spriteBoundsTable(state, rect))
+			}
+
+			state.Push(t)
+			return 1
+		})
+
+	/// @func detect_frames(id, name, options?, nocopy?) -> []int<collection.IMAGE>, []struct<spritesheet.Bounds>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string} - Each frame is named with the frame index appended.
+	/// @arg? options {struct<spritesheet.DetectOptions>}
+	/// @arg? nocopy {bool}
+	/// @returns {[]int<collection.IMAGE>}
+	/// @returns {[]struct<spritesheet.Bounds>}
+	/// @blocking
+	/// @desc
+	/// Same as detect, but also splits each sprite into a new image.
+	lib.CreateFunction(tab, "detect_frames",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+			{Type: lua.BOOL, Name: "nocopy", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := spriteDetectOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			var rects []image.Rectangle
+			var imgs []image.Image
+			var encoding imageutil.ImageEncoding
+			var model imageutil.ColorModel
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					rects = imageutil.SpritesheetDetect(i.Self.Image, opts)
+					for _, rect := range rects {
+						imgs = append(imgs, imageutil.SubImage(i.Self.Image, rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y, !args["nocopy"].(bool)))
+					}
+
+					encoding = i.Self.Encoding
+					model = i.Self.Model
+				},
+			})
+
+			name := args["name"].(string)
+			ids := state.NewTable()
+			bounds := state.NewTable()
+
+			for ind, img := range imgs {
+				frameName := fmt.Sprintf("%s_%d", name, ind)
+				ids.RawSetInt(ind+1, golua.LNumber(r.IC.ScheduleAdd(state, frameName, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+					i.Self = &collection.ItemImage{
+						Name:     frameName,
+						Image:    img,
+						Encoding: encoding,
+						Model:    model,
+					}
+				})))
+				bounds.RawSetInt(ind+1, spriteBoundsTable(state, rects[ind]))
+			}
+
+			state.Push(ids)
+			state.Push(bounds)
+			return 2
+		})
+
+	/// @func trim(id, name, threshold?) -> int<collection.IMAGE>, struct<spritesheet.Trim>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg? threshold {int} - The max alpha of a pixel to be trimmed, defaults to 0.
+	/// @returns {int<collection.IMAGE>}
+	/// @returns {struct<spritesheet.Trim>}
+	/// @blocking
+	/// @desc
+	/// Crops the transparent border of an image.
+	/// A fully transparent image is trimmed to a single pixel.
+	lib.CreateFunction(tab, "trim",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "threshold", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			threshold := args["threshold"].(int)
+			if threshold < 0 || threshold > 255 {
+				lua.Error(state, lg.Appendf("trim threshold must be between 0 and 255, got: %d", log.LEVEL_ERROR, threshold))
+			}
+
+			var img image.Image
+			var rect, source image.Rectangle
+			var encoding imageutil.ImageEncoding
+			var model imageutil.ColorModel
+
+			<-r.IC.Schedule(state, args["id"].(int), &collection.Task[collection.ItemImage]{
+				Lib:  d.Lib,
+				Name: d.Name,
+				Fn: func(i *collection.Item[collection.ItemImage]) {
+					source = i.Self.Image.Bounds()
+					rect = imageutil.SpriteTrim(i.Self.Image, uint8(threshold))
+					if rect.Empty() {
+						rect = image.Rect(source.Min.X, source.Min.Y, source.Min.X+1, source.Min.Y+1)
+					}
+
+					img = imageutil.SubImage(i.Self.Image, rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y, true)
+					encoding = i.Self.Encoding
+					model = i.Self.Model
+				},
+			})
+
+			name := args["name"].(string)
+			id := r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+				i.Self = &collection.ItemImage{
+					Name:     name,
+					Image:    img,
+					Encoding: encoding,
+					Model:    model,
+				}
+			})
+
+			/// @struct Trim
+			/// @prop offset_x {int} - Where the trimmed image begins in the source image.
+			/// @prop offset_y {int}
+			/// @prop width {int} - The size of the trimmed image.
+			/// @prop height {int}
+			/// @prop source_width {int} - The size of the source image.
+			/// @prop source_height {int}
+
+			t := state.NewTable()
+			t.RawSetString("offset_x", golua.LNumber(rect.Min.X-source.Min.X))
+			t.RawSetString("offset_y", golua.LNumber(rect.Min.Y-source.Min.Y))
+			t.RawSetString("width", golua.LNumber(rect.Dx()))
+			t.RawSetString("height", golua.LNumber(rect.Dy()))
+			t.RawSetString("source_width", golua.LNumber(source.Dx()))
+			t.RawSetString("source_height", golua.LNumber(source.Dy()))
+
+			state.Push(golua.LNumber(id))
+			state.Push(t)
+			return 2
+		})
+
+	/// @func atlas_pack(ids, name, model, encoding, options?) -> struct<spritesheet.Atlas>
+	/// @arg ids {[]int<collection.IMAGE>} - The name of each image is used as the sprite name.
+	/// @arg name {string} - Each page is named with the page index appended.
+	/// @arg model {int<image.ColorModel>}
+	/// @arg encoding {int<image.Encoding>}
+	/// @arg? options {struct<spritesheet.AtlasOptions>}
+	/// @returns {struct<spritesheet.Atlas>}
+	/// @blocking
+	/// @desc
+	/// Packs images of any size into one or more atlas pages.
+	lib.CreateFunction(tab, "atlas_pack",
+		[]lua.Arg{
+			lua.ArgArray("ids", lua.ArrayType{Type: lua.INT}, false),
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "model"},
+			{Type: lua.INT, Name: "encoding"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := atlasOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			ids := args["ids"].([]any)
+			imgs := make([]image.Image, len(ids))
+			names := make([]string, len(ids))
+
+			for ind, id := range ids {
+				<-r.IC.Schedule(state, id.(int), &collection.Task[collection.ItemImage]{
+					Lib:  d.Lib,
+					Name: d.Name,
+					Fn: func(i *collection.Item[collection.ItemImage]) {
+						imgs[ind] = i.Self.Image
+						names[ind] = i.Self.Name
+					},
+				})
+			}
+
+			atlas, pages, err := imageutil.AtlasPack(imgs, names, opts)
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to pack atlas: %s", log.LEVEL_ERROR, err))
+			}
+
+			name := args["name"].(string)
+			model := lua.ParseEnum(args["model"].(int), imageutil.ModelList, lib)
+			encoding := lua.ParseEnum(args["encoding"].(int), imageutil.EncodingList, lib)
+
+			pageIds := make([]int, len(pages))
+			for ind, page := range pages {
+				pageName := fmt.Sprintf("%s_%d", name, ind)
+				atlas.Pages[ind].Name = pageName + imageutil.EncodingExtension(encoding)
+
+				pageIds[ind] = r.IC.ScheduleAdd(state, pageName, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+					imghere, mhere := imageutil.Limit(page, model)
+
+					i.Self = &collection.ItemImage{
+						Name:     pageName,
+						Image:    imghere,
+						Encoding: encoding,
+						Model:    mhere,
+					}
+				})
+			}
+
+			state.Push(atlasTable(state, atlas, pageIds))
+			return 1
+		})
+
+	/// @func atlas_json(atlas, page, array?) -> string
+	/// @arg atlas {struct<spritesheet.Atlas>}
+	/// @arg page {int} - The index of the page to export, starting at 1.
+	/// @arg? array {bool} - Use the TexturePacker array format instead of the hash format.
+	/// @returns {string}
+	/// @desc
+	/// TexturePacker JSON only stores a single page, so each page is exported separately.
+	/// Rotated sprites must be packed with spritesheet.ATLASROTATION_CW.
+	lib.CreateFunction(tab, "atlas_json",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "atlas"},
+			{Type: lua.INT, Name: "page"},
+			{Type: lua.BOOL, Name: "array", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			atlas := atlasBuild(state, lg, args["atlas"].(*golua.LTable))
+
+			data, err := atlas.JSON(args["page"].(int)-1, args["array"].(bool))
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to export atlas: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(data))
+			return 1
+		})
+
+	/// @func atlas_libgdx(atlas) -> string
+	/// @arg atlas {struct<spritesheet.Atlas>}
+	/// @returns {string}
+	/// @desc
+	/// Exports all pages as a LibGDX .atlas file.
+	/// Rotated sprites must be packed with spritesheet.ATLASROTATION_CCW.
+	lib.CreateFunction(tab, "atlas_libgdx",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "atlas"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			atlas := atlasBuild(state, lg, args["atlas"].(*golua.LTable))
+
+			data, err := atlas.LibGDX()
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to export atlas: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(data))
+			return 1
+		})
+
+	/// @func atlas_lua(atlas) -> string
+	/// @arg atlas {struct<spritesheet.Atlas>}
+	/// @returns {string}
+	/// @desc
+	/// Exports the atlas as lua source returning a table, with the sprites keyed by name.
+	lib.CreateFunction(tab, "atlas_lua",
+		[]lua.Arg{
+			{Type: lua.RAW_TABLE, Name: "atlas"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			atlas := atlasBuild(state, lg, args["atlas"].(*golua.LTable))
+
+			data, err := atlas.Lua()
+			if err != nil {
+				lua.Error(state, lg.Appendf("failed to export atlas: %s", log.LEVEL_ERROR, err))
+			}
+
+			state.Push(golua.LString(data))
+			return 1
+		})
+
+	/// @constants AtlasAlgorithm {int}
+	/// @const ATLASALGORITHM_MAXRECTS
+	/// @const ATLASALGORITHM_SKYLINE
+	tab.RawSetString("ATLASALGORITHM_MAXRECTS", golua.LNumber(imageutil.ATLASALGORITHM_MAXRECTS))
+	tab.RawSetString("ATLASALGORITHM_SKYLINE", golua.LNumber(imageutil.ATLASALGORITHM_SKYLINE))
+
+	/// @constants AtlasRotation {int}
+	/// @const ATLASROTATION_NONE
+	/// @const ATLASROTATION_CW - Used by TexturePacker JSON.
+	/// @const ATLASROTATION_CCW - Used by LibGDX.
+	tab.RawSetString("ATLASROTATION_NONE", golua.LNumber(imageutil.ATLASROTATION_NONE))
+	tab.RawSetString("ATLASROTATION_CW", golua.LNumber(imageutil.ATLASROTATION_CW))
+	tab.RawSetString("ATLASROTATION_CCW", golua.LNumber(imageutil.ATLASROTATION_CCW))
+}
+
+func spriteDetectOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.SpriteDetectOptions {
+	/// @struct DetectOptions
+	/// @prop alpha_threshold {int} - The max alpha of a background pixel, defaults to 0.
+	/// @prop key {struct<image.Color>} - A background color, used in addition to transparency.
+	/// @prop key_tolerance {int} - The max difference of each channel from the key, defaults to 0.
+	/// @prop merge_distance {int} - Sprites with a gap smaller than this are merged, overlapping sprites are always merged. Defaults to 0.
+	/// @prop min_width {int} - Smaller sprites are ignored, defaults to 1.
+	/// @prop min_height {int} - Defaults to 1.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultSpriteDetectOptions()
+
+	number := func(key string, v golua.LValue) int {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("detect option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return int(n)
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "alpha_threshold":
+			threshold := number(key, v)
+			if threshold < 0 || threshold > 255 {
+				lua.Error(state, lg.Appendf("detect option alpha_threshold must be between 0 and 255, got: %d", log.LEVEL_ERROR, threshold))
+			}
+			opts.AlphaThreshold = uint8(threshold)
+		case "key":
+			c, ok := v.(*golua.LTable)
+			if !ok {
+				lua.Error(state, lg.Appendf("detect option key must be a color, got: %s", log.LEVEL_ERROR, v.Type()))
+			}
+			cr, cg, cb, ca := imageutil.ColorTableToRGBA(c)
+			opts.UseKey = true
+			opts.Key = color.NRGBA{cr, cg, cb, ca}
+		case "key_tolerance":
+			opts.KeyTolerance = number(key, v)
+		case "merge_distance":
+			opts.MergeDistance = number(key, v)
+		case "min_width":
+			opts.MinWidth = number(key, v)
+		case "min_height":
+			opts.MinHeight = number(key, v)
+		default:
+			lua.Error(state, lg.Appendf("unknown detect option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	return opts
+}
+
+func spriteBoundsTable(state *golua.LState, rect image.Rectangle) *golua.LTable {
+	/// @struct Bounds
+	/// @prop x {int}
+	/// @prop y {int}
+	/// @prop width {int}
+	/// @prop height {int}
+
+	t := state.NewTable()
+	t.RawSetString("x", golua.LNumber(rect.Min.X))
+	t.RawSetString("y", golua.LNumber(rect.Min.Y))
+	t.RawSetString("width", golua.LNumber(rect.Dx()))
+	t.RawSetString("height", golua.LNumber(rect.Dy()))
+
+	return t
+}
+
+func atlasOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.AtlasOptions {
+	/// @struct AtlasOptions
+	/// @prop algorithm {int<spritesheet.AtlasAlgorithm>} - Defaults to spritesheet.ATLASALGORITHM_MAXRECTS.
+	/// @prop max_width {int} - Defaults to 2048.
+	/// @prop max_height {int} - Defaults to 2048.
+	/// @prop padding {int} - Space between sprites, defaults to 0.
+	/// @prop extrude {int} - Repeats the edge pixels of each sprite outwards, defaults to 0.
+	/// @prop power_of_two {bool} - Defaults to false.
+	/// @prop rotation {int<spritesheet.AtlasRotation>} - Defaults to spritesheet.ATLASROTATION_NONE.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultAtlasOptions()
+
+	number := func(key string, v golua.LValue) int {
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("atlas option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+		return int(n)
+	}
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "algorithm":
+			opts.Algorithm = imageutil.AtlasAlgorithm(number(key, v))
+		case "max_width":
+			opts.MaxWidth = number(key, v)
+		case "max_height":
+			opts.MaxHeight = number(key, v)
+		case "padding":
+			opts.Padding = number(key, v)
+		case "extrude":
+			opts.Extrude = number(key, v)
+		case "power_of_two":
+			b, ok := v.(golua.LBool)
+			if !ok {
+				lua.Error(state, lg.Appendf("atlas option %s must be a bool, got: %s", log.LEVEL_ERROR, key, v.Type()))
+			}
+			opts.PowerOfTwo = bool(b)
+		case "rotation":
+			opts.Rotation = imageutil.AtlasRotation(number(key, v))
+		default:
+			lua.Error(state, lg.Appendf("unknown atlas option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid atlas options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func atlasTable(state *golua.LState, atlas *imageutil.Atlas, pageIds []int) *golua.LTable {
+	/// @struct Atlas
+	/// @prop pages {[]struct<spritesheet.AtlasPage>}
+	/// @prop sprites {[]struct<spritesheet.AtlasSprite>} - In the same order as the ids given.
+	/// @prop rotation {int<spritesheet.AtlasRotation>}
+
+	/// @struct AtlasPage
+	/// @prop img {int<collection.IMAGE>}
+	/// @prop name {string} - The file name used when exporting, defaults to the image name with the encoding's extension.
+	/// @prop width {int}
+	/// @prop height {int}
+
+	/// @struct AtlasSprite
+	/// @prop name {string}
+	/// @prop page {int} - Index into pages.
+	/// @prop x {int}
+	/// @prop y {int}
+	/// @prop width {int} - The width before rotation.
+	/// @prop height {int} - The height before rotation.
+	/// @prop rotated {bool}
+	/// @prop offset_x {int} - Where the sprite was trimmed from in the source image, set from spritesheet.trim to export trimmed sprites.
+	/// @prop offset_y {int}
+	/// @prop source_width {int} - The size of the source image before it was trimmed.
+	/// @prop source_height {int}
+
+	t := state.NewTable()
+
+	pages := state.NewTable()
+	for i, p := range atlas.Pages {
+		pt := state.NewTable()
+		pt.RawSetString("img", golua.LNumber(pageIds[i]))
+		pt.RawSetString("name", golua.LString(p.Name))
+		pt.RawSetString("width", golua.LNumber(p.Width))
+		pt.RawSetString("height", golua.LNumber(p.Height))
+		pages.RawSetInt(i+1, pt)
+	}
+	t.RawSetString("pages", pages)
+
+	sprites := state.NewTable()
+	for i, s := range atlas.Sprites {
+		st := state.NewTable()
+		st.RawSetString("name", golua.LString(s.Name))
+		st.RawSetString("page", golua.LNumber(s.Page+1))
+		st.RawSetString("x", golua.LNumber(s.X))
+		st.RawSetString("y", golua.LNumber(s.Y))
+		st.RawSetString("width", golua.LNumber(s.Width))
+		st.RawSetString("height", golua.LNumber(s.Height))
+		st.RawSetString("rotated", golua.LBool(s.Rotated))
+		st.RawSetString("offset_x", golua.LNumber(s.OffsetX))
+		st.RawSetString("offset_y", golua.LNumber(s.OffsetY))
+		st.RawSetString("source_width", golua.LNumber(s.SourceWidth))
+		st.RawSetString("source_height", golua.LNumber(s.SourceHeight))
+		sprites.RawSetInt(i+1, st)
+	}
+	t.RawSetString("sprites", sprites)
+
+	t.RawSetString("rotation", golua.LNumber(atlas.Rotation))
+
+	return t
+}
+
+func atlasBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) *imageutil.Atlas {
+	number := func(t *golua.LTable, key string) int {
+		n, ok := t.RawGetString(key).(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("atlas field %s must be a number", log.LEVEL_ERROR, key))
+		}
+		return int(n)
+	}
+	table := func(t *golua.LTable, key string) *golua.LTable {
+		v, ok := t.RawGetString(key).(*golua.LTable)
+		if !ok {
+			lua.Error(state, lg.Appendf("atlas field %s must be a table", log.LEVEL_ERROR, key))
+		}
+		return v
+	}
+
+	atlas := &imageutil.Atlas{
+		Rotation: imageutil.AtlasRotation(number(t, "rotation")),
+	}
+
+	pages := table(t, "pages")
+	for i := range pages.Len() {
+		pt, ok := pages.RawGetInt(i + 1).(*golua.LTable)
+		if !ok {
+			lua.Error(state, lg.Append("atlas pages must be tables", log.LEVEL_ERROR))
+		}
+
+		atlas.Pages = append(atlas.Pages, imageutil.AtlasPage{
+			Name:   pt.RawGetString("name").String(),
+			Width:  number(pt, "width"),
+			Height: number(pt, "height"),
+		})
+	}
+
+	sprites := table(t, "sprites")
+	for i := range sprites.Len() {
+		st, ok := sprites.RawGetInt(i + 1).(*golua.LTable)
+		if !ok {
+			lua.Error(state, lg.Append("atlas sprites must be tables", log.LEVEL_ERROR))
+		}
+
+		atlas.Sprites = append(atlas.Sprites, imageutil.AtlasSprite{
+			Name:    st.RawGetString("name").String(),
+			Page:    number(st, "page") - 1,
+			X:       number(st, "x"),
+			Y:       number(st, "y"),
+			Width:   number(st, "width"),
+			Height:  number(st, "height"),
+			Rotated: golua.LVAsBool(st.RawGetString("rotated")),
+
+			OffsetX:      number(st, "offset_x"),
+			OffsetY:      number(st, "offset_y"),
+			SourceWidth:  number(st, "source_width"),
+			SourceHeight: number(st, "source_height"),
+		})
+	}
+
+	return atlas
 }
 
 func spritesheetOffsetTable(state *golua.LState) *golua.LTable {
@@ -48,15 +48,20 @@ func RegisterTest(r *lua.Runner, lg *log.Logger) {
 			return 0
 		})
 
-	/// @func assert_image(img1, img2, msg?)
+	/// @func assert_image(img1, img2, msg?, tolerance?)
 	/// @arg img1 {int<collection.IMAGE>}
 	/// @arg img2 {int<collection.IMAGE>}
 	/// @arg? msg {string}
+	/// @arg? tolerance {struct<test.Tolerance>}
+	/// @desc
+	/// Without a tolerance the images must match exactly,
+	/// otherwise they are compared with the same metrics as image.compare_metrics.
 	lib.CreateFunction(tab, "assert_image",
 		[]lua.Arg{
 			{Type: lua.INT, Name: "img1"},
 			{Type: lua.INT, Name: "img2"},
 			{Type: lua.STRING, Name: "msg", Optional: true},
+			{Type: lua.RAW_TABLE, Name: "tolerance", Optional: true},
 		},
 		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
 			img1 := args["img1"].(int)
@@ -66,6 +71,7 @@ func RegisterTest(r *lua.Runner, lg *log.Logger) {
 			}
 
 			msg := args["msg"].(string)
+			tolerance, exact := toleranceBuild(state, lg, args["tolerance"].(*golua.LTable))
 
 			var img image.Image
 			imgReady := make(chan struct{}, 2)
@@ -77,7 +83,7 @@ func RegisterTest(r *lua.Runner, lg *log.Logger) {
 				Fn: func(i *collection.Item[collection.ItemImage]) {
 					img = i.Self.Image
 					imgReady <- struct{}{}
-					<-imgFinished
+					i.Wait(imgFinished)
 				},
 				Fail: func(i *collection.Item[collection.ItemImage]) {
 					imgReady <- struct{}{}
@@ -89,15 +95,31 @@ func RegisterTest(r *lua.Runner, lg *log.Logger) {
 				Lib:  d.Lib,
 				Name: d.Name,
 				Fn: func(i *collection.Item[collection.ItemImage]) {
-					<-imgReady
-					equal := imageutil.ImageCompare(img, i.Self.Image)
+					i.Wait(imgReady)
 
-					if !equal {
-						if msg != "" {
-							state.Error(golua.LString(lg.Append(fmt.Sprintf("assertion failed: %s", msg), log.LEVEL_ERROR)), 0)
-							return
+					if exact {
+						equal := imageutil.ImageCompare(img, i.Self.Image)
+
+						if !equal {
+							if msg != "" {
+								state.Error(golua.LString(lg.Append(fmt.Sprintf("assertion failed: %s", msg), log.LEVEL_ERROR)), 0)
+								return
+							}
+							state.Error(golua.LString("assertion failed"), 0)
+						}
+					} else {
+						result, _, err := imageutil.ImageCompareMetrics(img, i.Self.Image, tolerance.Threshold, false)
+						if err == nil {
+							err = tolerance.Check(result)
+						}
+
+						if err != nil {
+							if msg != "" {
+								state.Error(golua.LString(lg.Append(fmt.Sprintf("assertion failed: %s (%s)", msg, err), log.LEVEL_ERROR)), 0)
+								return
+							}
+							state.Error(golua.LString(lg.Append(fmt.Sprintf("assertion failed: %s", err), log.LEVEL_ERROR)), 0)
 						}
-						state.Error(golua.LString("assertion failed"), 0)
 					}
 
 					imgFinished <- struct{}{}
@@ -234,3 +256,47 @@ func validateSchema(value, schema *golua.LTable) bool {
 
 	return valid
 }
+
+// toleranceBuild parses the tolerance table for assert_image,
+// exact is true when the table is empty.
+func toleranceBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) (imageutil.CompareTolerance, bool) {
+	/// @struct Tolerance
+	/// @prop? min_psnr {float}
+	/// @prop? min_ssim {float}
+	/// @prop? max_delta_e_mean {float}
+	/// @prop? max_delta_e {float}
+	/// @prop? max_differing {int} - The most pixels allowed to have a difference above the threshold.
+	/// @prop? threshold {float} - The CIEDE2000 delta-e a pixel must be above to count as differing, defaults to 0.
+
+	tolerance := imageutil.DefaultCompareTolerance()
+	exact := true
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+		exact = false
+
+		n, ok := v.(golua.LNumber)
+		if !ok {
+			lua.Error(state, lg.Appendf("tolerance %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+		}
+
+		switch key {
+		case "min_psnr":
+			tolerance.MinPSNR = float64(n)
+		case "min_ssim":
+			tolerance.MinSSIM = float64(n)
+		case "max_delta_e_mean":
+			tolerance.MaxDeltaEMean = float64(n)
+		case "max_delta_e":
+			tolerance.MaxDeltaE = float64(n)
+		case "max_differing":
+			tolerance.MaxDiffering = int(n)
+		case "threshold":
+			tolerance.Threshold = float64(n)
+		default:
+			lua.Error(state, lg.Appendf("unknown tolerance: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	return tolerance, exact
+}
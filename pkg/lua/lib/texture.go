@@ -0,0 +1,432 @@
+package lib
+
+import (
+	"image"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	imageutil "github.com/ArtificialLegacy/imgscal/pkg/image_util"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua"
+	golua "github.com/yuin/gopher-lua"
+)
+
+const LIB_TEXTURE = "texture"
+
+/// @lib Texture
+/// @import texture
+/// @desc
+/// Library for deriving game ready texture maps from images, and making them tileable.
+
+func RegisterTexture(r *lua.Runner, lg *log.Logger) {
+	lib, tab := lua.NewLib(LIB_TEXTURE, r, r.State, lg)
+
+	/// @func normal_map(id, name, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>} - The height map, using the luma of each pixel.
+	/// @arg name {string}
+	/// @arg? options {struct<texture.NormalOptions>}
+	/// @returns {int<collection.IMAGE>} - A new tangent space normal map, using the NRGBA color model.
+	lib.CreateFunction(tab, "normal_map",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := normalOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			id := textureDerive(r, lg, state, d, args["id"].(int), args["name"].(string), func(src *collection.ItemImage) (image.Image, imageutil.ColorModel) {
+				return imageutil.NormalMap(src.Image, opts), imageutil.MODEL_NRGBA
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func height_from_normal(id, name, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>} - The tangent space normal map.
+	/// @arg name {string}
+	/// @arg? options {struct<texture.HeightOptions>}
+	/// @returns {int<collection.IMAGE>} - A new height map, using the GRAY16 color model.
+	/// @desc
+	/// The height is recovered by integrating the slopes of the normals,
+	/// and is stretched to use the full range as the original scale is lost.
+	lib.CreateFunction(tab, "height_from_normal",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := heightOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			id := textureDerive(r, lg, state, d, args["id"].(int), args["name"].(string), func(src *collection.ItemImage) (image.Image, imageutil.ColorModel) {
+				return imageutil.HeightFromNormal(src.Image, opts), imageutil.MODEL_GRAY16
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func ambient_occlusion(id, name, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>} - The height map, using the luma of each pixel.
+	/// @arg name {string}
+	/// @arg? options {struct<texture.AOOptions>}
+	/// @returns {int<collection.IMAGE>} - A new occlusion map using the GRAY color model, white is unoccluded.
+	/// @desc
+	/// Approximates ambient occlusion by finding how far the surrounding heights rise above each pixel.
+	lib.CreateFunction(tab, "ambient_occlusion",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := aoOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			id := textureDerive(r, lg, state, d, args["id"].(int), args["name"].(string), func(src *collection.ItemImage) (image.Image, imageutil.ColorModel) {
+				return imageutil.AmbientOcclusion(src.Image, opts), imageutil.MODEL_GRAY
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func sdf(id, name, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>} - The mask, using the alpha of each pixel.
+	/// @arg name {string}
+	/// @arg? options {struct<texture.SDFOptions>}
+	/// @returns {int<collection.IMAGE>} - A new signed distance field, using the GRAY color model.
+	/// @desc
+	/// The edge of the mask is at 128, pixels inside the mask are brighter.
+	/// A distance of spread from the edge reaches 255 inside or 0 outside.
+	lib.CreateFunction(tab, "sdf",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := sdfOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			id := textureDerive(r, lg, state, d, args["id"].(int), args["name"].(string), func(src *collection.ItemImage) (image.Image, imageutil.ColorModel) {
+				return imageutil.SignedDistanceField(src.Image, opts), imageutil.MODEL_GRAY
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func seamless(id, name, options?) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg? options {struct<texture.SeamlessOptions>}
+	/// @returns {int<collection.IMAGE>} - A new tileable image, using the NRGBA color model.
+	/// @desc
+	/// Creates a version of the image that tiles without visible seams.
+	/// texture.SEAMLESS_MIRROR doubles the size of the image,
+	/// and texture.SEAMLESS_QUILT rounds the size to a whole number of patches.
+	/// The result can be repeated with context.pattern_surface, or checked with texture.preview_tiled.
+	lib.CreateFunction(tab, "seamless",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.RAW_TABLE, Name: "options", Optional: true},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			opts := seamlessOptionsBuild(state, lg, args["options"].(*golua.LTable))
+
+			id := textureDerive(r, lg, state, d, args["id"].(int), args["name"].(string), func(src *collection.ItemImage) (image.Image, imageutil.ColorModel) {
+				return imageutil.Seamless(src.Image, opts), imageutil.MODEL_NRGBA
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @func preview_tiled(id, name, nx, ny) -> int<collection.IMAGE>
+	/// @arg id {int<collection.IMAGE>}
+	/// @arg name {string}
+	/// @arg nx {int} - The number of times to repeat the image horizontally.
+	/// @arg ny {int} - The number of times to repeat the image vertically.
+	/// @returns {int<collection.IMAGE>} - A new image using the same color model, for inspecting seams.
+	lib.CreateFunction(tab, "preview_tiled",
+		[]lua.Arg{
+			{Type: lua.INT, Name: "id"},
+			{Type: lua.STRING, Name: "name"},
+			{Type: lua.INT, Name: "nx"},
+			{Type: lua.INT, Name: "ny"},
+		},
+		func(state *golua.LState, d lua.TaskData, args map[string]any) int {
+			nx, ny := args["nx"].(int), args["ny"].(int)
+			if nx < 1 || ny < 1 {
+				lua.Error(state, lg.Appendf("tile counts must be at least 1, got: %dx%d", log.LEVEL_ERROR, nx, ny))
+			}
+
+			id := textureDerive(r, lg, state, d, args["id"].(int), args["name"].(string), func(src *collection.ItemImage) (image.Image, imageutil.ColorModel) {
+				return imageutil.CopyImage(imageutil.TilePreview(src.Image, nx, ny), src.Model), src.Model
+			})
+
+			state.Push(golua.LNumber(id))
+			return 1
+		})
+
+	/// @constants NormalKernel {int}
+	/// @const NORMALKERNEL_SOBEL
+	/// @const NORMALKERNEL_SCHARR - More accurate for diagonal slopes.
+	tab.RawSetString("NORMALKERNEL_SOBEL", golua.LNumber(imageutil.NORMALKERNEL_SOBEL))
+	tab.RawSetString("NORMALKERNEL_SCHARR", golua.LNumber(imageutil.NORMALKERNEL_SCHARR))
+
+	/// @constants NormalConvention {int}
+	/// @const NORMALCONVENTION_OPENGL - Green points up, used by Blender, Godot and Unity.
+	/// @const NORMALCONVENTION_DIRECTX - Green points down, used by Unreal.
+	tab.RawSetString("NORMALCONVENTION_OPENGL", golua.LNumber(imageutil.NORMALCONVENTION_OPENGL))
+	tab.RawSetString("NORMALCONVENTION_DIRECTX", golua.LNumber(imageutil.NORMALCONVENTION_DIRECTX))
+
+	/// @constants SDFAlgorithm {int}
+	/// @const SDF_8SSEDT - 8 point sequential signed euclidean distance transform, can be slightly off for some shapes.
+	/// @const SDF_FELZENSZWALB - Exact euclidean distance transform.
+	tab.RawSetString("SDF_8SSEDT", golua.LNumber(imageutil.SDF_8SSEDT))
+	tab.RawSetString("SDF_FELZENSZWALB", golua.LNumber(imageutil.SDF_FELZENSZWALB))
+
+	/// @constants SeamlessMode {int}
+	/// @const SEAMLESS_BLEND - Offsets the image by half its size, and blends the original back over the seams.
+	/// @const SEAMLESS_MIRROR - Places the image next to mirrored copies of itself, doubling the size.
+	/// @const SEAMLESS_QUILT - Rebuilds the image from random overlapping patches, joined along the cuts with the least difference. Images smaller than 2x2 use texture.SEAMLESS_BLEND instead.
+	tab.RawSetString("SEAMLESS_BLEND", golua.LNumber(imageutil.SEAMLESS_BLEND))
+	tab.RawSetString("SEAMLESS_MIRROR", golua.LNumber(imageutil.SEAMLESS_MIRROR))
+	tab.RawSetString("SEAMLESS_QUILT", golua.LNumber(imageutil.SEAMLESS_QUILT))
+}
+
+// textureDerive schedules fn on the image, adding the result as a new image without blocking.
+func textureDerive(r *lua.Runner, lg *log.Logger, state *golua.LState, d lua.TaskData, src int, name string, fn func(src *collection.ItemImage) (image.Image, imageutil.ColorModel)) int {
+	var img image.Image
+	var encoding imageutil.ImageEncoding
+	var model imageutil.ColorModel
+	ready := make(chan struct{}, 1)
+
+	r.IC.Schedule(state, src, &collection.Task[collection.ItemImage]{
+		Lib:  d.Lib,
+		Name: d.Name,
+		Fn: func(i *collection.Item[collection.ItemImage]) {
+			img, model = fn(i.Self)
+			encoding = i.Self.Encoding
+			ready <- struct{}{}
+		},
+		Fail: func(i *collection.Item[collection.ItemImage]) {
+			ready <- struct{}{}
+		},
+	})
+
+	return r.IC.ScheduleAdd(state, name, lg, d.Lib, d.Name, func(i *collection.Item[collection.ItemImage]) {
+		i.Wait(ready)
+		i.Self = &collection.ItemImage{
+			Name:     name,
+			Image:    img,
+			Encoding: encoding,
+			Model:    model,
+		}
+	})
+}
+
+// textureNumber reads a number option, erroring when the value has another type.
+func textureNumber(state *golua.LState, lg *log.Logger, key string, v golua.LValue) float64 {
+	n, ok := v.(golua.LNumber)
+	if !ok {
+		lua.Error(state, lg.Appendf("texture option %s must be a number, got: %s", log.LEVEL_ERROR, key, v.Type()))
+	}
+	return float64(n)
+}
+
+func textureBool(state *golua.LState, lg *log.Logger, key string, v golua.LValue) bool {
+	b, ok := v.(golua.LBool)
+	if !ok {
+		lua.Error(state, lg.Appendf("texture option %s must be a boolean, got: %s", log.LEVEL_ERROR, key, v.Type()))
+	}
+	return bool(b)
+}
+
+func normalOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.NormalOptions {
+	/// @struct NormalOptions
+	/// @prop kernel {int<texture.NormalKernel>} - Defaults to texture.NORMALKERNEL_SOBEL.
+	/// @prop convention {int<texture.NormalConvention>} - Defaults to texture.NORMALCONVENTION_OPENGL.
+	/// @prop strength {float} - Scales the slopes, must be greater than 0. Defaults to 4.
+	/// @prop wrap {bool} - Samples across the edges of the image, for tileable textures. Defaults to false.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultNormalOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "kernel":
+			opts.Kernel = imageutil.NormalKernel(textureNumber(state, lg, key, v))
+		case "convention":
+			opts.Convention = imageutil.NormalConvention(textureNumber(state, lg, key, v))
+		case "strength":
+			opts.Strength = textureNumber(state, lg, key, v)
+		case "wrap":
+			opts.Wrap = textureBool(state, lg, key, v)
+		default:
+			lua.Error(state, lg.Appendf("unknown normal option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid normal options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func heightOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.HeightOptions {
+	/// @struct HeightOptions
+	/// @prop convention {int<texture.NormalConvention>} - Defaults to texture.NORMALCONVENTION_OPENGL.
+	/// @prop iterations {int} - Iterations of the solver, more recover larger shapes but are slower. Defaults to 256.
+	/// @prop wrap {bool} - Treats the normal map as tileable. Defaults to false.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultHeightOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "convention":
+			opts.Convention = imageutil.NormalConvention(textureNumber(state, lg, key, v))
+		case "iterations":
+			opts.Iterations = int(textureNumber(state, lg, key, v))
+		case "wrap":
+			opts.Wrap = textureBool(state, lg, key, v)
+		default:
+			lua.Error(state, lg.Appendf("unknown height option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid height options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func aoOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.AOOptions {
+	/// @struct AOOptions
+	/// @prop radius {int} - The distance in pixels searched for occluders. Defaults to 8.
+	/// @prop directions {int} - The number of directions searched around each pixel. Defaults to 8.
+	/// @prop depth {float} - The height in pixels of a white pixel. Defaults to 8.
+	/// @prop strength {float} - Scales the occlusion. Defaults to 1.
+	/// @prop wrap {bool} - Samples across the edges of the image, for tileable textures. Defaults to false.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultAOOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "radius":
+			opts.Radius = int(textureNumber(state, lg, key, v))
+		case "directions":
+			opts.Directions = int(textureNumber(state, lg, key, v))
+		case "depth":
+			opts.Depth = textureNumber(state, lg, key, v)
+		case "strength":
+			opts.Strength = textureNumber(state, lg, key, v)
+		case "wrap":
+			opts.Wrap = textureBool(state, lg, key, v)
+		default:
+			lua.Error(state, lg.Appendf("unknown ambient occlusion option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid ambient occlusion options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func sdfOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.SDFOptions {
+	/// @struct SDFOptions
+	/// @prop algorithm {int<texture.SDFAlgorithm>} - Defaults to texture.SDF_FELZENSZWALB.
+	/// @prop spread {float} - The distance in source pixels from the edge to the ends of the range. Defaults to 8.
+	/// @prop scale {int} - Divides the size of the output, the distance is found at full size first. Defaults to 1.
+	/// @prop threshold {int} - The alpha a pixel needs to be inside the mask. Defaults to 128.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+
+	opts := imageutil.DefaultSDFOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "algorithm":
+			opts.Algorithm = imageutil.SDFAlgorithm(textureNumber(state, lg, key, v))
+		case "spread":
+			opts.Spread = textureNumber(state, lg, key, v)
+		case "scale":
+			opts.Scale = int(textureNumber(state, lg, key, v))
+		case "threshold":
+			threshold := int(textureNumber(state, lg, key, v))
+			if threshold < 0 || threshold > 255 {
+				lua.Error(state, lg.Appendf("sdf threshold must be between 0 and 255, got: %d", log.LEVEL_ERROR, threshold))
+			}
+			opts.Threshold = uint8(threshold)
+		default:
+			lua.Error(state, lg.Appendf("unknown sdf option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid sdf options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
+
+func seamlessOptionsBuild(state *golua.LState, lg *log.Logger, t *golua.LTable) imageutil.SeamlessOptions {
+	/// @struct SeamlessOptions
+	/// @prop mode {int<texture.SeamlessMode>} - Defaults to texture.SEAMLESS_BLEND.
+	/// @prop border {int} - The width of the blend from the edges for texture.SEAMLESS_BLEND. Defaults to 32.
+	/// @prop patch_size {int} - The size of each patch for texture.SEAMLESS_QUILT. Defaults to 64.
+	/// @prop overlap {int} - How much the patches overlap for texture.SEAMLESS_QUILT. Defaults to 16.
+	/// @prop candidates {int} - The number of random patches compared when placing each patch. Defaults to 128.
+	/// @prop seed {int} - Defaults to 0.
+	/// @desc
+	/// All fields are optional, unknown fields will cause an error.
+	/// Sizes are reduced to fit within half of the image.
+
+	opts := imageutil.DefaultSeamlessOptions()
+
+	t.ForEach(func(k, v golua.LValue) {
+		key := k.String()
+
+		switch key {
+		case "mode":
+			opts.Mode = imageutil.SeamlessMode(textureNumber(state, lg, key, v))
+		case "border":
+			opts.Border = int(textureNumber(state, lg, key, v))
+		case "patch_size":
+			opts.PatchSize = int(textureNumber(state, lg, key, v))
+		case "overlap":
+			opts.Overlap = int(textureNumber(state, lg, key, v))
+		case "candidates":
+			opts.Candidates = int(textureNumber(state, lg, key, v))
+		case "seed":
+			opts.Seed = int64(textureNumber(state, lg, key, v))
+		default:
+			lua.Error(state, lg.Appendf("unknown seamless option: %s", log.LEVEL_ERROR, key))
+		}
+	})
+
+	if err := opts.Validate(); err != nil {
+		lua.Error(state, lg.Appendf("invalid seamless options: %s", log.LEVEL_ERROR, err))
+	}
+
+	return opts
+}
@@ -39,11 +39,20 @@ type Runner struct {
 
 	Failed string
 
-	Wg  *sync.WaitGroup
-	Ctx context.Context
+	Wg        *sync.WaitGroup
+	Ctx       context.Context
+	Scheduler *collection.Scheduler
+	// sharedScheduler is set by UseScheduler, its limit is left to the owner instead of being set by Run.
+	sharedScheduler bool
 
 	CMDParser *argparse.Parser
 	CLIMode   bool
+	// CLIArgs are parsed by the cmd library, the first value is the workflow name and is skipped.
+	CLIArgs []string
+
+	BatchMode   bool
+	BatchInput  string
+	BatchOutput string
 
 	// -- collections
 	TC *collection.Collection[collection.ItemTask]
@@ -64,22 +73,25 @@ type Runner struct {
 
 func NewRunner(state *lua.LState, lg *log.Logger, cliMode bool) Runner {
 	wg := &sync.WaitGroup{}
+	sched := collection.NewScheduler(0)
 	return Runner{
 		State: state,
 		lg:    lg,
 
 		Libraries: []string{},
 
-		Wg: wg,
+		Wg:        wg,
+		Scheduler: sched,
 
 		CMDParser: argparse.NewParser("imgscal", ""),
 		CLIMode:   cliMode,
+		CLIArgs:   os.Args[1:],
 
 		// -- collections
-		IC: collection.NewCollection[collection.ItemImage](lg, wg, collection.TYPE_IMAGE),
-		CC: collection.NewCollection[collection.ItemContext](lg, wg, collection.TYPE_CONTEXT),
-		QR: collection.NewCollection[collection.ItemQR](lg, wg, collection.TYPE_QR),
-		TC: collection.NewCollection[collection.ItemTask](lg, wg, collection.TYPE_TASK),
+		IC: collection.NewCollection[collection.ItemImage](lg, wg, collection.TYPE_IMAGE).UseScheduler(sched),
+		CC: collection.NewCollection[collection.ItemContext](lg, wg, collection.TYPE_CONTEXT).UseScheduler(sched),
+		QR: collection.NewCollection[collection.ItemQR](lg, wg, collection.TYPE_QR).UseScheduler(sched),
+		TC: collection.NewCollection[collection.ItemTask](lg, wg, collection.TYPE_TASK).UseScheduler(sched),
 
 		// -- crates
 		CR_WIN: collection.NewCrate[giu.MasterWindow](),
@@ -105,6 +117,18 @@ func NewRunner(state *lua.LState, lg *log.Logger, cliMode bool) Runner {
 	}
 }
 
+// UseScheduler replaces the scheduler of the runner's collections,
+// so runners sharing a scheduler are limited together.
+// It must be called before any items are added, and Run won't change the limit of the scheduler.
+func (r *Runner) UseScheduler(sched *collection.Scheduler) {
+	r.Scheduler = sched
+	r.sharedScheduler = true
+	r.IC.UseScheduler(sched)
+	r.CC.UseScheduler(sched)
+	r.QR.UseScheduler(sched)
+	r.TC.UseScheduler(sched)
+}
+
 const luapath = "%[1]s/?/?.lua;%[1]s/?/init.lua;%[1]s/?.lua"
 
 func (r *Runner) Run(file string, plugins PluginMap) error {
@@ -116,6 +140,9 @@ func (r *Runner) Run(file string, plugins PluginMap) error {
 	}()
 
 	r.Dir = path.Dir(file)
+	if !r.sharedScheduler {
+		r.Scheduler.SetLimit(r.Config.MaxWorkers)
+	}
 
 	pkg := r.State.GetField(r.State.Get(lua.EnvironIndex), "package")
 	r.State.SetField(pkg, "path", lua.LString(fmt.Sprintf(luapath, r.Dir)+";"+fmt.Sprintf(luapath, r.Config.PluginDirectory)))
@@ -179,6 +206,9 @@ func (r *Runner) WorkflowInit(name string, lg *log.Logger, plugins PluginMap) *l
 	t := r.State.NewTable()
 
 	t.RawSetString("is_cli", lua.LBool(r.CLIMode))
+	t.RawSetString("is_batch", lua.LBool(r.BatchMode))
+	t.RawSetString("batch_input", lua.LString(r.BatchInput))
+	t.RawSetString("batch_output", lua.LString(r.BatchOutput))
 
 	t.RawSetString("debug", r.State.NewFunction(func(l *lua.LState) int {
 		lua.OpenDebug(r.State)
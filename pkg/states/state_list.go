@@ -12,6 +12,7 @@ const (
 	STATE_WORKFLOW_HELP
 	STATE_WORKFLOW_CMD
 	STATE_WORKFLOW_CMDLIST
+	STATE_WORKFLOW_BATCH
 
 	STATE_COUNT
 )
@@ -105,6 +105,10 @@ func viewConfig(cfg *config.Config) {
 		"disable_logs",
 		"always_confirm",
 		"disable_bell",
+		"max_workers",
+		"decode_max_pixels",
+		"decode_max_bytes",
+		"decode_max_frames",
 	}
 
 	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Underline(true)
@@ -120,6 +124,10 @@ func viewConfig(cfg *config.Config) {
 		fmt.Sprintf("%s%t%s", dlColor, cfg.DisableLogs, cli.COLOR_RESET),
 		fmt.Sprintf("%s%t%s", acColor, cfg.AlwaysConfirm, cli.COLOR_RESET),
 		fmt.Sprintf("%s%t%s", dbColor, cfg.DisableBell, cli.COLOR_RESET),
+		fmt.Sprintf("%s%d%s", cli.COLOR_YELLOW, cfg.MaxWorkers, cli.COLOR_RESET),
+		fmt.Sprintf("%s%d%s", cli.COLOR_YELLOW, cfg.DecodeMaxPixels, cli.COLOR_RESET),
+		fmt.Sprintf("%s%d%s", cli.COLOR_YELLOW, cfg.DecodeMaxBytes, cli.COLOR_RESET),
+		fmt.Sprintf("%s%d%s", cli.COLOR_YELLOW, cfg.DecodeMaxFrames, cli.COLOR_RESET),
 	}
 
 	strFields := ""
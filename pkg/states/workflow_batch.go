@@ -0,0 +1,323 @@
+package states
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ArtificialLegacy/imgscal/pkg/cli"
+	"github.com/ArtificialLegacy/imgscal/pkg/collection"
+	"github.com/ArtificialLegacy/imgscal/pkg/log"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua"
+	"github.com/ArtificialLegacy/imgscal/pkg/lua/lib"
+	"github.com/ArtificialLegacy/imgscal/pkg/statemachine"
+	"github.com/ArtificialLegacy/imgscal/pkg/workflow"
+	golua "github.com/yuin/gopher-lua"
+)
+
+type WorkflowBatchData struct {
+	Name   string
+	Input  string
+	Output string
+	Jobs   int
+	// Args are passed to the cmd library of every run.
+	Args []string
+}
+
+type batchResult struct {
+	File string
+	Err  error
+}
+
+func WorkflowBatchEnter(sm *statemachine.StateMachine, data WorkflowBatchData) {
+	sm.SetState(STATE_WORKFLOW_BATCH)
+	sm.Data = data
+}
+
+func WorkflowBatch(sm *statemachine.StateMachine) error {
+	data := sm.Data.(WorkflowBatchData)
+	sm.Data = nil
+
+	wf, errlist, err := workflow.WorkflowList(sm.Config.WorkflowDirectory)
+	if err != nil {
+		fmt.Printf("failed to scan for workflows: %s\n", err)
+		os.Exit(1)
+	}
+	if len(*errlist) > 0 {
+		fmt.Printf("failed to scan for workflows: %+v\n", *errlist)
+		os.Exit(1)
+	}
+
+	foundPath, foundWf, err := findCliWorkflow(*wf, data.Name)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+
+	if foundWf.APIVersion > workflow.API_VERSION {
+		fmt.Printf("Workflow %s has a newer API version than supported: %d. Current API: %d\n", foundWf.Name, foundWf.APIVersion, workflow.API_VERSION)
+		os.Exit(1)
+	}
+
+	files, err := globFiles(data.Input)
+	if err != nil {
+		fmt.Printf("invalid input glob %s: %s\n", data.Input, err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Printf("no files matched input glob: %s\n", data.Input)
+		os.Exit(1)
+	}
+
+	output := data.Output
+	if output == "" {
+		output = path.Join(sm.Config.OutputDirectory, data.Name)
+	}
+	err = os.MkdirAll(output, 0o777)
+	if err != nil {
+		fmt.Printf("failed to create output directory %s: %s\n", output, err)
+		os.Exit(1)
+	}
+
+	jobs := data.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(files) {
+		jobs = len(files)
+	}
+
+	luaPth := path.Join(sm.Config.WorkflowDirectory, foundPath)
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-signalChan:
+			fmt.Printf("%suser force quit, stopping batch%s\n", cli.COLOR_RED, cli.COLOR_RESET)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// the runs share a scheduler, so the jobs split max_workers between them instead of each using every cpu.
+	sched := collection.NewScheduler(sm.Config.MaxWorkers)
+
+	queue := make(chan string)
+	results := make(chan batchResult)
+	wg := sync.WaitGroup{}
+
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for file := range queue {
+				results <- batchResult{
+					File: file,
+					Err:  workflowBatchRun(ctx, sm, sched, luaPth, data, file, output),
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+
+		for _, file := range files {
+			select {
+			case queue <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	done := 0
+	failed := 0
+	for res := range results {
+		done++
+
+		if res.Err != nil {
+			failed++
+			fmt.Printf("[%d/%d] %sFAIL%s %s: %s\n", done, len(files), cli.COLOR_RED, cli.COLOR_RESET, res.File, res.Err)
+		} else {
+			fmt.Printf("[%d/%d] %sOK%s   %s\n", done, len(files), cli.COLOR_GREEN, cli.COLOR_RESET, res.File)
+		}
+	}
+
+	skipped := len(files) - done
+	fmt.Printf("\nbatch finished: %d succeeded, %d failed, %d skipped\n", done-failed, failed, skipped)
+
+	if failed > 0 || skipped > 0 {
+		os.Exit(1)
+	}
+
+	sm.SetState(STATE_EXIT)
+	return nil
+}
+
+func workflowBatchRun(ctx context.Context, sm *statemachine.StateMachine, sched *collection.Scheduler, luaPth string, data WorkflowBatchData, file, output string) (err error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var lg log.Logger
+
+	if sm.Config.DisableLogs {
+		lg = log.NewLoggerEmpty()
+	} else {
+		lg = log.NewLoggerBase("batch", sm.Config.LogDirectory, false)
+	}
+	defer lg.Close()
+
+	lg.Append(fmt.Sprintf("log started for workflow_batch: %s", file), log.LEVEL_SYSTEM)
+	state := golua.NewState(golua.Options{
+		SkipOpenLibs: false,
+	})
+	defer state.Close()
+
+	state.SetContext(ctx)
+	collection.CreateContext(state)
+
+	runner := lua.NewRunner(state, &lg, true)
+	runner.UseScheduler(sched)
+	runner.CLIArgs = append([]string{data.Name}, data.Args...)
+	runner.Config = sm.Config
+	runner.Entry = data.Name
+	runner.Ctx = ctx
+	runner.BatchMode = true
+	runner.BatchInput = file
+	runner.BatchOutput = output
+
+	defer func() {
+		if p := recover(); p != nil {
+			lg.Append(fmt.Sprintf("panic recovered: %+v", p), log.LEVEL_ERROR)
+			err = fmt.Errorf("%+v", p)
+		}
+	}()
+
+	err = runner.Run(luaPth, lib.Builtins)
+	runner.Wg.Wait()
+
+	runnerClean(&runner, state)
+
+	if runner.Failed != "" {
+		lg.Append(fmt.Sprintf("error occured while running script: %s", runner.Failed), log.LEVEL_ERROR)
+		return fmt.Errorf("%s", runner.Failed)
+	}
+	if err != nil {
+		lg.Append(fmt.Sprintf("error occured while running script: %s", err), log.LEVEL_ERROR)
+		return err
+	}
+
+	for _, errs := range [][]error{runner.TC.Errs, runner.IC.Errs, runner.CC.Errs, runner.QR.Errs} {
+		for _, e := range errs {
+			if e != nil {
+				lg.Append(fmt.Sprintf("error occured within collection: %s", e), log.LEVEL_ERROR)
+				return fmt.Errorf("error occurred within collection: %s", e)
+			}
+		}
+	}
+
+	lg.Append("workflow finished", log.LEVEL_INFO)
+	return nil
+}
+
+// globFiles expands a glob pattern into a sorted list of file paths.
+// In addition to the syntax of path.Match, a "**" segment matches any number of directories.
+func globFiles(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+
+	segments := strings.Split(pattern, "/")
+	root := []string{}
+	for len(segments) > 1 && !hasMeta(segments[0]) {
+		root = append(root, segments[0])
+		segments = segments[1:]
+	}
+
+	base := strings.Join(root, "/")
+	if base == "" {
+		if strings.HasPrefix(pattern, "/") {
+			base = "/"
+		} else {
+			base = "."
+		}
+	}
+
+	for _, seg := range segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	files := []string{}
+	err := filepath.WalkDir(base, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, pth)
+		if err != nil {
+			return err
+		}
+
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			files = append(files, pth)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func hasMeta(segment string) bool {
+	return strings.ContainsAny(segment, "*?[\\")
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], name[0])
+	if !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], name[1:])
+}
@@ -29,20 +29,32 @@ func WorkflowCMD(sm *statemachine.StateMachine) error {
 		return err
 	}
 
-	foundPath := ""
-	var foundWf *workflow.Workflow
-	for _, w := range *wf {
+	foundPath, foundWf, err := findCliWorkflow(*wf, name)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		sm.SetState(STATE_EXIT)
+		return err
+	}
+
+	if foundWf.APIVersion > workflow.API_VERSION {
+		fmt.Printf("Workflow %s has a newer API version than supported: %d. Current API: %d\n", foundWf.Name, foundWf.APIVersion, workflow.API_VERSION)
+		sm.SetState(STATE_EXIT)
+		return err
+	}
+
+	WorkflowRunEnter(sm, WorkflowRunData{Script: foundPath, Name: name})
+	return nil
+}
+
+func findCliWorkflow(wfs []*workflow.Workflow, name string) (string, *workflow.Workflow, error) {
+	for _, w := range wfs {
 		if w.Name == name {
 			found, ok := w.CliWorkflows["*"]
 			if !ok {
-				fmt.Printf("cannot use workflow base name when there is no star workflow: %s\n", err)
-				sm.SetState(STATE_EXIT)
-				return err
+				return "", nil, fmt.Errorf("cannot use workflow base name when there is no star workflow: %s", name)
 			}
 
-			foundWf = w
-			foundPath = path.Join(path.Dir(w.Base), found)
-			break
+			return path.Join(path.Dir(w.Base), found), w, nil
 		}
 
 		if !strings.HasPrefix(name, path.Base(path.Dir(w.Base))) {
@@ -54,17 +66,8 @@ func WorkflowCMD(sm *statemachine.StateMachine) error {
 			continue
 		}
 
-		foundWf = w
-		foundPath = path.Join(path.Dir(w.Base), found)
-		break
+		return path.Join(path.Dir(w.Base), found), w, nil
 	}
 
-	if foundWf.APIVersion > workflow.API_VERSION {
-		fmt.Printf("Workflow %s has a newer API version than supported: %d. Current API: %d\n", foundWf.Name, foundWf.APIVersion, workflow.API_VERSION)
-		sm.SetState(STATE_EXIT)
-		return err
-	}
-
-	WorkflowRunEnter(sm, WorkflowRunData{Script: foundPath, Name: name})
-	return nil
+	return "", nil, fmt.Errorf("workflow not found: %s", name)
 }
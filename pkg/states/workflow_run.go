@@ -102,20 +102,7 @@ func WorkflowRun(sm *statemachine.StateMachine) error {
 
 	lg.Append("All collections empty, exiting", log.LEVEL_SYSTEM)
 
-	runner.CR_WIN.CleanAll()
-	runner.CR_REF.CleanAll()
-	runner.CR_GMP.CleanAll()
-	runner.CR_LIP.CleanAll()
-	runner.CR_TEA.CleanAll()
-	runner.CR_CIM.CleanAll()
-	runner.CR_SHD.CleanAll()
-	runner.CR_CED.CleanAll()
-
-	runner.TC.CollectAll(state)
-	runner.IC.CollectAll(state)
-	runner.CC.CollectAll(state)
-	runner.QR.CollectAll(state)
-	runner.Wg.Wait()
+	runnerClean(&runner, state)
 
 	if runner.Failed != "" {
 		lg.Append(fmt.Sprintf("error occured while running script: %s", runner.Failed), log.LEVEL_ERROR)
@@ -218,3 +205,20 @@ func collErr(errs []error, name, script string, lg *log.Logger, sm *statemachine
 
 	return errExists
 }
+
+func runnerClean(runner *lua.Runner, state *golua.LState) {
+	runner.CR_WIN.CleanAll()
+	runner.CR_REF.CleanAll()
+	runner.CR_GMP.CleanAll()
+	runner.CR_LIP.CleanAll()
+	runner.CR_TEA.CleanAll()
+	runner.CR_CIM.CleanAll()
+	runner.CR_SHD.CleanAll()
+	runner.CR_CED.CleanAll()
+
+	runner.TC.CollectAll(state)
+	runner.IC.CollectAll(state)
+	runner.CC.CollectAll(state)
+	runner.QR.CollectAll(state)
+	runner.Wg.Wait()
+}